@@ -0,0 +1,238 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// installOptions describe where the service is installed
+type installOptions struct {
+	Name      string
+	User      string
+	Binary    string
+	ConfigDir string
+	DataDir   string
+	Repo      string
+	HTTPPort  int
+	Enable    bool
+	DryRun    bool
+}
+
+// ConfigPath is the manager configuration the service reads
+func (o installOptions) ConfigPath() string {
+	return filepath.Join(o.ConfigDir, "config.yaml")
+}
+
+// EnvPath is the file holding secrets such as GITHUB_TOKEN
+func (o installOptions) EnvPath() string {
+	return filepath.Join(o.ConfigDir, o.Name+".env")
+}
+
+// runInstall installs the manager as a system service: it creates the
+// service user and directories, copies the binary, writes a default
+// configuration and the service definition, and enables the service
+func runInstall(args []string) int {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	opts := installOptions{}
+	flags.StringVar(&opts.Name, "name", "party", "service name")
+	flags.StringVar(&opts.User, "user", "party", "user the service runs as, created when missing")
+	flags.StringVar(&opts.Binary, "binary", "/usr/local/bin/minecraft-manager", "where the manager binary is installed")
+	flags.StringVar(&opts.ConfigDir, "config-dir", "/etc/party", "directory of the configuration")
+	flags.StringVar(&opts.DataDir, "data-dir", "/var/lib/party", "working directory holding servers, worlds and caches")
+	flags.StringVar(&opts.Repo, "repo", "", "configuration repository as owner/name, written to a new configuration")
+	flags.IntVar(&opts.HTTPPort, "port", 8080, "HTTP port written to a new configuration")
+	noEnable := flags.Bool("no-enable", false, "install without enabling and starting the service")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "print the steps without changing anything")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: minecraft-manager install [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Installs the manager as a systemd service on Linux or a launchd daemon on")
+		fmt.Fprintln(os.Stderr, "macOS. An existing configuration is kept. Must run as root.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	opts.Enable = !*noEnable
+
+	if opts.Repo != "" && !strings.Contains(opts.Repo, "/") {
+		fmt.Fprintf(os.Stderr, "invalid -repo %q (must be owner/name)\n", opts.Repo)
+		return 2
+	}
+	if !opts.DryRun && os.Geteuid() != 0 {
+		fmt.Fprintln(os.Stderr, "install must run as root (use -dry-run to see the steps)")
+		return 1
+	}
+
+	inst := &installer{dryRun: opts.DryRun, out: os.Stdout}
+	if err := installService(inst, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "install failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Println()
+	fmt.Printf("Installed %s. Next steps:\n", opts.Name)
+	fmt.Printf("  - place the Bedrock server in %s, or the archive layers in %s\n",
+		filepath.Join(opts.DataDir, "bedrock_server"), filepath.Join(opts.DataDir, "versions"))
+	fmt.Printf("  - set GITHUB_TOKEN in %s\n", opts.EnvPath())
+	fmt.Printf("  - review %s and check the host with partyctl doctor -config %s\n", opts.ConfigPath(), opts.ConfigPath())
+	return 0
+}
+
+// installer performs install steps, or only prints them in a dry run
+type installer struct {
+	dryRun bool
+	out    io.Writer
+}
+
+func (i *installer) step(format string, args ...interface{}) {
+	prefix := ""
+	if i.dryRun {
+		prefix = "(dry run) "
+	}
+	fmt.Fprintf(i.out, "%s%s\n", prefix, fmt.Sprintf(format, args...))
+}
+
+// run executes a command, showing its output when it fails
+func (i *installer) run(name string, args ...string) error {
+	i.step("Running %s %s", name, strings.Join(args, " "))
+	if i.dryRun {
+		return nil
+	}
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// mkdir creates a directory owned by the service user
+func (i *installer) mkdir(path string, mode os.FileMode, owner string) error {
+	i.step("Creating %s", path)
+	if i.dryRun {
+		return nil
+	}
+	if err := os.MkdirAll(path, mode); err != nil {
+		return err
+	}
+	if owner == "" {
+		return nil
+	}
+	return i.chown(path, owner)
+}
+
+func (i *installer) chown(path, owner string) error {
+	if i.dryRun {
+		return nil
+	}
+	output, err := exec.Command("chown", owner, path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("chown %s %s: %w: %s", owner, path, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeFile writes a file. Unless overwrite is set an existing file is kept,
+// so that reinstalling never loses configuration.
+func (i *installer) writeFile(path string, data []byte, mode os.FileMode, overwrite bool) error {
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		i.step("Keeping existing %s", path)
+		return nil
+	}
+	i.step("Writing %s", path)
+	if i.dryRun {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, mode)
+}
+
+// installBinary copies the running executable to its installed path
+func (i *installer) installBinary(path string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	if self == path {
+		i.step("Binary already installed at %s", path)
+		return nil
+	}
+	i.step("Copying %s to %s", self, path)
+	if i.dryRun {
+		return nil
+	}
+
+	data, err := os.ReadFile(self)
+	if err != nil {
+		return err
+	}
+	// Write next to the target and rename, replacing a running binary safely
+	tmp := path + ".new"
+	if err := os.WriteFile(tmp, data, 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// setupCommon creates the directories, binary and default configuration
+// shared by every service manager
+func setupCommon(inst *installer, opts installOptions, owner string) error {
+	if err := inst.mkdir(opts.ConfigDir, 0755, ""); err != nil {
+		return err
+	}
+	for _, dir := range []string{opts.DataDir, filepath.Join(opts.DataDir, "versions")} {
+		if err := inst.mkdir(dir, 0750, owner); err != nil {
+			return err
+		}
+	}
+	if err := inst.installBinary(opts.Binary); err != nil {
+		return fmt.Errorf("failed to install the binary: %w", err)
+	}
+	if err := inst.writeFile(opts.ConfigPath(), []byte(defaultConfig(opts)), 0644, false); err != nil {
+		return fmt.Errorf("failed to write the configuration: %w", err)
+	}
+	if err := inst.writeFile(opts.EnvPath(), []byte("# Secrets of the manager, e.g.\n# GITHUB_TOKEN=ghp_...\n"), 0600, false); err != nil {
+		return fmt.Errorf("failed to write the environment file: %w", err)
+	}
+	return nil
+}
+
+// defaultConfig is the configuration written on first install, with every
+// path inside the data directory
+func defaultConfig(opts installOptions) string {
+	owner, name := "your-username", "minecraft-servers-config"
+	if opts.Repo != "" {
+		owner, name, _ = strings.Cut(opts.Repo, "/")
+	}
+	return fmt.Sprintf(`github:
+  repo_owner: %q
+  repo_name: %q
+  branch: "main"
+  config_path: "servers.yaml"
+  poll_interval: 60
+
+http:
+  port: %d
+
+server:
+  base_dir: %q
+  bedrock_path: %q
+  cache_dir: %q
+  data_dir: %q
+  max_instances: 5
+  memory_limit: "1G"
+`, owner, name, opts.HTTPPort,
+		filepath.Join(opts.DataDir, "servers"),
+		filepath.Join(opts.DataDir, "bedrock_server"),
+		filepath.Join(opts.DataDir, "cache"),
+		filepath.Join(opts.DataDir, "data"))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+)
+
+// installService installs a launchd daemon. Creating users on macOS needs
+// the directory service, so the service user must exist already.
+func installService(inst *installer, opts installOptions) error {
+	if _, err := user.Lookup(opts.User); err != nil {
+		return fmt.Errorf("user %s does not exist, create it in System Settings or with sysadminctl -addUser %s, or pass -user", opts.User, opts.User)
+	}
+	inst.step("User %s exists", opts.User)
+
+	if err := setupCommon(inst, opts, opts.User); err != nil {
+		return err
+	}
+
+	label := "com.golangdaddy." + opts.Name
+	plistPath := filepath.Join("/Library/LaunchDaemons", label+".plist")
+	if err := inst.writeFile(plistPath, []byte(launchdPlist(label, opts)), 0644, true); err != nil {
+		return fmt.Errorf("failed to write the property list: %w", err)
+	}
+	if !opts.Enable {
+		return nil
+	}
+	// Reload a daemon installed before, ignoring that it may not be loaded
+	inst.run("launchctl", "bootout", "system/"+label)
+	if err := inst.run("launchctl", "bootstrap", "system", plistPath); err != nil {
+		return err
+	}
+	return inst.run("launchctl", "enable", "system/"+label)
+}
+
+// launchdPlist runs the manager from its data directory and logs to it, as
+// launchd has no journal. A shell loads the environment file first.
+func launchdPlist(label string, opts installOptions) string {
+	logPath := filepath.Join(opts.DataDir, opts.Name+".log")
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>/bin/sh</string>
+		<string>-c</string>
+		<string>set -a; . '%s'; exec '%s'</string>
+	</array>
+	<key>UserName</key>
+	<string>%s</string>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>CONFIG_PATH</key>
+		<string>%s</string>
+	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ExitTimeOut</key>
+	<integer>120</integer>
+	<key>SoftResourceLimits</key>
+	<dict>
+		<key>NumberOfFiles</key>
+		<integer>65536</integer>
+	</dict>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, label, opts.EnvPath(), opts.Binary, opts.User, opts.DataDir, opts.ConfigPath(), logPath, logPath)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+)
+
+// installService installs a systemd unit. The service user is created as a
+// system user without a login shell.
+func installService(inst *installer, opts installOptions) error {
+	if _, err := user.Lookup(opts.User); err != nil {
+		if err := inst.run("useradd", "--system", "--home-dir", opts.DataDir, "--no-create-home",
+			"--shell", "/usr/sbin/nologin", opts.User); err != nil {
+			return fmt.Errorf("failed to create user %s: %w", opts.User, err)
+		}
+	} else {
+		inst.step("User %s exists", opts.User)
+	}
+
+	if err := setupCommon(inst, opts, opts.User+":"+opts.User); err != nil {
+		return err
+	}
+
+	unitPath := filepath.Join("/etc/systemd/system", opts.Name+".service")
+	if err := inst.writeFile(unitPath, []byte(systemdUnit(opts)), 0644, true); err != nil {
+		return fmt.Errorf("failed to write the unit: %w", err)
+	}
+	if err := inst.run("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	if !opts.Enable {
+		return nil
+	}
+	return inst.run("systemctl", "enable", "--now", opts.Name+".service")
+}
+
+// systemdUnit runs the manager from its data directory, where it keeps the
+// Bedrock versions and the branch file. The stop timeout leaves servers
+// time to shut down gracefully; a second SIGTERM would kill them.
+func systemdUnit(opts installOptions) string {
+	return fmt.Sprintf(`[Unit]
+Description=Minecraft Bedrock Server Manager
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=simple
+User=%[1]s
+Group=%[1]s
+WorkingDirectory=%[2]s
+Environment=CONFIG_PATH=%[3]s
+EnvironmentFile=-%[4]s
+ExecStart=%[5]s
+KillSignal=SIGTERM
+KillMode=mixed
+TimeoutStopSec=120
+Restart=on-failure
+RestartSec=5
+LimitNOFILE=65536
+NoNewPrivileges=true
+ProtectSystem=full
+ReadWritePaths=%[2]s
+
+[Install]
+WantedBy=multi-user.target
+`, opts.User, opts.DataDir, opts.ConfigPath(), opts.EnvPath(), opts.Binary)
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// installService is not available here: the Bedrock dedicated server for
+// Windows is not supported by the manager, which relies on Unix process and
+// file system calls
+func installService(inst *installer, opts installOptions) error {
+	return fmt.Errorf("installing a service is not supported on %s, only on Linux (systemd) and macOS (launchd)", runtime.GOOS)
+}
@@ -2,22 +2,34 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
+	"minecraft-server-manager/internal/alert"
+	"minecraft-server-manager/internal/api"
 	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/egress"
 	"minecraft-server-manager/internal/github"
+	"minecraft-server-manager/internal/hooks"
+	"minecraft-server-manager/internal/logging"
+	"minecraft-server-manager/internal/metrics"
+	"minecraft-server-manager/internal/notify"
+	"minecraft-server-manager/internal/preflight"
 	"minecraft-server-manager/internal/server"
 
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "install" {
+		os.Exit(runInstall(os.Args[2:]))
+	}
+
 	// Initialize logger
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.TextFormatter{
@@ -30,35 +42,78 @@ func main() {
 		logger.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Log which branch is being used
-	logger.Infof("Using branch '%s' for configuration", cfg.GitHub.Branch)
+	// Switch the logger to the configured level, format and outputs
+	logs, err := logging.New(logger, cfg.Log)
+	if err != nil {
+		logger.Fatalf("Invalid log configuration: %v", err)
+	}
+
+	// Outbound requests go through the configured proxies
+	egress.Install(cfg.Egress)
+	if cfg.Egress.Proxy != "" {
+		logger.Infof("Sending outbound requests through proxy %s", egress.Redact(cfg.Egress.Proxy))
+	}
 
-	// Create GitHub client for public repository
-	githubClient := github.NewClient(cfg.GitHub.RepoOwner, cfg.GitHub.RepoName)
+	// Log which repositories and branches are being used
+	if cfg.Offline() {
+		logger.Info("Running the offline profile: servers run with online-mode=false, GitHub and Xbox Live are not contacted")
+	}
+	for _, source := range cfg.GitHub.Sources {
+		if source.Path != "" {
+			logger.Infof("Using directory %s (%s) for configuration", source.Path, source.ConfigPath)
+			continue
+		}
+		logger.Infof("Using %s/%s branch '%s' (%s) for configuration", source.RepoOwner, source.RepoName, source.Branch, source.ConfigPath)
+	}
+
+	// Create GitHub clients for the public configuration repositories
+	sources := github.NewSources(cfg.GitHub.Sources, cfg.GitHub.Token)
+	if err := sources.SetSigning(cfg.GitHub.Signing); err != nil {
+		logger.Fatalf("Invalid signing configuration: %v", err)
+	}
+
+	// Check the host before anything starts
+	runPreflight(cfg, sources, logger)
+
+	// Notifications go to the configured sinks
+	notifier := notify.NewNotifier(cfg.Notifications, cfg.Telegram, logger)
+
+	// Provisioning hooks follow servers added to and removed from the
+	// configuration
+	runner, err := hooks.New(cfg.Hooks, notifier, logger)
+	if err != nil {
+		logger.Fatalf("Invalid hooks configuration: %v", err)
+	}
 
 	// Create server manager
-	serverManager := server.NewManager(cfg, logger)
+	serverManager := server.NewManager(cfg, sources, notifier, runner, logger)
 
-	// Create HTTP server for health checks and status
-	mux := http.NewServeMux()
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
-		status := serverManager.GetStatus()
-		json.NewEncoder(w).Encode(status)
-	})
+	// Create HTTP server for health checks, status and management
+	apiServer := api.NewServer(serverManager, cfg, logger, logs)
 
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.HTTP.Port),
-		Handler: mux,
+		Handler: apiServer.Handler(),
+	}
+	if cfg.HTTP.TLS.Enabled() {
+		tlsConfig, err := api.NewTLSConfig(cfg.HTTP.TLS)
+		if err != nil {
+			logger.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		httpServer.TLSConfig = tlsConfig
 	}
 
 	// Start HTTP server
 	go func() {
-		logger.Infof("Starting HTTP server on port %d", cfg.HTTP.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.HTTP.TLS.Enabled() {
+			logger.Infof("Starting HTTPS server on port %d (client certificates: %s)", cfg.HTTP.Port, cfg.HTTP.TLS.ClientAuth)
+			err = httpServer.ListenAndServeTLS(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile)
+		} else {
+			logger.Infof("Starting HTTP server on port %d", cfg.HTTP.Port)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Errorf("HTTP server error: %v", err)
 		}
 	}()
@@ -67,21 +122,76 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle graceful shutdown
-	sigChan := make(chan os.Signal, 1)
+	// Push metrics to StatsD when selected, Prometheus scrapes /metrics
+	if cfg.Metrics.Exporter == config.ExporterStatsD {
+		exporter, err := metrics.NewStatsD(cfg.Metrics.StatsD, logger)
+		if err != nil {
+			logger.Fatalf("Failed to create StatsD exporter: %v", err)
+		}
+		logger.Infof("Sending metrics to StatsD at %s", cfg.Metrics.StatsD.Address)
+		go exporter.Run(ctx, serverManager.Metrics)
+	}
+
+	// Evaluate alert rules and notify the configured sinks
+	go alert.NewEngine(cfg.Alerts, cfg.Server.DataDir, notifier, serverManager.Events(), logger).Run(ctx, serverManager.Metrics)
+
+	// Handle graceful shutdown: the first signal stops the servers
+	// gracefully, a second one kills them right away
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		<-sigChan
-		logger.Info("Received shutdown signal, stopping servers...")
+		logger.Info("Received shutdown signal, stopping servers (signal again to force)...")
 		cancel()
 
-		// Shutdown HTTP server
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer shutdownCancel()
-		httpServer.Shutdown(shutdownCtx)
+		<-sigChan
+		logger.Warn("Received second shutdown signal, forcing shutdown")
+		serverManager.ForceShutdown()
 	}()
 
-	// Start the main polling loop
-	serverManager.Start(ctx, githubClient)
+	// Start the main polling loop, it returns once all servers are stopped
+	serverManager.Start(ctx)
+
+	// Shutdown HTTP server last so shutdown progress stays observable, event
+	// streams would hold it open
+	serverManager.Events().Close()
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+	httpServer.Shutdown(shutdownCtx)
+}
+
+// runPreflight logs the outcome of the environment checks with their fixes.
+// Failures only stop the manager in strict mode.
+func runPreflight(cfg *config.Config, sources *github.Sources, logger *logrus.Logger) {
+	opts := preflight.Options{Config: cfg, Skip: cfg.Preflight.Skip}
+	if !slices.Contains(opts.Skip, config.CheckPorts) {
+		if sha, err := sources.GetLastCommitSHA(); err == nil {
+			if repoConfig, err := sources.GetConfigAt(sha); err == nil {
+				opts.Servers = repoConfig.Servers
+			}
+		}
+	}
+
+	results := preflight.Run(context.Background(), opts)
+	for _, result := range results {
+		entry := logger.WithField("check", result.Check)
+		if result.Fix != "" {
+			entry = entry.WithField("fix", result.Fix)
+		}
+		switch result.Status {
+		case preflight.StatusFail:
+			entry.Errorf("Preflight failed: %s", result.Message)
+		case preflight.StatusWarn:
+			entry.Warnf("Preflight warning: %s", result.Message)
+		default:
+			entry.Debugf("Preflight passed: %s", result.Message)
+		}
+	}
+	if preflight.Failed(results) {
+		if cfg.Preflight.Strict {
+			logger.Fatal("Preflight checks failed, refusing to start (preflight.strict is set)")
+		}
+		logger.Warn("Preflight checks failed, starting anyway; run partyctl doctor for details")
+	}
 }
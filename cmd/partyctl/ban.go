@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runBan(args []string) int {
+	flags := flag.NewFlagSet("ban", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	reason := flags.String("reason", "", "why the player is banned")
+	lift := flags.Bool("lift", false, "lift the ban instead")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl ban [flags] <server> [player]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Bans a player from a server and, when the server syncs bans, from every")
+		fmt.Fprintln(os.Stderr, "server of its group. Without a player, lists the bans of the server.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 1 || flags.NArg() > 2 || *lift && flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	ctx := context.Background()
+	name := flags.Arg(0)
+
+	if flags.NArg() == 1 {
+		bans, err := client.Bans(ctx, name)
+		if err != nil {
+			return banError(err)
+		}
+		if jsonOutput() {
+			printJSON(bans)
+			return 0
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "PLAYER\tORIGIN\tBY\tTIME\tREASON")
+		for _, ban := range bans {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", ban.Player, ban.Origin, ban.By, ban.Time.Local().Format("2006-01-02 15:04"), ban.Reason)
+		}
+		table.Flush()
+		return 0
+	}
+
+	player := flags.Arg(1)
+	var servers []string
+	if *lift {
+		servers, err = client.Unban(ctx, name, player)
+	} else {
+		servers, err = client.Ban(ctx, name, player, *reason)
+	}
+	if err != nil {
+		return banError(err)
+	}
+	if jsonOutput() {
+		printJSON(map[string][]string{"servers": servers})
+		return 0
+	}
+	if *lift {
+		fmt.Printf("Lifted the ban of %s on %s\n", player, strings.Join(servers, ", "))
+	} else {
+		fmt.Printf("Banned %s from %s\n", player, strings.Join(servers, ", "))
+	}
+	return 0
+}
+
+func banError(err error) int {
+	printError(err)
+	var apiErr *partyclient.Error
+	if errors.As(err, &apiErr) {
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runBulkCreate(args []string) int {
+	flags := flag.NewFlagSet("bulk-create", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	count := flags.Int("count", 0, "number of copies (default: the size of the port range or roster)")
+	ports := flags.String("ports", "", "port of the first copy or a range, e.g. 20000-20019 (required)")
+	name := flags.String("name", "", "name of the copies, {n} being the copy number (default <template>-{n})")
+	roster := flags.String("roster", "", "CSV file of players with an optional server column, - for stdin")
+	worldTemplate := flags.String("world-template", "", "world template of the copies (default the template's)")
+	commit := flags.Bool("commit", false, "commit the copies to the configuration instead of printing them")
+	pullRequest := flags.Bool("pr", false, "with -commit, open a pull request instead of committing to the branch")
+	message := flags.String("message", "", "commit message")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl bulk-create [flags] <template>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Generates copies of a configured server on consecutive ports, e.g. one per")
+		fmt.Fprintln(os.Stderr, "student of a class, with the players of a roster added to their allowlists.")
+		fmt.Fprintln(os.Stderr, "Prints the server entries, or commits them with -commit.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *ports == "" || *pullRequest && !*commit {
+		flags.Usage()
+		return 2
+	}
+
+	spec := server.BulkSpec{
+		Template:      flags.Arg(0),
+		Name:          *name,
+		Count:         *count,
+		Ports:         *ports,
+		WorldTemplate: *worldTemplate,
+		Commit:        *commit,
+		Message:       *message,
+	}
+	if *pullRequest {
+		spec.Mode = config.WriteBackPullRequest
+	}
+	if *roster != "" {
+		content, err := readRoster(*roster)
+		if err != nil {
+			printError(err)
+			return 2
+		}
+		spec.Roster = content
+	}
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	result, err := client.BulkCreate(context.Background(), spec)
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(result)
+		return 0
+	}
+	if result.Change == nil {
+		fmt.Print(result.YAML)
+		return 0
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "SERVER\tPORT\tALLOWLIST")
+	for _, copied := range result.Servers {
+		fmt.Fprintf(table, "%s\t%d\t%s\n", copied.Name, copied.Port, strings.Join(copied.Whitelist, ", "))
+	}
+	table.Flush()
+	printChange(result.Change)
+	return 0
+}
+
+func readRoster(path string) (string, error) {
+	if path == "-" {
+		content, err := io.ReadAll(os.Stdin)
+		return string(content), err
+	}
+	content, err := os.ReadFile(path)
+	return string(content), err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+// connection holds the address and credentials of the manager, resolved
+// from the selected profile and the $PARTY_* variables by selectProfile
+var connection profile
+
+// defaultAddr is the manager API address unless overridden by -addr
+func defaultAddr() string {
+	if connection.Addr != "" {
+		return connection.Addr
+	}
+	return "http://localhost:8080"
+}
+
+// httpClient returns a client for the manager API of a connection. Its CA
+// certificate verifies the manager, its client certificate and key are
+// presented for mTLS.
+func httpClient(connection profile) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile := connection.CACert; caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s contains no PEM certificates", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := connection.ClientCert, connection.ClientKey
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Client{
+		Timeout:   5 * time.Minute,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}, nil
+}
+
+// newClient returns an API client for addr using httpClient, authenticated
+// with the connection's token when set
+func newClient(addr string) (*partyclient.Client, error) {
+	client, err := httpClient(connection)
+	if err != nil {
+		return nil, err
+	}
+	apiClient := partyclient.New(addr, client)
+	apiClient.SetToken(connection.Token)
+	return apiClient, nil
+}
+
+// profileClient returns an API client for the manager of a named profile,
+// regardless of the selected one
+func profileClient(name string) (*partyclient.Client, error) {
+	path := profilesPath()
+	file, err := loadProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	selected, exists := file.Profiles[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown profile %q in %s", name, path)
+	}
+	client, err := httpClient(selected)
+	if err != nil {
+		return nil, err
+	}
+	apiClient := partyclient.New(firstSet(selected.Addr, "http://localhost:8080"), client)
+	apiClient.SetToken(selected.Token)
+	return apiClient, nil
+}
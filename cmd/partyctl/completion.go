@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// serverArgCommands take a server name as their argument, completed from
+// `partyctl status -q`
+var serverArgCommands = []string{"ban", "bulk-create", "config", "console", "exec", "lock", "logs", "macro", "migrate-world"}
+
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl completion bash|zsh|fish")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Prints a shell completion script, e.g.")
+		fmt.Fprintln(os.Stderr, "  source <(partyctl completion bash)")
+		fmt.Fprintln(os.Stderr, "  partyctl completion fish > ~/.config/fish/completions/partyctl.fish")
+		return 2
+	}
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	switch args[0] {
+	case "bash":
+		fmt.Printf(bashCompletion, strings.Join(names, " "), strings.Join(serverArgCommands, "|"))
+	case "zsh":
+		var described []string
+		for _, name := range names {
+			described = append(described, fmt.Sprintf("'%s:%s'", name, strings.ReplaceAll(commands[name].summary, "'", "")))
+		}
+		fmt.Printf(zshCompletion, strings.Join(described, " "), strings.Join(serverArgCommands, "|"))
+	case "fish":
+		fmt.Println("complete -c partyctl -f")
+		fmt.Println("complete -c partyctl -n __fish_use_subcommand -s o -r -a 'text json' -d 'Output format'")
+		fmt.Println("complete -c partyctl -n __fish_use_subcommand -o profile -r -a '(partyctl profile list -q 2>/dev/null)' -d 'Manager profile'")
+		os.Stdout.WriteString(fishProfileFunction)
+		for _, name := range names {
+			fmt.Printf("complete -c partyctl -n __fish_use_subcommand -a %s -d '%s'\n", name, strings.ReplaceAll(commands[name].summary, "'", ""))
+		}
+		fmt.Printf(fishCompletion, strings.Join(serverArgCommands, " "))
+	default:
+		fmt.Fprintf(os.Stderr, "unsupported shell %q (must be bash, zsh or fish)\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+const bashCompletion = `_partyctl() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd="" i
+    local -a global=()
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        case "${COMP_WORDS[i]}" in
+            -o|--o) ((i++)) ;;
+            -profile|--profile) global=(-profile "${COMP_WORDS[i+1]}"); ((i++)) ;;
+            -*) ;;
+            *) cmd="${COMP_WORDS[i]}"; break ;;
+        esac
+    done
+
+    case "$prev" in
+        -o|--o) COMPREPLY=($(compgen -W "text json" -- "$cur")); return ;;
+        -profile|--profile) COMPREPLY=($(compgen -W "$(partyctl profile list -q 2>/dev/null)" -- "$cur")); return ;;
+    esac
+    if [[ -z "$cmd" ]]; then
+        COMPREPLY=($(compgen -W "-o -profile %s" -- "$cur"))
+        return
+    fi
+    case "$cmd" in
+        %s) COMPREPLY=($(compgen -W "$(partyctl "${global[@]}" status -q 2>/dev/null)" -- "$cur")) ;;
+        completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+        profile)
+            if [[ "$prev" == "profile" ]]; then
+                COMPREPLY=($(compgen -W "list set use remove" -- "$cur"))
+            elif [[ "$prev" == "use" || "$prev" == "remove" ]]; then
+                COMPREPLY=($(compgen -W "$(partyctl profile list -q 2>/dev/null)" -- "$cur"))
+            fi ;;
+        mirror) [[ "$prev" == "mirror" ]] && COMPREPLY=($(compgen -W "sync" -- "$cur")) ;;
+        lint) COMPREPLY=($(compgen -f -- "$cur")) ;;
+    esac
+}
+complete -F _partyctl partyctl
+`
+
+const zshCompletion = `#compdef partyctl
+
+_partyctl() {
+    local -a commands global
+    commands=(%s)
+    local cmd="" i
+    for ((i = 2; i < CURRENT; i++)); do
+        case "${words[i]}" in
+            -o|--o) ((i++)) ;;
+            -profile|--profile) global=(-profile "${words[i+1]}"); ((i++)) ;;
+            -*) ;;
+            *) cmd="${words[i]}"; break ;;
+        esac
+    done
+
+    case "${words[CURRENT-1]}" in
+        -o|--o) compadd text json; return ;;
+        -profile|--profile) compadd -- ${(f)"$(partyctl profile list -q 2>/dev/null)"}; return ;;
+    esac
+    if [[ -z "$cmd" ]]; then
+        _describe 'command' commands
+        return
+    fi
+    case "$cmd" in
+        %s) compadd -- ${(f)"$(partyctl $global status -q 2>/dev/null)"} ;;
+        completion) compadd bash zsh fish ;;
+        profile)
+            case "${words[CURRENT-1]}" in
+                profile) compadd list set use remove ;;
+                use|remove) compadd -- ${(f)"$(partyctl profile list -q 2>/dev/null)"} ;;
+            esac ;;
+        mirror) [[ "${words[CURRENT-1]}" == mirror ]] && compadd sync ;;
+        lint) _files ;;
+    esac
+}
+
+compdef _partyctl partyctl
+`
+
+const fishCompletion = `complete -c partyctl -n '__fish_seen_subcommand_from %s' -a '(partyctl (__partyctl_profile) status -q 2>/dev/null)'
+complete -c partyctl -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c partyctl -n '__fish_seen_subcommand_from profile; and not __fish_seen_subcommand_from list set use remove' -a 'list set use remove'
+complete -c partyctl -n '__fish_seen_subcommand_from use remove' -a '(partyctl profile list -q 2>/dev/null)'
+complete -c partyctl -n '__fish_seen_subcommand_from mirror; and not __fish_seen_subcommand_from sync' -a 'sync'
+complete -c partyctl -n '__fish_seen_subcommand_from lint' -F
+`
+
+// fishProfileFunction passes the -profile of the command line on to the
+// partyctl calls that complete server names
+const fishProfileFunction = `function __partyctl_profile
+    set -l tokens (commandline -opc)
+    set -l i (contains -i -- -profile $tokens; or contains -i -- --profile $tokens)
+    and set -q tokens[(math $i + 1)]
+    and printf '%s\n' -profile $tokens[(math $i + 1)]
+end
+`
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/github"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runConfig(args []string) int {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	allow := flags.String("allow", "", "comma-separated players to add to the allowlist")
+	disallow := flags.String("disallow", "", "comma-separated players to remove from the allowlist")
+	maxPlayers := flags.Int("max-players", 0, "new player limit")
+	pullRequest := flags.Bool("pr", false, "open a pull request, even when the manager commits by default")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl config [flags] <server>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Changes the allowlist or player limit of a server in the configuration")
+		fmt.Fprintln(os.Stderr, "repository, with a commit or a pull request. The server picks the change")
+		fmt.Fprintln(os.Stderr, "up with the apply of the commit.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	request := partyclient.ConfigChangeRequest{
+		ServerEdit: config.ServerEdit{
+			WhitelistAdd:    splitPlayers(*allow),
+			WhitelistRemove: splitPlayers(*disallow),
+		},
+	}
+	if *maxPlayers != 0 {
+		request.MaxPlayers = maxPlayers
+	}
+	if *pullRequest {
+		request.Mode = config.WriteBackPullRequest
+	}
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	change, err := client.ChangeServerConfig(context.Background(), flags.Arg(0), request)
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(change)
+		return 0
+	}
+	printChange(change)
+	return 0
+}
+
+// splitPlayers splits a comma-separated list of players; names may
+// contain spaces
+func splitPlayers(list string) []string {
+	var players []string
+	for _, player := range strings.Split(list, ",") {
+		if player = strings.TrimSpace(player); player != "" {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+// printChange reports a change written back to a configuration source
+func printChange(change *github.Change) {
+	switch {
+	case change.PullRequest != "":
+		fmt.Printf("Opened pull request %s in source %s\n", change.PullRequest, change.Source)
+	case change.Commit != "":
+		fmt.Printf("Committed %s to source %s\n", change.Commit, change.Source)
+	default:
+		fmt.Printf("Updated the configuration file of source %s\n", change.Source)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+// maxHistory is how many commands the console history keeps
+const maxHistory = 500
+
+// errDetach ends a console session at the user's request
+var errDetach = errors.New("detached")
+
+func runConsole(args []string) int {
+	flags := flag.NewFlagSet("console", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	backlog := flags.Int("backlog", 50, "number of recent console lines to show first")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl console [flags] <server>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Attaches to the console of a running server: output is streamed live and")
+		fmt.Fprintln(os.Stderr, "typed lines are sent as commands. Up and down browse the command history,")
+		fmt.Fprintln(os.Stderr, "Ctrl-C or Ctrl-D detaches without stopping the server.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	name := flags.Arg(0)
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	conn, err := client.Console(context.Background(), name, *backlog)
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+	defer conn.Close()
+
+	editor := &lineEditor{out: os.Stdout, prompt: name + "> ", json: jsonOutput()}
+	if !editor.json {
+		if restore, err := makeRaw(int(os.Stdin.Fd())); err == nil {
+			editor.raw = true
+			defer restore()
+		}
+	}
+	historyPath := consoleHistoryPath()
+	editor.loadHistory(historyPath)
+	defer editor.saveHistory(historyPath)
+
+	editor.notice(fmt.Sprintf("Attached to %s, Ctrl-C to detach", name))
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			line, err := conn.ReadMessage()
+			if err != nil {
+				editor.notice("Connection closed")
+				return
+			}
+			editor.printLine(line)
+		}
+	}()
+
+	detached := make(chan struct{})
+	go func() {
+		defer close(detached)
+		input := bufio.NewReader(os.Stdin)
+		for {
+			line, err := editor.readLine(input)
+			if err != nil {
+				return
+			}
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if err := conn.WriteMessage(line); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Without raw mode Ctrl-C arrives as a signal
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	select {
+	case <-closed:
+	case <-detached:
+	case <-interrupt:
+	}
+	editor.finish()
+	return 0
+}
+
+// consoleHistoryPath is the file keeping the command history
+func consoleHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".party_console_history")
+}
+
+// lineEditor reads commands while console output is printed above the
+// input line. In raw mode it supports cursor movement and history; without
+// it lines are read as typed. In JSON mode each output line is printed as
+// {"line": ...}.
+type lineEditor struct {
+	out    io.Writer
+	prompt string
+	raw    bool
+	json   bool
+
+	mu      sync.Mutex
+	buf     []rune
+	cursor  int
+	history []string
+	// index is the history entry being edited, len(history) for a new line
+	index int
+}
+
+// printLine prints a line of output and redraws the input line below it
+func (e *lineEditor) printLine(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case e.json:
+		json.NewEncoder(e.out).Encode(struct {
+			Line string `json:"line"`
+		}{line})
+	case e.raw:
+		fmt.Fprintf(e.out, "\r\x1b[K%s\r\n", line)
+		e.redraw()
+	default:
+		fmt.Fprintln(e.out, line)
+	}
+}
+
+// notice prints a message of partyctl itself, to stderr in JSON mode so
+// that stdout only carries console lines
+func (e *lineEditor) notice(message string) {
+	if e.json {
+		fmt.Fprintln(os.Stderr, message)
+		return
+	}
+	e.printLine(message)
+}
+
+// redraw writes the prompt and input line and places the cursor.
+// The caller must hold e.mu.
+func (e *lineEditor) redraw() {
+	fmt.Fprintf(e.out, "\r\x1b[K%s%s", e.prompt, string(e.buf))
+	if back := len(e.buf) - e.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// finish moves past the input line when the session ends
+func (e *lineEditor) finish() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.raw {
+		fmt.Fprint(e.out, "\r\x1b[K")
+	}
+}
+
+// readLine reads one command. It returns errDetach on Ctrl-C, or Ctrl-D on
+// an empty line.
+func (e *lineEditor) readLine(in *bufio.Reader) (string, error) {
+	if !e.raw {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		e.mu.Lock()
+		e.addHistory(line)
+		e.mu.Unlock()
+		return line, nil
+	}
+
+	e.mu.Lock()
+	e.buf, e.cursor, e.index = nil, 0, len(e.history)
+	e.redraw()
+	e.mu.Unlock()
+
+	for {
+		r, _, err := in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		e.mu.Lock()
+		switch r {
+		case '\r', '\n':
+			line := string(e.buf)
+			e.addHistory(line)
+			e.buf, e.cursor = nil, 0
+			fmt.Fprintf(e.out, "\r\x1b[K%s%s\r\n", e.prompt, line)
+			e.mu.Unlock()
+			return line, nil
+		case 3: // Ctrl-C
+			e.mu.Unlock()
+			return "", errDetach
+		case 4: // Ctrl-D
+			if len(e.buf) == 0 {
+				e.mu.Unlock()
+				return "", errDetach
+			}
+		case 127, 8: // Backspace
+			if e.cursor > 0 {
+				e.buf = append(e.buf[:e.cursor-1], e.buf[e.cursor:]...)
+				e.cursor--
+			}
+		case 1: // Ctrl-A
+			e.cursor = 0
+		case 5: // Ctrl-E
+			e.cursor = len(e.buf)
+		case 21: // Ctrl-U
+			e.buf, e.cursor = e.buf[e.cursor:], 0
+		case 27: // Escape sequence
+			e.mu.Unlock()
+			sequence := readEscape(in)
+			e.mu.Lock()
+			e.handleEscape(sequence)
+		default:
+			if r >= ' ' {
+				e.buf = append(e.buf[:e.cursor], append([]rune{r}, e.buf[e.cursor:]...)...)
+				e.cursor++
+			}
+		}
+		e.redraw()
+		e.mu.Unlock()
+	}
+}
+
+// readEscape reads the rest of a CSI sequence such as "[A"
+func readEscape(in *bufio.Reader) string {
+	first, err := in.ReadByte()
+	if err != nil || (first != '[' && first != 'O') {
+		return ""
+	}
+	var sequence []byte
+	for {
+		b, err := in.ReadByte()
+		if err != nil {
+			return ""
+		}
+		sequence = append(sequence, b)
+		if b >= 0x40 && b <= 0x7E {
+			return string(sequence)
+		}
+	}
+}
+
+// handleEscape applies an arrow, home, end or delete key.
+// The caller must hold e.mu.
+func (e *lineEditor) handleEscape(sequence string) {
+	switch sequence {
+	case "A": // Up
+		if e.index > 0 {
+			e.index--
+			e.buf = []rune(e.history[e.index])
+			e.cursor = len(e.buf)
+		}
+	case "B": // Down
+		if e.index < len(e.history) {
+			e.index++
+			e.buf = nil
+			if e.index < len(e.history) {
+				e.buf = []rune(e.history[e.index])
+			}
+			e.cursor = len(e.buf)
+		}
+	case "C": // Right
+		if e.cursor < len(e.buf) {
+			e.cursor++
+		}
+	case "D": // Left
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case "H", "1~":
+		e.cursor = 0
+	case "F", "4~":
+		e.cursor = len(e.buf)
+	case "3~": // Delete
+		if e.cursor < len(e.buf) {
+			e.buf = append(e.buf[:e.cursor], e.buf[e.cursor+1:]...)
+		}
+	}
+}
+
+// addHistory appends a command unless it repeats the previous one.
+// The caller must hold e.mu.
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+func (e *lineEditor) loadHistory(path string) {
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, line := range strings.Split(string(data), "\n") {
+		e.addHistory(line)
+	}
+}
+
+func (e *lineEditor) saveHistory(path string) {
+	if path == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.history) == 0 {
+		return
+	}
+	os.WriteFile(path, []byte(strings.Join(e.history, "\n")+"\n"), 0600)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/egress"
+	"minecraft-server-manager/internal/github"
+	"minecraft-server-manager/internal/preflight"
+)
+
+func runDoctor(args []string) int {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	configPath := flags.String("config", "", "manager configuration file (default $CONFIG_PATH or config.yaml)")
+	serversPath := flags.String("servers", "", "server configuration file whose ports are checked (default: fetched from the configured repositories)")
+	skip := flags.String("skip", "", "comma-separated checks to skip: "+strings.Join(config.PreflightChecks, ", "))
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl doctor [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Checks that this host can run the manager: Bedrock libraries, free ports,")
+		fmt.Fprintln(os.Stderr, "the open files limit, disk space, the GitHub token and the clock. Run it")
+		fmt.Fprintln(os.Stderr, "before starting the manager, whose own ports would otherwise show as in use.")
+		fmt.Fprintln(os.Stderr, "Exits with 1 when a check fails.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *configPath != "" {
+		os.Setenv("CONFIG_PATH", *configPath)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	// Checks reach GitHub the way the manager does
+	egress.Install(cfg.Egress)
+
+	opts := preflight.Options{Config: cfg, Skip: cfg.Preflight.Skip}
+	if *skip != "" {
+		opts.Skip = strings.Split(*skip, ",")
+		for _, check := range opts.Skip {
+			if !slices.Contains(config.PreflightChecks, check) {
+				printError(fmt.Errorf("unknown check %q", check))
+				return 2
+			}
+		}
+	}
+	if !slices.Contains(opts.Skip, config.CheckPorts) {
+		opts.Servers, err = doctorServers(cfg, *serversPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: server ports are not checked: %v\n", err)
+		}
+	}
+
+	results := preflight.Run(context.Background(), opts)
+	if jsonOutput() {
+		printJSON(results)
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, result := range results {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", strings.ToUpper(result.Status), result.Check, result.Message)
+			if result.Fix != "" && result.Status != preflight.StatusOK {
+				fmt.Fprintf(table, "\t\tfix: %s\n", result.Fix)
+			}
+		}
+		table.Flush()
+	}
+
+	if preflight.Failed(results) {
+		return 1
+	}
+	return 0
+}
+
+// doctorServers returns the servers whose ports are checked, read from a file
+// or from the head of the configured repositories
+func doctorServers(cfg *config.Config, path string) ([]config.MinecraftServerConfig, error) {
+	repoConfig, err := loadRepoConfig(cfg, path)
+	if err != nil {
+		return nil, err
+	}
+	return repoConfig.Servers, nil
+}
+
+// loadRepoConfig reads a server configuration from a file, or from the
+// head of the configured repositories when path is empty
+func loadRepoConfig(cfg *config.Config, path string) (*config.RepoConfig, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return config.ParseRepoConfig(data, false)
+	}
+
+	sources := github.NewSources(cfg.GitHub.Sources, cfg.GitHub.Token)
+	sha, err := sources.GetLastCommitSHA()
+	if err != nil {
+		return nil, err
+	}
+	return sources.GetConfigAt(sha)
+}
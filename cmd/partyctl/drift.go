@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runDrift(args []string) int {
+	flags := flag.NewFlagSet("drift", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	check := flags.Bool("check", false, "check now instead of showing the last check")
+	correct := flags.Bool("correct", false, "check now and write drifted files again")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl drift [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Shows where running servers differ from their configuration, e.g. files")
+		fmt.Fprintln(os.Stderr, "edited by hand on the host. Exits with 1 when there is drift.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	var report *server.DriftReport
+	if *check || *correct {
+		report, err = client.CheckDrift(context.Background(), *correct)
+	} else {
+		report, err = client.Drift(context.Background())
+	}
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(report)
+	} else if len(report.Drifts) == 0 {
+		fmt.Printf("No drift (checked %s)\n", report.Checked.Local().Format("2006-01-02 15:04:05"))
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "SERVER\tITEM\tCORRECTED\tDETAILS")
+		for _, drift := range report.Drifts {
+			fmt.Fprintf(table, "%s\t%s\t%t\t%s\n", drift.Server, drift.Item, drift.Corrected, strings.Join(drift.Details, "; "))
+		}
+		table.Flush()
+	}
+	if len(report.Drifts) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+// eventsRetry is how long partyctl events waits before reconnecting
+const eventsRetry = 2 * time.Second
+
+func runEvents(args []string) int {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	types := flags.String("type", "", "only these comma-separated event types or categories, e.g. server,alert.firing")
+	servers := flags.String("server", "", "only events of these comma-separated servers")
+	since := flags.Uint64("since", 0, "first replay the remembered events after this event ID")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl events [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Follows the activity of the manager: applies, server status changes, world")
+		fmt.Fprintln(os.Stderr, "imports and resets, backups and alerts. The stream is resumed where it")
+		fmt.Fprintln(os.Stderr, "left off when the connection drops. With -o json every event is printed as")
+		fmt.Fprintln(os.Stderr, "one line of JSON.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	last := *since
+	connected := false
+	for {
+		conn, err := client.Events(context.Background(), splitList(*types), splitList(*servers), last)
+		if err != nil {
+			var apiErr *partyclient.Error
+			if errors.As(err, &apiErr) {
+				printError(err)
+				return 1
+			}
+			if !connected {
+				printError(err)
+				return 2
+			}
+			time.Sleep(eventsRetry)
+			continue
+		}
+		connected = true
+
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				break
+			}
+			var event events.Event
+			if err := json.Unmarshal([]byte(message), &event); err != nil {
+				continue
+			}
+			last = event.ID
+			if jsonOutput() {
+				fmt.Println(message)
+			} else {
+				printEvent(event)
+			}
+		}
+		conn.Close()
+		time.Sleep(eventsRetry)
+	}
+}
+
+// printEvent prints an event on one line, its data as sorted key=value pairs
+func printEvent(event events.Event) {
+	keys := make([]string, 0, len(event.Data))
+	for key := range event.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%v", key, event.Data[key]))
+	}
+	fmt.Printf("%s  %-16s  %-12s  %s\n", event.Time.Local().Format(time.TimeOnly), event.Type, dash(event.Server), strings.Join(fields, " "))
+}
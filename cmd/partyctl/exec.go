@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runExec(args []string) int {
+	flags := flag.NewFlagSet("exec", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	expect := flags.String("expect", "", "stop capturing at the first output line matching this regular expression")
+	quiet := flags.Duration("quiet", 0, "stop capturing after this long without output (default 500ms)")
+	timeout := flags.Duration("timeout", 0, "stop capturing after this long in any case (default 5s, at most 1m)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl exec [flags] <server> <command...>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Runs a command on the console of a running server and prints the console")
+		fmt.Fprintln(os.Stderr, "output that follows it. Exits with 1 when -expect was given and no line")
+		fmt.Fprintln(os.Stderr, "matched before the timeout.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return 2
+	}
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	result, err := client.Command(context.Background(), flags.Arg(0), partyclient.CommandRequest{
+		Command:   strings.Join(flags.Args()[1:], " "),
+		Expect:    *expect,
+		QuietMS:   int(*quiet / time.Millisecond),
+		TimeoutMS: int(*timeout / time.Millisecond),
+	})
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(result)
+	} else {
+		for _, line := range result.Output {
+			fmt.Println(line)
+		}
+	}
+	if *expect != "" && !result.Matched {
+		fmt.Fprintf(os.Stderr, "warning: no output matched %q within %s\n", *expect, result.Duration)
+		return 1
+	}
+	return 0
+}
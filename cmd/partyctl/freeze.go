@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runFreeze(args []string) int {
+	flags := flag.NewFlagSet("freeze", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	reason := flags.String("reason", "", "why the manager is frozen, e.g. tournament")
+	lift := flags.Bool("lift", false, "lift the freeze and apply the commit that waited for it")
+	show := flags.Bool("show", false, "only show whether the manager is frozen")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl freeze [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Freezes the manager during incidents and tournaments: new commits are not")
+		fmt.Fprintln(os.Stderr, "applied and servers are not restarted until the freeze is lifted, while")
+		fmt.Fprintln(os.Stderr, "servers keep running and being monitored.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 || *lift && *show {
+		flags.Usage()
+		return 2
+	}
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	ctx := context.Background()
+
+	switch {
+	case *lift:
+		if err := client.Unfreeze(ctx); err != nil {
+			return freezeError(err)
+		}
+		if jsonOutput() {
+			printJSON(map[string]bool{"frozen": false})
+		} else {
+			fmt.Println("Lifted the freeze")
+		}
+		return 0
+	case *show:
+		freeze, err := client.Freeze(ctx)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			if jsonOutput() {
+				printJSON(map[string]bool{"frozen": false})
+			} else {
+				fmt.Println("Not frozen")
+			}
+			return 0
+		}
+		if err != nil {
+			return freezeError(err)
+		}
+		printFreeze(freeze)
+		return 0
+	}
+
+	freeze, err := client.FreezeManager(ctx, *reason)
+	if err != nil {
+		return freezeError(err)
+	}
+	printFreeze(freeze)
+	return 0
+}
+
+func printFreeze(freeze *server.Freeze) {
+	if jsonOutput() {
+		printJSON(freeze)
+		return
+	}
+	fmt.Printf("Frozen since %s by %s", freeze.Since.Local().Format("2006-01-02 15:04:05"), dash(freeze.By))
+	if freeze.Reason != "" {
+		fmt.Printf(": %s", freeze.Reason)
+	}
+	fmt.Println()
+	if freeze.Pending != "" {
+		fmt.Printf("Commit %s waits until the freeze is lifted\n", freeze.Pending[:8])
+	}
+}
+
+func freezeError(err error) int {
+	printError(err)
+	var apiErr *partyclient.Error
+	if errors.As(err, &apiErr) {
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// configSource reads files of a config repository, either from a working
+// tree or from a Git ref
+type configSource interface {
+	ReadFile(name string) ([]byte, error)
+	DirExists(name string) bool
+	// ReadDir returns the regular files below a directory, keyed by their
+	// slash separated path inside it
+	ReadDir(name string) (map[string][]byte, error)
+	String() string
+}
+
+type dirSource struct {
+	root string
+}
+
+func (s dirSource) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.root, filepath.FromSlash(name)))
+}
+
+func (s dirSource) DirExists(name string) bool {
+	info, err := os.Stat(filepath.Join(s.root, filepath.FromSlash(name)))
+	return err == nil && info.IsDir()
+}
+
+func (s dirSource) ReadDir(name string) (map[string][]byte, error) {
+	dir := filepath.Join(s.root, filepath.FromSlash(name))
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relPath)] = content
+		return nil
+	})
+	return files, err
+}
+
+func (s dirSource) String() string {
+	return s.root
+}
+
+type gitSource struct {
+	ref string
+}
+
+func (s gitSource) ReadFile(name string) ([]byte, error) {
+	out, err := exec.Command("git", "show", s.ref+":"+name).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s not found at %s", name, s.ref)
+	}
+	return out, nil
+}
+
+func (s gitSource) DirExists(name string) bool {
+	out, err := exec.Command("git", "cat-file", "-t", s.ref+":"+strings.Trim(name, "/")).Output()
+	return err == nil && strings.TrimSpace(string(out)) == "tree"
+}
+
+func (s gitSource) ReadDir(name string) (map[string][]byte, error) {
+	dir := strings.Trim(name, "/")
+	out, err := exec.Command("git", "ls-tree", "-r", "-z", s.ref, "--", dir+"/").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s not found at %s", name, s.ref)
+	}
+	files := make(map[string][]byte)
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		// Each line is "<mode> <type> <object>\t<path>"; symlinks and
+		// submodules are not part of a deployed pack
+		info, filePath, found := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !found || len(fields) != 3 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		content, err := exec.Command("git", "cat-file", "blob", fields[2]).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s at %s: %w", filePath, s.ref, err)
+		}
+		files[strings.TrimPrefix(filePath, dir+"/")] = content
+	}
+	return files, nil
+}
+
+func (s gitSource) String() string {
+	return s.ref
+}
+
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	file := flags.String("file", "servers.yaml", "config file path inside the repository when linting a Git ref")
+	root := flags.String("root", "", "repository root for pack paths when linting a file (default: Git top level of the file)")
+	verifyTemplates := flags.Bool("verify-templates", false, "download world templates and verify their checksums")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl lint [flags] <path-or-ref>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Runs the full validation pipeline against a local config file or a Git ref")
+		fmt.Fprintln(os.Stderr, "and exits non-zero if any problem is found.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	target := flags.Arg(0)
+
+	source, configPath, err := resolveLintTarget(target, *file, *root)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	data, err := source.ReadFile(configPath)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	problems := lintConfig(data, source, *verifyTemplates)
+	if jsonOutput() {
+		printJSON(struct {
+			Target   string   `json:"target"`
+			OK       bool     `json:"ok"`
+			Problems []string `json:"problems"`
+		}{target, len(problems) == 0, append([]string{}, problems...)})
+		if len(problems) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("%s: %d problem(s) found\n", target, len(problems))
+		for _, problem := range problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+		return 1
+	}
+
+	fmt.Printf("%s: OK\n", target)
+	return 0
+}
+
+// resolveLintTarget treats an existing file as a working tree config and
+// anything else as a Git ref
+func resolveLintTarget(target, file, root string) (configSource, string, error) {
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		absPath, err := filepath.Abs(target)
+		if err != nil {
+			return nil, "", err
+		}
+		if root == "" {
+			root = gitTopLevel(filepath.Dir(absPath))
+		}
+		relPath, err := filepath.Rel(root, absPath)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			return nil, "", fmt.Errorf("%s is outside the repository root %s", target, root)
+		}
+		return dirSource{root: root}, filepath.ToSlash(relPath), nil
+	}
+
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", target+"^{commit}").Run(); err != nil {
+		return nil, "", fmt.Errorf("%s is neither a file nor a Git ref", target)
+	}
+	return gitSource{ref: target}, file, nil
+}
+
+func gitTopLevel(dir string) string {
+	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return dir
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// lintConfig runs schema, semantic and repository checks and returns every
+// problem found
+func lintConfig(data []byte, source configSource, verifyTemplates bool) []string {
+	repoConfig, err := config.ParseRepoConfig(data, true)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var problems []string
+
+	var validationErr *config.ValidationError
+	if err := repoConfig.Validate(); errors.As(err, &validationErr) {
+		problems = append(problems, validationErr.Problems...)
+	}
+
+	problems = append(problems, lintPacks(repoConfig, source)...)
+
+	if verifyTemplates {
+		for name, template := range repoConfig.WorldTemplates {
+			if err := verifyChecksum(template.URL, template.SHA256); err != nil {
+				problems = append(problems, fmt.Sprintf("world_templates.%s: %v", name, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// lintPacks checks that pack directories exist in the repository, that
+// their files match a pinned sha256 and that their manifests parse
+func lintPacks(repoConfig *config.RepoConfig, source configSource) []string {
+	var problems []string
+
+	checked := make(map[string]bool)
+	for _, server := range repoConfig.Servers {
+		for _, pack := range server.Packs() {
+			if pack.Path == "" || checked[pack.Path] {
+				continue
+			}
+			checked[pack.Path] = true
+
+			if !source.DirExists(pack.Path) {
+				problems = append(problems, fmt.Sprintf("pack %s: directory not found in %s", pack.Path, source))
+				continue
+			}
+
+			if pack.SHA256 != "" {
+				files, err := source.ReadDir(pack.Path)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("pack %s: %v", pack.Path, err))
+				} else if actual := config.HashPackFiles(files); !strings.EqualFold(pack.SHA256, actual) {
+					problems = append(problems, fmt.Sprintf("pack %s: files do not match its sha256 (expected: %s, got: %s)", pack.Path, strings.ToLower(pack.SHA256), actual))
+				}
+			}
+
+			data, err := source.ReadFile(path.Join(pack.Path, "manifest.json"))
+			if err != nil {
+				// A manifest is generated at deploy time
+				continue
+			}
+			var manifest struct {
+				Header struct {
+					UUID    string      `json:"uuid"`
+					Version interface{} `json:"version"`
+				} `json:"header"`
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				problems = append(problems, fmt.Sprintf("pack %s: invalid manifest.json: %v", pack.Path, err))
+				continue
+			}
+			if manifest.Header.Version == nil {
+				problems = append(problems, fmt.Sprintf("pack %s: manifest.json has no header.version", pack.Path))
+			}
+		}
+	}
+
+	return problems
+}
+
+func verifyChecksum(url, checksum string) error {
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, checksum) {
+		return fmt.Errorf("checksum mismatch (expected: %s, got: %s)", checksum, actual)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runLock(args []string) int {
+	flags := flag.NewFlagSet("lock", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	duration := flags.Duration("for", 0, "how long the server stays locked, e.g. 3h")
+	until := flags.String("until", "", "when the lock expires, as RFC 3339 or 2006-01-02 15:04 in local time")
+	reason := flags.String("reason", "", "why the server is locked, e.g. tournament")
+	lift := flags.Bool("lift", false, "lift the lock and apply the configuration that waited for it")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl lock [flags] <server>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Locks the settings of a server, e.g. for a tournament: until the lock")
+		fmt.Fprintln(os.Stderr, "expires, applies, maximum uptime restarts, scheduled resets and schedules")
+		fmt.Fprintln(os.Stderr, "leave the server as it is. Without -for, -until or -lift, shows the lock.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *duration != 0 && *until != "" || *lift && (*duration != 0 || *until != "") {
+		flags.Usage()
+		return 2
+	}
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	ctx := context.Background()
+	name := flags.Arg(0)
+
+	var lock *server.LockedServer
+	switch {
+	case *lift:
+		if err := client.UnlockServer(ctx, name); err != nil {
+			return lockError(err)
+		}
+		if jsonOutput() {
+			printJSON(map[string]string{"status": "unlocked"})
+		} else {
+			fmt.Printf("Unlocked %s\n", name)
+		}
+		return 0
+	case *duration != 0:
+		lock, err = client.LockServer(ctx, name, *reason, time.Now().Add(*duration))
+	case *until != "":
+		end, parseErr := parseUntil(*until)
+		if parseErr != nil {
+			printError(parseErr)
+			return 2
+		}
+		lock, err = client.LockServer(ctx, name, *reason, end)
+	default:
+		lock, err = client.Lock(ctx, name)
+	}
+	if err != nil {
+		return lockError(err)
+	}
+
+	if jsonOutput() {
+		printJSON(lock)
+		return 0
+	}
+	fmt.Printf("%s is locked until %s by %s", lock.Name, lock.Until.Local().Format("2006-01-02 15:04"), dash(lock.By))
+	if lock.Reason != "" {
+		fmt.Printf(": %s", lock.Reason)
+	}
+	fmt.Println()
+	return 0
+}
+
+// parseUntil parses the end of a lock as RFC 3339 or as a local time
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339 or 2006-01-02 15:04)", value)
+	}
+	return t, nil
+}
+
+func lockError(err error) int {
+	printError(err)
+	var apiErr *partyclient.Error
+	if errors.As(err, &apiErr) {
+		return 1
+	}
+	return 2
+}
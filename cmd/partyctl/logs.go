@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+// logsPollInterval is how often partyctl logs -f asks for new lines
+const logsPollInterval = time.Second
+
+func runLogs(args []string) int {
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	follow := flags.Bool("f", false, "keep printing new lines as they arrive")
+	since := flags.Uint64("since", 0, "only lines after this sequence number")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl logs [flags] <server>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Prints the console lines the manager keeps for a running server. With -f")
+		fmt.Fprintln(os.Stderr, "new lines are printed as they arrive, and a note is printed when lines")
+		fmt.Fprintln(os.Stderr, "were overwritten before they could be read. With -o json every line is")
+		fmt.Fprintln(os.Stderr, "printed as {\"seq\": ..., \"line\": ...}.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	name := flags.Arg(0)
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	next := *since
+	for {
+		page, err := client.Logs(context.Background(), name, next, 0)
+		if err != nil {
+			printError(err)
+			var apiErr *partyclient.Error
+			if errors.As(err, &apiErr) {
+				return 1
+			}
+			return 2
+		}
+		if page.Missed > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d lines were overwritten before they could be read\n", page.Missed)
+		}
+		for _, line := range page.Lines {
+			if jsonOutput() {
+				data, _ := json.Marshal(line)
+				fmt.Println(string(data))
+			} else {
+				fmt.Println(line.Line)
+			}
+		}
+		// The server was restarted when its log is behind what was read
+		if page.Next < next {
+			fmt.Fprintln(os.Stderr, "warning: the server was restarted, reading its new log")
+			page.Next = 0
+		}
+		next = page.Next
+		if !*follow {
+			return 0
+		}
+		time.Sleep(logsPollInterval)
+	}
+}
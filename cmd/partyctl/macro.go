@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runMacro(args []string) int {
+	flags := flag.NewFlagSet("macro", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl macro [flags] <server> <macro> [name=value...]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Starts a macro of the configuration on a running server, overriding the")
+		fmt.Fprintln(os.Stderr, "defaults of its arguments with name=value pairs, and prints the commands")
+		fmt.Fprintln(os.Stderr, "it runs. The steps continue in the background.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return 2
+	}
+	macroArgs := make(map[string]string)
+	for _, arg := range flags.Args()[2:] {
+		name, value, found := strings.Cut(arg, "=")
+		if !found || name == "" {
+			fmt.Fprintf(os.Stderr, "invalid argument %q (must be name=value)\n", arg)
+			return 2
+		}
+		macroArgs[name] = value
+	}
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	run, err := client.RunMacro(context.Background(), flags.Arg(0), flags.Arg(1), macroArgs)
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(run)
+		return 0
+	}
+	fmt.Printf("Started %s on %s (%s):\n", run.Macro, run.Server, run.Duration)
+	for _, command := range run.Commands {
+		fmt.Printf("  %s\n", command)
+	}
+	return 0
+}
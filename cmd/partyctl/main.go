@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"ban":           {"Ban players from a server and its group", runBan},
+	"bulk-create":   {"Generate copies of a server for a class or workshop", runBulkCreate},
+	"config":        {"Commit a change of the allowlist or player limit of a server", runConfig},
+	"console":       {"Attach to the console of a running server", runConsole},
+	"doctor":        {"Check that this host can run the manager", runDoctor},
+	"drift":         {"Show where running servers differ from their configuration", runDrift},
+	"events":        {"Follow the activity of the manager", runEvents},
+	"exec":          {"Run a console command and print its output", runExec},
+	"freeze":        {"Stop the manager from applying configuration and restarting servers", runFreeze},
+	"lint":          {"Validate a server configuration file or Git ref", runLint},
+	"lock":          {"Lock the settings of a server, e.g. for a tournament", runLock},
+	"logs":          {"Print the console output of a running server", runLogs},
+	"macro":         {"Run a command macro on a running server", runMacro},
+	"migrate-world": {"Move the world of a server to another server", runMigrateWorld},
+	"mirror":        {"Copy Bedrock versions and world templates to the mirror", runMirror},
+	"profile":       {"Manage named manager endpoints", runProfile},
+	"promote":       {"Promote the configuration of one environment to another", runPromote},
+	"status":        {"List the servers of the manager", runStatus},
+	"usage":         {"Report the resource usage of servers per month", runUsage},
+}
+
+func init() {
+	// Registered here because the completion script lists the commands
+	commands["completion"] = command{"Print a bash, zsh or fish completion script", runCompletion}
+}
+
+func main() {
+	global := flag.NewFlagSet("partyctl", flag.ExitOnError)
+	global.StringVar(&outputFormat, "o", outputText, "output format: text or json")
+	profileName := global.String("profile", "", "named manager endpoint to use (default $PARTY_PROFILE or the current profile)")
+	global.Usage = usage
+	global.Parse(os.Args[1:])
+
+	if outputFormat != outputText && outputFormat != outputJSON {
+		fmt.Fprintf(os.Stderr, "invalid output format %q (must be text or json)\n", outputFormat)
+		os.Exit(2)
+	}
+	if global.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, exists := commands[global.Arg(0)]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", global.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	// Managing profiles must work even when the selected one is broken
+	if global.Arg(0) != "profile" {
+		if err := selectProfile(*profileName); err != nil {
+			printError(err)
+			os.Exit(2)
+		}
+	}
+
+	os.Exit(cmd.run(global.Args()[1:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: partyctl [-o text|json] [-profile name] <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].summary)
+	}
+}
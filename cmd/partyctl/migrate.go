@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runMigrateWorld(args []string) int {
+	flags := flag.NewFlagSet("migrate-world", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	toProfile := flags.String("to-profile", "", "profile of the manager of the target server, when it is not the same manager")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl migrate-world [flags] <from-server> <to-server>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Backs up the world of a server and restores it as the world of another,")
+		fmt.Fprintln(os.Stderr, "which keeps its own port and properties. With -to-profile the world is")
+		fmt.Fprintln(os.Stderr, "exported from this manager and imported into the other one.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	from, to := flags.Arg(0), flags.Arg(1)
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	var result *server.MigrationResult
+	if *toProfile == "" {
+		result, err = client.MigrateWorld(context.Background(), from, to)
+	} else {
+		var target *partyclient.Client
+		if target, err = profileClient(*toProfile); err != nil {
+			printError(err)
+			return 2
+		}
+		result, err = migrateBetweenManagers(client, target, from, to)
+	}
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(result)
+		return 0
+	}
+	fmt.Printf("Migrated world of %s to %s (backup %s)\n", from, to, result.Backup)
+	if result.TargetBackup != "" {
+		fmt.Printf("The previous world of %s is kept as backup %s\n", to, result.TargetBackup)
+	}
+	for _, difference := range result.Differences {
+		fmt.Printf("warning: the servers differ in %s\n", difference)
+	}
+	return 0
+}
+
+// migrateBetweenManagers backs up both worlds, downloads the world of from
+// and uploads it as the world of to on the target manager
+func migrateBetweenManagers(source, target *partyclient.Client, from, to string) (*server.MigrationResult, error) {
+	ctx := context.Background()
+	result := &server.MigrationResult{From: from, To: to}
+
+	backup, err := source.Backup(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	result.Backup = backup.ID
+	// A target without a world yet cannot be backed up, and the import
+	// keeps the replaced world as well
+	if targetBackup, err := target.Backup(ctx, to); err == nil {
+		result.TargetBackup = targetBackup.ID
+	} else {
+		fmt.Fprintf(os.Stderr, "warning: world of %s not backed up: %v\n", to, err)
+	}
+
+	archive, err := os.CreateTemp("", "world-migrate-*.mcworld")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := source.ExportWorld(ctx, from, archive); err != nil {
+		return nil, fmt.Errorf("failed to export world of %s: %w", from, err)
+	}
+	if _, err := archive.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	if err := target.ImportWorld(ctx, to, archive); err != nil {
+		return nil, fmt.Errorf("failed to import world into %s: %w", to, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/egress"
+	"minecraft-server-manager/internal/mirror"
+)
+
+// syncedArtifact is the outcome of copying one artifact to the mirror
+type syncedArtifact struct {
+	Artifact string `json:"artifact"`
+	Location string `json:"location"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Outcomes of syncedArtifact
+const (
+	syncPresent   = "present"
+	syncPublished = "published"
+	syncFailed    = "failed"
+)
+
+func runMirror(args []string) int {
+	if len(args) < 1 || args[0] != "sync" {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl mirror sync [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Copies the Bedrock versions and world templates of the servers to the mirror,")
+		fmt.Fprintln(os.Stderr, "see partyctl mirror sync -h")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("mirror sync", flag.ExitOnError)
+	configPath := flags.String("config", "", "manager configuration file (default $CONFIG_PATH or config.yaml)")
+	serversPath := flags.String("servers", "", "server configuration file to sync (default: fetched from the configured repositories)")
+	versions := flags.String("versions", "", "comma-separated Bedrock versions to sync besides those of the servers")
+	dir := flags.String("dir", "", "write the HTTP layout to this directory instead of the configured mirror, e.g. to carry it to an offline site")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl mirror sync [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Downloads the Bedrock versions and world templates the servers use from their")
+		fmt.Fprintln(os.Stderr, "original locations and publishes those the mirror does not have yet. Run it")
+		fmt.Fprintln(os.Stderr, "on a host with internet access. Exits with 1 when an artifact failed.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	if *configPath != "" {
+		os.Setenv("CONFIG_PATH", *configPath)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	egress.Install(cfg.Egress)
+
+	target := mirror.New(cfg.Mirror)
+	if *dir != "" {
+		abs, err := filepath.Abs(*dir)
+		if err != nil {
+			printError(err)
+			return 2
+		}
+		target = mirror.New(config.MirrorConfig{URL: "file://" + filepath.ToSlash(abs)})
+	}
+	if target == nil {
+		printError(fmt.Errorf("no mirror configured, set mirror.url or pass -dir"))
+		return 2
+	}
+
+	repoConfig, err := loadRepoConfig(cfg, *serversPath)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+
+	var results []syncedArtifact
+	for _, version := range mirrorVersions(repoConfig, *versions) {
+		artifact := mirror.Bedrock(version)
+		checksum, err := cfg.BedrockChecksum(repoConfig, version)
+		if err != nil {
+			results = append(results, syncedArtifact{Artifact: artifact.String(), Location: target.Location(artifact), Status: syncFailed, Error: err.Error()})
+			continue
+		}
+		url := strings.ReplaceAll(cfg.Server.Versions.URL, "{version}", version)
+		results = append(results, syncArtifact(target, artifact, url, checksum))
+	}
+	for _, name := range mirrorTemplates(repoConfig) {
+		template := repoConfig.WorldTemplates[name]
+		results = append(results, syncArtifact(target, mirror.Template(template.SHA256), template.URL, strings.ToLower(template.SHA256)))
+	}
+
+	failed := false
+	for _, result := range results {
+		failed = failed || result.Status == syncFailed
+	}
+	if jsonOutput() {
+		printJSON(results)
+	} else {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, result := range results {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", strings.ToUpper(result.Status), result.Artifact, result.Location)
+			if result.Error != "" {
+				fmt.Fprintf(table, "\t\terror: %s\n", result.Error)
+			}
+		}
+		table.Flush()
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// mirrorVersions returns the Bedrock versions of the servers, other than
+// channels, and the extra ones, sorted
+func mirrorVersions(repoConfig *config.RepoConfig, extra string) []string {
+	seen := make(map[string]bool)
+	for _, serverConfig := range repoConfig.Servers {
+		// Builds of channels are named with -versions
+		if serverConfig.Version != "" && serverConfig.Version != config.ChannelLatest && serverConfig.Version != config.ChannelPreview {
+			seen[serverConfig.Version] = true
+		}
+	}
+	for _, version := range strings.Split(extra, ",") {
+		if version = strings.TrimSpace(version); version != "" {
+			seen[version] = true
+		}
+	}
+	versions := make([]string, 0, len(seen))
+	for version := range seen {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// mirrorTemplates returns the names of the world templates with a URL and
+// checksum, which are those the manager downloads, sorted
+func mirrorTemplates(repoConfig *config.RepoConfig) []string {
+	var names []string
+	for name, template := range repoConfig.WorldTemplates {
+		if template.URL != "" && template.SHA256 != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// syncArtifact publishes an artifact the mirror does not have, downloaded
+// from url and verified against checksum unless empty
+func syncArtifact(target *mirror.Mirror, artifact mirror.Artifact, url, checksum string) syncedArtifact {
+	ctx := context.Background()
+	result := syncedArtifact{Artifact: artifact.String(), Location: target.Location(artifact), Status: syncFailed}
+
+	exists, err := target.Has(ctx, artifact)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if exists {
+		result.Status = syncPresent
+		return result
+	}
+
+	file, err := os.CreateTemp("", "party-mirror-*.zip")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer os.Remove(file.Name())
+	err = downloadArtifact(url, file, checksum)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		result.Error = fmt.Sprintf("download from %s: %v", url, err)
+		return result
+	}
+
+	if err := target.Publish(ctx, artifact, file.Name()); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = syncPublished
+	return result
+}
+
+// downloadArtifact writes url to w, verifying its SHA256 checksum unless
+// empty
+func downloadArtifact(url string, w io.Writer, checksum string) error {
+	var body io.Reader
+	if path, local := strings.CutPrefix(url, "file://"); local {
+		source, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer source.Close()
+		body = source
+	} else {
+		client := &http.Client{Timeout: 30 * time.Minute}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		body = resp.Body
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), body); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); checksum != "" && actual != checksum {
+		return fmt.Errorf("checksum mismatch (expected: %s, got: %s)", checksum, actual)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+// Output formats of the global -o flag
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormat is set by the global -o flag
+var outputFormat = outputText
+
+// jsonOutput reports whether commands print JSON instead of text
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// printJSON writes a value as indented JSON to stdout
+func printJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// printError reports an error on stderr, as {"error": ..., "status": ...}
+// in JSON mode
+func printError(err error) {
+	if !jsonOutput() {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return
+	}
+
+	output := struct {
+		Error  string `json:"error"`
+		Status int    `json:"status,omitempty"`
+	}{Error: err.Error()}
+	var apiErr *partyclient.Error
+	if errors.As(err, &apiErr) {
+		output.Error, output.Status = apiErr.Message, apiErr.Status
+	}
+	encoder := json.NewEncoder(os.Stderr)
+	encoder.Encode(output)
+}
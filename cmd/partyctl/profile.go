@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile is a named manager endpoint with its credentials
+type profile struct {
+	Addr       string `yaml:"addr" json:"addr"`
+	Token      string `yaml:"token,omitempty" json:"-"`
+	CACert     string `yaml:"ca_cert,omitempty" json:"ca_cert,omitempty"`
+	ClientCert string `yaml:"client_cert,omitempty" json:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty" json:"client_key,omitempty"`
+}
+
+// fill sets the empty fields of p from other
+func (p *profile) fill(other profile) {
+	p.Addr = firstSet(p.Addr, other.Addr)
+	p.Token = firstSet(p.Token, other.Token)
+	p.CACert = firstSet(p.CACert, other.CACert)
+	p.ClientCert = firstSet(p.ClientCert, other.ClientCert)
+	p.ClientKey = firstSet(p.ClientKey, other.ClientKey)
+}
+
+func firstSet(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// profileFile is the profiles configuration, ~/.config/party/config
+type profileFile struct {
+	Current  string             `yaml:"current,omitempty"`
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// profilesPath is $PARTY_CONFIG, or party/config in the XDG configuration
+// directory
+func profilesPath() string {
+	if path := os.Getenv("PARTY_CONFIG"); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "party", "config")
+}
+
+// loadProfiles reads the profiles file, which may not exist
+func loadProfiles(path string) (*profileFile, error) {
+	file := &profileFile{Profiles: make(map[string]profile)}
+	if path == "" {
+		return file, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return file, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if file.Profiles == nil {
+		file.Profiles = make(map[string]profile)
+	}
+	return file, nil
+}
+
+// save writes the profiles file, readable only by the user as it holds
+// tokens
+func (f *profileFile) save(path string) error {
+	if path == "" {
+		return errors.New("cannot locate the home directory, set $PARTY_CONFIG")
+	}
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// selectProfile resolves the connection settings. A profile named by
+// -profile or $PARTY_PROFILE takes precedence over the $PARTY_* variables;
+// the current profile of the file only fills in what they leave unset.
+func selectProfile(name string) error {
+	env := profile{
+		Addr:       os.Getenv("PARTY_ADDR"),
+		Token:      os.Getenv("PARTY_TOKEN"),
+		CACert:     os.Getenv("PARTY_CA_CERT"),
+		ClientCert: os.Getenv("PARTY_CLIENT_CERT"),
+		ClientKey:  os.Getenv("PARTY_CLIENT_KEY"),
+	}
+
+	if name == "" {
+		name = os.Getenv("PARTY_PROFILE")
+	}
+	explicit := name != ""
+
+	path := profilesPath()
+	file, err := loadProfiles(path)
+	if err != nil {
+		return err
+	}
+	if !explicit {
+		name = file.Current
+	}
+
+	connection = env
+	if name == "" {
+		return nil
+	}
+	selected, exists := file.Profiles[name]
+	if !exists {
+		return fmt.Errorf("unknown profile %q in %s", name, path)
+	}
+	if explicit {
+		selected.fill(env)
+		connection = selected
+	} else {
+		connection.fill(selected)
+	}
+	return nil
+}
+
+func runProfile(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl profile <list|set|use|remove> [arguments]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Manages named manager endpoints in "+profilesPath()+":")
+		fmt.Fprintln(os.Stderr, "  list [-q]                 list the profiles, * marks the current one")
+		fmt.Fprintln(os.Stderr, "  set [flags] <name>        add or update a profile, see partyctl profile set -h")
+		fmt.Fprintln(os.Stderr, "  use <name>                make a profile the current one")
+		fmt.Fprintln(os.Stderr, "  remove <name>             delete a profile")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Select a profile for one command with partyctl -profile <name> <command>.")
+	}
+	if len(args) < 1 {
+		usage()
+		return 2
+	}
+
+	path := profilesPath()
+	file, err := loadProfiles(path)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		return listProfiles(file, args[1:])
+	case "set":
+		return setProfile(file, path, args[1:])
+	case "use", "remove":
+		if len(args) != 2 {
+			usage()
+			return 2
+		}
+		name := args[1]
+		if _, exists := file.Profiles[name]; !exists {
+			printError(fmt.Errorf("unknown profile %q", name))
+			return 1
+		}
+		if args[0] == "use" {
+			file.Current = name
+		} else {
+			delete(file.Profiles, name)
+			if file.Current == name {
+				file.Current = ""
+			}
+		}
+		if err := file.save(path); err != nil {
+			printError(err)
+			return 1
+		}
+		return 0
+	default:
+		usage()
+		return 2
+	}
+}
+
+func listProfiles(file *profileFile, args []string) int {
+	flags := flag.NewFlagSet("profile list", flag.ExitOnError)
+	quiet := flags.Bool("q", false, "only print profile names")
+	flags.Parse(args)
+
+	names := make([]string, 0, len(file.Profiles))
+	for name := range file.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	switch {
+	case *quiet:
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case jsonOutput():
+		// Tokens are never printed
+		type listed struct {
+			Name    string `json:"name"`
+			Current bool   `json:"current"`
+			Token   bool   `json:"token"`
+			profile
+		}
+		output := make([]listed, 0, len(names))
+		for _, name := range names {
+			p := file.Profiles[name]
+			output = append(output, listed{Name: name, Current: name == file.Current, Token: p.Token != "", profile: p})
+		}
+		printJSON(output)
+	default:
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "CURRENT\tNAME\tADDRESS\tTOKEN")
+		for _, name := range names {
+			p := file.Profiles[name]
+			current, token := "", "no"
+			if name == file.Current {
+				current = "*"
+			}
+			if p.Token != "" {
+				token = "yes"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", current, name, p.Addr, token)
+		}
+		table.Flush()
+	}
+	return 0
+}
+
+func setProfile(file *profileFile, path string, args []string) int {
+	flags := flag.NewFlagSet("profile set", flag.ExitOnError)
+	addr := flags.String("addr", "", "manager API address")
+	tokenStdin := flags.Bool("token-stdin", false, "read the API token from stdin")
+	caCert := flags.String("ca-cert", "", "CA certificate verifying the manager")
+	clientCert := flags.String("client-cert", "", "client certificate for mTLS")
+	clientKey := flags.String("client-key", "", "key of the client certificate")
+	use := flags.Bool("use", false, "make it the current profile")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl profile set [flags] <name>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Adds a profile or updates the given settings of an existing one. The token")
+		fmt.Fprintln(os.Stderr, "is read from stdin so that it stays out of the shell history, e.g.")
+		fmt.Fprintln(os.Stderr, "  pass show party/prod | partyctl profile set -addr https://prod:8080 -token-stdin prod")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	name := flags.Arg(0)
+
+	p, exists := file.Profiles[name]
+	if !exists && *addr == "" {
+		printError(errors.New("-addr is required for a new profile"))
+		return 2
+	}
+	p.Addr = firstSet(*addr, p.Addr)
+	p.CACert = firstSet(absPath(*caCert), p.CACert)
+	p.ClientCert = firstSet(absPath(*clientCert), p.ClientCert)
+	p.ClientKey = firstSet(absPath(*clientKey), p.ClientKey)
+	if *tokenStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if line = strings.TrimSpace(line); line == "" {
+			if err == nil {
+				err = errors.New("no token on stdin")
+			}
+			printError(err)
+			return 2
+		}
+		p.Token = line
+	}
+
+	file.Profiles[name] = p
+	if *use || file.Current == "" {
+		file.Current = name
+	}
+	if err := file.save(path); err != nil {
+		printError(err)
+		return 1
+	}
+	return 0
+}
+
+// absPath makes certificate paths independent of the directory partyctl
+// runs in
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
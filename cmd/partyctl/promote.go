@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runPromote(args []string) int {
+	flags := flag.NewFlagSet("promote", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	sha := flags.String("sha", "", "commit of the source environment to promote (default: its branch head)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl promote [flags] <from-environment> <to-environment>")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Fast-forwards the branch of the target environment to a validated commit")
+		fmt.Fprintln(os.Stderr, "of the source environment.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	promotion, err := client.Promote(context.Background(), partyclient.PromoteRequest{
+		From: flags.Arg(0),
+		To:   flags.Arg(1),
+		SHA:  *sha,
+	})
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	if jsonOutput() {
+		printJSON(promotion)
+		return 0
+	}
+
+	updated := make(map[string]bool)
+	for _, name := range promotion.Updated {
+		updated[name] = true
+	}
+
+	names := make([]string, 0, len(promotion.Commits))
+	for name := range promotion.Commits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		state := "already up to date"
+		if updated[name] {
+			state = "fast-forwarded"
+		}
+		fmt.Printf("%s: %s %s to %s\n", name, promotion.To, state, promotion.Commits[name])
+	}
+	return 0
+}
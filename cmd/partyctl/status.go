@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runStatus(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	quiet := flags.Bool("q", false, "only print server names")
+	statuses := flags.String("status", "", "only servers with these comma-separated statuses, e.g. crashed")
+	groups := flags.String("group", "", "only servers in these comma-separated groups")
+	tenants := flags.String("tenant", "", "only servers of these comma-separated tenants")
+	sortKey := flags.String("sort", "", "order by name, status, group, port, priority, players or uptime; prefix with - to reverse")
+	limit := flags.Int("limit", 0, "print at most this many servers")
+	offset := flags.Int("offset", 0, "skip this many servers")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl status [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Lists the servers of the manager with their status, port and players.")
+		fmt.Fprintln(os.Stderr, "Servers that were skipped are listed too, unless servers are filtered,")
+		fmt.Fprintln(os.Stderr, "sorted or paged.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+
+	var status *server.ManagerStatus
+	var list *server.ServerList
+	if *statuses == "" && *groups == "" && *tenants == "" && *sortKey == "" && *limit == 0 && *offset == 0 {
+		status, err = client.Status(context.Background())
+	} else {
+		list, err = client.Servers(context.Background(), server.ServerQuery{
+			Statuses: splitList(*statuses),
+			Groups:   splitList(*groups),
+			Tenants:  splitList(*tenants),
+			Sort:     *sortKey,
+			Limit:    *limit,
+			Offset:   *offset,
+		})
+	}
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+
+	var servers []server.ServerStatus
+	var skipped []server.SkippedServer
+	var quarantined []server.QuarantinedServer
+	if status != nil {
+		servers, skipped, quarantined = status.Servers, status.Skipped, status.Quarantined
+	} else {
+		servers = list.Servers
+	}
+
+	switch {
+	case *quiet:
+		for _, serverStatus := range servers {
+			fmt.Println(serverStatus.Name)
+		}
+	case jsonOutput() && status != nil:
+		printJSON(status)
+	case jsonOutput():
+		printJSON(list)
+	default:
+		if status != nil && status.Frozen != nil {
+			printFreeze(status.Frozen)
+			fmt.Println()
+		}
+		if status != nil && status.Stale != nil {
+			printStaleness(status.Stale)
+			fmt.Println()
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "NAME\tSTATUS\tGROUP\tPORT\tPLAYERS\tUPTIME")
+		for _, serverStatus := range servers {
+			statusText := serverStatus.Status
+			if serverStatus.LockedUntil != nil {
+				statusText += " (locked)"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%s\n", serverStatus.Name, statusText, dash(serverStatus.Group),
+				serverStatus.Port, serverStatus.PlayerCount, serverStatus.Uptime)
+		}
+		for _, skipped := range skipped {
+			fmt.Fprintf(table, "%s\tskipped\t-\t-\t-\t%s\n", skipped.Name, skipped.Reason)
+		}
+		for _, q := range quarantined {
+			fmt.Fprintf(table, "%s\tquarantined\t-\t-\t-\t%d restarts\n", q.Name, q.Restarts)
+		}
+		table.Flush()
+		if list != nil && len(list.Servers) > 0 && len(list.Servers) < list.Total {
+			fmt.Printf("\nShowing %d-%d of %d servers\n", list.Offset+1, list.Offset+len(list.Servers), list.Total)
+		}
+	}
+	return 0
+}
+
+// splitList splits a comma-separated flag value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func printStaleness(stale *server.Staleness) {
+	fmt.Printf("Configuration stale since %s", stale.Since.Local().Format("2006-01-02 15:04:05"))
+	if stale.Error != "" {
+		fmt.Printf(": %s", stale.Error)
+	}
+	fmt.Println()
+	switch {
+	case stale.SafeMode:
+		fmt.Println("Safe mode: servers are only restarted after crashes")
+	case stale.SafeModeAt != nil:
+		fmt.Printf("Safe mode begins at %s\n", stale.SafeModeAt.Local().Format("2006-01-02 15:04"))
+	}
+}
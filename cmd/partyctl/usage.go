@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	usagereport "minecraft-server-manager/internal/usage"
+	"minecraft-server-manager/pkg/partyclient"
+)
+
+func runUsage(args []string) int {
+	flags := flag.NewFlagSet("usage", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "manager API address")
+	month := flags.String("month", "", "month to report, e.g. 2024-05 (default: the current month)")
+	tenants := flags.String("tenant", "", "only servers of these comma-separated tenants")
+	csv := flags.Bool("csv", false, "print the report as CSV")
+	list := flags.Bool("list", false, "list the months with recorded usage")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: partyctl usage [flags]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Reports the uptime, peak players, CPU, memory and storage of every server")
+		fmt.Fprintln(os.Stderr, "over a month. Months are in UTC; the current month is still in progress.")
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	client, err := newClient(*addr)
+	if err != nil {
+		printError(err)
+		return 2
+	}
+	if *month == "" {
+		*month = time.Now().UTC().Format(usagereport.MonthFormat)
+	}
+
+	ctx := context.Background()
+	switch {
+	case *list:
+		var months []string
+		if months, err = client.UsageMonths(ctx); err == nil && jsonOutput() {
+			printJSON(months)
+		} else if err == nil {
+			for _, key := range months {
+				fmt.Println(key)
+			}
+		}
+	case *csv:
+		err = client.UsageReportCSV(ctx, *month, splitList(*tenants), os.Stdout)
+	default:
+		var report *usagereport.Report
+		if report, err = client.UsageReport(ctx, *month, splitList(*tenants)); err == nil {
+			printUsageReport(report)
+		}
+	}
+	if err != nil {
+		printError(err)
+		var apiErr *partyclient.Error
+		if errors.As(err, &apiErr) {
+			return 1
+		}
+		return 2
+	}
+	return 0
+}
+
+func printUsageReport(report *usagereport.Report) {
+	if jsonOutput() {
+		printJSON(report)
+		return
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TENANT\tSERVER\tUPTIME\tPEAK PLAYERS\tCPU CORE HOURS\tAVG MEMORY\tPEAK MEMORY\tSTORAGE")
+	for _, server := range report.Servers {
+		fmt.Fprintf(writer, "%s\t%s\t%.1fh\t%d\t%.2f\t%s\t%s\t%s\n",
+			dash(server.Tenant), server.Server, server.UptimeHours, server.PeakPlayers, server.CPUCoreHours,
+			formatBytes(server.AvgMemoryBytes), formatBytes(server.PeakMemoryBytes), formatBytes(server.StorageBytes))
+	}
+	writer.Flush()
+}
+
+// formatBytes prints a size with a binary unit, e.g. 1.5G
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, suffix := float64(size), ""
+	for _, next := range []string{"K", "M", "G", "T"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
@@ -5,10 +5,8 @@ go 1.21
 require (
 	github.com/google/go-github/v57 v57.0.0
 	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/sys v0.13.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/google/go-querystring v1.1.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
-)
+require github.com/google/go-querystring v1.1.0 // indirect
@@ -0,0 +1,380 @@
+// Package alert evaluates threshold rules against the metric set and sends
+// notifications when they fire and resolve, opening incidents for the
+// severe ones.
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/incident"
+	"minecraft-server-manager/internal/metrics"
+	"minecraft-server-manager/internal/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Engine evaluates alert rules at a fixed interval
+type Engine struct {
+	rules     []rule
+	interval  time.Duration
+	maxWindow time.Duration
+	notifier  *notify.Notifier
+	incidents *incident.Dispatcher
+	events    *events.Bus
+	logger    *logrus.Logger
+
+	// history holds recent values per series for windowed rules
+	history map[string][]point
+	// states tracks each rule per series
+	states map[string]*state
+
+	// path is the file the open incidents are kept in, so that they are
+	// resolved after a restart too
+	path string
+	// restored holds the incidents open before a restart by state key,
+	// until the first evaluation takes them over or resolves them
+	restored map[string]incident.Incident
+	// dirty is set when an incident was opened or resolved since the open
+	// incidents were last saved
+	dirty bool
+}
+
+type rule struct {
+	config.AlertRule
+	threshold float64
+	forDur    time.Duration
+	window    time.Duration
+	cooldown  time.Duration
+}
+
+type point struct {
+	at    time.Time
+	value float64
+}
+
+type state struct {
+	pendingSince time.Time
+	firing       bool
+	resolvedAt   time.Time
+	seen         bool
+	// incident is the incident opened while firing, nil without one
+	incident *incident.Incident
+}
+
+// NewEngine creates an engine for the configured rules, which notifies and
+// publishes events when they fire and resolve, and opens incidents for
+// rules of the configured incident severity. The open incidents are kept in
+// dataDir. The rules have been validated when the configuration was loaded.
+func NewEngine(cfg config.AlertsConfig, dataDir string, notifier *notify.Notifier, bus *events.Bus, logger *logrus.Logger) *Engine {
+	engine := &Engine{
+		interval:  time.Duration(cfg.Interval) * time.Second,
+		notifier:  notifier,
+		incidents: incident.New(cfg.Incidents, notifier, logger),
+		events:    bus,
+		logger:    logger,
+		history:   make(map[string][]point),
+		states:    make(map[string]*state),
+		path:      filepath.Join(dataDir, "alert_incidents.json"),
+	}
+
+	for _, ruleConfig := range cfg.Rules {
+		threshold, _ := ruleConfig.ThresholdValue()
+		r := rule{
+			AlertRule: ruleConfig,
+			threshold: threshold,
+			forDur:    time.Duration(ruleConfig.ForMinutes) * time.Minute,
+			window:    time.Duration(ruleConfig.WindowMinutes) * time.Minute,
+			cooldown:  time.Duration(ruleConfig.CooldownMinutes) * time.Minute,
+		}
+		engine.maxWindow = max(engine.maxWindow, r.window)
+		engine.rules = append(engine.rules, r)
+	}
+
+	if err := engine.loadIncidents(); err != nil {
+		logger.Warnf("Failed to load open alert incidents: %v", err)
+	}
+	return engine
+}
+
+// loadIncidents reads the incidents left open by the previous run
+func (e *Engine) loadIncidents() error {
+	data, err := os.ReadFile(e.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &e.restored); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", e.path, err)
+	}
+	return nil
+}
+
+// saveIncidents writes the open incidents by state key
+func (e *Engine) saveIncidents() error {
+	open := make(map[string]incident.Incident)
+	for key, inc := range e.restored {
+		open[key] = inc
+	}
+	for key, s := range e.states {
+		if s.incident != nil {
+			open[key] = *s.incident
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(e.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(open, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := e.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.path)
+}
+
+// Run evaluates the rules every interval until ctx is cancelled
+func (e *Engine) Run(ctx context.Context, collect metrics.Collector) {
+	if len(e.rules) == 0 {
+		// Incidents of rules removed since the restart are resolved still
+		if len(e.restored) > 0 {
+			e.Evaluate(time.Now(), nil)
+		}
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(now, collect())
+		}
+	}
+}
+
+// Evaluate checks every rule against one round of samples
+func (e *Engine) Evaluate(now time.Time, samples []metrics.Metric) {
+	if e.maxWindow > 0 {
+		e.record(now, samples)
+	}
+
+	for _, s := range e.states {
+		s.seen = false
+	}
+
+	for _, r := range e.rules {
+		for _, sample := range samples {
+			if sample.Name != r.Metric || (r.Server != "" && sample.Labels["server"] != r.Server) {
+				continue
+			}
+
+			series := seriesKey(sample)
+			value := sample.Value
+			if r.window > 0 {
+				value = e.increase(series, now.Add(-r.window), sample.Value)
+			}
+
+			key := r.Name + "|" + series
+			s, exists := e.states[key]
+			if !exists {
+				s = &state{}
+				e.states[key] = s
+			}
+			s.seen = true
+			if restored, exists := e.restored[key]; exists {
+				// An incident open before a restart fires on and is
+				// resolved once the rule no longer matches
+				delete(e.restored, key)
+				s.firing, s.pendingSince, s.incident = true, now, &restored
+			}
+			e.evaluateSeries(now, r, s, sample, value)
+		}
+	}
+
+	// Incidents of rules or series that are gone since the restart are
+	// resolved with the first evaluation
+	for key, restored := range e.restored {
+		e.incidents.Resolve(restored)
+		delete(e.restored, key)
+		e.dirty = true
+	}
+
+	// Forget series that are gone, e.g. servers removed from the
+	// configuration, resolving their incidents
+	for key, s := range e.states {
+		if !s.seen {
+			if s.incident != nil {
+				e.incidents.Resolve(*s.incident)
+				e.dirty = true
+			}
+			delete(e.states, key)
+		}
+	}
+
+	if e.dirty {
+		if err := e.saveIncidents(); err != nil {
+			e.logger.Errorf("Failed to save open alert incidents: %v", err)
+			return
+		}
+		e.dirty = false
+	}
+}
+
+func (e *Engine) evaluateSeries(now time.Time, r rule, s *state, sample metrics.Metric, value float64) {
+	if !compare(value, r.Op, r.threshold) {
+		s.pendingSince = time.Time{}
+		if s.firing {
+			s.firing = false
+			s.resolvedAt = now
+			e.logger.Infof("Alert %s resolved for %s", r.Name, seriesKey(sample))
+			e.notifier.Notify(notification(r, sample, value, "resolved", notify.SeverityInfo))
+			e.publish(events.AlertResolved, r, sample, value)
+			if s.incident != nil {
+				e.incidents.Resolve(*s.incident)
+				s.incident = nil
+				e.dirty = true
+			}
+		}
+		return
+	}
+
+	if s.pendingSince.IsZero() {
+		s.pendingSince = now
+	}
+	if s.firing || now.Sub(s.pendingSince) < r.forDur {
+		return
+	}
+	if !s.resolvedAt.IsZero() && now.Sub(s.resolvedAt) < r.cooldown {
+		return
+	}
+
+	s.firing = true
+	e.logger.Warnf("Alert %s firing for %s: %s", r.Name, seriesKey(sample), describe(r, value))
+	e.notifier.Notify(notification(r, sample, value, "firing", r.Severity))
+	e.publish(events.AlertFiring, r, sample, value)
+	if e.incidents.Accepts(r.Severity) {
+		s.incident = &incident.Incident{
+			Key:      r.Name + ":" + seriesKey(sample),
+			Summary:  fmt.Sprintf("%s: %s: %s", r.Name, seriesKey(sample), describe(r, value)),
+			Severity: r.Severity,
+			Server:   sample.Labels["server"],
+			Details: map[string]string{
+				"alert":  r.Name,
+				"metric": r.Metric,
+				"value":  fmt.Sprintf("%g", value),
+			},
+		}
+		e.incidents.Trigger(*s.incident)
+		e.dirty = true
+	}
+}
+
+// publish sends an alert transition to the event bus
+func (e *Engine) publish(eventType string, r rule, sample metrics.Metric, value float64) {
+	e.events.Publish(eventType, sample.Labels["server"], map[string]interface{}{
+		"alert":    r.Name,
+		"severity": r.Severity,
+		"metric":   r.Metric,
+		"series":   seriesKey(sample),
+		"value":    value,
+		"message":  describe(r, value),
+	})
+}
+
+// record adds samples to the history and drops values older than the
+// longest window
+func (e *Engine) record(now time.Time, samples []metrics.Metric) {
+	cutoff := now.Add(-e.maxWindow - e.interval)
+	for _, sample := range samples {
+		series := seriesKey(sample)
+		points := append(e.history[series], point{at: now, value: sample.Value})
+		for len(points) > 0 && points[0].at.Before(cutoff) {
+			points = points[1:]
+		}
+		e.history[series] = points
+	}
+}
+
+// increase returns how much a series grew since the oldest value recorded
+// at or after since
+func (e *Engine) increase(series string, since time.Time, current float64) float64 {
+	for _, p := range e.history[series] {
+		if !p.at.Before(since) {
+			return current - p.value
+		}
+	}
+	return 0
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+func seriesKey(sample metrics.Metric) string {
+	if server, exists := sample.Labels["server"]; exists {
+		return fmt.Sprintf("%s{server=%s}", sample.Name, server)
+	}
+	return sample.Name
+}
+
+func describe(r rule, value float64) string {
+	var b strings.Builder
+	if r.window > 0 {
+		fmt.Fprintf(&b, "increase over %s ", r.window)
+	}
+	fmt.Fprintf(&b, "%g %s %s", value, r.Op, r.Threshold)
+	if r.forDur > 0 {
+		fmt.Fprintf(&b, " for %s", r.forDur)
+	}
+	return b.String()
+}
+
+func notification(r rule, sample metrics.Metric, value float64, status, severity string) notify.Notification {
+	event := config.NotifyAlertFiring
+	if status == "resolved" {
+		event = config.NotifyAlertResolved
+	}
+	return notify.Notification{
+		Event:    event,
+		Title:    fmt.Sprintf("[%s] %s", strings.ToUpper(status), r.Name),
+		Message:  fmt.Sprintf("%s: %s", seriesKey(sample), describe(r, value)),
+		Severity: severity,
+		Server:   sample.Labels["server"],
+		Fields: map[string]string{
+			"alert":  r.Name,
+			"status": status,
+			"metric": r.Metric,
+			"value":  fmt.Sprintf("%g", value),
+		},
+	}
+}
@@ -0,0 +1,1013 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/logging"
+	"minecraft-server-manager/internal/metrics"
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/internal/usage"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Server struct {
+	manager *server.Manager
+	logger  *logrus.Logger
+	logging *logging.Logging
+
+	// prometheus enables the /metrics endpoint, pprof /debug/pprof/
+	prometheus bool
+	pprof      bool
+
+	// limiter limits requests per client, nil when unlimited
+	limiter *rateLimiter
+	audit   *audit.Log
+
+	// grants are the configured API tokens, none when the API is open
+	grants []*grant
+	// sessions holds OIDC logins, nil without OIDC
+	sessions *sessionStore
+
+	// origins are the origins besides the API's own whose pages may open
+	// WebSockets
+	origins []string
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(manager *server.Manager, cfg *config.Config, logger *logrus.Logger, logs *logging.Logging) *Server {
+	s := &Server{
+		manager:    manager,
+		logger:     logger,
+		logging:    logs,
+		prometheus: cfg.Metrics.Exporter == config.ExporterPrometheus,
+		pprof:      cfg.HTTP.Pprof,
+		audit:      audit.NewLog(filepath.Join(cfg.Server.DataDir, "audit.jsonl")),
+		grants:     newGrants(cfg.HTTP.Auth.Tokens),
+		sessions:   newSessionStore(cfg.HTTP.Auth.OIDC),
+		origins:    cfg.HTTP.AllowedOrigins,
+	}
+	if cfg.HTTP.RateLimit.RequestsPerSecond > 0 {
+		s.limiter = newRateLimiter(cfg.HTTP.RateLimit.RequestsPerSecond, cfg.HTTP.RateLimit.Burst)
+	}
+	return s
+}
+
+// Handler returns the HTTP handler serving all API routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/servers", s.handleServerList)
+	mux.HandleFunc("/servers/", s.handleServers)
+	mux.HandleFunc("/gc", s.handleGC)
+	mux.HandleFunc("/drift", s.handleDrift)
+	mux.HandleFunc("/freeze", s.handleFreeze)
+	mux.HandleFunc("/promote", s.handlePromote)
+	mux.HandleFunc("/bulk", s.handleBulk)
+	mux.HandleFunc("/applies", s.handleApplies)
+	mux.HandleFunc("/applies/", s.handleApplies)
+	mux.HandleFunc("/shutdown", s.handleShutdown)
+	mux.HandleFunc("/reports", s.handleReports)
+	mux.HandleFunc("/reports/", s.handleReports)
+	mux.HandleFunc("/audit", s.handleAudit)
+	mux.HandleFunc("/players", s.handlePlayers)
+	mux.HandleFunc("/logging", s.handleLogging)
+	mux.HandleFunc("/events", s.handleEvents)
+	mux.HandleFunc("/usage", s.handleUsage)
+	mux.HandleFunc("/usage/", s.handleUsage)
+	mux.HandleFunc("/openapi.json", s.handleOpenAPI)
+	if s.prometheus {
+		mux.HandleFunc("/metrics", s.handleMetrics)
+	}
+	if s.pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	if s.sessions != nil {
+		mux.HandleFunc("/auth/login", s.handleLogin)
+		mux.HandleFunc("/auth/callback", s.handleCallback)
+		mux.HandleFunc("/auth/logout", s.handleLogout)
+		mux.HandleFunc("/auth/session", s.handleSession)
+	}
+	return s.identifyClient(s.authenticate(s.auditMutations(s.authorize(s.rateLimit(mux)))))
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if s.manager.GetShutdownStatus() != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("SHUTTING DOWN"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// handleHealthz reports that the manager process is alive
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// handleReadyz reports whether the manager is ready, 503 with the failing
+// checks otherwise
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readiness := s.manager.GetReadiness()
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, status, readiness)
+}
+
+// handleShutdown reports the progress of a shutdown in progress
+func (s *Server) handleShutdown(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		status := s.manager.GetShutdownStatus()
+		if status == nil {
+			s.writeError(w, http.StatusNotFound, errors.New("not shutting down"))
+			return
+		}
+		s.writeJSON(w, http.StatusOK, status)
+	})
+}
+
+// handleReports lists crash reports on /reports and downloads one on
+// /reports/{name}
+func (s *Server) handleReports(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/reports"), "/")
+		if name == "" {
+			s.writeJSON(w, http.StatusOK, s.manager.GetCrashReports())
+			return
+		}
+
+		reportPath, err := s.manager.CrashReportPath(name)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		http.ServeFile(w, r, reportPath)
+	})
+}
+
+// handleUsage lists the months with recorded usage on /usage and serves
+// the usage report of one month on /usage/{month}, as CSV with
+// ?format=csv. ?tenant= limits the report to some tenants (comma-separated)
+// and scoped grants only see the servers in scope.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		month := strings.Trim(strings.TrimPrefix(r.URL.Path, "/usage"), "/")
+		if month == "" {
+			months, err := s.manager.UsageMonths()
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			s.writeJSON(w, http.StatusOK, months)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid format %q (must be json or csv)", format))
+			return
+		}
+		report, err := s.manager.UsageReport(month)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+
+		tenants := splitList(r.URL.Query().Get("tenant"))
+		g := grantFrom(r)
+		report = report.Filter(func(row usage.ServerUsage) bool {
+			if len(tenants) > 0 && !slices.Contains(tenants, row.Tenant) {
+				return false
+			}
+			if g == nil || !g.scoped() {
+				return true
+			}
+			group, _, _ := s.manager.ServerScope(row.Server)
+			return g.covers(row.Server, group, row.Tenant)
+		})
+
+		if format != "csv" {
+			s.writeJSON(w, http.StatusOK, report)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "usage-"+month+".csv"))
+		if err := report.WriteCSV(w); err != nil {
+			s.logger.Warnf("Failed to write usage report: %v", err)
+		}
+	})
+}
+
+// handleMetrics serves the metric set in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := metrics.WritePrometheus(w, "party", s.manager.Metrics()); err != nil {
+			s.logger.Warnf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status := s.manager.GetStatus()
+	if g := grantFrom(r); g != nil && g.scoped() {
+		s.filterStatus(g, &status)
+	}
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleServerList lists servers filtered by ?status=, ?group= and
+// ?tenant= (all comma-separated), ordered by ?sort= and paged with ?limit= and ?offset=
+func (s *Server) handleServerList(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		query, err := parseServerQuery(r.URL.Query())
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		status := s.manager.GetStatus()
+		if g := grantFrom(r); g != nil && g.scoped() {
+			s.filterStatus(g, &status)
+		}
+		s.writeJSON(w, http.StatusOK, query.Apply(status.Servers))
+	})
+}
+
+func parseServerQuery(values url.Values) (server.ServerQuery, error) {
+	query := server.ServerQuery{
+		Statuses: splitList(values.Get("status")),
+		Groups:   splitList(values.Get("group")),
+		Tenants:  splitList(values.Get("tenant")),
+		Sort:     values.Get("sort"),
+	}
+	for name, target := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+		if value := values.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return query, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = parsed
+		}
+	}
+	return query, query.Validate()
+}
+
+// splitList splits a comma-separated query parameter
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// filterStatus drops the servers outside the scope of a grant, and the
+// tenants other than the grant's
+func (s *Server) filterStatus(g *grant, status *server.ManagerStatus) {
+	inScope := func(name string) bool {
+		group, tenant, _ := s.manager.ServerScope(name)
+		return g.covers(name, group, tenant)
+	}
+
+	var tenants []server.TenantStatus
+	for _, tenant := range status.Tenants {
+		if tenant.Name == g.tenant {
+			tenants = append(tenants, tenant)
+		}
+	}
+	status.Tenants = tenants
+
+	servers := status.Servers[:0]
+	for _, serverStatus := range status.Servers {
+		if inScope(serverStatus.Name) {
+			servers = append(servers, serverStatus)
+		}
+	}
+	skipped := status.Skipped[:0]
+	for _, skippedServer := range status.Skipped {
+		if inScope(skippedServer.Name) {
+			skipped = append(skipped, skippedServer)
+		}
+	}
+	status.Servers, status.Skipped = servers, skipped
+	status.TotalServers = len(servers)
+	status.Running, status.Stopped = 0, 0
+	for _, serverStatus := range servers {
+		if serverStatus.Status == "running" {
+			status.Running++
+		} else {
+			status.Stopped++
+		}
+	}
+}
+
+// handleServers dispatches /servers/{name}/... routes
+func (s *Server) handleServers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/servers/"), "/"), "/")
+	if len(parts) < 2 || parts[0] == "" {
+		s.writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	name := parts[0]
+	action := strings.Join(parts[1:], "/")
+	if id, ok := backupRestoreID(action); ok {
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleBackupRestore(w, r, name, id) })
+		return
+	}
+	if macro, ok := macroAction(action); ok {
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleMacro(w, r, name, macro) })
+		return
+	}
+	if player, ok := bannedPlayer(action); ok {
+		s.requireMethod(w, r, http.MethodDelete, func() { s.handleUnban(w, r, name, player) })
+		return
+	}
+	if player, verb, ok := playerAction(action); ok {
+		s.requireMethod(w, r, http.MethodPost, func() { s.handlePlayerAction(w, r, name, player, verb) })
+		return
+	}
+
+	switch action {
+	case "world/import":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleWorldImport(w, r, name) })
+	case "world/reset":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleWorldReset(w, r, name) })
+	case "world/trim":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleWorldTrim(w, r, name) })
+	case "world/export":
+		s.requireMethod(w, r, http.MethodGet, func() { s.handleWorldExport(w, r, name) })
+	case "world/migrate":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleWorldMigrate(w, r, name) })
+	case "backups":
+		s.handleBackups(w, r, name)
+	case "uptime":
+		s.requireMethod(w, r, http.MethodGet, func() { s.handleUptime(w, r, name) })
+	case "warnings":
+		s.requireMethod(w, r, http.MethodGet, func() { s.handleWarnings(w, r, name) })
+	case "traffic":
+		s.requireMethod(w, r, http.MethodGet, func() { s.handleTraffic(w, r, name) })
+	case "restart":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleRestart(w, r, name) })
+	case "suspend":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleSuspend(w, r, name) })
+	case "resume":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleResume(w, r, name) })
+	case "release":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleRelease(w, r, name) })
+	case "confirm-version":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleConfirmVersion(w, r, name) })
+	case "lock":
+		s.handleLock(w, r, name)
+	case "command":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleCommand(w, r, name) })
+	case "console":
+		s.requireMethod(w, r, http.MethodGet, func() { s.handleConsole(w, r, name) })
+	case "logs":
+		s.requireMethod(w, r, http.MethodGet, func() { s.handleLogs(w, r, name) })
+	case "bans":
+		s.handleBans(w, r, name)
+	case "config":
+		s.requireMethod(w, r, http.MethodPatch, func() { s.handleServerConfig(w, r, name) })
+	case "weather":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleWeather(w, r, name) })
+	case "time":
+		s.requireMethod(w, r, http.MethodPost, func() { s.handleTime(w, r, name) })
+	default:
+		s.writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) handleWorldImport(w http.ResponseWriter, r *http.Request, name string) {
+	body := r.Body
+
+	// Accept both raw uploads and multipart forms with a "world" file field
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("world")
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	if err := s.manager.ImportWorld(name, body); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "imported"})
+}
+
+func (s *Server) handleWorldReset(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.manager.ResetWorld(name); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+}
+
+func (s *Server) handleWorldTrim(w http.ResponseWriter, r *http.Request, name string) {
+	result, err := s.manager.TrimWorld(name)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// handleWorldExport downloads a consistent copy of the world of a server
+// as a .mcworld archive
+func (s *Server) handleWorldExport(w http.ResponseWriter, r *http.Request, name string) {
+	export, err := s.manager.ExportWorld(name)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	defer export.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.World+".mcworld"))
+	if err := export.WriteArchive(w); err != nil {
+		s.logger.Warnf("Failed to write world export of %s: %v", name, err)
+	}
+}
+
+type migrateRequest struct {
+	From string `json:"from"`
+}
+
+// handleWorldMigrate replaces the world of a server with the world of the
+// server named in the request, which the grant must cover as well
+func (s *Server) handleWorldMigrate(w http.ResponseWriter, r *http.Request, name string) {
+	var req migrateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if g := grantFrom(r); g != nil {
+		group, tenant, _ := s.manager.ServerScope(req.From)
+		if !g.covers(req.From, group, tenant) {
+			s.writeError(w, http.StatusForbidden, errors.New("source server is not in scope"))
+			return
+		}
+	}
+
+	result, err := s.manager.MigrateWorld(req.From, name)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// backupRestoreID returns the backup of a backups/{id}/restore action
+func backupRestoreID(action string) (string, bool) {
+	rest, isBackup := strings.CutPrefix(action, "backups/")
+	id, isRestore := strings.CutSuffix(rest, "/restore")
+	return id, isBackup && isRestore && id != "" && !strings.Contains(id, "/")
+}
+
+// handleBackups lists the backups of a server on GET and takes one on POST
+func (s *Server) handleBackups(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		backups, err := s.manager.ListBackups(name)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, backups)
+	case http.MethodPost:
+		backup, err := s.manager.CreateBackup(name)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		backup.Files = nil
+		s.writeJSON(w, http.StatusOK, backup)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (s *Server) handleBackupRestore(w http.ResponseWriter, r *http.Request, name, id string) {
+	backup, err := s.manager.RestoreBackup(name, id)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, backup)
+}
+
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.manager.RestartServer(name); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "restarted"})
+}
+
+func (s *Server) handleSuspend(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.manager.SuspendServer(name); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "paused"})
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.manager.ResumeServer(name); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "running"})
+}
+
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.manager.ReleaseServer(name); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "released"})
+}
+
+type confirmVersionRequest struct {
+	Version string `json:"version"`
+}
+
+// handleConfirmVersion lets a server open its world with a Bedrock version
+// the world version guard refuses. The body is optional, the version
+// defaults to the configured one.
+func (s *Server) handleConfirmVersion(w http.ResponseWriter, r *http.Request, name string) {
+	var req confirmVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if err := s.manager.ConfirmVersion(name, req.Version); err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "confirmed"})
+}
+
+// commandRequest is a console command. Its output is captured until a line
+// matches Expect, for QuietMS without output when there is no Expect, or
+// for TimeoutMS.
+type commandRequest struct {
+	Command   string `json:"command"`
+	Expect    string `json:"expect,omitempty"`
+	QuietMS   int    `json:"quiet_ms,omitempty"`
+	TimeoutMS int    `json:"timeout_ms,omitempty"`
+}
+
+// handleCommand runs a console command and returns its output
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request, name string) {
+	var req commandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	opts := server.CommandOptions{
+		Quiet:   time.Duration(req.QuietMS) * time.Millisecond,
+		Timeout: time.Duration(req.TimeoutMS) * time.Millisecond,
+	}
+	if req.Expect != "" {
+		expect, err := regexp.Compile(req.Expect)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid expect pattern: %w", err))
+			return
+		}
+		opts.Expect = expect
+	}
+	if err := grantFrom(r).permitsCommand(req.Command); err != nil {
+		s.writeError(w, http.StatusForbidden, err)
+		return
+	}
+
+	result, err := s.manager.RunCommand(r.Context(), name, req.Command, opts)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	result.RequestID = requestID(r)
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// macroAction returns the macro of a macros/{macro} action
+func macroAction(action string) (string, bool) {
+	macro, ok := strings.CutPrefix(action, "macros/")
+	return macro, ok && macro != "" && !strings.Contains(macro, "/")
+}
+
+type macroRequest struct {
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// handleMacro starts a macro of the configuration on a server. Its
+// commands are subject to the command policy of the caller.
+func (s *Server) handleMacro(w http.ResponseWriter, r *http.Request, name, macro string) {
+	var req macroRequest
+	if err := decodeBody(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	g := grantFrom(r)
+	var refused error
+	run, err := s.manager.RunMacro(name, macro, req.Args, func(command string) error {
+		refused = g.permitsCommand(command)
+		return refused
+	})
+	if refused != nil {
+		s.writeError(w, http.StatusForbidden, err)
+		return
+	}
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, run)
+}
+
+func (s *Server) handleUptime(w http.ResponseWriter, r *http.Request, name string) {
+	report, err := s.manager.GetUptime(name)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) handleWarnings(w http.ResponseWriter, r *http.Request, name string) {
+	warnings, err := s.manager.GetWarnings(name)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, warnings)
+}
+
+// handleLogs returns the console lines of a server after ?since=N, up to
+// ?limit=N of them
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request, name string) {
+	var since uint64
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid since %q", value))
+			return
+		}
+		since = parsed
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", value))
+			return
+		}
+		limit = parsed
+	}
+
+	page, err := s.manager.ReadLogs(name, since, limit)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, page)
+}
+
+func (s *Server) handleTraffic(w http.ResponseWriter, r *http.Request, name string) {
+	traffic, err := s.manager.GetTraffic(name)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, traffic)
+}
+
+// handleGC runs a garbage collection; ?dry_run=true only reports what
+// would be removed
+func (s *Server) handleGC(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodPost, func() {
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+
+		report, err := s.manager.CollectGarbage(dryRun)
+		if err != nil {
+			s.writeError(w, http.StatusConflict, err)
+			return
+		}
+
+		s.writeJSON(w, http.StatusOK, report)
+	})
+}
+
+// handleDrift returns the last drift report on GET and checks for drift
+// now on POST, correcting it with ?correct=true
+func (s *Server) handleDrift(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		report := s.manager.GetDrift()
+		if report == nil {
+			s.writeError(w, http.StatusNotFound, errors.New("no drift check has run yet"))
+			return
+		}
+		s.writeJSON(w, http.StatusOK, report)
+	case http.MethodPost:
+		s.writeJSON(w, http.StatusOK, s.manager.CheckDrift(r.URL.Query().Get("correct") == "true"))
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// freezeRequest freezes the manager
+type freezeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// handleFreeze returns the freeze on GET, freezes the manager on PUT and
+// lifts the freeze on DELETE
+func (s *Server) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		freeze := s.manager.GetFreeze()
+		if freeze == nil {
+			s.writeError(w, http.StatusNotFound, server.ErrNotFrozen)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, freeze)
+	case http.MethodPut:
+		var req freezeRequest
+		if err := decodeBody(r, &req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, s.manager.FreezeManager(req.Reason, callerIdentity(r)))
+	case http.MethodDelete:
+		if err := s.manager.Unfreeze(callerIdentity(r)); err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]string{"status": "unfrozen"})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleApplies serves the apply history at /applies, the apply SLOs at
+// /applies/slo and the diff of one apply at /applies/{sha}/diff
+func (s *Server) handleApplies(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/applies"), "/")
+		if rest == "" {
+			s.writeJSON(w, http.StatusOK, s.manager.GetApplies())
+			return
+		}
+		if rest == "slo" {
+			s.writeJSON(w, http.StatusOK, s.manager.GetApplySLO())
+			return
+		}
+
+		sha, action, _ := strings.Cut(rest, "/")
+		if action != "diff" {
+			s.writeError(w, http.StatusNotFound, errors.New("not found"))
+			return
+		}
+
+		diff, err := s.manager.GetApplyDiff(sha)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, diff)
+	})
+}
+
+// handleLogging reports the log settings of the manager on GET and changes
+// them on PUT
+func (s *Server) handleLogging(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, http.StatusOK, s.logging.Settings())
+	case http.MethodPut:
+		var settings logging.Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		updated, err := s.logging.Update(settings)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, updated)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+type promoteRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	SHA  string `json:"sha"`
+}
+
+// handlePromote fast-forwards the branch of one environment to a validated
+// commit of another
+func (s *Server) handlePromote(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodPost, func() {
+		var req promoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if req.From == "" || req.To == "" {
+			s.writeError(w, http.StatusBadRequest, errors.New("from and to are required"))
+			return
+		}
+
+		promotion, err := s.manager.Promote(req.From, req.To, req.SHA)
+		if err != nil {
+			s.writeError(w, http.StatusConflict, err)
+			return
+		}
+
+		s.writeJSON(w, http.StatusOK, promotion)
+	})
+}
+
+// handleBulk generates copies of a configured server, e.g. one per student
+// of a class, and commits them to the configuration when requested
+func (s *Server) handleBulk(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodPost, func() {
+		var spec server.BulkSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if spec.Template == "" || spec.Ports == "" {
+			s.writeError(w, http.StatusBadRequest, errors.New("template and ports are required"))
+			return
+		}
+
+		result, err := s.manager.BulkCreate(spec, callerIdentity(r))
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, result)
+	})
+}
+
+// lockRequest locks the settings of a server until Until or for Minutes
+type lockRequest struct {
+	Reason  string    `json:"reason,omitempty"`
+	Until   time.Time `json:"until,omitempty"`
+	Minutes int       `json:"minutes,omitempty"`
+}
+
+// handleLock returns the lock of a server on GET, locks its settings on
+// PUT and lifts the lock on DELETE
+func (s *Server) handleLock(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		lock, err := s.manager.GetLock(name)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, lock)
+	case http.MethodPut:
+		var req lockRequest
+		if err := decodeBody(r, &req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		until := req.Until
+		if req.Minutes > 0 {
+			until = time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		}
+		if until.IsZero() {
+			s.writeError(w, http.StatusBadRequest, errors.New("until or minutes is required"))
+			return
+		}
+		lock, err := s.manager.LockServer(name, req.Reason, callerIdentity(r), until)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, lock)
+	case http.MethodDelete:
+		if err := s.manager.UnlockServer(name, callerIdentity(r)); err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]string{"status": "unlocked"})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// configChangeRequest changes the configuration of a server in its
+// source; Mode overrides github.write_back
+type configChangeRequest struct {
+	config.ServerEdit
+	Mode string `json:"mode,omitempty"`
+}
+
+// handleServerConfig writes a change of a server's allowlist or player
+// limit back to the configuration repository
+func (s *Server) handleServerConfig(w http.ResponseWriter, r *http.Request, name string) {
+	var req configChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	change, err := s.manager.ChangeServerConfig(name, req.ServerEdit, req.Mode, callerIdentity(r))
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, change)
+}
+
+func (s *Server) requireMethod(w http.ResponseWriter, r *http.Request, method string, next func()) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	next()
+}
+
+func (s *Server) writeManagerError(w http.ResponseWriter, err error) {
+	if errors.Is(err, server.ErrServerNotFound) || errors.Is(err, server.ErrApplyNotFound) || errors.Is(err, server.ErrReportNotFound) || errors.Is(err, server.ErrBackupNotFound) || errors.Is(err, server.ErrMacroNotFound) || errors.Is(err, server.ErrPlayerNotOnline) || errors.Is(err, server.ErrBanNotFound) || errors.Is(err, server.ErrNotLocked) || errors.Is(err, usage.ErrNoUsage) {
+		s.writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if errors.Is(err, server.ErrFrozen) || errors.Is(err, server.ErrNotFrozen) {
+		s.writeError(w, http.StatusConflict, err)
+		return
+	}
+	s.writeError(w, http.StatusBadRequest, err)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Errorf("Failed to encode API response: %v", err)
+	}
+}
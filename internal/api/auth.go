@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// publicPaths are served without a token or session
+var publicPaths = map[string]bool{
+	"/health":        true,
+	"/healthz":       true,
+	"/readyz":        true,
+	"/openapi.json":  true,
+	"/auth/login":    true,
+	"/auth/callback": true,
+	"/auth/logout":   true,
+	"/auth/session":  true,
+}
+
+// serverVerbs maps the actions under /servers/{name}/ to the verb they need
+var serverVerbs = map[string]string{
+	"uptime":       config.VerbRead,
+	"warnings":     config.VerbRead,
+	"traffic":      config.VerbRead,
+	"command":      config.VerbCommand,
+	"console":      config.VerbCommand,
+	"logs":         config.VerbCommand,
+	"macros":       config.VerbCommand,
+	"players":      config.VerbCommand,
+	"bans":         config.VerbCommand,
+	"weather":      config.VerbCommand,
+	"time":         config.VerbCommand,
+	"restart":      config.VerbLifecycle,
+	"suspend":      config.VerbLifecycle,
+	"resume":       config.VerbLifecycle,
+	"release":      config.VerbLifecycle,
+	"lock":         config.VerbLifecycle,
+	"config":       config.VerbLifecycle,
+	"world/import": config.VerbBackup,
+	"world/reset":  config.VerbBackup,
+	"world/trim":   config.VerbBackup,
+
+	// Exports read a world, migrations need the verb on the source too
+	"world/export":  config.VerbBackup,
+	"world/migrate": config.VerbBackup,
+
+	// Confirming a version starts or restarts the server
+	"confirm-version": config.VerbLifecycle,
+
+	// Backups are listed and taken under backups and restored under
+	// backups/{id}/restore
+	"backups":         config.VerbBackup,
+	"backups/restore": config.VerbBackup,
+}
+
+// filteredPaths list servers or their events and are filtered to the scope
+// of a grant instead of refused
+var filteredPaths = map[string]bool{
+	"/status":  true,
+	"/servers": true,
+	"/events":  true,
+	"/usage":   true,
+}
+
+// adminPaths are manager-wide endpoints that need the admin verb
+var adminPaths = map[string]bool{
+	"/gc":      true,
+	"/drift":   true,
+	"/freeze":  true,
+	"/promote": true,
+	"/bulk":    true,
+	"/audit":   true,
+	"/logging": true,
+}
+
+// grant is what one token allows
+type grant struct {
+	name    string
+	secret  []byte
+	verbs   map[string]bool
+	servers map[string]bool
+	groups  map[string]bool
+	tenant  string
+
+	// commands limits the console commands, nil when any is allowed
+	commands *config.CommandPolicy
+}
+
+func newGrants(tokens []config.APIToken) []*grant {
+	var grants []*grant
+	for _, token := range tokens {
+		grants = append(grants, newGrant(token.Name, []byte(token.Token), token.Grant))
+	}
+	return grants
+}
+
+func newGrant(name string, secret []byte, cfg config.Grant) *grant {
+	g := &grant{
+		name:    name,
+		secret:  secret,
+		verbs:   make(map[string]bool),
+		servers: make(map[string]bool),
+		groups:  make(map[string]bool),
+		tenant:  cfg.Tenant,
+
+		commands: cfg.Commands,
+	}
+	for _, verb := range cfg.Verbs {
+		g.verbs[verb] = true
+	}
+	for _, server := range cfg.Servers {
+		g.servers[server] = true
+	}
+	for _, group := range cfg.Groups {
+		g.groups[group] = true
+	}
+	return g
+}
+
+// scoped reports whether the grant is limited to some servers
+func (g *grant) scoped() bool {
+	return len(g.servers) > 0 || len(g.groups) > 0 || g.tenant != ""
+}
+
+// covers reports whether the grant applies to a server in a group of a
+// tenant. A tenant grant without servers and groups covers every server of
+// the tenant.
+func (g *grant) covers(name, group, tenant string) bool {
+	if g.tenant != "" && tenant != g.tenant {
+		return false
+	}
+	if len(g.servers) == 0 && len(g.groups) == 0 {
+		return true
+	}
+	return g.servers[name] || (group != "" && g.groups[group])
+}
+
+// permitsCommand returns an error when the command policy of a grant does
+// not allow a console command. Without auth every command is allowed.
+func (g *grant) permitsCommand(command string) error {
+	if g == nil || g.commands == nil {
+		return nil
+	}
+	return g.commands.Permits(command)
+}
+
+// grantFrom returns the grant of an authenticated request, nil when the API
+// is open
+func grantFrom(r *http.Request) *grant {
+	g, _ := r.Context().Value(grantKey).(*grant)
+	return g
+}
+
+// lookupGrant returns the grant of a bearer token
+func (s *Server) lookupGrant(r *http.Request) *grant {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil
+	}
+	secret := []byte(strings.TrimSpace(token))
+	for _, g := range s.grants {
+		if subtle.ConstantTimeCompare(secret, g.secret) == 1 {
+			return g
+		}
+	}
+	return nil
+}
+
+// authenticate attaches the grant of a bearer token or login session to the
+// request and names the caller after it. Rejection is left to authorize so
+// that the audit log in between also records refused calls.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g := s.lookupGrant(r); g != nil {
+			r = withIdentity(r, "token:"+g.name)
+			r = r.WithContext(context.WithValue(r.Context(), grantKey, g))
+		} else if sess := s.lookupSession(r); sess != nil {
+			r = withIdentity(r, "oidc:"+sess.user)
+			r = r.WithContext(context.WithValue(r.Context(), grantKey, sess.grant))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// lookupSession returns the login session of the request's cookie
+func (s *Server) lookupSession(r *http.Request) *session {
+	if s.sessions == nil {
+		return nil
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	return s.sessions.lookup(cookie.Value, time.Now())
+}
+
+// authorize requires a bearer token or session when either is configured and
+// checks
+// that its verbs and scope allow the request
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (len(s.grants) == 0 && s.sessions == nil) || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		g := grantFrom(r)
+		if g == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="party"`)
+			s.writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token or login session is required"))
+			return
+		}
+		if err := s.permitted(g, r); err != nil {
+			s.writeError(w, http.StatusForbidden, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// permitted checks a request against a grant. Server routes need the verb
+// of their action on that server, /status, /servers, /events and /usage are
+// filtered to the servers in scope, and the remaining manager-wide routes
+// need an unscoped grant.
+func (s *Server) permitted(g *grant, r *http.Request) error {
+	if rest, ok := strings.CutPrefix(r.URL.Path, "/servers/"); ok {
+		name, action, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+		if _, ok := backupRestoreID(action); ok {
+			action = "backups/restore"
+		}
+		if _, ok := macroAction(action); ok {
+			action = "macros"
+		}
+		if _, _, ok := playerAction(action); ok {
+			action = "players"
+		}
+		if _, ok := bannedPlayer(action); ok {
+			action = "bans"
+		}
+		verb, known := serverVerbs[action]
+		if !known {
+			// Unknown routes fall through to the 404 of the mux
+			return nil
+		}
+		if !g.verbs[verb] {
+			return fmt.Errorf("the %s verb is not granted", verb)
+		}
+		group, tenant, _ := s.manager.ServerScope(name)
+		if !g.covers(name, group, tenant) {
+			return errors.New("server is not in scope")
+		}
+		return nil
+	}
+
+	verb := config.VerbRead
+	if adminPaths[r.URL.Path] || strings.HasPrefix(r.URL.Path, "/debug/pprof/") {
+		verb = config.VerbAdmin
+	}
+	if !g.verbs[verb] {
+		return fmt.Errorf("the %s verb is not granted", verb)
+	}
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/usage/") {
+		path = "/usage"
+	}
+	if !filteredPaths[path] && g.scoped() {
+		return errors.New("access scoped to servers cannot use manager-wide endpoints")
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
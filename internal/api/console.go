@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/websocket"
+)
+
+// consoleNotice prefixes messages from the manager itself on an attached
+// console
+const consoleNotice = "[party] "
+
+// handleConsole attaches a WebSocket to the console of a server: console
+// lines are sent as text messages, text messages received are run as
+// commands. ?backlog=N sets how many recent lines are sent first (default
+// 50).
+func (s *Server) handleConsole(w http.ResponseWriter, r *http.Request, name string) {
+	if !websocket.IsUpgrade(r) {
+		s.writeError(w, http.StatusBadRequest, errors.New("a WebSocket upgrade is required"))
+		return
+	}
+
+	backlog := 50
+	if value := r.URL.Query().Get("backlog"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid backlog %q", value))
+			return
+		}
+		backlog = parsed
+	}
+
+	session, err := s.manager.AttachConsole(name, backlog)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	defer session.Detach()
+
+	conn, err := websocket.Upgrade(w, r, s.origins)
+	if err != nil {
+		s.logger.Warnf("Failed to attach console of %s: %v", name, err)
+		return
+	}
+	defer conn.Close()
+
+	who := callerIdentity(r)
+	s.logger.Infof("Console of %s attached by %s from %s", name, who, r.RemoteAddr)
+	defer s.logger.Infof("Console of %s detached by %s", name, who)
+
+	go func() {
+		for _, line := range session.Backlog {
+			if conn.WriteMessage(line) != nil {
+				return
+			}
+		}
+		for line := range session.Lines {
+			if conn.WriteMessage(line) != nil {
+				return
+			}
+		}
+		conn.WriteMessage(consoleNotice + "console closed, the server has stopped")
+		conn.Close()
+	}()
+
+	for {
+		command, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		start := time.Now()
+		status := http.StatusOK
+		if err := grantFrom(r).permitsCommand(command); err != nil {
+			status = http.StatusForbidden
+			conn.WriteMessage(consoleNotice + "refused: " + err.Error())
+		} else if err := s.manager.SendCommand(name, command); err != nil {
+			status = http.StatusBadRequest
+			conn.WriteMessage(consoleNotice + "error: " + err.Error())
+		}
+		s.recordConsoleCommand(r, who, command, status, start)
+	}
+}
+
+// recordConsoleCommand audits a command typed on an attached console
+func (s *Server) recordConsoleCommand(r *http.Request, who, command string, status int, start time.Time) {
+	entry := audit.Entry{
+		Time:         start,
+		Who:          who,
+		RemoteAddr:   r.RemoteAddr,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		Method:       "CONSOLE",
+		Path:         r.URL.Path,
+		Query:        url.Values{"command": {command}}.Encode(),
+		Status:       status,
+		Duration:     time.Since(start).Round(time.Millisecond).String(),
+	}
+	if err := s.audit.Record(entry); err != nil {
+		s.logger.Errorf("Failed to write audit log: %v", err)
+	}
+}
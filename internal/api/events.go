@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/websocket"
+)
+
+// eventKeepAlive is how often an idle event stream sends a comment so that
+// proxies keep the connection open
+const eventKeepAlive = 30 * time.Second
+
+// eventFilter selects the events a subscriber receives
+type eventFilter struct {
+	types   []string
+	servers []string
+	grant   *grant
+	// scopes caches the group and tenant of each server for scoped grants
+	scopes map[string]serverScope
+}
+
+type serverScope struct {
+	group, tenant string
+}
+
+// eventMatches reports whether an event passes the filter. An entry of types
+// matches the event type or its category, e.g. "alert" matches
+// "alert.firing". Scoped grants only receive events of servers in scope.
+func (s *Server) eventMatches(f *eventFilter, event events.Event) bool {
+	if len(f.types) > 0 && !slices.ContainsFunc(f.types, func(t string) bool {
+		return event.Type == t || strings.HasPrefix(event.Type, t+".")
+	}) {
+		return false
+	}
+	if len(f.servers) > 0 && !slices.Contains(f.servers, event.Server) {
+		return false
+	}
+	if f.grant == nil || !f.grant.scoped() {
+		return true
+	}
+	if event.Server == "" {
+		return false
+	}
+	scope, cached := f.scopes[event.Server]
+	if !cached {
+		scope.group, scope.tenant, _ = s.manager.ServerScope(event.Server)
+		f.scopes[event.Server] = scope
+	}
+	return f.grant.covers(event.Server, scope.group, scope.tenant)
+}
+
+// handleEvents streams the manager's activity as server-sent events, or
+// over a WebSocket with one JSON event per text message. ?type= and
+// ?server= filter the events (both comma-separated). A client resuming
+// with Last-Event-ID or ?since= first receives the remembered events it
+// missed.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		query := r.URL.Query()
+		filter := &eventFilter{
+			types:   splitList(query.Get("type")),
+			servers: splitList(query.Get("server")),
+			grant:   grantFrom(r),
+			scopes:  make(map[string]serverScope),
+		}
+
+		since := r.Header.Get("Last-Event-ID")
+		if value := query.Get("since"); value != "" {
+			since = value
+		}
+		var after uint64
+		if since != "" {
+			parsed, err := strconv.ParseUint(since, 10, 64)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid event ID %q", since))
+				return
+			}
+			after = parsed
+		}
+
+		backlog, stream, cancel := s.manager.Events().Subscribe(after)
+		defer cancel()
+
+		if websocket.IsUpgrade(r) {
+			s.streamEventsWebSocket(w, r, filter, backlog, stream)
+			return
+		}
+		s.streamEventsSSE(w, r, filter, backlog, stream)
+	})
+}
+
+func (s *Server) streamEventsSSE(w http.ResponseWriter, r *http.Request, filter *eventFilter, backlog []events.Event, stream <-chan events.Event) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeError(w, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	write := func(event events.Event) error {
+		if !s.eventMatches(filter, event) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		return err
+	}
+
+	for _, event := range backlog {
+		if write(event) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, open := <-stream:
+			if !open {
+				// Dropped for falling behind, the client reconnects and
+				// resumes with Last-Event-ID
+				return
+			}
+			if write(event) != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) streamEventsWebSocket(w http.ResponseWriter, r *http.Request, filter *eventFilter, backlog []events.Event, stream <-chan events.Event) {
+	conn, err := websocket.Upgrade(w, r, s.origins)
+	if err != nil {
+		s.logger.Warnf("Failed to open event stream: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Reading notices when the client goes away; messages it sends are
+	// ignored
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(event events.Event) error {
+		if !s.eventMatches(filter, event) {
+			return nil
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(string(data))
+	}
+
+	for _, event := range backlog {
+		if write(event) != nil {
+			return
+		}
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case event, open := <-stream:
+			if !open || write(event) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+)
+
+// unlimitedPaths are probed by orchestrators and scrapers and are not rate
+// limited
+var unlimitedPaths = map[string]bool{
+	"/health":  true,
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+type contextKey int
+
+const (
+	// identityKey holds the authenticated caller of a request
+	identityKey contextKey = iota
+	// grantKey holds the API token grant of a request
+	grantKey
+	// requestIDKey holds the ID of an audited request
+	requestIDKey
+)
+
+// requestIDPattern matches request IDs a client may choose itself
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID returns the ID of an audited request, "" for other requests
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// callerIdentity names the caller of a request for the audit log
+func callerIdentity(r *http.Request) string {
+	if identity, ok := r.Context().Value(identityKey).(string); ok && identity != "" {
+		return identity
+	}
+	return "anonymous"
+}
+
+// withIdentity returns a request carrying the caller's identity
+func withIdentity(r *http.Request, identity string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey, identity))
+}
+
+// rateLimiter is a token bucket per client address
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(max(burst, 1)),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token for a client and otherwise returns how long until
+// the next one is available
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, exists := l.buckets[client]
+	if !exists {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(b.tokens+now.Sub(b.updated).Seconds()*l.rate, l.burst)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+
+	// Drop buckets that have refilled, keeping the map small
+	if len(l.buckets) > 1024 {
+		for key, other := range l.buckets {
+			if now.Sub(other.updated).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, key)
+			}
+		}
+	}
+	return true, 0
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// rateLimit rejects clients exceeding the configured request rate
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.limiter == nil || unlimitedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ok, wait := s.limiter.allow(clientAddress(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			s.writeError(w, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// auditMutations records every call that may change state
+func (s *Server) auditMutations(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Callers can pass their own X-Request-ID to find the call in the
+		// audit log
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = randomID()[:16]
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		entry := audit.Entry{
+			Time:         start,
+			RequestID:    id,
+			Who:          callerIdentity(r),
+			RemoteAddr:   r.RemoteAddr,
+			ForwardedFor: r.Header.Get("X-Forwarded-For"),
+			Method:       r.Method,
+			Path:         r.URL.Path,
+			Query:        r.URL.RawQuery,
+			Status:       recorder.status,
+			Duration:     time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err := s.audit.Record(entry); err != nil {
+			s.logger.Errorf("Failed to write audit log: %v", err)
+		}
+		s.logger.Infof("API %s %s by %s from %s: %d (request %s)", entry.Method, entry.Path, entry.Who, entry.RemoteAddr, entry.Status, id)
+	})
+}
+
+// clientAddress is the host part of the remote address
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// handleAudit returns the most recent audited calls, ?limit=N (default 100)
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit %q", value))
+				return
+			}
+			limit = parsed
+		}
+
+		entries, err := s.audit.Recent(limit)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, entries)
+	})
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"minecraft-server-manager/internal/server"
+)
+
+// teleportRequest moves a player to a position or to another player
+type teleportRequest struct {
+	To       string           `json:"to,omitempty"`
+	Position *server.Position `json:"position,omitempty"`
+}
+
+type gamemodeRequest struct {
+	Gamemode string `json:"gamemode"`
+}
+
+// itemRequest names an item to give or clear, e.g. diamond_sword. Amount
+// defaults to 1 for give.
+type itemRequest struct {
+	Item   string `json:"item,omitempty"`
+	Amount int    `json:"amount,omitempty"`
+}
+
+type weatherRequest struct {
+	Weather string `json:"weather"`
+}
+
+// timeRequest sets the time of day by name or in ticks
+type timeRequest struct {
+	Time string `json:"time"`
+}
+
+// playerAction returns the player and action of a players/{player}/{action}
+// route
+func playerAction(action string) (player, verb string, ok bool) {
+	rest, ok := strings.CutPrefix(action, "players/")
+	if !ok {
+		return "", "", false
+	}
+	player, verb, ok = strings.Cut(rest, "/")
+	return player, verb, ok && player != "" && !strings.Contains(verb, "/")
+}
+
+// handlePlayerAction runs a moderation action on a player of a server
+func (s *Server) handlePlayerAction(w http.ResponseWriter, r *http.Request, name, player, action string) {
+	var command string
+	var err error
+	switch action {
+	case "teleport":
+		var req teleportRequest
+		if err = decodeBody(r, &req); err == nil {
+			command, err = server.TeleportCommand(player, req.To, req.Position)
+		}
+	case "gamemode":
+		var req gamemodeRequest
+		if err = decodeBody(r, &req); err == nil {
+			command, err = server.GamemodeCommand(player, req.Gamemode)
+		}
+	case "clear":
+		var req itemRequest
+		if err = decodeBody(r, &req); err == nil {
+			command, err = server.ClearCommand(player, req.Item)
+		}
+	case "give":
+		req := itemRequest{Amount: 1}
+		if err = decodeBody(r, &req); err == nil {
+			command, err = server.GiveCommand(player, req.Item, req.Amount)
+		}
+	default:
+		s.writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.moderate(w, r, name, player, command)
+}
+
+// handleWeather sets the weather of a server
+func (s *Server) handleWeather(w http.ResponseWriter, r *http.Request, name string) {
+	var req weatherRequest
+	if err := decodeBody(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	command, err := server.WeatherCommand(req.Weather)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.moderate(w, r, name, "", command)
+}
+
+// handleTime sets the time of day of a server
+func (s *Server) handleTime(w http.ResponseWriter, r *http.Request, name string) {
+	var req timeRequest
+	if err := decodeBody(r, &req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	command, err := server.TimeCommand(req.Time)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.moderate(w, r, name, "", command)
+}
+
+// moderate runs the command of a moderation action, subject to the
+// caller's command policy, and returns the console output
+func (s *Server) moderate(w http.ResponseWriter, r *http.Request, name, player, command string) {
+	if err := grantFrom(r).permitsCommand(command); err != nil {
+		s.writeError(w, http.StatusForbidden, err)
+		return
+	}
+	// The audit log has the path only, the request ID ties it to the command
+	s.logger.Infof("Moderation on server %s by %s: %s (request %s)", name, callerIdentity(r), command, requestID(r))
+	result, err := s.manager.Moderate(r.Context(), name, player, command)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	result.RequestID = requestID(r)
+	s.writeJSON(w, http.StatusOK, result)
+}
+
+// decodeBody decodes a JSON request body, an empty body leaves v as it is
+func decodeBody(r *http.Request, v interface{}) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+// banRequest bans a player; XUID is looked up when the player is online
+type banRequest struct {
+	Player string `json:"player"`
+	XUID   string `json:"xuid,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// banResponse lists the servers a ban was made or lifted on
+type banResponse struct {
+	Servers []string `json:"servers"`
+}
+
+// bannedPlayer returns the player of a bans/{player} action
+func bannedPlayer(action string) (string, bool) {
+	player, ok := strings.CutPrefix(action, "bans/")
+	return player, ok && player != "" && !strings.Contains(player, "/")
+}
+
+// handleBans lists the bans of a server on GET and bans a player on POST
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		bans, err := s.manager.Bans(name)
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, bans)
+	case http.MethodPost:
+		var req banRequest
+		if err := decodeBody(r, &req); err != nil {
+			s.writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Player == "" {
+			s.writeError(w, http.StatusBadRequest, errors.New("player is required"))
+			return
+		}
+		servers, err := s.manager.BanPlayer(name, server.Ban{Player: req.Player, XUID: req.XUID, Reason: req.Reason, By: callerIdentity(r)})
+		if err != nil {
+			s.writeManagerError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, banResponse{Servers: servers})
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleUnban lifts the ban of a player
+func (s *Server) handleUnban(w http.ResponseWriter, r *http.Request, name, player string) {
+	servers, err := s.manager.UnbanPlayer(name, player)
+	if err != nil {
+		s.writeManagerError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, banResponse{Servers: servers})
+}
+
+// handlePlayers lists the players seen by the manager, ?name=N only those
+// who use or used gamertag N
+func (s *Server) handlePlayers(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		s.writeJSON(w, http.StatusOK, s.manager.KnownPlayers(r.URL.Query().Get("name")))
+	})
+}
@@ -0,0 +1,359 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/github"
+	"minecraft-server-manager/internal/logging"
+	"minecraft-server-manager/internal/proxy"
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/internal/uptime"
+	"minecraft-server-manager/internal/usage"
+)
+
+// apiRoute describes one operation of the management API for the OpenAPI
+// document. Request and Response are zero values of the Go types sent and
+// returned, their schemas are derived by reflection.
+type apiRoute struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Params      []apiParam
+	Request     interface{}
+	Response    interface{}
+	// Upload takes a raw or multipart file upload as the request body
+	Upload bool
+	// ContentType overrides application/json for non-JSON responses
+	ContentType string
+	// Redirect responds with 302 instead of 200
+	Redirect bool
+	// Errors lists the error statuses besides 400
+	Errors []int
+}
+
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Description string
+}
+
+var serverNameParam = apiParam{Name: "name", In: "path", Type: "string", Description: "server name"}
+
+// apiRoutes is the operation table of the management API. Keep it in sync
+// with Handler and the client package.
+var apiRoutes = []apiRoute{
+	{Method: http.MethodGet, Path: "/health", OperationID: "health", Summary: "Liveness including shutdown state", ContentType: "text/plain", Errors: []int{503}},
+	{Method: http.MethodGet, Path: "/healthz", OperationID: "healthz", Summary: "Liveness of the manager process", ContentType: "text/plain"},
+	{Method: http.MethodGet, Path: "/readyz", OperationID: "getReadiness", Summary: "Readiness checks", Response: server.Readiness{}, Errors: []int{503}},
+	{Method: http.MethodGet, Path: "/status", OperationID: "getStatus", Summary: "Status of the manager and every server", Response: server.ManagerStatus{}},
+	{Method: http.MethodGet, Path: "/servers", OperationID: "listServers", Summary: "Servers filtered, sorted and paged", Params: []apiParam{
+		{Name: "status", In: "query", Type: "string", Description: "comma-separated statuses, e.g. crashed"},
+		{Name: "group", In: "query", Type: "string", Description: "comma-separated groups"},
+		{Name: "tenant", In: "query", Type: "string", Description: "comma-separated tenants"},
+		{Name: "sort", In: "query", Type: "string", Description: "name (default), status, group, port, priority, players or uptime, prefixed with - for descending order"},
+		{Name: "limit", In: "query", Type: "integer", Description: "page size, 0 (default) for all, at most 1000"},
+		{Name: "offset", In: "query", Type: "integer", Description: "servers to skip"},
+	}, Response: server.ServerList{}},
+	{Method: http.MethodPost, Path: "/servers/{name}/world/import", OperationID: "importWorld", Summary: "Replace the world of a server with an uploaded .mcworld", Params: []apiParam{serverNameParam}, Upload: true, Response: map[string]string{}, Errors: []int{404, 409}},
+	{Method: http.MethodPost, Path: "/servers/{name}/world/reset", OperationID: "resetWorld", Summary: "Reset the world of a server", Params: []apiParam{serverNameParam}, Response: map[string]string{}, Errors: []int{404, 409}},
+	{Method: http.MethodPost, Path: "/servers/{name}/world/trim", OperationID: "trimWorld", Summary: "Remove the chunks beyond the trim radius from the world of a server", Params: []apiParam{serverNameParam}, Response: server.TrimResult{}, Errors: []int{404, 409}},
+	{Method: http.MethodGet, Path: "/servers/{name}/world/export", OperationID: "exportWorld", Summary: "Download a consistent copy of the world of a server as a .mcworld archive", Params: []apiParam{serverNameParam}, ContentType: "application/zip", Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/world/migrate", OperationID: "migrateWorld", Summary: "Replace the world of a server with a backup of the world of another server", Params: []apiParam{serverNameParam}, Request: migrateRequest{}, Response: server.MigrationResult{}, Errors: []int{403, 404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/backups", OperationID: "listBackups", Summary: "Backups of the world of a server, oldest first", Params: []apiParam{serverNameParam}, Response: []server.Backup{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/backups", OperationID: "createBackup", Summary: "Back up the world of a server, with a snapshot where the filesystem supports it", Params: []apiParam{serverNameParam}, Response: server.Backup{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/backups/{id}/restore", OperationID: "restoreBackup", Summary: "Replace the world of a server with a backup", Params: []apiParam{serverNameParam, {Name: "id", In: "path", Type: "string", Description: "backup id"}}, Response: server.Backup{}, Errors: []int{404, 409}},
+	{Method: http.MethodPost, Path: "/servers/{name}/restart", OperationID: "restartServer", Summary: "Restart a server", Params: []apiParam{serverNameParam}, Response: map[string]string{}, Errors: []int{404, 409}},
+	{Method: http.MethodPost, Path: "/servers/{name}/suspend", OperationID: "suspendServer", Summary: "Freeze a running server with SIGSTOP", Params: []apiParam{serverNameParam}, Response: map[string]string{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/resume", OperationID: "resumeServer", Summary: "Continue a paused server", Params: []apiParam{serverNameParam}, Response: map[string]string{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/lock", OperationID: "getLock", Summary: "Lock of a server", Params: []apiParam{serverNameParam}, Response: server.LockedServer{}, Errors: []int{404}},
+	{Method: http.MethodPut, Path: "/servers/{name}/lock", OperationID: "lockServer", Summary: "Lock the settings of a server until a time, e.g. for a tournament", Params: []apiParam{serverNameParam}, Request: lockRequest{}, Response: server.LockedServer{}, Errors: []int{404}},
+	{Method: http.MethodDelete, Path: "/servers/{name}/lock", OperationID: "unlockServer", Summary: "Lift the lock of a server and apply the configuration that waited for it", Params: []apiParam{serverNameParam}, Response: map[string]string{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/release", OperationID: "releaseServer", Summary: "Lift the quarantine of a server and start it again", Params: []apiParam{serverNameParam}, Response: map[string]string{}, Errors: []int{400, 409}},
+	{Method: http.MethodPost, Path: "/servers/{name}/confirm-version", OperationID: "confirmVersion", Summary: "Let a server open its world with a Bedrock version the world version guard refuses", Params: []apiParam{serverNameParam}, Request: confirmVersionRequest{}, Response: map[string]string{}, Errors: []int{400, 404, 409}},
+	{Method: http.MethodPatch, Path: "/servers/{name}/config", OperationID: "changeServerConfig", Summary: "Commit a change of the allowlist or player limit of a server to the configuration", Params: []apiParam{serverNameParam}, Request: configChangeRequest{}, Response: github.Change{}, Errors: []int{400, 404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/command", OperationID: "sendCommand", Summary: "Run a command on the console of a running server and return its output", Params: []apiParam{serverNameParam}, Request: commandRequest{}, Response: server.CommandResult{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/macros/{macro}", OperationID: "runMacro", Summary: "Start a macro of the configuration on a running server; its steps run in the background", Params: []apiParam{serverNameParam, {Name: "macro", In: "path", Type: "string", Description: "macro name"}}, Request: macroRequest{}, Response: server.MacroRun{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/players/{player}/teleport", OperationID: "teleportPlayer", Summary: "Teleport an online player to a position or to another player", Params: []apiParam{serverNameParam, {Name: "player", In: "path", Type: "string", Description: "player name"}}, Request: teleportRequest{}, Response: server.CommandResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/players/{player}/gamemode", OperationID: "setGamemode", Summary: "Change the game mode of an online player", Params: []apiParam{serverNameParam, {Name: "player", In: "path", Type: "string", Description: "player name"}}, Request: gamemodeRequest{}, Response: server.CommandResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/players/{player}/clear", OperationID: "clearInventory", Summary: "Clear the inventory of an online player, or only one item", Params: []apiParam{serverNameParam, {Name: "player", In: "path", Type: "string", Description: "player name"}}, Request: itemRequest{}, Response: server.CommandResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/players/{player}/give", OperationID: "giveItem", Summary: "Give an online player an item", Params: []apiParam{serverNameParam, {Name: "player", In: "path", Type: "string", Description: "player name"}}, Request: itemRequest{}, Response: server.CommandResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/weather", OperationID: "setWeather", Summary: "Set the weather of a running server", Params: []apiParam{serverNameParam}, Request: weatherRequest{}, Response: server.CommandResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/time", OperationID: "setTime", Summary: "Set the time of day of a running server", Params: []apiParam{serverNameParam}, Request: timeRequest{}, Response: server.CommandResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/bans", OperationID: "listBans", Summary: "List the players banned from a server", Params: []apiParam{serverNameParam}, Response: []server.Ban{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/servers/{name}/bans", OperationID: "banPlayer", Summary: "Ban a player from a server and, when it syncs bans, from its group", Params: []apiParam{serverNameParam}, Request: banRequest{}, Response: banResponse{}, Errors: []int{400, 404}},
+	{Method: http.MethodDelete, Path: "/servers/{name}/bans/{player}", OperationID: "unbanPlayer", Summary: "Lift the ban of a player on a server and the servers it was propagated to", Params: []apiParam{serverNameParam, {Name: "player", In: "path", Type: "string", Description: "player name"}}, Response: banResponse{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/console", OperationID: "attachConsole", Summary: "Attach to the console over a WebSocket: console lines are sent as text messages, received text messages run as commands", Params: []apiParam{serverNameParam, {Name: "backlog", In: "query", Type: "integer", Description: "recent lines sent first, default 50"}}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/logs", OperationID: "readLogs", Summary: "Console lines of a running server after a sequence number, oldest first", Params: []apiParam{
+		serverNameParam,
+		{Name: "since", In: "query", Type: "integer", Description: "sequence number of the last line read, the next of the previous page; 0 (default) for all lines kept"},
+		{Name: "limit", In: "query", Type: "integer", Description: "most lines returned, 0 (default) for all"},
+	}, Response: server.LogPage{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/uptime", OperationID: "getUptime", Summary: "Availability of a server", Params: []apiParam{serverNameParam}, Response: uptime.Report{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/warnings", OperationID: "getWarnings", Summary: "Content log warnings of a server", Params: []apiParam{serverNameParam}, Response: []server.ContentWarning{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/servers/{name}/traffic", OperationID: "getTraffic", Summary: "Proxy traffic of a server", Params: []apiParam{serverNameParam}, Response: proxy.Stats{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/gc", OperationID: "collectGarbage", Summary: "Remove unreferenced versions, templates and packs", Params: []apiParam{{Name: "dry_run", In: "query", Type: "boolean", Description: "only report what would be removed"}}, Response: server.GCReport{}, Errors: []int{409}},
+	{Method: http.MethodGet, Path: "/drift", OperationID: "getDrift", Summary: "Drift found by the last check between running servers and their configuration", Response: server.DriftReport{}, Errors: []int{404}},
+	{Method: http.MethodPost, Path: "/drift", OperationID: "checkDrift", Summary: "Check running servers for drift from their configuration now", Params: []apiParam{{Name: "correct", In: "query", Type: "boolean", Description: "write drifted files again"}}, Response: server.DriftReport{}},
+	{Method: http.MethodGet, Path: "/freeze", OperationID: "getFreeze", Summary: "Freeze in place", Response: server.Freeze{}, Errors: []int{404}},
+	{Method: http.MethodPut, Path: "/freeze", OperationID: "freeze", Summary: "Stop applying configuration and restarting servers", Request: freezeRequest{}, Response: server.Freeze{}},
+	{Method: http.MethodDelete, Path: "/freeze", OperationID: "unfreeze", Summary: "Lift the freeze and apply the commit that waited for it", Errors: []int{409}},
+	{Method: http.MethodPost, Path: "/promote", OperationID: "promote", Summary: "Promote the configuration of one environment to another", Request: promoteRequest{}, Response: github.Promotion{}, Errors: []int{409}},
+	{Method: http.MethodPost, Path: "/bulk", OperationID: "bulkCreate", Summary: "Generate copies of a server and optionally commit them to the configuration", Request: server.BulkSpec{}, Response: server.BulkResult{}, Errors: []int{400, 404}},
+	{Method: http.MethodGet, Path: "/applies", OperationID: "listApplies", Summary: "Apply history", Response: []server.ApplyRecord{}},
+	{Method: http.MethodGet, Path: "/applies/slo", OperationID: "getApplySLO", Summary: "Success rate, lead time and duration of applies over rolling windows", Response: server.ApplySLOReport{}},
+	{Method: http.MethodGet, Path: "/applies/{sha}/diff", OperationID: "getApplyDiff", Summary: "What one apply changed", Params: []apiParam{{Name: "sha", In: "path", Type: "string", Description: "applied commit"}}, Response: server.ApplyDiff{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/shutdown", OperationID: "getShutdown", Summary: "Progress of a shutdown in progress", Response: server.ShutdownStatus{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/reports", OperationID: "listCrashReports", Summary: "Crash reports", Response: []server.CrashReport{}},
+	{Method: http.MethodGet, Path: "/reports/{report}", OperationID: "getCrashReport", Summary: "Download a crash report bundle", Params: []apiParam{{Name: "report", In: "path", Type: "string", Description: "report file name"}}, ContentType: "application/zip", Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/players", OperationID: "listPlayers", Summary: "Players seen by the manager with the gamertags they used, keyed by XUID", Params: []apiParam{{Name: "name", In: "query", Type: "string", Description: "only players who use or used this gamertag"}}, Response: []server.KnownPlayer{}},
+	{Method: http.MethodGet, Path: "/audit", OperationID: "listAudit", Summary: "Most recent mutating API calls", Params: []apiParam{{Name: "limit", In: "query", Type: "integer", Description: "number of entries, default 100"}}, Response: []audit.Entry{}},
+	{Method: http.MethodGet, Path: "/logging", OperationID: "getLogging", Summary: "Level, format and outputs of the manager log", Response: logging.Settings{}},
+	{Method: http.MethodPut, Path: "/logging", OperationID: "updateLogging", Summary: "Change the level, format or outputs of the manager log; empty fields are kept", Request: logging.Settings{}, Response: logging.Settings{}, Errors: []int{400}},
+	{Method: http.MethodGet, Path: "/events", OperationID: "streamEvents", Summary: "Stream manager activity as server-sent events, or as JSON text messages over a WebSocket", Params: []apiParam{
+		{Name: "type", In: "query", Type: "string", Description: "comma-separated event types or categories, e.g. server,backup.completed"},
+		{Name: "server", In: "query", Type: "string", Description: "comma-separated server names"},
+		{Name: "since", In: "query", Type: "integer", Description: "resume after this event ID, like the Last-Event-ID header"},
+	}, ContentType: "text/event-stream"},
+	{Method: http.MethodGet, Path: "/usage", OperationID: "listUsageMonths", Summary: "Months with recorded usage", Response: []string{}},
+	{Method: http.MethodGet, Path: "/usage/{month}", OperationID: "getUsageReport", Summary: "Usage of every server in a month, such as 2024-05", Params: []apiParam{
+		{Name: "month", In: "path", Type: "string", Description: "month in UTC, YYYY-MM"},
+		{Name: "tenant", In: "query", Type: "string", Description: "comma-separated tenants"},
+		{Name: "format", In: "query", Type: "string", Description: "json (default) or csv"},
+	}, Response: usage.Report{}, Errors: []int{404}},
+	{Method: http.MethodGet, Path: "/metrics", OperationID: "getMetrics", Summary: "Metrics in the Prometheus text format, only with the prometheus exporter", ContentType: "text/plain"},
+	{Method: http.MethodGet, Path: "/auth/login", OperationID: "login", Summary: "Start an OIDC login, only with http.auth.oidc", Params: []apiParam{{Name: "redirect", In: "query", Type: "string", Description: "local path to return to"}}, Redirect: true},
+	{Method: http.MethodGet, Path: "/auth/callback", OperationID: "loginCallback", Summary: "Complete an OIDC login and set the session cookie", Params: []apiParam{{Name: "code", In: "query", Type: "string"}, {Name: "state", In: "query", Type: "string"}}, Redirect: true, Errors: []int{401, 403}},
+	{Method: http.MethodPost, Path: "/auth/logout", OperationID: "logout", Summary: "End the login session", Response: map[string]string{}},
+	{Method: http.MethodGet, Path: "/auth/session", OperationID: "getSession", Summary: "The signed-in user and their role", Response: sessionInfo{}, Errors: []int{401}},
+	{Method: http.MethodGet, Path: "/openapi.json", OperationID: "getOpenAPI", Summary: "This document", Response: map[string]interface{}{}},
+}
+
+// handleOpenAPI serves the OpenAPI 3 document of the API
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		s.writeJSON(w, http.StatusOK, openAPIDocument())
+	})
+}
+
+// openAPIDocument builds the OpenAPI document from apiRoutes
+func openAPIDocument() map[string]interface{} {
+	schemas := schemaSet{}
+	paths := make(map[string]map[string]interface{})
+
+	for _, route := range apiRoutes {
+		operation := map[string]interface{}{
+			"operationId": route.OperationID,
+			"summary":     route.Summary,
+			"responses":   route.responses(schemas),
+		}
+
+		var params []map[string]interface{}
+		for _, param := range route.Params {
+			params = append(params, map[string]interface{}{
+				"name":        param.Name,
+				"in":          param.In,
+				"required":    param.In == "path",
+				"description": param.Description,
+				"schema":      map[string]interface{}{"type": param.Type},
+			})
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		if publicPaths[route.Path] {
+			operation["security"] = []interface{}{}
+		}
+
+		switch {
+		case route.Request != nil:
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemas.schemaOf(reflect.TypeOf(route.Request))},
+				},
+			}
+		case route.Upload:
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/octet-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+					"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"world": map[string]interface{}{"type": "string", "format": "binary"}},
+					}},
+				},
+			}
+		}
+
+		if paths[route.Path] == nil {
+			paths[route.Path] = make(map[string]interface{})
+		}
+		paths[route.Path][strings.ToLower(route.Method)] = operation
+	}
+
+	schemas["Error"] = schemas.structSchema(reflect.TypeOf(errorResponse{}))
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "party management API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+	}
+}
+
+func (route apiRoute) responses(schemas schemaSet) map[string]interface{} {
+	ok := map[string]interface{}{"description": "OK"}
+	switch {
+	case route.ContentType != "":
+		format := map[string]interface{}{"type": "string"}
+		if route.ContentType == "application/zip" {
+			format["format"] = "binary"
+		}
+		ok["content"] = map[string]interface{}{route.ContentType: map[string]interface{}{"schema": format}}
+	case route.Response != nil:
+		ok["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schemas.schemaOf(reflect.TypeOf(route.Response))},
+		}
+	}
+
+	errorContent := map[string]interface{}{
+		"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+	}
+	responses := map[string]interface{}{"200": ok}
+	if route.Redirect {
+		responses = map[string]interface{}{"302": map[string]interface{}{"description": http.StatusText(302)}}
+	}
+	if route.Method != http.MethodGet || len(route.Params) > 0 {
+		responses["400"] = map[string]interface{}{"description": http.StatusText(400), "content": errorContent}
+	}
+	for _, status := range route.Errors {
+		responses[strconv.Itoa(status)] = map[string]interface{}{"description": http.StatusText(status), "content": errorContent}
+	}
+	if !publicPaths[route.Path] {
+		responses["401"] = map[string]interface{}{"description": http.StatusText(401), "content": errorContent}
+		responses["403"] = map[string]interface{}{"description": http.StatusText(403), "content": errorContent}
+	}
+	responses["429"] = map[string]interface{}{"description": http.StatusText(429), "content": errorContent}
+	return responses
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaSet holds the component schemas of named struct types, keyed by
+// package and type name
+type schemaSet map[string]interface{}
+
+// schemaOf returns the schema of t, registering named structs as components
+// and referencing them
+func (set schemaSet) schemaOf(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawJSONType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": set.schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": set.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return set.structSchema(t)
+		}
+		name := path.Base(t.PkgPath()) + "." + strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, exists := set[name]; !exists {
+			// Reserve the name first so recursive types terminate
+			set[name] = nil
+			set[name] = set.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema describes the JSON encoding of a struct, following the
+// encoding/json rules for tags, omitempty and embedded structs
+func (set schemaSet) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	set.addFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (set schemaSet) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				set.addFields(embedded, properties, required)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = set.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
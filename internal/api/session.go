@@ -0,0 +1,278 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/oidc"
+)
+
+const (
+	sessionCookie = "party_session"
+	stateCookie   = "party_login"
+
+	// loginTimeout is how long a started login may take
+	loginTimeout = 10 * time.Minute
+)
+
+// session is a signed-in user
+type session struct {
+	user    string
+	role    string
+	grant   *grant
+	expires time.Time
+}
+
+// pendingLogin is a login waiting for its callback
+type pendingLogin struct {
+	nonce    string
+	redirect string
+	started  time.Time
+}
+
+// sessionStore keeps OIDC sessions and pending logins in memory; they do
+// not survive a restart of the manager
+type sessionStore struct {
+	provider *oidc.Provider
+	cfg      config.OIDCConfig
+	roles    []*grant
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	pending  map[string]*pendingLogin
+}
+
+func newSessionStore(cfg *config.OIDCConfig) *sessionStore {
+	if cfg == nil {
+		return nil
+	}
+	store := &sessionStore{
+		provider: oidc.New(*cfg),
+		cfg:      *cfg,
+		sessions: make(map[string]*session),
+		pending:  make(map[string]*pendingLogin),
+	}
+	for _, role := range cfg.Roles {
+		store.roles = append(store.roles, newGrant("role:"+role.Group, nil, role.Grant))
+	}
+	return store
+}
+
+// lookup returns the session of a cookie value
+func (store *sessionStore) lookup(id string, now time.Time) *session {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	sess, exists := store.sessions[id]
+	if !exists {
+		return nil
+	}
+	if now.After(sess.expires) {
+		delete(store.sessions, id)
+		return nil
+	}
+	return sess
+}
+
+// role returns the first role matching one of the user's groups
+func (store *sessionStore) role(groups []string) (string, *grant) {
+	for i, role := range store.cfg.Roles {
+		for _, group := range groups {
+			if group == role.Group {
+				return role.Group, store.roles[i]
+			}
+		}
+	}
+	return "", nil
+}
+
+// expire drops sessions and logins that have run out.
+// The caller must hold store.mu.
+func (store *sessionStore) expire(now time.Time) {
+	for id, sess := range store.sessions {
+		if now.After(sess.expires) {
+			delete(store.sessions, id)
+		}
+	}
+	for state, login := range store.pending {
+		if now.Sub(login.started) > loginTimeout {
+			delete(store.pending, state)
+		}
+	}
+}
+
+func randomID() string {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// localRedirect reports whether a redirect target is a path on this host.
+// Browsers treat a backslash like a slash, so "/\evil.com" is refused along
+// with "//evil.com" and absolute URLs.
+func localRedirect(redirect string) bool {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return false
+	}
+	target, err := url.Parse(redirect)
+	return err == nil && target.Scheme == "" && target.Host == ""
+}
+
+// handleLogin starts a login and redirects to the identity provider.
+// ?redirect= names the local path to return to afterwards.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		redirect := r.URL.Query().Get("redirect")
+		if !localRedirect(redirect) {
+			redirect = "/auth/session"
+		}
+
+		state, nonce := randomID(), randomID()
+		authURL, err := s.sessions.provider.AuthURL(r.Context(), state, nonce)
+		if err != nil {
+			s.logger.Errorf("Failed to start login: %v", err)
+			s.writeError(w, http.StatusBadGateway, errors.New("identity provider unavailable"))
+			return
+		}
+
+		now := time.Now()
+		s.sessions.mu.Lock()
+		s.sessions.expire(now)
+		s.sessions.pending[state] = &pendingLogin{nonce: nonce, redirect: redirect, started: now}
+		s.sessions.mu.Unlock()
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     stateCookie,
+			Value:    state,
+			Path:     "/auth/",
+			MaxAge:   int(loginTimeout.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	})
+}
+
+// handleCallback completes a login, maps the user's groups to a role and
+// starts a session
+func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		query := r.URL.Query()
+		if message := query.Get("error"); message != "" {
+			s.writeError(w, http.StatusUnauthorized, errors.New("login failed: "+message))
+			return
+		}
+
+		state := query.Get("state")
+		cookie, err := r.Cookie(stateCookie)
+		if err != nil || state == "" || cookie.Value != state {
+			s.writeError(w, http.StatusBadRequest, errors.New("login state does not match, start the login again"))
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth/", MaxAge: -1})
+
+		s.sessions.mu.Lock()
+		login, exists := s.sessions.pending[state]
+		delete(s.sessions.pending, state)
+		s.sessions.mu.Unlock()
+		if !exists || time.Since(login.started) > loginTimeout {
+			s.writeError(w, http.StatusBadRequest, errors.New("login expired, start the login again"))
+			return
+		}
+
+		identity, err := s.sessions.provider.Exchange(r.Context(), query.Get("code"), login.nonce)
+		if err != nil {
+			s.logger.Warnf("Login failed: %v", err)
+			s.writeError(w, http.StatusUnauthorized, errors.New("login failed"))
+			return
+		}
+
+		role, g := s.sessions.role(identity.Groups)
+		if g == nil {
+			s.logger.Warnf("Login of %s refused: none of the groups %v has a role", identity.Name, identity.Groups)
+			s.writeError(w, http.StatusForbidden, errors.New("none of your groups has access"))
+			return
+		}
+
+		id := randomID()
+		sess := &session{
+			user:    identity.Name,
+			role:    role,
+			grant:   g,
+			expires: time.Now().Add(time.Duration(s.sessions.cfg.SessionHours) * time.Hour),
+		}
+		s.sessions.mu.Lock()
+		s.sessions.sessions[id] = sess
+		s.sessions.mu.Unlock()
+		s.logger.Infof("User %s signed in with role %s", identity.Name, role)
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    id,
+			Path:     "/",
+			Expires:  sess.expires,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, login.redirect, http.StatusFound)
+	})
+}
+
+// handleLogout ends the session of the caller
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodPost, func() {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			s.sessions.mu.Lock()
+			delete(s.sessions.sessions, cookie.Value)
+			s.sessions.mu.Unlock()
+		}
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+		s.writeJSON(w, http.StatusOK, map[string]string{"status": "signed out"})
+	})
+}
+
+// sessionInfo describes the session of the caller
+type sessionInfo struct {
+	User    string    `json:"user"`
+	Role    string    `json:"role"`
+	Verbs   []string  `json:"verbs"`
+	Servers []string  `json:"servers,omitempty"`
+	Groups  []string  `json:"groups,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// handleSession returns the signed-in user and their grant
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	s.requireMethod(w, r, http.MethodGet, func() {
+		cookie, err := r.Cookie(sessionCookie)
+		if err != nil {
+			s.writeError(w, http.StatusUnauthorized, errors.New("not signed in"))
+			return
+		}
+		sess := s.sessions.lookup(cookie.Value, time.Now())
+		if sess == nil {
+			s.writeError(w, http.StatusUnauthorized, errors.New("not signed in"))
+			return
+		}
+
+		s.writeJSON(w, http.StatusOK, sessionInfo{
+			User:    sess.user,
+			Role:    sess.role,
+			Verbs:   sortedKeys(sess.grant.verbs),
+			Servers: sortedKeys(sess.grant.servers),
+			Groups:  sortedKeys(sess.grant.groups),
+			Expires: sess.expires,
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Results of a configuration apply
+const (
+	ApplySucceeded = "success"
+	ApplyFailed    = "failure"
+	ApplyRejected  = "rejected"
+)
+
+// Apply is the outcome of one configuration commit, from its detection to
+// the last server running it
+type Apply struct {
+	Time            time.Time `json:"time"`
+	Commit          string    `json:"commit"`
+	Result          string    `json:"result"`
+	CommittedAt     time.Time `json:"committed_at,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	// LeadTimeSeconds is the time from the commit to the end of the apply,
+	// zero when the commit time is unknown
+	LeadTimeSeconds float64 `json:"lead_time_seconds,omitempty"`
+	Started         int     `json:"started"`
+	Restarted       int     `json:"restarted"`
+	Stopped         int     `json:"stopped"`
+	Failed          int     `json:"failed"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// Changed is the number of servers the apply started, restarted or stopped
+func (a Apply) Changed() int {
+	return a.Started + a.Restarted + a.Stopped
+}
+
+// ApplyLog appends apply outcomes to a file
+type ApplyLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewApplyLog creates a log writing to path
+func NewApplyLog(path string) *ApplyLog {
+	return &ApplyLog{path: path}
+}
+
+// Record appends an apply
+func (l *ApplyLog) Record(apply Apply) error {
+	data, err := json.Marshal(apply)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// Since returns the applies that finished at or after since, oldest first
+func (l *ApplyLog) Since(since time.Time) ([]Apply, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var applies []Apply
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var apply Apply
+		if err := json.Unmarshal(scanner.Bytes(), &apply); err != nil {
+			return nil, fmt.Errorf("corrupt apply log line: %w", err)
+		}
+		if !apply.Time.Before(since) {
+			applies = append(applies, apply)
+		}
+	}
+	return applies, scanner.Err()
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CommandPolicy limits the console commands a grant may run, e.g. letting
+// moderators kick and teleport but not op. Patterns are matched without
+// regard to case against the command without its leading slash: a pattern
+// without a space matches the command name ("kick"), one with a space the
+// whole command ("gamerule keepinventory *"), where * matches any text.
+// Deny wins over Allow; without Allow every command that is not denied is
+// allowed. The commands run by execute are checked as well.
+type CommandPolicy struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+func (p *CommandPolicy) validate() error {
+	if len(p.Allow) == 0 && len(p.Deny) == 0 {
+		return fmt.Errorf("allow or deny is required")
+	}
+	for _, pattern := range append(p.Allow, p.Deny...) {
+		if strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("empty pattern")
+		}
+	}
+	return nil
+}
+
+// Permits returns an error when the policy does not allow a command
+func (p *CommandPolicy) Permits(command string) error {
+	command = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(command), "/"))
+	name, _, _ := strings.Cut(command, " ")
+
+	for _, pattern := range p.Deny {
+		if commandMatches(pattern, name, command) {
+			return fmt.Errorf("command %q is denied", name)
+		}
+	}
+	if len(p.Allow) > 0 {
+		allowed := false
+		for _, pattern := range p.Allow {
+			allowed = allowed || commandMatches(pattern, name, command)
+		}
+		if !allowed {
+			return fmt.Errorf("command %q is not allowed", name)
+		}
+	}
+
+	// execute runs another command, after "run" or in the legacy syntax
+	// after target, position and an optional detect clause, which must be
+	// allowed too. Every run outside of quotes is checked, since one in a
+	// quoted selector hides the command that runs.
+	if name == "execute" {
+		if runs := unquotedRuns(command); len(runs) > 0 {
+			for _, i := range runs {
+				if err := p.Permits(command[i+len(" run "):]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		fields := strings.Fields(command)
+		if len(fields) > 5 && fields[5] == "detect" {
+			fields = append(fields[:5], fields[min(len(fields), 11):]...)
+		}
+		if len(fields) > 5 {
+			return p.Permits(strings.Join(fields[5:], " "))
+		}
+	}
+	return nil
+}
+
+// unquotedRuns returns the positions of " run " outside of double quotes
+// in a command
+func unquotedRuns(command string) []int {
+	var runs []int
+	quoted := false
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && quoted:
+			i++
+		case command[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(command[i:], " run "):
+			runs = append(runs, i)
+		}
+	}
+	return runs
+}
+
+// commandMatches reports whether a pattern matches a command name or, when
+// it contains a space, the whole command
+func commandMatches(pattern, name, command string) bool {
+	pattern = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(pattern), "/"))
+	if strings.Contains(pattern, " ") {
+		return wildcardMatch(pattern, command)
+	}
+	return wildcardMatch(pattern, name)
+}
+
+// wildcardMatch matches s against a pattern in which * stands for any text
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
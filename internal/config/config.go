@@ -1,37 +1,1369 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
+
+	"minecraft-server-manager/internal/schedule"
 
 	"gopkg.in/yaml.v3"
 )
 
-type Config struct {
-	GitHub GitHubConfig `yaml:"github"`
-	HTTP   HTTPConfig   `yaml:"http"`
-	Server ServerConfig `yaml:"server"`
+type Config struct {
+	GitHub  GitHubConfig  `yaml:"github"`
+	HTTP    HTTPConfig    `yaml:"http"`
+	Server  ServerConfig  `yaml:"server"`
+	GC      GCConfig      `yaml:"gc"`
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Alerts        AlertsConfig        `yaml:"alerts"`
+	Heartbeat     HeartbeatConfig     `yaml:"heartbeat"`
+	Proxy         ProxyConfig         `yaml:"proxy"`
+	GeoIP         GeoIPConfig         `yaml:"geoip"`
+	Preflight     PreflightConfig     `yaml:"preflight"`
+
+	// Egress routes outbound HTTP traffic through proxies
+	Egress EgressConfig `yaml:"egress"`
+
+	// Mirror serves Bedrock binaries and world templates from an internal
+	// repository
+	Mirror MirrorConfig `yaml:"mirror"`
+
+	// Verification pins the checksums of downloaded Bedrock binaries and
+	// behavior packs
+	Verification VerificationConfig `yaml:"verification"`
+
+	// Lockfile records the Bedrock builds, packs and checksums of every
+	// apply
+	Lockfile LockfileConfig `yaml:"lockfile"`
+
+	// Tenants partition servers and API access between customers, with
+	// quotas per tenant
+	Tenants map[string]TenantQuota `yaml:"tenants"`
+
+	// Usage records resource usage per server for monthly billing reports
+	Usage UsageConfig `yaml:"usage"`
+
+	// Hooks call external systems when servers are added to or removed
+	// from the configuration
+	Hooks []HookConfig `yaml:"hooks"`
+
+	// Telegram sends notifications through a Telegram bot and answers its
+	// commands
+	Telegram *TelegramConfig `yaml:"telegram"`
+
+	// Announcements tell players in game about what the manager does
+	Announcements AnnouncementsConfig `yaml:"announcements"`
+
+	// Backups back up the worlds of running servers
+	Backups BackupConfig `yaml:"backups"`
+
+	// Drift compares the files and processes of running servers with
+	// their configuration, to catch manual edits on the host
+	Drift DriftConfig `yaml:"drift"`
+
+	// Staleness decides what happens while the configuration sources
+	// cannot be reached
+	Staleness StalenessConfig `yaml:"staleness"`
+
+	// Hibernate stops the host while every server is scheduled off
+	Hibernate HibernateConfig `yaml:"hibernate"`
+
+	// Freeze starts the manager frozen: configuration is not applied and
+	// servers are not restarted until the freeze is lifted through the API
+	Freeze bool `yaml:"freeze"`
+
+	// Log configures the manager's own log
+	Log LogConfig `yaml:"log"`
+
+	// Profile is online (default) or offline. The offline profile runs
+	// without internet access, e.g. at LAN parties and in classrooms: the
+	// configuration comes from local directories, servers run with
+	// online-mode=false and nothing contacts GitHub or Xbox Live.
+	Profile string `yaml:"profile"`
+}
+
+// Deployment profiles
+const (
+	ProfileOnline  = "online"
+	ProfileOffline = "offline"
+)
+
+// Offline reports whether the manager runs the offline profile
+func (c *Config) Offline() bool {
+	return c.Profile == ProfileOffline
+}
+
+// LogConfig configures the manager's log. Level is trace, debug, info
+// (default), warn or error; Format text (default) or json. Outputs lists
+// where log lines go: stderr (default), file and journald. Level, format
+// and outputs can be changed at runtime through the API.
+type LogConfig struct {
+	Level   string        `yaml:"level"`
+	Format  string        `yaml:"format"`
+	Outputs []string      `yaml:"outputs"`
+	File    LogFileConfig `yaml:"file"`
+}
+
+// LogFileConfig is the log file of the file output. It is rotated once it
+// reaches MaxSizeMB (default 100), keeping MaxBackups (default 5) old files
+// as path.1, path.2 and so on.
+type LogFileConfig struct {
+	Path       string `yaml:"path"`
+	MaxSizeMB  int    `yaml:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups"`
+}
+
+// Log levels, formats and outputs
+var (
+	LogLevels  = []string{"trace", "debug", "info", "warn", "error"}
+	LogFormats = []string{LogFormatText, LogFormatJSON}
+	LogOutputs = []string{LogOutputStderr, LogOutputFile, LogOutputJournald}
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+
+	LogOutputStderr   = "stderr"
+	LogOutputFile     = "file"
+	LogOutputJournald = "journald"
+)
+
+// Validate checks the level, format and outputs of a log configuration
+func (c LogConfig) Validate() error {
+	if !slices.Contains(LogLevels, c.Level) {
+		return fmt.Errorf("level: invalid value %q (must be one of %s)", c.Level, strings.Join(LogLevels, ", "))
+	}
+	if !slices.Contains(LogFormats, c.Format) {
+		return fmt.Errorf("format: invalid value %q (must be one of %s)", c.Format, strings.Join(LogFormats, ", "))
+	}
+	if len(c.Outputs) == 0 {
+		return fmt.Errorf("outputs: at least one output is required")
+	}
+	for _, output := range c.Outputs {
+		if !slices.Contains(LogOutputs, output) {
+			return fmt.Errorf("outputs: invalid value %q (must be one of %s)", output, strings.Join(LogOutputs, ", "))
+		}
+		if output == LogOutputFile && c.File.Path == "" {
+			return fmt.Errorf("outputs: file requires file.path")
+		}
+	}
+	if c.File.MaxSizeMB < 0 || c.File.MaxBackups < 0 {
+		return fmt.Errorf("file: max_size_mb and max_backups must not be negative")
+	}
+	return nil
+}
+
+// BackupConfig configures world backups. Backend is copy, btrfs, zfs or
+// auto (default), which snapshots where the server directory is a btrfs
+// subvolume or a ZFS dataset and copies otherwise. Cron backs up every
+// running server when it matches; Keep is how many backups of each server
+// are kept (default 10).
+type BackupConfig struct {
+	Backend string `yaml:"backend"`
+	Cron    string `yaml:"cron"`
+	Keep    int    `yaml:"keep"`
+
+	// Throttling keeps backups of big worlds from causing lag: copies are
+	// limited to MaxMBPerSecond (0 for no limit) and done in the idle I/O
+	// class with IONice
+	MaxMBPerSecond int  `yaml:"max_mb_per_second"`
+	IONice         bool `yaml:"ionice"`
+
+	// Defer holds scheduled backups back until few players are online
+	Defer *BackupDeferConfig `yaml:"defer"`
+}
+
+// BackupDeferConfig delays the scheduled backup of a server until at most
+// Players players are online, but no longer than MaxMinutes (default 120)
+type BackupDeferConfig struct {
+	Players    int `yaml:"players"`
+	MaxMinutes int `yaml:"max_minutes"`
+}
+
+// Backup backends
+const (
+	BackupAuto  = "auto"
+	BackupCopy  = "copy"
+	BackupBtrfs = "btrfs"
+	BackupZFS   = "zfs"
+)
+
+// AnnouncementsConfig announces manager actions to the players of a server
+// through its console. Messages maps events to Go templates replacing the
+// default messages; an empty message silences an event. Command is "say"
+// (default) or "tellraw".
+type AnnouncementsConfig struct {
+	Enabled  bool              `yaml:"enabled"`
+	Command  string            `yaml:"command"`
+	Messages map[string]string `yaml:"messages"`
+}
+
+// Announcement events and commands
+const (
+	AnnounceRestart       = "restart"
+	AnnounceShutdown      = "shutdown"
+	AnnounceWorldReset    = "world_reset"
+	AnnouncePacksReloaded = "packs_reloaded"
+	AnnounceSchedules     = "schedules"
+
+	AnnounceSay     = "say"
+	AnnounceTellraw = "tellraw"
+)
+
+// AnnouncementEvents lists the events that can be announced
+var AnnouncementEvents = []string{AnnounceRestart, AnnounceShutdown, AnnounceWorldReset, AnnouncePacksReloaded, AnnounceSchedules}
+
+// DefaultAnnouncements are the messages of events without a configured one
+var DefaultAnnouncements = map[string]string{
+	AnnounceRestart:       "Server restarting now ({{.Reason}}), please rejoin in a minute",
+	AnnounceShutdown:      "Server shutting down for maintenance",
+	AnnounceWorldReset:    "World reset starting ({{.Reason}}) - backing up, brief lag expected",
+	AnnouncePacksReloaded: "Packs updated - reloading, brief lag expected",
+	AnnounceSchedules:     "{{if .Schedules}}Now in effect: {{.Schedules}}{{else}}Back to normal rules{{end}}",
+}
+
+func (a *AnnouncementsConfig) normalize() error {
+	switch a.Command {
+	case "":
+		a.Command = AnnounceSay
+	case AnnounceSay, AnnounceTellraw:
+	default:
+		return fmt.Errorf("command: invalid value %q (must be %s or %s)", a.Command, AnnounceSay, AnnounceTellraw)
+	}
+	for event, message := range a.Messages {
+		if !slices.Contains(AnnouncementEvents, event) {
+			return fmt.Errorf("messages: unknown event %q (must be one of %s)", event, strings.Join(AnnouncementEvents, ", "))
+		}
+		if _, err := template.New(event).Parse(message); err != nil {
+			return fmt.Errorf("messages.%s: %w", event, err)
+		}
+	}
+	return nil
+}
+
+// TelegramConfig is a Telegram bot. Notifications of at least Severity
+// (default warning) are sent to ChatIDs. Members of those chats may ask for
+// /status; only the users in AdminIDs may restart servers. Token defaults
+// to $TELEGRAM_BOT_TOKEN.
+type TelegramConfig struct {
+	Token    string  `yaml:"token"`
+	ChatIDs  []int64 `yaml:"chat_ids"`
+	Severity string  `yaml:"severity"`
+	AdminIDs []int64 `yaml:"admin_ids"`
+
+	Templates NotificationTemplates `yaml:"templates"`
+}
+
+func (t *TelegramConfig) normalize() error {
+	if t.Token == "" {
+		t.Token = os.Getenv("TELEGRAM_BOT_TOKEN")
+	}
+	if t.Token == "" {
+		return fmt.Errorf("token (or $TELEGRAM_BOT_TOKEN) is required")
+	}
+	if len(t.ChatIDs) == 0 && len(t.AdminIDs) == 0 {
+		return fmt.Errorf("at least one of chat_ids and admin_ids is required")
+	}
+	if t.Severity == "" {
+		t.Severity = "warning"
+	}
+	if !slices.Contains(Severities, t.Severity) {
+		return fmt.Errorf("severity: invalid value %q (must be one of %s)", t.Severity, strings.Join(Severities, ", "))
+	}
+	return t.Templates.validate()
+}
+
+// TenantQuota limits the servers of a tenant. MaxInstances caps the
+// running servers, Memory the memory they reserve and Disk the space their
+// directories take. Zero values mean unlimited.
+type TenantQuota struct {
+	MaxInstances int    `yaml:"max_instances"`
+	Memory       string `yaml:"memory"`
+	Disk         string `yaml:"disk"`
+}
+
+type GitHubConfig struct {
+	RepoOwner    string `yaml:"repo_owner"`
+	RepoName     string `yaml:"repo_name"`
+	Branch       string `yaml:"branch"`
+	ConfigPath   string `yaml:"config_path"`
+	PollInterval int    `yaml:"poll_interval"`
+
+	// Path reads the configuration from a local directory instead of a
+	// repository, e.g. a checkout or a USB stick
+	Path string `yaml:"path"`
+
+	// Environments maps environment names to branches, e.g. dev: develop.
+	// Environment selects the branch this manager follows.
+	Environments map[string]string `yaml:"environments"`
+	Environment  string            `yaml:"environment"`
+	// Token authenticates GitHub API requests that write to the
+	// repositories, such as promotions. Defaults to $GITHUB_TOKEN.
+	Token string `yaml:"token"`
+
+	// Signing restricts applied commits to those signed by allowed keys
+	Signing SigningConfig `yaml:"signing"`
+
+	// Deployments records every apply as a GitHub deployment
+	Deployments DeploymentsConfig `yaml:"deployments"`
+
+	// Sources lists several configuration repositories that are merged in
+	// order, later sources taking precedence. When empty the repository
+	// above is the only source.
+	Sources []ConfigSource `yaml:"sources"`
+
+	// WriteBack is how changes made through the API are written to the
+	// configuration: committed to the branch (commit) or proposed in a pull
+	// request (pull_request). Empty, the default, turns write-back off.
+	WriteBack string `yaml:"write_back"`
+}
+
+// Write-back modes
+const (
+	WriteBackCommit      = "commit"
+	WriteBackPullRequest = "pull_request"
+)
+
+// SigningConfig requires applied commits to be signed by one of the allowed
+// keys, or to be tagged by a signed tag when AllowSignedTags is set. Keys are
+// SSH public keys in authorized_keys format, SSH fingerprints
+// ("SHA256:...") or GPG key fingerprints or IDs.
+type SigningConfig struct {
+	Required        bool     `yaml:"required"`
+	AllowedKeys     []string `yaml:"allowed_keys"`
+	AllowSignedTags bool     `yaml:"allow_signed_tags"`
+}
+
+// DeploymentsConfig controls reporting applies to the GitHub Deployments
+// API. LogURL may contain {sha}, replaced by the applied commit.
+type DeploymentsConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Environment string `yaml:"environment"`
+	LogURL      string `yaml:"log_url"`
+}
+
+// ConfigSource is one repository contributing to the server configuration.
+// Unset fields fall back to the top-level github settings.
+type ConfigSource struct {
+	Name       string `yaml:"name"`
+	RepoOwner  string `yaml:"repo_owner"`
+	RepoName   string `yaml:"repo_name"`
+	Branch     string `yaml:"branch"`
+	ConfigPath string `yaml:"config_path"`
+	// Tenant restricts the source to servers of one tenant, e.g. a
+	// repository owned by a customer
+	Tenant string `yaml:"tenant"`
+
+	// Path is a local directory read instead of the repository
+	Path string `yaml:"path"`
+}
+
+type HTTPConfig struct {
+	Port int `yaml:"port"`
+
+	// RateLimit limits API requests per client address
+	RateLimit APIRateLimit `yaml:"rate_limit"`
+
+	// TLS serves the API over HTTPS when a certificate is configured
+	TLS TLSConfig `yaml:"tls"`
+
+	// Auth requires bearer tokens once any token is configured
+	Auth AuthConfig `yaml:"auth"`
+
+	// Pprof serves the Go profiles of the manager under /debug/pprof/ to
+	// callers with the admin verb. It requires auth.
+	Pprof bool `yaml:"pprof"`
+
+	// AllowedOrigins are the origins, such as https://dashboard.example.com,
+	// whose pages may open the console and event WebSockets besides the
+	// API's own
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// AuthConfig lists the API tokens and the OIDC login. Without either the
+// API is open.
+type AuthConfig struct {
+	Tokens []APIToken  `yaml:"tokens"`
+	OIDC   *OIDCConfig `yaml:"oidc"`
+}
+
+// Grant is a set of verbs. A grant without Servers, Groups and Tenant is
+// unscoped and applies to every server and to manager-wide endpoints. A
+// grant with a Tenant only applies to the servers of that tenant.
+type Grant struct {
+	Verbs   []string `yaml:"verbs"`
+	Servers []string `yaml:"servers"`
+	Groups  []string `yaml:"groups"`
+	Tenant  string   `yaml:"tenant"`
+
+	// Commands limits the console commands of the command verb
+	Commands *CommandPolicy `yaml:"commands"`
+}
+
+// APIToken is a static bearer token with a grant
+type APIToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Grant `yaml:",inline"`
+}
+
+// OIDCConfig signs users in through an OpenID Connect provider such as
+// Google or Keycloak, or through GitHub OAuth, and maps their groups to
+// roles. Sessions are kept in a cookie.
+type OIDCConfig struct {
+	// Provider is "oidc" (default) or "github"
+	Provider string `yaml:"provider"`
+	// Issuer is the OIDC issuer URL, discovered through
+	// /.well-known/openid-configuration
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL is the public URL of /auth/callback
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+	// GroupsClaim names the ID token claim listing the user's groups
+	GroupsClaim string `yaml:"groups_claim"`
+	// SessionHours is how long a login lasts
+	SessionHours int `yaml:"session_hours"`
+	// Roles are matched in order, the first role whose group the user is in
+	// applies. With GitHub, groups are "org" and "org/team".
+	Roles []OIDCRole `yaml:"roles"`
+}
+
+// OIDCRole grants verbs to the members of an IdP group
+type OIDCRole struct {
+	Group string `yaml:"group"`
+	Grant `yaml:",inline"`
+}
+
+// OIDC providers
+const (
+	ProviderOIDC   = "oidc"
+	ProviderGitHub = "github"
+)
+
+// API verbs
+const (
+	VerbRead      = "read"
+	VerbCommand   = "command"
+	VerbLifecycle = "lifecycle"
+	VerbBackup    = "backup"
+	VerbAdmin     = "admin"
+)
+
+var apiVerbs = []string{VerbRead, VerbCommand, VerbLifecycle, VerbBackup, VerbAdmin}
+
+// Scoped reports whether the grant is limited to some servers
+func (g Grant) Scoped() bool {
+	return len(g.Servers) > 0 || len(g.Groups) > 0 || g.Tenant != ""
+}
+
+func (g Grant) validate() error {
+	if len(g.Verbs) == 0 {
+		return fmt.Errorf("at least one verb is required")
+	}
+	for _, verb := range g.Verbs {
+		valid := false
+		for _, known := range apiVerbs {
+			valid = valid || verb == known
+		}
+		if !valid {
+			return fmt.Errorf("invalid verb %q (must be one of %s)", verb, strings.Join(apiVerbs, ", "))
+		}
+		if verb == VerbAdmin && g.Scoped() {
+			return fmt.Errorf("the admin verb cannot be scoped to servers, groups or a tenant")
+		}
+	}
+	if g.Commands != nil {
+		if !slices.Contains(g.Verbs, VerbCommand) {
+			return fmt.Errorf("commands: requires the command verb")
+		}
+		if err := g.Commands.validate(); err != nil {
+			return fmt.Errorf("commands: %w", err)
+		}
+	}
+	return nil
+}
+
+func (a *AuthConfig) normalize() error {
+	names := make(map[string]bool)
+	secrets := make(map[string]bool)
+	for i, token := range a.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("tokens[%d]: name is required", i)
+		}
+		if names[token.Name] {
+			return fmt.Errorf("tokens[%d]: duplicate name %q", i, token.Name)
+		}
+		names[token.Name] = true
+		if len(token.Token) < 16 {
+			return fmt.Errorf("token %s: token must be at least 16 characters", token.Name)
+		}
+		if secrets[token.Token] {
+			return fmt.Errorf("token %s: token is shared with another entry", token.Name)
+		}
+		secrets[token.Token] = true
+		if err := token.Grant.validate(); err != nil {
+			return fmt.Errorf("token %s: %w", token.Name, err)
+		}
+	}
+
+	if a.OIDC != nil {
+		if err := a.OIDC.normalize(); err != nil {
+			return fmt.Errorf("oidc: %w", err)
+		}
+	}
+	return nil
+}
+
+func (o *OIDCConfig) normalize() error {
+	switch o.Provider {
+	case "":
+		o.Provider = ProviderOIDC
+	case ProviderOIDC, ProviderGitHub:
+	default:
+		return fmt.Errorf("provider: invalid value %q (must be %s or %s)", o.Provider, ProviderOIDC, ProviderGitHub)
+	}
+	if o.Provider == ProviderOIDC && o.Issuer == "" {
+		return fmt.Errorf("issuer is required")
+	}
+	if o.ClientSecret == "" {
+		o.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	}
+	if o.ClientID == "" || o.ClientSecret == "" {
+		return fmt.Errorf("client_id and client_secret (or $OIDC_CLIENT_SECRET) are required")
+	}
+	if o.RedirectURL == "" {
+		return fmt.Errorf("redirect_url is required")
+	}
+	if len(o.Scopes) == 0 {
+		o.Scopes = []string{"openid", "email", "profile"}
+		if o.Provider == ProviderGitHub {
+			o.Scopes = []string{"read:user", "user:email", "read:org"}
+		}
+	}
+	if o.GroupsClaim == "" {
+		o.GroupsClaim = "groups"
+	}
+	if o.SessionHours <= 0 {
+		o.SessionHours = 12
+	}
+	if len(o.Roles) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	for i, role := range o.Roles {
+		if role.Group == "" {
+			return fmt.Errorf("roles[%d]: group is required", i)
+		}
+		if err := role.Grant.validate(); err != nil {
+			return fmt.Errorf("role %s: %w", role.Group, err)
+		}
+	}
+	return nil
+}
+
+// TLSConfig configures HTTPS for the API. With ClientCAFile set, clients
+// present certificates signed by that CA (mTLS); ClientAuth is "none",
+// "optional" or "require" (the default with a client CA).
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+	ClientAuth   string `yaml:"client_auth"`
+}
+
+// Client authentication modes
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Enabled reports whether the API is served over TLS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// APIRateLimit is a token bucket per client. Zero RequestsPerSecond
+// disables rate limiting.
+type APIRateLimit struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+type ServerConfig struct {
+	BaseDir      string `yaml:"base_dir"`
+	MaxInstances int    `yaml:"max_instances"`
+	BedrockPath  string `yaml:"bedrock_path"`
+	MemoryLimit  string `yaml:"memory_limit"`
+	MaxImportMB  int    `yaml:"max_import_mb"`
+	CacheDir     string `yaml:"cache_dir"`
+	DataDir      string `yaml:"data_dir"`
+	ApplyHistory int    `yaml:"apply_history"`
+	// ShutdownTimeout is how long servers get to stop gracefully, in seconds
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+
+	// GroupLimits caps the number of running servers per group
+	GroupLimits map[string]int `yaml:"group_limits"`
+	// Budget is the host capacity shared by all servers
+	Budget ResourceBudget `yaml:"budget"`
+
+	// Orphans is what happens to server processes left behind by an
+	// earlier manager process: terminate, adopt or ignore
+	Orphans string `yaml:"orphans"`
+
+	// RestartBudget is how often a server may be restarted within an hour,
+	// by crashes, applies or schedules alike, before it is quarantined;
+	// zero for no limit
+	RestartBudget int `yaml:"restart_budget"`
+
+	// Versions runs every server with the Bedrock binary of its version
+	Versions VersionsConfig `yaml:"versions"`
+}
+
+// VersionsConfig downloads the Bedrock dedicated server of each version
+// servers use into cache_dir/versions and runs every server with the
+// binary of its version, instead of bedrock_path for all. URL is where a
+// version is downloaded from, with {version} replaced by the version.
+//
+// A server's version may also be a channel, latest or preview, resolved
+// to the current build of the channel through ChannelsURL whenever a
+// commit is fetched.
+type VersionsConfig struct {
+	Download    bool   `yaml:"download"`
+	URL         string `yaml:"url"`
+	ChannelsURL string `yaml:"channels_url"`
+}
+
+// DefaultVersionsURL is where Mojang publishes the Bedrock dedicated
+// server for Linux
+const DefaultVersionsURL = "https://www.minecraft.net/bedrockdedicatedserver/bin-linux/bedrock-server-{version}.zip"
+
+// DefaultChannelsURL lists Mojang's current downloads of the dedicated
+// server
+const DefaultChannelsURL = "https://net-secondary.web.minecraft-services.net/api/v1.0/download/links"
+
+// Version channels
+const (
+	ChannelLatest  = "latest"
+	ChannelPreview = "preview"
+)
+
+// LockfileConfig controls the lockfile written after every apply. Path is
+// the lockfile in the repository of Source, by default party.lock in the
+// first source. With Commit, changes of the lockfile are written back to
+// it as github.write_back says; with Frozen, servers on a channel run the
+// build the repository's lockfile holds for them instead of the current
+// one.
+type LockfileConfig struct {
+	Path   string `yaml:"path"`
+	Source string `yaml:"source"`
+	Commit bool   `yaml:"commit"`
+	Frozen bool   `yaml:"frozen"`
+}
+
+// Orphan policies
+const (
+	OrphansTerminate = "terminate"
+	OrphansAdopt     = "adopt"
+	OrphansIgnore    = "ignore"
+)
+
+// ResourceBudget declares the memory and CPU available to servers on the
+// host. Zero values mean unlimited.
+type ResourceBudget struct {
+	Memory string  `yaml:"memory"`
+	CPU    float64 `yaml:"cpu"`
+}
+
+// ProxyConfig enables the built-in UDP proxy. Each server then listens on
+// its port plus PortOffset and the proxy serves the configured port,
+// accounting for the traffic. SessionTimeout is in seconds. Packets from
+// addresses or CIDR ranges in Blocklist are dropped. MaxSessions caps the
+// client sessions of each server across all source IPs (default 1024).
+type ProxyConfig struct {
+	Enabled        bool            `yaml:"enabled"`
+	PortOffset     int             `yaml:"port_offset"`
+	SessionTimeout int             `yaml:"session_timeout"`
+	MaxSessions    int             `yaml:"max_sessions"`
+	Blocklist      []string        `yaml:"blocklist"`
+	RateLimit      ProxyRateLimits `yaml:"rate_limit"`
+	Queue          ProxyQueue      `yaml:"queue"`
+}
+
+// ProxyQueue holds players joining a full server in a queue and admits them
+// in order as slots free up. Size caps the queue; a queued player keeps
+// their place for Hold seconds after their client was last heard from.
+type ProxyQueue struct {
+	Enabled bool `yaml:"enabled"`
+	Size    int  `yaml:"size"`
+	Hold    int  `yaml:"hold"`
+}
+
+// ProxyRateLimits limit what a single source IP may send. Zero disables a
+// limit.
+type ProxyRateLimits struct {
+	PacketsPerSecond float64 `yaml:"packets_per_second"`
+	Burst            int     `yaml:"burst"`
+	MaxSessions      int     `yaml:"max_sessions"`
+}
+
+// GeoIPConfig points at a MaxMind GeoLite2/GeoIP2 Country or City
+// database used to resolve client countries in the proxy
+type GeoIPConfig struct {
+	Database string `yaml:"database"`
+}
+
+// EgressConfig routes the manager's outbound HTTP requests, such as GitHub
+// API calls, template and pack downloads, notifications and hooks, through
+// Proxy, an http://, https:// or socks5:// URL. Hosts in NoProxy are
+// reached directly. Destinations override both for their hosts, where a
+// proxy of "direct" connects without one. Without Proxy the HTTPS_PROXY,
+// HTTP_PROXY and NO_PROXY environment variables apply.
+type EgressConfig struct {
+	Proxy        string              `yaml:"proxy"`
+	NoProxy      []string            `yaml:"no_proxy"`
+	Destinations []EgressDestination `yaml:"destinations"`
+}
+
+// EgressDestination sends requests to Hosts through Proxy. Hosts are
+// names, "*.example.com" for subdomains, IP addresses or CIDR ranges.
+type EgressDestination struct {
+	Hosts []string `yaml:"hosts"`
+	Proxy string   `yaml:"proxy"`
+}
+
+// EgressDirect is the proxy of destinations reached without one
+const EgressDirect = "direct"
+
+func (c *EgressConfig) validate() error {
+	if c.Proxy != "" {
+		if err := validateProxyURL(c.Proxy); err != nil {
+			return fmt.Errorf("proxy: %w", err)
+		}
+	}
+	for i, destination := range c.Destinations {
+		if len(destination.Hosts) == 0 {
+			return fmt.Errorf("destinations[%d].hosts: is required", i)
+		}
+		if destination.Proxy == EgressDirect {
+			continue
+		}
+		if err := validateProxyURL(destination.Proxy); err != nil {
+			return fmt.Errorf("destinations[%d].proxy: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateProxyURL(value string) error {
+	proxyURL, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if schemes := []string{"http", "https", "socks5"}; !slices.Contains(schemes, proxyURL.Scheme) || proxyURL.Host == "" {
+		return fmt.Errorf("invalid proxy %q (must be an http://, https:// or socks5:// URL)", value)
+	}
+	return nil
+}
+
+// MirrorConfig points at an internal repository of Bedrock binaries and
+// world templates, for sites without or with little internet access. URL
+// is the base of a simple HTTP layout, as http://, https:// or file://, or
+// an OCI registry repository as oci://registry/repository (oci+http:// for
+// registries without TLS). Username and Password authenticate to it. With
+// Fallback, artifacts missing from the mirror are downloaded from their
+// original location.
+type MirrorConfig struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Fallback bool   `yaml:"fallback"`
+}
+
+func (c *MirrorConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	mirrorURL, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+	if schemes := []string{"http", "https", "file", "oci", "oci+http"}; !slices.Contains(schemes, mirrorURL.Scheme) {
+		return fmt.Errorf("url: invalid scheme %q (must be one of %s)", mirrorURL.Scheme, strings.Join(schemes, ", "))
+	}
+	if strings.HasPrefix(mirrorURL.Scheme, "oci") && strings.Trim(mirrorURL.Path, "/") == "" {
+		return fmt.Errorf("url: %s names no repository", c.URL)
+	}
+	return nil
+}
+
+// VerificationConfig controls the checks of artifacts before the servers
+// run them. Checksums pins the SHA-256 checksums of Bedrock archives by
+// version on this host, besides the bedrock_checksums of the repository
+// configuration. Bedrock versions without a pin are refused unless
+// AllowUnpinned is set; with RequirePackChecksums, behavior packs without
+// a sha256 are refused as well.
+type VerificationConfig struct {
+	Checksums            map[string]string `yaml:"checksums"`
+	AllowUnpinned        bool              `yaml:"allow_unpinned"`
+	RequirePackChecksums bool              `yaml:"require_pack_checksums"`
+}
+
+func (c *VerificationConfig) validate() error {
+	for _, version := range sortedKeys(c.Checksums) {
+		if !sha256Pattern.MatchString(c.Checksums[version]) {
+			return fmt.Errorf("checksums.%s: must be a hex encoded SHA-256 checksum", version)
+		}
+	}
+	return nil
+}
+
+// BedrockChecksum returns the pinned SHA-256 checksum of the archive of a
+// Bedrock version, empty when neither the manager configuration nor the
+// repository configuration pins one. Differing pins are an error. Versions
+// pinned by neither fall back to the checksum of the repository's
+// lockfile.
+func (c *Config) BedrockChecksum(repoConfig *RepoConfig, version string) (string, error) {
+	pinned := strings.ToLower(c.Verification.Checksums[version])
+	if repoConfig == nil {
+		return pinned, nil
+	}
+	if checksum := strings.ToLower(repoConfig.BedrockChecksums[version]); checksum != "" {
+		if pinned != "" && pinned != checksum {
+			return "", fmt.Errorf("Bedrock %s is pinned to %s by verification.checksums but to %s by bedrock_checksums", version, pinned, checksum)
+		}
+		pinned = checksum
+	}
+	if pinned == "" && repoConfig.Lock != nil {
+		pinned = strings.ToLower(repoConfig.Lock.Bedrock[version].SHA256)
+	}
+	return pinned, nil
+}
+
+// PreflightConfig controls the environment checks run at startup. With
+// Strict the manager refuses to start when a check fails. Skip names
+// checks that do not apply to this host.
+type PreflightConfig struct {
+	Strict bool     `yaml:"strict"`
+	Skip   []string `yaml:"skip"`
+}
+
+// Preflight checks
+const (
+	CheckBedrockLibraries = "bedrock_libraries"
+	CheckPorts            = "ports"
+	CheckOpenFiles        = "open_files"
+	CheckDiskSpace        = "disk_space"
+	CheckGitHubToken      = "github_token"
+	CheckClock            = "clock"
+)
+
+// PreflightChecks lists every preflight check in the order they run
+var PreflightChecks = []string{CheckBedrockLibraries, CheckPorts, CheckOpenFiles, CheckDiskSpace, CheckGitHubToken, CheckClock}
+
+// GCConfig controls pruning of cached artifacts and deployed packs that are
+// no longer referenced by the configuration. Durations are in hours.
+type GCConfig struct {
+	Interval    int  `yaml:"interval"`
+	GracePeriod int  `yaml:"grace_period"`
+	DryRun      bool `yaml:"dry_run"`
+}
+
+// Staleness policies
+const (
+	StalenessKeep     = "keep"
+	StalenessSafeMode = "safe-mode"
+)
+
+// StalenessConfig decides what the manager does while it cannot get the
+// latest configuration of its sources. After WarnMinutes (default 30) the
+// configuration is reported stale. With Policy safe-mode, the manager
+// enters safe mode after SafeModeHours (default 6): it makes no changes of
+// its own, such as maximum uptime restarts, scheduled resets, schedules
+// and operating hours, but still restarts crashed servers. The default
+// policy keep runs on as is.
+type StalenessConfig struct {
+	WarnMinutes   int    `yaml:"warn_minutes"`
+	Policy        string `yaml:"policy"`
+	SafeModeHours int    `yaml:"safe_mode_hours"`
+}
+
+// HibernateConfig stops the host, e.g. a cloud VM, while every configured
+// server is scheduled off outside its operating hours. Once all servers
+// have been off for IdleMinutes (default 10) and the next operating hours
+// begin at least MinOffMinutes (default 60) later, the manager saves its
+// state, runs Command, such as aws ec2 stop-instances, and calls the hooks
+// registered for host.hibernate. Starting the host again is left to the
+// cloud provider's scheduler.
+type HibernateConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	IdleMinutes   int      `yaml:"idle_minutes"`
+	MinOffMinutes int      `yaml:"min_off_minutes"`
+	Command       []string `yaml:"command"`
+}
+
+// DriftConfig checks running servers for drift every Interval minutes
+// (default 15, negative to turn the checks off). Correct writes drifted
+// files again instead of only reporting them.
+type DriftConfig struct {
+	Interval int  `yaml:"interval"`
+	Correct  bool `yaml:"correct"`
+}
+
+// MetricsConfig selects how the manager's metrics are exported: served in
+// the Prometheus text format on /metrics, pushed to a StatsD agent, or not
+// at all.
+type MetricsConfig struct {
+	Exporter string       `yaml:"exporter"`
+	StatsD   StatsDConfig `yaml:"statsd"`
+}
+
+// StatsDConfig configures the StatsD exporter. Tags are DogStatsD tags
+// ("key:value") added to every metric; Interval is in seconds.
+type StatsDConfig struct {
+	Address  string   `yaml:"address"`
+	Prefix   string   `yaml:"prefix"`
+	Tags     []string `yaml:"tags"`
+	Interval int      `yaml:"interval"`
+}
+
+// Metrics exporters
+const (
+	ExporterPrometheus = "prometheus"
+	ExporterStatsD     = "statsd"
+	ExporterNone       = "none"
+)
+
+// NotificationsConfig lists the sinks that receive notifications.
+// Templates customize the notifications of every sink; templates of a sink
+// take precedence.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `yaml:"webhooks"`
+	Email    *EmailConfig    `yaml:"email"`
+
+	Templates NotificationTemplates `yaml:"templates"`
+
+	// Cooldown suppresses repeats of a notification about the same server
+	// within that many minutes; QuietHours hold back less severe
+	// notifications at night
+	Cooldown   int         `yaml:"cooldown"`
+	QuietHours *QuietHours `yaml:"quiet_hours"`
+}
+
+// QuietHours drop notifications below Severity (default critical) between
+// Start and End, given as "22:00" in Timezone (default the local time
+// zone). The window may span midnight.
+type QuietHours struct {
+	Start    string `yaml:"start"`
+	End      string `yaml:"end"`
+	Severity string `yaml:"severity"`
+	Timezone string `yaml:"timezone"`
+
+	start, end int
+	location   *time.Location
+}
+
+// parseClock parses "22:00" into minutes after midnight
+func parseClock(value string) (int, error) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (must look like 22:00)", value)
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+func (q *QuietHours) normalize() error {
+	var err error
+	if q.start, err = parseClock(q.Start); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if q.end, err = parseClock(q.End); err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if q.Severity == "" {
+		q.Severity = "critical"
+	}
+	if !slices.Contains(Severities, q.Severity) {
+		return fmt.Errorf("severity: invalid value %q (must be one of %s)", q.Severity, strings.Join(Severities, ", "))
+	}
+	q.location = time.Local
+	if q.Timezone != "" {
+		if q.location, err = time.LoadLocation(q.Timezone); err != nil {
+			return fmt.Errorf("timezone: %w", err)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether t falls into the quiet hours
+func (q *QuietHours) Contains(t time.Time) bool {
+	local := t.In(q.location)
+	minute := local.Hour()*60 + local.Minute()
+	if q.start <= q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// NotificationTemplates maps notification events, or "*" for any event, to
+// the templates replacing their title and message
+type NotificationTemplates map[string]NotificationTemplate
+
+// NotificationTemplate holds Go templates over a notification. An empty
+// template keeps the original text.
+type NotificationTemplate struct {
+	Title   string `yaml:"title"`
+	Message string `yaml:"message"`
+}
+
+// Notification events
+const (
+	NotifyServerCrashed = "server.crashed"
+	NotifyConfigFailed  = "config.failed"
+	NotifyAlertFiring   = "alert.firing"
+	NotifyAlertResolved = "alert.resolved"
+	NotifyTenantDisk    = "tenant.disk_quota"
+	NotifyHookFailed    = "hook.failed"
+
+	NotifyIncidentFailed = "incident.failed"
+	NotifyConfigStale    = "config.stale"
+
+	NotifyServerQuarantined = "server.quarantined"
+	NotifyServerDrift       = "server.drift"
+)
+
+// NotificationEvents lists the events notifications are sent for
+var NotificationEvents = []string{NotifyServerCrashed, NotifyConfigFailed, NotifyAlertFiring, NotifyAlertResolved, NotifyTenantDisk, NotifyHookFailed, NotifyServerQuarantined, NotifyServerDrift, NotifyIncidentFailed, NotifyConfigStale}
+
+func (t NotificationTemplates) validate() error {
+	for _, event := range sortedKeys(t) {
+		if event != "*" && !slices.Contains(NotificationEvents, event) {
+			return fmt.Errorf("templates: unknown event %q (must be * or one of %s)", event, strings.Join(NotificationEvents, ", "))
+		}
+		for field, text := range map[string]string{"title": t[event].Title, "message": t[event].Message} {
+			if _, err := template.New(field).Parse(text); err != nil {
+				return fmt.Errorf("templates.%s.%s: %w", event, field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// EmailConfig mails notifications through an SMTP server to each recipient
+// whose filters they pass
+type EmailConfig struct {
+	SMTP       SMTPConfig       `yaml:"smtp"`
+	Recipients []EmailRecipient `yaml:"recipients"`
+}
+
+// EmailRecipient receives notifications of at least Severity (default
+// critical). Tenant and MatchLabels filter like those of webhooks.
+type EmailRecipient struct {
+	Address     string            `yaml:"address"`
+	Severity    string            `yaml:"severity"`
+	Tenant      string            `yaml:"tenant"`
+	MatchLabels map[string]string `yaml:"match_labels"`
+
+	Templates NotificationTemplates `yaml:"templates"`
+}
+
+// Severities lists the notification severities, lowest first
+var Severities = []string{"info", "warning", "critical"}
+
+func (e *EmailConfig) normalize() error {
+	if err := e.SMTP.normalize(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if len(e.Recipients) == 0 {
+		return fmt.Errorf("recipients: at least one is required")
+	}
+	for i := range e.Recipients {
+		recipient := &e.Recipients[i]
+		if recipient.Address == "" {
+			return fmt.Errorf("recipients[%d]: address is required", i)
+		}
+		if recipient.Severity == "" {
+			recipient.Severity = "critical"
+		}
+		if !slices.Contains(Severities, recipient.Severity) {
+			return fmt.Errorf("recipients[%d] (%s): severity: invalid value %q (must be one of %s)", i, recipient.Address, recipient.Severity, strings.Join(Severities, ", "))
+		}
+		if err := recipient.Templates.validate(); err != nil {
+			return fmt.Errorf("recipients[%d] (%s): %w", i, recipient.Address, err)
+		}
+	}
+	return nil
+}
+
+// WebhookConfig posts notifications as JSON to a URL. With Tenant only
+// notifications about that tenant are sent, with MatchLabels only those
+// about servers carrying all of those labels.
+type WebhookConfig struct {
+	Name        string            `yaml:"name"`
+	URL         string            `yaml:"url"`
+	Headers     map[string]string `yaml:"headers"`
+	Tenant      string            `yaml:"tenant"`
+	MatchLabels map[string]string `yaml:"match_labels"`
+
+	Templates NotificationTemplates `yaml:"templates"`
+}
+
+// HookConfig is an HTTP request made when one of Events happens to a
+// server. URL and Body are Go templates over the server; without Body the
+// server is sent as JSON. Failed requests are retried Retries times with
+// backoff. With Tenant only servers of that tenant trigger the hook.
+type HookConfig struct {
+	Name    string            `yaml:"name"`
+	Events  []string          `yaml:"events"`
+	Method  string            `yaml:"method"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	Retries int               `yaml:"retries"`
+	Tenant  string            `yaml:"tenant"`
+}
+
+// Hook events
+const (
+	HookServerCreated   = "server.created"
+	HookServerDestroyed = "server.destroyed"
+	HookHostHibernate   = "host.hibernate"
+)
+
+// HookEvents lists the events hooks can be called on
+var HookEvents = []string{HookServerCreated, HookServerDestroyed, HookHostHibernate}
+
+func (h *HookConfig) normalize() error {
+	if h.Name == "" {
+		return fmt.Errorf("name: is required")
+	}
+	if h.URL == "" {
+		return fmt.Errorf("url: is required")
+	}
+	if len(h.Events) == 0 {
+		// Host events are opt-in
+		h.Events = []string{HookServerCreated, HookServerDestroyed}
+	}
+	for _, event := range h.Events {
+		if !slices.Contains(HookEvents, event) {
+			return fmt.Errorf("events: unknown event %q (must be one of %s)", event, strings.Join(HookEvents, ", "))
+		}
+	}
+	if h.Method == "" {
+		h.Method = "POST"
+	}
+	h.Method = strings.ToUpper(h.Method)
+	switch {
+	case h.Retries == 0:
+		h.Retries = 3
+	case h.Retries < 0:
+		return fmt.Errorf("retries: must not be negative")
+	}
+	return nil
+}
+
+// UsageConfig controls the monthly usage reports. RetentionMonths is how
+// many months of usage are kept; Email sends the reports of every finished
+// month.
+type UsageConfig struct {
+	RetentionMonths int              `yaml:"retention_months"`
+	Email           UsageEmailConfig `yaml:"email"`
+}
+
+// UsageEmailConfig mails the full report to To and the report of each
+// tenant to the addresses listed for it in Tenants
+type UsageEmailConfig struct {
+	SMTP    SMTPConfig          `yaml:"smtp"`
+	To      []string            `yaml:"to"`
+	Tenants map[string][]string `yaml:"tenants"`
+}
+
+// Enabled reports whether any report is mailed
+func (e UsageEmailConfig) Enabled() bool {
+	return len(e.To) > 0 || len(e.Tenants) > 0
+}
+
+// SMTPConfig is a mail server used to send email. Address is host:port.
+// TLS is "auto" (the default: implicit TLS on port 465, elsewhere STARTTLS
+// when offered), "implicit", "starttls" (required) or "none". Password
+// defaults to $SMTP_PASSWORD.
+type SMTPConfig struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+	TLS      string `yaml:"tls"`
+}
+
+// SMTP TLS modes
+const (
+	SMTPTLSAuto     = "auto"
+	SMTPTLSImplicit = "implicit"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSNone     = "none"
+)
+
+func (s *SMTPConfig) normalize() error {
+	if s.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+	if _, _, err := net.SplitHostPort(s.Address); err != nil {
+		return fmt.Errorf("invalid address %q (must be host:port)", s.Address)
+	}
+	if s.From == "" {
+		return fmt.Errorf("from is required")
+	}
+	if s.Password == "" {
+		s.Password = os.Getenv("SMTP_PASSWORD")
+	}
+	switch s.TLS {
+	case "":
+		s.TLS = SMTPTLSAuto
+	case SMTPTLSAuto, SMTPTLSImplicit, SMTPTLSStartTLS, SMTPTLSNone:
+	default:
+		return fmt.Errorf("tls: invalid value %q (must be one of %s, %s, %s, %s)", s.TLS, SMTPTLSAuto, SMTPTLSImplicit, SMTPTLSStartTLS, SMTPTLSNone)
+	}
+	return nil
+}
+
+// HeartbeatConfig lists URLs of external uptime monitors, such as
+// healthchecks.io checks. URL is pinged after every successful poll and
+// Servers maps server names to URLs pinged every minute while the server is
+// running.
+type HeartbeatConfig struct {
+	URL     string            `yaml:"url"`
+	Servers map[string]string `yaml:"servers"`
+}
+
+// AlertsConfig holds the alert rules evaluated against the metric set every
+// Interval seconds
+type AlertsConfig struct {
+	Interval  int             `yaml:"interval"`
+	Rules     []AlertRule     `yaml:"rules"`
+	Incidents IncidentsConfig `yaml:"incidents"`
+}
+
+// IncidentsConfig opens an incident in PagerDuty and Opsgenie for every
+// alert of at least Severity (default critical) that fires, and resolves
+// it when the alert resolves
+type IncidentsConfig struct {
+	Severity  string           `yaml:"severity"`
+	PagerDuty *PagerDutyConfig `yaml:"pagerduty"`
+	Opsgenie  *OpsgenieConfig  `yaml:"opsgenie"`
+}
+
+// PagerDutyConfig sends incidents to the Events API v2 with the routing
+// key of a service integration
+type PagerDutyConfig struct {
+	RoutingKey string `yaml:"routing_key"`
+	URL        string `yaml:"url"`
 }
 
-type GitHubConfig struct {
-	RepoOwner    string `yaml:"repo_owner"`
-	RepoName     string `yaml:"repo_name"`
-	Branch       string `yaml:"branch"`
-	ConfigPath   string `yaml:"config_path"`
-	PollInterval int    `yaml:"poll_interval"`
+// OpsgenieConfig creates Opsgenie alerts with the key of an API
+// integration. URL is https://api.eu.opsgenie.com for EU accounts.
+// Responders are team names the alerts are assigned to.
+type OpsgenieConfig struct {
+	APIKey     string   `yaml:"api_key"`
+	URL        string   `yaml:"url"`
+	Responders []string `yaml:"responders"`
+	Tags       []string `yaml:"tags"`
 }
 
-type HTTPConfig struct {
-	Port int `yaml:"port"`
+func (c *IncidentsConfig) normalize() error {
+	if c.Severity == "" {
+		c.Severity = "critical"
+	}
+	if !slices.Contains(Severities, c.Severity) {
+		return fmt.Errorf("severity: invalid value %q (must be one of %s)", c.Severity, strings.Join(Severities, ", "))
+	}
+	if pd := c.PagerDuty; pd != nil {
+		if pd.RoutingKey == "" {
+			return fmt.Errorf("pagerduty.routing_key: is required")
+		}
+		if pd.URL == "" {
+			pd.URL = "https://events.pagerduty.com/v2/enqueue"
+		}
+	}
+	if og := c.Opsgenie; og != nil {
+		if og.APIKey == "" {
+			return fmt.Errorf("opsgenie.api_key: is required")
+		}
+		if og.URL == "" {
+			og.URL = "https://api.opsgenie.com"
+		}
+		og.URL = strings.TrimSuffix(og.URL, "/")
+	}
+	return nil
 }
 
-type ServerConfig struct {
-	BaseDir      string `yaml:"base_dir"`
-	MaxInstances int    `yaml:"max_instances"`
-	BedrockPath  string `yaml:"bedrock_path"`
-	MemoryLimit  string `yaml:"memory_limit"`
+// AlertRule fires when a metric compares to the threshold for ForMinutes.
+// With WindowMinutes set, counters are compared by their increase over the
+// window instead, e.g. crashes per hour. Server limits per-server metrics to
+// one server. Once resolved, a rule does not fire again for the same series
+// within CooldownMinutes.
+type AlertRule struct {
+	Name            string `yaml:"name"`
+	Metric          string `yaml:"metric"`
+	Server          string `yaml:"server"`
+	Op              string `yaml:"op"`
+	Threshold       string `yaml:"threshold"`
+	ForMinutes      int    `yaml:"for_minutes"`
+	WindowMinutes   int    `yaml:"window_minutes"`
+	CooldownMinutes int    `yaml:"cooldown_minutes"`
+	Severity        string `yaml:"severity"`
+}
+
+// ThresholdValue parses the threshold, a number or a size like "5G"
+func (r AlertRule) ThresholdValue() (float64, error) {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(r.Threshold), 64); err == nil {
+		return value, nil
+	}
+	size, err := ParseMemory(r.Threshold)
+	if err != nil {
+		return 0, fmt.Errorf("threshold: %q is neither a number nor a size", r.Threshold)
+	}
+	return float64(size), nil
+}
+
+// alertOps are the comparisons supported by alert rules
+var alertOps = []string{">", ">=", "<", "<=", "==", "!="}
+
+func (r AlertRule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name: is required")
+	}
+	if r.Metric == "" {
+		return fmt.Errorf("metric: is required")
+	}
+	valid := false
+	for _, op := range alertOps {
+		valid = valid || r.Op == op
+	}
+	if !valid {
+		return fmt.Errorf("op: invalid value %q (must be one of %s)", r.Op, strings.Join(alertOps, " "))
+	}
+	if _, err := r.ThresholdValue(); err != nil {
+		return err
+	}
+	if r.ForMinutes < 0 || r.WindowMinutes < 0 || r.CooldownMinutes < 0 {
+		return fmt.Errorf("durations must not be negative")
+	}
+	return nil
 }
 
 type MinecraftServerConfig struct {
@@ -59,10 +1391,257 @@ type MinecraftServerConfig struct {
 	MaxThreads                   int               `yaml:"max_threads"`
 	PlayerIdleTimeout            int               `yaml:"player_idle_timeout"`
 	MaxWorldSize                 int               `yaml:"max_world_size"`
+	WorldTemplate                string            `yaml:"world_template"`
+	ResetPolicy                  ResetPolicy       `yaml:"reset_policy"`
+	Experiments                  *Experiments      `yaml:"experiments"`
+	ScriptPack                   *ScriptPack       `yaml:"script_pack"`
+	BehaviorPacks                []ScriptPack      `yaml:"behavior_packs"`
+	Preset                       string            `yaml:"preset"`
+	Group                        string            `yaml:"group"`
+	Priority                     int               `yaml:"priority"`
+	Memory                       string            `yaml:"memory"`
+	CPU                          float64           `yaml:"cpu"`
+	Geo                          GeoPolicy         `yaml:"geo"`
+	Tenant                       string            `yaml:"tenant"`
+
+	// Labels are short key/value pairs, e.g. owner: alice, added to the
+	// server's metrics and notifications and matched by notification
+	// routes. Annotations are free-form notes such as the purpose of the
+	// server, shown in the status and notifications.
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+
+	// Gamerules are set through the console whenever the server starts,
+	// e.g. keepInventory: "true". Schedules change the difficulty and game
+	// rules at certain times without a restart.
+	Gamerules map[string]string  `yaml:"gamerules"`
+	Schedules []PropertySchedule `yaml:"schedules"`
+
+	// MaxUptimeHours restarts a server gracefully once it has been up that
+	// long, working around memory and chunk bugs of long-running Bedrock
+	// servers. The restart waits for MaintenanceWindow when set, a cron
+	// expression matching the minutes restarts may happen in, e.g.
+	// "* 4-5 * * *".
+	MaxUptimeHours    int    `yaml:"max_uptime_hours"`
+	MaintenanceWindow string `yaml:"maintenance_window"`
+
+	// OperatingHours are cron expressions matching the minutes the server
+	// runs in, e.g. "* 18-23 * * 5" and "* * * * 6,0" for Friday 18:00 to
+	// Sunday midnight. Outside of them the server is stopped gracefully
+	// and started again when they begin; without them it always runs.
+	OperatingHours []string `yaml:"operating_hours"`
+
+	// RestartOnCrash starts a crashed server again, unless the crash is
+	// one a restart cannot fix, such as its port being taken
+	RestartOnCrash bool `yaml:"restart_on_crash"`
+
+	// AllowDowngrade lets the server open its world with an older Bedrock
+	// version than it was last opened with, which can corrupt the world.
+	// AllowMajorUpgrade lets it open the world with a newer major version,
+	// such as 1.21 after 1.20, which cannot be undone.
+	AllowDowngrade    bool `yaml:"allow_downgrade"`
+	AllowMajorUpgrade bool `yaml:"allow_major_upgrade"`
+
+	// Standby keeps a copy of the world, synced every StandbySyncMinutes
+	// (default 15), that a crashed server is started on right away
+	Standby            bool `yaml:"standby"`
+	StandbySyncMinutes int  `yaml:"standby_sync_minutes"`
+
+	// Trim removes chunks far from the world spawn while the server is
+	// stopped for its maximum uptime restart
+	Trim *TrimConfig `yaml:"trim"`
+
+	// LogLines is how many console lines the manager keeps for the
+	// server (default 100), from its next start
+	LogLines int `yaml:"log_lines"`
+
+	// Bans shares the manager's bans of the server with its group and
+	// detects bans on its console
+	Bans *BanConfig `yaml:"bans"`
+
+	// Source is the name of the configuration source that defined the
+	// server, set when configurations are merged
+	Source string `yaml:"-"`
+
+	// Channel is the channel Version was resolved from, such as latest
+	Channel string `yaml:"-"`
+}
+
+// GeoPolicy restricts which countries may connect to a server, by ISO
+// 3166-1 alpha-2 code. It is enforced by the proxy and needs a GeoIP
+// database.
+type GeoPolicy struct {
+	AllowCountries []string `yaml:"allow_countries"`
+	DenyCountries  []string `yaml:"deny_countries"`
+}
+
+// ScriptPack points at a behavior pack source directory in the config
+// repository. A manifest is generated when the directory has none.
+type ScriptPack struct {
+	Path         string            `yaml:"path"`
+	Name         string            `yaml:"name"`
+	Version      string            `yaml:"version"`
+	Entry        string            `yaml:"entry"`
+	Dependencies map[string]string `yaml:"dependencies"`
+	// SHA256 pins the checksum of the pack's source files; a pack whose
+	// sources differ is not deployed
+	SHA256 string `yaml:"sha256"`
+}
+
+// HashPackFiles returns the checksum a pack's sha256 pins: the SHA-256 of
+// its source files, keyed by their slash separated path inside the pack
+// directory, in path order with each preceded by its path and length
+func HashPackFiles(files map[string][]byte) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s\x00%d\x00", name, len(files[name]))
+		hash.Write(files[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Experiments are the world experiment toggles stored in level.dat. When
+// set, every flag is enforced on the world; when omitted the world is left
+// untouched.
+type Experiments struct {
+	BetaAPIs                   bool `yaml:"beta_apis"`
+	CustomBiomes               bool `yaml:"custom_biomes"`
+	UpcomingCreatorFeatures    bool `yaml:"upcoming_creator_features"`
+	HolidayCreatorFeatures     bool `yaml:"holiday_creator_features"`
+	ExperimentalMolangFeatures bool `yaml:"experimental_molang_features"`
+	VillagerTradesRebalance    bool `yaml:"villager_trades_rebalance"`
+}
+
+// ResetPolicy controls when a server's world is archived and re-provisioned
+// from its world template.
+type ResetPolicy struct {
+	Cron    string `yaml:"cron"`
+	OnEmpty bool   `yaml:"on_empty"`
+	// KeepArchives is how many archives of reset worlds are kept, the
+	// oldest are removed (default 10)
+	KeepArchives int `yaml:"keep_archives"`
+}
+
+// DefaultKeepArchives is how many archives of reset worlds are kept by
+// default
+const DefaultKeepArchives = 10
+
+// TrimConfig removes the overworld and nether chunks farther than Radius
+// blocks from the world spawn, at most every EveryDays days (default 7)
+type TrimConfig struct {
+	Radius    int `yaml:"radius"`
+	EveryDays int `yaml:"every_days"`
+}
+
+// BanConfig propagates every ban on the server to all servers of its group
+// when Sync is set. ConsolePattern is a regular expression matching console
+// lines that report a ban, e.g. of an addon; its first group is the player
+// and a group named reason the reason.
+type BanConfig struct {
+	Sync           bool   `yaml:"sync"`
+	ConsolePattern string `yaml:"console_pattern"`
+}
+
+// PropertySchedule changes the difficulty and game rules of a running
+// server through its console while Cron matches the current minute, e.g.
+// "* 22-23,0-5 * * *" for nights. When several schedules are active the
+// later one wins; outside of all schedules the server's own difficulty and
+// gamerules apply again. Macro is run with Args each time the schedule
+// becomes active.
+type PropertySchedule struct {
+	Name       string            `yaml:"name"`
+	Cron       string            `yaml:"cron"`
+	Difficulty string            `yaml:"difficulty"`
+	Gamerules  map[string]string `yaml:"gamerules"`
+
+	Macro string            `yaml:"macro"`
+	Args  map[string]string `yaml:"args"`
+}
+
+type WorldTemplate struct {
+	URL    string `yaml:"url"`
+	SHA256 string `yaml:"sha256"`
 }
 
 type RepoConfig struct {
-	Servers []MinecraftServerConfig `yaml:"servers"`
+	Servers         []MinecraftServerConfig      `yaml:"servers"`
+	WorldTemplates  map[string]WorldTemplate     `yaml:"world_templates"`
+	PropertyPresets map[string]map[string]string `yaml:"property_presets"`
+	Rollout         RolloutConfig                `yaml:"rollout"`
+
+	// BedrockChecksums pins the SHA-256 checksums of Bedrock archives by
+	// version
+	BedrockChecksums map[string]string `yaml:"bedrock_checksums"`
+
+	// Lock is the lockfile of the repository at the commit, nil when it
+	// has none
+	Lock *Lockfile `yaml:"-"`
+
+	// Macros are named command sequences run through the API or by
+	// schedules
+	Macros map[string]Macro `yaml:"macros"`
+
+	// mergeProblems are tenant violations found while merging sources,
+	// reported by Validate
+	mergeProblems []string
+}
+
+// RolloutConfig controls how changes that restart several running servers
+// are rolled out. With the canary strategy the canary server is restarted
+// first and the other restarts wait until it has been ready and healthy for
+// the soak period. MaxUnavailable limits how many servers restart at once;
+// each wave waits for the previous one to become ready.
+type RolloutConfig struct {
+	Strategy            string `yaml:"strategy"`
+	Canary              string `yaml:"canary"`
+	SoakMinutes         int    `yaml:"soak_minutes"`
+	ReadyTimeoutMinutes int    `yaml:"ready_timeout_minutes"`
+	MaxUnavailable      int    `yaml:"max_unavailable"`
+}
+
+// Rollout strategies
+const (
+	RolloutAll    = "all"
+	RolloutCanary = "canary"
+)
+
+// ReadyTimeout is how long a restarted server may take to become ready
+func (r RolloutConfig) ReadyTimeout() time.Duration {
+	if r.ReadyTimeoutMinutes <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(r.ReadyTimeoutMinutes) * time.Minute
+}
+
+func (t *TLSConfig) normalize() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be set together")
+	}
+	if t.ClientCAFile != "" && !t.Enabled() {
+		return fmt.Errorf("client_ca_file requires cert_file and key_file")
+	}
+
+	switch t.ClientAuth {
+	case "":
+		t.ClientAuth = ClientAuthNone
+		if t.ClientCAFile != "" {
+			t.ClientAuth = ClientAuthRequire
+		}
+	case ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if t.ClientCAFile == "" {
+			return fmt.Errorf("client_auth %s requires client_ca_file", t.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("client_auth: invalid value %q (must be one of %s, %s, %s)", t.ClientAuth, ClientAuthNone, ClientAuthOptional, ClientAuthRequire)
+	}
+	return nil
 }
 
 // readBranchFile reads the branch from the branch file in the root directory
@@ -107,11 +1686,21 @@ func Load() (*Config, error) {
 	}
 
 	// Set defaults
+	if config.GitHub.Environment != "" {
+		branch, exists := config.GitHub.Environments[config.GitHub.Environment]
+		if !exists {
+			return nil, fmt.Errorf("github.environment: unknown environment %q", config.GitHub.Environment)
+		}
+		config.GitHub.Branch = branch
+	}
 	if branchFromFile != "" {
 		config.GitHub.Branch = branchFromFile
 	} else if config.GitHub.Branch == "" {
 		config.GitHub.Branch = "main"
 	}
+	if config.GitHub.Token == "" {
+		config.GitHub.Token = os.Getenv("GITHUB_TOKEN")
+	}
 
 	if config.GitHub.ConfigPath == "" {
 		config.GitHub.ConfigPath = "servers.yaml"
@@ -119,9 +1708,67 @@ func Load() (*Config, error) {
 	if config.GitHub.PollInterval == 0 {
 		config.GitHub.PollInterval = 60 // 60 seconds
 	}
+	if err := config.GitHub.normalizeSources(); err != nil {
+		return nil, err
+	}
+	if err := config.normalizeProfile(); err != nil {
+		return nil, err
+	}
+	if config.GitHub.Deployments.Enabled {
+		if config.GitHub.Token == "" {
+			return nil, fmt.Errorf("github.deployments: a token is required to create deployments")
+		}
+		if config.GitHub.Deployments.Environment == "" {
+			config.GitHub.Deployments.Environment = config.GitHub.Environment
+		}
+		if config.GitHub.Deployments.Environment == "" {
+			config.GitHub.Deployments.Environment = "production"
+		}
+	}
+	if config.GitHub.Signing.Required && len(config.GitHub.Signing.AllowedKeys) == 0 {
+		return nil, fmt.Errorf("github.signing: allowed_keys is required when signatures are required")
+	}
+	switch config.GitHub.WriteBack {
+	case "", WriteBackCommit, WriteBackPullRequest:
+	default:
+		return nil, fmt.Errorf("github.write_back: must be %s or %s", WriteBackCommit, WriteBackPullRequest)
+	}
+	for _, source := range config.GitHub.Sources {
+		if source.Path == "" {
+			continue
+		}
+		// Local directories have no signed commits, deployments or pull
+		// requests
+		if config.GitHub.Signing.Required {
+			return nil, fmt.Errorf("github.signing: source %s is a local directory", source.Name)
+		}
+		if config.GitHub.Deployments.Enabled {
+			return nil, fmt.Errorf("github.deployments: source %s is a local directory", source.Name)
+		}
+		if config.GitHub.WriteBack == WriteBackPullRequest {
+			return nil, fmt.Errorf("github.write_back: source %s is a local directory, which takes no pull requests", source.Name)
+		}
+	}
 	if config.HTTP.Port == 0 {
 		config.HTTP.Port = 8080
 	}
+	if err := config.HTTP.TLS.normalize(); err != nil {
+		return nil, fmt.Errorf("http.tls: %w", err)
+	}
+	if err := config.HTTP.Auth.normalize(); err != nil {
+		return nil, fmt.Errorf("http.auth: %w", err)
+	}
+	if config.HTTP.Pprof && len(config.HTTP.Auth.Tokens) == 0 && config.HTTP.Auth.OIDC == nil {
+		return nil, fmt.Errorf("http.pprof: requires http.auth tokens or oidc")
+	}
+	for _, origin := range config.HTTP.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("http.allowed_origins: invalid origin %q (must be scheme://host[:port])", origin)
+		}
+	}
+	if limits := &config.HTTP.RateLimit; limits.RequestsPerSecond > 0 && limits.Burst == 0 {
+		limits.Burst = max(int(limits.RequestsPerSecond), 1)
+	}
 	if config.Server.BaseDir == "" {
 		config.Server.BaseDir = "./servers"
 	}
@@ -134,6 +1781,323 @@ func Load() (*Config, error) {
 	if config.Server.MemoryLimit == "" {
 		config.Server.MemoryLimit = "1G"
 	}
+	if config.Server.MaxImportMB == 0 {
+		config.Server.MaxImportMB = 1024
+	}
+	if config.Server.CacheDir == "" {
+		config.Server.CacheDir = "./cache"
+	}
+	if config.Server.DataDir == "" {
+		config.Server.DataDir = "./data"
+	}
+	if config.Server.ApplyHistory == 0 {
+		config.Server.ApplyHistory = 20
+	}
+	if config.Server.ShutdownTimeout == 0 {
+		config.Server.ShutdownTimeout = 30
+	}
+	if config.Server.Orphans == "" {
+		config.Server.Orphans = OrphansTerminate
+	}
+	if orphans := []string{OrphansTerminate, OrphansAdopt, OrphansIgnore}; !slices.Contains(orphans, config.Server.Orphans) {
+		return nil, fmt.Errorf("server.orphans: invalid value %q (must be one of %s)", config.Server.Orphans, strings.Join(orphans, ", "))
+	}
+	if config.Server.RestartBudget < 0 {
+		return nil, fmt.Errorf("server.restart_budget: must not be negative")
+	}
+	if config.Server.Budget.Memory != "" {
+		if _, err := ParseMemory(config.Server.Budget.Memory); err != nil {
+			return nil, fmt.Errorf("invalid server.budget.memory: %w", err)
+		}
+	}
+	if _, err := ParseMemory(config.Server.MemoryLimit); err != nil {
+		return nil, fmt.Errorf("invalid server.memory_limit: %w", err)
+	}
+
+	for name, quota := range config.Tenants {
+		if quota.MaxInstances < 0 {
+			return nil, fmt.Errorf("tenants.%s.max_instances: must not be negative", name)
+		}
+		if _, err := ParseMemory(quota.Memory); quota.Memory != "" && err != nil {
+			return nil, fmt.Errorf("tenants.%s.memory: %w", name, err)
+		}
+		if _, err := ParseMemory(quota.Disk); quota.Disk != "" && err != nil {
+			return nil, fmt.Errorf("tenants.%s.disk: %w", name, err)
+		}
+	}
+	for _, source := range config.GitHub.Sources {
+		if _, exists := config.Tenants[source.Tenant]; source.Tenant != "" && !exists {
+			return nil, fmt.Errorf("github.sources: %s: unknown tenant %q", source.Name, source.Tenant)
+		}
+	}
+	for _, webhook := range config.Notifications.Webhooks {
+		if _, exists := config.Tenants[webhook.Tenant]; webhook.Tenant != "" && !exists {
+			return nil, fmt.Errorf("notifications.webhooks: %s: unknown tenant %q", webhook.Name, webhook.Tenant)
+		}
+	}
+	for _, token := range config.HTTP.Auth.Tokens {
+		if _, exists := config.Tenants[token.Tenant]; token.Tenant != "" && !exists {
+			return nil, fmt.Errorf("http.auth: token %s: unknown tenant %q", token.Name, token.Tenant)
+		}
+	}
+	if oidc := config.HTTP.Auth.OIDC; oidc != nil {
+		for _, role := range oidc.Roles {
+			if _, exists := config.Tenants[role.Tenant]; role.Tenant != "" && !exists {
+				return nil, fmt.Errorf("http.auth: oidc: role %s: unknown tenant %q", role.Group, role.Tenant)
+			}
+		}
+	}
+
+	if config.Usage.RetentionMonths == 0 {
+		config.Usage.RetentionMonths = 24
+	}
+	if email := &config.Usage.Email; email.Enabled() {
+		if err := email.SMTP.normalize(); err != nil {
+			return nil, fmt.Errorf("usage.email.smtp: %w", err)
+		}
+		for tenant := range email.Tenants {
+			if _, exists := config.Tenants[tenant]; !exists {
+				return nil, fmt.Errorf("usage.email.tenants: unknown tenant %q", tenant)
+			}
+		}
+	}
+
+	hookNames := make(map[string]bool)
+	for i := range config.Hooks {
+		hook := &config.Hooks[i]
+		if err := hook.normalize(); err != nil {
+			return nil, fmt.Errorf("hooks[%d] (%s): %w", i, hook.Name, err)
+		}
+		if hookNames[hook.Name] {
+			return nil, fmt.Errorf("hooks[%d]: duplicate name %q", i, hook.Name)
+		}
+		hookNames[hook.Name] = true
+		if _, exists := config.Tenants[hook.Tenant]; hook.Tenant != "" && !exists {
+			return nil, fmt.Errorf("hooks: %s: unknown tenant %q", hook.Name, hook.Tenant)
+		}
+	}
+
+	if config.Proxy.PortOffset == 0 {
+		config.Proxy.PortOffset = 10000
+	}
+	if config.Proxy.SessionTimeout == 0 {
+		config.Proxy.SessionTimeout = 60
+	}
+	if config.Proxy.MaxSessions == 0 {
+		config.Proxy.MaxSessions = 1024
+	}
+	if config.Proxy.Queue.Size == 0 {
+		config.Proxy.Queue.Size = 50
+	}
+	if config.Proxy.Queue.Hold == 0 {
+		config.Proxy.Queue.Hold = 60
+	}
+	for _, entry := range config.Proxy.Blocklist {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return nil, fmt.Errorf("proxy.blocklist: invalid address or CIDR range %q", entry)
+			}
+		}
+	}
+	if limits := &config.Proxy.RateLimit; limits.PacketsPerSecond > 0 && limits.Burst == 0 {
+		limits.Burst = max(int(limits.PacketsPerSecond), 1)
+	}
+
+	if config.Log.Level == "" {
+		config.Log.Level = "info"
+	}
+	if config.Log.Format == "" {
+		config.Log.Format = LogFormatText
+	}
+	if config.Log.Outputs == nil {
+		config.Log.Outputs = []string{LogOutputStderr}
+	}
+	if config.Log.File.MaxSizeMB == 0 {
+		config.Log.File.MaxSizeMB = 100
+	}
+	if config.Log.File.MaxBackups == 0 {
+		config.Log.File.MaxBackups = 5
+	}
+	if err := config.Log.Validate(); err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	switch config.Metrics.Exporter {
+	case "":
+		config.Metrics.Exporter = ExporterPrometheus
+	case ExporterPrometheus, ExporterStatsD, ExporterNone:
+	default:
+		return nil, fmt.Errorf("metrics.exporter: invalid value %q (must be one of %s, %s, %s)",
+			config.Metrics.Exporter, ExporterPrometheus, ExporterStatsD, ExporterNone)
+	}
+	if config.Metrics.StatsD.Address == "" {
+		config.Metrics.StatsD.Address = "127.0.0.1:8125"
+	}
+	if config.Metrics.StatsD.Prefix == "" {
+		config.Metrics.StatsD.Prefix = "party"
+	}
+	if config.Metrics.StatsD.Interval == 0 {
+		config.Metrics.StatsD.Interval = 10
+	}
+
+	for i, webhook := range config.Notifications.Webhooks {
+		if webhook.URL == "" {
+			return nil, fmt.Errorf("notifications.webhooks[%d].url: is required", i)
+		}
+		if err := webhook.Templates.validate(); err != nil {
+			return nil, fmt.Errorf("notifications.webhooks[%d] (%s): %w", i, webhook.Name, err)
+		}
+	}
+	if err := config.Notifications.Templates.validate(); err != nil {
+		return nil, fmt.Errorf("notifications: %w", err)
+	}
+	if config.Notifications.Cooldown < 0 {
+		return nil, fmt.Errorf("notifications.cooldown: must not be negative")
+	}
+	if quiet := config.Notifications.QuietHours; quiet != nil {
+		if err := quiet.normalize(); err != nil {
+			return nil, fmt.Errorf("notifications.quiet_hours: %w", err)
+		}
+	}
+	if email := config.Notifications.Email; email != nil {
+		if err := email.normalize(); err != nil {
+			return nil, fmt.Errorf("notifications.email: %w", err)
+		}
+		for _, recipient := range email.Recipients {
+			if _, exists := config.Tenants[recipient.Tenant]; recipient.Tenant != "" && !exists {
+				return nil, fmt.Errorf("notifications.email: %s: unknown tenant %q", recipient.Address, recipient.Tenant)
+			}
+		}
+	}
+	if err := config.Announcements.normalize(); err != nil {
+		return nil, fmt.Errorf("announcements: %w", err)
+	}
+	if config.Telegram != nil {
+		if err := config.Telegram.normalize(); err != nil {
+			return nil, fmt.Errorf("telegram: %w", err)
+		}
+	}
+	if config.Alerts.Interval == 0 {
+		config.Alerts.Interval = 60
+	}
+	for i := range config.Alerts.Rules {
+		rule := &config.Alerts.Rules[i]
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("alerts.rules[%d] (%s): %w", i, rule.Name, err)
+		}
+		if rule.Severity == "" {
+			rule.Severity = "warning"
+		}
+	}
+	if err := config.Alerts.Incidents.normalize(); err != nil {
+		return nil, fmt.Errorf("alerts.incidents: %w", err)
+	}
+
+	for _, check := range config.Preflight.Skip {
+		if !slices.Contains(PreflightChecks, check) {
+			return nil, fmt.Errorf("preflight.skip: unknown check %q (must be one of %s)", check, strings.Join(PreflightChecks, ", "))
+		}
+	}
+
+	if err := config.Egress.validate(); err != nil {
+		return nil, fmt.Errorf("egress: %w", err)
+	}
+	if err := config.Mirror.validate(); err != nil {
+		return nil, fmt.Errorf("mirror: %w", err)
+	}
+	if err := config.Verification.validate(); err != nil {
+		return nil, fmt.Errorf("verification: %w", err)
+	}
+	if config.Server.Versions.URL == "" {
+		config.Server.Versions.URL = DefaultVersionsURL
+	}
+	if config.Server.Versions.ChannelsURL == "" {
+		config.Server.Versions.ChannelsURL = DefaultChannelsURL
+	}
+	if config.Lockfile.Commit && config.GitHub.WriteBack == "" {
+		return nil, fmt.Errorf("lockfile.commit: requires github.write_back")
+	}
+	if config.Lockfile.Path == "" {
+		config.Lockfile.Path = "party.lock"
+	}
+	if config.Lockfile.Source == "" {
+		config.Lockfile.Source = config.GitHub.Sources[0].Name
+	} else if !slices.ContainsFunc(config.GitHub.Sources, func(source ConfigSource) bool { return source.Name == config.Lockfile.Source }) {
+		return nil, fmt.Errorf("lockfile.source: unknown source %q", config.Lockfile.Source)
+	}
+
+	if config.GC.Interval == 0 {
+		config.GC.Interval = 24
+	}
+	if hibernate := &config.Hibernate; hibernate.Enabled {
+		if hibernate.IdleMinutes < 0 || hibernate.MinOffMinutes < 0 {
+			return nil, fmt.Errorf("hibernate: idle_minutes and min_off_minutes must not be negative")
+		}
+		if hibernate.IdleMinutes == 0 {
+			hibernate.IdleMinutes = 10
+		}
+		if hibernate.MinOffMinutes == 0 {
+			hibernate.MinOffMinutes = 60
+		}
+		hooked := slices.ContainsFunc(config.Hooks, func(hook HookConfig) bool {
+			return slices.Contains(hook.Events, HookHostHibernate)
+		})
+		if len(hibernate.Command) == 0 && !hooked {
+			return nil, fmt.Errorf("hibernate: needs a command or a hook for %s", HookHostHibernate)
+		}
+	}
+	if config.Drift.Interval == 0 {
+		config.Drift.Interval = 15
+	}
+	staleness := &config.Staleness
+	if staleness.WarnMinutes < 0 || staleness.SafeModeHours < 0 {
+		return nil, fmt.Errorf("staleness: warn_minutes and safe_mode_hours must not be negative")
+	}
+	if staleness.WarnMinutes == 0 {
+		staleness.WarnMinutes = 30
+	}
+	if staleness.WarnMinutes*60 <= config.GitHub.PollInterval {
+		// Every wait for the next poll would count as stale
+		return nil, fmt.Errorf("staleness.warn_minutes: %d minutes must be longer than github.poll_interval (%d seconds)", staleness.WarnMinutes, config.GitHub.PollInterval)
+	}
+	if staleness.Policy == "" {
+		staleness.Policy = StalenessKeep
+	}
+	if policies := []string{StalenessKeep, StalenessSafeMode}; !slices.Contains(policies, staleness.Policy) {
+		return nil, fmt.Errorf("staleness.policy: invalid value %q (must be one of %s)", staleness.Policy, strings.Join(policies, ", "))
+	}
+	if staleness.SafeModeHours == 0 {
+		staleness.SafeModeHours = 6
+	}
+	if config.GC.GracePeriod == 0 {
+		config.GC.GracePeriod = 7 * 24
+	}
+
+	if config.Backups.Backend == "" {
+		config.Backups.Backend = BackupAuto
+	}
+	if backends := []string{BackupAuto, BackupCopy, BackupBtrfs, BackupZFS}; !slices.Contains(backends, config.Backups.Backend) {
+		return nil, fmt.Errorf("backups.backend: invalid value %q (must be one of %s)", config.Backups.Backend, strings.Join(backends, ", "))
+	}
+	if config.Backups.Cron != "" {
+		if _, err := schedule.ParseCron(config.Backups.Cron); err != nil {
+			return nil, fmt.Errorf("backups.cron: %w", err)
+		}
+	}
+	if config.Backups.Keep == 0 {
+		config.Backups.Keep = 10
+	}
+	if config.Backups.MaxMBPerSecond < 0 {
+		return nil, fmt.Errorf("backups.max_mb_per_second: must not be negative")
+	}
+	if deferral := config.Backups.Defer; deferral != nil {
+		if deferral.Players < 0 || deferral.MaxMinutes < 0 {
+			return nil, fmt.Errorf("backups.defer: players and max_minutes must not be negative")
+		}
+		if deferral.MaxMinutes == 0 {
+			deferral.MaxMinutes = 120
+		}
+	}
 
 	return &config, nil
 }
@@ -153,3 +2117,116 @@ func (c *Config) GetPermissionsPath(serverName string) string {
 func (c *Config) GetWhitelistPath(serverName string) string {
 	return filepath.Join(c.GetServerDir(serverName), "whitelist.json")
 }
+
+func (c *Config) GetWorldDir(serverName, worldName string) string {
+	return filepath.Join(c.GetServerDir(serverName), "worlds", worldName)
+}
+
+// Packs returns all behavior packs of a server in configuration order, the
+// script pack first.
+func (c *MinecraftServerConfig) Packs() []ScriptPack {
+	var packs []ScriptPack
+	if c.ScriptPack != nil {
+		packs = append(packs, *c.ScriptPack)
+	}
+	return append(packs, c.BehaviorPacks...)
+}
+
+// ParseMemory parses sizes like "512M", "2G" or "1.5GiB" into bytes
+func ParseMemory(size string) (int64, error) {
+	value := strings.TrimSpace(strings.ToUpper(size))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'K':
+			multiplier = 1 << 10
+		case 'M':
+			multiplier = 1 << 20
+		case 'G':
+			multiplier = 1 << 30
+		case 'T':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			value = value[:n-1]
+		}
+	}
+
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid memory size %q", size)
+	}
+	return int64(amount * float64(multiplier)), nil
+}
+
+// normalizeProfile checks the profile. The offline profile needs local
+// configuration sources and turns off what needs GitHub: deployments and
+// the preflight checks of the token and the clock.
+func (c *Config) normalizeProfile() error {
+	switch c.Profile {
+	case "":
+		c.Profile = ProfileOnline
+	case ProfileOnline:
+	case ProfileOffline:
+		for i, source := range c.GitHub.Sources {
+			if source.Path == "" {
+				return fmt.Errorf("profile offline: github.sources[%d] (%s): a local path is required", i, source.Name)
+			}
+		}
+		c.GitHub.Deployments.Enabled = false
+		for _, check := range []string{CheckGitHubToken, CheckClock} {
+			if !slices.Contains(c.Preflight.Skip, check) {
+				c.Preflight.Skip = append(c.Preflight.Skip, check)
+			}
+		}
+	default:
+		return fmt.Errorf("profile: invalid value %q (must be %s or %s)", c.Profile, ProfileOnline, ProfileOffline)
+	}
+	return nil
+}
+
+// normalizeSources fills in source defaults from the top-level settings and
+// turns a single-repository configuration into a one-element source list
+func (g *GitHubConfig) normalizeSources() error {
+	if len(g.Sources) == 0 {
+		g.Sources = []ConfigSource{{Name: "default"}}
+	}
+
+	names := make(map[string]bool)
+	for i := range g.Sources {
+		source := &g.Sources[i]
+		if source.RepoOwner == "" {
+			source.RepoOwner = g.RepoOwner
+		}
+		if source.RepoName == "" {
+			source.RepoName = g.RepoName
+		}
+		if source.Branch == "" {
+			source.Branch = g.Branch
+		}
+		if source.ConfigPath == "" {
+			source.ConfigPath = g.ConfigPath
+		}
+		if source.Path == "" && source.RepoOwner == "" && source.RepoName == "" {
+			source.Path = g.Path
+		}
+		if source.Name == "" {
+			source.Name = source.RepoOwner + "/" + source.RepoName + "/" + source.ConfigPath
+			if source.Path != "" {
+				source.Name = filepath.Join(source.Path, source.ConfigPath)
+			}
+		}
+
+		if source.Path == "" && (source.RepoOwner == "" || source.RepoName == "") {
+			return fmt.Errorf("github.sources[%d]: repo_owner and repo_name, or a local path, are required", i)
+		}
+		if names[source.Name] {
+			return fmt.Errorf("github.sources[%d]: duplicate source name %q", i, source.Name)
+		}
+		names[source.Name] = true
+	}
+
+	return nil
+}
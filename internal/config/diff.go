@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Change kinds reported by DiffRepoConfigs
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// FieldChange is one configuration field that differs, identified by its
+// YAML key
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// EntryDiff describes how one named entry (a server, world template or
+// property preset) differs between two configurations
+type EntryDiff struct {
+	Name   string        `json:"name"`
+	Change string        `json:"change"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// RepoConfigDiff lists the differences between two configurations
+type RepoConfigDiff struct {
+	Servers         []EntryDiff `json:"servers,omitempty"`
+	WorldTemplates  []EntryDiff `json:"world_templates,omitempty"`
+	PropertyPresets []EntryDiff `json:"property_presets,omitempty"`
+	Macros          []EntryDiff `json:"macros,omitempty"`
+}
+
+// DiffRepoConfigs compares two configurations field by field. A nil old
+// configuration reports everything in new as added.
+func DiffRepoConfigs(old, new *RepoConfig) *RepoConfigDiff {
+	if old == nil {
+		old = &RepoConfig{}
+	}
+	if new == nil {
+		new = &RepoConfig{}
+	}
+
+	oldServers := make(map[string]interface{})
+	for _, server := range old.Servers {
+		oldServers[server.Name] = server
+	}
+	newServers := make(map[string]interface{})
+	for _, server := range new.Servers {
+		newServers[server.Name] = server
+	}
+
+	return &RepoConfigDiff{
+		Servers:         diffEntries(oldServers, newServers),
+		WorldTemplates:  diffEntries(toInterfaceMap(old.WorldTemplates), toInterfaceMap(new.WorldTemplates)),
+		PropertyPresets: diffEntries(toInterfaceMap(old.PropertyPresets), toInterfaceMap(new.PropertyPresets)),
+		Macros:          diffEntries(toInterfaceMap(old.Macros), toInterfaceMap(new.Macros)),
+	}
+}
+
+// Empty reports whether the configurations are identical
+func (d *RepoConfigDiff) Empty() bool {
+	return len(d.Servers) == 0 && len(d.WorldTemplates) == 0 && len(d.PropertyPresets) == 0 && len(d.Macros) == 0
+}
+
+func diffEntries(old, new map[string]interface{}) []EntryDiff {
+	var diffs []EntryDiff
+
+	for _, name := range sortedKeys(old) {
+		if _, exists := new[name]; !exists {
+			diffs = append(diffs, EntryDiff{Name: name, Change: ChangeRemoved})
+		}
+	}
+
+	for _, name := range sortedKeys(new) {
+		oldEntry, exists := old[name]
+		if !exists {
+			diffs = append(diffs, EntryDiff{Name: name, Change: ChangeAdded})
+			continue
+		}
+		if fields := diffFields(oldEntry, new[name]); len(fields) > 0 {
+			diffs = append(diffs, EntryDiff{Name: name, Change: ChangeChanged, Fields: fields})
+		}
+	}
+
+	return diffs
+}
+
+// diffFields compares two values by their YAML representation, so fields
+// are reported under the keys used in the configuration file
+func diffFields(old, new interface{}) []FieldChange {
+	oldFields := yamlFields(old)
+	newFields := yamlFields(new)
+
+	keys := make(map[string]bool)
+	for key := range oldFields {
+		keys[key] = true
+	}
+	for key := range newFields {
+		keys[key] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var changes []FieldChange
+	for _, key := range sorted {
+		if !reflect.DeepEqual(oldFields[key], newFields[key]) {
+			changes = append(changes, FieldChange{Field: key, Old: oldFields[key], New: newFields[key]})
+		}
+	}
+	return changes
+}
+
+func yamlFields(value interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		// Not a mapping, compare as a whole
+		return map[string]interface{}{"value": fmt.Sprint(value)}
+	}
+	return fields
+}
+
+func toInterfaceMap[V any](m map[string]V) map[string]interface{} {
+	result := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		result[key] = value
+	}
+	return result
+}
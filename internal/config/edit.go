@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServerEdit changes the allowlist or the player limit of a server entry
+type ServerEdit struct {
+	WhitelistAdd    []string `json:"whitelist_add,omitempty"`
+	WhitelistRemove []string `json:"whitelist_remove,omitempty"`
+	MaxPlayers      *int     `json:"max_players,omitempty"`
+}
+
+// Apply makes the changes to a server's configuration
+func (e ServerEdit) Apply(server *MinecraftServerConfig) {
+	server.Whitelist = slices.DeleteFunc(slices.Clone(server.Whitelist), func(player string) bool {
+		return containsFold(e.WhitelistRemove, player)
+	})
+	for _, player := range e.WhitelistAdd {
+		if !containsFold(server.Whitelist, player) {
+			server.Whitelist = append(server.Whitelist, player)
+		}
+	}
+	if e.MaxPlayers != nil {
+		server.MaxPlayers = *e.MaxPlayers
+	}
+}
+
+// Describe summarizes the changes, e.g. for a commit message
+func (e ServerEdit) Describe() string {
+	var changes []string
+	if len(e.WhitelistAdd) > 0 {
+		changes = append(changes, "allow "+strings.Join(e.WhitelistAdd, ", "))
+	}
+	if len(e.WhitelistRemove) > 0 {
+		changes = append(changes, "disallow "+strings.Join(e.WhitelistRemove, ", "))
+	}
+	if e.MaxPlayers != nil {
+		changes = append(changes, fmt.Sprintf("max_players %d", *e.MaxPlayers))
+	}
+	return strings.Join(changes, "; ")
+}
+
+// EditServer makes the changes of edit to the entry of a server in a
+// configuration file. The rest of the file, including its comments, is
+// kept.
+func EditServer(content []byte, name string, edit ServerEdit) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+	}
+	var entry *yaml.Node
+	if document.Kind == yaml.DocumentNode {
+		if list := mappingValue(document.Content[0], "servers"); list != nil && list.Kind == yaml.SequenceNode {
+			for _, item := range list.Content {
+				if value := mappingValue(item, "name"); value != nil && value.Value == name {
+					entry = item
+					break
+				}
+			}
+		}
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("server %s is not defined in the config file", name)
+	}
+
+	if len(edit.WhitelistAdd) > 0 || len(edit.WhitelistRemove) > 0 {
+		whitelist := mappingValue(entry, "whitelist")
+		if whitelist == nil || whitelist.Kind == yaml.ScalarNode && whitelist.Tag == "!!null" {
+			whitelist = setMappingValue(entry, "whitelist", &yaml.Node{Kind: yaml.SequenceNode})
+		}
+		if whitelist.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("server %s: whitelist is not a list", name)
+		}
+		whitelist.Content = slices.DeleteFunc(whitelist.Content, func(item *yaml.Node) bool {
+			return containsFold(edit.WhitelistRemove, item.Value)
+		})
+		for _, player := range edit.WhitelistAdd {
+			if !slices.ContainsFunc(whitelist.Content, func(item *yaml.Node) bool { return strings.EqualFold(item.Value, player) }) {
+				whitelist.Content = append(whitelist.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: player})
+			}
+		}
+	}
+	if edit.MaxPlayers != nil {
+		setMappingValue(entry, "max_players", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(*edit.MaxPlayers)})
+	}
+	return encodeNode(&document)
+}
+
+// mappingValue returns the value of a key of a mapping node, nil when the
+// key is not set
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets the value of a key of a mapping node, keeping the
+// comments of a value it replaces
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			value.LineComment = node.Content[i+1].LineComment
+			node.Content[i+1] = value
+			return value
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+func containsFold(list []string, value string) bool {
+	return slices.ContainsFunc(list, func(item string) bool { return strings.EqualFold(item, value) })
+}
+
+// MarshalServers writes server entries as the servers list of a
+// configuration file, leaving out fields that are not set
+func MarshalServers(servers []MinecraftServerConfig) ([]byte, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, server := range servers {
+		node, err := serverNode(server)
+		if err != nil {
+			return nil, err
+		}
+		list.Content = append(list.Content, node)
+	}
+	root := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "servers"}, list,
+	}}
+	return encodeNode(root)
+}
+
+// AppendServers adds server entries to the servers list of a configuration
+// file. The rest of the file, including its comments, is kept.
+func AppendServers(content []byte, servers []MinecraftServerConfig) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+	}
+	if document.Kind == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("config file is not a mapping")
+	}
+
+	list := mappingValue(root, "servers")
+	if list == nil {
+		list = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "servers"}, list)
+	}
+	if list.Kind == yaml.ScalarNode && list.Tag == "!!null" {
+		// "servers:" without entries
+		*list = yaml.Node{Kind: yaml.SequenceNode}
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, errors.New("servers is not a list")
+	}
+	// Flow style lists such as "servers: []" become block lists
+	list.Style = 0
+
+	for _, server := range servers {
+		node, err := serverNode(server)
+		if err != nil {
+			return nil, err
+		}
+		list.Content = append(list.Content, node)
+	}
+	return encodeNode(&document)
+}
+
+// serverNode encodes a server entry without the fields that are not set,
+// as they would be written by hand
+func serverNode(server MinecraftServerConfig) (*yaml.Node, error) {
+	var node yaml.Node
+	if err := node.Encode(server); err != nil {
+		return nil, fmt.Errorf("failed to encode server %s: %w", server.Name, err)
+	}
+	pruneNode(&node)
+	return &node, nil
+}
+
+// pruneNode removes the keys of a mapping whose values are empty, and
+// reports whether the node itself is empty
+func pruneNode(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.MappingNode:
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !pruneNode(node.Content[i+1]) {
+				content = append(content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node.Content = content
+		return len(content) == 0
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			pruneNode(item)
+		}
+		return len(node.Content) == 0
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			return true
+		case "!!str":
+			return node.Value == ""
+		case "!!int", "!!float":
+			return node.Value == "0"
+		case "!!bool":
+			return node.Value == "false"
+		}
+	}
+	return false
+}
+
+func encodeNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Lockfile records what an apply resolved the configuration to: the
+// Bedrock build of every server, including those on a channel, the
+// versions of their packs and the checksums of all artifacts. It holds no
+// commit or time, so applies that resolve the same produce the same file.
+type Lockfile struct {
+	// Bedrock are the archives of the Bedrock builds by version
+	Bedrock        map[string]LockedArtifact `json:"bedrock,omitempty"`
+	Servers        map[string]LockedServer   `json:"servers"`
+	WorldTemplates map[string]LockedArtifact `json:"world_templates,omitempty"`
+}
+
+// LockedServer is the resolved configuration of one server. Version is the
+// build it runs and Channel the channel it was resolved from, if any.
+type LockedServer struct {
+	Version       string       `json:"version,omitempty"`
+	Channel       string       `json:"channel,omitempty"`
+	WorldTemplate string       `json:"world_template,omitempty"`
+	Packs         []LockedPack `json:"packs,omitempty"`
+}
+
+// LockedPack is a deployed behavior pack with the version and UUID of its
+// manifest and the checksum of its source files
+type LockedPack struct {
+	Path    string `json:"path"`
+	UUID    string `json:"uuid"`
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+}
+
+// LockedArtifact is a downloaded archive
+type LockedArtifact struct {
+	URL    string `json:"url,omitempty"`
+	SHA256 string `json:"sha256"`
+}
+
+// ParseLockfile reads a lockfile
+func ParseLockfile(data []byte) (*Lockfile, error) {
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile: %w", err)
+	}
+	return &lock, nil
+}
+
+// Marshal encodes the lockfile with sorted keys, for stable diffs
+func (l *Lockfile) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// macroArgPattern matches the names of macro arguments, which templates
+// refer to as {{.name}}
+var macroArgPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Macro is a named sequence of console commands, e.g. setting game rules,
+// teleporting players and announcing an event. Commands are templates in
+// which {{.name}} is replaced by the argument of that name and {{.server}}
+// by the server's name. Args declares the arguments with their defaults;
+// arguments with an empty default must be given.
+type Macro struct {
+	Args  map[string]string `yaml:"args"`
+	Steps []MacroStep       `yaml:"steps"`
+}
+
+// MacroStep is a command run DelaySeconds after the previous step
+type MacroStep struct {
+	Command      string `yaml:"command"`
+	DelaySeconds int    `yaml:"delay_seconds"`
+}
+
+// Render returns the commands of the macro for a server with args filled
+// in, in the order of the steps
+func (m Macro) Render(server string, args map[string]string) ([]string, error) {
+	data := map[string]string{"server": server}
+	for name, value := range m.Args {
+		data[name] = value
+	}
+	for name, value := range args {
+		if _, declared := m.Args[name]; !declared {
+			return nil, fmt.Errorf("unknown argument %q", name)
+		}
+		data[name] = value
+	}
+	for _, name := range sortedKeys(m.Args) {
+		if data[name] == "" {
+			return nil, fmt.Errorf("argument %q is required", name)
+		}
+		if strings.ContainsAny(data[name], "\r\n") {
+			return nil, fmt.Errorf("argument %q must not contain line breaks", name)
+		}
+	}
+
+	commands := make([]string, len(m.Steps))
+	for i, step := range m.Steps {
+		tmpl, err := template.New("command").Option("missingkey=error").Parse(step.Command)
+		if err != nil {
+			return nil, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+		var command strings.Builder
+		if err := tmpl.Execute(&command, data); err != nil {
+			return nil, fmt.Errorf("steps[%d]: %w", i, err)
+		}
+		commands[i] = strings.TrimSpace(command.String())
+		if commands[i] == "" || strings.ContainsAny(commands[i], "\r\n") {
+			return nil, fmt.Errorf("steps[%d]: command must be a single non-empty line", i)
+		}
+	}
+	return commands, nil
+}
+
+// checkMacro validates a macro of the repository configuration
+func checkMacro(where string, macro Macro) []string {
+	var problems []string
+	for _, name := range sortedKeys(macro.Args) {
+		if !macroArgPattern.MatchString(name) || name == "server" {
+			problems = append(problems, fmt.Sprintf("%s: args.%s: names contain letters, digits and underscores, and server is reserved", where, name))
+		}
+	}
+	if len(macro.Steps) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: steps: at least one step is required", where))
+	}
+	for i, step := range macro.Steps {
+		if strings.TrimSpace(step.Command) == "" {
+			problems = append(problems, fmt.Sprintf("%s: steps[%d].command: is required", where, i))
+		} else if _, err := template.New("command").Parse(step.Command); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: steps[%d].command: %v", where, i, err))
+		}
+		if step.DelaySeconds < 0 {
+			problems = append(problems, fmt.Sprintf("%s: steps[%d].delay_seconds: must not be negative", where, i))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,91 @@
+package config
+
+import "fmt"
+
+// MergeRepoConfigs combines the configurations of several sources. Sources
+// are applied in order and later ones take precedence: a server with the
+// same name replaces the earlier definition in place, world templates,
+// property presets, macros and Bedrock checksums are overridden by name or
+// version, and the last source
+// with a rollout section defines the rollout. Each server records the
+// source that defined it.
+//
+// tenants maps the names of sources bound to a tenant to that tenant. Their
+// servers are assigned to it, and Validate reports servers they declare for
+// another tenant or that sources of different tenants both define. The
+// fleet-wide sections are shared by every tenant, so Validate reports them
+// in sources bound to a tenant too.
+func MergeRepoConfigs(names []string, tenants map[string]string, configs []*RepoConfig) *RepoConfig {
+	merged := &RepoConfig{
+		WorldTemplates:   make(map[string]WorldTemplate),
+		PropertyPresets:  make(map[string]map[string]string),
+		Macros:           make(map[string]Macro),
+		BedrockChecksums: make(map[string]string),
+	}
+	index := make(map[string]int)
+
+	for i, repoConfig := range configs {
+		tenant := tenants[names[i]]
+		if tenant != "" {
+			merged.mergeProblems = append(merged.mergeProblems, repoConfig.fleetSections(names[i], tenant)...)
+		}
+		for _, server := range repoConfig.Servers {
+			server.Source = names[i]
+			if tenant != "" {
+				if server.Tenant != "" && server.Tenant != tenant {
+					merged.mergeProblems = append(merged.mergeProblems, fmt.Sprintf("server %s: tenant: source %s may only define servers of tenant %s", server.Name, names[i], tenant))
+				}
+				server.Tenant = tenant
+			}
+			if j, exists := index[server.Name]; exists {
+				previous := merged.Servers[j]
+				if (tenant != "" || tenants[previous.Source] != "") && previous.Tenant != server.Tenant {
+					merged.mergeProblems = append(merged.mergeProblems, fmt.Sprintf("server %s: defined by sources %s and %s of different tenants", server.Name, previous.Source, names[i]))
+				}
+				merged.Servers[j] = server
+				continue
+			}
+			index[server.Name] = len(merged.Servers)
+			merged.Servers = append(merged.Servers, server)
+		}
+
+		for name, template := range repoConfig.WorldTemplates {
+			merged.WorldTemplates[name] = template
+		}
+		for name, preset := range repoConfig.PropertyPresets {
+			merged.PropertyPresets[name] = preset
+		}
+		for name, macro := range repoConfig.Macros {
+			merged.Macros[name] = macro
+		}
+		for version, checksum := range repoConfig.BedrockChecksums {
+			merged.BedrockChecksums[version] = checksum
+		}
+		if repoConfig.Rollout != (RolloutConfig{}) {
+			merged.Rollout = repoConfig.Rollout
+		}
+	}
+
+	return merged
+}
+
+// fleetSections reports the fleet-wide sections a source bound to a tenant
+// sets, which would apply to the servers of other tenants
+func (c *RepoConfig) fleetSections(source, tenant string) []string {
+	var problems []string
+	for _, section := range []struct {
+		name string
+		set  bool
+	}{
+		{"world_templates", len(c.WorldTemplates) > 0},
+		{"property_presets", len(c.PropertyPresets) > 0},
+		{"macros", len(c.Macros) > 0},
+		{"bedrock_checksums", len(c.BedrockChecksums) > 0},
+		{"rollout", c.Rollout != (RolloutConfig{})},
+	} {
+		if section.set {
+			problems = append(problems, fmt.Sprintf("%s: source %s of tenant %s may not set fleet-wide settings", section.name, source, tenant))
+		}
+	}
+	return problems
+}
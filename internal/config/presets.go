@@ -0,0 +1,42 @@
+package config
+
+// BuiltinPresets are server.properties presets available without defining
+// them in the repository configuration.
+var BuiltinPresets = map[string]map[string]string{
+	"survival-hard": {
+		"gamemode":                        "survival",
+		"difficulty":                      "hard",
+		"level-type":                      "DEFAULT",
+		"allow-cheats":                    "false",
+		"default-player-permission-level": "member",
+	},
+	"creative-flat": {
+		"gamemode":                        "creative",
+		"difficulty":                      "peaceful",
+		"level-type":                      "FLAT",
+		"allow-cheats":                    "true",
+		"default-player-permission-level": "operator",
+	},
+	"anarchy": {
+		"gamemode":                        "survival",
+		"difficulty":                      "hard",
+		"level-type":                      "DEFAULT",
+		"allow-cheats":                    "false",
+		"allow-list":                      "false",
+		"default-player-permission-level": "member",
+		"server-authoritative-movement":   "server-auth",
+		"correct-player-movement":         "true",
+	},
+}
+
+// Preset returns the properties of a named preset. Presets defined in the
+// repository configuration take precedence over the built-in ones.
+func (rc *RepoConfig) Preset(name string) (map[string]string, bool) {
+	if rc != nil {
+		if preset, exists := rc.PropertyPresets[name]; exists {
+			return preset, true
+		}
+	}
+	preset, exists := BuiltinPresets[name]
+	return preset, exists
+}
@@ -0,0 +1,448 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"minecraft-server-manager/internal/schedule"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	serverNamePattern  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	sha256Pattern      = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	packVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	countryCodePattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+	// Label keys become metric label names
+	labelKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	gameruleNamePattern  = regexp.MustCompile(`^[A-Za-z]+$`)
+	gameruleValuePattern = regexp.MustCompile(`^(true|false|-?\d+)$`)
+
+	motdVariablePattern = regexp.MustCompile(`\{([A-Za-z_]*)\}`)
+)
+
+// maxLogLines bounds log_lines, every line kept costs memory
+const maxLogLines = 100000
+
+// motdVariables are the {variables} a MOTD may contain
+var motdVariables = []string{"name", "players", "max_players", "version", "uptime", "next_restart"}
+
+// ValidationError lists all problems found in a repository configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(e.Problems, "; "))
+}
+
+// enumProperties are the server.properties keys restricted to a fixed set of
+// values, with the allowed values in the order they are reported
+var enumProperties = map[string][]string{
+	"gamemode":                        {"survival", "creative", "adventure"},
+	"difficulty":                      {"peaceful", "easy", "normal", "hard"},
+	"level-type":                      {"DEFAULT", "FLAT", "LEGACY"},
+	"default-player-permission-level": {"visitor", "member", "operator"},
+}
+
+// checkSchedules validates the gamerules and property schedules of a
+// server. Scheduled game rules need a value in gamerules to return to.
+func checkSchedules(where string, server MinecraftServerConfig, macros map[string]Macro) []string {
+	var problems []string
+	base := make(map[string]bool)
+	for _, name := range sortedKeys(server.Gamerules) {
+		problems = append(problems, checkGamerule(fmt.Sprintf("%s: gamerules.%s", where, name), name, server.Gamerules[name])...)
+		base[strings.ToLower(name)] = true
+	}
+
+	for j, sched := range server.Schedules {
+		at := fmt.Sprintf("%s: schedules[%d] (%s)", where, j, sched.Name)
+		if sched.Cron == "" {
+			problems = append(problems, fmt.Sprintf("%s: cron: is required", at))
+		} else if _, err := schedule.ParseCron(sched.Cron); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: cron: %v", at, err))
+		}
+		if sched.Difficulty == "" && len(sched.Gamerules) == 0 && sched.Macro == "" {
+			problems = append(problems, fmt.Sprintf("%s: sets neither difficulty nor gamerules and runs no macro", at))
+		}
+		if sched.Macro != "" {
+			if macro, exists := macros[sched.Macro]; !exists {
+				problems = append(problems, fmt.Sprintf("%s: macro: unknown macro %q", at, sched.Macro))
+			} else if _, err := macro.Render(server.Name, sched.Args); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: macro %s: %v", at, sched.Macro, err))
+			}
+		} else if len(sched.Args) > 0 {
+			problems = append(problems, fmt.Sprintf("%s: args: requires a macro", at))
+		}
+		if problem := checkEnum("difficulty", sched.Difficulty); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s: difficulty: %s", at, problem))
+		}
+		for _, name := range sortedKeys(sched.Gamerules) {
+			problems = append(problems, checkGamerule(fmt.Sprintf("%s: gamerules.%s", at, name), name, sched.Gamerules[name])...)
+			if gameruleNamePattern.MatchString(name) && !base[strings.ToLower(name)] {
+				problems = append(problems, fmt.Sprintf("%s: gamerules.%s: needs a value in the server's gamerules to return to", at, name))
+			}
+		}
+	}
+	return problems
+}
+
+// checkMOTD validates the variables of a MOTD. ';' separates the fields of
+// ping responses, so it cannot appear in a MOTD.
+func checkMOTD(where, motd string) []string {
+	var problems []string
+	if strings.ContainsAny(motd, ";\r\n") {
+		problems = append(problems, fmt.Sprintf("%s: motd: must not contain ';' or line breaks", where))
+	}
+	for _, match := range motdVariablePattern.FindAllStringSubmatch(motd, -1) {
+		if !slices.Contains(motdVariables, match[1]) {
+			problems = append(problems, fmt.Sprintf("%s: motd: unknown variable %s (must be one of {%s})", where, match[0], strings.Join(motdVariables, "}, {")))
+		}
+	}
+	return problems
+}
+
+func checkGamerule(where, name, value string) []string {
+	var problems []string
+	if !gameruleNamePattern.MatchString(name) {
+		problems = append(problems, fmt.Sprintf("%s: game rule names contain only letters", where))
+	}
+	if !gameruleValuePattern.MatchString(value) {
+		problems = append(problems, fmt.Sprintf("%s: %q must be true, false or a whole number", where, value))
+	}
+	return problems
+}
+
+// Validate checks the repository configuration and returns a
+// *ValidationError describing every problem found.
+func (rc *RepoConfig) Validate() error {
+	problems := append([]string(nil), rc.mergeProblems...)
+
+	names := make(map[string]string)
+	ports := make(map[int]string)
+
+	for i, server := range rc.Servers {
+		where := fmt.Sprintf("servers[%d] (%s)", i, server.Name)
+
+		// Names are used as directory names on the host
+		if !serverNamePattern.MatchString(server.Name) {
+			problems = append(problems, fmt.Sprintf("%s: name: must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", where))
+		} else if other, exists := names[strings.ToLower(server.Name)]; exists {
+			problems = append(problems, fmt.Sprintf("%s: name: collides with %s", where, other))
+		} else {
+			names[strings.ToLower(server.Name)] = where
+		}
+
+		if server.Port < 1 || server.Port > 65535 {
+			problems = append(problems, fmt.Sprintf("%s: port: %d is not a valid port", where, server.Port))
+		} else if other, exists := ports[server.Port]; exists {
+			problems = append(problems, fmt.Sprintf("%s: port: %d is already used by %s", where, server.Port, other))
+		} else {
+			ports[server.Port] = where
+		}
+
+		if server.WorldName == "" {
+			problems = append(problems, fmt.Sprintf("%s: world_name: is required", where))
+		} else if strings.ContainsAny(server.WorldName, `/\`) || server.WorldName == "." || server.WorldName == ".." {
+			problems = append(problems, fmt.Sprintf("%s: world_name: must not contain path separators", where))
+		}
+
+		if server.Preset != "" {
+			if _, exists := rc.Preset(server.Preset); !exists {
+				problems = append(problems, fmt.Sprintf("%s: preset: unknown preset %q", where, server.Preset))
+			}
+		}
+
+		if server.WorldTemplate != "" {
+			if _, exists := rc.WorldTemplates[server.WorldTemplate]; !exists {
+				problems = append(problems, fmt.Sprintf("%s: world_template: unknown template %q", where, server.WorldTemplate))
+			}
+		}
+		if server.ResetPolicy.Cron != "" || server.ResetPolicy.OnEmpty {
+			if server.WorldTemplate == "" {
+				problems = append(problems, fmt.Sprintf("%s: reset_policy: requires a world_template", where))
+			}
+			if server.ResetPolicy.Cron != "" {
+				if _, err := schedule.ParseCron(server.ResetPolicy.Cron); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: reset_policy.cron: %v", where, err))
+				}
+			}
+			if server.ResetPolicy.KeepArchives < 0 {
+				problems = append(problems, fmt.Sprintf("%s: reset_policy.keep_archives: must not be negative", where))
+			}
+		}
+
+		if server.Memory != "" {
+			if _, err := ParseMemory(server.Memory); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: memory: %v", where, err))
+			}
+		}
+		if server.CPU < 0 {
+			problems = append(problems, fmt.Sprintf("%s: cpu: must not be negative", where))
+		}
+
+		for _, country := range server.Geo.AllowCountries {
+			if !countryCodePattern.MatchString(country) {
+				problems = append(problems, fmt.Sprintf("%s: geo.allow_countries: %q is not a two-letter country code", where, country))
+			}
+		}
+		for _, country := range server.Geo.DenyCountries {
+			if !countryCodePattern.MatchString(country) {
+				problems = append(problems, fmt.Sprintf("%s: geo.deny_countries: %q is not a two-letter country code", where, country))
+			}
+		}
+
+		for _, key := range sortedKeys(server.Labels) {
+			if !labelKeyPattern.MatchString(key) {
+				problems = append(problems, fmt.Sprintf("%s: labels.%s: keys must start with a letter or '_' and contain only letters, digits and '_'", where, key))
+			}
+		}
+		if _, exists := server.Annotations[""]; exists {
+			problems = append(problems, fmt.Sprintf("%s: annotations: keys must not be empty", where))
+		}
+
+		problems = append(problems, checkSchedules(where, server, rc.Macros)...)
+		if server.MaxUptimeHours < 0 {
+			problems = append(problems, fmt.Sprintf("%s: max_uptime_hours: must not be negative", where))
+		}
+		if server.MaintenanceWindow != "" {
+			if server.MaxUptimeHours == 0 {
+				problems = append(problems, fmt.Sprintf("%s: maintenance_window: requires max_uptime_hours", where))
+			}
+			if _, err := schedule.ParseCron(server.MaintenanceWindow); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: maintenance_window: %v", where, err))
+			}
+		}
+		for j, expr := range server.OperatingHours {
+			if _, err := schedule.ParseCron(expr); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: operating_hours[%d]: %v", where, j, err))
+			}
+		}
+		if server.Trim != nil {
+			if server.Trim.Radius <= 0 {
+				problems = append(problems, fmt.Sprintf("%s: trim.radius: must be positive", where))
+			}
+			if server.Trim.EveryDays < 0 {
+				problems = append(problems, fmt.Sprintf("%s: trim.every_days: must not be negative", where))
+			}
+		}
+		if server.StandbySyncMinutes < 0 {
+			problems = append(problems, fmt.Sprintf("%s: standby_sync_minutes: must not be negative", where))
+		}
+		if server.StandbySyncMinutes > 0 && !server.Standby {
+			problems = append(problems, fmt.Sprintf("%s: standby_sync_minutes: requires standby", where))
+		}
+		if server.LogLines < 0 || server.LogLines > maxLogLines {
+			problems = append(problems, fmt.Sprintf("%s: log_lines: must be between 0 and %d", where, maxLogLines))
+		}
+		if server.Bans != nil {
+			if server.Bans.Sync && server.Group == "" {
+				problems = append(problems, fmt.Sprintf("%s: bans.sync: requires a group", where))
+			}
+			if server.Bans.ConsolePattern != "" {
+				if pattern, err := regexp.Compile(server.Bans.ConsolePattern); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: bans.console_pattern: %v", where, err))
+				} else if pattern.NumSubexp() == 0 {
+					problems = append(problems, fmt.Sprintf("%s: bans.console_pattern: needs a group matching the player", where))
+				}
+			}
+		}
+		problems = append(problems, checkMOTD(where, server.Motd)...)
+
+		for j, pack := range server.Packs() {
+			if pack.Path == "" {
+				problems = append(problems, fmt.Sprintf("%s: packs[%d]: path is required", where, j))
+			} else if clean := path.Clean(pack.Path); clean == "." || clean == "/" || strings.HasPrefix(clean, "..") {
+				problems = append(problems, fmt.Sprintf("%s: packs[%d] (%s): path: must be a directory inside the repository", where, j, pack.Path))
+			}
+			if pack.Version != "" && !packVersionPattern.MatchString(pack.Version) {
+				problems = append(problems, fmt.Sprintf("%s: packs[%d] (%s): version: %q must look like 1.0.0", where, j, pack.Path, pack.Version))
+			}
+			if pack.SHA256 != "" && !sha256Pattern.MatchString(pack.SHA256) {
+				problems = append(problems, fmt.Sprintf("%s: packs[%d] (%s): sha256: must be a hex encoded SHA-256 checksum", where, j, pack.Path))
+			}
+		}
+
+		typed := map[string]string{
+			"gamemode":                        server.Gamemode,
+			"difficulty":                      server.Difficulty,
+			"level-type":                      server.LevelType,
+			"default-player-permission-level": server.DefaultPlayerPermissionLevel,
+		}
+		for _, key := range sortedKeys(typed) {
+			if problem := checkEnum(key, typed[key]); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s: %s: %s", where, yamlFieldName(key), problem))
+			}
+		}
+
+		for _, key := range sortedKeys(server.Properties) {
+			if problem := checkEnum(key, server.Properties[key]); problem != "" {
+				problems = append(problems, fmt.Sprintf("%s: properties.%s: %s", where, key, problem))
+			}
+		}
+	}
+
+	switch rc.Rollout.Strategy {
+	case "", RolloutAll:
+	case RolloutCanary:
+		if rc.Rollout.Canary == "" {
+			problems = append(problems, "rollout.canary: is required for the canary strategy")
+		} else if rc.Server(rc.Rollout.Canary) == nil {
+			problems = append(problems, fmt.Sprintf("rollout.canary: unknown server %q", rc.Rollout.Canary))
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("rollout.strategy: invalid value %q (must be one of %s, %s)", rc.Rollout.Strategy, RolloutAll, RolloutCanary))
+	}
+	if rc.Rollout.SoakMinutes < 0 {
+		problems = append(problems, "rollout.soak_minutes: must not be negative")
+	}
+	if rc.Rollout.MaxUnavailable < 0 {
+		problems = append(problems, "rollout.max_unavailable: must not be negative")
+	}
+	if rc.Rollout.ReadyTimeoutMinutes < 0 {
+		problems = append(problems, "rollout.ready_timeout_minutes: must not be negative")
+	}
+
+	for _, name := range sortedKeys(rc.WorldTemplates) {
+		template := rc.WorldTemplates[name]
+		if template.URL == "" {
+			problems = append(problems, fmt.Sprintf("world_templates.%s.url: is required", name))
+		}
+		if !sha256Pattern.MatchString(template.SHA256) {
+			problems = append(problems, fmt.Sprintf("world_templates.%s.sha256: must be a hex encoded SHA-256 checksum", name))
+		}
+	}
+
+	for _, version := range sortedKeys(rc.BedrockChecksums) {
+		if !sha256Pattern.MatchString(rc.BedrockChecksums[version]) {
+			problems = append(problems, fmt.Sprintf("bedrock_checksums.%s: must be a hex encoded SHA-256 checksum", version))
+		}
+	}
+
+	for _, name := range sortedKeys(rc.PropertyPresets) {
+		preset := rc.PropertyPresets[name]
+		for _, key := range sortedKeys(preset) {
+			if problem := checkEnum(key, preset[key]); problem != "" {
+				problems = append(problems, fmt.Sprintf("property_presets.%s.%s: %s", name, key, problem))
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(rc.Macros) {
+		if !serverNamePattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("macros.%s: names contain letters, digits, '.', '_' and '-'", name))
+		}
+		problems = append(problems, checkMacro("macros."+name, rc.Macros[name])...)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Server returns the configuration of the named server, or nil
+func (rc *RepoConfig) Server(name string) *MinecraftServerConfig {
+	if rc == nil {
+		return nil
+	}
+	for i := range rc.Servers {
+		if rc.Servers[i].Name == name {
+			return &rc.Servers[i]
+		}
+	}
+	return nil
+}
+
+// ParseRepoConfig decodes a repository configuration. In strict mode unknown
+// fields are reported as errors, which catches misspelled keys.
+func ParseRepoConfig(data []byte, strict bool) (*RepoConfig, error) {
+	var repoConfig RepoConfig
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(strict)
+	if err := decoder.Decode(&repoConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+	}
+
+	return &repoConfig, nil
+}
+
+// checkEnum validates the value of an enum property and returns a problem
+// description, or an empty string if the value is valid. Empty values are
+// valid and leave the server default in place.
+func checkEnum(key, value string) string {
+	allowed, isEnum := enumProperties[key]
+	if !isEnum || value == "" {
+		return ""
+	}
+
+	for _, candidate := range allowed {
+		if value == candidate {
+			return ""
+		}
+	}
+
+	problem := fmt.Sprintf("invalid value %q (must be one of %s)", value, strings.Join(allowed, ", "))
+	if suggestion := closestMatch(value, allowed); suggestion != "" {
+		problem += fmt.Sprintf(", did you mean %q?", suggestion)
+	}
+	return problem
+}
+
+// closestMatch returns the allowed value closest to value if it looks like a
+// typo or a case mismatch
+func closestMatch(value string, allowed []string) string {
+	best := ""
+	bestDistance := 3
+	for _, candidate := range allowed {
+		if strings.EqualFold(value, candidate) {
+			return candidate
+		}
+		if d := editDistance(strings.ToLower(value), strings.ToLower(candidate)); d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func yamlFieldName(property string) string {
+	return strings.ReplaceAll(property, "-", "_")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
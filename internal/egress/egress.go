@@ -0,0 +1,135 @@
+// Package egress routes the manager's outbound HTTP requests through the
+// proxies networks such as those of schools and companies require.
+package egress
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// hostMatcher matches the host of a request against one configured host:
+// a name, "*.example.com" or ".example.com" for subdomains, an IP address
+// or a CIDR range
+type hostMatcher struct {
+	name   string
+	suffix string
+	ip     net.IP
+	cidr   *net.IPNet
+}
+
+func newHostMatcher(host string) hostMatcher {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if _, cidr, err := net.ParseCIDR(host); err == nil {
+		return hostMatcher{cidr: cidr}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return hostMatcher{ip: ip}
+	}
+	if suffix, wildcard := strings.CutPrefix(host, "*"); wildcard || strings.HasPrefix(host, ".") {
+		if !wildcard {
+			suffix = host
+		}
+		return hostMatcher{suffix: suffix}
+	}
+	return hostMatcher{name: host}
+}
+
+func (h hostMatcher) matches(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return h.ip != nil && h.ip.Equal(ip) || h.cidr != nil && h.cidr.Contains(ip)
+	}
+	switch {
+	case h.name != "":
+		return host == h.name
+	case h.suffix != "":
+		return strings.HasSuffix(host, h.suffix)
+	}
+	return false
+}
+
+// route sends requests to its hosts through proxy, directly when nil
+type route struct {
+	hosts []hostMatcher
+	proxy *url.URL
+}
+
+func (r route) matches(host string) bool {
+	for _, h := range r.hosts {
+		if h.matches(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Router picks the proxy of each outbound request
+type Router struct {
+	routes []route
+	// fallback is used for hosts no route matches, nil to read the
+	// proxy environment variables
+	fallback func(*http.Request) (*url.URL, error)
+}
+
+// NewRouter creates a router for the egress configuration, which has been
+// validated when it was loaded
+func NewRouter(cfg config.EgressConfig) *Router {
+	r := &Router{fallback: http.ProxyFromEnvironment}
+	for _, destination := range cfg.Destinations {
+		r.routes = append(r.routes, newRoute(destination.Hosts, destination.Proxy))
+	}
+	if cfg.Proxy != "" {
+		r.routes = append(r.routes, newRoute(cfg.NoProxy, config.EgressDirect))
+		proxyURL, _ := url.Parse(cfg.Proxy)
+		r.fallback = http.ProxyURL(proxyURL)
+	}
+	return r
+}
+
+func newRoute(hosts []string, proxy string) route {
+	r := route{}
+	for _, host := range hosts {
+		r.hosts = append(r.hosts, newHostMatcher(host))
+	}
+	if proxy != config.EgressDirect {
+		r.proxy, _ = url.Parse(proxy)
+	}
+	return r
+}
+
+// Proxy returns the proxy of a request, nil to connect directly. It has
+// the signature of http.Transport.Proxy.
+func (r *Router) Proxy(req *http.Request) (*url.URL, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	// Like the environment variables, the proxy never applies to the host
+	// itself
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		return nil, nil
+	}
+	for _, route := range r.routes {
+		if route.matches(host) {
+			return route.proxy, nil
+		}
+	}
+	return r.fallback(req)
+}
+
+// Redact hides the password of a proxy URL for logs
+func Redact(proxy string) string {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return proxy
+	}
+	return proxyURL.Redacted()
+}
+
+// Install routes the requests of every HTTP client using the default
+// transport, which are all clients of the manager, through the router
+func Install(cfg config.EgressConfig) {
+	if transport, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport.Proxy = NewRouter(cfg).Proxy
+	}
+}
@@ -0,0 +1,155 @@
+// Package events broadcasts structured events about the manager's activity
+// to subscribers such as the /events stream of the API.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	ConfigApplied   = "config.applied"
+	ConfigFailed    = "config.failed"
+	ConfigStale     = "config.stale"
+	ConfigFresh     = "config.fresh"
+	ServerStatus    = "server.status"
+	ServerCreated   = "server.created"
+	ServerDestroyed = "server.destroyed"
+	ServerLocked    = "server.locked"
+	ServerUnlocked  = "server.unlocked"
+	WorldImported   = "world.imported"
+	WorldReset      = "world.reset"
+	WorldTrimmed    = "world.trimmed"
+	WorldMigrated   = "world.migrated"
+	WorldUpgraded   = "world.upgraded"
+	WorldBlocked    = "world.blocked"
+	BackupCompleted = "backup.completed"
+	BackupRestored  = "backup.restored"
+	MacroStarted    = "macro.started"
+	MacroFinished   = "macro.finished"
+	PlayerBanned    = "player.banned"
+	PlayerUnbanned  = "player.unbanned"
+	PlayerRenamed   = "player.renamed"
+	DriftDetected   = "drift.detected"
+	ManagerFrozen   = "manager.frozen"
+	ManagerUnfrozen = "manager.unfrozen"
+	HostHibernating = "host.hibernating"
+	HostResumed     = "host.resumed"
+	AlertFiring     = "alert.firing"
+	AlertResolved   = "alert.resolved"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped
+const subscriberBuffer = 64
+
+// Event is one thing that happened. IDs increase by one per event, so a
+// subscriber can resume after the last event it has seen.
+type Event struct {
+	ID     uint64                 `json:"id"`
+	Type   string                 `json:"type"`
+	Time   time.Time              `json:"time"`
+	Server string                 `json:"server,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// Bus fans events out to subscribers and keeps the most recent ones for
+// subscribers that reconnect
+type Bus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	size        int
+	subscribers map[chan Event]struct{}
+	closed      bool
+}
+
+// NewBus creates a bus remembering the last size events
+func NewBus(size int) *Bus {
+	return &Bus{
+		nextID:      1,
+		size:        size,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber. A subscriber that cannot keep
+// up is dropped, its channel is closed so that it can reconnect and resume
+// from the history. A nil bus discards events.
+func (b *Bus) Publish(eventType, server string, data map[string]interface{}) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := Event{ID: b.nextID, Type: eventType, Time: time.Now(), Server: server, Data: data}
+	b.nextID++
+	b.history = append(b.history, event)
+	if excess := len(b.history) - b.size; excess > 0 {
+		b.history = append([]Event(nil), b.history[excess:]...)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the remembered events after the given ID and a channel
+// receiving the events that follow. The channel is closed when the
+// subscriber falls behind, cancel is called or the bus is closed.
+func (b *Bus) Subscribe(after uint64) ([]Event, <-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []Event
+	if after > 0 {
+		for _, event := range b.history {
+			if event.ID > after {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	if b.closed {
+		close(ch)
+		return backlog, ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, exists := b.subscribers[ch]; exists {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// Close ends every subscription so that streams finish before the API
+// shuts down. Events are still remembered.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Stats returns how many events are remembered for replay and how many
+// subscribers are connected
+func (b *Bus) Stats() (history, subscribers int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.history), len(b.subscribers)
+}
@@ -0,0 +1,102 @@
+package github
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// maxArchiveSize bounds the uncompressed files read from a repository
+// archive
+const maxArchiveSize = 256 << 20
+
+// commitPattern matches full commit SHAs, whose files never change and are
+// cached
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// filesAt returns every file of the repository at a branch or commit, keyed
+// by path, from one download of its tarball instead of a contents request
+// per file. The files of the last commit fetched are cached.
+func (c *Client) filesAt(ctx context.Context, ref string) (map[string][]byte, error) {
+	if c.dir != "" {
+		return c.localFilesAt(ref)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.archiveRef == ref {
+		return c.archiveFiles, nil
+	}
+
+	link, _, err := c.client.Repositories.GetArchiveLink(ctx, c.repoOwner, c.repoName, github.Tarball, &github.RepositoryContentGetOptions{Ref: ref}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archive of %s from GitHub: %w", ref, err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.client.Client().Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download archive of %s: %w", ref, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download archive of %s: %s", ref, response.Status)
+	}
+
+	files, err := readTarball(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive of %s: %w", ref, err)
+	}
+	if commitPattern.MatchString(ref) {
+		c.archiveRef, c.archiveFiles = ref, files
+	}
+	return files, nil
+}
+
+// readTarball reads the regular files of a GitHub tarball, keyed by their
+// path without the top-level directory GitHub puts them in
+func readTarball(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	archive := tar.NewReader(gz)
+	var total int64
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		_, name, found := strings.Cut(header.Name, "/")
+		if !found || name == "" {
+			continue
+		}
+		total += header.Size
+		if total > maxArchiveSize {
+			return nil, fmt.Errorf("repository is larger than %d MB", maxArchiveSize>>20)
+		}
+		content, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+}
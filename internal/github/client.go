@@ -2,8 +2,14 @@ package github
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"minecraft-server-manager/internal/config"
@@ -18,6 +24,26 @@ type Client struct {
 	repoName   string
 	branch     string
 	configPath string
+
+	// dir is set for local sources, read from the filesystem
+	dir string
+
+	// archiveFiles are the files of the repository at archiveRef, the
+	// last commit downloaded
+	mu           sync.Mutex
+	archiveRef   string
+	archiveFiles map[string][]byte
+
+	// heads are the last head commits seen per branch with their ETag, so
+	// that polls ask GitHub only for changes; notModified counts the polls
+	// answered with 304 Not Modified
+	heads       map[string]branchHead
+	notModified atomic.Int64
+}
+
+type branchHead struct {
+	etag string
+	sha  string
 }
 
 func NewClient(repoOwner, repoName string) *Client {
@@ -41,26 +67,29 @@ func (c *Client) SetConfigPath(configPath string) {
 	c.configPath = configPath
 }
 
+// SetToken authenticates requests, which is required for writes such as
+// promotions
+func (c *Client) SetToken(token string) {
+	c.client = github.NewClient(nil).WithAuthToken(token)
+}
+
 func (c *Client) GetConfig() (*config.RepoConfig, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	return c.GetConfigAt(c.branch)
+}
+
+// GetConfigAt reads the configuration file at a branch or commit
+func (c *Client) GetConfigAt(ref string) (*config.RepoConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
-	// Get the file content from GitHub
-	fileContent, _, resp, err := c.client.Repositories.GetContents(ctx, c.repoOwner, c.repoName, c.configPath, &github.RepositoryContentGetOptions{
-		Ref: c.branch,
-	})
+	files, err := c.filesAt(ctx, ref)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get config file from GitHub: %w", err)
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+		return nil, err
 	}
-
-	// Decode the content
-	content, err := base64.StdEncoding.DecodeString(*fileContent.Content)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode file content: %w", err)
+	configPath := strings.Trim(c.configPath, "/")
+	content, exists := files[configPath]
+	if !exists {
+		return nil, fmt.Errorf("config file %s not found at %s", configPath, ref)
 	}
 
 	// Parse the YAML configuration
@@ -73,22 +102,173 @@ func (c *Client) GetConfig() (*config.RepoConfig, error) {
 }
 
 func (c *Client) GetLastCommitSHA() (string, error) {
+	return c.GetBranchSHA(c.branch)
+}
+
+// GetBranchSHA returns the head commit of a branch
+func (c *Client) GetBranchSHA(branch string) (string, error) {
+	if c.dir != "" {
+		if branch != c.branch {
+			return "", fmt.Errorf("branch %s: %w", branch, ErrLocalSource)
+		}
+		return c.localSHA()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	commits, _, err := c.client.Repositories.ListCommits(ctx, c.repoOwner, c.repoName, &github.CommitsListOptions{
-		SHA: c.branch,
-		ListOptions: github.ListOptions{
-			PerPage: 1,
-		},
-	})
+	// A conditional request for only the SHA; GitHub answers 304 without
+	// counting against the rate limit while the branch is unchanged
+	req, err := c.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/commits/%s", c.repoOwner, c.repoName, url.PathEscape(branch)), nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to get commits: %w", err)
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.sha")
+	c.mu.Lock()
+	head, known := c.heads[branch]
+	c.mu.Unlock()
+	if known {
+		req.Header.Set("If-None-Match", head.etag)
 	}
 
-	if len(commits) == 0 {
+	var sha strings.Builder
+	resp, err := c.client.Do(ctx, req, &sha)
+	var errResp *github.ErrorResponse
+	if known && errors.As(err, &errResp) && errResp.Response.StatusCode == http.StatusNotModified {
+		c.notModified.Add(1)
+		return head.sha, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get commits: %w", err)
+	}
+	if sha.Len() == 0 {
 		return "", fmt.Errorf("no commits found")
 	}
 
-	return *commits[0].SHA, nil
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		c.mu.Lock()
+		if c.heads == nil {
+			c.heads = make(map[string]branchHead)
+		}
+		c.heads[branch] = branchHead{etag: etag, sha: strings.TrimSpace(sha.String())}
+		c.mu.Unlock()
+	}
+	return strings.TrimSpace(sha.String()), nil
+}
+
+// NotModified returns how many polls GitHub answered with 304 Not
+// Modified
+func (c *Client) NotModified() int64 {
+	return c.notModified.Load()
+}
+
+// CommitTime returns when a commit was committed, which for a merge is
+// when the change was merged
+func (c *Client) CommitTime(sha string) (time.Time, error) {
+	if c.dir != "" {
+		return c.localCommitTime()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	commit, _, err := c.client.Git.GetCommit(ctx, c.repoOwner, c.repoName, sha)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get commit %s: %w", sha, err)
+	}
+	return commit.GetCommitter().GetDate().Time, nil
+}
+
+// CanFastForward reports whether branch can be fast-forwarded to sha, and
+// whether it is already there
+func (c *Client) CanFastForward(branch, sha string) (ok, upToDate bool, err error) {
+	if c.dir != "" {
+		return false, false, fmt.Errorf("promotions are %w", ErrLocalSource)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	comparison, _, err := c.client.Repositories.CompareCommits(ctx, c.repoOwner, c.repoName, branch, sha, nil)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to compare %s with %s: %w", branch, sha, err)
+	}
+
+	switch comparison.GetStatus() {
+	case "ahead":
+		return true, false, nil
+	case "identical":
+		return true, true, nil
+	default:
+		return false, false, nil
+	}
+}
+
+// FastForward moves branch to sha. GitHub rejects the update unless it is
+// a fast-forward.
+func (c *Client) FastForward(branch, sha string) error {
+	if c.dir != "" {
+		return fmt.Errorf("promotions are %w", ErrLocalSource)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, _, err := c.client.Git.UpdateRef(ctx, c.repoOwner, c.repoName, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}, false)
+	if err != nil {
+		return fmt.Errorf("failed to update branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// GetFileAt fetches a file at a branch or commit, from the same archive
+// as the configuration. A missing file is reported with os.ErrNotExist.
+func (c *Client) GetFileAt(filePath, ref string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	files, err := c.filesAt(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	content, exists := files[strings.Trim(filePath, "/")]
+	if !exists {
+		return nil, fmt.Errorf("%s at %s: %w", filePath, ref, os.ErrNotExist)
+	}
+	return content, nil
+}
+
+// GetDirectory fetches all files below dirPath, keyed by their path relative
+// to dirPath using forward slashes.
+func (c *Client) GetDirectory(dirPath string) (map[string][]byte, error) {
+	return c.GetDirectoryAt(dirPath, c.branch)
+}
+
+// GetDirectoryAt fetches all files below dirPath at a branch or commit.
+// The files come from the same archive as the configuration, so the packs
+// of an apply cost no further requests.
+func (c *Client) GetDirectoryAt(dirPath, ref string) (map[string][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	all, err := c.filesAt(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	dir := strings.Trim(dirPath, "/")
+	files := make(map[string][]byte)
+	for name, content := range all {
+		relPath := name
+		if dir != "" {
+			var found bool
+			if relPath, found = strings.CutPrefix(name, dir+"/"); !found {
+				continue
+			}
+		}
+		files[relPath] = content
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("directory %s not found at %s", dirPath, ref)
+	}
+
+	return files, nil
 }
@@ -0,0 +1,105 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Deployment is a GitHub deployment created in every source for one apply
+type Deployment struct {
+	environment string
+	ids         map[string]int64
+}
+
+// CreateDeployment creates a deployment of each source's commit in
+// commitSHA. Sources that fail are left out and reported in the error.
+func (s *Sources) CreateDeployment(commitSHA, environment, description string) (*Deployment, error) {
+	commits, err := s.commits(commitSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := &Deployment{environment: environment, ids: make(map[string]int64)}
+	var firstErr error
+	for _, name := range s.names {
+		id, err := s.clients[name].createDeployment(commits[name], environment, description)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("source %s: %w", name, err)
+			}
+			continue
+		}
+		deployment.ids[name] = id
+	}
+
+	return deployment, firstErr
+}
+
+// SetDeploymentStatus posts a status (in_progress, success, failure or
+// error) to the deployment in every source
+func (s *Sources) SetDeploymentStatus(deployment *Deployment, state, description, logURL string) error {
+	var firstErr error
+	for _, name := range s.names {
+		id, exists := deployment.ids[name]
+		if !exists {
+			continue
+		}
+		if err := s.clients[name].createDeploymentStatus(id, deployment.environment, state, description, logURL); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("source %s: %w", name, err)
+		}
+	}
+	return firstErr
+}
+
+func (c *Client) createDeployment(ref, environment, description string) (int64, error) {
+	if c.dir != "" {
+		return 0, fmt.Errorf("deployments are %w", ErrLocalSource)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	deployment, _, err := c.client.Repositories.CreateDeployment(ctx, c.repoOwner, c.repoName, &github.DeploymentRequest{
+		Ref:         github.String(ref),
+		Environment: github.String(environment),
+		Description: github.String(truncateDescription(description)),
+		AutoMerge:   github.Bool(false),
+		// The manager deploys whatever it applies, regardless of checks
+		RequiredContexts: &[]string{},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create deployment: %w", err)
+	}
+	return deployment.GetID(), nil
+}
+
+func (c *Client) createDeploymentStatus(id int64, environment, state, description, logURL string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	request := &github.DeploymentStatusRequest{
+		State:        github.String(state),
+		Environment:  github.String(environment),
+		Description:  github.String(truncateDescription(description)),
+		AutoInactive: github.Bool(true),
+	}
+	if logURL != "" {
+		request.LogURL = github.String(logURL)
+	}
+
+	if _, _, err := c.client.Repositories.CreateDeploymentStatus(ctx, c.repoOwner, c.repoName, id, request); err != nil {
+		return fmt.Errorf("failed to set deployment status: %w", err)
+	}
+	return nil
+}
+
+// truncateDescription keeps descriptions within GitHub's 140 character limit
+func truncateDescription(description string) string {
+	runes := []rune(description)
+	if len(runes) <= 140 {
+		return description
+	}
+	return string(runes[:139]) + "…"
+}
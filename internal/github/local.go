@@ -0,0 +1,123 @@
+package github
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrLocalSource is returned for operations that need a GitHub repository
+// when the source is a local directory
+var ErrLocalSource = errors.New("not supported for a local configuration source")
+
+// NewLocalClient reads the configuration from a directory instead of a
+// repository. Its commit is a hash of the files, so that a change to any
+// of them is applied like a new commit.
+func NewLocalClient(dir string) *Client {
+	return &Client{dir: dir, configPath: "servers.yaml"}
+}
+
+// localFiles reads every file below the directory, skipping .git, keyed by
+// slash-separated path, with the hash standing in for the commit
+func (c *Client) localFiles() (map[string][]byte, string, error) {
+	files := make(map[string][]byte)
+	var size int64
+	err := filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if size += int64(len(content)); size > maxArchiveSize {
+			return fmt.Errorf("files exceed %d MB", maxArchiveSize>>20)
+		}
+		relPath, err := filepath.Rel(c.dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(relPath)] = content
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", c.dir, err)
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hash := sha1.New()
+	for _, path := range paths {
+		fmt.Fprintf(hash, "%s\x00%d\x00", path, len(files[path]))
+		hash.Write(files[path])
+	}
+	return files, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// localFilesAt returns the files of the directory if they still hash to
+// ref. Files that changed since are applied on the next poll.
+func (c *Client) localFilesAt(ref string) (map[string][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.archiveRef == ref {
+		return c.archiveFiles, nil
+	}
+	files, sha, err := c.localFiles()
+	if err != nil {
+		return nil, err
+	}
+	c.archiveRef, c.archiveFiles = sha, files
+	if sha != ref {
+		return nil, fmt.Errorf("%s changed since %s was read", c.dir, ref)
+	}
+	return files, nil
+}
+
+// localSHA hashes the directory and keeps its files for the apply
+func (c *Client) localSHA() (string, error) {
+	files, sha, err := c.localFiles()
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.archiveRef, c.archiveFiles = sha, files
+	c.mu.Unlock()
+	return sha, nil
+}
+
+// localCommitTime is when the newest file of the directory was modified
+func (c *Client) localCommitTime() (time.Time, error) {
+	var latest time.Time
+	err := filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
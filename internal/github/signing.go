@@ -0,0 +1,326 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// KeyRing holds the keys allowed to sign applied configuration. GitHub
+// checks that a signature is cryptographically valid; the key ring pins
+// which keys may have made it, so that a compromised account cannot sign
+// with a newly added key.
+type KeyRing struct {
+	ssh map[string]bool // SHA256 fingerprints
+	gpg []string        // upper case hex fingerprints or key IDs
+}
+
+// NewKeyRing parses SSH public keys in authorized_keys format, SSH
+// fingerprints and GPG fingerprints or key IDs
+func NewKeyRing(keys []string) (*KeyRing, error) {
+	ring := &KeyRing{ssh: make(map[string]bool)}
+
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		fields := strings.Fields(key)
+
+		switch {
+		case strings.HasPrefix(key, "SHA256:"):
+			ring.ssh[key] = true
+		case len(fields) >= 2 && (strings.HasPrefix(fields[0], "ssh-") || strings.HasPrefix(fields[0], "ecdsa-") || strings.HasPrefix(fields[0], "sk-")):
+			blob, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid SSH public key %q: %w", key, err)
+			}
+			ring.ssh[sshFingerprint(blob)] = true
+		default:
+			id := strings.ToUpper(strings.ReplaceAll(key, " ", ""))
+			if _, err := hex.DecodeString(id); err != nil || (len(id) != 16 && len(id) != 40) {
+				return nil, fmt.Errorf("unrecognized signing key %q", key)
+			}
+			ring.gpg = append(ring.gpg, id)
+		}
+	}
+
+	return ring, nil
+}
+
+// check returns nil if a verified signature was made by an allowed key
+func (k *KeyRing) check(verification *github.SignatureVerification) error {
+	if verification == nil || verification.GetSignature() == "" {
+		return errors.New("not signed")
+	}
+	if !verification.GetVerified() {
+		return fmt.Errorf("signature not verified by GitHub (%s)", verification.GetReason())
+	}
+
+	signature := verification.GetSignature()
+	switch {
+	case strings.Contains(signature, "BEGIN SSH SIGNATURE"):
+		fingerprint, err := sshSignatureKey(signature)
+		if err != nil {
+			return err
+		}
+		if !k.ssh[fingerprint] {
+			return fmt.Errorf("signed by SSH key %s which is not allowed", fingerprint)
+		}
+	case strings.Contains(signature, "BEGIN PGP SIGNATURE"):
+		issuer, err := pgpSignatureIssuer(signature)
+		if err != nil {
+			return err
+		}
+		if !k.allowsGPG(issuer) {
+			return fmt.Errorf("signed by GPG key %s which is not allowed", issuer)
+		}
+	default:
+		return errors.New("unsupported signature type")
+	}
+
+	return nil
+}
+
+// allowsGPG matches an issuer fingerprint exactly. A key ID, the last 16
+// hex digits of a fingerprint, only matches a key pinned by its key ID, so
+// a signature naming just a key ID never passes for a pinned fingerprint.
+func (k *KeyRing) allowsGPG(issuer string) bool {
+	for _, id := range k.gpg {
+		if id == issuer || len(id) == 16 && strings.HasSuffix(issuer, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCommit checks that a commit is signed by an allowed key or, with
+// allowTags set, is the target of a tag signed by one
+func (c *Client) VerifyCommit(sha string, keys *KeyRing, allowTags bool) error {
+	if c.dir != "" {
+		return fmt.Errorf("signatures are %w", ErrLocalSource)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	commit, _, err := c.client.Git.GetCommit(ctx, c.repoOwner, c.repoName, sha)
+	if err != nil {
+		return fmt.Errorf("failed to get commit %s: %w", sha, err)
+	}
+
+	commitErr := keys.check(commit.Verification)
+	if commitErr == nil || !allowTags {
+		return commitErr
+	}
+
+	var tags []*github.RepositoryTag
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := c.client.Repositories.ListTags(ctx, c.repoOwner, c.repoName, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list tags: %w", err)
+		}
+		tags = append(tags, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	for _, tag := range tags {
+		if tag.GetCommit().GetSHA() != sha {
+			continue
+		}
+
+		ref, _, err := c.client.Git.GetRef(ctx, c.repoOwner, c.repoName, "tags/"+tag.GetName())
+		if err != nil || ref.GetObject().GetType() != "tag" {
+			// Lightweight tags cannot be signed
+			continue
+		}
+		tagObject, _, err := c.client.Git.GetTag(ctx, c.repoOwner, c.repoName, ref.GetObject().GetSHA())
+		if err != nil {
+			continue
+		}
+		if keys.check(tagObject.Verification) == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("commit %v and no tag of it is signed by an allowed key", commitErr)
+}
+
+func sshFingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// sshSignatureKey returns the fingerprint of the public key embedded in an
+// armored SSHSIG signature
+func sshSignatureKey(armored string) (string, error) {
+	data, err := dearmor(armored)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH signature: %w", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("SSHSIG")) || len(data) < 10 {
+		return "", errors.New("invalid SSH signature: bad magic")
+	}
+	// Magic and version are followed by the public key as an SSH string
+	rest := data[10:]
+	if len(rest) < 4 {
+		return "", errors.New("invalid SSH signature: truncated")
+	}
+	length := binary.BigEndian.Uint32(rest)
+	if uint64(len(rest)-4) < uint64(length) {
+		return "", errors.New("invalid SSH signature: truncated")
+	}
+
+	return sshFingerprint(rest[4 : 4+length]), nil
+}
+
+// pgpSignatureIssuer returns the issuer fingerprint, or the issuer key ID
+// if the signature carries no fingerprint, of an armored OpenPGP signature.
+// Only the hashed subpacket area is covered by the signature, anything in
+// the unhashed area can be changed without invalidating it and is ignored.
+func pgpSignatureIssuer(armored string) (string, error) {
+	data, err := dearmor(armored)
+	if err != nil {
+		return "", fmt.Errorf("invalid PGP signature: %w", err)
+	}
+
+	body, err := pgpPacketBody(data)
+	if err != nil {
+		return "", err
+	}
+	if len(body) < 6 || body[0] != 4 {
+		return "", errors.New("unsupported PGP signature version")
+	}
+
+	// The hashed subpacket area follows the fixed header
+	var keyID string
+	rest := body[4:]
+	length := int(binary.BigEndian.Uint16(rest))
+	if len(rest)-2 < length {
+		return "", errors.New("invalid PGP signature: truncated")
+	}
+	subpackets := rest[2 : 2+length]
+
+	for len(subpackets) > 0 {
+		size, header := pgpSubpacketLength(subpackets)
+		if header == 0 || size == 0 || len(subpackets) < header+size {
+			return "", errors.New("invalid PGP signature: bad subpacket")
+		}
+		kind := subpackets[header] & 0x7f
+		value := subpackets[header+1 : header+size]
+		subpackets = subpackets[header+size:]
+
+		switch {
+		case kind == 33 && len(value) > 1:
+			// Issuer fingerprint, prefixed by the key version
+			return strings.ToUpper(hex.EncodeToString(value[1:])), nil
+		case kind == 16 && len(value) == 8:
+			keyID = strings.ToUpper(hex.EncodeToString(value))
+		}
+	}
+
+	if keyID == "" {
+		return "", errors.New("PGP signature has no issuer in its hashed subpackets")
+	}
+	return keyID, nil
+}
+
+// pgpPacketBody returns the body of the first packet, which must be a
+// signature packet
+func pgpPacketBody(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0]&0x80 == 0 {
+		return nil, errors.New("invalid PGP signature: bad packet header")
+	}
+
+	var tag byte
+	var length, header int
+	if data[0]&0x40 != 0 {
+		// New format
+		tag = data[0] & 0x3f
+		size, n := pgpSubpacketLength(data[1:])
+		length, header = size, 1+n
+	} else {
+		// Old format
+		tag = (data[0] >> 2) & 0x0f
+		switch data[0] & 0x03 {
+		case 0:
+			length, header = int(data[1]), 2
+		case 1:
+			if len(data) < 3 {
+				return nil, errors.New("invalid PGP signature: truncated")
+			}
+			length, header = int(binary.BigEndian.Uint16(data[1:])), 3
+		case 2:
+			if len(data) < 5 {
+				return nil, errors.New("invalid PGP signature: truncated")
+			}
+			length, header = int(binary.BigEndian.Uint32(data[1:])), 5
+		default:
+			length, header = len(data)-1, 1
+		}
+	}
+
+	if tag != 2 {
+		return nil, fmt.Errorf("invalid PGP signature: unexpected packet type %d", tag)
+	}
+	if header == 0 || len(data) < header+length {
+		return nil, errors.New("invalid PGP signature: truncated")
+	}
+	return data[header : header+length], nil
+}
+
+// pgpSubpacketLength decodes an OpenPGP length, returning the length and
+// the number of bytes it occupies, or 0 bytes if it is malformed
+func pgpSubpacketLength(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	switch first := int(data[0]); {
+	case first < 192:
+		return first, 1
+	case first < 255:
+		if len(data) < 2 {
+			return 0, 0
+		}
+		return (first-192)<<8 + int(data[1]) + 192, 2
+	default:
+		if len(data) < 5 {
+			return 0, 0
+		}
+		return int(binary.BigEndian.Uint32(data[1:])), 5
+	}
+}
+
+// dearmor decodes the base64 body of an ASCII armored block, skipping armor
+// headers and the CRC line
+func dearmor(armored string) ([]byte, error) {
+	var body strings.Builder
+	inBody := false
+	for _, line := range strings.Split(strings.ReplaceAll(armored, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "-----BEGIN"):
+			inBody = true
+		case strings.HasPrefix(line, "-----END"):
+			inBody = false
+		case !inBody, line == "", strings.Contains(line, ": "), strings.HasPrefix(line, "="):
+			// Armor headers, blank separator and checksum
+		default:
+			body.WriteString(line)
+		}
+	}
+
+	if body.Len() == 0 {
+		return nil, errors.New("empty armor")
+	}
+	return base64.StdEncoding.DecodeString(body.String())
+}
@@ -0,0 +1,284 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// Sources reads the server configuration from one or more repositories and
+// merges it in source order
+type Sources struct {
+	names   []string
+	tenants map[string]string
+	clients map[string]*Client
+
+	// keys is set when applied commits must be signed
+	keys            *KeyRing
+	allowSignedTags bool
+}
+
+func NewSources(sources []config.ConfigSource, token string) *Sources {
+	s := &Sources{clients: make(map[string]*Client), tenants: make(map[string]string)}
+
+	for _, source := range sources {
+		client := NewClient(source.RepoOwner, source.RepoName)
+		if source.Path != "" {
+			client = NewLocalClient(source.Path)
+		} else if token != "" {
+			client.SetToken(token)
+		}
+		client.SetBranch(source.Branch)
+		client.SetConfigPath(source.ConfigPath)
+
+		s.names = append(s.names, source.Name)
+		s.clients[source.Name] = client
+		if source.Tenant != "" {
+			s.tenants[source.Name] = source.Tenant
+		}
+	}
+
+	return s
+}
+
+// GetLastCommitSHA returns the head commit of a single source, or the head
+// commits of all sources joined with "+" so that a change in any of them
+// is detected
+func (s *Sources) GetLastCommitSHA() (string, error) {
+	shas := make([]string, 0, len(s.names))
+	for _, name := range s.names {
+		sha, err := s.clients[name].GetLastCommitSHA()
+		if err != nil {
+			return "", fmt.Errorf("source %s: %w", name, err)
+		}
+		shas = append(shas, sha)
+	}
+	return strings.Join(shas, "+"), nil
+}
+
+// NotModified returns how many polls of all sources GitHub answered with
+// 304 Not Modified
+func (s *Sources) NotModified() int64 {
+	var total int64
+	for _, client := range s.clients {
+		total += client.NotModified()
+	}
+	return total
+}
+
+// CommitTime returns when the commits of a combined commit SHA were
+// committed; with several sources, the latest of them
+func (s *Sources) CommitTime(commitSHA string) (time.Time, error) {
+	commits, err := s.commits(commitSHA)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var latest time.Time
+	for _, name := range s.names {
+		committed, err := s.clients[name].CommitTime(commits[name])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("source %s: %w", name, err)
+		}
+		if committed.After(latest) {
+			latest = committed
+		}
+	}
+	return latest, nil
+}
+
+// SetSigning requires commits to be signed by one of the allowed keys
+// before Verify accepts them
+func (s *Sources) SetSigning(signing config.SigningConfig) error {
+	if !signing.Required {
+		s.keys = nil
+		return nil
+	}
+
+	keys, err := NewKeyRing(signing.AllowedKeys)
+	if err != nil {
+		return err
+	}
+	s.keys = keys
+	s.allowSignedTags = signing.AllowSignedTags
+	return nil
+}
+
+// Verify checks the signatures of the commits returned by GetLastCommitSHA.
+// It always succeeds when signing is not required.
+func (s *Sources) Verify(commitSHA string) error {
+	if s.keys == nil {
+		return nil
+	}
+
+	commits, err := s.commits(commitSHA)
+	if err != nil {
+		return err
+	}
+	for _, name := range s.names {
+		if err := s.clients[name].VerifyCommit(commits[name], s.keys, s.allowSignedTags); err != nil {
+			return fmt.Errorf("source %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// GetConfigAt fetches and merges the configuration of all sources at the
+// commits returned by GetLastCommitSHA, so that the applied configuration
+// is the one that was verified even if a branch moves in between
+func (s *Sources) GetConfigAt(commitSHA string) (*config.RepoConfig, error) {
+	commits, err := s.commits(commitSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sources are downloaded in parallel. The download holds the pack
+	// directories too, which GetDirectoryAt reads from it afterwards.
+	configs := make([]*config.RepoConfig, len(s.names))
+	errs := make([]error, len(s.names))
+	var wg sync.WaitGroup
+	for i, name := range s.names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			configs[i], errs[i] = s.clients[name].GetConfigAt(commits[name])
+		}(i, name)
+	}
+	wg.Wait()
+	for i, name := range s.names {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("source %s: %w", name, errs[i])
+		}
+	}
+	return config.MergeRepoConfigs(s.names, s.tenants, configs), nil
+}
+
+// GetDirectoryAt fetches a directory from the named source at its commit
+// in commitSHA
+func (s *Sources) GetDirectoryAt(source, dirPath, commitSHA string) (map[string][]byte, error) {
+	client, exists := s.clients[source]
+	if !exists {
+		return nil, fmt.Errorf("unknown configuration source %q", source)
+	}
+	commits, err := s.commits(commitSHA)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetDirectoryAt(dirPath, commits[source])
+}
+
+// GetFileAt fetches a file from the named source at its commit in
+// commitSHA. A missing file is reported with os.ErrNotExist.
+func (s *Sources) GetFileAt(source, filePath, commitSHA string) ([]byte, error) {
+	client, exists := s.clients[source]
+	if !exists {
+		return nil, fmt.Errorf("unknown configuration source %q", source)
+	}
+	commits, err := s.commits(commitSHA)
+	if err != nil {
+		return nil, err
+	}
+	return client.GetFileAt(filePath, commits[source])
+}
+
+// commits splits a combined commit SHA into the commit of each source
+func (s *Sources) commits(commitSHA string) (map[string]string, error) {
+	shas := strings.Split(commitSHA, "+")
+	if len(shas) != len(s.names) {
+		return nil, fmt.Errorf("commit %s does not match the %d configuration sources", commitSHA, len(s.names))
+	}
+
+	commits := make(map[string]string, len(shas))
+	for i, name := range s.names {
+		commits[name] = shas[i]
+	}
+	return commits, nil
+}
+
+// Promotion describes a fast-forward of one branch to another across all
+// sources
+type Promotion struct {
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Commits map[string]string `json:"commits"`
+	Updated []string          `json:"updated"`
+}
+
+// Promote fast-forwards toBranch to fromBranch in every source, after
+// validating the merged configuration the promotion would produce. With sha
+// set, that commit of fromBranch is promoted instead of its head, which is
+// only possible with a single source. Nothing is updated unless every
+// source can be fast-forwarded.
+func (s *Sources) Promote(fromBranch, toBranch, sha string) (*Promotion, error) {
+	if sha != "" && len(s.names) > 1 {
+		return nil, errors.New("promoting a specific commit requires a single configuration source")
+	}
+
+	promotion := &Promotion{
+		From:    fromBranch,
+		To:      toBranch,
+		Commits: make(map[string]string),
+	}
+
+	var pending []string
+	for _, name := range s.names {
+		client := s.clients[name]
+
+		target := sha
+		if target == "" {
+			head, err := client.GetBranchSHA(fromBranch)
+			if err != nil {
+				return nil, fmt.Errorf("source %s: %w", name, err)
+			}
+			target = head
+		} else {
+			// The commit must be part of the source branch
+			onBranch, _, err := client.CanFastForward(target, fromBranch)
+			if err != nil {
+				return nil, fmt.Errorf("source %s: %w", name, err)
+			}
+			if !onBranch {
+				return nil, fmt.Errorf("source %s: commit %s is not on branch %s", name, target, fromBranch)
+			}
+		}
+
+		ok, upToDate, err := client.CanFastForward(toBranch, target)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", name, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("source %s: %s cannot be fast-forwarded to %s, the branches have diverged", name, toBranch, target)
+		}
+
+		promotion.Commits[name] = target
+		if !upToDate {
+			pending = append(pending, name)
+		}
+	}
+
+	// Validate the configuration as the target environment would see it
+	configs := make([]*config.RepoConfig, 0, len(s.names))
+	for _, name := range s.names {
+		repoConfig, err := s.clients[name].GetConfigAt(promotion.Commits[name])
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", name, err)
+		}
+		configs = append(configs, repoConfig)
+	}
+	if err := config.MergeRepoConfigs(s.names, s.tenants, configs).Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range pending {
+		if err := s.clients[name].FastForward(toBranch, promotion.Commits[name]); err != nil {
+			return promotion, fmt.Errorf("source %s: %w", name, err)
+		}
+		promotion.Updated = append(promotion.Updated, name)
+	}
+
+	return promotion, nil
+}
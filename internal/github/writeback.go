@@ -0,0 +1,163 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// ConfigUpdate changes the content of a configuration file
+type ConfigUpdate func(content []byte) ([]byte, error)
+
+// Change is a change of a configuration file written back to its source,
+// as a commit to the source's branch or a pull request. Commit is empty
+// for local sources, where the file is written in place.
+type Change struct {
+	Source      string `json:"source"`
+	Commit      string `json:"commit,omitempty"`
+	PullRequest string `json:"pull_request,omitempty"`
+}
+
+// WriteConfig changes the configuration file of the named source, with a
+// commit to its branch or, in pull_request mode, a pull request for review
+func (s *Sources) WriteConfig(source, mode, message string, update ConfigUpdate) (*Change, error) {
+	client, exists := s.clients[source]
+	if !exists {
+		return nil, fmt.Errorf("unknown configuration source %q", source)
+	}
+	return s.WriteFile(source, client.configPath, mode, message, update)
+}
+
+// WriteFile changes a file in the repository of the named source as
+// WriteConfig does
+func (s *Sources) WriteFile(source, filePath, mode, message string, update ConfigUpdate) (*Change, error) {
+	client, exists := s.clients[source]
+	if !exists {
+		return nil, fmt.Errorf("unknown configuration source %q", source)
+	}
+	change := &Change{Source: source}
+	var err error
+	if mode == config.WriteBackPullRequest {
+		change.PullRequest, change.Commit, err = client.ProposeFile(filePath, message, update)
+	} else {
+		change.Commit, err = client.UpdateFile(filePath, message, update)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("source %s: %w", source, err)
+	}
+	return change, nil
+}
+
+// UpdateFile changes a file on the branch through a commit and returns
+// the commit. Writes need a token.
+func (c *Client) UpdateFile(filePath, message string, update ConfigUpdate) (string, error) {
+	filePath = strings.Trim(filePath, "/")
+	if c.dir != "" {
+		return "", c.updateLocalFile(filePath, update)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return c.updateFile(ctx, c.branch, filePath, message, update)
+}
+
+// ProposeFile changes a file on a new branch and opens a pull request to
+// merge it into the branch. It returns the URL of the pull request and
+// the commit.
+func (c *Client) ProposeFile(filePath, message string, update ConfigUpdate) (string, string, error) {
+	if c.dir != "" {
+		return "", "", fmt.Errorf("pull requests are %w", ErrLocalSource)
+	}
+	filePath = strings.Trim(filePath, "/")
+	head, err := c.GetBranchSHA(c.branch)
+	if err != nil {
+		return "", "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	branch := fmt.Sprintf("party/%s", time.Now().UTC().Format("20060102-150405.000000"))
+	ref := "refs/heads/" + branch
+	if _, _, err := c.client.Git.CreateRef(ctx, c.repoOwner, c.repoName, &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: github.String(head)},
+	}); err != nil {
+		return "", "", fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+	sha, err := c.updateFile(ctx, branch, filePath, message, update)
+	if err != nil {
+		// Leave no empty branches behind
+		c.client.Git.DeleteRef(ctx, c.repoOwner, c.repoName, ref)
+		return "", "", err
+	}
+
+	title, body, _ := strings.Cut(message, "\n")
+	pull, _, err := c.client.PullRequests.Create(ctx, c.repoOwner, c.repoName, &github.NewPullRequest{
+		Title: github.String(title),
+		Head:  github.String(branch),
+		Base:  github.String(c.branch),
+		Body:  github.String(strings.TrimSpace(body)),
+	})
+	if err != nil {
+		return "", sha, fmt.Errorf("failed to open a pull request for branch %s: %w", branch, err)
+	}
+	return pull.GetHTMLURL(), sha, nil
+}
+
+// updateFile commits a change of a file to a branch. The commit is refused
+// if the file changed since it was read, so that concurrent edits are not
+// lost.
+func (c *Client) updateFile(ctx context.Context, branch, filePath, message string, update ConfigUpdate) (string, error) {
+	file, _, response, err := c.client.Repositories.GetContents(ctx, c.repoOwner, c.repoName, filePath, &github.RepositoryContentGetOptions{Ref: branch})
+	if err != nil && (response == nil || response.StatusCode != http.StatusNotFound) {
+		return "", fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	var content []byte
+	options := &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Branch:  github.String(branch),
+	}
+	if file != nil {
+		decoded, err := file.GetContent()
+		if err != nil {
+			return "", fmt.Errorf("failed to decode %s: %w", filePath, err)
+		}
+		content = []byte(decoded)
+		options.SHA = file.SHA
+	}
+
+	if options.Content, err = update(content); err != nil {
+		return "", err
+	}
+	commit, _, err := c.client.Repositories.UpdateFile(ctx, c.repoOwner, c.repoName, filePath, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit %s: %w", filePath, err)
+	}
+	return commit.GetSHA(), nil
+}
+
+// updateLocalFile writes a file of a local source in place
+func (c *Client) updateLocalFile(filePath string, update ConfigUpdate) error {
+	path := filepath.Join(c.dir, filepath.FromSlash(filePath))
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	updated, err := update(content)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, updated, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
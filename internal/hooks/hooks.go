@@ -0,0 +1,226 @@
+// Package hooks calls external systems when servers are created or
+// destroyed, such as creating a Discord channel, a DNS record or a billing
+// entry for every server in the configuration, and when the host
+// hibernates, such as stopping its cloud VM.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestTimeout bounds one attempt of a hook
+const requestTimeout = 30 * time.Second
+
+// maxBackoff caps the wait between attempts, which starts at two seconds
+// and doubles
+const maxBackoff = time.Minute
+
+// queueSize is how many calls may wait for delivery before new ones are
+// dropped
+const queueSize = 256
+
+// Payload describes the server, or for host events the host, a hook is
+// called for. It is the data of the URL and body templates, and the body
+// of hooks without a template.
+type Payload struct {
+	Event       string            `json:"event"`
+	Time        time.Time         `json:"time"`
+	Host        string            `json:"host,omitempty"`
+	Server      string            `json:"server,omitempty"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Group       string            `json:"group,omitempty"`
+	Port        int               `json:"port"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// WakeAt is when a hibernating host is next needed, nil when no server
+	// is scheduled to start again
+	WakeAt *time.Time `json:"wake_at,omitempty"`
+}
+
+// subject names what a hook is called for in logs and notifications
+func (p Payload) subject() string {
+	if p.Server == "" {
+		return p.Host
+	}
+	return p.Server
+}
+
+// templateFuncs are available in URL and body templates: json encodes a
+// value, query escapes it for a URL
+var templateFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"query": url.QueryEscape,
+}
+
+type hook struct {
+	config.HookConfig
+	url  *template.Template
+	body *template.Template
+}
+
+// call is one hook to deliver
+type call struct {
+	hook    *hook
+	payload Payload
+}
+
+// Runner delivers hook calls one at a time in the order they were fired,
+// so that a server's creation reaches a hook before its destruction
+type Runner struct {
+	hooks    []*hook
+	client   *http.Client
+	notifier *notify.Notifier
+	logger   *logrus.Logger
+	queue    chan call
+}
+
+// New parses the templates of the configured hooks and starts delivering
+// their calls
+func New(cfgs []config.HookConfig, notifier *notify.Notifier, logger *logrus.Logger) (*Runner, error) {
+	r := &Runner{
+		client:   &http.Client{Timeout: requestTimeout},
+		notifier: notifier,
+		logger:   logger,
+		queue:    make(chan call, queueSize),
+	}
+	for _, cfg := range cfgs {
+		h := &hook{HookConfig: cfg}
+		var err error
+		if h.url, err = template.New("url").Funcs(templateFuncs).Option("missingkey=zero").Parse(cfg.URL); err != nil {
+			return nil, fmt.Errorf("hook %s: url: %w", cfg.Name, err)
+		}
+		if cfg.Body != "" {
+			if h.body, err = template.New("body").Funcs(templateFuncs).Option("missingkey=zero").Parse(cfg.Body); err != nil {
+				return nil, fmt.Errorf("hook %s: body: %w", cfg.Name, err)
+			}
+		}
+		r.hooks = append(r.hooks, h)
+	}
+	if len(r.hooks) > 0 {
+		go r.deliver()
+	}
+	return r, nil
+}
+
+// Fire calls every hook registered for the payload's event in the
+// background. A nil runner discards calls.
+func (r *Runner) Fire(payload Payload) {
+	if r == nil {
+		return
+	}
+	if payload.Time.IsZero() {
+		payload.Time = time.Now()
+	}
+	for _, h := range r.hooks {
+		if !slices.Contains(h.Events, payload.Event) || (h.Tenant != "" && h.Tenant != payload.Tenant) {
+			continue
+		}
+		select {
+		case r.queue <- call{hook: h, payload: payload}:
+		default:
+			r.logger.Errorf("Dropped hook %s for %s of %s, too many calls are pending", h.Name, payload.Event, payload.subject())
+		}
+	}
+}
+
+func (r *Runner) deliver() {
+	for c := range r.queue {
+		r.run(c.hook, c.payload)
+	}
+}
+
+// run calls a hook until it succeeds or runs out of retries. Failures that
+// retrying cannot fix, such as a rejected request, end it early.
+func (r *Runner) run(h *hook, payload Payload) {
+	backoff := 2 * time.Second
+	var err error
+	for attempt := 0; attempt <= h.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff = min(2*backoff, maxBackoff)
+		}
+		var retry bool
+		if retry, err = r.send(h, payload); err == nil {
+			r.logger.Infof("Called hook %s for %s of %s", h.Name, payload.Event, payload.subject())
+			return
+		}
+		r.logger.Warnf("Hook %s for %s of %s failed (attempt %d of %d): %v", h.Name, payload.Event, payload.subject(), attempt+1, h.Retries+1, err)
+		if !retry {
+			break
+		}
+	}
+
+	r.notifier.Notify(notify.Notification{
+		Event:    config.NotifyHookFailed,
+		Title:    fmt.Sprintf("Hook %s failed for %s", h.Name, payload.subject()),
+		Message:  fmt.Sprintf("Calling hook %s for %s of %s failed: %v", h.Name, payload.Event, payload.subject(), err),
+		Severity: notify.SeverityWarning,
+		Server:   payload.Server,
+		Fields:   map[string]string{"hook": h.Name, "event": payload.Event, "error": err.Error()},
+	})
+}
+
+// send makes one request and reports whether a failure is worth retrying
+func (r *Runner) send(h *hook, payload Payload) (bool, error) {
+	var target bytes.Buffer
+	if err := h.url.Execute(&target, payload); err != nil {
+		return false, fmt.Errorf("failed to render url: %w", err)
+	}
+	var body []byte
+	if h.body != nil {
+		var rendered bytes.Buffer
+		if err := h.body.Execute(&rendered, payload); err != nil {
+			return false, fmt.Errorf("failed to render body: %w", err)
+		}
+		body = rendered.Bytes()
+	} else {
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return false, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, h.Method, strings.TrimSpace(target.String()), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Party-Event", payload.Event)
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return false, nil
+}
@@ -0,0 +1,168 @@
+// Package incident opens and resolves incidents in on-call tools such as
+// PagerDuty and Opsgenie for alerts that need someone to act.
+package incident
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+
+	"github.com/sirupsen/logrus"
+)
+
+// requestTimeout bounds one attempt to reach a provider
+const requestTimeout = 30 * time.Second
+
+// attempts is how often a trigger or resolve is tried, with backoff
+// starting at two seconds and doubling
+const attempts = 4
+
+// queueSize is how many calls may wait for delivery before new ones are
+// dropped
+const queueSize = 256
+
+// Incident is an alert firing for one series. Key identifies it across
+// triggering and resolving.
+type Incident struct {
+	Key      string
+	Summary  string
+	Severity string
+	Source   string
+	Server   string
+	Details  map[string]string
+}
+
+// Provider is an on-call tool incidents are sent to
+type Provider interface {
+	Name() string
+	Trigger(ctx context.Context, incident Incident) error
+	Resolve(ctx context.Context, incident Incident) error
+}
+
+// call is one trigger or resolve to deliver
+type call struct {
+	provider Provider
+	resolve  bool
+	incident Incident
+}
+
+// Dispatcher delivers incidents to every provider one at a time in the
+// order they happened, so that an incident is triggered before it is
+// resolved
+type Dispatcher struct {
+	providers []Provider
+	severity  string
+	source    string
+	notifier  *notify.Notifier
+	logger    *logrus.Logger
+	queue     chan call
+}
+
+// New creates a dispatcher for the configured providers, nil when none is
+// configured
+func New(cfg config.IncidentsConfig, notifier *notify.Notifier, logger *logrus.Logger) *Dispatcher {
+	var providers []Provider
+	if cfg.PagerDuty != nil {
+		providers = append(providers, newPagerDuty(*cfg.PagerDuty))
+	}
+	if cfg.Opsgenie != nil {
+		providers = append(providers, newOpsgenie(*cfg.Opsgenie))
+	}
+	if len(providers) == 0 {
+		return nil
+	}
+
+	source, err := os.Hostname()
+	if err != nil {
+		source = "party"
+	}
+	d := &Dispatcher{
+		providers: providers,
+		severity:  cfg.Severity,
+		source:    source,
+		notifier:  notifier,
+		logger:    logger,
+		queue:     make(chan call, queueSize),
+	}
+	go d.deliver()
+	return d
+}
+
+// Accepts reports whether alerts of a severity open incidents. A nil
+// dispatcher accepts none.
+func (d *Dispatcher) Accepts(severity string) bool {
+	return d != nil && notify.SeverityRank(severity) >= notify.SeverityRank(d.severity)
+}
+
+// Trigger opens an incident with every provider in the background
+func (d *Dispatcher) Trigger(incident Incident) {
+	d.enqueue(incident, false)
+}
+
+// Resolve resolves an incident with every provider in the background
+func (d *Dispatcher) Resolve(incident Incident) {
+	d.enqueue(incident, true)
+}
+
+func (d *Dispatcher) enqueue(incident Incident, resolve bool) {
+	if d == nil {
+		return
+	}
+	if incident.Source == "" {
+		incident.Source = d.source
+	}
+	// Keys are prefixed with the host, so that managers sharing a service
+	// do not resolve each other's incidents
+	incident.Key = d.source + ":" + incident.Key
+	for _, provider := range d.providers {
+		select {
+		case d.queue <- call{provider: provider, resolve: resolve, incident: incident}:
+		default:
+			d.logger.Errorf("Dropped incident %s for %s, too many calls are pending", incident.Key, provider.Name())
+		}
+	}
+}
+
+func (d *Dispatcher) deliver() {
+	for c := range d.queue {
+		d.run(c)
+	}
+}
+
+// run delivers one call until it succeeds or runs out of attempts
+func (d *Dispatcher) run(c call) {
+	action, send := "trigger", c.provider.Trigger
+	if c.resolve {
+		action, send = "resolve", c.provider.Resolve
+	}
+
+	backoff := 2 * time.Second
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		err = send(ctx, c.incident)
+		cancel()
+		if err == nil {
+			d.logger.Infof("Sent %s of incident %s to %s", action, c.incident.Key, c.provider.Name())
+			return
+		}
+		d.logger.Warnf("Failed to %s incident %s in %s (attempt %d of %d): %v", action, c.incident.Key, c.provider.Name(), attempt, attempts, err)
+	}
+
+	d.notifier.Notify(notify.Notification{
+		Event:    config.NotifyIncidentFailed,
+		Title:    fmt.Sprintf("Failed to %s incident in %s", action, c.provider.Name()),
+		Message:  fmt.Sprintf("%s: %v", c.incident.Summary, err),
+		Severity: notify.SeverityCritical,
+		Server:   c.incident.Server,
+		Fields:   map[string]string{"provider": c.provider.Name(), "incident": c.incident.Key, "error": err.Error()},
+	})
+}
@@ -0,0 +1,157 @@
+package incident
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+)
+
+// post sends body as JSON and fails on responses other than 2xx
+func post(ctx context.Context, client *http.Client, target string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// pagerDuty sends incidents to the PagerDuty Events API v2
+type pagerDuty struct {
+	config.PagerDutyConfig
+	client *http.Client
+}
+
+func newPagerDuty(cfg config.PagerDutyConfig) *pagerDuty {
+	return &pagerDuty{PagerDutyConfig: cfg, client: &http.Client{Timeout: requestTimeout}}
+}
+
+func (p *pagerDuty) Name() string {
+	return "PagerDuty"
+}
+
+// pagerDutySeverities maps notification severities to PagerDuty's
+var pagerDutySeverities = map[string]string{
+	notify.SeverityInfo:     "info",
+	notify.SeverityWarning:  "warning",
+	notify.SeverityCritical: "critical",
+}
+
+func (p *pagerDuty) Trigger(ctx context.Context, incident Incident) error {
+	severity := pagerDutySeverities[incident.Severity]
+	if severity == "" {
+		severity = "error"
+	}
+	payload := map[string]interface{}{
+		"summary":        incident.Summary,
+		"source":         incident.Source,
+		"severity":       severity,
+		"custom_details": incident.Details,
+	}
+	if incident.Server != "" {
+		payload["component"] = incident.Server
+	}
+	return post(ctx, p.client, p.URL, nil, map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    incident.Key,
+		"payload":      payload,
+	})
+}
+
+func (p *pagerDuty) Resolve(ctx context.Context, incident Incident) error {
+	return post(ctx, p.client, p.URL, nil, map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "resolve",
+		"dedup_key":    incident.Key,
+	})
+}
+
+// opsgenie creates and closes Opsgenie alerts through the Alert API,
+// identified by their alias
+type opsgenie struct {
+	config.OpsgenieConfig
+	client *http.Client
+}
+
+func newOpsgenie(cfg config.OpsgenieConfig) *opsgenie {
+	return &opsgenie{OpsgenieConfig: cfg, client: &http.Client{Timeout: requestTimeout}}
+}
+
+func (o *opsgenie) Name() string {
+	return "Opsgenie"
+}
+
+// opsgeniePriorities maps notification severities to Opsgenie priorities
+var opsgeniePriorities = map[string]string{
+	notify.SeverityInfo:     "P5",
+	notify.SeverityWarning:  "P3",
+	notify.SeverityCritical: "P1",
+}
+
+// opsgenieMessageLimit is the longest message Opsgenie accepts
+const opsgenieMessageLimit = 130
+
+func (o *opsgenie) headers() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + o.APIKey}
+}
+
+func (o *opsgenie) Trigger(ctx context.Context, incident Incident) error {
+	message := incident.Summary
+	if runes := []rune(message); len(runes) > opsgenieMessageLimit {
+		message = string(runes[:opsgenieMessageLimit])
+	}
+	priority := opsgeniePriorities[incident.Severity]
+	if priority == "" {
+		priority = "P3"
+	}
+	body := map[string]interface{}{
+		"message":     message,
+		"alias":       incident.Key,
+		"description": incident.Summary,
+		"priority":    priority,
+		"source":      incident.Source,
+		"details":     incident.Details,
+		"tags":        o.Tags,
+	}
+	if incident.Server != "" {
+		body["entity"] = incident.Server
+	}
+	if len(o.Responders) > 0 {
+		responders := make([]map[string]string, 0, len(o.Responders))
+		for _, team := range o.Responders {
+			responders = append(responders, map[string]string{"name": team, "type": "team"})
+		}
+		body["responders"] = responders
+	}
+	return post(ctx, o.client, o.URL+"/v2/alerts", o.headers(), body)
+}
+
+func (o *opsgenie) Resolve(ctx context.Context, incident Incident) error {
+	target := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", o.URL, url.PathEscape(incident.Key))
+	return post(ctx, o.client, target, o.headers(), map[string]string{"source": incident.Source})
+}
@@ -0,0 +1,338 @@
+// Package leveldb reads and writes the LevelDB databases Minecraft Bedrock
+// Edition keeps worlds in (the db directory of a world), as far as the
+// manager needs: listing every live entry and writing a fresh database.
+// Blocks may be stored uncompressed or compressed with zlib or raw deflate
+// like Mojang's fork does; snappy is not supported.
+package leveldb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// comparator is the only key order the package understands
+const comparator = "leveldb.BytewiseComparator"
+
+// Value types of internal keys and write batch records
+const (
+	kindDeletion = 0
+	kindValue    = 1
+)
+
+// Version edit tags of the MANIFEST
+const (
+	tagComparator     = 1
+	tagLogNumber      = 2
+	tagNextFileNumber = 3
+	tagLastSequence   = 4
+	tagCompactPointer = 5
+	tagDeletedFile    = 6
+	tagNewFile        = 7
+	tagPrevLogNumber  = 9
+)
+
+// DB is a database opened for reading. It must not be written to while
+// it is open, i.e. its server must be stopped.
+type DB struct {
+	dir    string
+	tables []string
+	logs   []string
+
+	// latest maps each user key to the trailer (sequence and kind) of its
+	// newest version, built on first use
+	latest map[string]uint64
+}
+
+// Open reads the MANIFEST of the database in dir to find its live tables
+// and the logs not yet compacted into them
+func Open(dir string) (*DB, error) {
+	current, err := os.ReadFile(filepath.Join(dir, "CURRENT"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := strings.TrimSpace(string(current))
+	if !strings.HasPrefix(manifest, "MANIFEST-") || strings.ContainsAny(manifest, `/\`) {
+		return nil, fmt.Errorf("%w: CURRENT names %q", ErrCorrupt, manifest)
+	}
+
+	file, err := os.Open(filepath.Join(dir, manifest))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	files := make(map[uint64]bool)
+	var logNumber, prevLogNumber uint64
+	r := &logReader{r: bufio.NewReader(file)}
+	for {
+		record, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", manifest, err)
+		}
+		if err := applyEdit(record, files, &logNumber, &prevLogNumber); err != nil {
+			return nil, fmt.Errorf("%s: %w", manifest, err)
+		}
+	}
+
+	db := &DB{dir: dir}
+	for number := range files {
+		db.tables = append(db.tables, tableName(dir, number))
+	}
+	sort.Strings(db.tables)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var logs []uint64
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), ".log")
+		if !found {
+			continue
+		}
+		number, err := strconv.ParseUint(name, 10, 64)
+		if err == nil && (number >= logNumber || number == prevLogNumber) {
+			logs = append(logs, number)
+		}
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	for _, number := range logs {
+		db.logs = append(db.logs, filepath.Join(dir, fmt.Sprintf("%06d.log", number)))
+	}
+	return db, nil
+}
+
+// tableName returns the path of a table file; older databases use .sst
+func tableName(dir string, number uint64) string {
+	path := filepath.Join(dir, fmt.Sprintf("%06d.ldb", number))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return filepath.Join(dir, fmt.Sprintf("%06d.sst", number))
+	}
+	return path
+}
+
+// applyEdit applies a version edit of the MANIFEST to the set of live
+// table files
+func applyEdit(edit []byte, files map[uint64]bool, logNumber, prevLogNumber *uint64) error {
+	d := decoder{data: edit}
+	for len(d.data) > 0 && d.err == nil {
+		switch tag := d.uvarint(); tag {
+		case tagComparator:
+			if name := string(d.bytes()); d.err == nil && name != comparator {
+				return fmt.Errorf("leveldb: unsupported comparator %q", name)
+			}
+		case tagLogNumber:
+			*logNumber = d.uvarint()
+		case tagPrevLogNumber:
+			*prevLogNumber = d.uvarint()
+		case tagNextFileNumber, tagLastSequence:
+			d.uvarint()
+		case tagCompactPointer:
+			d.uvarint()
+			d.bytes()
+		case tagDeletedFile:
+			d.uvarint()
+			delete(files, d.uvarint())
+		case tagNewFile:
+			d.uvarint()
+			number := d.uvarint()
+			d.uvarint()
+			d.bytes()
+			d.bytes()
+			files[number] = true
+		default:
+			return fmt.Errorf("%w: unknown version edit tag %d", ErrCorrupt, tag)
+		}
+	}
+	return d.err
+}
+
+// Entries calls fn with the newest value of every key that was not
+// deleted, in no particular order. key and value are only valid during
+// the call. The first call reads the database twice, keeping every key in
+// memory to tell old versions apart.
+func (db *DB) Entries(fn func(key, value []byte) error) error {
+	if db.latest == nil {
+		latest := make(map[string]uint64)
+		err := db.scan(func(key []byte, trailer uint64, _ []byte) error {
+			if trailer>>8 >= latest[string(key)]>>8 {
+				latest[string(key)] = trailer
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		db.latest = latest
+	}
+
+	return db.scan(func(key []byte, trailer uint64, value []byte) error {
+		if trailer&0xff != kindValue || db.latest[string(key)] != trailer {
+			return nil
+		}
+		return fn(key, value)
+	})
+}
+
+// Len returns the number of live keys, reading the database on first use
+func (db *DB) Len() (int, error) {
+	if err := db.Entries(func(_, _ []byte) error { return nil }); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, trailer := range db.latest {
+		if trailer&0xff == kindValue {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// scan calls fn with every version of every key in the tables and logs
+func (db *DB) scan(fn func(key []byte, trailer uint64, value []byte) error) error {
+	for _, table := range db.tables {
+		err := readTable(table, func(key, value []byte) error {
+			if len(key) < 8 {
+				return fmt.Errorf("%w: %s has a key without trailer", ErrCorrupt, table)
+			}
+			return fn(key[:len(key)-8], binary.LittleEndian.Uint64(key[len(key)-8:]), value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, log := range db.logs {
+		if err := readLog(log, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLog calls fn with the records of the write batches in a log file
+func readLog(path string, fn func(key []byte, trailer uint64, value []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := &logReader{r: bufio.NewReader(file)}
+	for {
+		batch, err := r.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if len(batch) < 12 {
+			return fmt.Errorf("%w: %s has a short write batch", ErrCorrupt, path)
+		}
+		sequence := binary.LittleEndian.Uint64(batch[0:8])
+		count := binary.LittleEndian.Uint32(batch[8:12])
+		d := decoder{data: batch[12:]}
+		for i := uint32(0); i < count; i++ {
+			kind := d.byte()
+			key := d.bytes()
+			var value []byte
+			if kind == kindValue {
+				value = d.bytes()
+			} else if kind != kindDeletion {
+				return fmt.Errorf("%w: %s has an unknown record kind %d", ErrCorrupt, path, kind)
+			}
+			if d.err != nil {
+				return fmt.Errorf("%s: %w", path, d.err)
+			}
+			if err := fn(key, (sequence+uint64(i))<<8|uint64(kind), value); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decoder reads the varints and length-prefixed strings of MANIFEST edits
+// and write batches, remembering the first error
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = fmt.Errorf("%w: invalid varint", ErrCorrupt)
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.data) == 0 {
+		d.err = fmt.Errorf("%w: unexpected end of record", ErrCorrupt)
+		return 0
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b
+}
+
+func (d *decoder) bytes() []byte {
+	length := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if length > uint64(len(d.data)) {
+		d.err = fmt.Errorf("%w: unexpected end of record", ErrCorrupt)
+		return nil
+	}
+	b := d.data[:length]
+	d.data = d.data[length:]
+	return b
+}
+
+// Check verifies that the tables and logs of the database exist and that
+// every table ends in a valid footer, without reading their contents
+func (db *DB) Check() error {
+	for _, table := range db.tables {
+		file, err := os.Open(table)
+		if err != nil {
+			return err
+		}
+		footer := make([]byte, footerSize)
+		info, err := file.Stat()
+		if err == nil && info.Size() >= footerSize {
+			_, err = file.ReadAt(footer, info.Size()-footerSize)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if info.Size() < footerSize || binary.LittleEndian.Uint64(footer[footerSize-8:]) != tableMagic {
+			return fmt.Errorf("%w: %s is not a table", ErrCorrupt, table)
+		}
+	}
+	for _, log := range db.logs {
+		if _, err := os.Stat(log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package leveldb
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Log files, including the MANIFEST, are split into 32 KiB blocks holding
+// records with a 7 byte header: checksum, length and fragment type
+const (
+	blockSize  = 32768
+	headerSize = 7
+
+	recordFull   = 1
+	recordFirst  = 2
+	recordMiddle = 3
+	recordLast   = 4
+)
+
+// ErrCorrupt is returned for damaged database files
+var ErrCorrupt = errors.New("leveldb: corrupt database")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the masked CRC-32C LevelDB stores for a type byte and
+// the data it describes
+func checksum(data []byte, kind byte) uint32 {
+	c := crc32.Update(0, crcTable, []byte{kind})
+	c = crc32.Update(c, crcTable, data)
+	return (c>>15 | c<<17) + 0xa282ead8
+}
+
+// logReader reads the records of a log file
+type logReader struct {
+	r     io.Reader
+	block []byte
+}
+
+// next returns the next record, io.EOF after the last one. A record cut
+// off at the end of the file, as left by a crash while it was written, is
+// treated as the end of the log, like LevelDB does.
+func (l *logReader) next() ([]byte, error) {
+	var record []byte
+	fragmented := false
+	for {
+		if len(l.block) < headerSize {
+			buf := make([]byte, blockSize)
+			n, err := io.ReadFull(l.r, buf)
+			if n == 0 {
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return nil, io.EOF
+				}
+				return nil, err
+			}
+			l.block = buf[:n]
+			continue
+		}
+
+		length := int(binary.LittleEndian.Uint16(l.block[4:6]))
+		kind := l.block[6]
+		if kind == 0 && length == 0 {
+			// Zeroed trailer of a block or preallocated space
+			l.block = nil
+			continue
+		}
+		if headerSize+length > len(l.block) {
+			return nil, io.EOF
+		}
+		data := l.block[headerSize : headerSize+length]
+		if checksum(data, kind) != binary.LittleEndian.Uint32(l.block[0:4]) {
+			return nil, ErrCorrupt
+		}
+		l.block = l.block[headerSize+length:]
+
+		switch kind {
+		case recordFull:
+			if fragmented {
+				return nil, ErrCorrupt
+			}
+			return append([]byte(nil), data...), nil
+		case recordFirst:
+			if fragmented {
+				return nil, ErrCorrupt
+			}
+			record = append([]byte(nil), data...)
+			fragmented = true
+		case recordMiddle, recordLast:
+			if !fragmented {
+				return nil, ErrCorrupt
+			}
+			record = append(record, data...)
+			if kind == recordLast {
+				return record, nil
+			}
+		default:
+			return nil, ErrCorrupt
+		}
+	}
+}
+
+// logWriter writes records to a log file
+type logWriter struct {
+	w      io.Writer
+	offset int
+}
+
+func (l *logWriter) write(record []byte) error {
+	first := true
+	for {
+		left := blockSize - l.offset
+		if left < headerSize {
+			if _, err := l.w.Write(make([]byte, left)); err != nil {
+				return err
+			}
+			l.offset, left = 0, blockSize
+		}
+
+		n := min(len(record), left-headerSize)
+		last := n == len(record)
+		kind := byte(recordMiddle)
+		switch {
+		case first && last:
+			kind = recordFull
+		case first:
+			kind = recordFirst
+		case last:
+			kind = recordLast
+		}
+
+		var header [headerSize]byte
+		binary.LittleEndian.PutUint32(header[0:4], checksum(record[:n], kind))
+		binary.LittleEndian.PutUint16(header[4:6], uint16(n))
+		header[6] = kind
+		if _, err := l.w.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := l.w.Write(record[:n]); err != nil {
+			return err
+		}
+		l.offset += headerSize + n
+		record, first = record[n:], false
+		if last {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package leveldb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// A table file ends in a 48 byte footer holding the handles of its
+// metaindex and index blocks and a magic number
+const (
+	footerSize = 48
+	tableMagic = 0xdb4775248b80fb57
+)
+
+// Block compression types; Bedrock uses raw deflate, older versions zlib
+const (
+	compressionNone    = 0
+	compressionZlib    = 2
+	compressionDeflate = 4
+)
+
+// blockHandle locates a block in a table file
+type blockHandle struct {
+	offset uint64
+	size   uint64
+}
+
+func decodeHandle(data []byte) (blockHandle, int) {
+	offset, n := binary.Uvarint(data)
+	if n <= 0 {
+		return blockHandle{}, 0
+	}
+	size, m := binary.Uvarint(data[n:])
+	if m <= 0 {
+		return blockHandle{}, 0
+	}
+	return blockHandle{offset: offset, size: size}, n + m
+}
+
+// readTable calls fn with every internal key and value of a table file in
+// key order. key and value are only valid during the call.
+func readTable(path string, fn func(key, value []byte) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(data) < footerSize || binary.LittleEndian.Uint64(data[len(data)-8:]) != tableMagic {
+		return fmt.Errorf("%w: %s is not a table", ErrCorrupt, path)
+	}
+	footer := data[len(data)-footerSize:]
+	_, n := decodeHandle(footer)
+	if n == 0 {
+		return fmt.Errorf("%w: %s has an invalid footer", ErrCorrupt, path)
+	}
+	indexHandle, m := decodeHandle(footer[n:])
+	if m == 0 {
+		return fmt.Errorf("%w: %s has an invalid footer", ErrCorrupt, path)
+	}
+
+	index, err := readBlock(data, indexHandle)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return iterateBlock(index, func(_, value []byte) error {
+		handle, n := decodeHandle(value)
+		if n == 0 {
+			return fmt.Errorf("%w: %s has an invalid index", ErrCorrupt, path)
+		}
+		block, err := readBlock(data, handle)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return iterateBlock(block, fn)
+	})
+}
+
+// readBlock verifies and decompresses a block of a table file
+func readBlock(data []byte, handle blockHandle) ([]byte, error) {
+	end := handle.offset + handle.size
+	if end < handle.offset || end+5 > uint64(len(data)) {
+		return nil, fmt.Errorf("%w: block out of bounds", ErrCorrupt)
+	}
+	contents := data[handle.offset:end]
+	compression := data[end]
+
+	// Unlike log records, the checksum covers the contents first
+	c := crc32.Update(0, crcTable, contents)
+	c = crc32.Update(c, crcTable, []byte{compression})
+	if (c>>15|c<<17)+0xa282ead8 != binary.LittleEndian.Uint32(data[end+1:end+5]) {
+		return nil, fmt.Errorf("%w: block checksum mismatch", ErrCorrupt)
+	}
+
+	var r io.ReadCloser
+	switch compression {
+	case compressionNone:
+		return contents, nil
+	case compressionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		r = zr
+	case compressionDeflate:
+		r = flate.NewReader(bytes.NewReader(contents))
+	default:
+		return nil, fmt.Errorf("leveldb: unsupported block compression %d", compression)
+	}
+	defer r.Close()
+	block, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return block, nil
+}
+
+// iterateBlock calls fn with the entries of a block. Keys share prefixes
+// with their predecessor; the restart points at the end of the block are
+// only needed for seeking and are skipped.
+func iterateBlock(block []byte, fn func(key, value []byte) error) error {
+	if len(block) < 4 {
+		return fmt.Errorf("%w: block too short", ErrCorrupt)
+	}
+	restarts := int(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	limit := len(block) - 4 - 4*restarts
+	if restarts < 0 || limit < 0 {
+		return fmt.Errorf("%w: invalid block trailer", ErrCorrupt)
+	}
+
+	entries := block[:limit]
+	var key []byte
+	for len(entries) > 0 {
+		var fields [3]uint64
+		for i := range fields {
+			v, n := binary.Uvarint(entries)
+			if n <= 0 {
+				return fmt.Errorf("%w: invalid block entry", ErrCorrupt)
+			}
+			fields[i], entries = v, entries[n:]
+		}
+		shared, unshared, valueLength := fields[0], fields[1], fields[2]
+		if shared > uint64(len(key)) || unshared+valueLength > uint64(len(entries)) {
+			return fmt.Errorf("%w: invalid block entry", ErrCorrupt)
+		}
+		key = append(key[:shared], entries[:unshared]...)
+		if err := fn(key, entries[unshared:unshared+valueLength]); err != nil {
+			return err
+		}
+		entries = entries[unshared+valueLength:]
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package leveldb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// maxBatchSize is the size at which Create starts a new write batch
+const maxBatchSize = 1 << 20
+
+// File numbers of a database written by Create
+const (
+	createdManifest = 2
+	createdLog      = 3
+)
+
+// Create writes a new database into dir, which must not exist, with the
+// entries fill puts. The entries go into the log, which LevelDB compacts
+// into tables the first time the database is opened.
+func Create(dir string, fill func(put func(key, value []byte) error) error) error {
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%06d.log", createdLog)))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buffered := bufio.NewWriter(file)
+	log := &logWriter{w: buffered}
+
+	sequence := uint64(1)
+	var batch []byte
+	var count uint32
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		binary.LittleEndian.PutUint64(batch[0:8], sequence)
+		binary.LittleEndian.PutUint32(batch[8:12], count)
+		if err := log.write(batch); err != nil {
+			return err
+		}
+		sequence += uint64(count)
+		batch, count = batch[:0], 0
+		return nil
+	}
+	put := func(key, value []byte) error {
+		if count == 0 {
+			batch = append(batch[:0], make([]byte, 12)...)
+		}
+		batch = append(batch, kindValue)
+		batch = binary.AppendUvarint(batch, uint64(len(key)))
+		batch = append(batch, key...)
+		batch = binary.AppendUvarint(batch, uint64(len(value)))
+		batch = append(batch, value...)
+		count++
+		if len(batch) >= maxBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	if err := fill(put); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	var edit []byte
+	edit = binary.AppendUvarint(edit, tagComparator)
+	edit = binary.AppendUvarint(edit, uint64(len(comparator)))
+	edit = append(edit, comparator...)
+	edit = binary.AppendUvarint(edit, tagLogNumber)
+	edit = binary.AppendUvarint(edit, createdLog)
+	edit = binary.AppendUvarint(edit, tagNextFileNumber)
+	edit = binary.AppendUvarint(edit, createdLog+1)
+	edit = binary.AppendUvarint(edit, tagLastSequence)
+	edit = binary.AppendUvarint(edit, sequence-1)
+
+	manifestName := fmt.Sprintf("MANIFEST-%06d", createdManifest)
+	manifest, err := os.Create(filepath.Join(dir, manifestName))
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	if err := (&logWriter{w: manifest}).write(edit); err != nil {
+		return err
+	}
+	if err := manifest.Sync(); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "CURRENT"), []byte(manifestName+"\n"), 0644)
+}
@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// journalSocket is where journald receives entries in its native protocol
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalIdentifier is the SYSLOG_IDENTIFIER of the manager's entries,
+// e.g. for journalctl -t party
+const journalIdentifier = "party"
+
+// journalHook sends log entries to journald with their level as priority
+// and their fields as journal fields, independent of the log format
+type journalHook struct {
+	enabled atomic.Bool
+
+	mu   sync.Mutex
+	conn *net.UnixConn
+}
+
+// open connects to the journal socket unless connected already
+func (h *journalHook) open() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", journalSocket, err)
+	}
+	h.conn = conn
+	return nil
+}
+
+func (h *journalHook) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+}
+
+func (h *journalHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *journalHook) Fire(entry *logrus.Entry) error {
+	if !h.enabled.Load() {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	writeJournalField(&buf, "MESSAGE", entry.Message)
+	writeJournalField(&buf, "PRIORITY", fmt.Sprint(journalPriority(entry.Level)))
+	writeJournalField(&buf, "SYSLOG_IDENTIFIER", journalIdentifier)
+	for key, value := range entry.Data {
+		if name := journalFieldName(key); name != "" && name != "MESSAGE" && name != "PRIORITY" && name != "SYSLOG_IDENTIFIER" {
+			writeJournalField(&buf, name, fmt.Sprint(value))
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return nil
+	}
+	_, err := h.conn.Write(buf.Bytes())
+	return err
+}
+
+// writeJournalField appends a field in the native journal protocol: as
+// NAME=value, or with its length in front when the value spans lines
+func writeJournalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalFieldName turns a logrus field into a journal field name, which
+// consists of upper case letters, digits and underscores and must not
+// start with an underscore. It returns "" for fields that cannot be named.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		default:
+			return '_'
+		}
+	}, key)
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return ""
+	}
+	return name
+}
+
+// journalPriority maps a log level to a syslog priority
+func journalPriority(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return 0
+	case logrus.FatalLevel:
+		return 2
+	case logrus.ErrorLevel:
+		return 3
+	case logrus.WarnLevel:
+		return 4
+	case logrus.InfoLevel:
+		return 6
+	default:
+		return 7
+	}
+}
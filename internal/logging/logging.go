@@ -0,0 +1,151 @@
+// Package logging configures the manager's own log: its level, its format
+// and where it is written, and changes them while the manager runs.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+
+	"minecraft-server-manager/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Settings are the parts of the log configuration that can be changed at
+// runtime
+type Settings struct {
+	Level   string   `json:"level"`
+	Format  string   `json:"format"`
+	Outputs []string `json:"outputs"`
+}
+
+// Logging applies a log configuration to a logger
+type Logging struct {
+	logger *logrus.Logger
+
+	mu      sync.Mutex
+	config  config.LogConfig
+	file    *rotatingFile
+	journal *journalHook
+}
+
+// New configures logger as cfg says
+func New(logger *logrus.Logger, cfg config.LogConfig) (*Logging, error) {
+	l := &Logging{logger: logger, journal: &journalHook{}}
+	logger.AddHook(l.journal)
+	if err := l.apply(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Settings returns the current level, format and outputs
+func (l *Logging) Settings() Settings {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Settings{
+		Level:   l.config.Level,
+		Format:  l.config.Format,
+		Outputs: slices.Clone(l.config.Outputs),
+	}
+}
+
+// Update changes the level, format and outputs. Empty fields are left as
+// they are; the log file path can only be set in the configuration.
+func (l *Logging) Update(settings Settings) (Settings, error) {
+	l.mu.Lock()
+	cfg := l.config
+	l.mu.Unlock()
+
+	if settings.Level != "" {
+		cfg.Level = settings.Level
+	}
+	if settings.Format != "" {
+		cfg.Format = settings.Format
+	}
+	if settings.Outputs != nil {
+		cfg.Outputs = settings.Outputs
+	}
+	if err := cfg.Validate(); err != nil {
+		return Settings{}, err
+	}
+	if err := l.apply(cfg); err != nil {
+		return Settings{}, err
+	}
+	l.logger.Infof("Log settings changed: level %s, format %s, outputs %v", cfg.Level, cfg.Format, cfg.Outputs)
+	return l.Settings(), nil
+}
+
+// apply opens the outputs of cfg, then switches the logger over to them
+// and closes the outputs no longer used
+func (l *Logging) apply(cfg config.LogConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	level, err := logrus.ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file := l.file
+	if slices.Contains(cfg.Outputs, config.LogOutputFile) {
+		if file == nil || file.path != cfg.File.Path {
+			file, err = openRotatingFile(cfg.File)
+			if err != nil {
+				return fmt.Errorf("file: %w", err)
+			}
+		}
+	} else {
+		file = nil
+	}
+	journal := slices.Contains(cfg.Outputs, config.LogOutputJournald)
+	if journal {
+		if err := l.journal.open(); err != nil {
+			if file != nil && file != l.file {
+				file.Close()
+			}
+			return fmt.Errorf("journald: %w", err)
+		}
+	}
+
+	var writers []io.Writer
+	if slices.Contains(cfg.Outputs, config.LogOutputStderr) {
+		writers = append(writers, os.Stderr)
+	}
+	if file != nil {
+		writers = append(writers, file)
+	}
+	var out io.Writer = io.Discard
+	if len(writers) > 0 {
+		out = io.MultiWriter(writers...)
+	}
+
+	var formatter logrus.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	if cfg.Format == config.LogFormatJSON {
+		formatter = &logrus.JSONFormatter{}
+	}
+
+	l.logger.SetOutput(out)
+	l.logger.SetFormatter(formatter)
+	l.logger.SetLevel(level)
+	l.journal.enabled.Store(journal)
+	if !journal {
+		l.journal.close()
+	}
+
+	if l.file != nil && l.file != file {
+		if err := l.file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			l.logger.Warnf("Failed to close log file: %v", err)
+		}
+	}
+	l.file = file
+	l.config = cfg
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package metrics defines the metric set reported by the manager and the
+// exporters that publish it.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kind is the type of a metric
+type Kind string
+
+// Metric kinds
+const (
+	Gauge   Kind = "gauge"
+	Counter Kind = "counter"
+)
+
+// Metric is one sample of the metric set. Counters only ever increase for
+// the lifetime of the manager process.
+type Metric struct {
+	Name   string
+	Help   string
+	Kind   Kind
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector returns the current samples of the metric set
+type Collector func() []Metric
+
+// WritePrometheus writes samples in the Prometheus text exposition format,
+// grouping samples of the same metric. Metric names are prefixed with
+// prefix and an underscore.
+func WritePrometheus(w io.Writer, prefix string, samples []Metric) error {
+	var names []string
+	families := make(map[string][]Metric)
+	for _, sample := range samples {
+		if _, exists := families[sample.Name]; !exists {
+			names = append(names, sample.Name)
+		}
+		families[sample.Name] = append(families[sample.Name], sample)
+	}
+
+	for _, family := range names {
+		first := families[family][0]
+		name := family
+		if prefix != "" {
+			name = prefix + "_" + family
+		}
+
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, first.Help, name, first.Kind); err != nil {
+			return err
+		}
+		for _, sample := range families[family] {
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(sample.Labels), formatValue(sample.Value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, key := range sortedKeys(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, strconv.Quote(labels[key])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return strconv.FormatInt(int64(value), 10)
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
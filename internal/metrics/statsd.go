@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxDatagram keeps StatsD packets below common network MTUs
+const maxDatagram = 1432
+
+// StatsD pushes the metric set to a StatsD agent at a fixed interval.
+// Labels are sent as DogStatsD tags and counters as the increase since the
+// previous flush.
+type StatsD struct {
+	conn     net.Conn
+	prefix   string
+	tags     []string
+	interval time.Duration
+	logger   *logrus.Logger
+
+	// counters holds the counter values sent by the previous flush
+	counters map[string]float64
+}
+
+// NewStatsD creates an exporter sending to the configured agent
+func NewStatsD(cfg config.StatsDConfig, logger *logrus.Logger) (*StatsD, error) {
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD agent at %s: %w", cfg.Address, err)
+	}
+
+	return &StatsD{
+		conn:     conn,
+		prefix:   cfg.Prefix,
+		tags:     cfg.Tags,
+		interval: time.Duration(cfg.Interval) * time.Second,
+		logger:   logger,
+		counters: make(map[string]float64),
+	}, nil
+}
+
+// Run flushes the collected metrics every interval until ctx is cancelled
+func (s *StatsD) Run(ctx context.Context, collect Collector) {
+	defer s.conn.Close()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(collect()); err != nil {
+				s.logger.Warnf("Failed to send metrics to StatsD: %v", err)
+			}
+		}
+	}
+}
+
+// Flush sends one round of samples
+func (s *StatsD) Flush(samples []Metric) error {
+	var packet strings.Builder
+	for _, sample := range samples {
+		line := s.line(sample)
+		if line == "" {
+			continue
+		}
+
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxDatagram {
+			if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		if _, err := s.conn.Write([]byte(packet.String())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// line formats a sample, or returns an empty string for counters that did
+// not change since the previous flush
+func (s *StatsD) line(sample Metric) string {
+	name := sample.Name
+	if s.prefix != "" {
+		name = s.prefix + "." + name
+	}
+
+	tags := append([]string(nil), s.tags...)
+	for _, key := range sortedKeys(sample.Labels) {
+		tags = append(tags, key+":"+sample.Labels[key])
+	}
+
+	value, kind := sample.Value, "g"
+	if sample.Kind == Counter {
+		key := name + "|" + strings.Join(tags, ",")
+		value -= s.counters[key]
+		s.counters[key] = sample.Value
+		if value <= 0 {
+			return ""
+		}
+		kind = "c"
+	}
+
+	line := fmt.Sprintf("%s:%s|%s", name, formatValue(value), kind)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
@@ -0,0 +1,291 @@
+// Package mirror reads and publishes Bedrock binaries and world templates
+// in an internal repository, either a simple HTTP layout or an OCI
+// registry, for sites without or with little internet access.
+//
+// The HTTP layout is
+//
+//	bedrock/<version>/bedrock-server-<version>.zip
+//	templates/<sha256>.zip
+//
+// and an OCI registry holds them as <repository>/bedrock:<version> and
+// <repository>/templates:sha256-<sha256>, each with the archive as its only
+// layer.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// ErrNotFound is returned for artifacts the mirror does not have
+var ErrNotFound = errors.New("not found in mirror")
+
+// Artifact kinds
+const (
+	KindBedrock  = "bedrock"
+	KindTemplate = "templates"
+)
+
+// Artifact is one file of the mirror: a Bedrock version or a world
+// template by its SHA-256 checksum
+type Artifact struct {
+	Kind string
+	Name string
+}
+
+// Bedrock is the dedicated server archive of a Bedrock version
+func Bedrock(version string) Artifact {
+	return Artifact{Kind: KindBedrock, Name: version}
+}
+
+// Template is a world template archive by its SHA-256 checksum
+func Template(checksum string) Artifact {
+	return Artifact{Kind: KindTemplate, Name: strings.ToLower(checksum)}
+}
+
+// FileName is the name of the artifact's archive
+func (a Artifact) FileName() string {
+	if a.Kind == KindBedrock {
+		return fmt.Sprintf("bedrock-server-%s.zip", a.Name)
+	}
+	return a.Name + ".zip"
+}
+
+// Path is where the artifact lives in the HTTP layout
+func (a Artifact) Path() string {
+	if a.Kind == KindBedrock {
+		return path.Join(KindBedrock, a.Name, a.FileName())
+	}
+	return path.Join(KindTemplate, a.FileName())
+}
+
+// tag is the artifact's tag in an OCI registry
+func (a Artifact) tag() string {
+	if a.Kind == KindTemplate {
+		return "sha256-" + a.Name
+	}
+	return a.Name
+}
+
+func (a Artifact) String() string {
+	if a.Kind == KindBedrock {
+		return "Bedrock " + a.Name
+	}
+	return "world template " + a.Name
+}
+
+// requestTimeout bounds transfers of one artifact
+const requestTimeout = 30 * time.Minute
+
+// Mirror is a repository of artifacts
+type Mirror struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+
+	// registry is set for OCI registries
+	registry *registry
+}
+
+// New opens the configured mirror, nil when none is configured. The
+// configuration has been validated when it was loaded.
+func New(cfg config.MirrorConfig) *Mirror {
+	if cfg.URL == "" {
+		return nil
+	}
+	base, _ := url.Parse(cfg.URL)
+	m := &Mirror{
+		base:     base,
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+	if strings.HasPrefix(base.Scheme, "oci") {
+		scheme := "https"
+		if base.Scheme == "oci+http" {
+			scheme = "http"
+		}
+		m.registry = &registry{
+			mirror:     m,
+			endpoint:   scheme + "://" + base.Host,
+			repository: strings.Trim(base.Path, "/"),
+			tokens:     make(map[string]string),
+		}
+	}
+	return m
+}
+
+// Location describes where the mirror keeps an artifact, for logs
+func (m *Mirror) Location(a Artifact) string {
+	if m.registry != nil {
+		return fmt.Sprintf("%s/%s/%s:%s", m.base.Host, m.registry.repository, a.Kind, a.tag())
+	}
+	return strings.TrimSuffix(m.base.Redacted(), "/") + "/" + a.Path()
+}
+
+// Fetch writes an artifact to w. ErrNotFound is returned when the mirror
+// does not have it.
+func (m *Mirror) Fetch(ctx context.Context, a Artifact, w io.Writer) error {
+	if m.registry != nil {
+		return m.registry.fetch(ctx, a, w)
+	}
+	if m.base.Scheme == "file" {
+		file, err := os.Open(filepath.Join(m.base.Path, filepath.FromSlash(a.Path())))
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", a, ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(w, file)
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.Location(a), nil)
+	if err != nil {
+		return err
+	}
+	m.authenticate(req)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s: %w", a, ErrNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, m.Location(a))
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Has reports whether the mirror has an artifact
+func (m *Mirror) Has(ctx context.Context, a Artifact) (bool, error) {
+	if m.registry != nil {
+		return m.registry.has(ctx, a)
+	}
+	if m.base.Scheme == "file" {
+		_, err := os.Stat(filepath.Join(m.base.Path, filepath.FromSlash(a.Path())))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, m.Location(a), nil)
+	if err != nil {
+		return false, err
+	}
+	m.authenticate(req)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, m.Location(a))
+}
+
+// Publish stores the archive at file as an artifact. HTTP layouts are
+// written with PUT, as WebDAV servers and artifact repositories accept.
+func (m *Mirror) Publish(ctx context.Context, a Artifact, file string) error {
+	if m.registry != nil {
+		return m.registry.publish(ctx, a, file)
+	}
+	if m.base.Scheme == "file" {
+		return copyFile(file, filepath.Join(m.base.Path, filepath.FromSlash(a.Path())))
+	}
+
+	source, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, m.Location(a), source)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/zip")
+	m.authenticate(req)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, m.Location(a))
+	}
+	return nil
+}
+
+func (m *Mirror) authenticate(req *http.Request) {
+	if m.username != "" || m.password != "" {
+		req.SetBasicAuth(m.username, m.password)
+	}
+}
+
+// copyFile copies source to target through a temporary file, so that
+// readers never see a partial artifact
+func copyFile(source, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := target + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
+
+// registry reads and writes artifacts in an OCI registry through the
+// distribution API
+type registry struct {
+	mirror     *Mirror
+	endpoint   string
+	repository string
+
+	// tokens are bearer tokens by scope
+	mu     sync.Mutex
+	tokens map[string]string
+}
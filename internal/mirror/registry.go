@@ -0,0 +1,344 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Media types of the OCI image and distribution specifications
+const (
+	manifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	emptyMediaType    = "application/vnd.oci.empty.v1+json"
+	archiveMediaType  = "application/zip"
+	artifactType      = "application/vnd.party.artifact.v1"
+)
+
+// emptyConfig is the config blob of artifacts, which carry none
+var emptyConfig = []byte("{}")
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	ArtifactType  string       `json:"artifactType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// name is the repository of an artifact kind
+func (r *registry) name(a Artifact) string {
+	return r.repository + "/" + a.Kind
+}
+
+func (r *registry) fetch(ctx context.Context, a Artifact, w io.Writer) error {
+	name := r.name(a)
+	resp, err := r.do(ctx, name, false, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v2/%s/manifests/%s", r.endpoint, name, a.tag()), nil)
+		if err == nil {
+			req.Header.Set("Accept", manifestMediaType)
+		}
+		return req, err
+	})
+	if err != nil {
+		return err
+	}
+	var m manifest
+	err = decodeResponse(resp, &m)
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", a, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest of %s: %w", r.mirror.Location(a), err)
+	}
+	if len(m.Layers) != 1 {
+		return fmt.Errorf("%s has %d layers, expected one archive", r.mirror.Location(a), len(m.Layers))
+	}
+
+	resp, err = r.do(ctx, name, false, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v2/%s/blobs/%s", r.endpoint, name, m.Layers[0].Digest), nil)
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d for the archive of %s", resp.StatusCode, r.mirror.Location(a))
+	}
+	// The blob is verified against its digest while it streams, so an
+	// archive altered on the registry or on the way is rejected
+	digest := m.Layers[0].Digest
+	if !strings.HasPrefix(digest, "sha256:") {
+		return fmt.Errorf("unsupported digest %q of %s", digest, r.mirror.Location(a))
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), resp.Body); err != nil {
+		return err
+	}
+	if sum := "sha256:" + hex.EncodeToString(hash.Sum(nil)); sum != digest {
+		return fmt.Errorf("archive of %s has digest %s, expected %s", r.mirror.Location(a), sum, digest)
+	}
+	return nil
+}
+
+func (r *registry) has(ctx context.Context, a Artifact) (bool, error) {
+	name := r.name(a)
+	resp, err := r.do(ctx, name, false, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf("%s/v2/%s/manifests/%s", r.endpoint, name, a.tag()), nil)
+		if err == nil {
+			req.Header.Set("Accept", manifestMediaType)
+		}
+		return req, err
+	})
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("unexpected status %d for %s", resp.StatusCode, r.mirror.Location(a))
+}
+
+// publish uploads the archive and an empty config as blobs and tags a
+// manifest of them
+func (r *registry) publish(ctx context.Context, a Artifact, file string) error {
+	name := r.name(a)
+	layer, err := fileDescriptor(file)
+	if err != nil {
+		return err
+	}
+	layer.MediaType = archiveMediaType
+	layer.Annotations = map[string]string{"org.opencontainers.image.title": a.FileName()}
+	config := descriptor{MediaType: emptyMediaType, Digest: digestOf(emptyConfig), Size: int64(len(emptyConfig))}
+
+	if err := r.uploadBlob(ctx, name, config, func() (io.Reader, error) { return bytes.NewReader(emptyConfig), nil }); err != nil {
+		return fmt.Errorf("failed to upload config: %w", err)
+	}
+	var open *os.File
+	defer func() {
+		if open != nil {
+			open.Close()
+		}
+	}()
+	err = r.uploadBlob(ctx, name, layer, func() (io.Reader, error) {
+		if open != nil {
+			open.Close()
+		}
+		open, err = os.Open(file)
+		return open, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload archive: %w", err)
+	}
+
+	data, err := json.Marshal(manifest{
+		SchemaVersion: 2,
+		MediaType:     manifestMediaType,
+		ArtifactType:  artifactType,
+		Config:        config,
+		Layers:        []descriptor{layer},
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := r.do(ctx, name, true, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("%s/v2/%s/manifests/%s", r.endpoint, name, a.tag()), bytes.NewReader(data))
+		if err == nil {
+			req.Header.Set("Content-Type", manifestMediaType)
+		}
+		return req, err
+	})
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, nil)
+}
+
+// uploadBlob uploads a blob in one request unless the registry has it
+func (r *registry) uploadBlob(ctx context.Context, name string, blob descriptor, body func() (io.Reader, error)) error {
+	resp, err := r.do(ctx, name, true, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, fmt.Sprintf("%s/v2/%s/blobs/%s", r.endpoint, name, blob.Digest), nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = r.do(ctx, name, true, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/v2/%s/blobs/uploads/", r.endpoint, name), nil)
+	})
+	if err != nil {
+		return err
+	}
+	location := resp.Header.Get("Location")
+	if err := decodeResponse(resp, nil); err != nil {
+		return err
+	}
+	upload, err := resp.Request.URL.Parse(location)
+	if err != nil || location == "" {
+		return fmt.Errorf("registry returned no upload location")
+	}
+	query := upload.Query()
+	query.Set("digest", blob.Digest)
+	upload.RawQuery = query.Encode()
+
+	resp, err = r.do(ctx, name, true, func() (*http.Request, error) {
+		reader, err := body()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, upload.String(), reader)
+		if err == nil {
+			req.ContentLength = blob.Size
+			req.Header.Set("Content-Type", "application/octet-stream")
+		}
+		return req, err
+	})
+	if err != nil {
+		return err
+	}
+	return decodeResponse(resp, nil)
+}
+
+// do sends a request, authenticating with a bearer token for the
+// repository when the registry asks for one. newRequest is called again
+// for the retry, so bodies are read anew.
+func (r *registry) do(ctx context.Context, name string, push bool, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	scope := "repository:" + name + ":pull"
+	if push {
+		scope += ",push"
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		token := r.tokens[scope]
+		r.mu.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			r.mirror.authenticate(req)
+		}
+
+		resp, err := r.mirror.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			return nil, fmt.Errorf("registry %s refused the credentials", r.endpoint)
+		}
+		if token, err = r.login(ctx, challenge, scope); err != nil {
+			return nil, fmt.Errorf("failed to log in to registry %s: %w", r.endpoint, err)
+		}
+		r.mu.Lock()
+		r.tokens[scope] = token
+		r.mu.Unlock()
+	}
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// login gets a bearer token for a scope from the realm of a challenge
+func (r *registry) login(ctx context.Context, challenge, scope string) (string, error) {
+	params := make(map[string]string)
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid challenge %q", challenge)
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	r.mirror.authenticate(req)
+	resp, err := r.mirror.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	var answer struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := decodeResponse(resp, &answer); err != nil {
+		return "", err
+	}
+	if answer.Token != "" {
+		return answer.Token, nil
+	}
+	if answer.AccessToken != "" {
+		return answer.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token in answer of %s", realm.Host)
+}
+
+// decodeResponse closes a response, decoding its JSON body into v unless
+// nil, and fails on statuses other than 2xx
+func decodeResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// fileDescriptor returns the digest and size of a file
+func fileDescriptor(path string) (descriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return descriptor{}, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return descriptor{}, err
+	}
+	return descriptor{Digest: "sha256:" + hex.EncodeToString(hash.Sum(nil)), Size: size}, nil
+}
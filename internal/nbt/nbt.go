@@ -0,0 +1,397 @@
+// Package nbt reads and writes the little-endian NBT format used by
+// Minecraft Bedrock Edition, e.g. in a world's level.dat.
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Tag types
+const (
+	TagEnd byte = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+// Tag is a named value inside a compound. Value holds int8, int16, int32,
+// int64, float32, float64, []byte, string, List, Compound, []int32 or []int64
+// depending on Type.
+type Tag struct {
+	Type  byte
+	Name  string
+	Value interface{}
+}
+
+// Compound is an ordered list of named tags. Order is preserved so files can
+// be rewritten without reshuffling their contents.
+type Compound []Tag
+
+// List is a homogeneous list of unnamed values.
+type List struct {
+	ElemType byte
+	Items    []interface{}
+}
+
+// Get returns the tag with the given name.
+func (c Compound) Get(name string) (*Tag, bool) {
+	for i := range c {
+		if c[i].Name == name {
+			return &c[i], true
+		}
+	}
+	return nil, false
+}
+
+// Set replaces the value of the named tag, appending it if it does not exist.
+func (c *Compound) Set(name string, tagType byte, value interface{}) {
+	if tag, ok := c.Get(name); ok {
+		tag.Type = tagType
+		tag.Value = value
+		return
+	}
+	*c = append(*c, Tag{Type: tagType, Name: name, Value: value})
+}
+
+// maxLevelDatSize bounds the level.dat files read. Real ones are a few
+// kilobytes; a world from an import must not make the manager read more.
+const maxLevelDatSize = 16 << 20
+
+// maxDepth bounds the nesting of lists and compounds
+const maxDepth = 512
+
+// LevelDat is a Bedrock level.dat file: an 8 byte header followed by the
+// root compound.
+type LevelDat struct {
+	StorageVersion int32
+	Root           Compound
+}
+
+// ReadLevelDat reads and parses a Bedrock level.dat file.
+func ReadLevelDat(path string) (*LevelDat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxLevelDatSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxLevelDatSize {
+		return nil, fmt.Errorf("level.dat larger than %d bytes", maxLevelDatSize)
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("level.dat too short")
+	}
+
+	version := int32(binary.LittleEndian.Uint32(data[0:4]))
+	length := int(binary.LittleEndian.Uint32(data[4:8]))
+	if length != len(data)-8 {
+		return nil, fmt.Errorf("level.dat length mismatch (header: %d, actual: %d)", length, len(data)-8)
+	}
+
+	root, err := Decode(data[8:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse level.dat: %w", err)
+	}
+
+	return &LevelDat{StorageVersion: version, Root: root}, nil
+}
+
+// Decode parses a named root compound, as stored in level.dat after its
+// header and in the values of a world's database.
+func Decode(data []byte) (Compound, error) {
+	r := &reader{r: bytes.NewReader(data)}
+	tagType, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if tagType != TagCompound {
+		return nil, fmt.Errorf("root is not a compound (type %d)", tagType)
+	}
+	if _, err := r.string(); err != nil {
+		return nil, err
+	}
+	return r.compound()
+}
+
+// WriteLevelDat writes a Bedrock level.dat file.
+func WriteLevelDat(path string, level *LevelDat) error {
+	var body bytes.Buffer
+	w := &writer{w: &body}
+	w.byte(TagCompound)
+	w.string("")
+	w.compound(level.Root)
+	if w.err != nil {
+		return w.err
+	}
+
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[0:4], uint32(level.StorageVersion))
+	binary.LittleEndian.PutUint32(header[4:8], uint32(body.Len()))
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, append(header[:], body.Bytes()...), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// reader decodes NBT from memory. Lengths read from the data are checked
+// against the bytes left before anything is allocated for them, so that
+// crafted data cannot make it allocate more than its own size.
+type reader struct {
+	r     *bytes.Reader
+	depth int
+}
+
+func (r *reader) read(v interface{}) error {
+	return binary.Read(r.r, binary.LittleEndian, v)
+}
+
+func (r *reader) byte() (byte, error) {
+	var v byte
+	err := r.read(&v)
+	return v, err
+}
+
+func (r *reader) length() (int, error) {
+	var n int32
+	if err := r.read(&n); err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("negative length %d", n)
+	}
+	return int(n), nil
+}
+
+// elements reads the length of an array or list and checks that the data
+// left holds that many elements of at least size bytes each
+func (r *reader) elements(size int) (int, error) {
+	n, err := r.length()
+	if err != nil {
+		return 0, err
+	}
+	if left := r.r.Len(); int64(n)*int64(size) > int64(left) {
+		return 0, fmt.Errorf("length %d exceeds the %d bytes left", n, left)
+	}
+	return n, nil
+}
+
+// minSize is the smallest encoding of a payload of each tag type
+var minSize = map[byte]int{
+	TagByte:      1,
+	TagShort:     2,
+	TagInt:       4,
+	TagLong:      8,
+	TagFloat:     4,
+	TagDouble:    8,
+	TagByteArray: 4,
+	TagString:    2,
+	TagList:      5,
+	TagCompound:  1,
+	TagIntArray:  4,
+	TagLongArray: 4,
+}
+
+func (r *reader) string() (string, error) {
+	var n uint16
+	if err := r.read(&n); err != nil {
+		return "", err
+	}
+	if left := r.r.Len(); int(n) > left {
+		return "", fmt.Errorf("string length %d exceeds the %d bytes left", n, left)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (r *reader) compound() (Compound, error) {
+	if r.depth++; r.depth > maxDepth {
+		return nil, fmt.Errorf("nested deeper than %d levels", maxDepth)
+	}
+	defer func() { r.depth-- }()
+
+	var c Compound
+	for {
+		tagType, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		if tagType == TagEnd {
+			return c, nil
+		}
+		name, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.payload(tagType)
+		if err != nil {
+			return nil, fmt.Errorf("tag %q: %w", name, err)
+		}
+		c = append(c, Tag{Type: tagType, Name: name, Value: value})
+	}
+}
+
+func (r *reader) payload(tagType byte) (interface{}, error) {
+	switch tagType {
+	case TagByte:
+		var v int8
+		return v, r.read(&v)
+	case TagShort:
+		var v int16
+		return v, r.read(&v)
+	case TagInt:
+		var v int32
+		return v, r.read(&v)
+	case TagLong:
+		var v int64
+		return v, r.read(&v)
+	case TagFloat:
+		var v uint32
+		err := r.read(&v)
+		return math.Float32frombits(v), err
+	case TagDouble:
+		var v uint64
+		err := r.read(&v)
+		return math.Float64frombits(v), err
+	case TagByteArray:
+		n, err := r.elements(1)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]byte, n)
+		_, err = io.ReadFull(r.r, v)
+		return v, err
+	case TagString:
+		return r.string()
+	case TagList:
+		elemType, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, known := minSize[elemType]
+		if !known {
+			size = 1
+		}
+		n, err := r.elements(size)
+		if err != nil {
+			return nil, err
+		}
+		if r.depth++; r.depth > maxDepth {
+			return nil, fmt.Errorf("nested deeper than %d levels", maxDepth)
+		}
+		defer func() { r.depth-- }()
+		list := List{ElemType: elemType}
+		for i := 0; i < n; i++ {
+			item, err := r.payload(elemType)
+			if err != nil {
+				return nil, err
+			}
+			list.Items = append(list.Items, item)
+		}
+		return list, nil
+	case TagCompound:
+		return r.compound()
+	case TagIntArray:
+		n, err := r.elements(4)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int32, n)
+		return v, r.read(v)
+	case TagLongArray:
+		n, err := r.elements(8)
+		if err != nil {
+			return nil, err
+		}
+		v := make([]int64, n)
+		return v, r.read(v)
+	default:
+		return nil, fmt.Errorf("unknown tag type %d", tagType)
+	}
+}
+
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (w *writer) write(v interface{}) {
+	if w.err == nil {
+		w.err = binary.Write(w.w, binary.LittleEndian, v)
+	}
+}
+
+func (w *writer) byte(v byte) {
+	w.write(v)
+}
+
+func (w *writer) string(s string) {
+	w.write(uint16(len(s)))
+	w.write([]byte(s))
+}
+
+func (w *writer) compound(c Compound) {
+	for _, tag := range c {
+		w.byte(tag.Type)
+		w.string(tag.Name)
+		w.payload(tag.Type, tag.Value)
+	}
+	w.byte(TagEnd)
+}
+
+func (w *writer) payload(tagType byte, value interface{}) {
+	if w.err != nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case int8, int16, int32, int64:
+		w.write(v)
+	case []int32:
+		w.write(int32(len(v)))
+		w.write(v)
+	case []int64:
+		w.write(int32(len(v)))
+		w.write(v)
+	case float32:
+		w.write(math.Float32bits(v))
+	case float64:
+		w.write(math.Float64bits(v))
+	case []byte:
+		w.write(int32(len(v)))
+		w.write(v)
+	case string:
+		w.string(v)
+	case List:
+		w.byte(v.ElemType)
+		w.write(int32(len(v.Items)))
+		for _, item := range v.Items {
+			w.payload(v.ElemType, item)
+		}
+	case Compound:
+		w.compound(v)
+	default:
+		w.err = fmt.Errorf("unsupported value %T for tag type %d", value, tagType)
+	}
+}
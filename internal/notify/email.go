@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/mail"
+)
+
+// email mails notifications to one recipient
+type email struct {
+	smtp config.SMTPConfig
+	to   string
+}
+
+func (e *email) Name() string {
+	return "email " + e.to
+}
+
+func (e *email) Send(ctx context.Context, notification Notification) error {
+	return mail.Send(ctx, e.smtp, mail.Message{
+		To:      []string{e.to},
+		Subject: fmt.Sprintf("[%s] %s", notification.Severity, notification.Title),
+		Body:    emailBody(notification),
+	})
+}
+
+// emailBody renders a notification as plain text, the message followed by
+// its details
+func emailBody(notification Notification) string {
+	var body strings.Builder
+	body.WriteString(notification.Message)
+	body.WriteString("\n\n")
+	detail := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&body, "%s: %s\n", key, value)
+		}
+	}
+	detail("Severity", notification.Severity)
+	detail("Server", notification.Server)
+	detail("Tenant", notification.Tenant)
+	for _, values := range []map[string]string{notification.Fields, notification.Labels, notification.Annotations} {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			detail(key, values[key])
+		}
+	}
+	detail("Time", notification.Time.Format(time.RFC1123))
+	return body.String()
+}
@@ -0,0 +1,299 @@
+// Package notify delivers notifications about the manager and its servers
+// to the configured sinks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/telegram"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Severities of a notification
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Notification is a message sent to every sink. Tenant, Labels and
+// Annotations are those of Server and filled in by the notifier. Event is
+// one of config.NotificationEvents and selects the templates applied.
+type Notification struct {
+	Event       string            `json:"event,omitempty"`
+	Title       string            `json:"title"`
+	Message     string            `json:"message"`
+	Severity    string            `json:"severity"`
+	Server      string            `json:"server,omitempty"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	Time        time.Time         `json:"time"`
+}
+
+// SeverityRank orders severities, unknown ones rank as warnings
+func SeverityRank(severity string) int {
+	switch severity {
+	case SeverityInfo:
+		return 0
+	case SeverityCritical:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// ServerDetails describe the server a notification is about
+type ServerDetails struct {
+	Tenant      string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// ServerInfo looks up the details of a server
+type ServerInfo func(server string) ServerDetails
+
+// Sink delivers notifications to one destination
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, notification Notification) error
+}
+
+// route is a sink with the tenant and server labels a notification must
+// carry to be sent to it
+type route struct {
+	sink        Sink
+	tenant      string
+	matchLabels map[string]string
+	// minSeverity drops less severe notifications when set
+	minSeverity string
+	// templates are the sink's own templates followed by the shared ones
+	templates []messageTemplates
+}
+
+// matches reports whether a notification is routed to the sink
+func (r route) matches(notification Notification) bool {
+	if r.tenant != "" && notification.Tenant != r.tenant {
+		return false
+	}
+	if r.minSeverity != "" && SeverityRank(notification.Severity) < SeverityRank(r.minSeverity) {
+		return false
+	}
+	if len(r.matchLabels) == 0 {
+		return true
+	}
+	if notification.Server == "" {
+		return false
+	}
+	for key, value := range r.matchLabels {
+		if notification.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Notifier fans notifications out to all sinks
+type Notifier struct {
+	routes     []route
+	cooldown   time.Duration
+	quietHours *config.QuietHours
+	logger     *logrus.Logger
+
+	mu         sync.Mutex
+	serverInfo ServerInfo
+	// lastSent is when each notification was last sent, for the cooldown
+	lastSent map[string]time.Time
+}
+
+// NewNotifier creates a notifier for the configured sinks. Telegram chats
+// receive notifications when a bot is configured.
+func NewNotifier(cfg config.NotificationsConfig, bot *config.TelegramConfig, logger *logrus.Logger) *Notifier {
+	notifier := &Notifier{
+		cooldown:   time.Duration(cfg.Cooldown) * time.Minute,
+		quietHours: cfg.QuietHours,
+		logger:     logger,
+		lastSent:   make(map[string]time.Time),
+	}
+	shared := parseTemplates(cfg.Templates)
+	for _, webhook := range cfg.Webhooks {
+		notifier.routes = append(notifier.routes, route{
+			sink:        newWebhook(webhook),
+			tenant:      webhook.Tenant,
+			matchLabels: webhook.MatchLabels,
+			templates:   []messageTemplates{parseTemplates(webhook.Templates), shared},
+		})
+	}
+	if cfg.Email != nil {
+		for _, recipient := range cfg.Email.Recipients {
+			notifier.routes = append(notifier.routes, route{
+				sink:        &email{smtp: cfg.Email.SMTP, to: recipient.Address},
+				tenant:      recipient.Tenant,
+				matchLabels: recipient.MatchLabels,
+				minSeverity: recipient.Severity,
+				templates:   []messageTemplates{parseTemplates(recipient.Templates), shared},
+			})
+		}
+	}
+	if bot != nil {
+		client := telegram.NewClient(bot.Token)
+		botTemplates := parseTemplates(bot.Templates)
+		for _, chatID := range bot.ChatIDs {
+			notifier.routes = append(notifier.routes, route{
+				sink:        &telegramChat{client: client, chatID: chatID},
+				minSeverity: bot.Severity,
+				templates:   []messageTemplates{botTemplates, shared},
+			})
+		}
+	}
+	return notifier
+}
+
+// SetServerInfo sets how the details of a notification's server are looked
+// up
+func (n *Notifier) SetServerInfo(info ServerInfo) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.serverInfo = info
+}
+
+// Notify sends a notification to every sink it is routed to in the
+// background. Delivery failures are logged. A nil notifier discards
+// notifications.
+func (n *Notifier) Notify(notification Notification) {
+	if n == nil || len(n.routes) == 0 {
+		return
+	}
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	if reason := n.suppress(notification); reason != "" {
+		n.logger.Infof("Not sending notification %q (%s)", notification.Title, reason)
+		return
+	}
+
+	n.mu.Lock()
+	info := n.serverInfo
+	n.mu.Unlock()
+
+	// The lookup runs in the background as callers may hold locks it needs
+	go func() {
+		if info != nil && notification.Server != "" {
+			details := info(notification.Server)
+			if notification.Tenant == "" {
+				notification.Tenant = details.Tenant
+			}
+			if notification.Labels == nil {
+				notification.Labels = details.Labels
+			}
+			if notification.Annotations == nil {
+				notification.Annotations = details.Annotations
+			}
+		}
+
+		for _, r := range n.routes {
+			if !r.matches(notification) {
+				continue
+			}
+			go func(sink Sink, notification Notification) {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+
+				if err := sink.Send(ctx, notification); err != nil {
+					n.logger.Warnf("Failed to send notification %q to %s: %v", notification.Title, sink.Name(), err)
+				}
+			}(r.sink, n.render(r, notification))
+		}
+	}()
+}
+
+// suppress returns why a notification is held back by quiet hours or the
+// cooldown, or an empty string when it is sent. Repeats are recognized by
+// event, server and title, so that different alerts about one server are
+// not mistaken for each other.
+func (n *Notifier) suppress(notification Notification) string {
+	if q := n.quietHours; q != nil && q.Contains(notification.Time) && SeverityRank(notification.Severity) < SeverityRank(q.Severity) {
+		return "quiet hours"
+	}
+	if n.cooldown <= 0 {
+		return ""
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	key := notification.Event + "\x00" + notification.Server + "\x00" + notification.Title
+	if last, sent := n.lastSent[key]; sent && notification.Time.Sub(last) < n.cooldown {
+		return fmt.Sprintf("sent less than %s ago", n.cooldown)
+	}
+	for other, last := range n.lastSent {
+		if notification.Time.Sub(last) >= n.cooldown {
+			delete(n.lastSent, other)
+		}
+	}
+	n.lastSent[key] = notification.Time
+	return ""
+}
+
+// webhook posts notifications as JSON
+type webhook struct {
+	name    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newWebhook(cfg config.WebhookConfig) *webhook {
+	name := cfg.Name
+	if name == "" {
+		name = "webhook"
+	}
+	return &webhook{
+		name:    name,
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (w *webhook) Name() string {
+	return w.name
+}
+
+func (w *webhook) Send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"minecraft-server-manager/internal/telegram"
+)
+
+// severityIcons mark the severity at the start of Telegram messages
+var severityIcons = map[string]string{
+	SeverityInfo:     "ℹ️",
+	SeverityWarning:  "⚠️",
+	SeverityCritical: "🚨",
+}
+
+// telegramChat sends notifications to one Telegram chat
+type telegramChat struct {
+	client *telegram.Client
+	chatID int64
+}
+
+func (t *telegramChat) Name() string {
+	return fmt.Sprintf("telegram chat %d", t.chatID)
+}
+
+func (t *telegramChat) Send(ctx context.Context, notification Notification) error {
+	text := notification.Title + "\n\n" + notification.Message
+	if icon := severityIcons[notification.Severity]; icon != "" {
+		text = icon + " " + text
+	}
+	return t.client.SendMessage(ctx, t.chatID, text)
+}
@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"bytes"
+	"text/template"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// messageTemplate replaces the title and message of a notification. A nil
+// template keeps the original text.
+type messageTemplate struct {
+	title   *template.Template
+	message *template.Template
+}
+
+// messageTemplates are the templates of a sink by event, "*" applying to
+// any event
+type messageTemplates map[string]messageTemplate
+
+// parseTemplates parses configured templates, which were checked when the
+// configuration was loaded
+func parseTemplates(cfg config.NotificationTemplates) messageTemplates {
+	parse := func(name, text string) *template.Template {
+		if text == "" {
+			return nil
+		}
+		return template.Must(template.New(name).Option("missingkey=zero").Parse(text))
+	}
+	templates := make(messageTemplates, len(cfg))
+	for event, tmpl := range cfg {
+		templates[event] = messageTemplate{title: parse("title", tmpl.Title), message: parse("message", tmpl.Message)}
+	}
+	return templates
+}
+
+// lookup finds the templates for an event. Templates of the event win over
+// "*", and within each the sink's own over the shared ones.
+func (r route) lookup(event string) (title, message *template.Template) {
+	for _, key := range []string{event, "*"} {
+		for _, templates := range r.templates {
+			tmpl := templates[key]
+			if title == nil {
+				title = tmpl.title
+			}
+			if message == nil {
+				message = tmpl.message
+			}
+		}
+	}
+	return title, message
+}
+
+// render applies the templates of a route to a notification. Templates
+// that fail leave the original text.
+func (n *Notifier) render(r route, notification Notification) Notification {
+	title, message := r.lookup(notification.Event)
+	rendered := notification
+	execute := func(tmpl *template.Template, text *string) {
+		if tmpl == nil {
+			return
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, notification); err != nil {
+			n.logger.Warnf("Failed to render notification %q for %s: %v", notification.Title, r.sink.Name(), err)
+			return
+		}
+		*text = out.String()
+	}
+	execute(title, &rendered.Title)
+	execute(message, &rendered.Message)
+	return rendered
+}
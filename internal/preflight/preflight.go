@@ -0,0 +1,406 @@
+// Package preflight checks that the host can run Bedrock servers: shared
+// libraries, ports, file descriptor limits, disk space, the GitHub token and
+// the clock. Every problem comes with a fix the operator can apply.
+package preflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// Statuses of a check
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// Thresholds
+const (
+	minOpenFiles     = 4096
+	warnFreeBytes    = 2 << 30
+	failFreeBytes    = 500 << 20
+	warnClockSkew    = 30 * time.Second
+	failClockSkew    = 5 * time.Minute
+	libraryTimeout   = 10 * time.Second
+	githubAPI        = "https://api.github.com"
+	extractedBedrock = "./bedrock-server-extracted/bedrock_server"
+	bedrockArchive   = "versions/bedrock-server.zip"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// Options select what is checked. Servers are the configured servers whose
+// ports must be free; when nil only the HTTP port is checked.
+type Options struct {
+	Config     *config.Config
+	Servers    []config.MinecraftServerConfig
+	Skip       []string
+	HTTPClient *http.Client
+}
+
+// Run performs every check that is not skipped
+func Run(ctx context.Context, opts Options) []Result {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	// The token check also reads the clock of GitHub's API
+	var githubDate time.Time
+	checks := map[string]func() Result{
+		config.CheckBedrockLibraries: func() Result { return checkBedrockLibraries(opts.Config) },
+		config.CheckPorts:            func() Result { return checkPorts(opts.Config, opts.Servers) },
+		config.CheckOpenFiles:        checkOpenFiles,
+		config.CheckDiskSpace:        func() Result { return checkDiskSpace(opts.Config.Server.BaseDir) },
+		config.CheckGitHubToken: func() Result {
+			var result Result
+			result, githubDate = checkGitHubToken(ctx, opts.HTTPClient, opts.Config.GitHub.Token)
+			return result
+		},
+		config.CheckClock: func() Result { return checkClock(ctx, opts.HTTPClient, githubDate) },
+	}
+
+	var results []Result
+	for _, name := range config.PreflightChecks {
+		if slices.Contains(opts.Skip, name) {
+			continue
+		}
+		result := checks[name]()
+		result.Check = name
+		results = append(results, result)
+	}
+	return results
+}
+
+// Failed reports whether any check failed
+func Failed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func ok(format string, args ...interface{}) Result {
+	return Result{Status: StatusOK, Message: fmt.Sprintf(format, args...)}
+}
+
+func warn(fix, format string, args ...interface{}) Result {
+	return Result{Status: StatusWarn, Message: fmt.Sprintf(format, args...), Fix: fix}
+}
+
+func fail(fix, format string, args ...interface{}) Result {
+	return Result{Status: StatusFail, Message: fmt.Sprintf(format, args...), Fix: fix}
+}
+
+// glibcVersion matches the symbol versions ldd reports as missing
+var glibcVersion = regexp.MustCompile("`(GLIBC(?:XX)?_[0-9.]+)' not found")
+
+// checkBedrockLibraries checks the libraries of the Bedrock executable
+// the manager runs by default
+func checkBedrockLibraries(cfg *config.Config) Result {
+	if runtime.GOOS != "linux" {
+		return warn("Run the manager on Linux", "the Bedrock server only runs on Linux, not %s", runtime.GOOS)
+	}
+
+	path := cfg.Server.BedrockPath
+	if _, err := os.Stat(bedrockArchive); err == nil {
+		path = extractedBedrock
+	}
+	if _, err := os.Stat(path); err != nil {
+		if path == extractedBedrock {
+			return ok("%s is extracted when the manager starts", bedrockArchive)
+		}
+		return warn("Download the Bedrock server from minecraft.net and set server.bedrock_path",
+			"Bedrock executable %s not found", path)
+	}
+	return CheckLibraries(path)
+}
+
+// libraryPackage names the packages that install a shared library on
+// Debian and Ubuntu, and on Fedora and RHEL
+type libraryPackage struct {
+	apt, dnf string
+}
+
+// libraryPackages are the packages of the libraries Bedrock links against
+// that minimal hosts and containers lack
+var libraryPackages = map[string]libraryPackage{
+	"libssl.so.3":      {"libssl3", "openssl-libs"},
+	"libcrypto.so.3":   {"libssl3", "openssl-libs"},
+	"libssl.so.1.1":    {"libssl1.1", "compat-openssl11"},
+	"libcrypto.so.1.1": {"libssl1.1", "compat-openssl11"},
+	"libcurl.so.4":     {"libcurl4", "libcurl"},
+	"libz.so.1":        {"zlib1g", "zlib"},
+	"libstdc++.so.6":   {"libstdc++6", "libstdc++"},
+	"libgcc_s.so.1":    {"libgcc-s1", "libgcc"},
+	"libnsl.so.2":      {"libnsl2", "libnsl"},
+}
+
+// CheckLibraries lists the shared libraries of an executable, with ldd or,
+// where ldd is not installed, the dynamic loader it wraps, to find the
+// libraries and glibc symbol versions the host lacks. A failure names the
+// packages to install. The commands are killed when they hang, as a
+// loader that ignores LD_TRACE_LOADED_OBJECTS runs the server instead.
+func CheckLibraries(path string) Result {
+	ctx, cancel := context.WithTimeout(context.Background(), libraryTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "ldd", path).CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		// The loader lists the libraries instead of running the program
+		cmd := exec.CommandContext(ctx, path)
+		cmd.Env = append(os.Environ(), "LD_TRACE_LOADED_OBJECTS=1")
+		output, err = cmd.CombinedOutput()
+	}
+
+	var missing, versions []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if match := glibcVersion.FindStringSubmatch(line); match != nil {
+			if !slices.Contains(versions, match[1]) {
+				versions = append(versions, match[1])
+			}
+			continue
+		}
+		if library, _, found := strings.Cut(strings.TrimSpace(line), " => not found"); found && !slices.Contains(missing, library) {
+			missing = append(missing, library)
+		}
+	}
+	sort.Strings(versions)
+
+	switch {
+	case len(versions) > 0:
+		host := "the host glibc"
+		if version, err := exec.CommandContext(ctx, "getconf", "GNU_LIBC_VERSION").Output(); err == nil {
+			host = "the host's " + strings.TrimSpace(string(version))
+		}
+		return fail("Run the manager on a distribution with a newer glibc, such as Ubuntu 22.04 or Debian 12",
+			"%s lacks %s needed by %s", host, strings.Join(versions, ", "), path)
+	case len(missing) > 0:
+		return fail(installFix(missing), "%s needs missing libraries: %s", path, strings.Join(missing, ", "))
+	case ctx.Err() != nil:
+		return fail("Install ldd, which comes with the libc-bin or glibc-common package",
+			"listing the libraries of %s timed out after %s", path, libraryTimeout)
+	case err != nil:
+		// ldd fails on binaries for another architecture
+		return fail("Run the manager on an x86_64 Linux host",
+			"cannot inspect the libraries of %s: %s", path, strings.TrimSpace(string(output)))
+	}
+	return ok("all libraries of %s are present", path)
+}
+
+// installFix tells which packages install the missing libraries
+func installFix(missing []string) string {
+	var apt, dnf, unknown []string
+	for _, library := range missing {
+		pkg, known := libraryPackages[library]
+		if !known {
+			unknown = append(unknown, library)
+			continue
+		}
+		if !slices.Contains(apt, pkg.apt) {
+			apt = append(apt, pkg.apt)
+		}
+		if !slices.Contains(dnf, pkg.dnf) {
+			dnf = append(dnf, pkg.dnf)
+		}
+	}
+
+	fix := "Install the missing libraries with your package manager"
+	if len(apt) > 0 {
+		fix = fmt.Sprintf("Install them with apt install %s on Debian and Ubuntu, or dnf install %s on Fedora and RHEL",
+			strings.Join(apt, " "), strings.Join(dnf, " "))
+	}
+	if len(apt) > 0 && len(unknown) > 0 {
+		fix += fmt.Sprintf("; find the packages of %s with apt-file search or dnf provides", strings.Join(unknown, ", "))
+	}
+	return fix
+}
+
+// checkPorts binds the UDP ports of the configured servers and the TCP port
+// of the HTTP API to see whether another process holds them
+func checkPorts(cfg *config.Config, servers []config.MinecraftServerConfig) Result {
+	var busy []string
+	checked := 0
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.HTTP.Port))
+	if err != nil {
+		busy = append(busy, fmt.Sprintf("tcp/%d (http)", cfg.HTTP.Port))
+	} else {
+		listener.Close()
+	}
+	checked++
+
+	for _, server := range servers {
+		ports := []int{server.Port}
+		if cfg.Proxy.Enabled {
+			ports = append(ports, server.Port+cfg.Proxy.PortOffset)
+		}
+		for _, port := range ports {
+			checked++
+			conn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
+			if err != nil {
+				busy = append(busy, fmt.Sprintf("udp/%d (%s)", port, server.Name))
+				continue
+			}
+			conn.Close()
+		}
+	}
+
+	if len(busy) > 0 {
+		return fail("Stop the process holding the port (find it with ss -ulpn or ss -tlpn) or change the port in the configuration",
+			"ports in use: %s", strings.Join(busy, ", "))
+	}
+	if servers == nil {
+		return ok("HTTP port %d is free, no server ports to check", cfg.HTTP.Port)
+	}
+	return ok("all %d ports are free", checked)
+}
+
+// checkOpenFiles checks the file descriptor limit, which every server, world
+// database and player connection draws from
+func checkOpenFiles() Result {
+	limit, err := openFilesLimit()
+	if err != nil {
+		return warn("", "cannot read the open files limit: %v", err)
+	}
+	if limit < minOpenFiles {
+		return warn(fmt.Sprintf("Raise the limit to at least %d: LimitNOFILE=%d in the systemd unit, or ulimit -n %d", minOpenFiles, minOpenFiles, minOpenFiles),
+			"open files limit is %d", limit)
+	}
+	return ok("open files limit is %d", limit)
+}
+
+// checkDiskSpace checks the free space where servers and worlds are kept
+func checkDiskSpace(dir string) Result {
+	// The directory is created on the first apply, check its parent until then
+	path := dir
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+
+	free, err := freeSpace(path)
+	if err != nil {
+		return warn("", "cannot read the free space of %s: %v", path, err)
+	}
+	switch {
+	case free < failFreeBytes:
+		return fail("Free up space or move server.base_dir to a larger volume", "only %s free in %s", formatBytes(free), path)
+	case free < warnFreeBytes:
+		return warn("Free up space or move server.base_dir to a larger volume; worlds and backups grow over time",
+			"%s free in %s", formatBytes(free), path)
+	}
+	return ok("%s free in %s", formatBytes(free), path)
+}
+
+// checkGitHubToken asks the GitHub API for the token's rate limit, which
+// also tells whether the token is accepted. It returns the server's clock
+// for the skew check.
+func checkGitHubToken(ctx context.Context, client *http.Client, token string) (Result, time.Time) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubAPI+"/rate_limit", nil)
+	if err != nil {
+		return fail("", "%v", err), time.Time{}
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fail("Check DNS, the firewall and HTTPS_PROXY; the manager polls api.github.com",
+			"cannot reach the GitHub API: %v", err), time.Time{}
+	}
+	resp.Body.Close()
+	date, _ := http.ParseTime(resp.Header.Get("Date"))
+
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fail("Create a new token and set github.token or $GITHUB_TOKEN",
+			"GitHub rejected the token, it is invalid, expired or revoked"), date
+	case resp.StatusCode != http.StatusOK:
+		return warn("", "GitHub answered HTTP %d", resp.StatusCode), date
+	case token == "":
+		return warn("Set github.token or $GITHUB_TOKEN to raise the limit to 5000 requests per hour",
+			"no GitHub token, unauthenticated requests are limited to %s per hour", resp.Header.Get("X-RateLimit-Limit")), date
+	}
+	if n, err := strconv.Atoi(remaining); err == nil && n < 100 {
+		return warn("Wait for the limit to reset, or use a separate token for this manager",
+			"the token is valid but only %d requests are left this hour", n), date
+	}
+	return ok("the token is valid, %s requests left this hour", remaining), date
+}
+
+// checkClock compares the local clock with GitHub's. Commit signatures,
+// OIDC tokens and schedules all rely on an accurate clock.
+func checkClock(ctx context.Context, client *http.Client, remote time.Time) Result {
+	if remote.IsZero() {
+		// The token check was skipped or failed, ask GitHub directly
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, githubAPI, nil)
+		if err == nil {
+			if resp, err := client.Do(req); err == nil {
+				resp.Body.Close()
+				remote, _ = http.ParseTime(resp.Header.Get("Date"))
+			}
+		}
+	}
+	if remote.IsZero() {
+		return warn("Make sure api.github.com is reachable", "the clock could not be compared with GitHub's")
+	}
+
+	// The Date header has a resolution of one second
+	skew := time.Since(remote).Truncate(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	fix := "Enable time synchronization with timedatectl set-ntp true, or install chrony"
+	switch {
+	case skew > failClockSkew:
+		return fail(fix, "the clock is off by %s", skew)
+	case skew > warnClockSkew:
+		return warn(fix, "the clock is off by %s", skew)
+	}
+	return ok("the clock is within %s of GitHub's", warnClockSkew)
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1 << 10
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
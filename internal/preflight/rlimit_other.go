@@ -0,0 +1,10 @@
+//go:build !unix
+
+package preflight
+
+import "errors"
+
+// openFilesLimit is only implemented on Unix systems
+func openFilesLimit() (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
@@ -0,0 +1,13 @@
+package preflight
+
+import "syscall"
+
+// freeSpace returns the disk space available to unprivileged users on the
+// filesystem of path
+func freeSpace(path string) (uint64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+	return uint64(fs.Bavail) * uint64(fs.Bsize), nil
+}
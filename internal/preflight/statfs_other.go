@@ -0,0 +1,10 @@
+//go:build !linux
+
+package preflight
+
+import "errors"
+
+// freeSpace is only implemented on Linux
+func freeSpace(path string) (uint64, error) {
+	return 0, errors.New("not supported on this platform")
+}
@@ -0,0 +1,416 @@
+// Package proxy forwards UDP traffic from a server's public port to the port
+// the Bedrock server listens on, accounting for the traffic on the way.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxPacket is larger than any RakNet datagram
+const maxPacket = 65535
+
+// Stats counts the traffic through a proxy. In is traffic from clients to
+// the server, Out from the server to clients. Dropped packets are counted by
+// reason and not included in PacketsIn.
+type Stats struct {
+	BytesIn            uint64 `json:"bytes_in"`
+	BytesOut           uint64 `json:"bytes_out"`
+	PacketsIn          uint64 `json:"packets_in"`
+	PacketsOut         uint64 `json:"packets_out"`
+	Sessions           int    `json:"sessions"`
+	DroppedBlocked     uint64 `json:"dropped_blocked"`
+	DroppedRateLimited uint64 `json:"dropped_rate_limited"`
+	DroppedSessions    uint64 `json:"dropped_sessions"`
+	DroppedGeo         uint64 `json:"dropped_geo"`
+
+	// Queued is the number of clients waiting for a slot, QueueAdmitted
+	// counts the clients let through while the queue was enabled and
+	// DroppedQueueFull the join attempts refused because the queue was full
+	Queued           int    `json:"queued"`
+	QueueAdmitted    uint64 `json:"queue_admitted"`
+	DroppedQueueFull uint64 `json:"dropped_queue_full"`
+
+	// Countries counts open sessions by client country, "unknown" for
+	// addresses without a country
+	Countries map[string]int `json:"countries,omitempty"`
+}
+
+// Options control a proxy. Packets from addresses in Blocklist are
+// dropped. PacketsPerSecond and Burst limit the packets accepted per source
+// IP and MaxSessionsPerIP the number of source ports one IP may use.
+// MaxSessions caps the sessions and source IPs tracked at once, so a flood
+// from spoofed addresses cannot grow them without bound; zero disables a
+// limit. Country resolves client countries when a GeoIP database is
+// available. Queue holds joins to a full server.
+type Options struct {
+	SessionTimeout   time.Duration
+	MaxSessions      int
+	Blocklist        []*net.IPNet
+	PacketsPerSecond float64
+	Burst            int
+	MaxSessionsPerIP int
+	Country          func(net.IP) string
+	Countries        CountryPolicy
+	Queue            QueueOptions
+}
+
+// CountryPolicy admits new sessions by client country. With Allow set only
+// the listed countries may connect; countries in Deny never may. Addresses
+// without a country, such as private ranges, are always admitted.
+type CountryPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+func (c CountryPolicy) admits(country string) bool {
+	if country == "" {
+		return true
+	}
+	for _, denied := range c.Deny {
+		if strings.EqualFold(country, denied) {
+			return false
+		}
+	}
+	if len(c.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range c.Allow {
+		if strings.EqualFold(country, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseCIDRs parses CIDR ranges and single IP addresses
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, value := range values {
+		if ip := net.ParseIP(value); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address or CIDR range %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Proxy relays datagrams between clients and one backend. Each client gets
+// its own backend socket so replies can be routed back.
+type Proxy struct {
+	name    string
+	conn    *net.UDPConn
+	backend *net.UDPAddr
+	options Options
+	logger  *logrus.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	sources  map[string]*source
+	closed   chan struct{}
+
+	// queue lists the clients waiting for a slot, admitted those let
+	// through that have not joined yet
+	queue              []*queueEntry
+	admitted           []admission
+	online, maxPlayers int
+	serverGUID         atomic.Uint64
+
+	// motd replaces the MOTD in ping responses when set
+	motd string
+
+	bytesIn, bytesOut, packetsIn, packetsOut                        atomic.Uint64
+	droppedBlocked, droppedRateLimited, droppedSessions, droppedGeo atomic.Uint64
+	queueAdmitted, droppedQueueFull                                 atomic.Uint64
+}
+
+// source tracks the sessions, the token bucket and the country of one
+// client IP
+type source struct {
+	sessions int
+	tokens   float64
+	updated  time.Time
+	country  string
+}
+
+type session struct {
+	client   *net.UDPAddr
+	conn     *net.UDPConn
+	lastSeen atomic.Int64
+}
+
+// Listen starts a proxy on port forwarding to backendPort on localhost
+func Listen(name string, port, backendPort int, options Options, logger *logrus.Logger) (*Proxy, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on port %d: %w", port, err)
+	}
+
+	p := &Proxy{
+		name:     name,
+		conn:     conn,
+		backend:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: backendPort},
+		options:  options,
+		logger:   logger,
+		sessions: make(map[string]*session),
+		sources:  make(map[string]*source),
+		closed:   make(chan struct{}),
+	}
+
+	go p.serve()
+	go p.expireSessions()
+	return p, nil
+}
+
+// Stats returns the traffic counted so far
+func (p *Proxy) Stats() Stats {
+	p.mu.Lock()
+	sessions := len(p.sessions)
+	queued := len(p.queue)
+	var countries map[string]int
+	if p.options.Country != nil {
+		countries = make(map[string]int)
+		for _, src := range p.sources {
+			if src.sessions == 0 {
+				continue
+			}
+			country := src.country
+			if country == "" {
+				country = "unknown"
+			}
+			countries[country] += src.sessions
+		}
+	}
+	p.mu.Unlock()
+
+	return Stats{
+		BytesIn:            p.bytesIn.Load(),
+		BytesOut:           p.bytesOut.Load(),
+		PacketsIn:          p.packetsIn.Load(),
+		PacketsOut:         p.packetsOut.Load(),
+		Sessions:           sessions,
+		DroppedBlocked:     p.droppedBlocked.Load(),
+		DroppedRateLimited: p.droppedRateLimited.Load(),
+		DroppedSessions:    p.droppedSessions.Load(),
+		DroppedGeo:         p.droppedGeo.Load(),
+		Queued:             queued,
+		QueueAdmitted:      p.queueAdmitted.Load(),
+		DroppedQueueFull:   p.droppedQueueFull.Load(),
+		Countries:          countries,
+	}
+}
+
+// SetCountryPolicy replaces the country policy for new sessions
+func (p *Proxy) SetCountryPolicy(policy CountryPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.options.Countries = policy
+}
+
+// Close stops the proxy and all sessions
+func (p *Proxy) Close() error {
+	close(p.closed)
+	err := p.conn.Close()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, s := range p.sessions {
+		s.conn.Close()
+		delete(p.sessions, key)
+	}
+	return err
+}
+
+// serve relays datagrams from clients to the backend
+func (p *Proxy) serve() {
+	buf := make([]byte, maxPacket)
+	for {
+		n, client, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			p.logger.Warnf("Proxy for %s failed to read: %v", p.name, err)
+			continue
+		}
+
+		if p.blocked(client.IP) {
+			p.droppedBlocked.Add(1)
+			continue
+		}
+		if isPing(buf[:n]) {
+			p.touchQueue(client.IP.String())
+		} else if isOpenConnection(buf[:n]) && !p.admit(client.IP.String()) {
+			p.refuse(client)
+			continue
+		}
+
+		s, err := p.session(client)
+		if err != nil {
+			if !errors.Is(err, errDropped) {
+				p.logger.Warnf("Proxy for %s failed to open session for %s: %v", p.name, client, err)
+			}
+			continue
+		}
+		s.lastSeen.Store(time.Now().UnixNano())
+
+		if _, err := s.conn.Write(buf[:n]); err != nil {
+			continue
+		}
+		p.bytesIn.Add(uint64(n))
+		p.packetsIn.Add(1)
+	}
+}
+
+// errDropped is returned for packets dropped by a limit
+var errDropped = errors.New("dropped")
+
+// blocked reports whether an address is in the blocklist
+func (p *Proxy) blocked(ip net.IP) bool {
+	for _, network := range p.options.Blocklist {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// session returns the session of a client, creating it if needed, after
+// charging the packet to the client's rate limit
+func (p *Proxy) session(client *net.UDPAddr) (*session, error) {
+	ip := client.IP.String()
+
+	// The country of a new source is looked up before taking p.mu, so a
+	// slow GeoIP database does not hold up other clients
+	var country string
+	if p.options.Country != nil {
+		p.mu.Lock()
+		_, exists := p.sources[ip]
+		p.mu.Unlock()
+		if !exists {
+			country = p.options.Country(client.IP)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	src, exists := p.sources[ip]
+	if !exists {
+		if p.options.MaxSessions > 0 && len(p.sources) >= p.options.MaxSessions {
+			p.droppedSessions.Add(1)
+			return nil, errDropped
+		}
+		src = &source{tokens: float64(p.options.Burst), updated: now, country: country}
+		p.sources[ip] = src
+	}
+
+	if p.options.PacketsPerSecond > 0 {
+		elapsed := now.Sub(src.updated).Seconds()
+		src.tokens = min(src.tokens+elapsed*p.options.PacketsPerSecond, float64(max(p.options.Burst, 1)))
+		src.updated = now
+		if src.tokens < 1 {
+			p.droppedRateLimited.Add(1)
+			return nil, errDropped
+		}
+		src.tokens--
+	}
+
+	if s, exists := p.sessions[client.String()]; exists {
+		return s, nil
+	}
+
+	if !p.options.Countries.admits(src.country) {
+		p.droppedGeo.Add(1)
+		return nil, errDropped
+	}
+	if p.options.MaxSessionsPerIP > 0 && src.sessions >= p.options.MaxSessionsPerIP ||
+		p.options.MaxSessions > 0 && len(p.sessions) >= p.options.MaxSessions {
+		p.droppedSessions.Add(1)
+		return nil, errDropped
+	}
+
+	conn, err := net.DialUDP("udp", nil, p.backend)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{client: client, conn: conn}
+	p.sessions[client.String()] = s
+	src.sessions++
+
+	go p.reply(s)
+	return s, nil
+}
+
+// reply relays datagrams from the backend to a client until the session
+// is closed
+func (p *Proxy) reply(s *session) {
+	buf := make([]byte, maxPacket)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// The backend may not be listening yet
+			continue
+		}
+		s.lastSeen.Store(time.Now().UnixNano())
+
+		packet := p.rewritePong(buf[:n], s.client)
+		if _, err := p.conn.WriteToUDP(packet, s.client); err != nil {
+			continue
+		}
+		p.bytesOut.Add(uint64(len(packet)))
+		p.packetsOut.Add(1)
+	}
+}
+
+// expireSessions closes sessions that have been idle for the timeout
+func (p *Proxy) expireSessions() {
+	ticker := time.NewTicker(p.options.SessionTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case now := <-ticker.C:
+			cutoff := now.Add(-p.options.SessionTimeout)
+			p.mu.Lock()
+			for key, s := range p.sessions {
+				if s.lastSeen.Load() < cutoff.UnixNano() {
+					s.conn.Close()
+					delete(p.sessions, key)
+					if src, exists := p.sources[s.client.IP.String()]; exists {
+						src.sessions--
+					}
+				}
+			}
+			// Forget idle sources, their buckets have refilled
+			for ip, src := range p.sources {
+				if src.sessions == 0 && src.updated.Before(cutoff) {
+					delete(p.sources, ip)
+				}
+			}
+			p.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// admitGrace is how long an admitted client has to finish joining before
+// its reserved slot is given to the next in the queue
+const admitGrace = 20 * time.Second
+
+// QueueOptions hold clients joining a full server in a queue. Positions are
+// kept per client IP.
+type QueueOptions struct {
+	Enabled bool
+	Size    int
+	Hold    time.Duration
+}
+
+// queueEntry is one client IP waiting for a slot
+type queueEntry struct {
+	ip       string
+	lastSeen time.Time
+}
+
+// SetPlayers tells the proxy how many players are online and how many fit.
+// With the queue enabled, joins beyond max are queued; zero max disables
+// queueing.
+func (p *Proxy) SetPlayers(online, max int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// A join completes the oldest admission
+	if joined := online - p.online; joined > 0 {
+		p.admitted = p.admitted[min(joined, len(p.admitted)):]
+	}
+	p.online, p.maxPlayers = online, max
+}
+
+// pruneQueue forgets queued clients that went quiet and admissions that
+// were not completed.
+// The caller must hold p.mu.
+func (p *Proxy) pruneQueue(now time.Time) {
+	p.queue = slices.DeleteFunc(p.queue, func(entry *queueEntry) bool {
+		return now.Sub(entry.lastSeen) > p.options.Queue.Hold
+	})
+	p.admitted = slices.DeleteFunc(p.admitted, func(admission admission) bool {
+		return now.After(admission.until)
+	})
+}
+
+// admission is a slot reserved for a client that was let through
+type admission struct {
+	ip    string
+	until time.Time
+}
+
+// freeSlots is the number of clients that may be let through now.
+// The caller must hold p.mu.
+func (p *Proxy) freeSlots() int {
+	return p.maxPlayers - p.online - len(p.admitted)
+}
+
+// position returns the 1-based queue position of an IP, 0 when not queued.
+// The caller must hold p.mu.
+func (p *Proxy) position(ip string) int {
+	return slices.IndexFunc(p.queue, func(entry *queueEntry) bool { return entry.ip == ip }) + 1
+}
+
+// admit decides whether a connection request may reach the server. Clients
+// are let through while slots are free and nobody is waiting; otherwise
+// they join the queue and are admitted in order when they retry after
+// slots free up.
+func (p *Proxy) admit(ip string) bool {
+	if !p.options.Queue.Enabled {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.maxPlayers <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	p.pruneQueue(now)
+	if slices.ContainsFunc(p.admitted, func(admission admission) bool { return admission.ip == ip }) {
+		// Clients repeat the request while negotiating the MTU
+		return true
+	}
+
+	free := p.freeSlots()
+	position := p.position(ip)
+	switch {
+	case position > 0 && position <= free:
+		p.queue = slices.Delete(p.queue, position-1, position)
+	case position == 0 && len(p.queue) == 0 && free > 0:
+	case position > 0:
+		p.queue[position-1].lastSeen = now
+		return false
+	case len(p.queue) >= p.options.Queue.Size:
+		p.droppedQueueFull.Add(1)
+		return false
+	default:
+		p.queue = append(p.queue, &queueEntry{ip: ip, lastSeen: now})
+		p.logger.Infof("Server %s is full, queued %s at position %d", p.name, ip, len(p.queue))
+		return false
+	}
+	p.admitted = append(p.admitted, admission{ip: ip, until: now.Add(admitGrace)})
+	p.queueAdmitted.Add(1)
+	return true
+}
+
+// touchQueue keeps the place of a queued client that is still pinging
+func (p *Proxy) touchQueue(ip string) {
+	if !p.options.Queue.Enabled {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if position := p.position(ip); position > 0 {
+		p.queue[position-1].lastSeen = time.Now()
+	}
+}
+
+// refuse answers a queued connection request with "no free incoming
+// connections", so the client reports the server as full instead of
+// timing out
+func (p *Proxy) refuse(client *net.UDPAddr) {
+	reply := make([]byte, 0, 25)
+	reply = append(reply, idNoFreeConnections)
+	reply = append(reply, rakNetMagic...)
+	reply = binary.BigEndian.AppendUint64(reply, p.serverGUID.Load())
+	p.conn.WriteToUDP(reply, client)
+}
+
+// queueMessage returns the status a queued client sees in its server list,
+// empty when the client is not queued
+func (p *Proxy) queueMessage(ip string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	position := p.position(ip)
+	switch {
+	case position == 0:
+		return ""
+	case position <= p.freeSlots():
+		return "Your turn - join now"
+	default:
+		return fmt.Sprintf("Server full - queue position %d of %d", position, len(p.queue))
+	}
+}
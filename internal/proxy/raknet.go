@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// RakNet offline message IDs the proxy looks at
+const (
+	idUnconnectedPing     = 0x01
+	idUnconnectedPingOpen = 0x02
+	idOpenConnection1     = 0x05
+	idNoFreeConnections   = 0x14
+	idUnconnectedPong     = 0x1c
+)
+
+// rakNetMagic marks RakNet offline messages
+var rakNetMagic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// isOpenConnection reports whether a datagram is a client's first
+// connection request
+func isOpenConnection(packet []byte) bool {
+	return len(packet) >= 17 && packet[0] == idOpenConnection1 && bytes.Equal(packet[1:17], rakNetMagic)
+}
+
+// isPing reports whether a datagram is an unconnected ping, sent by clients
+// listing servers
+func isPing(packet []byte) bool {
+	return len(packet) >= 25 && (packet[0] == idUnconnectedPing || packet[0] == idUnconnectedPingOpen)
+}
+
+// SetMOTD replaces the first MOTD line in the server list with motd. A
+// "{version}" left in it is filled in with the version the server reports.
+// An empty motd keeps the server's own.
+func (p *Proxy) SetMOTD(motd string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.motd = motd
+}
+
+// rewritePong learns the server GUID from an unconnected pong and replaces
+// the first MOTD line with the queue position of a queued client, or with
+// the MOTD set by SetMOTD.
+// Pong: ID, time (8), server GUID (8), magic (16), length (2), status.
+func (p *Proxy) rewritePong(packet []byte, client *net.UDPAddr) []byte {
+	if len(packet) < 35 || packet[0] != idUnconnectedPong || !bytes.Equal(packet[17:33], rakNetMagic) {
+		return packet
+	}
+	p.serverGUID.Store(binary.BigEndian.Uint64(packet[9:17]))
+
+	var message string
+	if p.options.Queue.Enabled {
+		message = p.queueMessage(client.IP.String())
+	}
+	if message == "" {
+		p.mu.Lock()
+		message = p.motd
+		p.mu.Unlock()
+	}
+	length := int(binary.BigEndian.Uint16(packet[33:35]))
+	if message == "" || len(packet) < 35+length {
+		return packet
+	}
+	// Status: MCPE;<motd>;<protocol>;<version>;<online>;<max>;...
+	fields := strings.Split(string(packet[35:35+length]), ";")
+	if len(fields) < 4 {
+		return packet
+	}
+	fields[1] = strings.ReplaceAll(message, "{version}", fields[3])
+	status := strings.Join(fields, ";")
+
+	rewritten := make([]byte, 0, 35+len(status))
+	rewritten = append(rewritten, packet[:33]...)
+	rewritten = binary.BigEndian.AppendUint16(rewritten, uint16(len(status)))
+	return append(rewritten, status...)
+}
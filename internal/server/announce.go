@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// announcement is the data of an announcement template
+type announcement struct {
+	Server    string
+	Reason    string
+	Schedules string
+}
+
+// parseAnnouncements parses the announcement templates, with the default
+// message of every event that is not configured. Templates were checked
+// when the configuration was loaded.
+func parseAnnouncements(cfg config.AnnouncementsConfig) map[string]*template.Template {
+	if !cfg.Enabled {
+		return nil
+	}
+	templates := make(map[string]*template.Template)
+	for _, event := range config.AnnouncementEvents {
+		text, configured := cfg.Messages[event]
+		if !configured {
+			text = config.DefaultAnnouncements[event]
+		}
+		if text == "" {
+			continue
+		}
+		templates[event] = template.Must(template.New(event).Parse(text))
+	}
+	return templates
+}
+
+// announce tells the players of a running server about something the
+// manager does to it, when announcements are enabled for the event.
+// The caller must hold m.mu.
+func (m *Manager) announce(server *MinecraftServer, event string, data announcement) {
+	tmpl := m.announcements[event]
+	if tmpl == nil || server.Status != "running" || len(server.Players) == 0 {
+		return
+	}
+	data.Server = server.Config.Name
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, data); err != nil {
+		m.logger.Warnf("Failed to render %s announcement for %s: %v", event, data.Server, err)
+		return
+	}
+	message := strings.Join(strings.Fields(text.String()), " ")
+	if message == "" {
+		return
+	}
+
+	command := "say " + message
+	if m.config.Announcements.Command == config.AnnounceTellraw {
+		rawtext, _ := json.Marshal(map[string]interface{}{"rawtext": []map[string]string{{"text": message}}})
+		command = "tellraw @a " + string(rawtext)
+	}
+	if err := m.sendCommand(server, command); err != nil {
+		m.logger.Warnf("Failed to announce %s on %s: %v", event, data.Server, err)
+	}
+}
+
+// announceRestart announces that a server is about to restart.
+// The caller must hold m.mu.
+func (m *Manager) announceRestart(name, reason string) {
+	if server, exists := m.servers[name]; exists {
+		m.announce(server, config.AnnounceRestart, announcement{Reason: reason})
+	}
+}
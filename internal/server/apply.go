@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Actions taken on a server when a configuration is applied
+const (
+	ActionStarted      = "started"
+	ActionRestarted    = "restarted"
+	ActionReconfigured = "reconfigured"
+	ActionStopped      = "stopped"
+	ActionSkipped      = "skipped"
+	ActionDeferred     = "deferred"
+	ActionUnchanged    = "unchanged"
+	ActionPreempted    = "preempted"
+)
+
+// ServerAction is what applying a configuration did to one server. Error is
+// set when the action failed.
+type ServerAction struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// failedActions returns the actions that did not succeed
+func failedActions(actions []ServerAction) []ServerAction {
+	var failed []ServerAction
+	for _, action := range actions {
+		if action.Error != "" {
+			failed = append(failed, action)
+		}
+	}
+	return failed
+}
+
+// summarizeActions describes an apply in one line, e.g.
+// "2 started, 1 restarted, 1 failed (lobby: failed to deploy packs: ...)"
+func summarizeActions(actions []ServerAction) string {
+	counts := make(map[string]int)
+	for _, action := range actions {
+		if action.Error == "" {
+			counts[action.Action]++
+		}
+	}
+
+	var parts []string
+	for _, kind := range []string{ActionStarted, ActionRestarted, ActionReconfigured, ActionStopped, ActionSkipped, ActionDeferred, ActionUnchanged, ActionPreempted} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+
+	if failed := failedActions(actions); len(failed) > 0 {
+		details := make([]string, 0, len(failed))
+		for _, action := range failed {
+			details = append(details, fmt.Sprintf("%s: %s", action.Name, action.Error))
+		}
+		parts = append(parts, fmt.Sprintf("%d failed (%s)", len(failed), strings.Join(details, "; ")))
+	}
+
+	if len(parts) == 0 {
+		return "no servers"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+)
+
+// watcherBuffer is how many lines an attached console may fall behind
+// before lines are dropped for it
+const watcherBuffer = 256
+
+// ConsoleSession is a console attached to a server: the recent output
+// followed by live lines. Lines is closed when the server process exits or
+// the session is detached.
+type ConsoleSession struct {
+	Backlog []string
+	Lines   <-chan string
+
+	detachOnce sync.Once
+	detach     func()
+}
+
+// Detach stops the delivery of lines
+func (s *ConsoleSession) Detach() {
+	s.detachOnce.Do(s.detach)
+}
+
+// AttachConsole subscribes to the console output of a running server,
+// starting with up to backlog recent lines
+func (m *Manager) AttachConsole(name string, backlog int) (*ConsoleSession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server.Status != "starting" && server.Status != "running" {
+		return nil, fmt.Errorf("server %s is %s", name, server.Status)
+	}
+
+	lines := make(chan string, watcherBuffer)
+	if server.watchers == nil {
+		server.watchers = make(map[chan string]struct{})
+	}
+	server.watchers[lines] = struct{}{}
+
+	session := &ConsoleSession{
+		Backlog: server.logs.Last(backlog),
+		Lines:   lines,
+	}
+	session.detach = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, attached := server.watchers[lines]; attached {
+			delete(server.watchers, lines)
+			close(lines)
+		}
+	}
+	return session, nil
+}
+
+// broadcastConsole hands a console line to the attached consoles, dropping
+// it for those that are behind.
+// The caller must hold m.mu.
+func (m *Manager) broadcastConsole(server *MinecraftServer, line string) {
+	for lines := range server.watchers {
+		select {
+		case lines <- line:
+		default:
+		}
+	}
+}
+
+// detachConsoles ends every attached console of a server.
+// The caller must hold m.mu.
+func (m *Manager) detachConsoles(server *MinecraftServer) {
+	for lines := range server.watchers {
+		delete(server.watchers, lines)
+		close(lines)
+	}
+}
@@ -0,0 +1,490 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/schedule"
+)
+
+// Filesystem magic numbers reported by statfs
+const (
+	btrfsMagic = 0x9123683e
+	zfsMagic   = 0x2fc12fc1
+)
+
+// btrfsSubvolumeInode is the inode number of the root of every btrfs
+// subvolume
+const btrfsSubvolumeInode = 256
+
+// zfsSnapshotPrefix prefixes the names of the ZFS snapshots the manager takes
+const zfsSnapshotPrefix = "party-"
+
+// ErrBackupNotFound is returned for backups that do not exist
+var ErrBackupNotFound = errors.New("backup not found")
+
+// Backup is a backup of the world of a server. Source is the worlds
+// directory it is restored from; Files lists the world files in it with
+// their length, relative to Source.
+type Backup struct {
+	ID       string           `json:"id"`
+	Server   string           `json:"server"`
+	World    string           `json:"world"`
+	Backend  string           `json:"backend"`
+	Time     time.Time        `json:"time"`
+	Size     int64            `json:"size"`
+	Source   string           `json:"source"`
+	Snapshot string           `json:"snapshot,omitempty"`
+	Files    map[string]int64 `json:"files,omitempty"`
+}
+
+// backupBackend stores the world files of a server
+type backupBackend interface {
+	// create stores files of the worlds directory of a server, returning
+	// the directory to restore them from and the snapshot, if any
+	create(name, id string, files map[string]int64) (source, snapshot string, err error)
+	// remove deletes a backup created by the backend
+	remove(backup *Backup) error
+}
+
+// copyBackend copies the world files into the backups directory
+type copyBackend struct {
+	m *Manager
+}
+
+func (b *copyBackend) create(name, id string, files map[string]int64) (string, string, error) {
+	dest := filepath.Join(b.m.backupsDir(name), id)
+	worldsDir := filepath.Join(b.m.config.GetServerDir(name), "worlds")
+	err := b.m.backupIO(func() error {
+		return copyHeldFiles(worldsDir, files, dest, b.m.backupRateLimiter())
+	})
+	if err != nil {
+		os.RemoveAll(dest)
+		return "", "", err
+	}
+	return dest, "", nil
+}
+
+func (b *copyBackend) remove(backup *Backup) error {
+	return os.RemoveAll(backup.Source)
+}
+
+// btrfsBackend takes read-only snapshots of server directories that are
+// btrfs subvolumes. Snapshots must stay on the same filesystem, so they
+// are kept in .snapshots under base_dir.
+type btrfsBackend struct {
+	m *Manager
+}
+
+func (b *btrfsBackend) create(name, id string, _ map[string]int64) (string, string, error) {
+	snapshot := filepath.Join(b.m.config.Server.BaseDir, ".snapshots", name, id)
+	if err := os.MkdirAll(filepath.Dir(snapshot), 0755); err != nil {
+		return "", "", err
+	}
+	if err := runBackupCommand("btrfs", "subvolume", "snapshot", "-r", b.m.config.GetServerDir(name), snapshot); err != nil {
+		return "", "", err
+	}
+	return filepath.Join(snapshot, "worlds"), snapshot, nil
+}
+
+func (b *btrfsBackend) remove(backup *Backup) error {
+	return runBackupCommand("btrfs", "subvolume", "delete", backup.Snapshot)
+}
+
+// zfsBackend takes snapshots of server directories that are the mountpoint
+// of a ZFS dataset, read back through the .zfs directory of the dataset
+type zfsBackend struct {
+	m *Manager
+}
+
+func (b *zfsBackend) create(name, id string, _ map[string]int64) (string, string, error) {
+	serverDir := b.m.config.GetServerDir(name)
+	dataset, err := zfsDataset(serverDir)
+	if err != nil {
+		return "", "", err
+	}
+	snapshot := dataset + "@" + zfsSnapshotPrefix + id
+	if err := runBackupCommand("zfs", "snapshot", snapshot); err != nil {
+		return "", "", err
+	}
+	return filepath.Join(serverDir, ".zfs", "snapshot", zfsSnapshotPrefix+id, "worlds"), snapshot, nil
+}
+
+func (b *zfsBackend) remove(backup *Backup) error {
+	return runBackupCommand("zfs", "destroy", backup.Snapshot)
+}
+
+// zfsDataset returns the ZFS dataset mounted at dir
+func zfsDataset(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	output, err := exec.Command("zfs", "list", "-H", "-o", "name,mountpoint").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("zfs list failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		name, mountpoint, found := strings.Cut(scanner.Text(), "\t")
+		if found && mountpoint == dir {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not the mountpoint of a ZFS dataset", dir)
+}
+
+func runBackupCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// detectBackupBackend picks the snapshot backend the filesystem of a server
+// directory supports, or copying
+func detectBackupBackend(serverDir string) string {
+	fsType, err := filesystemType(serverDir)
+	if err != nil {
+		return config.BackupCopy
+	}
+	switch fsType {
+	case btrfsMagic:
+		// Only subvolumes can be snapshotted
+		if inode, err := fileInode(serverDir); err == nil && inode == btrfsSubvolumeInode {
+			return config.BackupBtrfs
+		}
+	case zfsMagic:
+		if _, err := zfsDataset(serverDir); err == nil {
+			return config.BackupZFS
+		}
+	}
+	return config.BackupCopy
+}
+
+// backupBackend returns the backend with the given name
+func (m *Manager) backupBackend(name string) (backupBackend, error) {
+	switch name {
+	case config.BackupCopy:
+		return &copyBackend{m: m}, nil
+	case config.BackupBtrfs:
+		return &btrfsBackend{m: m}, nil
+	case config.BackupZFS:
+		return &zfsBackend{m: m}, nil
+	}
+	return nil, fmt.Errorf("unknown backup backend %q", name)
+}
+
+// backupsDir is where the backups of a server are recorded
+func (m *Manager) backupsDir(name string) string {
+	return filepath.Join(m.config.Server.DataDir, "backups", name)
+}
+
+// worldFiles lists the files of a world of a stopped server with their
+// length, relative to the worlds directory like holdSaves does
+func worldFiles(worldsDir, world string) (map[string]int64, error) {
+	files := make(map[string]int64)
+	err := filepath.Walk(filepath.Join(worldsDir, world), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(worldsDir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = info.Size()
+		return nil
+	})
+	return files, err
+}
+
+// CreateBackup backs up the world of a server. The world of a running
+// server is backed up while its saving is on hold, which only takes a
+// moment with a snapshot backend.
+func (m *Manager) CreateBackup(name string) (*Backup, error) {
+	m.mu.RLock()
+	serverConfig := m.findServerConfig(name)
+	server := m.servers[name]
+	m.mu.RUnlock()
+	if serverConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+
+	serverDir := m.config.GetServerDir(name)
+	backendName := m.config.Backups.Backend
+	if backendName == config.BackupAuto {
+		backendName = detectBackupBackend(serverDir)
+	}
+	backend, err := m.backupBackend(backendName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	backup := &Backup{
+		ID:      now.Format("20060102-150405"),
+		Server:  name,
+		World:   serverConfig.WorldName,
+		Backend: backendName,
+		Time:    now,
+	}
+	if _, err := os.Stat(filepath.Join(m.backupsDir(name), backup.ID+".json")); err == nil {
+		return nil, fmt.Errorf("a backup of server %s was just taken", name)
+	}
+
+	if server != nil && server.Stdin != nil {
+		backup.Files, err = m.holdSaves(server)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hold saving: %w", err)
+		}
+		backup.Source, backup.Snapshot, err = backend.create(name, backup.ID, backup.Files)
+		m.resumeSaves(server)
+	} else {
+		backup.Files, err = worldFiles(filepath.Join(serverDir, "worlds"), serverConfig.WorldName)
+		if err == nil && len(backup.Files) == 0 {
+			err = fmt.Errorf("server %s has no world to back up yet", name)
+		}
+		if err == nil {
+			backup.Source, backup.Snapshot, err = backend.create(name, backup.ID, backup.Files)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up world of %s: %w", name, err)
+	}
+	for _, length := range backup.Files {
+		backup.Size += length
+	}
+
+	data, _ := json.MarshalIndent(backup, "", "  ")
+	if err := os.MkdirAll(m.backupsDir(name), 0755); err == nil {
+		err = os.WriteFile(filepath.Join(m.backupsDir(name), backup.ID+".json"), data, 0644)
+	}
+	if err != nil {
+		backend.remove(backup)
+		return nil, fmt.Errorf("failed to record backup of %s: %w", name, err)
+	}
+
+	m.logger.Infof("Backed up world of %s (%s, %d files, %d bytes)", name, backendName, len(backup.Files), backup.Size)
+	m.events.Publish(events.BackupCompleted, name, map[string]interface{}{"backup": backup.ID, "backend": backendName})
+	m.pruneBackups(name)
+	return backup, nil
+}
+
+// loadBackups reads the backups of a server, oldest first
+func (m *Manager) loadBackups(name string) ([]*Backup, error) {
+	paths, err := filepath.Glob(filepath.Join(m.backupsDir(name), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	backups := make([]*Backup, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var backup Backup
+		if err := json.Unmarshal(data, &backup); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		backups = append(backups, &backup)
+	}
+	return backups, nil
+}
+
+// ListBackups returns the backups of a server, oldest first, without their
+// file lists
+func (m *Manager) ListBackups(name string) ([]*Backup, error) {
+	m.mu.RLock()
+	found := m.findServerConfig(name) != nil
+	m.mu.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+
+	backups, err := m.loadBackups(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range backups {
+		backup.Files = nil
+	}
+	return backups, nil
+}
+
+// pruneBackups removes all but the newest backups.keep backups of a server
+func (m *Manager) pruneBackups(name string) {
+	backups, err := m.loadBackups(name)
+	if err != nil {
+		m.logger.Warnf("Failed to list backups of %s: %v", name, err)
+		return
+	}
+	for _, backup := range backups[:max(len(backups)-m.config.Backups.Keep, 0)] {
+		backend, err := m.backupBackend(backup.Backend)
+		if err == nil {
+			err = backend.remove(backup)
+		}
+		if err != nil {
+			m.logger.Warnf("Failed to remove backup %s of %s: %v", backup.ID, name, err)
+			continue
+		}
+		os.Remove(filepath.Join(m.backupsDir(name), backup.ID+".json"))
+	}
+}
+
+// RestoreBackup replaces the world of a server with a backup, stopping the
+// server while the worlds are swapped. The replaced world is kept next to
+// it with a .previous suffix until the next restore.
+func (m *Manager) RestoreBackup(name, id string) (*Backup, error) {
+	m.mu.RLock()
+	serverConfig := m.findServerConfig(name)
+	m.mu.RUnlock()
+	if serverConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+
+	backup, err := m.findBackup(name, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.restoreWorld(serverConfig, backup, nil); err != nil {
+		return nil, err
+	}
+	m.logger.Infof("Restored world of %s from backup %s", name, id)
+	m.events.Publish(events.BackupRestored, name, map[string]interface{}{"backup": id})
+	backup.Files = nil
+	return backup, nil
+}
+
+// findBackup returns a backup of a server with its file list
+func (m *Manager) findBackup(name, id string) (*Backup, error) {
+	backups, err := m.loadBackups(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, backup := range backups {
+		if backup.ID == id {
+			return backup, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s of server %s", ErrBackupNotFound, id, name)
+}
+
+// restoreWorld replaces the world of a server with a backup, which may be
+// one of another server. The backup is staged and checked while the server
+// keeps running, adjust may then change the staged world. Only the swap
+// stops the server.
+func (m *Manager) restoreWorld(serverConfig *config.MinecraftServerConfig, backup *Backup, adjust func(worldDir string) error) error {
+	name := serverConfig.Name
+	stagingDir := filepath.Join(m.config.GetServerDir(name), "worlds.restore")
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	err := m.backupIO(func() error {
+		return copyHeldFiles(backup.Source, backup.Files, stagingDir, m.backupRateLimiter())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy backup %s: %w", backup.ID, err)
+	}
+	stagedWorld := filepath.Join(stagingDir, backup.World)
+	if err := checkWorld(stagedWorld, true); err != nil {
+		return fmt.Errorf("backup %s is damaged: %w", backup.ID, err)
+	}
+	if adjust != nil {
+		if err := adjust(stagedWorld); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, running := m.servers[name]
+	if running {
+		if err := m.checkFrozen(); err != nil {
+			return err
+		}
+		m.logger.Infof("Stopping server %s to restore backup %s", name, backup.ID)
+		m.announceRestart(name, "world restore")
+		m.stopServer(name)
+	}
+
+	worldDir := m.config.GetWorldDir(name, serverConfig.WorldName)
+	previousDir := worldDir + ".previous"
+	err = os.RemoveAll(previousDir)
+	if err == nil {
+		if err = os.Rename(worldDir, previousDir); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		if err = os.Rename(stagedWorld, worldDir); err != nil {
+			os.Rename(previousDir, worldDir)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to restore backup %s: %w", backup.ID, err)
+	}
+
+	if running {
+		if startErr := m.startServer(serverConfig); startErr != nil && err == nil {
+			err = fmt.Errorf("backup restored but server failed to restart: %w", startErr)
+		}
+	}
+	return err
+}
+
+// runScheduledBackups backs up every running server when backups.cron
+// matches. With backups.defer, the backup of a server with more players
+// online waits until enough of them left or for at most max_minutes.
+func (m *Manager) runScheduledBackups(now time.Time) {
+	m.mu.Lock()
+	if m.config.Backups.Cron != "" {
+		if cron, err := schedule.ParseCron(m.config.Backups.Cron); err == nil && cron.Matches(now) {
+			for name, server := range m.servers {
+				if _, pending := m.pendingBackups[name]; server.Status == "running" && !pending {
+					m.pendingBackups[name] = now
+				}
+			}
+		}
+	}
+
+	var due []string
+	deferral := m.config.Backups.Defer
+	for name, since := range m.pendingBackups {
+		server, exists := m.servers[name]
+		if !exists || server.Status != "running" {
+			delete(m.pendingBackups, name)
+			continue
+		}
+		if deferral != nil && len(server.Players) > deferral.Players && now.Sub(since) < time.Duration(deferral.MaxMinutes)*time.Minute {
+			if since == now {
+				m.logger.Infof("Deferring backup of %s while %d players are online", name, len(server.Players))
+			}
+			continue
+		}
+		delete(m.pendingBackups, name)
+		due = append(due, name)
+	}
+	m.mu.Unlock()
+
+	for _, name := range due {
+		go func(name string) {
+			if _, err := m.CreateBackup(name); err != nil {
+				m.logger.Errorf("Scheduled backup failed: %v", err)
+			}
+		}(name)
+	}
+}
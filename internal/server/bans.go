@@ -0,0 +1,313 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/events"
+)
+
+// ErrBanNotFound is returned when lifting a ban that does not exist
+var ErrBanNotFound = errors.New("player is not banned")
+
+// Ban keeps a player off a server. Bedrock servers have no ban list of
+// their own, so the manager removes banned players from the allowlist and
+// kicks them whenever they join.
+type Ban struct {
+	Player string    `json:"player"`
+	XUID   string    `json:"xuid,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Time   time.Time `json:"time"`
+
+	// Origin is the server the ban was made on; it differs from the
+	// server for bans propagated to its group
+	Origin string `json:"origin"`
+}
+
+func (m *Manager) bansPath() string {
+	return filepath.Join(m.config.Server.DataDir, "bans.json")
+}
+
+// loadBans reads the bans of all servers
+func (m *Manager) loadBans() error {
+	data, err := os.ReadFile(m.bansPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	bans := make(map[string][]Ban)
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.bansPath(), err)
+	}
+	m.mu.Lock()
+	m.bans = bans
+	m.mu.Unlock()
+	return nil
+}
+
+// saveBans writes the bans of all servers.
+// The caller must hold m.mu.
+func (m *Manager) saveBans() error {
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m.bans, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.bansPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.bansPath())
+}
+
+// Bans returns the bans of a configured server, oldest first
+func (m *Manager) Bans(name string) ([]Ban, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.findServerConfig(name) == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	return slices.Clone(m.bans[name]), nil
+}
+
+// BanPlayer bans a player from a configured server and, when the server
+// syncs bans, from every server of its group. Running servers drop the
+// player from their allowlist and kick them. It returns the servers the
+// ban applies to.
+func (m *Manager) BanPlayer(name string, ban Ban) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findServerConfig(name) == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if _, err := playerTarget(ban.Player); err != nil {
+		return nil, err
+	}
+	return m.banPlayer(name, ban)
+}
+
+// banPlayer records a ban on a server and its group.
+// The caller must hold m.mu.
+func (m *Manager) banPlayer(name string, ban Ban) ([]string, error) {
+	ban.Origin = name
+	if ban.Time.IsZero() {
+		ban.Time = time.Now()
+	}
+	if ban.XUID == "" {
+		_, ban.XUID = m.resolvePlayer(ban.Player)
+	}
+	targets := m.banTargets(name)
+
+	if m.bans == nil {
+		m.bans = make(map[string][]Ban)
+	}
+	for _, target := range targets {
+		bans := slices.DeleteFunc(m.bans[target], func(existing Ban) bool {
+			return strings.EqualFold(existing.Player, ban.Player)
+		})
+		m.bans[target] = append(bans, ban)
+	}
+	if err := m.saveBans(); err != nil {
+		return nil, fmt.Errorf("failed to save bans: %w", err)
+	}
+
+	m.logger.Infof("Banned %s from %s: %s", ban.Player, strings.Join(targets, ", "), ban.Reason)
+	for _, target := range targets {
+		m.events.Publish(events.PlayerBanned, target, map[string]interface{}{"player": ban.Player, "origin": name, "reason": ban.Reason})
+		server, running := m.servers[target]
+		if !running || server.Stdin == nil {
+			continue
+		}
+		quoted, _ := playerTarget(ban.Player)
+		if err := m.sendCommand(server, "allowlist remove "+quoted); err != nil {
+			m.logger.Warnf("Failed to remove %s from the allowlist of %s: %v", ban.Player, server.Config.Name, err)
+		}
+		m.kickBanned(server, ban.Player)
+	}
+	return targets, nil
+}
+
+// UnbanPlayer lifts the ban of a player on a configured server and on the
+// servers it was propagated to. Running servers whose configuration
+// allowlists the player add them back. It returns the servers the ban was
+// lifted on.
+func (m *Manager) UnbanPlayer(name, player string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findServerConfig(name) == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	// Bans follow renamed players, so a former name finds them too
+	_, xuid := m.resolvePlayer(player)
+	found := bannedAs(m.bans[name], player, xuid)
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrBanNotFound, player)
+	}
+	ban := *found
+	lifts := func(existing Ban) bool {
+		return strings.EqualFold(existing.Player, ban.Player) || ban.XUID != "" && existing.XUID == ban.XUID
+	}
+	// A propagated ban is lifted wherever it was propagated to
+	targets := []string{name}
+	if ban.Origin != "" && m.findServerConfig(ban.Origin) != nil {
+		targets = append(m.banTargets(ban.Origin), name)
+	}
+
+	var lifted []string
+	for _, target := range targets {
+		before := len(m.bans[target])
+		m.bans[target] = slices.DeleteFunc(m.bans[target], lifts)
+		if len(m.bans[target]) == 0 {
+			delete(m.bans, target)
+		}
+		if len(m.bans[target]) == before {
+			continue
+		}
+		lifted = append(lifted, target)
+		m.events.Publish(events.PlayerUnbanned, target, map[string]interface{}{"player": ban.Player, "origin": name})
+		if server, running := m.servers[target]; running && server.Stdin != nil && len(server.Config.Whitelist) > 0 {
+			if err := m.refreshPlayerFiles(server); err != nil {
+				m.logger.Warnf("Failed to update the allowlist of %s: %v", target, err)
+			}
+		}
+	}
+	if err := m.saveBans(); err != nil {
+		return nil, fmt.Errorf("failed to save bans: %w", err)
+	}
+	m.logger.Infof("Lifted the ban of %s on %s", ban.Player, strings.Join(lifted, ", "))
+	return lifted, nil
+}
+
+// banTargets returns the server and, when it syncs bans, the other
+// configured servers of its group and tenant.
+// The caller must hold m.mu.
+func (m *Manager) banTargets(name string) []string {
+	serverConfig := m.findServerConfig(name)
+	if serverConfig == nil || serverConfig.Bans == nil || !serverConfig.Bans.Sync || serverConfig.Group == "" || m.lastConfig == nil {
+		return []string{name}
+	}
+	targets := []string{name}
+	for _, other := range m.lastConfig.Servers {
+		if other.Name != name && other.Group == serverConfig.Group && other.Tenant == serverConfig.Tenant {
+			targets = append(targets, other.Name)
+		}
+	}
+	sort.Strings(targets[1:])
+	return targets
+}
+
+// bannedAs returns the ban matching a player by name or, when known, by
+// XUID, so that renamed players stay banned
+func bannedAs(bans []Ban, player, xuid string) *Ban {
+	for i := range bans {
+		if strings.EqualFold(bans[i].Player, player) || xuid != "" && bans[i].XUID == xuid {
+			return &bans[i]
+		}
+	}
+	return nil
+}
+
+// isBanned reports whether a player is banned from a server.
+// The caller must hold m.mu.
+func (m *Manager) isBanned(name, player string) bool {
+	_, xuid := m.resolvePlayer(player)
+	return bannedAs(m.bans[name], player, xuid) != nil
+}
+
+// enforceBan kicks a player who joined a server they are banned from.
+// The caller must hold m.mu.
+func (m *Manager) enforceBan(server *MinecraftServer, player, xuid string) {
+	ban := bannedAs(m.bans[server.Config.Name], player, xuid)
+	if ban == nil {
+		return
+	}
+	if ban.XUID == "" && xuid != "" {
+		ban.XUID = xuid
+		if err := m.saveBans(); err != nil {
+			m.logger.Warnf("Failed to save bans: %v", err)
+		}
+	}
+	m.logger.Infof("Banned player %s joined %s", player, server.Config.Name)
+	m.kickBanned(server, player)
+}
+
+// kickBanned kicks a banned player if they are online.
+// The caller must hold m.mu.
+func (m *Manager) kickBanned(server *MinecraftServer, player string) {
+	for online := range server.Players {
+		if !strings.EqualFold(online, player) {
+			continue
+		}
+		target, err := playerTarget(online)
+		if err != nil {
+			m.logger.Warnf("Cannot kick banned player %q from %s: %v", online, server.Config.Name, err)
+			return
+		}
+		if err := m.sendCommand(server, "kick "+target+" You are banned from this server"); err != nil {
+			m.logger.Warnf("Failed to kick banned player %s from %s: %v", online, server.Config.Name, err)
+		}
+		return
+	}
+}
+
+// handleConsoleBan records a ban reported on the console of a server,
+// e.g. by an addon, when the line matches its console pattern.
+// The caller must hold m.mu.
+func (m *Manager) handleConsoleBan(server *MinecraftServer, line string) {
+	pattern := m.consoleBanPattern(server)
+	if pattern == nil {
+		return
+	}
+	match := pattern.FindStringSubmatch(line)
+	if match == nil || match[1] == "" {
+		return
+	}
+	ban := Ban{Player: strings.TrimSpace(match[1]), By: "console"}
+	if _, err := playerTarget(ban.Player); err != nil {
+		m.logger.Warnf("Ignoring ban on the console of %s: %v", server.Config.Name, err)
+		return
+	}
+	if i := pattern.SubexpIndex("reason"); i > 0 {
+		ban.Reason = strings.TrimSpace(match[i])
+	}
+	if m.isBanned(server.Config.Name, ban.Player) {
+		return
+	}
+	if _, err := m.banPlayer(server.Config.Name, ban); err != nil {
+		m.logger.Errorf("Failed to record ban of %s on %s: %v", ban.Player, server.Config.Name, err)
+	}
+}
+
+// consoleBanPattern compiles the console ban pattern of a server, again
+// whenever its configuration changes it.
+// The caller must hold m.mu.
+func (m *Manager) consoleBanPattern(server *MinecraftServer) *regexp.Regexp {
+	if server.Config.Bans == nil || server.Config.Bans.ConsolePattern == "" {
+		return nil
+	}
+	if server.banPattern == nil || server.banPattern.String() != server.Config.Bans.ConsolePattern {
+		pattern, err := regexp.Compile(server.Config.Bans.ConsolePattern)
+		if err != nil || pattern.NumSubexp() == 0 {
+			// Validation rejects such patterns
+			return nil
+		}
+		server.banPattern = pattern
+	}
+	return server.banPattern
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+)
+
+// restartWindow is the period the restart budget applies to
+const restartWindow = time.Hour
+
+// ErrQuarantined is returned when a quarantined server is to be started
+var ErrQuarantined = errors.New("server is quarantined")
+
+// QuarantinedServer is a server that exceeded the restart budget. It is not
+// started again until an operator releases it.
+type QuarantinedServer struct {
+	Name     string    `json:"name"`
+	Since    time.Time `json:"since"`
+	Restarts int       `json:"restarts"`
+}
+
+// useRestartBudget records the start of a server. A server that was
+// started more often in the last hour than restart_budget allows is
+// quarantined instead, and an alert is sent.
+// The caller must hold m.mu.
+func (m *Manager) useRestartBudget(name string, now time.Time) error {
+	if q, exists := m.quarantined[name]; exists {
+		return fmt.Errorf("%w: %s (since %s)", ErrQuarantined, name, q.Since.Format(time.RFC3339))
+	}
+
+	starts := m.starts[name]
+	for len(starts) > 0 && now.Sub(starts[0]) >= restartWindow {
+		starts = starts[1:]
+	}
+	// Every start within the window after the first is a restart
+	budget := m.config.Server.RestartBudget
+	if budget > 0 && len(starts) > budget {
+		m.quarantine(name, len(starts), now)
+		return fmt.Errorf("%w: %s (%d restarts within an hour, restart_budget is %d)", ErrQuarantined, name, len(starts), budget)
+	}
+	m.starts[name] = append(starts, now)
+	return nil
+}
+
+// quarantine keeps a server from being started and alerts about it.
+// The caller must hold m.mu.
+func (m *Manager) quarantine(name string, restarts int, now time.Time) {
+	m.quarantined[name] = QuarantinedServer{Name: name, Since: now, Restarts: restarts}
+	delete(m.starts, name)
+
+	m.logger.Errorf("Quarantined server %s after %d restarts within an hour", name, restarts)
+	notification := notify.Notification{
+		Event:    config.NotifyServerQuarantined,
+		Title:    fmt.Sprintf("Server %s quarantined", name),
+		Message:  fmt.Sprintf("Server %s was restarted %d times within an hour and is not started again until it is released", name, restarts),
+		Severity: notify.SeverityCritical,
+		Server:   name,
+		Fields:   map[string]string{"restarts": fmt.Sprint(restarts)},
+	}
+	go m.notifier.Notify(notification)
+}
+
+// ReleaseServer lifts the quarantine of a server and starts it again when
+// it is still in the configuration
+func (m *Manager) ReleaseServer(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.quarantined[name]; !exists {
+		return fmt.Errorf("server %s is not quarantined", name)
+	}
+	if err := m.checkFrozen(); err != nil {
+		return err
+	}
+	delete(m.quarantined, name)
+	m.logger.Infof("Released server %s from quarantine (requested through the API)", name)
+
+	serverConfig := m.lastConfig.Server(name)
+	if serverConfig == nil {
+		return nil
+	}
+	if server, exists := m.servers[name]; exists {
+		// A crashed server stays in place until it is restarted
+		if server.Status != "crashed" {
+			return nil
+		}
+		m.stopServer(name)
+	}
+	if err := m.startServer(serverConfig); err != nil {
+		return fmt.Errorf("failed to start server %s: %w", name, err)
+	}
+	return nil
+}
+
+// quarantinedServers lists the quarantined servers by name.
+// The caller must hold m.mu.
+func (m *Manager) quarantinedServers() []QuarantinedServer {
+	servers := make([]QuarantinedServer, 0, len(m.quarantined))
+	for _, q := range m.quarantined {
+		servers = append(servers, q)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/github"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxBulkCopies limits how many servers one bulk creation generates
+const maxBulkCopies = 100
+
+// BulkSpec describes copies of a configured server for a class or
+// workshop, e.g. 20 copies on ports 20000-20019 with a student each
+type BulkSpec struct {
+	// Template is the configured server the copies are made of
+	Template string `json:"template"`
+
+	// Name names the copies, {n} being replaced by the copy number, e.g.
+	// "class-{n}" (default "<template>-{n}")
+	Name string `json:"name,omitempty"`
+
+	// Count is the number of copies. It defaults to the size of the port
+	// range, or to the number of players in a roster that assigns none
+	// of them to a server.
+	Count int `json:"count,omitempty"`
+
+	// Ports is the port of the first copy or a range, e.g. 20000-20019;
+	// the copies use consecutive ports
+	Ports string `json:"ports"`
+
+	// Roster is a CSV of players added to the allowlists of the copies,
+	// with a player and optionally a server column, the copy number or
+	// name. Players without a server are dealt to the copies in turn.
+	Roster string `json:"roster,omitempty"`
+
+	// WorldTemplate replaces the world template of the copies
+	WorldTemplate string `json:"world_template,omitempty"`
+
+	// Commit adds the copies to the configuration file of the template's
+	// source instead of only returning them, with a commit or a pull
+	// request as Mode asks (default github.write_back)
+	Commit  bool   `json:"commit,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkServer is one generated copy
+type BulkServer struct {
+	Name      string   `json:"name"`
+	Port      int      `json:"port"`
+	Whitelist []string `json:"whitelist,omitempty"`
+}
+
+// BulkResult lists the generated copies and their configuration entries,
+// and the change that added them when they were committed
+type BulkResult struct {
+	Servers []BulkServer   `json:"servers"`
+	YAML    string         `json:"yaml"`
+	Source  string         `json:"source"`
+	Change  *github.Change `json:"change,omitempty"`
+}
+
+// rosterEntry is a player of a roster and the copy it is assigned to,
+// empty for any
+type rosterEntry struct {
+	player string
+	server string
+}
+
+// BulkCreate generates copies of a configured server and, when requested,
+// commits them to the configuration on behalf of by. The copies are
+// validated together with the applied configuration first; they are
+// created by the apply of the commit.
+func (m *Manager) BulkCreate(spec BulkSpec, by string) (*BulkResult, error) {
+	m.mu.RLock()
+	copies, source, err := m.bulkCopies(spec)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := config.MarshalServers(copies)
+	if err != nil {
+		return nil, err
+	}
+	result := &BulkResult{YAML: string(content), Source: source}
+	for _, server := range copies {
+		result.Servers = append(result.Servers, BulkServer{Name: server.Name, Port: server.Port, Whitelist: server.Whitelist})
+	}
+	if !spec.Commit {
+		return result, nil
+	}
+
+	message := spec.Message
+	if message == "" {
+		message = fmt.Sprintf("Add %d copies of %s", len(copies), spec.Template)
+	}
+	change, err := m.writeBack(spec.Mode, source, message, by, func(content []byte) ([]byte, error) {
+		// The file may have changed since it was applied
+		var current config.RepoConfig
+		if err := yaml.Unmarshal(content, &current); err != nil {
+			return nil, fmt.Errorf("failed to parse config YAML: %w", err)
+		}
+		for _, server := range copies {
+			if current.Server(server.Name) != nil {
+				return nil, fmt.Errorf("server %s already exists in source %s", server.Name, source)
+			}
+		}
+		return config.AppendServers(content, copies)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit the copies: %w", err)
+	}
+	result.Change = change
+	return result, nil
+}
+
+// bulkCopies generates and validates the copies of a bulk creation and
+// returns them with the source of the template.
+// The caller must hold m.mu.
+func (m *Manager) bulkCopies(spec BulkSpec) ([]config.MinecraftServerConfig, string, error) {
+	if m.lastConfig == nil {
+		return nil, "", errors.New("no configuration has been applied yet")
+	}
+	template := m.lastConfig.Server(spec.Template)
+	if template == nil {
+		return nil, "", fmt.Errorf("%w: %s", ErrServerNotFound, spec.Template)
+	}
+	roster, err := parseRoster(spec.Roster)
+	if err != nil {
+		return nil, "", err
+	}
+
+	first, last, err := parsePortRange(spec.Ports)
+	if err != nil {
+		return nil, "", err
+	}
+	count := spec.Count
+	if count == 0 && last != 0 {
+		count = last - first + 1
+	}
+	if count == 0 && !slices.ContainsFunc(roster, func(entry rosterEntry) bool { return entry.server != "" }) {
+		count = len(roster)
+	}
+	if count < 1 || count > maxBulkCopies {
+		return nil, "", fmt.Errorf("count must be between 1 and %d", maxBulkCopies)
+	}
+	if last != 0 && count > last-first+1 {
+		return nil, "", fmt.Errorf("ports %s have room for %d servers, not %d", spec.Ports, last-first+1, count)
+	}
+
+	pattern := spec.Name
+	if pattern == "" {
+		pattern = spec.Template + "-{n}"
+	}
+	if !strings.Contains(pattern, "{n}") {
+		return nil, "", errors.New("name must contain {n}")
+	}
+	width := len(strconv.Itoa(count))
+
+	copies := make([]config.MinecraftServerConfig, count)
+	index := make(map[string]int, count*2)
+	for i := range copies {
+		copied, err := copyServerConfig(template)
+		if err != nil {
+			return nil, "", err
+		}
+		copied.Name = strings.ReplaceAll(pattern, "{n}", fmt.Sprintf("%0*d", width, i+1))
+		copied.Port = first + i
+		if spec.WorldTemplate != "" {
+			copied.WorldTemplate = spec.WorldTemplate
+		}
+		copies[i] = copied
+		index[strconv.Itoa(i+1)] = i
+		index[strings.ToLower(copied.Name)] = i
+	}
+
+	next := 0
+	for _, entry := range roster {
+		i := next % count
+		if entry.server != "" {
+			key := strings.ToLower(entry.server)
+			if n, err := strconv.Atoi(entry.server); err == nil {
+				key = strconv.Itoa(n)
+			}
+			var exists bool
+			if i, exists = index[key]; !exists {
+				return nil, "", fmt.Errorf("roster: player %s: unknown server %q", entry.player, entry.server)
+			}
+		} else {
+			next++
+		}
+		if !slices.ContainsFunc(copies[i].Whitelist, func(name string) bool { return strings.EqualFold(name, entry.player) }) {
+			copies[i].Whitelist = append(copies[i].Whitelist, entry.player)
+		}
+	}
+
+	// Check the copies as the apply of the commit would
+	candidate := *m.lastConfig
+	candidate.Servers = append(slices.Clone(m.lastConfig.Servers), copies...)
+	if err := candidate.Validate(); err != nil {
+		return nil, "", err
+	}
+	return copies, template.Source, nil
+}
+
+// copyServerConfig makes a deep copy of a server's configuration
+func copyServerConfig(server *config.MinecraftServerConfig) (config.MinecraftServerConfig, error) {
+	var copied config.MinecraftServerConfig
+	data, err := yaml.Marshal(server)
+	if err != nil {
+		return copied, err
+	}
+	if err := yaml.Unmarshal(data, &copied); err != nil {
+		return copied, err
+	}
+	copied.Source = server.Source
+	return copied, nil
+}
+
+// parsePortRange parses a port, e.g. 20000, or a range, e.g. 20000-20019.
+// last is 0 for a single port.
+func parsePortRange(ports string) (first, last int, err error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(ports), "-")
+	if first, err = strconv.Atoi(strings.TrimSpace(from)); err != nil || first < 1 || first > 65535 {
+		return 0, 0, fmt.Errorf("invalid ports %q", ports)
+	}
+	if !isRange {
+		return first, 0, nil
+	}
+	if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil || last < first || last > 65535 {
+		return 0, 0, fmt.Errorf("invalid ports %q", ports)
+	}
+	return first, last, nil
+}
+
+// parseRoster reads the players of a roster CSV. A first row naming a
+// player column is a header, otherwise the player is the first column and
+// the server the second.
+func parseRoster(roster string) ([]rosterEntry, error) {
+	reader := csv.NewReader(strings.NewReader(roster))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	playerColumn, serverColumn := 0, 1
+	var entries []rosterEntry
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("roster: %w", err)
+		}
+		if row == 0 {
+			if i := slices.IndexFunc(record, func(field string) bool { return strings.EqualFold(strings.TrimSpace(field), "player") }); i >= 0 {
+				playerColumn = i
+				serverColumn = slices.IndexFunc(record, func(field string) bool { return strings.EqualFold(strings.TrimSpace(field), "server") })
+				continue
+			}
+		}
+
+		line, _ := reader.FieldPos(0)
+		if playerColumn >= len(record) || strings.TrimSpace(record[playerColumn]) == "" {
+			return nil, fmt.Errorf("roster: line %d: no player", line)
+		}
+		entry := rosterEntry{player: strings.TrimSpace(record[playerColumn])}
+		if _, err := playerTarget(entry.player); err != nil {
+			return nil, fmt.Errorf("roster: line %d: %w", line, err)
+		}
+		if serverColumn >= 0 && serverColumn < len(record) {
+			entry.server = strings.TrimSpace(record[serverColumn])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
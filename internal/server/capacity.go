@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// SkippedServer is a configured server that is not run because it does not
+// fit into the instance limits or the resource budget
+type SkippedServer struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Reason   string `json:"reason"`
+}
+
+// planCapacity decides which configured servers may run. Servers are
+// admitted in priority order (highest first, configuration order breaking
+// ties) until the global instance limit, their group limit, the quota of
+// their tenant or the host resource budget would be exceeded. A tenant over
+// its disk quota keeps its running servers but cannot start others; disk
+// usage is the one last measured, see refreshTenantDisk.
+// The caller must hold m.mu.
+func (m *Manager) planCapacity(servers []config.MinecraftServerConfig) (map[string]bool, []SkippedServer) {
+	order := priorityOrder(servers)
+
+	tenantCounts := make(map[string]int)
+	tenantMemory := make(map[string]int64)
+
+	budgetMemory, _ := config.ParseMemory(m.config.Server.Budget.Memory)
+	budgetCPU := m.config.Server.Budget.CPU
+
+	admitted := make(map[string]bool)
+	var skipped []SkippedServer
+	groupCounts := make(map[string]int)
+	var usedMemory int64
+	var usedCPU float64
+
+	for _, i := range order {
+		serverConfig := &servers[i]
+		memory := m.serverMemory(serverConfig)
+		tenant := serverConfig.Tenant
+		limits, tenantKnown := m.tenantLimits(tenant)
+		_, managed := m.servers[serverConfig.Name]
+
+		reason := ""
+		switch {
+		case tenant != "" && !tenantKnown:
+			reason = fmt.Sprintf("unknown tenant %q", tenant)
+		case len(admitted) >= m.config.Server.MaxInstances:
+			reason = fmt.Sprintf("maximum number of servers reached (%d)", m.config.Server.MaxInstances)
+		case serverConfig.Group != "" && m.groupLimitReached(serverConfig.Group, groupCounts[serverConfig.Group]):
+			reason = fmt.Sprintf("maximum number of servers in group %s reached (%d)", serverConfig.Group, m.config.Server.GroupLimits[serverConfig.Group])
+		case limits.instances > 0 && tenantCounts[tenant] >= limits.instances:
+			reason = fmt.Sprintf("maximum number of servers of tenant %s reached (%d)", tenant, limits.instances)
+		case limits.memory > 0 && tenantMemory[tenant]+memory > limits.memory:
+			reason = fmt.Sprintf("memory quota of tenant %s exceeded (%d of %d bytes in use, %d requested)", tenant, tenantMemory[tenant], limits.memory, memory)
+		case limits.disk > 0 && !managed && m.tenantDisk[tenant] > limits.disk:
+			reason = fmt.Sprintf("disk quota of tenant %s exceeded (%d of %d bytes used)", tenant, m.tenantDisk[tenant], limits.disk)
+		case budgetMemory > 0 && usedMemory+memory > budgetMemory:
+			reason = fmt.Sprintf("memory budget exceeded (%d of %d bytes in use, %d requested)", usedMemory, budgetMemory, memory)
+		case budgetCPU > 0 && usedCPU+serverConfig.CPU > budgetCPU:
+			reason = fmt.Sprintf("CPU budget exceeded (%.2f of %.2f cores in use, %.2f requested)", usedCPU, budgetCPU, serverConfig.CPU)
+		}
+
+		if reason != "" {
+			skipped = append(skipped, SkippedServer{Name: serverConfig.Name, Priority: serverConfig.Priority, Reason: reason})
+			continue
+		}
+
+		admitted[serverConfig.Name] = true
+		groupCounts[serverConfig.Group]++
+		if tenant != "" {
+			tenantCounts[tenant]++
+			tenantMemory[tenant] += memory
+		}
+		usedMemory += memory
+		usedCPU += serverConfig.CPU
+	}
+
+	return admitted, skipped
+}
+
+// priorityOrder returns the indexes of servers sorted by priority, highest
+// first, keeping configuration order among servers of equal priority
+func priorityOrder(servers []config.MinecraftServerConfig) []int {
+	order := make([]int, len(servers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return servers[order[a]].Priority > servers[order[b]].Priority
+	})
+	return order
+}
+
+// runningByPriority returns the names of managed servers sorted by priority,
+// highest first, with ties broken by name.
+// The caller must hold m.mu.
+func (m *Manager) runningByPriority() []string {
+	names := make([]string, 0, len(m.servers))
+	for name := range m.servers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(a, b int) bool {
+		pa, pb := m.servers[names[a]].Config.Priority, m.servers[names[b]].Config.Priority
+		if pa != pb {
+			return pa > pb
+		}
+		return names[a] < names[b]
+	})
+	return names
+}
+
+func (m *Manager) groupLimitReached(group string, count int) bool {
+	limit, exists := m.config.Server.GroupLimits[group]
+	return exists && count >= limit
+}
+
+// serverMemory returns the memory reserved for a server, falling back to
+// the manager wide memory limit
+func (m *Manager) serverMemory(serverConfig *config.MinecraftServerConfig) int64 {
+	if serverConfig.Memory != "" {
+		if memory, err := config.ParseMemory(serverConfig.Memory); err == nil {
+			return memory
+		}
+	}
+	memory, _ := config.ParseMemory(m.config.Server.MemoryLimit)
+	return memory
+}
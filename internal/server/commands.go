@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Defaults and bounds of the output capture of RunCommand
+const (
+	defaultCommandQuiet   = 500 * time.Millisecond
+	defaultCommandTimeout = 5 * time.Second
+	maxCommandTimeout     = time.Minute
+	maxCommandOutput      = 1000
+)
+
+// CommandOptions controls how long RunCommand captures output. Capture
+// ends at the first line matching Expect, after Quiet without output when
+// no Expect is given, or at Timeout.
+type CommandOptions struct {
+	Expect  *regexp.Regexp
+	Quiet   time.Duration
+	Timeout time.Duration
+}
+
+// CommandResult is a console command with the output it produced
+type CommandResult struct {
+	RequestID string   `json:"request_id,omitempty"`
+	Command   string   `json:"command"`
+	Output    []string `json:"output"`
+	// Matched is set when the output ended at the expected line, TimedOut
+	// when capture ran into the timeout instead
+	Matched  bool   `json:"matched,omitempty"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// RunCommand sends a command to the console of a running server and
+// returns the console output that follows it. The console does not tell
+// which command a line answers, so commands run through RunCommand are
+// serialized per server; output of the server itself, such as players
+// joining, may still end up in the result.
+func (m *Manager) RunCommand(ctx context.Context, name, command string, opts CommandOptions) (*CommandResult, error) {
+	command = strings.TrimSpace(command)
+	if command == "" || strings.ContainsAny(command, "\r\n") {
+		return nil, fmt.Errorf("command must be a single non-empty line")
+	}
+	if opts.Quiet <= 0 {
+		opts.Quiet = defaultCommandQuiet
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultCommandTimeout
+	}
+	opts.Timeout = min(opts.Timeout, maxCommandTimeout)
+
+	m.mu.RLock()
+	server, exists := m.servers[name]
+	m.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	server.commands.Lock()
+	defer server.commands.Unlock()
+
+	session, err := m.AttachConsole(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Detach()
+
+	m.mu.RLock()
+	if server.Status != "running" {
+		m.mu.RUnlock()
+		return nil, fmt.Errorf("server %s is %s", name, server.Status)
+	}
+	m.logger.Infof("Sending command to server %s: %s", name, command)
+	err = m.sendCommand(server, command)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	result := &CommandResult{Command: command, Output: []string{}}
+	deadline := time.NewTimer(opts.Timeout)
+	defer deadline.Stop()
+	quiet := time.NewTimer(opts.Quiet)
+	defer quiet.Stop()
+	if opts.Expect != nil {
+		quiet.Stop()
+	}
+
+capture:
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			result.TimedOut = true
+			break capture
+		case <-quiet.C:
+			break capture
+		case line, open := <-session.Lines:
+			if !open {
+				// The server exited
+				break capture
+			}
+			if len(result.Output) < maxCommandOutput {
+				result.Output = append(result.Output, line)
+			}
+			if opts.Expect != nil {
+				if opts.Expect.MatchString(line) {
+					result.Matched = true
+					break capture
+				}
+				continue
+			}
+			if !quiet.Stop() {
+				<-quiet.C
+			}
+			quiet.Reset(opts.Quiet)
+		}
+	}
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	return result, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/uptime"
+)
+
+var (
+	playerConnectedPattern    = regexp.MustCompile(`Player connected: ([^,]+), xuid: (\d*)`)
+	playerDisconnectedPattern = regexp.MustCompile(`Player disconnected: ([^,]+), xuid: (\d*)`)
+)
+
+// readConsole consumes the console output of a server process, echoing it to
+// stdout, keeping the most recent lines and tracking connected players.
+func (m *Manager) readConsole(server *MinecraftServer, output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fmt.Fprintln(os.Stdout, line)
+
+		m.mu.Lock()
+		becameEmpty := m.handleConsoleLine(server, line)
+		resetWorld := becameEmpty && server.Config.ResetPolicy.OnEmpty
+		m.mu.Unlock()
+
+		if resetWorld {
+			go m.resetOnEmpty(server)
+		}
+	}
+}
+
+// handleConsoleLine updates server state from a line of console output and
+// reports whether the last player just left.
+// The caller must hold m.mu.
+func (m *Manager) handleConsoleLine(server *MinecraftServer, line string) bool {
+	server.logs.Append(line)
+
+	if m.handleGametime(server, line, time.Now()) || m.handleSaveQuery(server, line) {
+		return false
+	}
+	m.broadcastConsole(server, line)
+
+	if strings.Contains(line, "Server started.") && server.Status == "starting" {
+		m.setStatus(server, "running")
+		m.logger.Infof("Server %s is running", server.Config.Name)
+		m.recordState(server.Config.Name, uptime.StateUp)
+		m.resetSchedules(server)
+		m.applyServerSchedules(server, time.Now())
+		return false
+	}
+
+	if match := playerConnectedPattern.FindStringSubmatch(line); match != nil {
+		server.Players[match[1]] = match[2]
+		m.updateProxyPlayers(server)
+		m.logger.Infof("Player %s joined %s (%d online)", match[1], server.Config.Name, len(server.Players))
+		m.trackPlayer(server, match[1], match[2])
+		m.enforceBan(server, match[1], match[2])
+		return false
+	}
+
+	if match := playerDisconnectedPattern.FindStringSubmatch(line); match != nil {
+		delete(server.Players, match[1])
+		m.updateProxyPlayers(server)
+		m.logger.Infof("Player %s left %s (%d online)", match[1], server.Config.Name, len(server.Players))
+		return len(server.Players) == 0
+	}
+
+	m.handleConsoleBan(server, line)
+	return false
+}
+
+// sendCommand writes a command to the server console.
+// The caller must hold m.mu.
+func (m *Manager) sendCommand(server *MinecraftServer, command string) error {
+	if server.Stdin == nil {
+		return fmt.Errorf("console of server %s is not available", server.Config.Name)
+	}
+	if _, err := io.WriteString(server.Stdin, command+"\n"); err != nil {
+		return fmt.Errorf("failed to write to console of server %s: %w", server.Config.Name, err)
+	}
+	return nil
+}
+
+// updateProxyPlayers tells the proxy of a server how many players are
+// online, for its join queue and MOTD.
+// The caller must hold m.mu.
+func (m *Manager) updateProxyPlayers(server *MinecraftServer) {
+	if server.proxy != nil {
+		server.proxy.SetPlayers(len(server.Players), server.Config.MaxPlayers)
+		m.updateMOTD(server, time.Now())
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxWarnings is how many distinct content log warnings are kept per server
+const maxWarnings = 50
+
+// contentLogPattern matches content log lines such as
+// "12:00:01[Scripting][error]-Error: ..." and captures the category, the
+// level and the message
+var contentLogPattern = regexp.MustCompile(`\[([A-Za-z ]+)\]\[(error|warning|warn)\]-?\s*(.*)$`)
+
+// ContentWarning is a distinct pack or script problem reported in a server's
+// content log
+type ContentWarning struct {
+	Category  string    `json:"category"`
+	Level     string    `json:"level"`
+	Message   string    `json:"message"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// contentLog tracks how far a server's content log has been read
+type contentLog struct {
+	path     string
+	offset   int64
+	warnings []ContentWarning
+}
+
+// scanContentLogs reads new content log lines of every server that has the
+// content log enabled
+func (m *Manager) scanContentLogs() {
+	type target struct {
+		server *MinecraftServer
+		log    contentLog
+	}
+
+	m.mu.RLock()
+	var targets []target
+	for _, server := range m.servers {
+		if server.Config.ContentLogFileEnabled {
+			targets = append(targets, target{server: server, log: server.contentLog})
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, t := range targets {
+		path := latestContentLog(m.config.GetServerDir(t.server.Config.Name), t.server.StartTime)
+		if path == "" {
+			continue
+		}
+		if path != t.log.path {
+			t.log.path, t.log.offset = path, 0
+		}
+
+		lines, offset, err := readNewLines(path, t.log.offset)
+		if err != nil {
+			m.logger.Warnf("Failed to read content log of %s: %v", t.server.Config.Name, err)
+			continue
+		}
+
+		m.mu.Lock()
+		server := t.server
+		server.contentLog.path, server.contentLog.offset = path, offset
+		for _, line := range lines {
+			m.addContentWarning(server, line, time.Now())
+		}
+		m.mu.Unlock()
+	}
+}
+
+// addContentWarning classifies a content log line and records it, counting
+// repeated messages.
+// The caller must hold m.mu.
+func (m *Manager) addContentWarning(server *MinecraftServer, line string, now time.Time) {
+	match := contentLogPattern.FindStringSubmatch(line)
+	if match == nil {
+		return
+	}
+	category, level, message := match[1], match[2], strings.TrimSpace(match[3])
+	if level == "warn" {
+		level = "warning"
+	}
+
+	warnings := server.contentLog.warnings
+	for i := range warnings {
+		if warnings[i].Category == category && warnings[i].Message == message {
+			warnings[i].Count++
+			warnings[i].LastSeen = now
+			return
+		}
+	}
+
+	if level == "error" {
+		m.logger.Warnf("Content error on %s: [%s] %s", server.Config.Name, category, message)
+	}
+	warnings = append(warnings, ContentWarning{
+		Category:  category,
+		Level:     level,
+		Message:   message,
+		Count:     1,
+		FirstSeen: now,
+		LastSeen:  now,
+	})
+	if len(warnings) > maxWarnings {
+		warnings = warnings[len(warnings)-maxWarnings:]
+	}
+	server.contentLog.warnings = warnings
+}
+
+// GetWarnings returns the content log warnings of a running server
+func (m *Manager) GetWarnings(name string) ([]ContentWarning, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	return append([]ContentWarning{}, server.contentLog.warnings...), nil
+}
+
+// latestContentLog returns the most recent content log written since the
+// server started. Bedrock writes ContentLog__*.txt files to the logs
+// directory of the server.
+func latestContentLog(serverDir string, since time.Time) string {
+	matches, _ := filepath.Glob(filepath.Join(serverDir, "logs", "ContentLog*"))
+	latest := ""
+	var latestTime time.Time
+	for _, match := range matches {
+		info, err := os.Stat(match)
+		if err != nil || info.ModTime().Before(since) {
+			continue
+		}
+		if info.ModTime().After(latestTime) {
+			latest, latestTime = match, info.ModTime()
+		}
+	}
+	return latest
+}
+
+// readNewLines reads the complete lines written after offset and returns
+// them with the offset following the last complete line
+func readNewLines(path string, offset int64) ([]string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && info.Size() < offset {
+		// The file was truncated
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+
+	var lines []string
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave partial lines for the next scan
+			break
+		}
+		offset += int64(len(line))
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	return lines, offset, nil
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+)
+
+// ErrReportNotFound is returned when a crash report does not exist
+var ErrReportNotFound = errors.New("crash report not found")
+
+// maxCrashReports is how many crash bundles are kept, oldest are removed
+const maxCrashReports = 50
+
+// CrashReport is a crash bundle in the reports directory
+type CrashReport struct {
+	Name      string    `json:"name"`
+	Server    string    `json:"server"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// crashInfo is the summary written to info.json in a crash bundle
+type crashInfo struct {
+	Server         string    `json:"server"`
+	Version        string    `json:"version"`
+	BedrockPath    string    `json:"bedrock_path"`
+	Error          string    `json:"error"`
+	Crash          crash     `json:"crash"`
+	StartTime      time.Time `json:"start_time"`
+	CrashedAt      time.Time `json:"crashed_at"`
+	Uptime         string    `json:"uptime"`
+	Players        []string  `json:"players"`
+	WorldSizeBytes int64     `json:"world_size_bytes"`
+}
+
+// crashBundle is the state captured when a server crashed
+type crashBundle struct {
+	info        crashInfo
+	console     []string
+	propsPath   string
+	worldDir    string
+	managerLogs []string
+}
+
+// captureCrash collects what is needed for a crash bundle.
+// The caller must hold m.mu.
+func (m *Manager) captureCrash(server *MinecraftServer, exitErr error) *crashBundle {
+	now := time.Now()
+	name := server.Config.Name
+
+	players := make([]string, 0, len(server.Players))
+	for player := range server.Players {
+		players = append(players, player)
+	}
+	sort.Strings(players)
+
+	return &crashBundle{
+		info: crashInfo{
+			Server:      name,
+			Version:     server.Config.Version,
+			BedrockPath: server.Process.Path,
+			Error:       exitErr.Error(),
+			Crash:       *server.crash,
+			StartTime:   server.StartTime,
+			CrashedAt:   now,
+			Uptime:      now.Sub(server.StartTime).Round(time.Second).String(),
+			Players:     players,
+		},
+		console:     server.logs.Lines(),
+		propsPath:   m.config.GetServerPropertiesPath(name),
+		worldDir:    m.config.GetWorldDir(name, server.Config.WorldName),
+		managerLogs: m.logs.Lines(),
+	}
+}
+
+// reportCrash writes a crash bundle and sends a notification linking it
+func (m *Manager) reportCrash(bundle *crashBundle) {
+	name, err := m.writeCrashBundle(bundle)
+	if err != nil {
+		m.logger.Errorf("Failed to write crash report for %s: %v", bundle.info.Server, err)
+	} else {
+		m.logger.Infof("Wrote crash report %s", name)
+	}
+
+	reason := crashReasonText[bundle.info.Crash.Reason]
+	notification := notify.Notification{
+		Event:    config.NotifyServerCrashed,
+		Title:    fmt.Sprintf("Server %s crashed (%s)", bundle.info.Server, reason),
+		Message:  fmt.Sprintf("Server %s crashed after %s (%s): %s", bundle.info.Server, bundle.info.Uptime, reason, bundle.info.Error),
+		Severity: notify.SeverityCritical,
+		Server:   bundle.info.Server,
+		Fields: map[string]string{
+			"version":  bundle.info.Version,
+			"error":    bundle.info.Error,
+			"duration": bundle.info.Uptime,
+			"reason":   bundle.info.Crash.Reason,
+		},
+	}
+	if bundle.info.Crash.Signal != "" {
+		notification.Fields["signal"] = bundle.info.Crash.Signal
+	}
+	if bundle.info.Crash.ExitCode != 0 {
+		notification.Fields["exit_code"] = strconv.Itoa(bundle.info.Crash.ExitCode)
+	}
+	if name != "" {
+		notification.Fields["report"] = "/reports/" + name
+	}
+	m.notifier.Notify(notification)
+}
+
+// writeCrashBundle stores a crash bundle as a zip archive and returns its
+// name
+func (m *Manager) writeCrashBundle(bundle *crashBundle) (string, error) {
+	dir := m.reportsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	bundle.info.WorldSizeBytes = newGCItem(bundle.worldDir, "world").Size
+
+	name := fmt.Sprintf("%s-%s.zip", bundle.info.Server, bundle.info.CrashedAt.UTC().Format("20060102-150405"))
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	info, err := json.MarshalIndent(bundle.info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	properties, err := os.ReadFile(bundle.propsPath)
+	if err != nil {
+		properties = []byte(fmt.Sprintf("# failed to read server.properties: %v\n", err))
+	}
+
+	archive := zip.NewWriter(file)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"info.json", info},
+		{"console.log", []byte(strings.Join(bundle.console, "\n") + "\n")},
+		{"server.properties", properties},
+		{"manager.log", []byte(strings.Join(bundle.managerLogs, "\n") + "\n")},
+	}
+	for _, f := range files {
+		w, err := archive.Create(f.name)
+		if err != nil {
+			return "", err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return "", err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return "", err
+	}
+
+	m.pruneCrashReports()
+	return name, nil
+}
+
+// pruneCrashReports removes the oldest crash bundles beyond the limit
+func (m *Manager) pruneCrashReports() {
+	reports := m.listCrashReports()
+	for _, report := range reports[min(len(reports), maxCrashReports):] {
+		os.Remove(filepath.Join(m.reportsDir(), report.Name))
+	}
+}
+
+// GetCrashReports lists the crash bundles, most recent first
+func (m *Manager) GetCrashReports() []CrashReport {
+	return m.listCrashReports()
+}
+
+// CrashReportPath returns the path of a crash bundle
+func (m *Manager) CrashReportPath(name string) (string, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".zip") {
+		return "", fmt.Errorf("%w: %s", ErrReportNotFound, name)
+	}
+	reportPath := filepath.Join(m.reportsDir(), name)
+	if _, err := os.Stat(reportPath); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrReportNotFound, name)
+	}
+	return reportPath, nil
+}
+
+func (m *Manager) listCrashReports() []CrashReport {
+	var reports []CrashReport
+	for _, entry := range readDir(m.reportsDir()) {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || !strings.HasSuffix(entry.Name(), ".zip") {
+			continue
+		}
+		server := strings.TrimSuffix(entry.Name(), ".zip")
+		if i := strings.LastIndex(server, "-"); i > 0 {
+			if j := strings.LastIndex(server[:i], "-"); j > 0 {
+				server = server[:j]
+			}
+		}
+		reports = append(reports, CrashReport{
+			Name:      entry.Name(),
+			Server:    server,
+			Size:      info.Size(),
+			CreatedAt: info.ModTime(),
+		})
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].CreatedAt.After(reports[j].CreatedAt)
+	})
+	return reports
+}
+
+func (m *Manager) reportsDir() string {
+	return filepath.Join(m.config.Server.DataDir, "reports")
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Crash reasons, decoded from how a server process ended
+const (
+	CrashOutOfMemory = "out_of_memory"
+	CrashKilled      = "killed"
+	CrashSegfault    = "segfault"
+	CrashAborted     = "aborted"
+	CrashSignal      = "signal"
+	CrashPortInUse   = "port_in_use"
+	CrashExitCode    = "exit_code"
+)
+
+// crashReasonText describes crash reasons in notifications
+var crashReasonText = map[string]string{
+	CrashOutOfMemory: "out of memory",
+	CrashKilled:      "killed",
+	CrashSegfault:    "segmentation fault",
+	CrashAborted:     "aborted",
+	CrashSignal:      "killed by a signal",
+	CrashPortInUse:   "port in use",
+	CrashExitCode:    "exited with an error",
+}
+
+// portInUseMessages are console lines of a server that could not bind its
+// port, lowercased
+var portInUseMessages = []string{"network port occupied", "address already in use"}
+
+// crash is why a server process ended unexpectedly
+type crash struct {
+	Reason   string `json:"reason"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+}
+
+// classifyCrash decodes the exit error of a server process. Port bind
+// failures are recognized in the console output of its startup, which
+// ends with "Server started.", so that later lines such as chat messages
+// cannot be mistaken for one. A SIGKILL is attributed to the OOM killer
+// when the cgroup counted an OOM kill since the server started.
+func classifyCrash(exitErr error, startup []string, oomKillsAtStart int) crash {
+	for _, line := range startup {
+		if strings.Contains(line, "Server started.") {
+			break
+		}
+		lower := strings.ToLower(line)
+		for _, message := range portInUseMessages {
+			if strings.Contains(lower, message) {
+				return crash{Reason: CrashPortInUse, ExitCode: exitCode(exitErr)}
+			}
+		}
+	}
+
+	var exitError *exec.ExitError
+	if !errors.As(exitErr, &exitError) {
+		return crash{Reason: CrashExitCode}
+	}
+	status, ok := exitError.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return crash{Reason: CrashExitCode, ExitCode: exitError.ExitCode()}
+	}
+
+	signal := status.Signal()
+	result := crash{Reason: CrashSignal, Signal: signalName(signal)}
+	switch signal {
+	case syscall.SIGKILL:
+		result.Reason = CrashKilled
+		if kills, ok := oomKills(); ok && kills > oomKillsAtStart {
+			result.Reason = CrashOutOfMemory
+		}
+	case syscall.SIGSEGV, syscall.SIGBUS:
+		result.Reason = CrashSegfault
+	case syscall.SIGABRT:
+		result.Reason = CrashAborted
+	}
+	return result
+}
+
+func exitCode(err error) int {
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	return 0
+}
+
+// signalName returns the conventional name of a signal, e.g. SIGSEGV
+func signalName(signal syscall.Signal) string {
+	names := map[syscall.Signal]string{
+		syscall.SIGKILL: "SIGKILL",
+		syscall.SIGSEGV: "SIGSEGV",
+		syscall.SIGBUS:  "SIGBUS",
+		syscall.SIGABRT: "SIGABRT",
+		syscall.SIGTERM: "SIGTERM",
+		syscall.SIGINT:  "SIGINT",
+		syscall.SIGHUP:  "SIGHUP",
+		syscall.SIGILL:  "SIGILL",
+		syscall.SIGFPE:  "SIGFPE",
+	}
+	if name, exists := names[signal]; exists {
+		return name
+	}
+	return "signal " + strconv.Itoa(int(signal))
+}
+
+// oomKills returns how many processes the OOM killer has killed in the
+// manager's cgroup, which its servers share. ok is false without cgroup v2
+// memory accounting.
+func oomKills() (int, bool) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return 0, false
+	}
+	// The cgroup v2 entry is "0::/path"
+	var path string
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, found := strings.CutPrefix(line, "0::"); found {
+			path = rest
+		}
+	}
+	if path == "" {
+		return 0, false
+	}
+
+	file, err := os.Open(filepath.Join("/sys/fs/cgroup", path, "memory.events"))
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "oom_kill "); found {
+			kills, err := strconv.Atoi(value)
+			return kills, err == nil
+		}
+	}
+	return 0, false
+}
+
+// crashRestartDelay is how long a crashed server waits before it is
+// restarted
+const crashRestartDelay = 10 * time.Second
+
+// scheduleCrashRestart restarts a crashed server with restart_on_crash
+// after a short delay. Servers whose port is taken are left crashed, a
+// restart would fail the same way.
+// The caller must hold m.mu.
+func (m *Manager) scheduleCrashRestart(server *MinecraftServer) {
+	name := server.Config.Name
+	if !server.Config.RestartOnCrash || m.shutdownStatus != nil {
+		return
+	}
+	if server.crash.Reason == CrashPortInUse {
+		m.logger.Warnf("Not restarting server %s, its port is in use", name)
+		return
+	}
+
+	m.logger.Infof("Restarting server %s in %s after it crashed (%s)", name, crashRestartDelay, server.crash.Reason)
+	time.AfterFunc(crashRestartDelay, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		// The server may have been restarted, replaced or removed meanwhile
+		if m.servers[name] != server || server.Status != "crashed" || m.shutdownStatus != nil || m.freeze != nil {
+			return
+		}
+		serverConfig := server.Config
+		m.stopServer(name)
+		if err := m.startServer(serverConfig); err != nil {
+			m.logger.Errorf("Failed to restart server %s after it crashed: %v", name, err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"strings"
+
+	"minecraft-server-manager/internal/github"
+)
+
+// startDeployment creates a GitHub deployment for an apply and marks it in
+// progress. It returns nil when deployments are disabled or could not be
+// created; reporting never blocks an apply.
+func (m *Manager) startDeployment(commitSHA string) *github.Deployment {
+	settings := m.config.GitHub.Deployments
+	if !settings.Enabled {
+		return nil
+	}
+
+	deployment, err := m.sources.CreateDeployment(commitSHA, settings.Environment, "Minecraft server configuration")
+	if err != nil {
+		m.logger.Errorf("Failed to create GitHub deployment for %s: %v", commitSHA[:8], err)
+		if deployment == nil {
+			return nil
+		}
+	}
+
+	if err := m.sources.SetDeploymentStatus(deployment, "in_progress", "Applying configuration", m.deploymentLogURL(commitSHA)); err != nil {
+		m.logger.Errorf("Failed to update GitHub deployment for %s: %v", commitSHA[:8], err)
+	}
+	return deployment
+}
+
+// finishDeployment posts the final state of a deployment
+func (m *Manager) finishDeployment(deployment *github.Deployment, commitSHA, state, description string) {
+	if deployment == nil {
+		return
+	}
+
+	if err := m.sources.SetDeploymentStatus(deployment, state, description, m.deploymentLogURL(commitSHA)); err != nil {
+		m.logger.Errorf("Failed to update GitHub deployment for %s: %v", commitSHA[:8], err)
+	}
+}
+
+func (m *Manager) deploymentLogURL(commitSHA string) string {
+	return strings.ReplaceAll(m.config.GitHub.Deployments.LogURL, "{sha}", commitSHA)
+}
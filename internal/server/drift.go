@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/notify"
+)
+
+// Drift items
+const (
+	DriftProperties  = "server.properties"
+	DriftWhitelist   = "whitelist.json"
+	DriftPermissions = "permissions.json"
+	DriftProcess     = "process"
+)
+
+// Drift is a difference between a running server and the configuration it
+// was applied with, e.g. a file edited by hand on the host
+type Drift struct {
+	Server  string   `json:"server"`
+	Item    string   `json:"item"`
+	Details []string `json:"details"`
+
+	// Corrected is set when the item was put back as configured
+	Corrected bool `json:"corrected,omitempty"`
+}
+
+// DriftReport lists the drift found by a check
+type DriftReport struct {
+	Checked time.Time `json:"checked"`
+	Drifts  []Drift   `json:"drifts"`
+}
+
+// GetDrift returns the report of the last drift check, nil before the
+// first one
+func (m *Manager) GetDrift() *DriftReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.drift
+}
+
+// CheckDrift compares the generated files and the processes of running
+// servers with their configuration and, when correct is set, writes
+// drifted files again
+func (m *Manager) CheckDrift(correct bool) *DriftReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.checkDrift(time.Now(), correct)
+}
+
+// checkDriftDue runs the periodic drift check once its interval passed
+func (m *Manager) checkDriftDue(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	interval := time.Duration(m.config.Drift.Interval) * time.Minute
+	if interval <= 0 || m.drift != nil && now.Sub(m.drift.Checked) < interval-time.Second {
+		return
+	}
+	m.checkDrift(now, m.config.Drift.Correct)
+}
+
+// checkDrift checks every running server for drift, reports new drift and
+// keeps the report. Drift is only reported while the manager is frozen or
+// in safe mode.
+// The caller must hold m.mu.
+func (m *Manager) checkDrift(now time.Time, correct bool) *DriftReport {
+	correct = correct && !m.paused()
+	seen := make(map[string]bool)
+	if m.drift != nil {
+		for _, drift := range m.drift.Drifts {
+			seen[drift.Server+"/"+drift.Item] = true
+		}
+	}
+
+	report := &DriftReport{Checked: now, Drifts: []Drift{}}
+	names := make([]string, 0, len(m.servers))
+	for name, server := range m.servers {
+		// Servers being started or stopped write their files
+		if server.Status == "running" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		server := m.servers[name]
+		for _, drift := range m.serverDrift(server) {
+			if correct && !m.isLocked(name) {
+				m.correctDrift(server, &drift)
+			}
+			report.Drifts = append(report.Drifts, drift)
+
+			if seen[drift.Server+"/"+drift.Item] {
+				continue
+			}
+			m.logger.Warnf("Server %s drifted from its configuration in %s: %s", drift.Server, drift.Item, strings.Join(drift.Details, "; "))
+			m.events.Publish(events.DriftDetected, drift.Server, map[string]interface{}{"item": drift.Item, "details": drift.Details, "corrected": drift.Corrected})
+			go m.notifier.Notify(notify.Notification{
+				Event:    config.NotifyServerDrift,
+				Title:    fmt.Sprintf("Server %s drifted from its configuration", drift.Server),
+				Message:  fmt.Sprintf("%s of server %s differs from its configuration: %s", drift.Item, drift.Server, strings.Join(drift.Details, "; ")),
+				Severity: notify.SeverityWarning,
+				Server:   drift.Server,
+				Fields:   map[string]string{"item": drift.Item, "corrected": fmt.Sprint(drift.Corrected)},
+			})
+		}
+	}
+	m.drift = report
+	return report
+}
+
+// serverDrift compares the files and the process of a running server with
+// the configuration it was applied with.
+// The caller must hold m.mu.
+func (m *Manager) serverDrift(server *MinecraftServer) []Drift {
+	serverConfig := server.Config
+	name := serverConfig.Name
+	var drifts []Drift
+	add := func(item string, details []string) {
+		if len(details) > 0 {
+			drifts = append(drifts, Drift{Server: name, Item: item, Details: details})
+		}
+	}
+
+	if desired, err := m.serverProperties(serverConfig); err != nil {
+		m.logger.Warnf("Cannot check server.properties of %s for drift: %v", name, err)
+	} else {
+		var ignored []string
+		if strings.Contains(serverConfig.Motd, "{") {
+			// The variables of the MOTD change the server name over time
+			ignored = append(ignored, "server-name")
+		}
+		add(DriftProperties, propertiesDrift(desired, m.config.GetServerPropertiesPath(name), ignored...))
+	}
+
+	var whitelist []string
+	for _, entry := range m.whitelistEntries(serverConfig) {
+		whitelist = append(whitelist, entry.Name)
+	}
+	add(DriftWhitelist, whitelistDrift(whitelist, m.config.GetWhitelistPath(name)))
+
+	permissions := make(map[string]string)
+	for _, entry := range m.permissionsEntries(serverConfig) {
+		permissions[strings.ToLower(entry.Name)] = entry.Permission
+	}
+	add(DriftPermissions, permissionsDrift(permissions, m.config.GetPermissionsPath(name)))
+
+	if server.Process != nil && server.Process.Process != nil {
+		add(DriftProcess, processDrift(server.Process.Process.Pid, m.serverArgs(serverConfig)))
+	}
+	return drifts
+}
+
+// correctDrift writes a drifted file again and has the server pick it up.
+// A drifted process is only reported, a restart corrects it.
+// The caller must hold m.mu.
+func (m *Manager) correctDrift(server *MinecraftServer, drift *Drift) {
+	name := server.Config.Name
+	var err error
+	switch drift.Item {
+	case DriftProperties:
+		err = m.correctProperties(server)
+	case DriftWhitelist, DriftPermissions:
+		err = m.refreshPlayerFiles(server)
+	default:
+		return
+	}
+	if err != nil {
+		m.logger.Errorf("Failed to correct the drift of %s in %s: %v", name, drift.Item, err)
+		return
+	}
+	drift.Corrected = true
+	m.logger.Infof("Corrected the drift of %s in %s", name, drift.Item)
+}
+
+// correctProperties writes server.properties again and sets the
+// properties a running server applies live through the console; the others
+// take effect at the next start.
+// The caller must hold m.mu.
+func (m *Manager) correctProperties(server *MinecraftServer) error {
+	changed, err := m.changedProperties(server.Config)
+	if err != nil {
+		return err
+	}
+	if err := m.createServerProperties(server.Config, m.config.GetServerPropertiesPath(server.Config.Name)); err != nil {
+		return err
+	}
+	var commands []string
+	for key, value := range changed {
+		if command := liveProperties[key]; command != nil && value != "" {
+			commands = append(commands, command(value))
+		}
+	}
+	sort.Strings(commands)
+	for _, command := range commands {
+		if err := m.sendCommand(server, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// propertiesDrift lists the properties of a server.properties file that
+// differ from the desired ones, except the ignored ones
+func propertiesDrift(desired map[string]string, path string, ignored ...string) []string {
+	current, err := readProperties(path)
+	if err != nil {
+		return []string{fmt.Sprintf("cannot be read: %v", err)}
+	}
+	var details []string
+	for key, value := range desired {
+		actual, exists := current[key]
+		switch {
+		case slices.Contains(ignored, key):
+		case !exists:
+			details = append(details, fmt.Sprintf("%s is missing, configured %q", key, value))
+		case actual != value:
+			details = append(details, fmt.Sprintf("%s is %q, configured %q", key, actual, value))
+		}
+	}
+	for key, value := range current {
+		if _, exists := desired[key]; !exists && !slices.Contains(ignored, key) {
+			details = append(details, fmt.Sprintf("%s is %q, not configured", key, value))
+		}
+	}
+	sort.Strings(details)
+	return details
+}
+
+// whitelistDrift lists the players added to or missing from an allowlist
+// file, ignoring case and XUIDs, which servers fill in themselves
+func whitelistDrift(desired []string, path string) []string {
+	var entries []WhitelistEntry
+	if err := readJSONFile(path, &entries); err != nil {
+		return []string{fmt.Sprintf("cannot be read: %v", err)}
+	}
+	var current []string
+	for _, entry := range entries {
+		current = append(current, entry.Name)
+	}
+	var details []string
+	for _, player := range current {
+		if !slices.ContainsFunc(desired, func(name string) bool { return strings.EqualFold(name, player) }) {
+			details = append(details, fmt.Sprintf("%s is allowed, not configured", player))
+		}
+	}
+	for _, player := range desired {
+		if !slices.ContainsFunc(current, func(name string) bool { return strings.EqualFold(name, player) }) {
+			details = append(details, fmt.Sprintf("%s is missing", player))
+		}
+	}
+	sort.Strings(details)
+	return details
+}
+
+// permissionsDrift lists the players whose permission in a permissions
+// file differs from the desired one, keyed by lowercase name
+func permissionsDrift(desired map[string]string, path string) []string {
+	var entries []PermissionsEntry
+	if err := readJSONFile(path, &entries); err != nil {
+		return []string{fmt.Sprintf("cannot be read: %v", err)}
+	}
+	current := make(map[string]PermissionsEntry)
+	for _, entry := range entries {
+		current[strings.ToLower(entry.Name)] = entry
+	}
+	var details []string
+	for key, entry := range current {
+		if permission, exists := desired[key]; !exists {
+			details = append(details, fmt.Sprintf("%s is %s, not configured", entry.Name, entry.Permission))
+		} else if permission != entry.Permission {
+			details = append(details, fmt.Sprintf("%s is %s, configured %s", entry.Name, entry.Permission, permission))
+		}
+	}
+	for key, permission := range desired {
+		if _, exists := current[key]; !exists {
+			details = append(details, fmt.Sprintf("%s is missing, configured %s", key, permission))
+		}
+	}
+	sort.Strings(details)
+	return details
+}
+
+// processDrift compares the arguments of a server process with the
+// desired ones. Without /proc, e.g. on macOS, there is nothing to compare.
+func processDrift(pid int, desired []string) []string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	args := strings.Split(string(bytes.TrimRight(data, "\x00")), "\x00")
+	if len(args) > 0 {
+		// The executable may be invoked through another path
+		args = args[1:]
+	}
+	if slices.Equal(args, desired) {
+		return nil
+	}
+	return []string{fmt.Sprintf("runs with %q, configured %q", strings.Join(args, " "), strings.Join(desired, " "))}
+}
+
+// readJSONFile decodes a JSON file; an empty file or "null" leaves v as it
+// is
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,25 @@
+package server
+
+import "minecraft-server-manager/internal/events"
+
+// eventHistory is how many events are kept for subscribers that reconnect
+const eventHistory = 1000
+
+// Events returns the bus publishing the manager's activity
+func (m *Manager) Events() *events.Bus {
+	return m.events
+}
+
+// setStatus changes the status of a server and publishes the transition
+// and the status snapshot.
+// The caller must hold m.mu.
+func (m *Manager) setStatus(server *MinecraftServer, status string) {
+	previous := server.Status
+	server.Status = status
+	data := map[string]interface{}{"status": status}
+	if previous != "" {
+		data["previous"] = previous
+	}
+	m.events.Publish(events.ServerStatus, server.Config.Name, data)
+	m.publishStatus()
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/nbt"
+)
+
+// experimentKeys maps the typed experiment flags to their level.dat keys
+func experimentKeys(experiments *config.Experiments) map[string]bool {
+	return map[string]bool{
+		"gametest":                     experiments.BetaAPIs,
+		"data_driven_biomes":           experiments.CustomBiomes,
+		"upcoming_creator_features":    experiments.UpcomingCreatorFeatures,
+		"data_driven_items":            experiments.HolidayCreatorFeatures,
+		"experimental_molang_features": experiments.ExperimentalMolangFeatures,
+		"villager_trades_rebalance":    experiments.VillagerTradesRebalance,
+	}
+}
+
+// applyExperiments writes the configured experiment toggles into the
+// world's level.dat. Worlds that have not been created yet are skipped;
+// Bedrock creates them on first start and the toggles are applied on the
+// next restart.
+func (m *Manager) applyExperiments(serverConfig *config.MinecraftServerConfig) error {
+	if serverConfig.Experiments == nil {
+		return nil
+	}
+
+	levelPath := filepath.Join(m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName), "level.dat")
+	if _, err := os.Stat(levelPath); os.IsNotExist(err) {
+		m.logger.Infof("World for %s does not exist yet, experiments will be applied on next restart", serverConfig.Name)
+		return nil
+	}
+
+	level, err := nbt.ReadLevelDat(levelPath)
+	if err != nil {
+		return fmt.Errorf("failed to read level.dat: %w", err)
+	}
+
+	var experiments nbt.Compound
+	if tag, ok := level.Root.Get("experiments"); ok {
+		if existing, ok := tag.Value.(nbt.Compound); ok {
+			experiments = existing
+		}
+	}
+
+	changed := false
+	anyEnabled := false
+	for key, enabled := range experimentKeys(serverConfig.Experiments) {
+		value := boolByte(enabled)
+		if tag, ok := experiments.Get(key); !ok || tag.Value != value {
+			// Absent keys mean disabled, avoid adding noise to the file
+			if ok || enabled {
+				experiments.Set(key, nbt.TagByte, value)
+				changed = true
+			}
+		}
+		anyEnabled = anyEnabled || enabled
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if anyEnabled {
+		experiments.Set("experiments_ever_used", nbt.TagByte, boolByte(true))
+		experiments.Set("saved_with_toggled_experiments", nbt.TagByte, boolByte(true))
+	}
+	level.Root.Set("experiments", nbt.TagCompound, experiments)
+
+	if err := nbt.WriteLevelDat(levelPath, level); err != nil {
+		return fmt.Errorf("failed to write level.dat: %w", err)
+	}
+
+	m.logger.Infof("Updated world experiments for %s", serverConfig.Name)
+	return nil
+}
+
+func experimentsEqual(a, b *config.Experiments) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func boolByte(v bool) int8 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"minecraft-server-manager/internal/events"
+)
+
+// ErrFrozen is returned for changes refused while the manager is frozen
+var ErrFrozen = errors.New("manager is frozen")
+
+// ErrNotFrozen is returned when lifting a freeze that is not in place
+var ErrNotFrozen = errors.New("manager is not frozen")
+
+// freezeWait is how often a rollout checks whether a freeze was lifted
+const freezeWait = 10 * time.Second
+
+// Freeze stops the manager from applying configuration and restarting
+// servers, e.g. during an incident or a tournament, while servers keep
+// running and being monitored
+type Freeze struct {
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Since  time.Time `json:"since"`
+
+	// Pending is the commit waiting to be applied once the freeze is
+	// lifted
+	Pending string `json:"pending,omitempty"`
+}
+
+func (m *Manager) freezePath() string {
+	return filepath.Join(m.config.Server.DataDir, "freeze.json")
+}
+
+// loadFreeze reads a freeze that outlived the previous manager process
+func (m *Manager) loadFreeze() error {
+	data, err := os.ReadFile(m.freezePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var freeze Freeze
+	if err := json.Unmarshal(data, &freeze); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.freezePath(), err)
+	}
+	m.mu.Lock()
+	m.freeze = &freeze
+	m.mu.Unlock()
+	m.logger.Warnf("Manager is frozen since %s: configuration is not applied and servers are not restarted", freeze.Since.Format(time.RFC3339))
+	return nil
+}
+
+// saveFreeze writes the freeze, or removes it once lifted.
+// The caller must hold m.mu.
+func (m *Manager) saveFreeze() error {
+	if m.freeze == nil {
+		if err := os.Remove(m.freezePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m.freeze, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.freezePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.freezePath())
+}
+
+// GetFreeze returns the freeze in place, nil when the manager is not
+// frozen
+func (m *Manager) GetFreeze() *Freeze {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.freezeStatus()
+}
+
+// freezeStatus returns a copy of the freeze with the commit waiting for
+// it, nil when the manager is not frozen.
+// The caller must hold m.mu.
+func (m *Manager) freezeStatus() *Freeze {
+	if m.freeze == nil {
+		return nil
+	}
+	freeze := *m.freeze
+	freeze.Pending = m.queue.waiting()
+	return &freeze
+}
+
+// FreezeManager freezes the manager: new commits wait until the freeze is
+// lifted, and neither rollouts, maximum uptime restarts, scheduled world
+// resets nor crash restarts restart servers. An apply in progress
+// finishes. Freezing again updates the reason.
+func (m *Manager) FreezeManager(reason, by string) *Freeze {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.freeze == nil {
+		m.freeze = &Freeze{Since: time.Now()}
+	}
+	m.freeze.Reason, m.freeze.By = reason, by
+	if err := m.saveFreeze(); err != nil {
+		m.logger.Errorf("Failed to save freeze: %v", err)
+	}
+	m.logger.Warnf("Manager frozen by %s: %s", by, reason)
+	m.events.Publish(events.ManagerFrozen, "", map[string]interface{}{"reason": reason, "by": by})
+	m.publishStatus()
+	return m.freezeStatus()
+}
+
+// Unfreeze lifts the freeze, applying the commit that waited for it
+func (m *Manager) Unfreeze(by string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.freeze == nil {
+		return ErrNotFrozen
+	}
+	since := m.freeze.Since
+	m.freeze = nil
+	if err := m.saveFreeze(); err != nil {
+		m.logger.Errorf("Failed to save freeze: %v", err)
+	}
+	m.logger.Infof("Manager unfrozen by %s after %s", by, time.Since(since).Round(time.Second))
+	m.events.Publish(events.ManagerUnfrozen, "", map[string]interface{}{"by": by})
+	m.publishStatus()
+	m.queue.wake()
+	return nil
+}
+
+// Frozen reports whether the manager is frozen
+func (m *Manager) Frozen() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.freeze != nil
+}
+
+// checkFrozen refuses a change while the manager is frozen.
+// The caller must hold m.mu.
+func (m *Manager) checkFrozen() error {
+	if m.freeze == nil {
+		return nil
+	}
+	if m.freeze.Reason != "" {
+		return fmt.Errorf("%w: %s", ErrFrozen, m.freeze.Reason)
+	}
+	return ErrFrozen
+}
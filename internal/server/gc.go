@@ -0,0 +1,216 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// GCItem is an artifact considered for removal
+type GCItem struct {
+	Path    string    `json:"path"`
+	Kind    string    `json:"kind"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Removed bool      `json:"removed"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// GCReport lists unreferenced artifacts found by a garbage collection run
+type GCReport struct {
+	DryRun       bool      `json:"dry_run"`
+	GracePeriod  string    `json:"grace_period"`
+	Items        []GCItem  `json:"items"`
+	Retained     int       `json:"retained"`
+	ReclaimBytes int64     `json:"reclaim_bytes"`
+	RunAt        time.Time `json:"run_at"`
+}
+
+// CollectGarbage removes downloaded Bedrock versions, world template
+// archives and deployed behavior packs that are not referenced by the current
+// configuration and have not been modified within the grace period. With
+// dryRun set, nothing is removed and the report only lists candidates.
+func (m *Manager) CollectGarbage(dryRun bool) (*GCReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastConfig == nil {
+		return nil, fmt.Errorf("no configuration applied yet")
+	}
+
+	gracePeriod := time.Duration(m.config.GC.GracePeriod) * time.Hour
+	report := &GCReport{
+		DryRun:      dryRun,
+		GracePeriod: gracePeriod.String(),
+		RunAt:       time.Now(),
+	}
+	cutoff := report.RunAt.Add(-gracePeriod)
+
+	var candidates []GCItem
+	candidates = append(candidates, m.unusedVersions()...)
+	candidates = append(candidates, m.unusedTemplates()...)
+	candidates = append(candidates, m.unusedPacks()...)
+
+	for _, item := range candidates {
+		if item.ModTime.After(cutoff) {
+			report.Retained++
+			continue
+		}
+
+		if !dryRun {
+			if !m.removeGCItem(&item) {
+				report.Retained++
+				continue
+			}
+		}
+
+		report.ReclaimBytes += item.Size
+		report.Items = append(report.Items, item)
+	}
+
+	verb := "Removed"
+	if dryRun {
+		verb = "Would remove"
+	}
+	m.logger.Infof("Garbage collection found %d unused artifacts (%d bytes), %d within grace period",
+		len(report.Items), report.ReclaimBytes, report.Retained)
+	for _, item := range report.Items {
+		if item.Error != "" {
+			m.logger.Errorf("Failed to remove %s: %s", item.Path, item.Error)
+			continue
+		}
+		m.logger.Infof("%s unused %s %s (%d bytes)", verb, item.Kind, item.Path, item.Size)
+	}
+
+	return report, nil
+}
+
+// removeGCItem removes an artifact, recording the outcome in the item. It
+// reports false for a cached version or template being downloaded, which
+// is kept.
+func (m *Manager) removeGCItem(item *GCItem) bool {
+	if item.Kind != "pack" {
+		lock, _ := m.downloads.LoadOrStore(item.Path, &sync.Mutex{})
+		if !lock.(*sync.Mutex).TryLock() {
+			return false
+		}
+		defer lock.(*sync.Mutex).Unlock()
+	}
+	if err := os.RemoveAll(item.Path); err != nil {
+		item.Error = err.Error()
+		return true
+	}
+	item.Removed = true
+	// Deployed packs carry a hash file next to them
+	if item.Kind == "pack" {
+		os.Remove(item.Path + ".sha256")
+	}
+	return true
+}
+
+// serverConfigsInUse returns the configured servers and the configuration
+// the running servers were started with, which may be an older one.
+// The caller must hold m.mu.
+func (m *Manager) serverConfigsInUse() []*config.MinecraftServerConfig {
+	configs := make([]*config.MinecraftServerConfig, 0, len(m.lastConfig.Servers)+len(m.servers))
+	for i := range m.lastConfig.Servers {
+		configs = append(configs, &m.lastConfig.Servers[i])
+	}
+	for _, server := range m.servers {
+		configs = append(configs, server.Config)
+	}
+	return configs
+}
+
+// unusedVersions lists Bedrock versions in the cache that no server uses.
+// The caller must hold m.mu.
+func (m *Manager) unusedVersions() []GCItem {
+	used := make(map[string]bool)
+	for _, serverConfig := range m.serverConfigsInUse() {
+		used[serverConfig.Version] = true
+	}
+
+	var items []GCItem
+	for _, entry := range readDir(filepath.Join(m.config.Server.CacheDir, "versions")) {
+		if !used[entry.Name()] {
+			items = append(items, newGCItem(filepath.Join(m.config.Server.CacheDir, "versions", entry.Name()), "version"))
+		}
+	}
+	return items
+}
+
+// unusedTemplates lists cached world template archives that are not the
+// current version of a configured template.
+// The caller must hold m.mu.
+func (m *Manager) unusedTemplates() []GCItem {
+	used := make(map[string]bool)
+	for name, template := range m.lastConfig.WorldTemplates {
+		used[fmt.Sprintf("%s-%s.zip", name, strings.ToLower(template.SHA256))] = true
+	}
+
+	var items []GCItem
+	for _, entry := range readDir(filepath.Join(m.config.Server.CacheDir, "templates")) {
+		if !used[entry.Name()] {
+			items = append(items, newGCItem(filepath.Join(m.config.Server.CacheDir, "templates", entry.Name()), "template"))
+		}
+	}
+	return items
+}
+
+// unusedPacks lists deployed behavior packs that neither the configuration
+// nor a running server references, including packs of servers removed from
+// the configuration.
+// The caller must hold m.mu.
+func (m *Manager) unusedPacks() []GCItem {
+	used := make(map[string]bool)
+	for _, serverConfig := range m.serverConfigsInUse() {
+		for _, pack := range serverConfig.Packs() {
+			used[filepath.Join(m.config.GetServerDir(serverConfig.Name), "behavior_packs", path.Base(pack.Path))] = true
+		}
+	}
+
+	var items []GCItem
+	for _, serverEntry := range readDir(m.config.Server.BaseDir) {
+		packsDir := filepath.Join(m.config.Server.BaseDir, serverEntry.Name(), "behavior_packs")
+		for _, entry := range readDir(packsDir) {
+			packDir := filepath.Join(packsDir, entry.Name())
+			if entry.IsDir() && !used[packDir] {
+				items = append(items, newGCItem(packDir, "pack"))
+			}
+		}
+	}
+	return items
+}
+
+func readDir(dir string) []os.DirEntry {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	return entries
+}
+
+func newGCItem(itemPath, kind string) GCItem {
+	item := GCItem{Path: itemPath, Kind: kind}
+
+	filepath.Walk(itemPath, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			item.Size += info.Size()
+		}
+		if info.ModTime().After(item.ModTime) {
+			item.ModTime = info.ModTime()
+		}
+		return nil
+	})
+
+	return item
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+var heartbeatClient = &http.Client{Timeout: 10 * time.Second}
+
+// pingPollHeartbeat tells the external monitor that polling works
+func (m *Manager) pingPollHeartbeat() {
+	if m.config.Heartbeat.URL != "" {
+		go m.ping(m.config.Heartbeat.URL)
+	}
+}
+
+// pingServerHeartbeats pings the monitor of every running server
+func (m *Manager) pingServerHeartbeats() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, url := range m.config.Heartbeat.Servers {
+		if server, exists := m.servers[name]; exists && server.Status == "running" {
+			go m.ping(url)
+		}
+	}
+}
+
+// ping sends a heartbeat. Failures are only logged, a missing heartbeat is
+// what the monitor alerts on.
+func (m *Manager) ping(url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		m.logger.Warnf("Invalid heartbeat URL %s: %v", url, err)
+		return
+	}
+	resp, err := heartbeatClient.Do(req)
+	if err != nil {
+		m.logger.Warnf("Failed to send heartbeat: %v", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		m.logger.Warnf("Heartbeat returned status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/hooks"
+)
+
+// hibernateTimeout bounds the hibernate command
+const hibernateTimeout = 5 * time.Minute
+
+// hibernation is recorded when the host hibernates, so that the next boot
+// knows it resumed from hibernation rather than a crash
+type hibernation struct {
+	Since  time.Time  `json:"since"`
+	WakeAt *time.Time `json:"wake_at,omitempty"`
+}
+
+func (m *Manager) hibernationPath() string {
+	return filepath.Join(m.config.Server.DataDir, "hibernation.json")
+}
+
+// loadHibernation reports a hibernation the host resumed from and forgets
+// it
+func (m *Manager) loadHibernation() error {
+	data, err := os.ReadFile(m.hibernationPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var record hibernation
+	if err := json.Unmarshal(data, &record); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.hibernationPath(), err)
+	}
+	m.logger.Infof("Resumed after hibernating since %s", record.Since.Format(time.RFC3339))
+	m.events.Publish(events.HostResumed, "", map[string]interface{}{"since": record.Since})
+	return os.Remove(m.hibernationPath())
+}
+
+// checkHibernate hibernates the host once every configured server has been
+// scheduled off for hibernate.idle_minutes, unless the next operating
+// hours begin within hibernate.min_off_minutes
+func (m *Manager) checkHibernate(now time.Time) {
+	cfg := m.config.Hibernate
+	if !cfg.Enabled {
+		return
+	}
+
+	m.mu.Lock()
+	if !m.allScheduledOff() {
+		m.offSince, m.hibernating = time.Time{}, false
+		m.mu.Unlock()
+		return
+	}
+	if m.offSince.IsZero() {
+		m.offSince = now
+	}
+	if m.hibernating || now.Sub(m.offSince) < time.Duration(cfg.IdleMinutes)*time.Minute {
+		m.mu.Unlock()
+		return
+	}
+	var wakeAt *time.Time
+	for i := range m.lastConfig.Servers {
+		next := nextOperatingStart(&m.lastConfig.Servers[i], now)
+		if !next.IsZero() && (wakeAt == nil || next.Before(*wakeAt)) {
+			wakeAt = &next
+		}
+	}
+	if wakeAt != nil && wakeAt.Sub(now) < time.Duration(cfg.MinOffMinutes)*time.Minute {
+		m.mu.Unlock()
+		return
+	}
+	m.hibernating = true
+	m.saveState()
+	m.mu.Unlock()
+
+	go m.hibernate(now, wakeAt)
+}
+
+// allScheduledOff reports whether every configured server is scheduled
+// off and none is running.
+// The caller must hold m.mu.
+func (m *Manager) allScheduledOff() bool {
+	if m.lastConfig == nil || len(m.lastConfig.Servers) == 0 || len(m.servers) > 0 || m.shutdownStatus != nil || m.paused() {
+		return false
+	}
+	for _, serverConfig := range m.lastConfig.Servers {
+		if _, off := m.scheduledOff[serverConfig.Name]; !off {
+			return false
+		}
+	}
+	return true
+}
+
+// saveState writes the state kept in memory, so that the next boot starts
+// where this one left off.
+// The caller must hold m.mu.
+func (m *Manager) saveState() {
+	if err := m.saveBans(); err != nil {
+		m.logger.Errorf("Failed to save bans: %v", err)
+	}
+	if err := m.savePlayers(); err != nil {
+		m.logger.Errorf("Failed to save known players: %v", err)
+	}
+	if err := m.saveLocked(); err != nil {
+		m.logger.Errorf("Failed to save server locks: %v", err)
+	}
+}
+
+// hibernate records the hibernation, flushes the state to disk and stops
+// the host through the hibernate command and hooks. When the command
+// returns, the host resumed or the command failed, and it hibernates again
+// after hibernate.idle_minutes.
+func (m *Manager) hibernate(now time.Time, wakeAt *time.Time) {
+	wake := "no server is scheduled to start again"
+	if wakeAt != nil {
+		wake = "next needed at " + wakeAt.Format(time.RFC3339)
+	}
+	m.logger.Infof("Every server is scheduled off, hibernating the host (%s)", wake)
+	m.events.Publish(events.HostHibernating, "", map[string]interface{}{"wake_at": wakeAt})
+
+	if err := m.recordHibernation(hibernation{Since: now, WakeAt: wakeAt}); err != nil {
+		m.logger.Errorf("Failed to record hibernation: %v", err)
+	}
+	if err := m.syncState(); err != nil {
+		m.logger.Errorf("Failed to flush the state in %s to disk: %v", m.config.Server.DataDir, err)
+	}
+
+	host, _ := os.Hostname()
+	m.hooks.Fire(hooks.Payload{Event: config.HookHostHibernate, Time: now, Host: host, WakeAt: wakeAt})
+
+	command := m.config.Hibernate.Command
+	if len(command) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hibernateTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = os.Environ()
+	if wakeAt != nil {
+		cmd.Env = append(cmd.Env, "PARTY_WAKE_AT="+wakeAt.Format(time.RFC3339))
+	}
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		// A command that suspends the host returns once it resumed
+		m.logger.Infof("Hibernate command finished: %s", output)
+		if err := m.loadHibernation(); err != nil {
+			m.logger.Errorf("Failed to clear hibernation record: %v", err)
+		}
+	} else {
+		m.logger.Errorf("Hibernate command failed: %v: %s", err, output)
+		os.Remove(m.hibernationPath())
+	}
+
+	m.mu.Lock()
+	if m.hibernating {
+		m.offSince, m.hibernating = time.Now(), false
+	}
+	m.mu.Unlock()
+}
+
+func (m *Manager) recordHibernation(record hibernation) error {
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.hibernationPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.hibernationPath())
+}
+
+// syncState flushes the state files written before hibernating and the
+// data directory holding them to disk, so that they survive a host that is
+// powered off rather than shut down
+func (m *Manager) syncState() error {
+	for _, path := range []string{m.bansPath(), m.playersPath(), m.lockedPath(), m.hibernationPath(), m.config.Server.DataDir} {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = f.Sync()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// ErrApplyNotFound is returned when no recorded apply matches a commit
+var ErrApplyNotFound = errors.New("apply not found")
+
+// ApplyRecord is one applied configuration with the actions taken
+type ApplyRecord struct {
+	CommitSHA   string         `json:"commit_sha"`
+	PreviousSHA string         `json:"previous_sha,omitempty"`
+	AppliedAt   time.Time      `json:"applied_at"`
+	Summary     string         `json:"summary"`
+	Actions     []ServerAction `json:"actions"`
+
+	config   *config.RepoConfig
+	previous *config.RepoConfig
+}
+
+// ApplyDiff shows what an apply changed per server and what was done
+type ApplyDiff struct {
+	CommitSHA   string                 `json:"commit_sha"`
+	PreviousSHA string                 `json:"previous_sha,omitempty"`
+	AppliedAt   time.Time              `json:"applied_at"`
+	Changes     *config.RepoConfigDiff `json:"changes"`
+	Actions     []ServerAction         `json:"actions"`
+}
+
+// recordApply adds an apply to the history, dropping the oldest records
+// beyond the configured limit.
+// The caller must hold m.mu.
+func (m *Manager) recordApply(commitSHA, previousSHA string, previous, applied *config.RepoConfig, actions []ServerAction) {
+	m.applies = append(m.applies, ApplyRecord{
+		CommitSHA:   commitSHA,
+		PreviousSHA: previousSHA,
+		AppliedAt:   time.Now(),
+		Summary:     summarizeActions(actions),
+		Actions:     actions,
+		config:      applied,
+		previous:    previous,
+	})
+
+	if excess := len(m.applies) - m.config.Server.ApplyHistory; excess > 0 {
+		m.applies = append([]ApplyRecord(nil), m.applies[excess:]...)
+	}
+}
+
+// updateApplyActions replaces the actions recorded for servers of an apply,
+// e.g. when deferred restarts have been carried out.
+// The caller must hold m.mu.
+func (m *Manager) updateApplyActions(commitSHA string, actions []ServerAction) {
+	for i := len(m.applies) - 1; i >= 0; i-- {
+		record := &m.applies[i]
+		if record.CommitSHA != commitSHA {
+			continue
+		}
+
+		for _, action := range actions {
+			for j := range record.Actions {
+				if record.Actions[j].Name == action.Name {
+					record.Actions[j] = action
+				}
+			}
+		}
+		record.Summary = summarizeActions(record.Actions)
+		return
+	}
+}
+
+// GetApplies returns the recorded applies, most recent first
+func (m *Manager) GetApplies() []ApplyRecord {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	applies := make([]ApplyRecord, 0, len(m.applies))
+	for i := len(m.applies) - 1; i >= 0; i-- {
+		applies = append(applies, m.applies[i])
+	}
+	return applies
+}
+
+// GetApplyDiff compares the configuration applied at a commit with the one
+// it replaced. sha may be abbreviated; the most recent matching apply wins.
+func (m *Manager) GetApplyDiff(sha string) (*ApplyDiff, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if sha == "" {
+		return nil, ErrApplyNotFound
+	}
+
+	for i := len(m.applies) - 1; i >= 0; i-- {
+		record := m.applies[i]
+		if !strings.HasPrefix(record.CommitSHA, sha) {
+			continue
+		}
+
+		return &ApplyDiff{
+			CommitSHA:   record.CommitSHA,
+			PreviousSHA: record.PreviousSHA,
+			AppliedAt:   record.AppliedAt,
+			Changes:     config.DiffRepoConfigs(record.previous, record.config),
+			Actions:     record.Actions,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrApplyNotFound, sha)
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/schedule"
+)
+
+// statusScheduledOff is the status of a configured server stopped outside
+// its operating hours
+const statusScheduledOff = "scheduled-off"
+
+// inOperatingHours reports whether a server should run at now. Servers
+// without operating hours always run.
+func inOperatingHours(serverConfig *config.MinecraftServerConfig, now time.Time) bool {
+	if len(serverConfig.OperatingHours) == 0 {
+		return true
+	}
+	for _, expr := range serverConfig.OperatingHours {
+		// Validated when the configuration was loaded
+		if cron, err := schedule.ParseCron(expr); err == nil && cron.Matches(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOperatingStart returns when the operating hours of a server next
+// begin after now, the zero time when they never do
+func nextOperatingStart(serverConfig *config.MinecraftServerConfig, now time.Time) time.Time {
+	var next time.Time
+	for _, expr := range serverConfig.OperatingHours {
+		cron, err := schedule.ParseCron(expr)
+		if err != nil {
+			continue
+		}
+		if at := cron.Next(now); !at.IsZero() && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// scheduleOff records a configured server as scheduled off instead of
+// starting it.
+// The caller must hold m.mu.
+func (m *Manager) scheduleOff(name string) {
+	if _, exists := m.scheduledOff[name]; exists {
+		return
+	}
+	m.scheduledOff[name] = time.Now()
+	m.events.Publish(events.ServerStatus, name, map[string]interface{}{"status": statusScheduledOff})
+}
+
+// applyOperatingHours stops running servers gracefully once their
+// operating hours end and starts scheduled off servers when they begin.
+// Locked servers are left alone, as are all while the manager is frozen or
+// in safe mode.
+func (m *Manager) applyOperatingHours(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastConfig == nil || m.shutdownStatus != nil || m.paused() {
+		return
+	}
+	for _, name := range m.runningByPriority() {
+		server := m.servers[name]
+		if server.Status != "running" || inOperatingHours(server.Config, now) || m.isLocked(name) {
+			continue
+		}
+		m.logger.Infof("Stopping server %s outside its operating hours", name)
+		m.announce(server, config.AnnounceShutdown, announcement{Reason: "outside operating hours"})
+		if err := m.askToStop(server); err != nil {
+			m.logger.Warn(err)
+		}
+		m.setStatus(server, "stopping")
+		go m.finishScheduledStop(server)
+	}
+
+	for _, i := range priorityOrder(m.lastConfig.Servers) {
+		serverConfig := &m.lastConfig.Servers[i]
+		name := serverConfig.Name
+		if _, off := m.scheduledOff[name]; !off || !inOperatingHours(serverConfig, now) {
+			continue
+		}
+		delete(m.scheduledOff, name)
+		if _, exists := m.servers[name]; exists {
+			continue
+		}
+		m.logger.Infof("Starting server %s, its operating hours began", name)
+		if err := m.startServer(serverConfig); err != nil {
+			m.logger.Errorf("Failed to start server %s for its operating hours: %v", name, err)
+		}
+	}
+}
+
+// finishScheduledStop waits for a server asked to stop by
+// applyOperatingHours to save its world and exit, killing it after the
+// shutdown timeout, and records it as scheduled off unless it was replaced
+// in the meantime
+func (m *Manager) finishScheduledStop(server *MinecraftServer) {
+	name := server.Config.Name
+	select {
+	case <-server.exited:
+	case <-time.After(time.Duration(m.config.Server.ShutdownTimeout) * time.Second):
+		m.logger.Warnf("Server %s did not stop in time, killing it", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.servers[name] != server || m.shutdownStatus != nil {
+		return
+	}
+	m.stopServer(name)
+	m.scheduleOff(name)
+	m.publishStatus()
+}
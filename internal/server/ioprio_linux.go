@@ -0,0 +1,21 @@
+package server
+
+import "syscall"
+
+// I/O scheduling class of ioprio_set(2)
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// setIdleIOPriority puts the calling thread in the idle I/O scheduling
+// class, which only gets disk time no other process wants. The CFQ and BFQ
+// schedulers honor it.
+func setIdleIOPriority() error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(syscall.Gettid()), ioprioClassIdle<<ioprioClassShift)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "errors"
+
+// setIdleIOPriority is only implemented on Linux
+func setIdleIOPriority() error {
+	return errors.New("I/O priorities are not supported on this platform")
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+	"minecraft-server-manager/internal/uptime"
+)
+
+// RestartServer stops and starts a managed server with its current
+// configuration
+func (m *Manager) RestartServer(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkFrozen(); err != nil {
+		return err
+	}
+
+	server, exists := m.servers[name]
+	if !exists {
+		if m.lastConfig.Server(name) != nil {
+			return fmt.Errorf("server %s is not managed in the current configuration", name)
+		}
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+
+	m.logger.Infof("Restarting server %s (requested through the API)", name)
+	m.announce(server, config.AnnounceRestart, announcement{Reason: "requested by an operator"})
+	serverConfig := server.Config
+	m.stopServer(name)
+	if err := m.startServer(serverConfig); err != nil {
+		return fmt.Errorf("failed to restart server %s: %w", name, err)
+	}
+	return nil
+}
+
+// SuspendServer freezes the process of a running server with SIGSTOP,
+// keeping its memory, e.g. to investigate griefing. Players lose their
+// connection once their clients time out.
+func (m *Manager) SuspendServer(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server.Status != "running" {
+		return fmt.Errorf("server %s is %s", name, server.Status)
+	}
+	if err := suspendProcess(server.Process.Process); err != nil {
+		return fmt.Errorf("failed to suspend server %s: %w", name, err)
+	}
+
+	m.logger.Warnf("Suspended server %s (requested through the API)", name)
+	m.recordState(name, uptime.StateDown)
+	m.setStatus(server, "paused")
+	return nil
+}
+
+// ResumeServer continues a server suspended by SuspendServer
+func (m *Manager) ResumeServer(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server.Status != "paused" {
+		return fmt.Errorf("server %s is %s", name, server.Status)
+	}
+	if err := m.continueServer(server); err != nil {
+		return fmt.Errorf("failed to resume server %s: %w", name, err)
+	}
+
+	m.logger.Infof("Resumed server %s (requested through the API)", name)
+	m.recordState(name, uptime.StateUp)
+	m.setStatus(server, "running")
+	return nil
+}
+
+// continueServer sends SIGCONT to a paused server, which must run again
+// before it can act on console commands.
+// The caller must hold m.mu.
+func (m *Manager) continueServer(server *MinecraftServer) error {
+	if server.Process == nil || server.Process.Process == nil {
+		return nil
+	}
+	return continueProcess(server.Process.Process)
+}
+
+// SendCommand writes a command to the console of a running server
+func (m *Manager) SendCommand(name, command string) error {
+	command = strings.TrimSpace(command)
+	if command == "" || strings.ContainsAny(command, "\r\n") {
+		return fmt.Errorf("command must be a single non-empty line")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server.Status != "running" {
+		return fmt.Errorf("server %s is %s", name, server.Status)
+	}
+
+	m.logger.Infof("Sending command to server %s: %s", name, command)
+	return m.sendCommand(server, command)
+}
+
+// serverInfo returns the tenant, labels and annotations of a configured
+// server for notifications
+func (m *Manager) serverInfo(name string) notify.ServerDetails {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	serverConfig := m.findServerConfig(name)
+	if serverConfig == nil {
+		return notify.ServerDetails{}
+	}
+	return notify.ServerDetails{Tenant: serverConfig.Tenant, Labels: serverConfig.Labels, Annotations: serverConfig.Annotations}
+}
+
+// ServerScope returns the group and tenant of a configured server
+func (m *Manager) ServerScope(name string) (group, tenant string, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	serverConfig := m.findServerConfig(name)
+	if serverConfig == nil {
+		return "", "", fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	return serverConfig.Group, serverConfig.Tenant, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+)
+
+// ErrNotLocked is returned when unlocking a server that is not locked
+var ErrNotLocked = errors.New("server is not locked")
+
+// LockedServer is a server whose settings are locked, e.g. for a
+// tournament: until the lock expires or is lifted, applies leave it as it
+// is and it is neither restarted for its maximum uptime, reset on
+// schedule, nor changed by its schedules. Crash restarts still happen.
+type LockedServer struct {
+	Name   string    `json:"name"`
+	Reason string    `json:"reason,omitempty"`
+	By     string    `json:"by,omitempty"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+}
+
+func (m *Manager) lockedPath() string {
+	return filepath.Join(m.config.Server.DataDir, "locked.json")
+}
+
+// loadLocked reads the locks that outlived the previous manager process
+func (m *Manager) loadLocked() error {
+	data, err := os.ReadFile(m.lockedPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	locked := make(map[string]LockedServer)
+	if err := json.Unmarshal(data, &locked); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.lockedPath(), err)
+	}
+	m.mu.Lock()
+	m.locked = locked
+	m.mu.Unlock()
+	return nil
+}
+
+// saveLocked writes the locks of all servers.
+// The caller must hold m.mu.
+func (m *Manager) saveLocked() error {
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m.locked, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.lockedPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.lockedPath())
+}
+
+// isLocked reports whether the settings of a server are locked.
+// The caller must hold m.mu.
+func (m *Manager) isLocked(name string) bool {
+	lock, exists := m.locked[name]
+	return exists && time.Now().Before(lock.Until)
+}
+
+// lockedReason describes the lock of a server for apply actions.
+// The caller must hold m.mu.
+func (m *Manager) lockedReason(name string) string {
+	return fmt.Sprintf("locked until %s", m.locked[name].Until.Format(time.RFC3339))
+}
+
+// LockServer locks the settings of a running server until a time.
+// Locking a locked server again replaces its lock.
+func (m *Manager) LockServer(name, reason, by string, until time.Time) (*LockedServer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.servers[name]; !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	now := time.Now()
+	if !until.After(now) {
+		return nil, fmt.Errorf("lock of server %s must end in the future", name)
+	}
+	lock := LockedServer{Name: name, Reason: reason, By: by, Since: now, Until: until}
+	if previous, exists := m.locked[name]; exists {
+		lock.Since = previous.Since
+	}
+	m.locked[name] = lock
+	if err := m.saveLocked(); err != nil {
+		m.logger.Errorf("Failed to save server locks: %v", err)
+	}
+
+	m.logger.Infof("Locked server %s until %s by %s: %s", name, until.Format(time.RFC3339), by, reason)
+	m.events.Publish(events.ServerLocked, name, map[string]interface{}{"until": until, "reason": reason, "by": by})
+	m.publishStatus()
+	return &lock, nil
+}
+
+// UnlockServer lifts the lock of a server before it expires and applies
+// the configuration that waited for it
+func (m *Manager) UnlockServer(name, by string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.locked[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotLocked, name)
+	}
+	m.unlockServer(name, "lifted by "+by)
+	return nil
+}
+
+// GetLock returns the lock of a server
+func (m *Manager) GetLock(name string) (*LockedServer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lock, exists := m.locked[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNotLocked, name)
+	}
+	return &lock, nil
+}
+
+// expireLocks lifts the locks that have run out
+func (m *Manager) expireLocks(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []string
+	for name, lock := range m.locked {
+		if !now.Before(lock.Until) {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+	for _, name := range expired {
+		m.unlockServer(name, "expired")
+	}
+}
+
+// unlockServer removes the lock of a server and brings the server in line
+// with the applied configuration, unless the manager is frozen: then the
+// next apply does.
+// The caller must hold m.mu.
+func (m *Manager) unlockServer(name, reason string) {
+	delete(m.locked, name)
+	if err := m.saveLocked(); err != nil {
+		m.logger.Errorf("Failed to save server locks: %v", err)
+	}
+	m.logger.Infof("Unlocked server %s (%s)", name, reason)
+	m.events.Publish(events.ServerUnlocked, name, map[string]interface{}{"reason": reason})
+	defer m.publishStatus()
+
+	server, exists := m.servers[name]
+	if !exists || m.lastConfig == nil || m.freeze != nil {
+		return
+	}
+	serverConfig := m.lastConfig.Server(name)
+	switch {
+	case serverConfig == nil:
+		m.logger.Infof("Stopping server %s (no longer in configuration)", name)
+		m.stopServer(name)
+	case server.Config != serverConfig:
+		m.restartServers([]*config.MinecraftServerConfig{serverConfig}, "configuration changed while locked")
+	}
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// channelDownloadTypes are the download types of the channels in Mojang's
+// list of downloads
+var channelDownloadTypes = map[string]string{
+	config.ChannelLatest:  "serverBedrockLinux",
+	config.ChannelPreview: "serverBedrockPreviewLinux",
+}
+
+// channelBuildPattern finds the build in a download URL of a channel
+var channelBuildPattern = regexp.MustCompile(`bedrock-server-(\d+(?:\.\d+)+)\.zip`)
+
+// readLockfile attaches the lockfile of the repository at a commit to its
+// configuration. A missing or invalid lockfile is left out.
+func (m *Manager) readLockfile(repoConfig *config.RepoConfig, commitSHA string) {
+	data, err := m.sources.GetFileAt(m.config.Lockfile.Source, m.config.Lockfile.Path, commitSHA)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err == nil {
+		repoConfig.Lock, err = config.ParseLockfile(data)
+	}
+	if err != nil {
+		m.logger.Warnf("Ignoring lockfile %s: %v", m.config.Lockfile.Path, err)
+	}
+}
+
+// resolveChannels replaces the channels servers use as their version with
+// the current build of the channel, or with the build the repository's
+// lockfile holds for the server when lockfile.frozen is set. Channels
+// that cannot be resolved keep the build the server runs.
+func (m *Manager) resolveChannels(repoConfig *config.RepoConfig) {
+	if !m.config.Server.Versions.Download {
+		return
+	}
+	var builds map[string]string
+	var listErr error
+	for i := range repoConfig.Servers {
+		serverConfig := &repoConfig.Servers[i]
+		channel := serverConfig.Version
+		if _, isChannel := channelDownloadTypes[channel]; !isChannel {
+			continue
+		}
+		serverConfig.Channel = channel
+
+		var locked config.LockedServer
+		if repoConfig.Lock != nil {
+			locked = repoConfig.Lock.Servers[serverConfig.Name]
+		}
+		if m.config.Lockfile.Frozen && locked.Channel == channel && locked.Version != "" {
+			serverConfig.Version = locked.Version
+			continue
+		}
+
+		if builds == nil && listErr == nil {
+			builds, listErr = m.channelBuilds()
+		}
+		if build := builds[channel]; build != "" {
+			serverConfig.Version = build
+			continue
+		}
+
+		// Keep the build the server runs, or the one it was locked to
+		m.mu.RLock()
+		if current := m.lastConfig.Server(serverConfig.Name); current != nil && current.Channel == channel {
+			serverConfig.Version = current.Version
+		}
+		m.mu.RUnlock()
+		if serverConfig.Version == channel && locked.Channel == channel && locked.Version != "" {
+			serverConfig.Version = locked.Version
+		}
+		reason := fmt.Sprintf("%s has no %s build", m.config.Server.Versions.ChannelsURL, channel)
+		if listErr != nil {
+			reason = listErr.Error()
+		}
+		m.logger.Warnf("Failed to resolve channel %s of server %s, keeping %s: %s", channel, serverConfig.Name, serverConfig.Version, reason)
+	}
+}
+
+// channelBuilds lists the current build of every channel from Mojang's
+// list of downloads, remembering where each build is downloaded from
+func (m *Manager) channelBuilds() (map[string]string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(m.config.Server.Versions.ChannelsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, m.config.Server.Versions.ChannelsURL)
+	}
+	var list struct {
+		Result struct {
+			Links []struct {
+				DownloadType string `json:"downloadType"`
+				DownloadURL  string `json:"downloadUrl"`
+			} `json:"links"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid list of downloads: %w", err)
+	}
+
+	builds := make(map[string]string)
+	for channel, downloadType := range channelDownloadTypes {
+		for _, link := range list.Result.Links {
+			match := channelBuildPattern.FindStringSubmatch(link.DownloadURL)
+			if link.DownloadType != downloadType || match == nil {
+				continue
+			}
+			builds[channel] = match[1]
+			m.channelDownloads.Store(match[1], link.DownloadURL)
+		}
+	}
+	return builds, nil
+}
+
+// versionURL is where a Bedrock version is downloaded from: the URL a
+// channel listed for it, or server.versions.url
+func (m *Manager) versionURL(version string) string {
+	if url, listed := m.channelDownloads.Load(version); listed {
+		return url.(string)
+	}
+	return strings.ReplaceAll(m.config.Server.Versions.URL, "{version}", version)
+}
+
+// buildLockfile records what the applied configuration resolved to.
+// The caller must hold m.mu.
+func (m *Manager) buildLockfile(repoConfig *config.RepoConfig) *config.Lockfile {
+	lock := &config.Lockfile{
+		Bedrock:        make(map[string]config.LockedArtifact),
+		Servers:        make(map[string]config.LockedServer),
+		WorldTemplates: make(map[string]config.LockedArtifact),
+	}
+	for _, serverConfig := range repoConfig.Servers {
+		locked := config.LockedServer{
+			Version:       serverConfig.Version,
+			Channel:       serverConfig.Channel,
+			WorldTemplate: serverConfig.WorldTemplate,
+		}
+		packs := serverConfig.Packs()
+		for i := range packs {
+			sources, exists := m.packSources[packSourceKey(serverConfig.Source, packs[i].Path)]
+			if !exists {
+				continue
+			}
+			built, err := buildPack(&packs[i], sources)
+			if err != nil {
+				continue
+			}
+			locked.Packs = append(locked.Packs, config.LockedPack{
+				Path:    packs[i].Path,
+				UUID:    built.ref.PackID,
+				Version: formatVersion(built.ref.Version),
+				SHA256:  config.HashPackFiles(sources),
+			})
+		}
+		lock.Servers[serverConfig.Name] = locked
+
+		if m.config.Server.Versions.Download && serverConfig.Version != "" {
+			installed, err := readInstalledVersion(filepath.Join(m.config.Server.CacheDir, "versions", serverConfig.Version))
+			if err == nil {
+				lock.Bedrock[serverConfig.Version] = config.LockedArtifact{URL: m.versionURL(serverConfig.Version), SHA256: installed.Archive}
+			}
+		}
+		if template, exists := repoConfig.WorldTemplates[serverConfig.WorldTemplate]; exists {
+			lock.WorldTemplates[serverConfig.WorldTemplate] = config.LockedArtifact{URL: template.URL, SHA256: strings.ToLower(template.SHA256)}
+		}
+	}
+	return lock
+}
+
+// writeLockfile stores the lockfile of an apply in data_dir/party.lock
+// and, with lockfile.commit, writes it back to the repository when it
+// differs from the lockfile there
+func (m *Manager) writeLockfile(commitSHA string, lock, previous *config.Lockfile) {
+	data, err := lock.Marshal()
+	if err != nil {
+		m.logger.Errorf("Failed to encode lockfile: %v", err)
+		return
+	}
+	path := filepath.Join(m.config.Server.DataDir, "party.lock")
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		m.logger.Errorf("Failed to write lockfile: %v", err)
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		m.logger.Errorf("Failed to write lockfile: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		m.logger.Errorf("Failed to write lockfile: %v", err)
+		return
+	}
+
+	if !m.config.Lockfile.Commit {
+		return
+	}
+	if previous != nil {
+		if committed, err := previous.Marshal(); err == nil && bytes.Equal(committed, data) {
+			return
+		}
+	}
+	message := fmt.Sprintf("Update %s for commit %s", m.config.Lockfile.Path, commitSHA[:8])
+	change, err := m.sources.WriteFile(m.config.Lockfile.Source, m.config.Lockfile.Path, m.config.GitHub.WriteBack, message, func([]byte) ([]byte, error) {
+		return data, nil
+	})
+	switch {
+	case err != nil:
+		m.logger.Errorf("Failed to write back lockfile: %v", err)
+	case change.PullRequest != "":
+		m.logger.Infof("Opened pull request %s for lockfile %s", change.PullRequest, m.config.Lockfile.Path)
+	case change.Commit != "":
+		m.logger.Infof("Committed lockfile %s as %s", m.config.Lockfile.Path, change.Commit[:8])
+	default:
+		m.logger.Infof("Wrote lockfile %s to source %s", m.config.Lockfile.Path, m.config.Lockfile.Source)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// Lock files written into each server directory while its process runs
+const (
+	pidFileName  = "bedrock_server.pid"
+	portLockName = "port.lock"
+)
+
+// processAlive reports whether pid is a running server process. Where
+// /proc is available it must have been started with -worldsdir, so that a
+// reused pid is not mistaken for a server.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err == nil {
+		return bytes.Contains(cmdline, []byte("\x00-worldsdir\x00"))
+	}
+	if _, statErr := os.Stat("/proc/self"); statErr == nil {
+		return false
+	}
+	return signalPid(pid, 0) == nil
+}
+
+// readLock reads the pid and port of a lock file. Missing or unreadable
+// files are reported as pid 0.
+func readLock(path string) (pid, port int) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) > 0 {
+		pid, _ = strconv.Atoi(fields[0])
+	}
+	if len(fields) > 1 {
+		port, _ = strconv.Atoi(fields[1])
+	}
+	return pid, port
+}
+
+// checkServerLocks refuses to start a server whose world is still run by
+// another process, such as a second manager or a manual start, or whose
+// port is taken: by a live process recorded in another server directory's
+// port lock, or by anything else bound to it.
+func (m *Manager) checkServerLocks(serverConfig *config.MinecraftServerConfig) error {
+	serverDir := m.config.GetServerDir(serverConfig.Name)
+	if pid, _ := readLock(filepath.Join(serverDir, pidFileName)); processAlive(pid) {
+		return fmt.Errorf("server directory is in use by process %d (%s)", pid, filepath.Join(serverDir, pidFileName))
+	}
+
+	port := m.serverPort(serverConfig)
+	locks, _ := filepath.Glob(filepath.Join(m.config.Server.BaseDir, "*", portLockName))
+	for _, lock := range locks {
+		if filepath.Dir(lock) == filepath.Clean(serverDir) {
+			continue
+		}
+		if pid, lockedPort := readLock(lock); lockedPort == port && processAlive(pid) {
+			return fmt.Errorf("port %d is locked by process %d of %s", port, pid, filepath.Base(filepath.Dir(lock)))
+		}
+	}
+
+	conn, err := net.ListenPacket("udp4", ":"+strconv.Itoa(port))
+	if err != nil {
+		return fmt.Errorf("port %d is in use: %w", port, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// writeServerLocks records the process of a server that has just started
+func (m *Manager) writeServerLocks(serverConfig *config.MinecraftServerConfig, pid int) error {
+	serverDir := m.config.GetServerDir(serverConfig.Name)
+	if err := os.WriteFile(filepath.Join(serverDir, pidFileName), []byte(fmt.Sprintf("%d\n", pid)), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(serverDir, portLockName), []byte(fmt.Sprintf("%d %d\n", pid, m.serverPort(serverConfig))), 0644)
+}
+
+// removeServerLocks deletes the lock files of a server whose process
+// exited, unless they already name another process
+func (m *Manager) removeServerLocks(name string, pid int) {
+	serverDir := m.config.GetServerDir(name)
+	for _, lock := range []string{pidFileName, portLockName} {
+		path := filepath.Join(serverDir, lock)
+		if locked, _ := readLock(path); locked != pid {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			m.logger.Warnf("Failed to remove %s: %v", path, err)
+		}
+	}
+}
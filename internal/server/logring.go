@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+)
+
+// defaultLogLines is how many console lines are kept per server when
+// log_lines is not set
+const defaultLogLines = 100
+
+// LogLine is a console line with its sequence number. Sequence numbers
+// start at 1 and are never reused while the server runs.
+type LogLine struct {
+	Seq  uint64 `json:"seq"`
+	Line string `json:"line"`
+}
+
+// LogPage is a read of a server's console log: the lines after the
+// requested sequence number, oldest first. Next is the sequence number to
+// read after next time, that of the last line read; Missed counts the
+// lines that were overwritten before they could be read.
+type LogPage struct {
+	Lines  []LogLine `json:"lines"`
+	Next   uint64    `json:"next"`
+	Missed uint64    `json:"missed,omitempty"`
+}
+
+// logRing keeps the most recent console lines of a server in a fixed-size
+// ring. It has its own lock, held only to append or to take the string
+// headers of a range, so readers neither wait for m.mu nor copy the lines.
+type logRing struct {
+	mu    sync.RWMutex
+	lines []string
+	// next is the sequence number the next line gets
+	next uint64
+}
+
+func newLogRing(size int) *logRing {
+	if size <= 0 {
+		size = defaultLogLines
+	}
+	return &logRing{lines: make([]string, size), next: 1}
+}
+
+// Append adds a line, overwriting the oldest once the ring is full
+func (r *logRing) Append(line string) {
+	r.mu.Lock()
+	r.lines[r.next%uint64(len(r.lines))] = line
+	r.next++
+	r.mu.Unlock()
+}
+
+// oldest returns the sequence number of the oldest line still kept.
+// The caller must hold r.mu.
+func (r *logRing) oldest() uint64 {
+	if r.next <= uint64(len(r.lines)) {
+		return 1
+	}
+	return r.next - uint64(len(r.lines))
+}
+
+// Len returns the number of lines kept
+func (r *logRing) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return int(r.next - r.oldest())
+}
+
+// Since returns up to limit lines after seq, all of them when limit is 0.
+// A seq older than the ring reads from its oldest line and reports the
+// lines it missed. A seq ahead of the ring, e.g. of a server that has been
+// restarted since, returns no lines and a Next below seq.
+func (r *logRing) Since(seq uint64, limit int) LogPage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	from := max(seq+1, r.oldest())
+	if from >= r.next {
+		return LogPage{Next: r.next - 1}
+	}
+	page := LogPage{Missed: from - (seq + 1)}
+	count := r.next - from
+	if limit > 0 && uint64(limit) < count {
+		count = uint64(limit)
+	}
+	page.Lines = make([]LogLine, count)
+	for i := range page.Lines {
+		n := from + uint64(i)
+		page.Lines[i] = LogLine{Seq: n, Line: r.lines[n%uint64(len(r.lines))]}
+	}
+	page.Next = from + count - 1
+	return page
+}
+
+// Last returns up to n of the most recent lines, oldest first
+func (r *logRing) Last(n int) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	from := max(r.oldest(), r.next-min(uint64(max(n, 0)), r.next-1))
+	lines := make([]string, 0, r.next-from)
+	for seq := from; seq < r.next; seq++ {
+		lines = append(lines, r.lines[seq%uint64(len(r.lines))])
+	}
+	return lines
+}
+
+// Lines returns every line kept, oldest first
+func (r *logRing) Lines() []string {
+	return r.Last(len(r.lines))
+}
+
+// ReadLogs returns the console lines of a server after seq, see LogPage
+func (m *Manager) ReadLogs(name string, seq uint64, limit int) (LogPage, error) {
+	m.mu.RLock()
+	server, exists := m.servers[name]
+	m.mu.RUnlock()
+	if !exists {
+		return LogPage{}, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	return server.logs.Since(seq, limit), nil
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+)
+
+// ErrMacroNotFound is returned for macros the applied configuration does
+// not define
+var ErrMacroNotFound = errors.New("macro not found")
+
+// MacroRun is a macro started on a server, with its commands as rendered
+type MacroRun struct {
+	Macro    string   `json:"macro"`
+	Server   string   `json:"server"`
+	Commands []string `json:"commands"`
+	// Duration is how long the steps take with their delays
+	Duration string `json:"duration"`
+}
+
+// RunMacro starts a macro of the applied configuration on a running server.
+// Its commands are rendered and passed to permit, when given, before the
+// first one is sent, so bad arguments and refused commands are reported
+// right away; the steps then run in the background.
+func (m *Manager) RunMacro(name, macroName string, args map[string]string, permit func(command string) error) (*MacroRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server.Status != "running" {
+		return nil, fmt.Errorf("server %s is %s", name, server.Status)
+	}
+	var macro config.Macro
+	if m.lastConfig != nil {
+		macro, exists = m.lastConfig.Macros[macroName]
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrMacroNotFound, macroName)
+	}
+	commands, err := macro.Render(name, args)
+	if err != nil {
+		return nil, fmt.Errorf("macro %s: %w", macroName, err)
+	}
+	if permit != nil {
+		for _, command := range commands {
+			if err := permit(command); err != nil {
+				return nil, fmt.Errorf("macro %s: %w", macroName, err)
+			}
+		}
+	}
+
+	m.logger.Infof("Running macro %s on %s", macroName, name)
+	go m.runMacroSteps(server, macroName, macro.Steps, commands)
+
+	var duration time.Duration
+	for _, step := range macro.Steps {
+		duration += time.Duration(step.DelaySeconds) * time.Second
+	}
+	return &MacroRun{Macro: macroName, Server: name, Commands: commands, Duration: duration.String()}, nil
+}
+
+// startScheduleMacro runs the macro of a schedule that just became active,
+// which includes schedules active when the server starts.
+// The caller must hold m.mu.
+func (m *Manager) startScheduleMacro(server *MinecraftServer, sched config.PropertySchedule) {
+	macro, exists := m.lastConfig.Macros[sched.Macro]
+	if !exists {
+		m.logger.Warnf("Schedule %s of %s refers to unknown macro %s", sched.Name, server.Config.Name, sched.Macro)
+		return
+	}
+	commands, err := macro.Render(server.Config.Name, sched.Args)
+	if err != nil {
+		m.logger.Warnf("Schedule %s of %s cannot run macro %s: %v", sched.Name, server.Config.Name, sched.Macro, err)
+		return
+	}
+	m.logger.Infof("Schedule %s runs macro %s on %s", sched.Name, sched.Macro, server.Config.Name)
+	go m.runMacroSteps(server, sched.Macro, macro.Steps, commands)
+}
+
+// runMacroSteps sends the commands of a macro with the delays of its steps,
+// stopping when the server stops
+func (m *Manager) runMacroSteps(server *MinecraftServer, macroName string, steps []config.MacroStep, commands []string) {
+	name := server.Config.Name
+	m.events.Publish(events.MacroStarted, name, map[string]interface{}{"macro": macroName, "commands": len(commands)})
+
+	var err error
+	for i, step := range steps {
+		if step.DelaySeconds > 0 {
+			select {
+			case <-time.After(time.Duration(step.DelaySeconds) * time.Second):
+			case <-server.exited:
+			}
+		}
+
+		m.mu.RLock()
+		if m.servers[name] != server || server.Status != "running" {
+			err = fmt.Errorf("server %s stopped", name)
+		} else {
+			err = m.sendCommand(server, commands[i])
+		}
+		m.mu.RUnlock()
+		if err != nil {
+			err = fmt.Errorf("step %d of %d: %w", i+1, len(steps), err)
+			break
+		}
+	}
+
+	data := map[string]interface{}{"macro": macroName}
+	if err != nil {
+		m.logger.Warnf("Macro %s on %s did not finish: %v", macroName, name, err)
+		data["error"] = err.Error()
+	} else {
+		m.logger.Infof("Macro %s on %s finished", macroName, name)
+	}
+	m.events.Publish(events.MacroFinished, name, data)
+}
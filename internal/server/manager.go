@@ -5,58 +5,311 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
+	"minecraft-server-manager/internal/audit"
 	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/geoip"
 	"minecraft-server-manager/internal/github"
+	"minecraft-server-manager/internal/hooks"
+	"minecraft-server-manager/internal/mirror"
+	"minecraft-server-manager/internal/notify"
+	"minecraft-server-manager/internal/proxy"
+	"minecraft-server-manager/internal/uptime"
+	"minecraft-server-manager/internal/usage"
 
 	"github.com/sirupsen/logrus"
 )
 
+// ErrServerNotFound is returned when an operation targets a server that is
+// not part of the applied configuration.
+var ErrServerNotFound = errors.New("server not found")
+
 type Manager struct {
 	config        *config.Config
+	sources       *github.Sources
+	notifier      *notify.Notifier
+	events        *events.Bus
 	logger        *logrus.Logger
 	servers       map[string]*MinecraftServer
 	mu            sync.RWMutex
 	lastConfig    *config.RepoConfig
 	lastCommitSHA string
 	bedrockPath   string
+	packSources   map[string]map[string][]byte
+
+	// queue holds the newest fetched configuration until it is applied
+	queue *applyQueue
+
+	// snapshot is the status and metrics served without taking mu
+	snapshot atomic.Pointer[statusSnapshot]
+
+	// downloads holds a lock per cached world template and Bedrock
+	// version, so concurrent downloads of one happen once
+	downloads sync.Map
+
+	// mirror serves downloads when one is configured
+	mirror *mirror.Mirror
+
+	// channelDownloads are the download URLs of the builds channels
+	// resolved to, by version
+	channelDownloads sync.Map
+
+	// configError describes why the last rejected commit failed
+	// validation
+	configError string
+
+	// skipped lists servers left out by the last capacity planning
+	skipped []SkippedServer
+
+	// starts are the start times of each server within the restart window,
+	// quarantined the servers that exceeded their restart budget
+	starts      map[string][]time.Time
+	quarantined map[string]QuarantinedServer
+
+	// pendingBackups are the scheduled backups deferred until few players
+	// are online, by the time they were due
+	pendingBackups map[string]time.Time
+
+	// tenantDisk is the disk usage of each tenant when it was last
+	// measured; tenantOverDisk remembers which tenants were notified about
+	// exceeding their disk quota
+	tenantDisk         map[string]int64
+	tenantDiskMeasured time.Time
+	tenantOverDisk     map[string]bool
+
+	// serverDisk is the size of each server directory when it was last
+	// measured
+	serverDisk map[string]int64
+
+	// trimming holds the servers whose world is being trimmed; they are
+	// not started until the trim is done
+	trimming map[string]bool
+
+	// usage accumulates resource usage for the monthly usage reports
+	usage *usage.Recorder
+
+	// hooks call external systems when servers are created or destroyed
+	hooks *hooks.Runner
+
+	// announcements are the in-game messages by event, nil when disabled
+	announcements map[string]*template.Template
+
+	// orphans are server processes left behind by an earlier manager
+	// process, kept by name for the first apply to adopt
+	orphans map[string]orphan
+
+	// applies is the apply history, oldest first
+	applies []ApplyRecord
+
+	// applyLog records the outcome of every apply, applyOutcomes those of
+	// the longest SLO window, oldest first
+	applyLog      *audit.ApplyLog
+	applyOutcomes []audit.Apply
+
+	// rollout is the most recent staged apply
+	rollout *rollout
+
+	// uptime records server state transitions for availability reports
+	uptime *uptime.Tracker
+
+	// shutdownStatus is set once shutdown has begun; force is closed to
+	// skip the rest of the graceful phase
+	shutdownStatus *ShutdownStatus
+	force          chan struct{}
+	forceOnce      sync.Once
+
+	counters counters
+
+	// logs keeps recent manager log lines for crash reports
+	logs *logBuffer
+
+	// geo resolves client countries in the proxy, nil without a database
+	geo *geoip.DB
+
+	// bans are the banned players per server, players those seen so far
+	// by XUID
+	bans    map[string][]Ban
+	players map[string]*KnownPlayer
+
+	// drift is the report of the last drift check
+	drift *DriftReport
+
+	// freeze is set while the manager is frozen
+	freeze *Freeze
+
+	// locked are the servers whose settings are locked, by name
+	locked map[string]LockedServer
+
+	// worldVersions are the Bedrock versions the worlds were last opened
+	// with, by server; confirmed are the versions confirmed through the
+	// API that the world version guard lets pass once
+	worldVersions map[string]WorldVersion
+	confirmed     map[string]string
+
+	// libraries are the Bedrock binaries whose shared libraries were
+	// found present, by path
+	libraries map[string]bool
+
+	// scheduledOff are the configured servers stopped outside their
+	// operating hours, by the time they were stopped
+	scheduledOff map[string]time.Time
+
+	// offSince is when every server was last found scheduled off, zero
+	// while any is not; hibernating is set once the host was asked to
+	// hibernate for that period
+	offSince    time.Time
+	hibernating bool
+
+	// stale is set while the configuration could not be confirmed current
+	// for staleness.warn_minutes; safeMode while the manager makes no
+	// changes of its own because of it
+	stale    bool
+	safeMode bool
+
+	// stateLoaded is set once persisted state has been read
+	stateLoaded bool
+
+	// lastPoll is when GitHub was last contacted, pollError why that
+	// failed. They have their own lock, so polls go on during applies.
+	pollMu    sync.Mutex
+	lastPoll  time.Time
+	pollError string
+	// polls counts the polls for new commits; lastChecked is when the
+	// manager last had the latest configuration of its sources
+	polls       pollCounters
+	lastChecked time.Time
 }
 
 type MinecraftServer struct {
 	Config    *config.MinecraftServerConfig
 	Process   *exec.Cmd
+	Stdin     io.WriteCloser
 	Status    string
 	StartTime time.Time
 	Port      int
-	Logs      []string
-	MaxLogs   int
+	Players   map[string]string // player name -> XUID
+	NextReset time.Time
+
+	// exited is closed once the process has exited
+	exited chan struct{}
+
+	// logs keeps the recent console output
+	logs *logRing
+
+	// contentLog holds the pack and script problems read from the
+	// content log
+	contentLog contentLog
+
+	// tick estimates tick health from game time probes
+	tick tickProbe
+
+	// proxy forwards the public port to the server when enabled
+	proxy *proxy.Proxy
+
+	// watchers receive console lines of attached consoles
+	watchers map[chan string]struct{}
+
+	// commands serializes commands whose output is captured
+	commands sync.Mutex
+
+	// banPattern is the compiled console ban pattern
+	banPattern *regexp.Regexp
+
+	// settings are the console commands last applied for the difficulty
+	// and game rules, activeSchedules the schedules in effect
+	settings        map[string]string
+	activeSchedules []string
+
+	// oomKills is the OOM kill count of the cgroup when the server started,
+	// crash why it last crashed
+	oomKills int
+	crash    *crash
+
+	// hold is a pending "save hold", standbySynced when the standby world
+	// was last synced; failedOver is set when the server was started on
+	// its standby world after a crash
+	hold          *saveHold
+	standbySynced time.Time
+	failedOver    bool
 }
 
 type ServerStatus struct {
-	Name        string    `json:"name"`
-	Status      string    `json:"status"`
-	Port        int       `json:"port"`
-	StartTime   time.Time `json:"start_time"`
-	Uptime      string    `json:"uptime"`
-	PlayerCount int       `json:"player_count"`
+	Name        string            `json:"name"`
+	Status      string            `json:"status"`
+	Group       string            `json:"group,omitempty"`
+	Tenant      string            `json:"tenant,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Port        int               `json:"port"`
+	Priority    int               `json:"priority"`
+	StartTime   time.Time         `json:"start_time"`
+	Uptime      string            `json:"uptime"`
+	PlayerCount int               `json:"player_count"`
+
+	ActiveSchedules []string `json:"active_schedules,omitempty"`
+
+	// CrashReason is why a crashed server crashed, e.g. out_of_memory
+	CrashReason string `json:"crash_reason,omitempty"`
+
+	// FailedOver is set when the server runs on its standby world after
+	// a crash
+	FailedOver bool `json:"failed_over,omitempty"`
+
+	// NextRestart is the next world reset or maximum uptime restart
+	NextRestart *time.Time `json:"next_restart,omitempty"`
+
+	// NextStart is when the operating hours of a scheduled off server
+	// begin
+	NextStart *time.Time `json:"next_start,omitempty"`
+
+	// LockedUntil is when the lock of a locked server expires
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
+
+	Warnings   []ContentWarning `json:"warnings,omitempty"`
+	TickHealth *TickHealth      `json:"tick_health,omitempty"`
+	Traffic    *proxy.Stats     `json:"traffic,omitempty"`
 }
 
 type ManagerStatus struct {
-	TotalServers int            `json:"total_servers"`
-	Running      int            `json:"running"`
-	Stopped      int            `json:"stopped"`
-	Servers      []ServerStatus `json:"servers"`
-	LastUpdate   time.Time      `json:"last_update"`
-	BedrockPath  string         `json:"bedrock_path"`
+	TotalServers int             `json:"total_servers"`
+	Running      int             `json:"running"`
+	Stopped      int             `json:"stopped"`
+	Servers      []ServerStatus  `json:"servers"`
+	LastUpdate   time.Time       `json:"last_update"`
+	BedrockPath  string          `json:"bedrock_path"`
+	ConfigError  string          `json:"config_error,omitempty"`
+	Skipped      []SkippedServer `json:"skipped,omitempty"`
+	Tenants      []TenantStatus  `json:"tenants,omitempty"`
+	Rollout      *RolloutStatus  `json:"rollout,omitempty"`
+	Shutdown     *ShutdownStatus `json:"shutdown,omitempty"`
+
+	// Quarantined lists servers not started after too many restarts
+	Quarantined []QuarantinedServer `json:"quarantined,omitempty"`
+
+	// Offline is set when the manager runs the offline profile
+	Offline bool `json:"offline,omitempty"`
+
+	// Frozen is set while configuration is not applied and servers are
+	// not restarted
+	Frozen *Freeze `json:"frozen,omitempty"`
+
+	// Stale is set while the configuration could not be confirmed to be
+	// the latest of its sources
+	Stale *Staleness `json:"stale,omitempty"`
 }
 
 type WhitelistEntry struct {
@@ -70,41 +323,165 @@ type PermissionsEntry struct {
 	Permission string `json:"permission"`
 }
 
-func NewManager(cfg *config.Config, logger *logrus.Logger) *Manager {
-	return &Manager{
-		config:  cfg,
-		logger:  logger,
-		servers: make(map[string]*MinecraftServer),
+func NewManager(cfg *config.Config, sources *github.Sources, notifier *notify.Notifier, runner *hooks.Runner, logger *logrus.Logger) *Manager {
+	logs := newLogBuffer(200)
+	logger.AddHook(logs)
+
+	var geo *geoip.DB
+	if cfg.GeoIP.Database != "" {
+		db, err := geoip.Open(cfg.GeoIP.Database)
+		if err != nil {
+			logger.Errorf("Failed to open GeoIP database, country policies are not enforced: %v", err)
+		} else {
+			geo = db
+		}
 	}
+
+	m := &Manager{
+		config:   cfg,
+		sources:  sources,
+		notifier: notifier,
+		logger:   logger,
+		logs:     logs,
+		geo:      geo,
+		servers:  make(map[string]*MinecraftServer),
+		events:   events.NewBus(eventHistory),
+		uptime:   uptime.NewTracker(filepath.Join(cfg.Server.DataDir, "uptime")),
+		force:    make(chan struct{}),
+		queue:    newApplyQueue(),
+		counters: counters{
+			crashes: make(map[string]int),
+		},
+		tenantOverDisk: make(map[string]bool),
+		starts:         make(map[string][]time.Time),
+		quarantined:    make(map[string]QuarantinedServer),
+		locked:         make(map[string]LockedServer),
+		worldVersions:  make(map[string]WorldVersion),
+		libraries:      make(map[string]bool),
+		confirmed:      make(map[string]string),
+		scheduledOff:   make(map[string]time.Time),
+		trimming:       make(map[string]bool),
+		pendingBackups: make(map[string]time.Time),
+		usage:          usage.NewRecorder(filepath.Join(cfg.Server.DataDir, "usage")),
+		hooks:          runner,
+		applyLog:       audit.NewApplyLog(filepath.Join(cfg.Server.DataDir, "applies.jsonl")),
+		announcements:  parseAnnouncements(cfg.Announcements),
+		mirror:         mirror.New(cfg.Mirror),
+	}
+	if cfg.Freeze {
+		m.freeze = &Freeze{Reason: "frozen in the manager configuration", By: "config", Since: time.Now()}
+	}
+	notifier.SetServerInfo(m.serverInfo)
+	m.publishStatus()
+	return m
 }
 
-func (m *Manager) Start(ctx context.Context, githubClient *github.Client) {
+func (m *Manager) Start(ctx context.Context) {
 	m.logger.Info("Starting Minecraft Bedrock server manager")
 
+	// The first commit is fetched, and what its servers need downloaded,
+	// while the server binary is extracted. It is applied once the
+	// applier starts below.
+	pollCtx, stopPolls := context.WithCancel(ctx)
+	defer stopPolls()
+	go m.runPolls(pollCtx)
+
 	// Initialize Bedrock server
 	if err := m.initializeBedrockServer(); err != nil {
 		m.logger.Errorf("Failed to initialize Bedrock server: %v", err)
 		return
 	}
 
-	// Set GitHub client configuration
-	githubClient.SetBranch(m.config.GitHub.Branch)
-	githubClient.SetConfigPath(m.config.GitHub.ConfigPath)
+	m.collectOrphans()
+	if err := m.uptime.Load(); err != nil {
+		m.logger.Errorf("Failed to load uptime history: %v", err)
+	}
+	if err := m.usage.Load(time.Now()); err != nil {
+		m.logger.Errorf("Failed to load usage of this month: %v", err)
+	}
+	if err := m.loadApplyOutcomes(time.Now()); err != nil {
+		m.logger.Errorf("Failed to load apply history for SLOs: %v", err)
+	}
+	if err := m.loadBans(); err != nil {
+		m.logger.Errorf("Failed to load bans: %v", err)
+	}
+	if err := m.loadPlayers(); err != nil {
+		m.logger.Errorf("Failed to load known players: %v", err)
+	}
+	if err := m.loadFreeze(); err != nil {
+		m.logger.Errorf("Failed to load freeze: %v", err)
+	}
+	if err := m.loadLocked(); err != nil {
+		m.logger.Errorf("Failed to load server locks: %v", err)
+	}
+	if err := m.loadWorldVersions(); err != nil {
+		m.logger.Errorf("Failed to load world versions: %v", err)
+	}
+	if err := m.loadHibernation(); err != nil {
+		m.logger.Errorf("Failed to load hibernation: %v", err)
+	}
+	m.mu.Lock()
+	m.stateLoaded = true
+	m.mu.Unlock()
+
+	minuteTicker := time.NewTicker(time.Minute)
+	defer minuteTicker.Stop()
+
+	// A negative GC interval disables periodic garbage collection
+	var gcTick <-chan time.Time
+	if m.config.GC.Interval > 0 {
+		gcTicker := time.NewTicker(time.Duration(m.config.GC.Interval) * time.Hour)
+		defer gcTicker.Stop()
+		gcTick = gcTicker.C
+	}
 
-	ticker := time.NewTicker(time.Duration(m.config.GitHub.PollInterval) * time.Second)
-	defer ticker.Stop()
+	if m.config.Telegram != nil {
+		go m.runTelegramBot(ctx)
+	}
 
-	// Initial configuration load
-	m.pollConfiguration(githubClient)
+	// Polling and applying run apart, so a slow apply neither delays the
+	// next poll nor the minute ticks. The first poll loads the initial
+	// configuration.
+	applier := make(chan struct{})
+	go func() {
+		m.runApplies(ctx)
+		close(applier)
+	}()
+	go m.runStatusSnapshots(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			m.logger.Info("Shutting down server manager")
-			m.stopAllServers()
+			// An apply in progress finishes before servers are stopped
+			<-applier
+			m.shutdown()
 			return
-		case <-ticker.C:
-			m.pollConfiguration(githubClient)
+		case now := <-minuteTicker.C:
+			m.checkScheduledResets(now)
+			m.checkMaxUptime(now)
+			m.uptime.Touch(now)
+			m.pingServerHeartbeats()
+			m.scanContentLogs()
+			m.probeTicks(now)
+			m.applySchedules(now)
+			m.applyOperatingHours(now)
+			m.updateMOTDs(now)
+			m.syncStandbys(now)
+			m.runScheduledBackups(now)
+			if now.Minute()%diskInterval == 0 {
+				m.measureStorage()
+				go m.cleanupOrphans()
+			}
+			m.recordUsage(now)
+			m.checkDriftDue(now)
+			m.expireLocks(now)
+			m.checkStaleness(now)
+			m.checkHibernate(now)
+		case <-gcTick:
+			if _, err := m.CollectGarbage(m.config.GC.DryRun); err != nil {
+				m.logger.Errorf("Garbage collection failed: %v", err)
+			}
 		}
 	}
 }
@@ -390,40 +767,221 @@ func (m *Manager) findBedrockExecutable(dir string) (string, error) {
 	return found, nil
 }
 
-func (m *Manager) pollConfiguration(githubClient *github.Client) {
+// pollConfiguration fetches, verifies and validates the configuration at
+// a new commit and queues it for the applier
+func (m *Manager) pollConfiguration() {
 	// Check if there are any changes
-	commitSHA, err := githubClient.GetLastCommitSHA()
+	started := time.Now()
+	commitSHA, err := m.sources.GetLastCommitSHA()
+	m.countPoll(time.Since(started), err)
 	if err != nil {
 		m.logger.Errorf("Failed to get last commit SHA: %v", err)
+		m.recordPoll(err)
 		return
 	}
 
 	// If no changes, skip
-	if commitSHA == m.lastCommitSHA {
+	if !m.queue.wants(commitSHA) {
+		m.recordPoll(nil)
 		return
 	}
 
-	m.logger.Infof("Configuration changed, updating servers (commit: %s)", commitSHA[:8])
+	m.logger.Infof("Configuration changed, fetching commit %s", commitSHA[:8])
+	timing := applyTiming{started: time.Now(), committed: m.commitTime(commitSHA)}
+
+	// Refuse to act on commits that are not signed by an allowed key
+	if err := m.sources.Verify(commitSHA); err != nil {
+		m.rejectConfiguration(commitSHA, timing, fmt.Errorf("signature verification failed: %w", err))
+		return
+	}
 
-	// Get new configuration
-	repoConfig, err := githubClient.GetConfig()
+	// Get new configuration at the verified commit
+	repoConfig, err := m.sources.GetConfigAt(commitSHA)
 	if err != nil {
 		m.logger.Errorf("Failed to get configuration from GitHub: %v", err)
+		m.recordPoll(err)
 		return
 	}
+	m.recordPoll(nil)
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	// Reject invalid configurations, the running servers keep the last
+	// applied configuration
+	if err := repoConfig.Validate(); err != nil {
+		m.rejectConfiguration(commitSHA, timing, err)
+		return
+	}
+
+	// Resolve the channels servers follow to builds, reproducibly with a
+	// frozen lockfile
+	m.readLockfile(repoConfig, commitSHA)
+	m.resolveChannels(repoConfig)
+
+	// Download what the servers need before the apply, while no lock is
+	// held; on a cold host this keeps the first apply from downloading
+	// templates one server at a time
+	m.prewarmTemplates(repoConfig)
+	m.prewarmVersions(repoConfig)
+	m.queueConfiguration(&fetchedConfig{
+		commitSHA:   commitSHA,
+		repoConfig:  repoConfig,
+		packSources: m.fetchPackSources(repoConfig, commitSHA),
+		timing:      timing,
+	})
+}
+
+// applyConfiguration brings the servers in line with a fetched
+// configuration. Cancelling applyCtx preempts the apply before the next
+// server is started, restarted or stopped; the servers left out keep
+// running as they are for the next apply. A rollout runs with ctx.
+func (m *Manager) applyConfiguration(ctx, applyCtx context.Context, fetched *fetchedConfig) {
+	commitSHA, repoConfig, timing := fetched.commitSHA, fetched.repoConfig, fetched.timing
+	m.logger.Infof("Updating servers (commit: %s)", commitSHA[:8])
+	deployment := m.startDeployment(commitSHA)
+	m.refreshTenantDisk(repoConfig.Servers)
 
-	// Update servers based on new configuration
-	m.updateServers(repoConfig)
+	m.mu.Lock()
+	// Update servers based on new configuration. The new configuration is
+	// stored first so world templates resolve against it.
+	previous, previousSHA := m.lastConfig, m.lastCommitSHA
+	m.cancelRollout()
 	m.lastConfig = repoConfig
+	m.packSources = fetched.packSources
+	actions := m.updateServers(applyCtx, repoConfig)
+	m.releaseOrphans()
+	m.deployAllPacks()
 	m.lastCommitSHA = commitSHA
+	m.configError = ""
+	m.recordApply(commitSHA, previousSHA, previous, repoConfig, actions)
+	lock := m.buildLockfile(repoConfig)
+	m.counters.applies++
+	if len(failedActions(actions)) > 0 {
+		m.counters.applyFailures++
+	}
+
+	// Deferred restarts are carried out by a rollout once the servers
+	// restarted now are ready. The rollout also finishes the deployment.
+	// A preempted apply leaves them to the next apply, like a cancelled
+	// rollout, and records no outcome.
+	preempted := preemption(applyCtx)
+	var wave []string
+	var deferred []*config.MinecraftServerConfig
+	for i, action := range actions {
+		switch {
+		case action.Action == ActionRestarted:
+			wave = append(wave, action.Name)
+		case action.Action == ActionDeferred && preempted != "":
+			actions[i].Action = ActionPreempted
+			actions[i].Reason = preempted
+		case action.Action == ActionDeferred:
+			deferred = append(deferred, repoConfig.Server(action.Name))
+		}
+	}
+	if preempted != "" {
+		m.logger.Infof("Preempted apply of commit %s: %s", commitSHA[:8], preempted)
+	} else if len(deferred) > 0 {
+		m.startRollout(ctx, commitSHA, repoConfig, previous, wave, deferred, deployment, timing)
+		deployment = nil
+	} else {
+		result := audit.ApplySucceeded
+		if len(failedActions(actions)) > 0 {
+			result = audit.ApplyFailed
+		}
+		m.recordApplyOutcome(commitSHA, result, timing, actions, "")
+	}
+	m.publishStatus()
+	m.mu.Unlock()
+
+	m.logger.Infof("Applied configuration at commit %s: %s", commitSHA[:8], summarizeActions(actions))
+	m.writeLockfile(commitSHA, lock, repoConfig.Lock)
+	m.events.Publish(events.ConfigApplied, "", map[string]interface{}{
+		"commit":  commitSHA,
+		"summary": summarizeActions(actions),
+		"actions": actions,
+	})
+
+	state, description := "success", summarizeActions(actions)
+	if failed := failedActions(actions); len(failed) > 0 {
+		state = "failure"
+		m.notifyApplyFailed(commitSHA, failed, time.Since(timing.started))
+	}
+	if preempted != "" {
+		m.finishDeployment(deployment, commitSHA, "inactive", preempted)
+		return
+	}
+	m.finishDeployment(deployment, commitSHA, state, description)
+	m.provisionServers(repoConfig)
+}
+
+// notifyApplyFailed reports the servers an applied configuration failed
+// for
+func (m *Manager) notifyApplyFailed(commitSHA string, failed []ServerAction, duration time.Duration) {
+	details := make([]string, 0, len(failed))
+	for _, action := range failed {
+		details = append(details, fmt.Sprintf("%s: %s", action.Name, action.Error))
+	}
+	m.notifier.Notify(notify.Notification{
+		Event:    config.NotifyConfigFailed,
+		Title:    fmt.Sprintf("Configuration at %s failed for %d servers", commitSHA[:8], len(failed)),
+		Message:  fmt.Sprintf("Applying the configuration at commit %s failed for %s", commitSHA[:8], strings.Join(details, "; ")),
+		Severity: notify.SeverityWarning,
+		Fields: map[string]string{
+			"commit":   commitSHA,
+			"error":    strings.Join(details, "; "),
+			"duration": duration.Round(time.Millisecond).String(),
+		},
+	})
 }
 
-func (m *Manager) updateServers(repoConfig *config.RepoConfig) {
-	// Stop servers that are no longer in configuration
-	for name := range m.servers {
+// rejectConfiguration records a commit that will not be applied. The
+// running servers keep the last applied configuration.
+func (m *Manager) rejectConfiguration(commitSHA string, timing applyTiming, err error) {
+	m.logger.Errorf("Rejecting configuration at commit %s: %v", commitSHA[:8], err)
+
+	m.queue.reject(commitSHA)
+	m.mu.Lock()
+	m.configError = err.Error()
+	m.counters.rejections++
+	m.recordApplyOutcome(commitSHA, audit.ApplyRejected, timing, nil, err.Error())
+	m.publishStatus()
+	m.mu.Unlock()
+	m.events.Publish(events.ConfigFailed, "", map[string]interface{}{"commit": commitSHA, "error": err.Error()})
+	m.notifier.Notify(notify.Notification{
+		Event:    config.NotifyConfigFailed,
+		Title:    fmt.Sprintf("Configuration at %s rejected", commitSHA[:8]),
+		Message:  fmt.Sprintf("The configuration at commit %s was rejected, servers keep the last applied configuration: %v", commitSHA[:8], err),
+		Severity: notify.SeverityWarning,
+		Fields:   map[string]string{"commit": commitSHA, "error": err.Error()},
+	})
+
+	m.finishDeployment(m.startDeployment(commitSHA), commitSHA, "failure", "rejected: "+err.Error())
+}
+
+// updateServers brings the running servers in line with the configuration
+// and reports what was done to each server. Once ctx is cancelled, the
+// servers still to be started, restarted or stopped are preempted.
+// The caller must hold m.mu.
+func (m *Manager) updateServers(ctx context.Context, repoConfig *config.RepoConfig) []ServerAction {
+	var actions []ServerAction
+
+	// Decide which servers fit into the instance limits and resource budget
+	admitted, skipped := m.planCapacity(repoConfig.Servers)
+	m.skipped = skipped
+
+	// Restarts beyond the canary or the first wave wait for a rollout
+	deferred := m.deferredRestarts(repoConfig, admitted)
+
+	// Servers removed or displaced are no longer scheduled off
+	for name := range m.scheduledOff {
+		if !admitted[name] {
+			delete(m.scheduledOff, name)
+		}
+	}
+
+	// Stop servers that are no longer in configuration or were displaced
+	// by servers with a higher priority, lowest priority first
+	running := m.runningByPriority()
+	for i := len(running) - 1; i >= 0; i-- {
+		name := running[i]
 		found := false
 		for _, serverConfig := range repoConfig.Servers {
 			if serverConfig.Name == name {
@@ -431,107 +989,335 @@ func (m *Manager) updateServers(repoConfig *config.RepoConfig) {
 				break
 			}
 		}
-		if !found {
+		if (!found || !admitted[name]) && m.isLocked(name) {
+			// Keeps running until its lock is lifted
+			if !found {
+				actions = append(actions, ServerAction{Name: name, Action: ActionSkipped, Reason: m.lockedReason(name)})
+			}
+		} else if (!found || !admitted[name]) && preemption(ctx) != "" {
+			actions = append(actions, ServerAction{Name: name, Action: ActionPreempted, Reason: preemption(ctx)})
+		} else if !found {
 			m.logger.Infof("Stopping server %s (no longer in configuration)", name)
 			m.stopServer(name)
+			actions = append(actions, ServerAction{Name: name, Action: ActionStopped, Reason: "removed from configuration"})
+		} else if !admitted[name] {
+			m.logger.Infof("Stopping server %s (no longer fits into capacity)", name)
+			m.stopServer(name)
+			actions = append(actions, ServerAction{Name: name, Action: ActionStopped, Reason: "displaced by higher priority servers"})
 		}
 	}
 
-	// Start/update servers from configuration
-	for _, serverConfig := range repoConfig.Servers {
-		if len(m.servers) >= m.config.Server.MaxInstances {
-			m.logger.Warnf("Maximum number of servers reached (%d), skipping %s", m.config.Server.MaxInstances, serverConfig.Name)
+	for _, skippedServer := range skipped {
+		m.logger.Warnf("Skipping server %s (priority %d): %s", skippedServer.Name, skippedServer.Priority, skippedServer.Reason)
+		actions = append(actions, ServerAction{Name: skippedServer.Name, Action: ActionSkipped, Reason: skippedServer.Reason})
+	}
+
+	// Start/update servers from configuration, highest priority first
+	for _, i := range priorityOrder(repoConfig.Servers) {
+		// Servers keep a pointer to their config, so take the address of
+		// the slice element rather than of a loop variable
+		serverConfig := &repoConfig.Servers[i]
+		if !admitted[serverConfig.Name] {
 			continue
 		}
 
+		action := ServerAction{Name: serverConfig.Name}
 		existingServer, exists := m.servers[serverConfig.Name]
 		if exists {
 			// Update existing server if configuration changed
-			if m.serverConfigChanged(existingServer.Config, &serverConfig) {
-				m.logger.Infof("Restarting server %s (configuration changed)", serverConfig.Name)
+			if m.isLocked(serverConfig.Name) {
+				// Keeps its current configuration until its lock is lifted
+				action.Action = ActionSkipped
+				action.Reason = m.lockedReason(serverConfig.Name)
+			} else if deferred[serverConfig.Name] {
+				// Keeps running with its current configuration for now
+				action.Action = ActionDeferred
+				action.Reason = "waiting for rolling restart"
+				if repoConfig.Rollout.Strategy == config.RolloutCanary {
+					action.Reason = fmt.Sprintf("waiting for canary %s", repoConfig.Rollout.Canary)
+				}
+			} else if reasons := m.restartReasons(existingServer.Config, serverConfig); len(reasons) > 0 && preemption(ctx) != "" {
+				action.Action = ActionPreempted
+				action.Reason = preemption(ctx)
+			} else if len(reasons) > 0 && m.versionBlocked(serverConfig, &action) {
+				// Keeps running its current version rather than failing
+				// to start the new one
+			} else if len(reasons) > 0 {
+				m.logger.Infof("Restarting server %s (configuration changed: %s)", serverConfig.Name, strings.Join(reasons, ", "))
+				m.announceRestart(serverConfig.Name, "configuration changed")
 				m.stopServer(serverConfig.Name)
-				m.startServer(&serverConfig)
+				action.Action = ActionRestarted
+				action.Reason = "configuration changed: " + strings.Join(reasons, ", ")
+				if err := m.startServer(serverConfig); err != nil {
+					m.logger.Errorf("Failed to restart server %s: %v", serverConfig.Name, err)
+					action.Error = err.Error()
+				}
+			} else {
+				action.Action = ActionUnchanged
+				applied, err := m.reconfigureServer(existingServer, serverConfig)
+				if len(applied) > 0 {
+					m.logger.Infof("Reconfigured server %s without a restart: %s", serverConfig.Name, strings.Join(applied, ", "))
+					action.Action = ActionReconfigured
+					action.Reason = "applied live: " + strings.Join(applied, ", ")
+				}
+				if err != nil {
+					m.logger.Errorf("Failed to reconfigure server %s: %v", serverConfig.Name, err)
+					action.Error = err.Error()
+				}
 			}
 		} else {
-			// Start new server
-			m.logger.Infof("Starting new server %s", serverConfig.Name)
-			m.startServer(&serverConfig)
+			// Start new server, or take over the process an earlier
+			// manager left running
+			action.Action = ActionStarted
+			if _, quarantined := m.quarantined[serverConfig.Name]; quarantined {
+				action.Action = ActionSkipped
+				action.Reason = "quarantined after too many restarts"
+			} else if preemption(ctx) != "" {
+				action.Action = ActionPreempted
+				action.Reason = preemption(ctx)
+			} else if reason := m.adoptOrphan(serverConfig); reason != "" {
+				action.Reason = reason
+			} else if !inOperatingHours(serverConfig, time.Now()) {
+				action.Action = ActionSkipped
+				action.Reason = "outside operating hours"
+				m.scheduleOff(serverConfig.Name)
+			} else {
+				m.logger.Infof("Starting new server %s", serverConfig.Name)
+				if err := m.startServer(serverConfig); err != nil {
+					m.logger.Errorf("Failed to start server %s: %v", serverConfig.Name, err)
+					action.Error = err.Error()
+				}
+			}
 		}
+		actions = append(actions, action)
 	}
+
+	return actions
 }
 
+// serverConfigChanged reports whether a running server must be restarted
+// to apply its new configuration, see restartReasons
 func (m *Manager) serverConfigChanged(old, new *config.MinecraftServerConfig) bool {
-	// Simple comparison - in a real implementation, you might want more sophisticated diffing
-	return old.Port != new.Port || old.Version != new.Version || old.WorldName != new.WorldName
+	return len(m.restartReasons(old, new)) > 0
 }
 
-func (m *Manager) startServer(serverConfig *config.MinecraftServerConfig) {
+// startServer prepares the server directory and world and starts the
+// server process.
+// The caller must hold m.mu.
+func (m *Manager) startServer(serverConfig *config.MinecraftServerConfig) error {
 	serverDir := m.config.GetServerDir(serverConfig.Name)
+	delete(m.scheduledOff, serverConfig.Name)
 
 	// Create server directory
 	if err := os.MkdirAll(serverDir, 0755); err != nil {
-		m.logger.Errorf("Failed to create server directory for %s: %v", serverConfig.Name, err)
-		return
+		return fmt.Errorf("failed to create server directory: %w", err)
+	}
+
+	// Never run a world twice or start on a port that is taken
+	if err := m.checkServerLocks(serverConfig); err != nil {
+		return err
+	}
+	if m.trimming[serverConfig.Name] {
+		return fmt.Errorf("world of server %s is being trimmed", serverConfig.Name)
+	}
+
+	// Stop restart storms
+	if err := m.useRestartBudget(serverConfig.Name, time.Now()); err != nil {
+		return err
+	}
+
+	// Provision new worlds from their template
+	if serverConfig.WorldTemplate != "" {
+		worldDir := m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName)
+		if _, err := os.Stat(worldDir); os.IsNotExist(err) {
+			if err := m.provisionWorld(serverConfig); err != nil {
+				return fmt.Errorf("failed to provision world: %w", err)
+			}
+		}
+	}
+
+	// Refuse worlds the server would crash on
+	if err := checkWorld(m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName), false); err != nil {
+		return fmt.Errorf("world %s is damaged: %w", serverConfig.WorldName, err)
+	}
+
+	// Never open a world with an older Bedrock, or a newer major one
+	// nobody confirmed
+	if err := m.checkWorldVersion(serverConfig); err != nil {
+		return err
+	}
+
+	// Apply world experiment toggles
+	if err := m.applyExperiments(serverConfig); err != nil {
+		return fmt.Errorf("failed to apply experiments: %w", err)
+	}
+
+	// Deploy behavior packs before the server loads them
+	if _, err := m.deployPacks(serverConfig); err != nil {
+		return fmt.Errorf("failed to deploy packs: %w", err)
 	}
 
 	// Check if Bedrock server executable exists
-	if err := m.checkBedrockServer(serverConfig.Version); err != nil {
-		m.logger.Errorf("Failed to check Bedrock server for %s: %v", serverConfig.Name, err)
-		return
+	bedrockPath, err := m.bedrockBinary(serverConfig.Version)
+	if err != nil {
+		return fmt.Errorf("failed to get Bedrock server: %w", err)
+	}
+	if err := checkBedrockServer(bedrockPath); err != nil {
+		return fmt.Errorf("failed to check Bedrock server: %w", err)
+	}
+	if err := m.checkLibraries(bedrockPath); err != nil {
+		return fmt.Errorf("Bedrock server cannot run on this host: %w", err)
 	}
 
 	// Create server.properties
 	propertiesPath := m.config.GetServerPropertiesPath(serverConfig.Name)
 	if err := m.createServerProperties(serverConfig, propertiesPath); err != nil {
-		m.logger.Errorf("Failed to create server.properties for %s: %v", serverConfig.Name, err)
-		return
+		return fmt.Errorf("failed to create server.properties: %w", err)
 	}
 
 	// Create permissions.json
 	permissionsPath := m.config.GetPermissionsPath(serverConfig.Name)
 	if err := m.createPermissionsFile(serverConfig, permissionsPath); err != nil {
-		m.logger.Errorf("Failed to create permissions.json for %s: %v", serverConfig.Name, err)
-		return
+		return fmt.Errorf("failed to create permissions.json: %w", err)
 	}
 
 	// Create whitelist.json
 	whitelistPath := m.config.GetWhitelistPath(serverConfig.Name)
 	if err := m.createWhitelistFile(serverConfig, whitelistPath); err != nil {
-		m.logger.Errorf("Failed to create whitelist.json for %s: %v", serverConfig.Name, err)
-		return
+		return fmt.Errorf("failed to create whitelist.json: %w", err)
 	}
 
 	// Start the server process
-	cmd := exec.Command(m.bedrockPath,
-		"-port", strconv.Itoa(serverConfig.Port),
-		"-worldsdir", serverDir,
-		"-world", serverConfig.WorldName,
-		"-logpath", filepath.Join(serverDir, "logs"))
+	cmd := exec.Command(bedrockPath, m.serverArgs(serverConfig)...)
 
 	cmd.Dir = serverDir
-	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture output: %w", err)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to open console: %w", err)
+	}
+
+	serverProxy, err := m.startProxy(serverConfig)
+	if err != nil {
+		return err
+	}
+
 	if err := cmd.Start(); err != nil {
-		m.logger.Errorf("Failed to start server %s: %v", serverConfig.Name, err)
-		return
+		if serverProxy != nil {
+			serverProxy.Close()
+		}
+		return fmt.Errorf("failed to start process: %w", err)
+	}
+	if err := m.writeServerLocks(serverConfig, cmd.Process.Pid); err != nil {
+		m.logger.Warnf("Failed to write lock files of server %s: %v", serverConfig.Name, err)
 	}
+	m.recordWorldVersion(serverConfig)
 
 	server := &MinecraftServer{
 		Config:    serverConfig,
 		Process:   cmd,
-		Status:    "starting",
+		Stdin:     stdin,
 		StartTime: time.Now(),
 		Port:      serverConfig.Port,
-		MaxLogs:   100,
+		Players:   make(map[string]string),
+		exited:    make(chan struct{}),
+		logs:      newLogRing(serverConfig.LogLines),
+		proxy:     serverProxy,
 	}
+	server.oomKills, _ = oomKills()
 
 	m.servers[serverConfig.Name] = server
+	m.setStatus(server, "starting")
+	m.scheduleReset(server)
+	m.updateMOTD(server, time.Now())
+
+	go m.readConsole(server, stdout)
 
 	// Monitor the process
-	go m.monitorServer(serverConfig.Name, cmd)
+	go m.monitorServer(server)
 
 	m.logger.Infof("Server %s started on port %d", serverConfig.Name, serverConfig.Port)
+	return nil
+}
+
+// serverArgs returns the command line arguments of a server process
+func (m *Manager) serverArgs(serverConfig *config.MinecraftServerConfig) []string {
+	serverDir := m.config.GetServerDir(serverConfig.Name)
+	return []string{
+		"-port", strconv.Itoa(m.serverPort(serverConfig)),
+		"-worldsdir", serverDir,
+		"-world", serverConfig.WorldName,
+		"-logpath", filepath.Join(serverDir, "logs"),
+	}
+}
+
+// startProxy serves the public port of a server in front of its process
+// when the proxy is enabled, and returns nil otherwise
+func (m *Manager) startProxy(serverConfig *config.MinecraftServerConfig) (*proxy.Proxy, error) {
+	if hasGeoPolicy(serverConfig) && (!m.config.Proxy.Enabled || m.geo == nil) {
+		m.logger.Warnf("Server %s has a country policy, which needs the proxy and a GeoIP database", serverConfig.Name)
+	}
+	if !m.config.Proxy.Enabled {
+		return nil, nil
+	}
+	if m.serverPort(serverConfig) > 65535 {
+		return nil, fmt.Errorf("port %d plus the proxy port offset exceeds 65535", serverConfig.Port)
+	}
+	serverProxy, err := proxy.Listen(serverConfig.Name, serverConfig.Port, m.serverPort(serverConfig), m.proxyOptions(serverConfig), m.logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start proxy: %w", err)
+	}
+	serverProxy.SetPlayers(0, serverConfig.MaxPlayers)
+	return serverProxy, nil
+}
+
+// serverPort is the port the server process listens on, behind the proxy
+// when it is enabled
+func (m *Manager) serverPort(serverConfig *config.MinecraftServerConfig) int {
+	if m.config.Proxy.Enabled {
+		return serverConfig.Port + m.config.Proxy.PortOffset
+	}
+	return serverConfig.Port
+}
+
+// proxyOptions returns the proxy settings for a server
+func (m *Manager) proxyOptions(serverConfig *config.MinecraftServerConfig) proxy.Options {
+	// The blocklist has been validated when the configuration was loaded
+	blocklist, _ := proxy.ParseCIDRs(m.config.Proxy.Blocklist)
+	options := proxy.Options{
+		SessionTimeout:   time.Duration(m.config.Proxy.SessionTimeout) * time.Second,
+		MaxSessions:      m.config.Proxy.MaxSessions,
+		Blocklist:        blocklist,
+		PacketsPerSecond: m.config.Proxy.RateLimit.PacketsPerSecond,
+		Burst:            m.config.Proxy.RateLimit.Burst,
+		MaxSessionsPerIP: m.config.Proxy.RateLimit.MaxSessions,
+		Countries:        countryPolicy(serverConfig),
+		Queue: proxy.QueueOptions{
+			Enabled: m.config.Proxy.Queue.Enabled,
+			Size:    m.config.Proxy.Queue.Size,
+			Hold:    time.Duration(m.config.Proxy.Queue.Hold) * time.Second,
+		},
+	}
+	if m.geo != nil {
+		options.Country = m.geo.Country
+	}
+	return options
+}
+
+func countryPolicy(serverConfig *config.MinecraftServerConfig) proxy.CountryPolicy {
+	return proxy.CountryPolicy{
+		Allow: serverConfig.Geo.AllowCountries,
+		Deny:  serverConfig.Geo.DenyCountries,
+	}
+}
+
+func hasGeoPolicy(serverConfig *config.MinecraftServerConfig) bool {
+	return len(serverConfig.Geo.AllowCountries) > 0 || len(serverConfig.Geo.DenyCountries) > 0
 }
 
 func (m *Manager) stopServer(name string) {
@@ -542,66 +1328,108 @@ func (m *Manager) stopServer(name string) {
 
 	if server.Process != nil && server.Process.Process != nil {
 		server.Process.Process.Kill()
-		server.Process.Wait()
+		<-server.exited
+	}
+	if server.proxy != nil {
+		server.proxy.Close()
 	}
+	m.recordState(name, uptime.StateDown)
+	m.setStatus(server, "stopped")
 
 	delete(m.servers, name)
+	m.publishStatus()
 	m.logger.Infof("Server %s stopped", name)
 }
 
-func (m *Manager) stopAllServers() {
+// monitorServer waits for a server process to exit and records how it
+// ended.
+func (m *Manager) monitorServer(server *MinecraftServer) {
+	err := server.Process.Wait()
+	m.removeServerLocks(server.Config.Name, server.Process.Process.Pid)
+	close(server.exited)
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.detachConsoles(server)
+
+	// The server may have been stopped or replaced in the meantime
+	name := server.Config.Name
+	if m.servers[name] != server {
+		return
+	}
 
-	for name := range m.servers {
-		m.stopServer(name)
+	if err != nil {
+		// Servers that got past their startup bound their port
+		var startup []string
+		if server.Status == "starting" {
+			startup = server.logs.Lines()
+		}
+		crash := classifyCrash(err, startup, server.oomKills)
+		server.crash = &crash
+		m.setStatus(server, "crashed")
+		m.logger.Errorf("Server %s crashed (%s): %v", name, crash.Reason, err)
+		m.recordState(name, uptime.StateCrash)
+		m.counters.crashes[name]++
+		go m.reportCrash(m.captureCrash(server, err))
+		if m.freeze != nil {
+			m.logger.Warnf("Not restarting server %s, the manager is frozen", name)
+		} else if !m.failover(server) {
+			m.scheduleCrashRestart(server)
+		}
+	} else {
+		m.setStatus(server, "stopped")
+		m.logger.Infof("Server %s stopped", name)
+		m.recordState(name, uptime.StateDown)
 	}
 }
 
-func (m *Manager) monitorServer(name string, cmd *exec.Cmd) {
-	err := cmd.Wait()
+// recordState adds a state transition to the uptime history
+func (m *Manager) recordState(name, state string) {
+	if err := m.uptime.Record(name, state, time.Now()); err != nil {
+		m.logger.Errorf("Failed to record uptime of %s: %v", name, err)
+	}
+}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// GetUptime reports the availability of a server over the last 24 hours,
+// 7 days and 30 days
+func (m *Manager) GetUptime(name string) (*uptime.Report, error) {
+	m.mu.RLock()
+	serverConfig := m.findServerConfig(name)
+	m.mu.RUnlock()
 
-	if server, exists := m.servers[name]; exists {
-		if err != nil {
-			server.Status = "crashed"
-			m.logger.Errorf("Server %s crashed: %v", name, err)
-		} else {
-			server.Status = "stopped"
-			m.logger.Infof("Server %s stopped", name)
-		}
+	if serverConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
 	}
+	return m.uptime.Report(name, time.Now()), nil
 }
 
-func (m *Manager) checkBedrockServer(version string) error {
+func checkBedrockServer(bedrockPath string) error {
 	// Check if Bedrock server executable exists
-	if _, err := os.Stat(m.bedrockPath); err != nil {
-		return fmt.Errorf("Bedrock server executable not found at %s", m.bedrockPath)
+	if _, err := os.Stat(bedrockPath); err != nil {
+		return fmt.Errorf("Bedrock server executable not found at %s", bedrockPath)
 	}
 	return nil
 }
 
 func (m *Manager) createServerProperties(serverConfig *config.MinecraftServerConfig, propertiesPath string) error {
+	properties, err := m.serverProperties(serverConfig)
+	if err != nil {
+		return err
+	}
+
+	// Write properties file
+	var content strings.Builder
+	for key, value := range properties {
+		content.WriteString(key + "=" + value + "\n")
+	}
+
+	return os.WriteFile(propertiesPath, []byte(content.String()), 0644)
+}
+
+// serverProperties returns the server.properties of a server
+func (m *Manager) serverProperties(serverConfig *config.MinecraftServerConfig) (map[string]string, error) {
 	properties := map[string]string{
-		"server-port":                              strconv.Itoa(serverConfig.Port),
-		"gamemode":                                 serverConfig.Gamemode,
-		"difficulty":                               serverConfig.Difficulty,
-		"max-players":                              strconv.Itoa(serverConfig.MaxPlayers),
-		"online-mode":                              strconv.FormatBool(serverConfig.OnlineMode),
 		"allow-cheats":                             "false",
-		"server-name":                              serverConfig.Name,
-		"level-name":                               serverConfig.WorldName,
-		"level-seed":                               serverConfig.LevelSeed,
-		"level-type":                               serverConfig.LevelType,
-		"default-player-permission-level":          serverConfig.DefaultPlayerPermissionLevel,
-		"content-log-file-enabled":                 strconv.FormatBool(serverConfig.ContentLogFileEnabled),
-		"enable-scripts":                           strconv.FormatBool(serverConfig.EnableScripts),
-		"enable-command-blocking":                  strconv.FormatBool(serverConfig.EnableCommandBlocking),
-		"max-threads":                              strconv.Itoa(serverConfig.MaxThreads),
-		"player-idle-timeout":                      strconv.Itoa(serverConfig.PlayerIdleTimeout),
-		"max-world-size":                           strconv.Itoa(serverConfig.MaxWorldSize),
 		"server-authoritative-movement":            "server-auth",
 		"player-movement-score-threshold":          "20",
 		"player-movement-distance-threshold":       "0.3",
@@ -609,85 +1437,181 @@ func (m *Manager) createServerProperties(serverConfig *config.MinecraftServerCon
 		"correct-player-movement":                  "true",
 	}
 
+	// Apply the selected preset on top of the defaults
+	if serverConfig.Preset != "" {
+		preset, exists := m.lastConfig.Preset(serverConfig.Preset)
+		if !exists {
+			return nil, fmt.Errorf("unknown properties preset %q", serverConfig.Preset)
+		}
+		for key, value := range preset {
+			properties[key] = value
+		}
+	}
+
+	// Typed fields override the preset when they are set
+	typed := map[string]string{
+		"server-port":                     strconv.Itoa(m.serverPort(serverConfig)),
+		"gamemode":                        serverConfig.Gamemode,
+		"difficulty":                      serverConfig.Difficulty,
+		"max-players":                     strconv.Itoa(serverConfig.MaxPlayers),
+		"server-name":                     m.serverName(serverConfig),
+		"level-name":                      serverConfig.WorldName,
+		"level-seed":                      serverConfig.LevelSeed,
+		"level-type":                      serverConfig.LevelType,
+		"default-player-permission-level": serverConfig.DefaultPlayerPermissionLevel,
+		"max-threads":                     strconv.Itoa(serverConfig.MaxThreads),
+		"player-idle-timeout":             strconv.Itoa(serverConfig.PlayerIdleTimeout),
+		"max-world-size":                  strconv.Itoa(serverConfig.MaxWorldSize),
+	}
+	for key, value := range typed {
+		if _, inPreset := properties[key]; inPreset && (value == "" || value == "0") {
+			continue
+		}
+		properties[key] = value
+	}
+
+	// Booleans cannot be told apart from unset values and are always written
+	properties["online-mode"] = strconv.FormatBool(serverConfig.OnlineMode)
+	properties["content-log-file-enabled"] = strconv.FormatBool(serverConfig.ContentLogFileEnabled)
+	properties["enable-scripts"] = strconv.FormatBool(serverConfig.EnableScripts)
+	properties["enable-command-blocking"] = strconv.FormatBool(serverConfig.EnableCommandBlocking)
+
 	// Add custom properties
 	for key, value := range serverConfig.Properties {
 		properties[key] = value
 	}
 
-	// Write properties file
-	var content strings.Builder
-	for key, value := range properties {
-		content.WriteString(key + "=" + value + "\n")
+	// Without internet access Xbox Live cannot authenticate players
+	if m.config.Offline() {
+		properties["online-mode"] = "false"
 	}
-
-	return os.WriteFile(propertiesPath, []byte(content.String()), 0644)
+	return properties, nil
 }
 
 func (m *Manager) createPermissionsFile(serverConfig *config.MinecraftServerConfig, permissionsPath string) error {
+	data, err := json.MarshalIndent(m.permissionsEntries(serverConfig), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(permissionsPath, data, 0644)
+}
+
+// permissionsEntries returns the permissions.json entries of a server.
+// The caller must hold m.mu.
+func (m *Manager) permissionsEntries(serverConfig *config.MinecraftServerConfig) []PermissionsEntry {
 	var permissions []PermissionsEntry
 
-	// Add operators
+	// Add operators; players seen before get their current name and XUID
 	for _, op := range serverConfig.Ops {
+		name, xuid := m.resolvePlayer(op)
 		permissions = append(permissions, PermissionsEntry{
-			Name:       op,
-			XUID:       "", // XUID would need to be looked up
+			Name:       name,
+			XUID:       xuid,
 			Permission: "operator",
 		})
 	}
 
 	// Add whitelisted players with member permissions
 	for _, player := range serverConfig.Whitelist {
+		name, xuid := m.resolvePlayer(player)
 		permissions = append(permissions, PermissionsEntry{
-			Name:       player,
-			XUID:       "", // XUID would need to be looked up
+			Name:       name,
+			XUID:       xuid,
 			Permission: "member",
 		})
 	}
+	return permissions
+}
 
-	data, err := json.MarshalIndent(permissions, "", "  ")
+func (m *Manager) createWhitelistFile(serverConfig *config.MinecraftServerConfig, whitelistPath string) error {
+	data, err := json.MarshalIndent(m.whitelistEntries(serverConfig), "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(permissionsPath, data, 0644)
+	return os.WriteFile(whitelistPath, data, 0644)
 }
 
-func (m *Manager) createWhitelistFile(serverConfig *config.MinecraftServerConfig, whitelistPath string) error {
+// whitelistEntries returns the whitelist.json entries of a server, leaving
+// out banned players.
+// The caller must hold m.mu.
+func (m *Manager) whitelistEntries(serverConfig *config.MinecraftServerConfig) []WhitelistEntry {
 	var whitelist []WhitelistEntry
 
 	for _, player := range serverConfig.Whitelist {
+		name, xuid := m.resolvePlayer(player)
+		if bannedAs(m.bans[serverConfig.Name], name, xuid) != nil {
+			continue
+		}
 		whitelist = append(whitelist, WhitelistEntry{
-			Name: player,
-			XUID: "", // XUID would need to be looked up
+			Name: name,
+			XUID: xuid,
 		})
 	}
-
-	data, err := json.MarshalIndent(whitelist, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(whitelistPath, data, 0644)
+	return whitelist
 }
 
-func (m *Manager) GetStatus() ManagerStatus {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
+// collectStatus builds the current status.
+// The caller must hold m.mu.
+func (m *Manager) collectStatus() ManagerStatus {
 	status := ManagerStatus{
 		TotalServers: len(m.servers),
 		LastUpdate:   time.Now(),
+		Offline:      m.config.Offline(),
 		BedrockPath:  m.bedrockPath,
+		ConfigError:  m.configError,
+		Skipped:      m.skipped,
+		Tenants:      m.tenantStatuses(),
+		Quarantined:  m.quarantinedServers(),
+		Frozen:       m.freezeStatus(),
+		Stale:        m.stalenessStatus(time.Now()),
+	}
+	if m.rollout != nil {
+		rolloutStatus := m.rollout.status
+		status.Rollout = &rolloutStatus
+	}
+	if m.shutdownStatus != nil {
+		shutdownStatus := *m.shutdownStatus
+		status.Shutdown = &shutdownStatus
 	}
 
-	for name, server := range m.servers {
+	for _, name := range m.runningByPriority() {
+		server := m.servers[name]
 		uptime := time.Since(server.StartTime)
 		serverStatus := ServerStatus{
-			Name:      name,
-			Status:    server.Status,
-			Port:      server.Port,
-			StartTime: server.StartTime,
-			Uptime:    uptime.String(),
+			Name:        name,
+			Status:      server.Status,
+			Group:       server.Config.Group,
+			Tenant:      server.Config.Tenant,
+			Labels:      server.Config.Labels,
+			Annotations: server.Config.Annotations,
+			Port:        server.Port,
+			Priority:    server.Config.Priority,
+			StartTime:   server.StartTime,
+			Uptime:      uptime.String(),
+			PlayerCount: len(server.Players),
+			Warnings:    append([]ContentWarning(nil), server.contentLog.warnings...),
+
+			ActiveSchedules: server.activeSchedules,
+		}
+		if next := nextRestart(server); !next.IsZero() {
+			serverStatus.NextRestart = &next
+		}
+		if server.Status == "crashed" && server.crash != nil {
+			serverStatus.CrashReason = server.crash.Reason
+		}
+		if lock, locked := m.locked[name]; locked {
+			serverStatus.LockedUntil = &lock.Until
+		}
+		serverStatus.FailedOver = server.failedOver
+		if server.tick.health != nil {
+			tickHealth := *server.tick.health
+			serverStatus.TickHealth = &tickHealth
+		}
+		if server.proxy != nil {
+			traffic := server.proxy.Stats()
+			serverStatus.Traffic = &traffic
 		}
 
 		if server.Status == "running" {
@@ -699,5 +1623,31 @@ func (m *Manager) GetStatus() ManagerStatus {
 		status.Servers = append(status.Servers, serverStatus)
 	}
 
+	// Scheduled off servers are listed after the managed ones
+	if m.lastConfig != nil {
+		for _, i := range priorityOrder(m.lastConfig.Servers) {
+			serverConfig := &m.lastConfig.Servers[i]
+			if _, off := m.scheduledOff[serverConfig.Name]; !off {
+				continue
+			}
+			serverStatus := ServerStatus{
+				Name:        serverConfig.Name,
+				Status:      statusScheduledOff,
+				Group:       serverConfig.Group,
+				Tenant:      serverConfig.Tenant,
+				Labels:      serverConfig.Labels,
+				Annotations: serverConfig.Annotations,
+				Port:        serverConfig.Port,
+				Priority:    serverConfig.Priority,
+			}
+			if next := nextOperatingStart(serverConfig, time.Now()); !next.IsZero() {
+				serverStatus.NextStart = &next
+			}
+			status.TotalServers++
+			status.Stopped++
+			status.Servers = append(status.Servers, serverStatus)
+		}
+	}
+
 	return status
 }
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"time"
+
+	"minecraft-server-manager/internal/schedule"
+)
+
+// restartDue returns when a server is to be restarted for its maximum
+// uptime: once it has been up max_uptime_hours, at the start of the next
+// maintenance window. It is zero for servers without a maximum uptime.
+func restartDue(server *MinecraftServer) time.Time {
+	hours := server.Config.MaxUptimeHours
+	if hours == 0 {
+		return time.Time{}
+	}
+	due := server.StartTime.Add(time.Duration(hours) * time.Hour)
+	if server.Config.MaintenanceWindow == "" {
+		return due
+	}
+	// Validated when the configuration was loaded
+	window, err := schedule.ParseCron(server.Config.MaintenanceWindow)
+	if err != nil || window.Matches(due) {
+		return due
+	}
+	return window.Next(due)
+}
+
+// nextRestart returns the earlier of a server's next world reset and its
+// maximum uptime restart, zero when neither is scheduled
+func nextRestart(server *MinecraftServer) time.Time {
+	next := server.NextReset
+	if due := restartDue(server); !due.IsZero() && (next.IsZero() || due.Before(next)) {
+		next = due
+	}
+	return next
+}
+
+// inMaintenanceWindow reports whether a server may be restarted at now
+func inMaintenanceWindow(server *MinecraftServer, now time.Time) bool {
+	if server.Config.MaintenanceWindow == "" {
+		return true
+	}
+	window, err := schedule.ParseCron(server.Config.MaintenanceWindow)
+	return err == nil && window.Matches(now)
+}
+
+// checkMaxUptime restarts the first running server, by priority, that has
+// exceeded its maximum uptime and is inside its maintenance window. One
+// server is restarted per minute so that servers sharing a window do not
+// all go down at once. Nothing is restarted during a rollout or shutdown,
+// or while the manager is frozen or in safe mode.
+func (m *Manager) checkMaxUptime(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.shutdownStatus != nil || m.paused() || (m.rollout != nil && m.rollout.active()) {
+		return
+	}
+	for _, name := range m.runningByPriority() {
+		server := m.servers[name]
+		due := restartDue(server)
+		if server.Status != "running" || due.IsZero() || now.Before(due) || !inMaintenanceWindow(server, now) || m.isLocked(name) {
+			continue
+		}
+
+		uptime := now.Sub(server.StartTime).Round(time.Minute)
+		m.logger.Infof("Restarting server %s after %s of uptime (max_uptime_hours %d)", name, uptime, server.Config.MaxUptimeHours)
+		m.announceRestart(name, "scheduled maintenance")
+		if err := m.askToStop(server); err != nil {
+			m.logger.Warn(err)
+		}
+		m.setStatus(server, "stopping")
+		go m.finishUptimeRestart(server)
+		return
+	}
+}
+
+// finishUptimeRestart waits for a server asked to stop by checkMaxUptime to
+// save its world and exit, killing it after the shutdown timeout, and
+// starts it again unless it was replaced in the meantime
+func (m *Manager) finishUptimeRestart(server *MinecraftServer) {
+	name := server.Config.Name
+	select {
+	case <-server.exited:
+	case <-time.After(time.Duration(m.config.Server.ShutdownTimeout) * time.Second):
+		m.logger.Warnf("Server %s did not stop in time, killing it", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.servers[name] != server || m.shutdownStatus != nil {
+		return
+	}
+	serverConfig := server.Config
+	m.stopServer(name)
+	if m.trimDue(serverConfig, time.Now()) && !m.trimming[name] {
+		if _, err := m.trimUnlocked(serverConfig); err != nil {
+			m.logger.Errorf("Failed to trim world of %s: %v", name, err)
+		}
+		// The configuration may have changed while the world was rewritten
+		_, started := m.servers[name]
+		if serverConfig = m.findServerConfig(name); started || serverConfig == nil || m.shutdownStatus != nil {
+			return
+		}
+	}
+	if err := m.startServer(serverConfig); err != nil {
+		m.logger.Errorf("Failed to restart server %s after its maximum uptime: %v", name, err)
+	}
+}
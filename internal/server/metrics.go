@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/metrics"
+	"minecraft-server-manager/internal/proxy"
+)
+
+// counters are the manager's metric counters, kept for the lifetime of the
+// process
+type counters struct {
+	crashes       map[string]int
+	applies       int
+	applyFailures int
+	rejections    int
+}
+
+// Metrics returns the metric set of the last status snapshot
+func (m *Manager) Metrics() []metrics.Metric {
+	return m.snapshot.Load().metrics
+}
+
+// collectMetrics builds the current metric set.
+// The caller must hold m.mu.
+func (m *Manager) collectMetrics() []metrics.Metric {
+	configured := 0
+	if m.lastConfig != nil {
+		configured = len(m.lastConfig.Servers)
+	}
+	running := 0
+	for _, server := range m.servers {
+		if server.Status == "running" {
+			running++
+		}
+	}
+
+	frozen := 0.0
+	if m.freeze != nil {
+		frozen = 1
+	}
+	safeMode := 0.0
+	if m.safeMode {
+		safeMode = 1
+	}
+
+	samples := []metrics.Metric{
+		{Name: "servers_configured", Help: "Servers in the applied configuration.", Kind: metrics.Gauge, Value: float64(configured)},
+		{Name: "servers_running", Help: "Servers that are running.", Kind: metrics.Gauge, Value: float64(running)},
+		{Name: "servers_stopped", Help: "Managed servers that are not running.", Kind: metrics.Gauge, Value: float64(len(m.servers) - running)},
+		{Name: "servers_skipped", Help: "Servers left out by capacity planning.", Kind: metrics.Gauge, Value: float64(len(m.skipped))},
+		{Name: "servers_quarantined", Help: "Servers not started after exceeding the restart budget.", Kind: metrics.Gauge, Value: float64(len(m.quarantined))},
+		{Name: "manager_frozen", Help: "1 while the manager is frozen and applies no configuration.", Kind: metrics.Gauge, Value: frozen},
+		{Name: "manager_safe_mode", Help: "1 while the configuration is stale and the manager makes no changes of its own.", Kind: metrics.Gauge, Value: safeMode},
+		{Name: "config_applies_total", Help: "Configuration commits applied.", Kind: metrics.Counter, Value: float64(m.counters.applies)},
+		{Name: "config_apply_failures_total", Help: "Applies in which at least one server action failed.", Kind: metrics.Counter, Value: float64(m.counters.applyFailures)},
+		{Name: "config_superseded_total", Help: "Fetched configuration commits replaced or preempted by a newer commit.", Kind: metrics.Counter, Value: float64(m.queue.supersededCount())},
+		{Name: "config_rejections_total", Help: "Configuration commits rejected by validation or signature checks.", Kind: metrics.Counter, Value: float64(m.counters.rejections)},
+	}
+	samples = append(samples, m.applyMetrics()...)
+	samples = append(samples, m.pollMetrics(time.Now())...)
+	samples = append(samples, runtimeMetrics()...)
+	samples = append(samples, m.memoryMetrics()...)
+
+	if free, err := freeSpace(m.config.Server.BaseDir); err == nil {
+		samples = append(samples, metrics.Metric{Name: "disk_free_bytes", Help: "Free disk space available to the server directory.", Kind: metrics.Gauge, Value: float64(free)})
+	}
+
+	for _, tenant := range m.tenantStatuses() {
+		labels := map[string]string{"tenant": tenant.Name}
+		samples = append(samples,
+			metrics.Metric{Name: "tenant_servers_running", Help: "Servers of the tenant that are running.", Kind: metrics.Gauge, Labels: labels, Value: float64(tenant.Running)},
+			metrics.Metric{Name: "tenant_memory_bytes", Help: "Memory reserved by the servers of the tenant.", Kind: metrics.Gauge, Labels: labels, Value: float64(tenant.Memory)},
+			metrics.Metric{Name: "tenant_disk_bytes", Help: "Disk space used by the servers of the tenant when last measured.", Kind: metrics.Gauge, Labels: labels, Value: float64(tenant.Disk)},
+		)
+	}
+
+	now := time.Now()
+	for _, name := range m.runningByPriority() {
+		server := m.servers[name]
+		labels := serverLabels(server.Config)
+
+		up, uptime := 0.0, 0.0
+		if server.Status == "running" {
+			up = 1
+			uptime = now.Sub(server.StartTime).Seconds()
+		}
+		samples = append(samples,
+			metrics.Metric{Name: "server_up", Help: "Whether the server is running.", Kind: metrics.Gauge, Labels: labels, Value: up},
+			metrics.Metric{Name: "server_players", Help: "Players online.", Kind: metrics.Gauge, Labels: labels, Value: float64(len(server.Players))},
+			metrics.Metric{Name: "server_uptime_seconds", Help: "Seconds since the server was started.", Kind: metrics.Gauge, Labels: labels, Value: uptime},
+			metrics.Metric{Name: "server_crashes_total", Help: "Times the server process exited unexpectedly.", Kind: metrics.Counter, Labels: labels, Value: float64(m.counters.crashes[name])},
+		)
+		if server.proxy != nil {
+			traffic := server.proxy.Stats()
+			in := serverLabels(server.Config, "direction", "in")
+			out := serverLabels(server.Config, "direction", "out")
+			samples = append(samples,
+				metrics.Metric{Name: "server_network_bytes_total", Help: "Bytes relayed by the proxy.", Kind: metrics.Counter, Labels: in, Value: float64(traffic.BytesIn)},
+				metrics.Metric{Name: "server_network_bytes_total", Help: "Bytes relayed by the proxy.", Kind: metrics.Counter, Labels: out, Value: float64(traffic.BytesOut)},
+				metrics.Metric{Name: "server_network_packets_total", Help: "Packets relayed by the proxy.", Kind: metrics.Counter, Labels: in, Value: float64(traffic.PacketsIn)},
+				metrics.Metric{Name: "server_network_packets_total", Help: "Packets relayed by the proxy.", Kind: metrics.Counter, Labels: out, Value: float64(traffic.PacketsOut)},
+				metrics.Metric{Name: "server_network_sessions", Help: "Client sessions open in the proxy.", Kind: metrics.Gauge, Labels: labels, Value: float64(traffic.Sessions)},
+				metrics.Metric{Name: "server_queue_length", Help: "Players waiting in the join queue.", Kind: metrics.Gauge, Labels: labels, Value: float64(traffic.Queued)},
+				metrics.Metric{Name: "server_queue_admitted_total", Help: "Joins let through by the join queue.", Kind: metrics.Counter, Labels: labels, Value: float64(traffic.QueueAdmitted)},
+			)
+			dropped := []struct {
+				reason string
+				count  uint64
+			}{
+				{"blocked", traffic.DroppedBlocked},
+				{"rate_limited", traffic.DroppedRateLimited},
+				{"sessions", traffic.DroppedSessions},
+				{"geo", traffic.DroppedGeo},
+				{"queue_full", traffic.DroppedQueueFull},
+			}
+			for _, d := range dropped {
+				samples = append(samples, metrics.Metric{Name: "server_network_dropped_total", Help: "Packets dropped by the proxy.", Kind: metrics.Counter, Labels: serverLabels(server.Config, "reason", d.reason), Value: float64(d.count)})
+			}
+		}
+		if health := server.tick.health; health != nil && server.Status == "running" {
+			degraded := 0.0
+			if health.Degraded {
+				degraded = 1
+			}
+			samples = append(samples,
+				metrics.Metric{Name: "server_tps", Help: "Estimated ticks per second.", Kind: metrics.Gauge, Labels: labels, Value: health.TPS},
+				metrics.Metric{Name: "server_console_latency_seconds", Help: "Console round trip of the last tick probe.", Kind: metrics.Gauge, Labels: labels, Value: health.latency.Seconds()},
+				metrics.Metric{Name: "server_tick_degraded", Help: "Whether the server is falling behind its tick rate.", Kind: metrics.Gauge, Labels: labels, Value: degraded},
+			)
+		}
+	}
+
+	return samples
+}
+
+// serverLabels returns the metric labels of a server: its name, its tenant,
+// its configured labels prefixed with label_, and the given key/value pairs
+func serverLabels(serverConfig *config.MinecraftServerConfig, pairs ...string) map[string]string {
+	labels := map[string]string{"server": serverConfig.Name}
+	if serverConfig.Tenant != "" {
+		labels["tenant"] = serverConfig.Tenant
+	}
+	for key, value := range serverConfig.Labels {
+		labels["label_"+key] = value
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels[pairs[i]] = pairs[i+1]
+	}
+	return labels
+}
+
+// GetTraffic returns the proxy traffic of a server, including the countries
+// of connected clients
+func (m *Manager) GetTraffic(name string) (*proxy.Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	server, exists := m.servers[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server.proxy == nil {
+		return nil, fmt.Errorf("server %s is not behind the proxy", name)
+	}
+	stats := server.proxy.Stats()
+	return &stats, nil
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/nbt"
+)
+
+// MigrationResult reports a world migration between two servers. Backup is
+// the backup of the source world that was migrated, TargetBackup the backup
+// of the world it replaced. Differences lists the settings of the two
+// servers that change how the world plays.
+type MigrationResult struct {
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Backup       string   `json:"backup"`
+	TargetBackup string   `json:"target_backup,omitempty"`
+	Differences  []string `json:"differences,omitempty"`
+}
+
+// MigrateWorld moves the world of one server to another: the source world
+// is backed up and restored as the world of the target, which keeps its
+// own port and properties. The target's world is backed up first.
+func (m *Manager) MigrateWorld(from, to string) (*MigrationResult, error) {
+	if from == to {
+		return nil, fmt.Errorf("cannot migrate the world of %s to itself", from)
+	}
+	m.mu.RLock()
+	source := m.findServerConfig(from)
+	target := m.findServerConfig(to)
+	m.mu.RUnlock()
+	if source == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, from)
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, to)
+	}
+
+	result := &MigrationResult{From: from, To: to, Differences: worldSettingDifferences(source, target)}
+	if _, err := os.Stat(m.config.GetWorldDir(to, target.WorldName)); err == nil {
+		targetBackup, err := m.CreateBackup(to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up world of %s: %w", to, err)
+		}
+		result.TargetBackup = targetBackup.ID
+	}
+	backup, err := m.CreateBackup(from)
+	if err != nil {
+		return nil, err
+	}
+	result.Backup = backup.ID
+
+	// The world takes the name of the target's world
+	err = m.restoreWorld(target, backup, func(worldDir string) error {
+		return renameLevel(worldDir, target.WorldName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m.logger.Infof("Migrated world of %s to %s (backup %s)", from, to, backup.ID)
+	for _, difference := range result.Differences {
+		m.logger.Warnf("Migrated world of %s to %s with a different %s", from, to, difference)
+	}
+	m.events.Publish(events.WorldMigrated, to, map[string]interface{}{"from": from, "backup": backup.ID})
+	return result, nil
+}
+
+// renameLevel sets the level name in the level.dat of a world
+func renameLevel(worldDir, name string) error {
+	levelPath := filepath.Join(worldDir, "level.dat")
+	level, err := nbt.ReadLevelDat(levelPath)
+	if err != nil {
+		return err
+	}
+	level.Root.Set("LevelName", nbt.TagString, name)
+	return nbt.WriteLevelDat(levelPath, level)
+}
+
+// worldSettingDifferences lists the settings two servers differ in that
+// change how a world plays on them, such as its game mode or experiments
+func worldSettingDifferences(source, target *config.MinecraftServerConfig) []string {
+	var differences []string
+	compare := func(setting string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			differences = append(differences, fmt.Sprintf("%s: %v -> %v", setting, a, b))
+		}
+	}
+	compare("version", source.Version, target.Version)
+	compare("gamemode", source.Gamemode, target.Gamemode)
+	compare("difficulty", source.Difficulty, target.Difficulty)
+	compare("level_type", source.LevelType, target.LevelType)
+	if !reflect.DeepEqual(source.Experiments, target.Experiments) {
+		differences = append(differences, "experiments")
+	}
+	if !reflect.DeepEqual(source.ScriptPack, target.ScriptPack) || !reflect.DeepEqual(source.BehaviorPacks, target.BehaviorPacks) {
+		differences = append(differences, "behavior packs")
+	}
+	return differences
+}
+
+// WorldExport is a consistent copy of the world of a server, taken by
+// ExportWorld. It must be closed to remove the copy.
+type WorldExport struct {
+	World string
+	dir   string
+}
+
+// WriteArchive writes the world as a .mcworld archive
+func (e *WorldExport) WriteArchive(w io.Writer) error {
+	return writeZip(filepath.Join(e.dir, e.World), w)
+}
+
+// Close removes the copy of the world
+func (e *WorldExport) Close() error {
+	return os.RemoveAll(e.dir)
+}
+
+// ExportWorld copies the world of a server for download. The world of a
+// running server is copied while its saving is on hold.
+func (m *Manager) ExportWorld(name string) (*WorldExport, error) {
+	m.mu.RLock()
+	serverConfig := m.findServerConfig(name)
+	server := m.servers[name]
+	m.mu.RUnlock()
+	if serverConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+
+	dir, err := os.MkdirTemp("", "world-export-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	export := &WorldExport{World: serverConfig.WorldName, dir: dir}
+	worldsDir := filepath.Join(m.config.GetServerDir(name), "worlds")
+
+	var files map[string]int64
+	if server != nil && server.Stdin != nil {
+		files, err = m.holdSaves(server)
+		if err == nil {
+			err = m.backupIO(func() error {
+				return copyHeldFiles(worldsDir, files, dir, m.backupRateLimiter())
+			})
+			m.resumeSaves(server)
+		}
+	} else {
+		files, err = worldFiles(worldsDir, serverConfig.WorldName)
+		if err == nil {
+			err = copyHeldFiles(worldsDir, files, dir, nil)
+		}
+	}
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("server %s has no world to export yet", name)
+	}
+	if err != nil {
+		export.Close()
+		return nil, fmt.Errorf("failed to export world of %s: %w", name, err)
+	}
+	return export, nil
+}
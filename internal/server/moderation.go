@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrPlayerNotOnline is returned for moderation actions on players that are
+// not on the server
+var ErrPlayerNotOnline = errors.New("player is not online")
+
+var (
+	// Gamertags are letters, digits and spaces; quotes would end the
+	// quoted target
+	playerNamePattern = regexp.MustCompile(`^[A-Za-z0-9 _-]{1,32}$`)
+	itemPattern       = regexp.MustCompile(`^[a-z0-9_.]+(:[a-z0-9_.]+)?$`)
+)
+
+// Values accepted by the moderation actions
+var (
+	Gamemodes  = []string{"survival", "creative", "adventure", "spectator"}
+	Weathers   = []string{"clear", "rain", "thunder"}
+	TimesOfDay = []string{"day", "night", "noon", "midnight", "sunrise", "sunset"}
+)
+
+// maxGiveSize is the largest amount give accepts
+const maxGiveSize = 32767
+
+// Position is a block position in the world
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+	Z float64 `json:"z"`
+}
+
+// playerTarget quotes a player name for a command, names with spaces need
+// the quotes
+func playerTarget(player string) (string, error) {
+	if !playerNamePattern.MatchString(player) {
+		return "", fmt.Errorf("invalid player name %q", player)
+	}
+	return strconv.Quote(player), nil
+}
+
+// TeleportCommand teleports a player to a position or, when to is set, to
+// another player
+func TeleportCommand(player, to string, position *Position) (string, error) {
+	target, err := playerTarget(player)
+	if err != nil {
+		return "", err
+	}
+	if to != "" {
+		destination, err := playerTarget(to)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("tp %s %s", target, destination), nil
+	}
+	if position == nil {
+		return "", fmt.Errorf("a position or a player to teleport to is required")
+	}
+	return fmt.Sprintf("tp %s %s %s %s", target, formatCoordinate(position.X), formatCoordinate(position.Y), formatCoordinate(position.Z)), nil
+}
+
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// GamemodeCommand changes the game mode of a player
+func GamemodeCommand(player, gamemode string) (string, error) {
+	target, err := playerTarget(player)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(Gamemodes, gamemode) {
+		return "", fmt.Errorf("invalid gamemode %q (must be one of %s)", gamemode, strings.Join(Gamemodes, ", "))
+	}
+	return fmt.Sprintf("gamemode %s %s", gamemode, target), nil
+}
+
+// ClearCommand clears the inventory of a player, only the given item when
+// item is set
+func ClearCommand(player, item string) (string, error) {
+	target, err := playerTarget(player)
+	if err != nil {
+		return "", err
+	}
+	if item == "" {
+		return "clear " + target, nil
+	}
+	if !itemPattern.MatchString(item) {
+		return "", fmt.Errorf("invalid item %q", item)
+	}
+	return fmt.Sprintf("clear %s %s", target, item), nil
+}
+
+// GiveCommand gives a player amount of an item
+func GiveCommand(player, item string, amount int) (string, error) {
+	target, err := playerTarget(player)
+	if err != nil {
+		return "", err
+	}
+	if !itemPattern.MatchString(item) {
+		return "", fmt.Errorf("invalid item %q", item)
+	}
+	if amount < 1 || amount > maxGiveSize {
+		return "", fmt.Errorf("amount must be between 1 and %d", maxGiveSize)
+	}
+	return fmt.Sprintf("give %s %s %d", target, item, amount), nil
+}
+
+// WeatherCommand sets the weather
+func WeatherCommand(weather string) (string, error) {
+	if !slices.Contains(Weathers, weather) {
+		return "", fmt.Errorf("invalid weather %q (must be one of %s)", weather, strings.Join(Weathers, ", "))
+	}
+	return "weather " + weather, nil
+}
+
+// TimeCommand sets the time of day, by name or in ticks
+func TimeCommand(time string) (string, error) {
+	if ticks, err := strconv.Atoi(time); err == nil && ticks >= 0 {
+		return fmt.Sprintf("time set %d", ticks), nil
+	}
+	if !slices.Contains(TimesOfDay, time) {
+		return "", fmt.Errorf("invalid time %q (must be a tick count or one of %s)", time, strings.Join(TimesOfDay, ", "))
+	}
+	return "time set " + time, nil
+}
+
+// Moderate runs a moderation command built by one of the functions above
+// on a running server and returns its output. With player set, the player
+// must be online.
+func (m *Manager) Moderate(ctx context.Context, name, player, command string) (*CommandResult, error) {
+	if player != "" {
+		m.mu.RLock()
+		server, exists := m.servers[name]
+		online := false
+		if exists {
+			_, online = server.Players[player]
+		}
+		m.mu.RUnlock()
+		if !exists {
+			return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+		}
+		if !online {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotOnline, player)
+		}
+	}
+	return m.RunCommand(ctx, name, command, CommandOptions{})
+}
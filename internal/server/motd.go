@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// motdValues returns the values of the MOTD variables of a server at now.
+// Without a configured version, {version} is left for the proxy to fill
+// in from the server's own ping response.
+func motdValues(serverConfig *config.MinecraftServerConfig, server *MinecraftServer, now time.Time) map[string]string {
+	values := map[string]string{
+		"name":         serverConfig.Name,
+		"players":      "0",
+		"max_players":  strconv.Itoa(serverConfig.MaxPlayers),
+		"version":      serverConfig.Version,
+		"uptime":       shortDuration(0),
+		"next_restart": "-",
+	}
+	if values["version"] == "" {
+		values["version"] = "{version}"
+	}
+	if server == nil {
+		return values
+	}
+	values["players"] = strconv.Itoa(len(server.Players))
+	if server.Status == "running" {
+		values["uptime"] = shortDuration(now.Sub(server.StartTime))
+	}
+	if next := nextRestart(server); !next.IsZero() {
+		values["next_restart"] = shortDuration(next.Sub(now))
+	}
+	return values
+}
+
+// renderMOTD fills the {variables} of a MOTD template
+func renderMOTD(template string, values map[string]string) string {
+	pairs := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// shortDuration formats a duration for the server list, e.g. 45m, 3h05m or
+// 2d4h
+func shortDuration(d time.Duration) string {
+	minutes := max(int(d.Minutes()), 0)
+	switch {
+	case minutes < 60:
+		return fmt.Sprintf("%dm", minutes)
+	case minutes < 24*60:
+		return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+	default:
+		return fmt.Sprintf("%dd%dh", minutes/(24*60), minutes%(24*60)/60)
+	}
+}
+
+// updateMOTD renders the MOTD of a server into the ping responses of its
+// proxy.
+// The caller must hold m.mu.
+func (m *Manager) updateMOTD(server *MinecraftServer, now time.Time) {
+	if server.proxy == nil {
+		return
+	}
+	motd := ""
+	if server.Config.Motd != "" {
+		motd = renderMOTD(server.Config.Motd, motdValues(server.Config, server, now))
+	}
+	server.proxy.SetMOTD(motd)
+}
+
+// updateMOTDs refreshes the MOTD of every server, so that uptime and the
+// time to the next restart stay current
+func (m *Manager) updateMOTDs(now time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, server := range m.servers {
+		m.updateMOTD(server, now)
+	}
+}
+
+// serverName is the server-name property: the MOTD rendered for a server
+// that has just started, or the server's name without a MOTD
+func (m *Manager) serverName(serverConfig *config.MinecraftServerConfig) string {
+	if serverConfig.Motd == "" {
+		return serverConfig.Name
+	}
+	return strings.ReplaceAll(renderMOTD(serverConfig.Motd, motdValues(serverConfig, nil, time.Now())), "{version}", "")
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/uptime"
+)
+
+// orphanPollInterval is how often an adopted process is checked for having
+// exited
+const orphanPollInterval = 5 * time.Second
+
+// orphan is a server process in a managed directory that the manager did
+// not start, typically left behind when an earlier manager process died
+type orphan struct {
+	pid     int
+	name    string
+	port    int
+	world   string
+	started time.Time
+	cmdline []byte
+}
+
+// findOrphans lists the processes started with -worldsdir in a server
+// directory under base_dir that are not managed servers. It reads /proc
+// and finds nothing on other systems.
+func (m *Manager) findOrphans() ([]orphan, error) {
+	baseDir, err := filepath.Abs(m.config.Server.BaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	known := m.knownPIDs()
+	m.mu.RUnlock()
+
+	entries, err := os.ReadDir("/proc")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []orphan
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() || known[pid] {
+			continue
+		}
+		o, ok := readOrphan(pid)
+		if !ok {
+			continue
+		}
+		// Processes vanish while /proc is read, and other users'
+		// processes cannot be inspected; both are skipped
+		cwd, err := os.Readlink(filepath.Join("/proc", entry.Name(), "cwd"))
+		if err != nil || filepath.Dir(cwd) != baseDir {
+			continue
+		}
+		o.name = filepath.Base(cwd)
+		orphans = append(orphans, o)
+	}
+	return orphans, nil
+}
+
+// knownPIDs returns the processes of managed servers and of orphans kept
+// for adoption.
+// The caller must hold m.mu.
+func (m *Manager) knownPIDs() map[int]bool {
+	known := make(map[int]bool, len(m.servers)+len(m.orphans))
+	for _, server := range m.servers {
+		if server.Process != nil && server.Process.Process != nil {
+			known[server.Process.Process.Pid] = true
+		}
+	}
+	for _, o := range m.orphans {
+		known[o.pid] = true
+	}
+	return known
+}
+
+// readOrphan reads the command line of a process and reports whether it
+// looks like a server started by the manager
+func readOrphan(pid int) (orphan, bool) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline"))
+	if err != nil {
+		return orphan{}, false
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return orphan{}, false
+	}
+
+	o := orphan{pid: pid, started: info.ModTime(), cmdline: cmdline}
+	args := bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0})
+	worldsDir := false
+	for i := 1; i+1 < len(args); i++ {
+		switch string(args[i]) {
+		case "-port":
+			o.port, _ = strconv.Atoi(string(args[i+1]))
+		case "-world":
+			o.world = string(args[i+1])
+		case "-worldsdir":
+			worldsDir = true
+		}
+	}
+	return o, worldsDir && o.port != 0
+}
+
+// alive reports whether the process of an orphan is still the same process
+func (o orphan) alive() bool {
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(o.pid), "cmdline"))
+	return err == nil && bytes.Equal(cmdline, o.cmdline)
+}
+
+// collectOrphans handles the orphans found when the manager starts: they
+// are terminated, ignored or kept for the first apply to adopt
+func (m *Manager) collectOrphans() {
+	orphans, err := m.findOrphans()
+	if err != nil {
+		m.logger.Errorf("Failed to look for orphaned server processes: %v", err)
+		return
+	}
+
+	for _, o := range orphans {
+		switch m.config.Server.Orphans {
+		case config.OrphansAdopt:
+			m.logger.Infof("Found orphaned process %d of server %s on port %d, adopting it if the configuration matches", o.pid, o.name, o.port)
+			m.mu.Lock()
+			if m.orphans == nil {
+				m.orphans = make(map[string]orphan)
+			}
+			m.orphans[o.name] = o
+			m.mu.Unlock()
+		case config.OrphansIgnore:
+			m.logger.Warnf("Ignoring orphaned process %d of server %s on port %d", o.pid, o.name, o.port)
+		default:
+			m.terminateOrphan(o)
+		}
+	}
+}
+
+// cleanupOrphans terminates the orphans found while the manager runs,
+// unless they are ignored. Adoption only happens on startup.
+func (m *Manager) cleanupOrphans() {
+	if m.config.Server.Orphans == config.OrphansIgnore {
+		return
+	}
+	orphans, err := m.findOrphans()
+	if err != nil {
+		m.logger.Errorf("Failed to look for orphaned server processes: %v", err)
+		return
+	}
+
+	// A server may have been started since the scan
+	m.mu.RLock()
+	known := m.knownPIDs()
+	m.mu.RUnlock()
+	for _, o := range orphans {
+		if !known[o.pid] {
+			m.terminateOrphan(o)
+		}
+	}
+}
+
+// adoptOrphan takes over the orphaned process of a server about to be
+// started when it runs the server's port and world. A mismatching orphan is
+// terminated in the background and the server started once it is gone. It
+// returns what was done, empty when the server has no orphan to start
+// normally.
+// The caller must hold m.mu.
+func (m *Manager) adoptOrphan(serverConfig *config.MinecraftServerConfig) string {
+	o, exists := m.orphans[serverConfig.Name]
+	if !exists {
+		return ""
+	}
+	delete(m.orphans, serverConfig.Name)
+
+	if o.port != m.serverPort(serverConfig) || o.world != serverConfig.WorldName || !o.alive() {
+		m.logger.Infof("Orphaned process %d of server %s does not match its configuration", o.pid, o.name)
+		go m.replaceOrphan(o, serverConfig)
+		return "starting once its orphaned process exited"
+	}
+
+	serverProxy, err := m.startProxy(serverConfig)
+	if err != nil {
+		m.logger.Errorf("Failed to adopt orphaned process %d of server %s: %v", o.pid, o.name, err)
+		go m.replaceOrphan(o, serverConfig)
+		return "starting once its orphaned process exited"
+	}
+	process, _ := os.FindProcess(o.pid)
+	server := &MinecraftServer{
+		Config:    serverConfig,
+		Process:   &exec.Cmd{Process: process},
+		StartTime: o.started,
+		Port:      serverConfig.Port,
+		Players:   make(map[string]string),
+		exited:    make(chan struct{}),
+		logs:      newLogRing(serverConfig.LogLines),
+		proxy:     serverProxy,
+	}
+
+	m.servers[serverConfig.Name] = server
+	m.setStatus(server, "running")
+	m.recordState(serverConfig.Name, uptime.StateUp)
+	m.scheduleReset(server)
+	m.updateMOTD(server, time.Now())
+	go m.watchAdopted(server, o)
+
+	m.logger.Infof("Adopted orphaned process %d of server %s, it has no console until it is restarted", o.pid, o.name)
+	return "adopted orphaned process"
+}
+
+// replaceOrphan terminates an orphan that cannot be adopted and starts its
+// server in its place, unless the server was started or changed meanwhile.
+// It waits for the orphan without holding m.mu.
+func (m *Manager) replaceOrphan(o orphan, serverConfig *config.MinecraftServerConfig) {
+	m.terminateOrphan(o)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := serverConfig.Name
+	if _, running := m.servers[name]; running || m.lastConfig.Server(name) != serverConfig || m.shutdownStatus != nil {
+		return
+	}
+	m.logger.Infof("Starting server %s in place of its orphaned process", name)
+	if err := m.startServer(serverConfig); err != nil {
+		m.logger.Errorf("Failed to start server %s: %v", name, err)
+	}
+	m.publishStatus()
+}
+
+// releaseOrphans terminates the orphans the first apply did not adopt,
+// such as servers no longer in the configuration, in the background.
+// The caller must hold m.mu.
+func (m *Manager) releaseOrphans() {
+	for name, o := range m.orphans {
+		go m.terminateOrphan(o)
+		delete(m.orphans, name)
+	}
+}
+
+// watchAdopted waits for an adopted process to exit. It is not a child of
+// the manager, so its exit status is unknown and it is checked for in
+// /proc instead.
+func (m *Manager) watchAdopted(server *MinecraftServer, o orphan) {
+	ticker := time.NewTicker(orphanPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !o.alive() {
+			break
+		}
+	}
+	m.removeServerLocks(server.Config.Name, o.pid)
+	close(server.exited)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := server.Config.Name
+	if m.servers[name] != server {
+		return
+	}
+	m.setStatus(server, "crashed")
+	m.logger.Errorf("Adopted server %s exited", name)
+	m.recordState(name, uptime.StateCrash)
+	m.counters.crashes[name]++
+}
+
+// terminateOrphan asks an orphaned process to stop with SIGTERM, so that
+// the server saves its world, and kills it after the shutdown timeout.
+// It waits for the process, so the caller must not hold m.mu.
+func (m *Manager) terminateOrphan(o orphan) {
+	m.logger.Warnf("Terminating orphaned process %d of server %s on port %d", o.pid, o.name, o.port)
+	if err := signalPid(o.pid, syscall.SIGTERM); err != nil {
+		m.logger.Errorf("Failed to terminate orphaned process %d: %v", o.pid, err)
+		return
+	}
+
+	deadline := time.Now().Add(time.Duration(m.config.Server.ShutdownTimeout) * time.Second)
+	for o.alive() {
+		if time.Now().After(deadline) {
+			m.logger.Warnf("Orphaned process %d did not stop in time, killing it", o.pid)
+			signalPid(o.pid, syscall.SIGKILL)
+			return
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// askToStop asks a server to save its world and exit: through its console,
+// or with SIGTERM for an adopted process without one.
+// The caller must hold m.mu.
+func (m *Manager) askToStop(server *MinecraftServer) error {
+	var err error
+	if server.Stdin == nil && server.Process != nil && server.Process.Process != nil {
+		err = server.Process.Process.Signal(syscall.SIGTERM)
+	} else {
+		err = m.sendCommand(server, "stop")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ask server %s to stop: %w", server.Config.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,590 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// packRef is an entry of a world's world_behavior_packs.json, also used for
+// pack dependencies in manifests
+type packRef struct {
+	PackID  string `json:"pack_id"`
+	Version []int  `json:"version"`
+}
+
+// builtPack is a behavior pack ready to be installed
+type builtPack struct {
+	path    string
+	name    string
+	dirName string
+	files   map[string][]byte
+	ref     packRef
+	deps    []packRef
+}
+
+// fetchPackSources downloads the source directories of all packs referenced
+// by the configuration, keyed by repository path. Packs that fail to
+// download are left out so the previously deployed versions stay in use.
+func (m *Manager) fetchPackSources(repoConfig *config.RepoConfig, commitSHA string) map[string]map[string][]byte {
+	packSources := make(map[string]map[string][]byte)
+
+	for _, serverConfig := range repoConfig.Servers {
+		for _, pack := range serverConfig.Packs() {
+			key := packSourceKey(serverConfig.Source, pack.Path)
+			if _, fetched := packSources[key]; fetched {
+				continue
+			}
+
+			files, err := m.sources.GetDirectoryAt(serverConfig.Source, pack.Path, commitSHA)
+			if err != nil {
+				m.logger.Errorf("Failed to fetch pack %s from %s: %v", pack.Path, serverConfig.Source, err)
+				continue
+			}
+			packSources[key] = files
+		}
+	}
+
+	return packSources
+}
+
+// packSourceKey identifies a pack directory within a configuration source,
+// since sources may use the same paths
+func packSourceKey(source, packPath string) string {
+	return source + ":" + packPath
+}
+
+// deployPacks packages and installs the server's behavior packs and writes
+// the world's world_behavior_packs.json in dependency-resolved priority
+// order. It reports whether anything changed on disk. Nothing is written
+// when the packs cannot be resolved.
+// The caller must hold m.mu.
+func (m *Manager) deployPacks(serverConfig *config.MinecraftServerConfig) (bool, error) {
+	packs := serverConfig.Packs()
+	if len(packs) == 0 {
+		return false, nil
+	}
+
+	var built []*builtPack
+	for i := range packs {
+		sources, exists := m.packSources[packSourceKey(serverConfig.Source, packs[i].Path)]
+		if !exists {
+			m.logger.Warnf("Sources for pack %s unavailable, keeping deployed packs for %s", packs[i].Path, serverConfig.Name)
+			return false, nil
+		}
+
+		if err := m.verifyPack(&packs[i], sources); err != nil {
+			return false, err
+		}
+		pack, err := buildPack(&packs[i], sources)
+		if err != nil {
+			return false, fmt.Errorf("failed to package pack %s: %w", packs[i].Path, err)
+		}
+		built = append(built, pack)
+	}
+
+	m.skipExternalDeps(serverConfig, built)
+	ordered, err := resolvePackOrder(built)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	packsDir := filepath.Join(m.config.GetServerDir(serverConfig.Name), "behavior_packs")
+	for _, pack := range ordered {
+		installed, err := installPack(packsDir, pack)
+		if err != nil {
+			return false, err
+		}
+		if installed {
+			m.logger.Infof("Deployed pack %s to %s (version %s)", pack.path, serverConfig.Name, formatVersion(pack.ref.Version))
+			changed = true
+		}
+	}
+
+	refs := make([]packRef, 0, len(ordered))
+	for _, pack := range ordered {
+		refs = append(refs, pack.ref)
+	}
+	written, err := m.writeWorldPacks(serverConfig, refs)
+	if err != nil {
+		return false, err
+	}
+
+	return changed || written, nil
+}
+
+// skipExternalDeps leaves out the dependencies that are not configured
+// behavior packs, which the packs are not ordered by: packs embedded in the
+// world and resource packs, which add-ons commonly depend on. The latter
+// are logged, the server itself reports them when missing.
+// The caller must hold m.mu.
+func (m *Manager) skipExternalDeps(serverConfig *config.MinecraftServerConfig, packs []*builtPack) {
+	configured := make(map[string]bool, len(packs))
+	for _, pack := range packs {
+		configured[pack.ref.PackID] = true
+	}
+	embedded := embeddedPackIDs(filepath.Join(m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName), "behavior_packs"))
+
+	for _, pack := range packs {
+		var deps []packRef
+		for _, dep := range pack.deps {
+			switch {
+			case configured[dep.PackID]:
+				deps = append(deps, dep)
+			case !embedded[dep.PackID]:
+				m.logger.Infof("Pack %s of %s depends on %s, which is not a configured behavior pack; not ordering by it",
+					pack.path, serverConfig.Name, dep.PackID)
+			}
+		}
+		pack.deps = deps
+	}
+}
+
+// verifyPack checks the source files of a pack against its pinned sha256.
+// Packs without one are refused with verification.require_pack_checksums.
+func (m *Manager) verifyPack(pack *config.ScriptPack, sources map[string][]byte) error {
+	actual := config.HashPackFiles(sources)
+	switch {
+	case pack.SHA256 != "" && !strings.EqualFold(pack.SHA256, actual):
+		return fmt.Errorf("pack %s does not match its sha256 (expected: %s, got: %s)", pack.Path, strings.ToLower(pack.SHA256), actual)
+	case pack.SHA256 == "" && m.config.Verification.RequirePackChecksums:
+		return fmt.Errorf("pack %s has no sha256, which verification.require_pack_checksums requires; its checksum is %s", pack.Path, actual)
+	}
+	return nil
+}
+
+// deployAllPacks redeploys the packs of running servers and reloads the
+// servers whose packs changed.
+// The caller must hold m.mu.
+func (m *Manager) deployAllPacks() {
+	for name, server := range m.servers {
+		changed, err := m.deployPacks(server.Config)
+		if err != nil {
+			m.logger.Errorf("Failed to deploy packs for %s: %v", name, err)
+			continue
+		}
+		if changed {
+			m.announce(server, config.AnnouncePacksReloaded, announcement{})
+			if err := m.sendCommand(server, "reload"); err != nil {
+				m.logger.Errorf("Failed to reload %s after pack deployment: %v", name, err)
+			}
+		}
+	}
+}
+
+// installPack writes a pack into packsDir unless the same content is
+// already deployed, and reports whether it was written.
+func installPack(packsDir string, pack *builtPack) (bool, error) {
+	// The pack directory is replaced as a whole, it must never be the packs
+	// directory itself or lie outside it
+	if pack.dirName == "." || pack.dirName == ".." || pack.dirName == "/" || pack.dirName == "" {
+		return false, fmt.Errorf("pack %s has no directory name of its own", pack.path)
+	}
+	packDir := filepath.Join(packsDir, pack.dirName)
+	hashPath := packDir + ".sha256"
+
+	hash := config.HashPackFiles(pack.files)
+	if deployed, err := os.ReadFile(hashPath); err == nil && string(deployed) == hash {
+		return false, nil
+	}
+
+	stagingDir := packDir + ".staging"
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return false, fmt.Errorf("failed to clean staging directory: %w", err)
+	}
+	for name, content := range pack.files {
+		target := filepath.Join(stagingDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return false, fmt.Errorf("failed to create pack directory: %w", err)
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			return false, fmt.Errorf("failed to write pack file %s: %w", name, err)
+		}
+	}
+
+	if err := os.RemoveAll(packDir); err != nil {
+		return false, fmt.Errorf("failed to remove old pack: %w", err)
+	}
+	if err := os.Rename(stagingDir, packDir); err != nil {
+		return false, fmt.Errorf("failed to move pack into place: %w", err)
+	}
+	if err := os.WriteFile(hashPath, []byte(hash), 0644); err != nil {
+		return false, fmt.Errorf("failed to record pack hash: %w", err)
+	}
+
+	return true, nil
+}
+
+// writeWorldPacks writes the world's world_behavior_packs.json. Entries for
+// packs embedded in the world itself are kept after the managed packs.
+// It reports whether the file changed.
+func (m *Manager) writeWorldPacks(serverConfig *config.MinecraftServerConfig, refs []packRef) (bool, error) {
+	worldDir := m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName)
+	packsPath := filepath.Join(worldDir, "world_behavior_packs.json")
+
+	var existing []packRef
+	if data, err := os.ReadFile(packsPath); err == nil {
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return false, fmt.Errorf("failed to parse world_behavior_packs.json: %w", err)
+		}
+	}
+
+	embedded := embeddedPackIDs(filepath.Join(worldDir, "behavior_packs"))
+	for _, ref := range existing {
+		if embedded[ref.PackID] {
+			refs = append(refs, ref)
+		}
+	}
+
+	data, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if current, err := os.ReadFile(packsPath); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(worldDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create world directory: %w", err)
+	}
+	if err := os.WriteFile(packsPath, data, 0644); err != nil {
+		return false, fmt.Errorf("failed to write world_behavior_packs.json: %w", err)
+	}
+	return true, nil
+}
+
+// embeddedPackIDs returns the header UUIDs of packs shipped inside a world
+func embeddedPackIDs(dir string) map[string]bool {
+	ids := make(map[string]bool)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ids
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "manifest.json"))
+		if err != nil {
+			continue
+		}
+		var manifest struct {
+			Header struct {
+				UUID string `json:"uuid"`
+			} `json:"header"`
+		}
+		if json.Unmarshal(data, &manifest) == nil && manifest.Header.UUID != "" {
+			ids[manifest.Header.UUID] = true
+		}
+	}
+	return ids
+}
+
+// resolvePackOrder checks that every pack dependency is satisfied by a
+// configured pack of a compatible version, see skipExternalDeps, and orders the packs by priority.
+// Configuration order is kept, except that a pack always ranks above the
+// packs it depends on.
+func resolvePackOrder(packs []*builtPack) ([]*builtPack, error) {
+	byID := make(map[string]*builtPack, len(packs))
+	dirNames := make(map[string]*builtPack, len(packs))
+	for _, pack := range packs {
+		if other, exists := byID[pack.ref.PackID]; exists {
+			if formatVersion(other.ref.Version) != formatVersion(pack.ref.Version) {
+				return nil, fmt.Errorf("pack version conflict: %s is configured as %s (%s) and %s (%s)",
+					pack.ref.PackID, other.path, formatVersion(other.ref.Version), pack.path, formatVersion(pack.ref.Version))
+			}
+			return nil, fmt.Errorf("pack %s is configured twice (%s and %s)", pack.ref.PackID, other.path, pack.path)
+		}
+		if other, exists := dirNames[pack.dirName]; exists {
+			return nil, fmt.Errorf("packs %s and %s would both be installed as %s", other.path, pack.path, pack.dirName)
+		}
+		byID[pack.ref.PackID] = pack
+		dirNames[pack.dirName] = pack
+	}
+
+	// dependents counts how many packs depend on each pack; a pack can only
+	// be placed once everything that depends on it has been placed
+	dependents := make(map[*builtPack]int, len(packs))
+	for _, pack := range packs {
+		for _, dep := range pack.deps {
+			provider, exists := byID[dep.PackID]
+			if !exists {
+				return nil, fmt.Errorf("pack %s (%s) depends on %s version %s, which is not configured",
+					pack.name, pack.path, dep.PackID, formatVersion(dep.Version))
+			}
+			if !versionSatisfies(provider.ref.Version, dep.Version) {
+				return nil, fmt.Errorf("pack version conflict: %s (%s) requires %s version %s, but %s is configured",
+					pack.name, pack.path, provider.name, formatVersion(dep.Version), formatVersion(provider.ref.Version))
+			}
+			dependents[provider]++
+		}
+	}
+
+	ordered := make([]*builtPack, 0, len(packs))
+	placed := make(map[*builtPack]bool, len(packs))
+	for len(ordered) < len(packs) {
+		progress := false
+		for _, pack := range packs {
+			if placed[pack] || dependents[pack] > 0 {
+				continue
+			}
+			ordered = append(ordered, pack)
+			placed[pack] = true
+			for _, dep := range pack.deps {
+				dependents[byID[dep.PackID]]--
+			}
+			progress = true
+			break
+		}
+		if !progress {
+			var cyclic []string
+			for _, pack := range packs {
+				if !placed[pack] {
+					cyclic = append(cyclic, pack.path)
+				}
+			}
+			return nil, fmt.Errorf("circular pack dependencies between %s", strings.Join(cyclic, ", "))
+		}
+	}
+
+	return ordered, nil
+}
+
+// versionSatisfies reports whether version fulfills a dependency on
+// required: same major version and not older.
+func versionSatisfies(version, required []int) bool {
+	if version[0] != required[0] {
+		return false
+	}
+	for i := range version {
+		if version[i] != required[i] {
+			return version[i] > required[i]
+		}
+	}
+	return true
+}
+
+func formatVersion(version []int) string {
+	parts := make([]string, len(version))
+	for i, v := range version {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ".")
+}
+
+// buildPack returns a pack ready for installation. An existing manifest.json
+// is kept and completed with stable UUIDs where they are missing; otherwise a
+// manifest is generated from the pack configuration.
+func buildPack(pack *config.ScriptPack, sources map[string][]byte) (*builtPack, error) {
+	files := make(map[string][]byte, len(sources)+1)
+	for name, content := range sources {
+		files[name] = content
+	}
+
+	var manifest map[string]interface{}
+	if data, exists := sources["manifest.json"]; exists {
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest.json: %w", err)
+		}
+	} else {
+		var err error
+		if manifest, err = generateManifest(pack, sources); err != nil {
+			return nil, err
+		}
+	}
+
+	header, ok := manifest["header"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("manifest.json has no header")
+	}
+
+	// UUIDs are derived from the pack path so they stay stable across
+	// deployments and servers sharing the pack agree on its identity
+	if id, _ := header["uuid"].(string); !uuidPattern.MatchString(id) {
+		header["uuid"] = stableUUID("header", pack.Path)
+	}
+	modules, _ := manifest["modules"].([]interface{})
+	for i, module := range modules {
+		if moduleMap, ok := module.(map[string]interface{}); ok {
+			if id, _ := moduleMap["uuid"].(string); !uuidPattern.MatchString(id) {
+				moduleMap["uuid"] = stableUUID("module", pack.Path, strconv.Itoa(i))
+			}
+		}
+	}
+
+	version, err := versionArray(header["version"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid pack version: %w", err)
+	}
+
+	// Only pack dependencies matter for ordering, script module
+	// dependencies (module_name) are provided by the server itself
+	var deps []packRef
+	dependencies, _ := manifest["dependencies"].([]interface{})
+	for _, dependency := range dependencies {
+		depMap, ok := dependency.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := depMap["uuid"].(string)
+		if id == "" {
+			continue
+		}
+		depVersion, err := versionArray(depMap["version"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version for dependency %s: %w", id, err)
+		}
+		deps = append(deps, packRef{PackID: id, Version: depVersion})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files["manifest.json"] = data
+
+	name, _ := header["name"].(string)
+	if name == "" {
+		name = path.Base(pack.Path)
+	}
+
+	return &builtPack{
+		path:    pack.Path,
+		name:    name,
+		dirName: path.Base(pack.Path),
+		files:   files,
+		ref:     packRef{PackID: header["uuid"].(string), Version: version},
+		deps:    deps,
+	}, nil
+}
+
+func generateManifest(pack *config.ScriptPack, sources map[string][]byte) (map[string]interface{}, error) {
+	name := pack.Name
+	if name == "" {
+		name = path.Base(pack.Path)
+	}
+	version := pack.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	entry := pack.Entry
+	if entry == "" {
+		entry = "scripts/main.js"
+	}
+
+	versionParts, err := versionArray(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pack version %q: %w", version, err)
+	}
+
+	// Packs without a script entry point are plain data packs
+	if _, hasEntry := sources[entry]; !hasEntry {
+		return map[string]interface{}{
+			"format_version": 2,
+			"header": map[string]interface{}{
+				"name":               name,
+				"description":        "Deployed by minecraft-server-manager",
+				"version":            versionParts,
+				"min_engine_version": []int{1, 20, 0},
+			},
+			"modules": []interface{}{
+				map[string]interface{}{
+					"type":    "data",
+					"version": versionParts,
+				},
+			},
+		}, nil
+	}
+
+	dependencies := []interface{}{}
+	moduleNames := make([]string, 0, len(pack.Dependencies))
+	for moduleName := range pack.Dependencies {
+		moduleNames = append(moduleNames, moduleName)
+	}
+	sort.Strings(moduleNames)
+	for _, moduleName := range moduleNames {
+		dependencies = append(dependencies, map[string]interface{}{
+			"module_name": moduleName,
+			"version":     pack.Dependencies[moduleName],
+		})
+	}
+	if len(dependencies) == 0 {
+		dependencies = append(dependencies, map[string]interface{}{
+			"module_name": "@minecraft/server",
+			"version":     "1.8.0",
+		})
+	}
+
+	return map[string]interface{}{
+		"format_version": 2,
+		"header": map[string]interface{}{
+			"name":               name,
+			"description":        "Deployed by minecraft-server-manager",
+			"version":            versionParts,
+			"min_engine_version": []int{1, 20, 0},
+		},
+		"modules": []interface{}{
+			map[string]interface{}{
+				"type":     "script",
+				"language": "javascript",
+				"version":  versionParts,
+				"entry":    entry,
+			},
+		},
+		"dependencies": dependencies,
+	}, nil
+}
+
+// versionArray converts "1.2.3" or [1, 2, 3] into a three part version
+func versionArray(value interface{}) ([]int, error) {
+	var parts []int
+
+	switch v := value.(type) {
+	case string:
+		for _, part := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version %q", v)
+			}
+			parts = append(parts, n)
+		}
+	case []int:
+		parts = v
+	case []interface{}:
+		for _, part := range v {
+			n, ok := part.(float64)
+			if !ok {
+				return nil, fmt.Errorf("invalid version %v", v)
+			}
+			parts = append(parts, int(n))
+		}
+	default:
+		return nil, fmt.Errorf("invalid version %v", value)
+	}
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("version must have three parts")
+	}
+	return parts, nil
+}
+
+// stableUUID derives a name-based (version 5 style) UUID from the given parts
+func stableUUID(parts ...string) string {
+	sum := sha1.Sum([]byte(strings.Join(parts, "\x00")))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	h := hex.EncodeToString(sum[:16])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
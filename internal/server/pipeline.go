@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// fetchedConfig is a verified and validated configuration waiting to be
+// applied, with the pack sources fetched for it
+type fetchedConfig struct {
+	commitSHA   string
+	repoConfig  *config.RepoConfig
+	packSources map[string]map[string][]byte
+	timing      applyTiming
+}
+
+// applyQueue hands fetched configurations from the poller to the applier.
+// It holds at most one configuration: one fetched while an older one is
+// still waiting replaces it, so only the newest commit is ever applied. It
+// has its own lock, so the poller never waits for an apply holding m.mu.
+type applyQueue struct {
+	mu      sync.Mutex
+	pending *fetchedConfig
+	ready   chan struct{}
+
+	// fetched is the commit last queued, rejected the last commit that
+	// failed verification or validation
+	fetched  string
+	rejected string
+
+	// cancel preempts the apply in progress, nil while idle
+	cancel context.CancelCauseFunc
+
+	// superseded counts commits replaced or preempted by a newer one
+	superseded int
+}
+
+func newApplyQueue() *applyQueue {
+	return &applyQueue{ready: make(chan struct{}, 1)}
+}
+
+// wants reports whether a commit must be fetched: it is neither the commit
+// last queued nor a rejected one. Going back to an older commit queues it
+// again, which undoes the changes of the newer one.
+func (q *applyQueue) wants(commitSHA string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return commitSHA != q.fetched && commitSHA != q.rejected
+}
+
+// reject remembers a commit that is not applied
+func (q *applyQueue) reject(commitSHA string) {
+	q.mu.Lock()
+	q.rejected = commitSHA
+	q.mu.Unlock()
+}
+
+// push queues a configuration and preempts the apply in progress. It
+// returns the commit of the configuration it replaced, "" when none was
+// waiting.
+func (q *applyQueue) push(fetched *fetchedConfig) string {
+	q.mu.Lock()
+	var replaced string
+	if q.pending != nil {
+		replaced = q.pending.commitSHA
+		q.superseded++
+	}
+	q.pending = fetched
+	q.fetched = fetched.commitSHA
+	if q.cancel != nil {
+		q.cancel(fmt.Errorf("superseded by commit %s", fetched.commitSHA[:8]))
+		q.cancel = nil
+		q.superseded++
+	}
+	q.mu.Unlock()
+
+	q.wake()
+	return replaced
+}
+
+// take removes the waiting configuration for the applier, nil when there
+// is none. cancel preempts its apply.
+func (q *applyQueue) take(cancel context.CancelCauseFunc) *fetchedConfig {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	fetched := q.pending
+	q.pending = nil
+	if fetched != nil {
+		q.cancel = cancel
+	}
+	return fetched
+}
+
+// done marks the apply in progress as finished
+func (q *applyQueue) done() {
+	q.mu.Lock()
+	q.cancel = nil
+	q.mu.Unlock()
+}
+
+// waiting returns the commit of the configuration waiting to be applied,
+// "" when none is
+func (q *applyQueue) waiting() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		return ""
+	}
+	return q.pending.commitSHA
+}
+
+// wake has the applier look at the queue again, e.g. once a freeze is
+// lifted
+func (q *applyQueue) wake() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// supersededCount returns the number of commits replaced or preempted
+func (q *applyQueue) supersededCount() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.superseded
+}
+
+// runPolls polls the configuration right away and then every poll
+// interval. New commits are queued for the applier, so a slow apply never
+// delays the next poll.
+func (m *Manager) runPolls(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(m.config.GitHub.PollInterval) * time.Second)
+	defer ticker.Stop()
+
+	m.pollConfiguration()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.pollConfiguration()
+		}
+	}
+}
+
+// runApplies applies the queued configurations one at a time until ctx is
+// cancelled. Each apply can be preempted by a newer commit. While the
+// manager is frozen the newest commit waits in the queue.
+func (m *Manager) runApplies(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.queue.ready:
+			if m.Frozen() {
+				if waiting := m.queue.waiting(); waiting != "" {
+					m.logger.Infof("Commit %s waits until the freeze is lifted", waiting[:8])
+				}
+				continue
+			}
+			applyCtx, cancel := context.WithCancelCause(ctx)
+			if fetched := m.queue.take(cancel); fetched != nil {
+				m.applyConfiguration(ctx, applyCtx, fetched)
+				m.queue.done()
+			}
+			cancel(nil)
+		}
+	}
+}
+
+// queueConfiguration hands a fetched configuration to the applier. A
+// configuration still waiting is superseded and never applied, an apply in
+// progress is preempted at the next server.
+func (m *Manager) queueConfiguration(fetched *fetchedConfig) {
+	if replaced := m.queue.push(fetched); replaced != "" {
+		m.logger.Infof("Commit %s superseded by %s before it was applied", replaced[:8], fetched.commitSHA[:8])
+	}
+}
+
+// preemption returns why an apply was preempted, "" while it may go on.
+// Servers are only started, restarted or stopped while it is "".
+func preemption(ctx context.Context) string {
+	if ctx.Err() == nil {
+		return ""
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+		return cause.Error()
+	}
+	return "manager shutting down"
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/events"
+)
+
+// KnownPlayer is a player the manager has seen join, keyed by XUID. The
+// XUID stays the same when the gamertag changes.
+type KnownPlayer struct {
+	XUID     string    `json:"xuid"`
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+
+	// Names are the gamertags seen for the player, oldest first, with the
+	// time each was first seen
+	Names []PlayerName `json:"names"`
+}
+
+// PlayerName is a gamertag a player used
+type PlayerName struct {
+	Name  string    `json:"name"`
+	Since time.Time `json:"since"`
+}
+
+func (m *Manager) playersPath() string {
+	return filepath.Join(m.config.Server.DataDir, "players.json")
+}
+
+// loadPlayers reads the players seen so far
+func (m *Manager) loadPlayers() error {
+	data, err := os.ReadFile(m.playersPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	players := make(map[string]*KnownPlayer)
+	if err := json.Unmarshal(data, &players); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.playersPath(), err)
+	}
+	m.mu.Lock()
+	m.players = players
+	m.mu.Unlock()
+	return nil
+}
+
+// savePlayers writes the players seen so far.
+// The caller must hold m.mu.
+func (m *Manager) savePlayers() error {
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m.players, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.playersPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.playersPath())
+}
+
+// KnownPlayers returns the players seen so far, by current name. A
+// non-empty name returns only players who use or used it.
+func (m *Manager) KnownPlayers(name string) []KnownPlayer {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	players := []KnownPlayer{}
+	for _, player := range m.players {
+		if name != "" && !player.usedName(name) {
+			continue
+		}
+		known := *player
+		known.Names = slices.Clone(player.Names)
+		players = append(players, known)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return strings.ToLower(players[i].Name) < strings.ToLower(players[j].Name)
+	})
+	return players
+}
+
+// usedName reports whether the player uses or used a gamertag
+func (p *KnownPlayer) usedName(name string) bool {
+	return slices.ContainsFunc(p.Names, func(used PlayerName) bool {
+		return strings.EqualFold(used.Name, name)
+	})
+}
+
+// resolvePlayer returns the current name and the XUID of a player named
+// in the configuration, which may be a gamertag the player used before.
+// Unknown players keep their name and have no XUID, as have all players
+// with the offline profile, whose servers do not authenticate them.
+// The caller must hold m.mu.
+func (m *Manager) resolvePlayer(name string) (string, string) {
+	if m.config.Offline() {
+		return name, ""
+	}
+	var found *KnownPlayer
+	for _, player := range m.players {
+		if strings.EqualFold(player.Name, name) {
+			return player.Name, player.XUID
+		}
+		// A name given up by one player may be taken by another, the
+		// player who used it last wins
+		if player.usedName(name) && (found == nil || player.LastSeen.After(found.LastSeen)) {
+			found = player
+		}
+	}
+	if found == nil {
+		return name, ""
+	}
+	return found.Name, found.XUID
+}
+
+// trackPlayer records a player joining a server. When the XUID is known
+// under another name the player was renamed: bans follow the XUID, the
+// allowlist and permissions of running servers that name the player are
+// written again, and a player.renamed event is published.
+// The caller must hold m.mu.
+func (m *Manager) trackPlayer(server *MinecraftServer, name, xuid string) {
+	if xuid == "" || m.config.Offline() {
+		// Offline servers do not authenticate players
+		return
+	}
+	now := time.Now()
+	if m.players == nil {
+		m.players = make(map[string]*KnownPlayer)
+	}
+	player, known := m.players[xuid]
+	if !known {
+		player = &KnownPlayer{XUID: xuid, Name: name, Names: []PlayerName{{Name: name, Since: now}}}
+		m.players[xuid] = player
+	}
+	player.LastSeen = now
+	previous := player.Name
+	renamed := known && previous != name
+	if renamed {
+		player.Name = name
+		if !player.usedName(name) {
+			player.Names = append(player.Names, PlayerName{Name: name, Since: now})
+		}
+	}
+	if err := m.savePlayers(); err != nil {
+		m.logger.Warnf("Failed to save known players: %v", err)
+	}
+	if !renamed {
+		return
+	}
+
+	m.logger.Infof("Player %s (XUID %s) is now called %s", previous, xuid, name)
+	m.events.Publish(events.PlayerRenamed, server.Config.Name, map[string]interface{}{"xuid": xuid, "previous": previous, "name": name})
+	m.renameBans(xuid, name)
+	for _, other := range m.servers {
+		if other.Status != "running" || !namesPlayer(other.Config.Whitelist, other.Config.Ops, player) {
+			continue
+		}
+		if err := m.refreshPlayerFiles(other); err != nil {
+			m.logger.Warnf("Failed to update the allowlist and permissions of %s after the rename of %s: %v", other.Config.Name, previous, err)
+		}
+	}
+}
+
+// namesPlayer reports whether an allowlist or operator list names a player
+// by one of its gamertags
+func namesPlayer(whitelist, ops []string, player *KnownPlayer) bool {
+	return slices.ContainsFunc(whitelist, player.usedName) || slices.ContainsFunc(ops, player.usedName)
+}
+
+// renameBans updates the name of the bans of a renamed player.
+// The caller must hold m.mu.
+func (m *Manager) renameBans(xuid, name string) {
+	changed := false
+	for _, bans := range m.bans {
+		for i := range bans {
+			if bans[i].XUID == xuid && bans[i].Player != name {
+				bans[i].Player = name
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := m.saveBans(); err != nil {
+		m.logger.Warnf("Failed to save bans: %v", err)
+	}
+}
+
+// refreshPlayerFiles writes the allowlist and permissions of a running
+// server again and has it reload them.
+// The caller must hold m.mu.
+func (m *Manager) refreshPlayerFiles(server *MinecraftServer) error {
+	name := server.Config.Name
+	if err := m.createWhitelistFile(server.Config, m.config.GetWhitelistPath(name)); err != nil {
+		return err
+	}
+	if err := m.createPermissionsFile(server.Config, m.config.GetPermissionsPath(name)); err != nil {
+		return err
+	}
+	for _, command := range []string{"allowlist reload", "permission reload"} {
+		if err := m.sendCommand(server, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/metrics"
+)
+
+// pollCounters are the counters of polls for new commits, kept for the
+// lifetime of the process
+type pollCounters struct {
+	// first is when the first poll was made
+	first    time.Time
+	attempts int
+	failures int
+	// latency is the duration of the last poll, latencySum of all
+	latency    time.Duration
+	latencySum time.Duration
+}
+
+// countPoll counts a poll for the head commit of the sources and how long
+// it took
+func (m *Manager) countPoll(latency time.Duration, err error) {
+	m.pollMu.Lock()
+	defer m.pollMu.Unlock()
+
+	if m.polls.first.IsZero() {
+		m.polls.first = time.Now().Add(-latency)
+	}
+	m.polls.attempts++
+	if err != nil {
+		m.polls.failures++
+	}
+	m.polls.latency = latency
+	m.polls.latencySum += latency
+}
+
+// configStaleness returns how long the manager has gone without the
+// latest configuration of its sources, counted from the first poll until
+// one succeeds
+func (m *Manager) configStaleness(now time.Time) time.Duration {
+	m.pollMu.Lock()
+	defer m.pollMu.Unlock()
+
+	since := m.lastChecked
+	if since.IsZero() {
+		since = m.polls.first
+	}
+	if since.IsZero() {
+		return 0
+	}
+	return max(now.Sub(since), 0)
+}
+
+// pollMetrics reports how reliably the sources are polled and how old
+// the applied configuration is.
+// The caller must hold m.mu.
+func (m *Manager) pollMetrics(now time.Time) []metrics.Metric {
+	m.pollMu.Lock()
+	polls := m.polls
+	m.pollMu.Unlock()
+
+	samples := []metrics.Metric{
+		{Name: "config_poll_attempts_total", Help: "Polls of the configuration sources for new commits.", Kind: metrics.Counter, Value: float64(polls.attempts)},
+		{Name: "config_poll_failures_total", Help: "Polls of the configuration sources that failed.", Kind: metrics.Counter, Value: float64(polls.failures)},
+		{Name: "config_poll_not_modified_total", Help: "Polls GitHub answered with 304 Not Modified.", Kind: metrics.Counter, Value: float64(m.sources.NotModified())},
+		{Name: "config_poll_latency_seconds", Help: "Duration of the last poll.", Kind: metrics.Gauge, Value: polls.latency.Seconds()},
+		{Name: "config_poll_latency_seconds_total", Help: "Duration of all polls, for the average latency.", Kind: metrics.Counter, Value: polls.latencySum.Seconds()},
+		{Name: "config_staleness_seconds", Help: "Time since the manager last had the latest configuration of its sources.", Kind: metrics.Gauge, Value: m.configStaleness(now).Seconds()},
+	}
+	for i := len(m.applyOutcomes) - 1; i >= 0; i-- {
+		last := m.applyOutcomes[i]
+		if last.Result == audit.ApplyRejected || last.Commit != m.lastCommitSHA || last.CommittedAt.IsZero() {
+			continue
+		}
+		samples = append(samples, metrics.Metric{Name: "config_commit_age_seconds", Help: "Age of the applied configuration commit.", Kind: metrics.Gauge, Value: max(now.Sub(last.CommittedAt).Seconds(), 0)})
+		break
+	}
+	return samples
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+
+	"minecraft-server-manager/internal/github"
+)
+
+// Promote fast-forwards the branch of environment to to the validated head
+// of environment from, or to the given commit of it
+func (m *Manager) Promote(from, to, sha string) (*github.Promotion, error) {
+	fromBranch, exists := m.config.GitHub.Environments[from]
+	if !exists {
+		return nil, fmt.Errorf("unknown environment %q", from)
+	}
+	toBranch, exists := m.config.GitHub.Environments[to]
+	if !exists {
+		return nil, fmt.Errorf("unknown environment %q", to)
+	}
+	if fromBranch == toBranch {
+		return nil, fmt.Errorf("environments %s and %s use the same branch %s", from, to, fromBranch)
+	}
+
+	m.logger.Infof("Promoting %s (%s) to %s (%s)", from, fromBranch, to, toBranch)
+
+	promotion, err := m.sources.Promote(fromBranch, toBranch, sha)
+	if err != nil {
+		m.logger.Errorf("Promotion of %s to %s failed: %v", from, to, err)
+		return promotion, err
+	}
+
+	for _, name := range promotion.Updated {
+		m.logger.Infof("Promoted %s to %s in source %s", promotion.Commits[name], toBranch, name)
+	}
+	return promotion, nil
+}
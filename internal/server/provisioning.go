@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/hooks"
+)
+
+// provisionedServer is what the hooks were told about a server when it was
+// created, kept so that its destruction carries the same details
+type provisionedServer struct {
+	Tenant      string            `json:"tenant,omitempty"`
+	Group       string            `json:"group,omitempty"`
+	Port        int               `json:"port"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func (m *Manager) provisionedPath() string {
+	return filepath.Join(m.config.Server.DataDir, "provisioned.json")
+}
+
+// loadProvisioned reads the servers known from earlier applies. It returns
+// nil without error when no state was recorded yet.
+func (m *Manager) loadProvisioned() (map[string]provisionedServer, error) {
+	data, err := os.ReadFile(m.provisionedPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	provisioned := make(map[string]provisionedServer)
+	if err := json.Unmarshal(data, &provisioned); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", m.provisionedPath(), err)
+	}
+	return provisioned, nil
+}
+
+func (m *Manager) saveProvisioned(provisioned map[string]provisionedServer) error {
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(provisioned, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.provisionedPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.provisionedPath())
+}
+
+// provisionServers compares an applied configuration with the servers known
+// from earlier applies and fires the hooks of servers that were added or
+// removed. The servers found on the first apply are recorded without
+// calling hooks, so that existing servers are not created again.
+func (m *Manager) provisionServers(repoConfig *config.RepoConfig) {
+	previous, err := m.loadProvisioned()
+	if err != nil {
+		m.logger.Errorf("Failed to load provisioned servers, hooks are not called: %v", err)
+		return
+	}
+
+	current := make(map[string]provisionedServer, len(repoConfig.Servers))
+	for _, serverConfig := range repoConfig.Servers {
+		current[serverConfig.Name] = provisionedServer{
+			Tenant:      serverConfig.Tenant,
+			Group:       serverConfig.Group,
+			Port:        serverConfig.Port,
+			Labels:      serverConfig.Labels,
+			Annotations: serverConfig.Annotations,
+		}
+	}
+	if err := m.saveProvisioned(current); err != nil {
+		m.logger.Errorf("Failed to record provisioned servers: %v", err)
+		return
+	}
+	if previous == nil {
+		m.logger.Infof("Recorded %d existing servers for provisioning hooks", len(current))
+		return
+	}
+
+	for _, name := range sortedNames(previous) {
+		if _, exists := current[name]; !exists {
+			m.fireHooks(events.ServerDestroyed, name, previous[name])
+		}
+	}
+	for _, name := range sortedNames(current) {
+		if _, exists := previous[name]; !exists {
+			m.fireHooks(events.ServerCreated, name, current[name])
+		}
+	}
+}
+
+func (m *Manager) fireHooks(event, name string, server provisionedServer) {
+	m.logger.Infof("Firing %s hooks for %s", event, name)
+	m.events.Publish(event, name, map[string]interface{}{"tenant": server.Tenant, "port": server.Port})
+	m.hooks.Fire(hooks.Payload{
+		Event:       event,
+		Server:      name,
+		Tenant:      server.Tenant,
+		Group:       server.Group,
+		Port:        server.Port,
+		Labels:      server.Labels,
+		Annotations: server.Annotations,
+	})
+}
+
+func sortedNames(servers map[string]provisionedServer) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
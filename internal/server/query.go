@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Sort keys of a server query
+const (
+	SortName     = "name"
+	SortStatus   = "status"
+	SortGroup    = "group"
+	SortPort     = "port"
+	SortPriority = "priority"
+	SortPlayers  = "players"
+	SortUptime   = "uptime"
+)
+
+var sortKeys = []string{SortName, SortStatus, SortGroup, SortPort, SortPriority, SortPlayers, SortUptime}
+
+// MaxServerLimit bounds the page size of a server query
+const MaxServerLimit = 1000
+
+// ServerQuery selects, orders and pages server statuses. Empty Statuses,
+// Groups or Tenants match every server. Sort is one of the sort keys, prefixed with "-"
+// for descending order; servers are ordered by name when it is empty and
+// ties are always broken by name. A zero Limit returns every server.
+type ServerQuery struct {
+	Statuses []string
+	Groups   []string
+	Tenants  []string
+	Sort     string
+	Limit    int
+	Offset   int
+}
+
+// ServerList is one page of servers matching a query
+type ServerList struct {
+	// Total is the number of matching servers over all pages
+	Total      int            `json:"total"`
+	Offset     int            `json:"offset"`
+	Limit      int            `json:"limit,omitempty"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+	Servers    []ServerStatus `json:"servers"`
+}
+
+// Validate checks the sort key and the page bounds
+func (q ServerQuery) Validate() error {
+	if key := strings.TrimPrefix(q.Sort, "-"); q.Sort != "" && !slices.Contains(sortKeys, key) {
+		return fmt.Errorf("invalid sort %q (must be one of %s, optionally prefixed with -)", q.Sort, strings.Join(sortKeys, ", "))
+	}
+	if q.Limit < 0 || q.Limit > MaxServerLimit {
+		return fmt.Errorf("limit must be between 0 and %d", MaxServerLimit)
+	}
+	if q.Offset < 0 {
+		return fmt.Errorf("offset must not be negative")
+	}
+	return nil
+}
+
+// Apply filters, sorts and pages servers. The slice is not modified.
+func (q ServerQuery) Apply(servers []ServerStatus) ServerList {
+	var matching []ServerStatus
+	for _, serverStatus := range servers {
+		if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, serverStatus.Status) {
+			continue
+		}
+		if len(q.Groups) > 0 && !slices.Contains(q.Groups, serverStatus.Group) {
+			continue
+		}
+		if len(q.Tenants) > 0 && !slices.Contains(q.Tenants, serverStatus.Tenant) {
+			continue
+		}
+		matching = append(matching, serverStatus)
+	}
+
+	key, descending := strings.CutPrefix(q.Sort, "-")
+	sort.SliceStable(matching, func(i, j int) bool {
+		a, b := matching[i], matching[j]
+		cmp := compareServers(key, a, b)
+		if cmp == 0 {
+			return a.Name < b.Name
+		}
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	list := ServerList{Total: len(matching), Offset: q.Offset, Limit: q.Limit, Servers: []ServerStatus{}}
+	if q.Offset >= len(matching) {
+		return list
+	}
+	end := len(matching)
+	if q.Limit > 0 && q.Offset+q.Limit < end {
+		end = q.Offset + q.Limit
+		list.NextOffset = &end
+	}
+	list.Servers = matching[q.Offset:end]
+	return list
+}
+
+// compareServers orders two servers by a sort key
+func compareServers(key string, a, b ServerStatus) int {
+	switch key {
+	case SortStatus:
+		return strings.Compare(a.Status, b.Status)
+	case SortGroup:
+		return strings.Compare(a.Group, b.Group)
+	case SortPort:
+		return a.Port - b.Port
+	case SortPriority:
+		return a.Priority - b.Priority
+	case SortPlayers:
+		return a.PlayerCount - b.PlayerCount
+	case SortUptime:
+		// A later start is a shorter uptime
+		return b.StartTime.Compare(a.StartTime)
+	}
+	return strings.Compare(a.Name, b.Name)
+}
@@ -0,0 +1,78 @@
+package server
+
+import "time"
+
+// Readiness reports whether the manager is ready to serve, with the result
+// of each check
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessCheck is one condition of readiness
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// recordPoll records the outcome of contacting GitHub and sends the poll
+// heartbeat on success
+func (m *Manager) recordPoll(err error) {
+	m.pollMu.Lock()
+	m.lastPoll = time.Now()
+	m.pollError = ""
+	if err != nil {
+		m.pollError = err.Error()
+	} else {
+		m.lastChecked = m.lastPoll
+	}
+	m.pollMu.Unlock()
+
+	if err == nil {
+		m.pingPollHeartbeat()
+	}
+}
+
+// GetReadiness checks that the initial configuration has been applied,
+// GitHub was reachable on the last poll, persisted state has been loaded
+// and the manager is not shutting down
+func (m *Manager) GetReadiness() Readiness {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	configCheck := ReadinessCheck{Name: "config", OK: m.lastCommitSHA != ""}
+	if !configCheck.OK {
+		configCheck.Message = "no configuration applied yet"
+		if m.configError != "" {
+			configCheck.Message += ": " + m.configError
+		}
+	}
+
+	m.pollMu.Lock()
+	lastPoll, pollError := m.lastPoll, m.pollError
+	m.pollMu.Unlock()
+	githubCheck := ReadinessCheck{Name: "github", OK: !lastPoll.IsZero() && pollError == ""}
+	switch {
+	case lastPoll.IsZero():
+		githubCheck.Message = "not polled yet"
+	case pollError != "":
+		githubCheck.Message = pollError
+	}
+
+	stateCheck := ReadinessCheck{Name: "state", OK: m.stateLoaded}
+	if !stateCheck.OK {
+		stateCheck.Message = "state not loaded yet"
+	}
+
+	shutdownCheck := ReadinessCheck{Name: "shutdown", OK: m.shutdownStatus == nil}
+	if !shutdownCheck.OK {
+		shutdownCheck.Message = "shutting down"
+	}
+
+	readiness := Readiness{Ready: true, Checks: []ReadinessCheck{configCheck, githubCheck, stateCheck, shutdownCheck}}
+	for _, check := range readiness.Checks {
+		readiness.Ready = readiness.Ready && check.OK
+	}
+	return readiness
+}
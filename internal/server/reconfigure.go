@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// liveProperties are the server.properties a running server picks up
+// without a restart, with the console command applying a new value. Those
+// without a command are applied with the schedules (difficulty), served by
+// the proxy (server-name) or only read when a world is generated.
+var liveProperties = map[string]func(value string) string{
+	"gamemode":    func(value string) string { return "defaultgamemode " + value },
+	"max-players": func(value string) string { return "setmaxplayers " + value },
+	"allow-list":  allowlistCommand,
+	"white-list":  allowlistCommand,
+	"difficulty":  nil,
+	"server-name": nil,
+	"level-seed":  nil,
+	"level-type":  nil,
+}
+
+func allowlistCommand(value string) string {
+	if value == "true" {
+		return "allowlist on"
+	}
+	return "allowlist off"
+}
+
+// readProperties reads a server.properties file
+func readProperties(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	properties := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if key, value, found := strings.Cut(line, "="); found && !strings.HasPrefix(line, "#") {
+			properties[key] = value
+		}
+	}
+	return properties, scanner.Err()
+}
+
+// changedProperties lists the properties of a running server that differ
+// from the ones its new configuration produces, with their new values.
+// Without a server.properties to compare to, every property is changed.
+func (m *Manager) changedProperties(serverConfig *config.MinecraftServerConfig) (map[string]string, error) {
+	properties, err := m.serverProperties(serverConfig)
+	if err != nil {
+		return nil, err
+	}
+	current, err := readProperties(m.config.GetServerPropertiesPath(serverConfig.Name))
+	if err != nil {
+		return properties, nil
+	}
+	changed := make(map[string]string)
+	for key, value := range properties {
+		if current[key] != value {
+			changed[key] = value
+		}
+	}
+	for key := range current {
+		if _, exists := properties[key]; !exists {
+			changed[key] = ""
+		}
+	}
+	return changed, nil
+}
+
+// restartReasons lists the changes between the running and the new
+// configuration of a server that only a restart applies
+func (m *Manager) restartReasons(old, new *config.MinecraftServerConfig) []string {
+	var reasons []string
+	if old.Port != new.Port {
+		reasons = append(reasons, "port")
+	}
+	if old.Version != new.Version {
+		reasons = append(reasons, "version")
+	}
+	if old.WorldName != new.WorldName {
+		reasons = append(reasons, "world_name")
+	}
+	if !experimentsEqual(old.Experiments, new.Experiments) {
+		reasons = append(reasons, "experiments")
+	}
+	if len(reasons) > 0 {
+		return reasons
+	}
+
+	changed, err := m.changedProperties(new)
+	if err != nil {
+		// The restart reports the error
+		return []string{err.Error()}
+	}
+	for key := range changed {
+		if _, live := liveProperties[key]; !live {
+			reasons = append(reasons, key)
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// reconfigureServer applies the new configuration of a running server that
+// needs no restart: changed properties are written and set through the
+// console, the allowlist and permissions reloaded, and difficulty and game
+// rules applied like schedules. It returns what changed.
+// The caller must hold m.mu.
+func (m *Manager) reconfigureServer(server *MinecraftServer, serverConfig *config.MinecraftServerConfig) ([]string, error) {
+	old := server.Config
+	name := serverConfig.Name
+	server.Config = serverConfig
+	if server.proxy != nil {
+		server.proxy.SetCountryPolicy(countryPolicy(serverConfig))
+	}
+	m.updateMOTD(server, time.Now())
+	m.updateProxyPlayers(server)
+
+	changed, err := m.changedProperties(serverConfig)
+	if err != nil {
+		return nil, err
+	}
+	var applied, commands []string
+	for key, value := range changed {
+		applied = append(applied, key)
+		if command := liveProperties[key]; command != nil {
+			commands = append(commands, command(value))
+		}
+	}
+	sort.Strings(applied)
+	sort.Strings(commands)
+	if len(changed) > 0 {
+		if err := m.createServerProperties(serverConfig, m.config.GetServerPropertiesPath(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	whitelistChanged := !slices.Equal(old.Whitelist, serverConfig.Whitelist)
+	if whitelistChanged {
+		if err := m.createWhitelistFile(serverConfig, m.config.GetWhitelistPath(name)); err != nil {
+			return nil, err
+		}
+		applied = append(applied, "whitelist")
+		commands = append(commands, "allowlist reload")
+	}
+	// Whitelisted players are members in the permissions
+	opsChanged := !slices.Equal(old.Ops, serverConfig.Ops)
+	if whitelistChanged || opsChanged {
+		if err := m.createPermissionsFile(serverConfig, m.config.GetPermissionsPath(name)); err != nil {
+			return nil, err
+		}
+		if opsChanged {
+			applied = append(applied, "ops")
+		}
+		commands = append(commands, "permission reload")
+	}
+	if !maps.Equal(old.Gamerules, serverConfig.Gamerules) {
+		applied = append(applied, "gamerules")
+	}
+
+	for _, command := range commands {
+		if err := m.sendCommand(server, command); err != nil {
+			return applied, err
+		}
+		m.logger.Infof("Applied %q to %s", command, name)
+	}
+	if server.Status == "running" {
+		m.applyServerSchedules(server, time.Now())
+	}
+	return applied, nil
+}
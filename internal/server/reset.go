@@ -0,0 +1,230 @@
+package server
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/schedule"
+)
+
+// scheduleReset computes the next scheduled world reset of a server from its
+// reset policy.
+func (m *Manager) scheduleReset(server *MinecraftServer) {
+	server.NextReset = time.Time{}
+
+	expr := server.Config.ResetPolicy.Cron
+	if expr == "" {
+		return
+	}
+
+	cron, err := schedule.ParseCron(expr)
+	if err != nil {
+		m.logger.Errorf("Invalid reset schedule for %s: %v", server.Config.Name, err)
+		return
+	}
+
+	server.NextReset = cron.Next(time.Now())
+	m.logger.Infof("Next world reset for %s scheduled at %s", server.Config.Name, server.NextReset.Format(time.RFC3339))
+}
+
+// checkScheduledResets resets the worlds of all servers whose scheduled
+// reset time has passed. Resets due while the manager is frozen or in safe
+// mode wait until it no longer is.
+func (m *Manager) checkScheduledResets(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.paused() {
+		return
+	}
+
+	var due []*config.MinecraftServerConfig
+	for name, server := range m.servers {
+		if !server.NextReset.IsZero() && !now.Before(server.NextReset) && !m.isLocked(name) {
+			due = append(due, server.Config)
+		}
+	}
+
+	for _, serverConfig := range due {
+		m.resetWorldForPolicy(serverConfig, "scheduled reset")
+	}
+}
+
+// resetOnEmpty resets the world of a server after its last player left.
+func (m *Manager) resetOnEmpty(server *MinecraftServer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The server may have been restarted or stopped in the meantime
+	if m.servers[server.Config.Name] != server || len(server.Players) > 0 || m.paused() || m.isLocked(server.Config.Name) {
+		return
+	}
+
+	m.resetWorldForPolicy(server.Config, "server empty")
+}
+
+// resetWorldForPolicy archives the current world and provisions a fresh one
+// from the server's world template. A running server is stopped first, so
+// that the archive is not torn by its writes, and started again afterwards.
+// The caller must hold m.mu.
+func (m *Manager) resetWorldForPolicy(serverConfig *config.MinecraftServerConfig, reason string) {
+	m.logger.Infof("Resetting world for %s (%s)", serverConfig.Name, reason)
+	_, running := m.servers[serverConfig.Name]
+	if running {
+		m.announce(m.servers[serverConfig.Name], config.AnnounceWorldReset, announcement{Reason: reason})
+		m.stopServer(serverConfig.Name)
+	}
+
+	archivePath, err := m.archiveWorld(serverConfig)
+	if err != nil {
+		m.logger.Errorf("Failed to archive world for %s, skipping reset: %v", serverConfig.Name, err)
+	} else {
+		if archivePath != "" {
+			m.logger.Infof("Archived world for %s to %s", serverConfig.Name, archivePath)
+			m.events.Publish(events.BackupCompleted, serverConfig.Name, map[string]interface{}{"archive": archivePath})
+		}
+		if err := m.provisionWorld(serverConfig); err != nil {
+			m.logger.Errorf("Failed to reset world for %s: %v", serverConfig.Name, err)
+		} else {
+			m.events.Publish(events.WorldReset, serverConfig.Name, map[string]interface{}{"reason": reason})
+		}
+	}
+
+	if running {
+		// Starting schedules the next reset
+		if err := m.startServer(serverConfig); err != nil {
+			m.logger.Errorf("Failed to restart server %s after its world reset: %v", serverConfig.Name, err)
+		}
+	}
+	// Make sure a failed reset does not retry every minute
+	if server, exists := m.servers[serverConfig.Name]; exists && !server.NextReset.After(time.Now()) {
+		m.scheduleReset(server)
+	}
+}
+
+// archiveWorld zips the current world of a server into its archives
+// directory and returns the archive path, or an empty path if the server
+// has no world yet. Archives beyond reset_policy.keep_archives are removed,
+// oldest first.
+func (m *Manager) archiveWorld(serverConfig *config.MinecraftServerConfig) (string, error) {
+	worldDir := m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName)
+	if _, err := os.Stat(worldDir); os.IsNotExist(err) {
+		return "", nil
+	}
+
+	archivesDir := filepath.Join(m.config.GetServerDir(serverConfig.Name), "archives")
+	if err := os.MkdirAll(archivesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archives directory: %w", err)
+	}
+
+	archivePath := filepath.Join(archivesDir, fmt.Sprintf("%s-%s.mcworld", serverConfig.WorldName, time.Now().Format("20060102-150405")))
+	if err := zipDirectory(worldDir, archivePath); err != nil {
+		os.Remove(archivePath)
+		return "", err
+	}
+
+	keep := serverConfig.ResetPolicy.KeepArchives
+	if keep == 0 {
+		keep = config.DefaultKeepArchives
+	}
+	if err := pruneArchives(archivesDir, keep); err != nil {
+		m.logger.Warnf("Failed to remove old world archives of %s: %v", serverConfig.Name, err)
+	}
+	return archivePath, nil
+}
+
+// pruneArchives removes all but the keep newest archives of a directory
+func pruneArchives(archivesDir string, keep int) error {
+	entries, err := os.ReadDir(archivesDir)
+	if err != nil {
+		return err
+	}
+	type archive struct {
+		path     string
+		modified time.Time
+	}
+	var archives []archive
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".mcworld" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		archives = append(archives, archive{filepath.Join(archivesDir, entry.Name()), info.ModTime()})
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].modified.After(archives[j].modified) })
+	for i := keep; i < len(archives); i++ {
+		if err := os.Remove(archives[i].path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func zipDirectory(srcDir, archivePath string) error {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeZip(srcDir, file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// writeZip writes the files under srcDir to w as a zip archive
+func writeZip(srcDir string, w io.Writer) error {
+	writer := zip.NewWriter(w)
+
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		header.Method = zip.Deflate
+
+		dst, err := writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/github"
+)
+
+// Rollout phases
+const (
+	PhaseCanary    = "canary"
+	PhaseRolling   = "rolling"
+	PhaseCompleted = "completed"
+	PhaseFailed    = "failed"
+	PhaseCancelled = "cancelled"
+)
+
+// healthCheckInterval is how often servers are checked while waiting for
+// them to become ready or while soaking
+const healthCheckInterval = 5 * time.Second
+
+// RolloutStatus reports the progress of a staged apply
+type RolloutStatus struct {
+	CommitSHA string    `json:"commit_sha"`
+	Phase     string    `json:"phase"`
+	Canary    string    `json:"canary,omitempty"`
+	Wave      []string  `json:"wave,omitempty"`
+	Pending   []string  `json:"pending,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	SoakUntil time.Time `json:"soak_until,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// rollout restarts deferred servers in the background, after the canary
+// has proven healthy and in waves of at most max_unavailable servers, each
+// wave waiting for the previous one to become ready
+type rollout struct {
+	status     RolloutStatus
+	settings   config.RolloutConfig
+	pending    []*config.MinecraftServerConfig
+	rollback   *config.MinecraftServerConfig
+	actions    []ServerAction
+	deployment *github.Deployment
+	cancel     context.CancelFunc
+
+	// timing is that of the apply the rollout completes
+	timing applyTiming
+}
+
+func (r *rollout) active() bool {
+	return r.status.Phase == PhaseCanary || r.status.Phase == PhaseRolling
+}
+
+// deferredRestarts returns the running servers whose restart is left to a
+// rollout. With the canary strategy, a change restarting the canary together
+// with other servers restarts only the canary. With max_unavailable set,
+// only that many servers are restarted at once, by priority.
+// The caller must hold m.mu.
+func (m *Manager) deferredRestarts(repoConfig *config.RepoConfig, admitted map[string]bool) map[string]bool {
+	settings := repoConfig.Rollout
+
+	var restarts []string
+	canaryRestarts := false
+	for _, i := range priorityOrder(repoConfig.Servers) {
+		serverConfig := &repoConfig.Servers[i]
+		existing, exists := m.servers[serverConfig.Name]
+		if !exists || !admitted[serverConfig.Name] || m.isLocked(serverConfig.Name) || !m.serverConfigChanged(existing.Config, serverConfig) {
+			continue
+		}
+		if settings.Strategy == config.RolloutCanary && serverConfig.Name == settings.Canary {
+			canaryRestarts = true
+			continue
+		}
+		restarts = append(restarts, serverConfig.Name)
+	}
+
+	immediate := len(restarts)
+	switch {
+	case canaryRestarts:
+		immediate = 0
+	case settings.MaxUnavailable > 0:
+		immediate = min(immediate, settings.MaxUnavailable)
+	}
+
+	deferred := make(map[string]bool)
+	for _, name := range restarts[immediate:] {
+		deferred[name] = true
+	}
+	return deferred
+}
+
+// startRollout carries out the deferred restarts of an apply once the
+// servers restarted right away (the first wave) are ready. When the first
+// wave is the canary, it is soaked first. The rollout takes over the
+// deployment and finishes it.
+// The caller must hold m.mu.
+func (m *Manager) startRollout(ctx context.Context, commitSHA string, repoConfig, previous *config.RepoConfig, wave []string, deferred []*config.MinecraftServerConfig, deployment *github.Deployment, timing applyTiming) {
+	settings := repoConfig.Rollout
+	rolloutCtx, cancel := context.WithCancel(ctx)
+
+	r := &rollout{
+		status: RolloutStatus{
+			CommitSHA: commitSHA,
+			Phase:     PhaseRolling,
+			Wave:      wave,
+			StartedAt: time.Now(),
+		},
+		settings:   settings,
+		pending:    deferred,
+		deployment: deployment,
+		cancel:     cancel,
+		timing:     timing,
+	}
+	for _, serverConfig := range deferred {
+		r.status.Pending = append(r.status.Pending, serverConfig.Name)
+	}
+
+	if settings.Strategy == config.RolloutCanary && len(wave) == 1 && wave[0] == settings.Canary {
+		r.status.Phase = PhaseCanary
+		r.status.Canary = settings.Canary
+		r.rollback = previous.Server(settings.Canary)
+		m.logger.Infof("Rolling out commit %s to canary %s first, %d servers waiting", commitSHA[:8], settings.Canary, len(deferred))
+	} else {
+		m.logger.Infof("Rolling restart of commit %s: %d servers restarted, %d waiting", commitSHA[:8], len(wave), len(deferred))
+	}
+
+	m.rollout = r
+	go m.runRollout(rolloutCtx, r)
+}
+
+// cancelRollout stops an active rollout, e.g. because a newer configuration
+// is being applied.
+// The caller must hold m.mu.
+func (m *Manager) cancelRollout() {
+	r := m.rollout
+	if r == nil || !r.active() {
+		return
+	}
+
+	r.cancel()
+	r.status.Phase = PhaseCancelled
+	m.logger.Infof("Cancelled rollout of commit %s", r.status.CommitSHA[:8])
+	go m.finishDeployment(r.deployment, r.status.CommitSHA, "inactive", "superseded by a newer configuration")
+}
+
+func (m *Manager) runRollout(ctx context.Context, r *rollout) {
+	if r.status.Phase == PhaseCanary {
+		canary := r.status.Canary
+		if err := m.waitReady(ctx, canary, r.settings.ReadyTimeout()); err != nil {
+			m.failRollout(ctx, r, err)
+			return
+		}
+
+		soak := time.Duration(r.settings.SoakMinutes) * time.Minute
+		m.mu.Lock()
+		r.status.SoakUntil = time.Now().Add(soak)
+		m.mu.Unlock()
+		m.logger.Infof("Canary %s is ready, soaking for %s", canary, soak)
+
+		if err := m.soak(ctx, canary, soak); err != nil {
+			m.failRollout(ctx, r, err)
+			return
+		}
+		m.logger.Infof("Canary %s passed, rolling out commit %s to %d servers", canary, r.status.CommitSHA[:8], len(r.pending))
+	} else if err := m.waitWave(ctx, r.status.Wave, r.settings.ReadyTimeout()); err != nil {
+		m.failRollout(ctx, r, err)
+		return
+	}
+
+	for {
+		m.mu.Lock()
+		if ctx.Err() != nil {
+			m.mu.Unlock()
+			return
+		}
+		if len(r.pending) == 0 {
+			break
+		}
+		if m.freeze != nil {
+			// The next batch waits until the freeze is lifted
+			m.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(freezeWait):
+			}
+			continue
+		}
+
+		size := len(r.pending)
+		if r.settings.MaxUnavailable > 0 {
+			size = min(size, r.settings.MaxUnavailable)
+		}
+		batch := r.pending[:size]
+		r.pending = r.pending[size:]
+
+		actions := m.restartServers(batch, "rolling restart")
+		r.actions = append(r.actions, actions...)
+		m.updateApplyActions(r.status.CommitSHA, actions)
+
+		r.status.Phase = PhaseRolling
+		r.status.Wave = nil
+		for _, action := range actions {
+			r.status.Wave = append(r.status.Wave, action.Name)
+		}
+		r.status.Pending = r.status.Pending[size:]
+		wave := r.status.Wave
+		m.mu.Unlock()
+
+		if err := m.waitWave(ctx, wave, r.settings.ReadyTimeout()); err != nil {
+			m.failRollout(ctx, r, err)
+			return
+		}
+	}
+
+	r.status.Phase = PhaseCompleted
+	r.status.Wave = nil
+	actions := r.actions
+	applied := m.applyActions(r.status.CommitSHA)
+	result := audit.ApplySucceeded
+	if len(failedActions(applied)) > 0 {
+		result = audit.ApplyFailed
+	}
+	m.recordApplyOutcome(r.status.CommitSHA, result, r.timing, applied, "")
+	m.mu.Unlock()
+
+	m.logger.Infof("Rollout of commit %s completed", r.status.CommitSHA[:8])
+
+	state := "success"
+	if len(failedActions(actions)) > 0 {
+		state = "failure"
+	}
+	m.finishDeployment(r.deployment, r.status.CommitSHA, state, "rollout completed, "+summarizeActions(actions))
+}
+
+// failRollout halts a rollout, leaving the remaining servers on their
+// current configuration. A failed canary is rolled back to its previous
+// configuration.
+func (m *Manager) failRollout(ctx context.Context, r *rollout, err error) {
+	m.mu.Lock()
+	if ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+
+	description := fmt.Sprintf("rollout halted: %v", err)
+	if r.status.Phase == PhaseCanary {
+		description = fmt.Sprintf("canary %s failed: %v", r.status.Canary, err)
+	}
+
+	m.logger.Errorf("Rollout of commit %s failed, %d servers left on their current configuration: %v", r.status.CommitSHA[:8], len(r.pending), err)
+	r.status.Error = err.Error()
+	m.configError = description
+
+	if r.status.Phase == PhaseCanary && r.rollback != nil {
+		m.logger.Infof("Rolling back canary %s to its previous configuration", r.status.Canary)
+		m.announceRestart(r.status.Canary, "rolling back an update")
+		m.stopServer(r.status.Canary)
+		if err := m.startServer(r.rollback); err != nil {
+			m.logger.Errorf("Failed to roll back canary %s: %v", r.status.Canary, err)
+		}
+	}
+	r.status.Phase = PhaseFailed
+	m.recordApplyOutcome(r.status.CommitSHA, audit.ApplyFailed, r.timing, m.applyActions(r.status.CommitSHA), description)
+	m.mu.Unlock()
+
+	m.finishDeployment(r.deployment, r.status.CommitSHA, "failure", description)
+}
+
+// restartServers restarts servers whose configuration still differs from
+// the running one. Locked servers are left to their unlock, scheduled off
+// servers to their operating hours.
+// The caller must hold m.mu.
+func (m *Manager) restartServers(serverConfigs []*config.MinecraftServerConfig, reason string) []ServerAction {
+	var actions []ServerAction
+	for _, serverConfig := range serverConfigs {
+		if _, off := m.scheduledOff[serverConfig.Name]; off || m.isLocked(serverConfig.Name) {
+			continue
+		}
+		existing, exists := m.servers[serverConfig.Name]
+		if exists && !m.serverConfigChanged(existing.Config, serverConfig) {
+			if _, err := m.reconfigureServer(existing, serverConfig); err != nil {
+				m.logger.Errorf("Failed to reconfigure server %s: %v", serverConfig.Name, err)
+			}
+			continue
+		}
+
+		action := ServerAction{Name: serverConfig.Name, Action: ActionRestarted, Reason: reason}
+		if exists && m.versionBlocked(serverConfig, &action) {
+			actions = append(actions, action)
+			continue
+		}
+		m.logger.Infof("Restarting server %s (%s)", serverConfig.Name, reason)
+		m.announceRestart(serverConfig.Name, reason)
+		m.stopServer(serverConfig.Name)
+		if err := m.startServer(serverConfig); err != nil {
+			m.logger.Errorf("Failed to restart server %s: %v", serverConfig.Name, err)
+			action.Error = err.Error()
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// waitWave waits until every server of a wave is ready
+func (m *Manager) waitWave(ctx context.Context, names []string, timeout time.Duration) error {
+	for _, name := range names {
+		if err := m.waitReady(ctx, name, timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitReady waits until a server reports that it has started
+func (m *Manager) waitReady(ctx context.Context, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		m.mu.RLock()
+		server, exists := m.servers[name]
+		status := ""
+		if exists {
+			status = server.Status
+		}
+		m.mu.RUnlock()
+
+		switch {
+		case !exists:
+			return fmt.Errorf("server %s is not running", name)
+		case status == "running":
+			return nil
+		case status != "starting":
+			return fmt.Errorf("server %s %s before becoming ready", name, status)
+		case time.Now().After(deadline):
+			return fmt.Errorf("server %s not ready after %s", name, timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// soak checks that a ready server keeps running without restarts for the
+// given period
+func (m *Manager) soak(ctx context.Context, name string, period time.Duration) error {
+	m.mu.RLock()
+	server := m.servers[name]
+	m.mu.RUnlock()
+
+	timer := time.NewTimer(period)
+	defer timer.Stop()
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		m.mu.RLock()
+		current, exists := m.servers[name]
+		status := ""
+		if exists {
+			status = current.Status
+		}
+		m.mu.RUnlock()
+
+		if current != server {
+			return fmt.Errorf("server %s was restarted during the soak period", name)
+		}
+		if status != "running" {
+			return fmt.Errorf("server %s %s during the soak period", name, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	runtimemetrics "runtime/metrics"
+
+	"minecraft-server-manager/internal/metrics"
+)
+
+// runtimeSamples are the Go runtime metrics of the manager process that are
+// exported, by their runtime/metrics name. Reading them does not stop the
+// world.
+var runtimeSamples = []struct {
+	source string
+	metric metrics.Metric
+}{
+	{"/sched/goroutines:goroutines", metrics.Metric{Name: "go_goroutines", Help: "Goroutines of the manager process.", Kind: metrics.Gauge}},
+	{"/memory/classes/heap/objects:bytes", metrics.Metric{Name: "go_heap_objects_bytes", Help: "Heap memory of live objects and of dead objects not yet swept.", Kind: metrics.Gauge}},
+	{"/gc/heap/objects:objects", metrics.Metric{Name: "go_heap_objects", Help: "Objects on the heap.", Kind: metrics.Gauge}},
+	{"/gc/heap/goal:bytes", metrics.Metric{Name: "go_gc_heap_goal_bytes", Help: "Heap size the next garbage collection aims for.", Kind: metrics.Gauge}},
+	{"/memory/classes/total:bytes", metrics.Metric{Name: "go_memory_bytes", Help: "Memory mapped by the Go runtime.", Kind: metrics.Gauge}},
+	{"/gc/cycles/total:gc-cycles", metrics.Metric{Name: "go_gc_cycles_total", Help: "Completed garbage collection cycles.", Kind: metrics.Counter}},
+}
+
+// runtimeMetrics reads the runtime metrics of the manager process
+func runtimeMetrics() []metrics.Metric {
+	samples := make([]runtimemetrics.Sample, len(runtimeSamples))
+	for i, sample := range runtimeSamples {
+		samples[i].Name = sample.source
+	}
+	runtimemetrics.Read(samples)
+
+	result := make([]metrics.Metric, 0, len(samples))
+	for i, sample := range samples {
+		metric := runtimeSamples[i].metric
+		switch sample.Value.Kind() {
+		case runtimemetrics.KindUint64:
+			metric.Value = float64(sample.Value.Uint64())
+		case runtimemetrics.KindFloat64:
+			metric.Value = sample.Value.Float64()
+		default:
+			// Not supported by this Go version
+			continue
+		}
+		result = append(result, metric)
+	}
+	return result
+}
+
+// memoryMetrics reports the sizes of what the manager keeps in memory, to
+// tell which of them grows.
+// The caller must hold m.mu.
+func (m *Manager) memoryMetrics() []metrics.Metric {
+	consoleLines := 0
+	for _, server := range m.servers {
+		consoleLines += server.logs.Len()
+	}
+	events, subscribers := m.events.Stats()
+	return []metrics.Metric{
+		{Name: "manager_console_lines", Help: "Console lines kept for all servers.", Kind: metrics.Gauge, Value: float64(consoleLines)},
+		{Name: "manager_log_lines", Help: "Manager log lines kept for crash reports.", Kind: metrics.Gauge, Value: float64(m.logs.Len())},
+		{Name: "manager_events", Help: "Events remembered for replay.", Kind: metrics.Gauge, Value: float64(events)},
+		{Name: "manager_event_subscribers", Help: "Connected event streams.", Kind: metrics.Gauge, Value: float64(subscribers)},
+		{Name: "manager_applies", Help: "Applies kept in the apply history.", Kind: metrics.Gauge, Value: float64(len(m.applies))},
+		{Name: "manager_apply_outcomes", Help: "Apply outcomes kept for the SLO windows.", Kind: metrics.Gauge, Value: float64(len(m.applyOutcomes))},
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// saveHoldTimeout is how long a server gets to make its world files ready
+// for copying after "save hold"
+const saveHoldTimeout = time.Minute
+
+// saveReadyMessage answers "save query" once the world files can be
+// copied. The next console line lists them as "path:length, ...", relative
+// to the worlds directory.
+const saveReadyMessage = "Data saved. Files are now ready to be copied."
+
+// saveHold is a pending "save hold" of a running server
+type saveHold struct {
+	ready bool
+	files chan map[string]int64
+}
+
+// holdSaves pauses the saving of a running server's world and waits until
+// its files can be copied consistently. It returns the files with the
+// length to copy of each; saving must be resumed with resumeSaves.
+func (m *Manager) holdSaves(server *MinecraftServer) (map[string]int64, error) {
+	name := server.Config.Name
+
+	m.mu.Lock()
+	if server.hold != nil {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("saving of server %s is already on hold", name)
+	}
+	hold := &saveHold{files: make(chan map[string]int64, 1)}
+	server.hold = hold
+	err := m.sendCommand(server, "save hold")
+	m.mu.Unlock()
+	if err != nil {
+		m.resumeSaves(server)
+		return nil, err
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	timeout := time.After(saveHoldTimeout)
+	for {
+		select {
+		case files := <-hold.files:
+			return files, nil
+		case <-ticker.C:
+			m.mu.Lock()
+			err := m.sendCommand(server, "save query")
+			m.mu.Unlock()
+			if err != nil {
+				m.resumeSaves(server)
+				return nil, err
+			}
+		case <-server.exited:
+			return nil, fmt.Errorf("server %s exited", name)
+		case <-timeout:
+			m.resumeSaves(server)
+			return nil, fmt.Errorf("server %s did not get its world files ready within %s", name, saveHoldTimeout)
+		}
+	}
+}
+
+// resumeSaves lets a server save its world again after holdSaves
+func (m *Manager) resumeSaves(server *MinecraftServer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	server.hold = nil
+	if m.servers[server.Config.Name] == server {
+		if err := m.sendCommand(server, "save resume"); err != nil {
+			m.logger.Warnf("Failed to resume saving of server %s: %v", server.Config.Name, err)
+		}
+	}
+}
+
+// handleSaveQuery picks up the file list answering "save query" and
+// reports whether the line was part of the answer.
+// The caller must hold m.mu.
+func (m *Manager) handleSaveQuery(server *MinecraftServer, line string) bool {
+	hold := server.hold
+	if hold == nil {
+		return false
+	}
+	if strings.Contains(line, saveReadyMessage) {
+		hold.ready = true
+		return true
+	}
+	if !hold.ready {
+		return false
+	}
+	hold.ready = false
+
+	files := make(map[string]int64)
+	for _, entry := range strings.Split(strings.TrimSpace(line), ", ") {
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			continue
+		}
+		length, err := strconv.ParseInt(entry[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		files[entry[:i]] = length
+	}
+	select {
+	case hold.files <- files:
+	default:
+	}
+	return true
+}
+
+// copyHeldFiles copies the world files listed by holdSaves from the worlds
+// directory of a server to dest, truncated to the length the server
+// reported, at the rate of limit unless it is nil
+func copyHeldFiles(worldsDir string, files map[string]int64, dest string, limit *rateLimiter) error {
+	for file, length := range files {
+		// File names come from the server console
+		if !filepath.IsLocal(file) {
+			return fmt.Errorf("invalid world file %q", file)
+		}
+		if err := copyFilePrefix(filepath.Join(worldsDir, file), filepath.Join(dest, file), length, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFilePrefix(src, dst string, length int64, limit *rateLimiter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = out
+	if limit != nil {
+		w = &throttledWriter{w: out, limit: limit}
+	}
+	if _, err := io.CopyN(w, in, length); err != nil && !errors.Is(err, io.EOF) {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/schedule"
+)
+
+// difficultySetting is the key of the difficulty among the settings a
+// server's schedules control; game rules are keyed by lowercased name
+const difficultySetting = "difficulty"
+
+// baseDifficulty returns the difficulty written to server.properties:
+// custom properties win over the typed field, which wins over the preset.
+// The caller must hold m.mu.
+func (m *Manager) baseDifficulty(serverConfig *config.MinecraftServerConfig) string {
+	if value := serverConfig.Properties["difficulty"]; value != "" {
+		return value
+	}
+	if serverConfig.Difficulty != "" {
+		return serverConfig.Difficulty
+	}
+	if serverConfig.Preset != "" && m.lastConfig != nil {
+		if preset, exists := m.lastConfig.Preset(serverConfig.Preset); exists && preset["difficulty"] != "" {
+			return preset["difficulty"]
+		}
+	}
+	return "easy"
+}
+
+// scheduledSettings returns the difficulty and game rules a server should
+// have at now, with the names of the active schedules. Each setting maps to
+// the console command applying it.
+// The caller must hold m.mu.
+func (m *Manager) scheduledSettings(serverConfig *config.MinecraftServerConfig, now time.Time) (map[string]string, []string) {
+	settings := map[string]string{difficultySetting: "difficulty " + m.baseDifficulty(serverConfig)}
+	for name, value := range serverConfig.Gamerules {
+		settings[strings.ToLower(name)] = fmt.Sprintf("gamerule %s %s", name, value)
+	}
+
+	var active []string
+	for _, sched := range serverConfig.Schedules {
+		// Validated when the configuration was loaded
+		cron, err := schedule.ParseCron(sched.Cron)
+		if err != nil || !cron.Matches(now) {
+			continue
+		}
+		active = append(active, sched.Name)
+		if sched.Difficulty != "" {
+			settings[difficultySetting] = "difficulty " + sched.Difficulty
+		}
+		for name, value := range sched.Gamerules {
+			settings[strings.ToLower(name)] = fmt.Sprintf("gamerule %s %s", name, value)
+		}
+	}
+	return settings, active
+}
+
+// applySchedules brings the difficulty and game rules of every running
+// server in line with its schedules. Locked servers keep their settings,
+// as do all while the manager is in safe mode.
+func (m *Manager) applySchedules(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.safeMode {
+		return
+	}
+	for name, server := range m.servers {
+		if server.Status == "running" && !m.isLocked(name) {
+			m.applyServerSchedules(server, now)
+		}
+	}
+}
+
+// applyServerSchedules sends the commands for the settings of a server
+// that differ from what was last applied.
+// The caller must hold m.mu.
+func (m *Manager) applyServerSchedules(server *MinecraftServer, now time.Time) {
+	settings, active := m.scheduledSettings(server.Config, now)
+	if strings.Join(active, ",") != strings.Join(server.activeSchedules, ",") {
+		if len(active) == 0 {
+			m.logger.Infof("No schedules of %s are active", server.Config.Name)
+		} else {
+			m.logger.Infof("Active schedules of %s: %s", server.Config.Name, strings.Join(active, ", "))
+		}
+		m.announce(server, config.AnnounceSchedules, announcement{Schedules: strings.Join(active, ", ")})
+	}
+	for _, sched := range server.Config.Schedules {
+		if sched.Macro != "" && m.lastConfig != nil && slices.Contains(active, sched.Name) && !slices.Contains(server.activeSchedules, sched.Name) {
+			m.startScheduleMacro(server, sched)
+		}
+	}
+	server.activeSchedules = active
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		command := settings[key]
+		if server.settings[key] == command {
+			continue
+		}
+		if err := m.sendCommand(server, command); err != nil {
+			m.logger.Warnf("Failed to apply schedule to %s: %v", server.Config.Name, err)
+			return
+		}
+		m.logger.Infof("Applied %q to %s", command, server.Config.Name)
+		server.settings[key] = command
+	}
+}
+
+// resetSchedules records the settings a freshly started server has, so
+// that only game rules and active schedules are sent.
+// The caller must hold m.mu.
+func (m *Manager) resetSchedules(server *MinecraftServer) {
+	server.settings = map[string]string{difficultySetting: "difficulty " + m.baseDifficulty(server.Config)}
+	server.activeSchedules = nil
+}
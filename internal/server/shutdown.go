@@ -0,0 +1,129 @@
+package server
+
+import (
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// Shutdown phases
+const (
+	ShutdownGraceful  = "graceful"
+	ShutdownForced    = "forced"
+	ShutdownCompleted = "completed"
+)
+
+// ShutdownStatus reports the progress of a manager shutdown
+type ShutdownStatus struct {
+	Phase     string    `json:"phase"`
+	StartedAt time.Time `json:"started_at"`
+	Deadline  time.Time `json:"deadline"`
+	Remaining []string  `json:"remaining"`
+}
+
+// ForceShutdown ends the graceful phase of a shutdown early and kills the
+// servers that are still running
+func (m *Manager) ForceShutdown() {
+	m.forceOnce.Do(func() { close(m.force) })
+}
+
+// GetShutdownStatus returns the shutdown progress, or nil while the manager
+// is running
+func (m *Manager) GetShutdownStatus() *ShutdownStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.shutdownStatus == nil {
+		return nil
+	}
+	status := *m.shutdownStatus
+	status.Remaining = append([]string(nil), status.Remaining...)
+	return &status
+}
+
+// shutdown stops all servers in two phases: servers are asked to stop
+// through their console, lowest priority first, so they can save their
+// worlds; those still running after the shutdown timeout, or when
+// ForceShutdown is called, are killed.
+func (m *Manager) shutdown() {
+	timeout := time.Duration(m.config.Server.ShutdownTimeout) * time.Second
+
+	m.mu.Lock()
+	status := &ShutdownStatus{
+		Phase:     ShutdownGraceful,
+		StartedAt: time.Now(),
+		Deadline:  time.Now().Add(timeout),
+	}
+	m.shutdownStatus = status
+
+	var waiting []*MinecraftServer
+	running := m.runningByPriority()
+	for i := len(running) - 1; i >= 0; i-- {
+		server := m.servers[running[i]]
+		if server.Status == "stopped" || server.Status == "crashed" {
+			continue
+		}
+		if server.Status == "paused" {
+			if err := m.continueServer(server); err != nil {
+				m.logger.Warnf("Failed to resume paused server %s: %v", running[i], err)
+			}
+		}
+		m.announce(server, config.AnnounceShutdown, announcement{})
+		if err := m.askToStop(server); err != nil {
+			m.logger.Warn(err)
+		}
+		m.setStatus(server, "stopping")
+		status.Remaining = append(status.Remaining, running[i])
+		waiting = append(waiting, server)
+	}
+	m.mu.Unlock()
+
+	m.logger.Infof("Waiting up to %s for %d servers to stop", timeout, len(waiting))
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	forced := false
+	for _, server := range waiting {
+		if forced {
+			break
+		}
+		select {
+		case <-server.exited:
+			m.mu.Lock()
+			status.Remaining = removeName(status.Remaining, server.Config.Name)
+			m.mu.Unlock()
+		case <-timer.C:
+			m.logger.Warnf("Shutdown timeout reached, killing %d servers", len(status.Remaining))
+			forced = true
+		case <-m.force:
+			m.logger.Warnf("Forced shutdown, killing %d servers", len(status.Remaining))
+			forced = true
+		}
+	}
+
+	if forced {
+		m.mu.Lock()
+		status.Phase = ShutdownForced
+		m.mu.Unlock()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, name := range m.runningByPriority() {
+		m.stopServer(name)
+	}
+	status.Remaining = nil
+	status.Phase = ShutdownCompleted
+	m.logger.Info("All servers stopped")
+}
+
+func removeName(names []string, name string) []string {
+	for i, candidate := range names {
+		if candidate == name {
+			return append(names[:i:i], names[i+1:]...)
+		}
+	}
+	return names
+}
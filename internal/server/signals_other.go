@@ -0,0 +1,26 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errSignalsUnsupported = errors.New("process signals are not supported on this platform")
+
+// suspendProcess is only implemented on Unix systems
+func suspendProcess(process *os.Process) error {
+	return errSignalsUnsupported
+}
+
+// continueProcess is only implemented on Unix systems
+func continueProcess(process *os.Process) error {
+	return errSignalsUnsupported
+}
+
+// signalPid is only implemented on Unix systems
+func signalPid(pid int, signal syscall.Signal) error {
+	return errSignalsUnsupported
+}
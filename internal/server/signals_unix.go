@@ -0,0 +1,24 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// suspendProcess stops a process with SIGSTOP until continueProcess
+func suspendProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGSTOP)
+}
+
+// continueProcess continues a process stopped by suspendProcess
+func continueProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGCONT)
+}
+
+// signalPid sends a signal to the process with the given pid, which the
+// manager did not start itself
+func signalPid(pid int, signal syscall.Signal) error {
+	return syscall.Kill(pid, signal)
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/metrics"
+)
+
+// sloWindows are the rolling windows apply SLOs are reported for; the
+// longest one bounds the applies kept in memory
+var sloWindows = []struct {
+	name   string
+	length time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// applyTiming is when a commit was made and when applying it began
+type applyTiming struct {
+	committed time.Time
+	started   time.Time
+}
+
+// ApplySLO reports the applies of one rolling window
+type ApplySLO struct {
+	Window    string `json:"window"`
+	Applies   int    `json:"applies"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Rejected  int    `json:"rejected"`
+	// SuccessRate is the share of applies that succeeded, rejected commits
+	// included; 1 without applies
+	SuccessRate    float64 `json:"success_rate"`
+	LeadTimeP50    float64 `json:"lead_time_p50_seconds"`
+	LeadTimeP95    float64 `json:"lead_time_p95_seconds"`
+	DurationP50    float64 `json:"duration_p50_seconds"`
+	DurationP95    float64 `json:"duration_p95_seconds"`
+	ServersChanged int     `json:"servers_changed"`
+}
+
+// ApplySLOReport is the apply SLO of every window and the last apply
+type ApplySLOReport struct {
+	Windows []ApplySLO   `json:"windows"`
+	Last    *audit.Apply `json:"last,omitempty"`
+}
+
+// loadApplyOutcomes reads the applies of the longest SLO window from the
+// apply log
+func (m *Manager) loadApplyOutcomes(now time.Time) error {
+	applies, err := m.applyLog.Since(now.Add(-sloWindows[len(sloWindows)-1].length))
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.applyOutcomes = append(applies, m.applyOutcomes...)
+	m.mu.Unlock()
+	return nil
+}
+
+// commitTime looks up when a commit was made for its lead time. Failing
+// to do so only leaves the lead time out.
+func (m *Manager) commitTime(commitSHA string) time.Time {
+	committed, err := m.sources.CommitTime(commitSHA)
+	if err != nil {
+		m.logger.Warnf("Failed to get the time of commit %s, its lead time is not recorded: %v", commitSHA[:8], err)
+	}
+	return committed
+}
+
+// recordApplyOutcome appends the result of an apply to the apply log and
+// the SLO windows. actions are all actions of the apply; failure is the
+// error of a halted rollout or a rejected commit.
+// The caller must hold m.mu.
+func (m *Manager) recordApplyOutcome(commitSHA, result string, timing applyTiming, actions []ServerAction, failure string) {
+	now := time.Now()
+	apply := audit.Apply{
+		Time:            now,
+		Commit:          commitSHA,
+		Result:          result,
+		CommittedAt:     timing.committed,
+		StartedAt:       timing.started,
+		DurationSeconds: now.Sub(timing.started).Seconds(),
+		Error:           failure,
+	}
+	if !timing.committed.IsZero() {
+		apply.LeadTimeSeconds = max(now.Sub(timing.committed).Seconds(), 0)
+	}
+	for _, action := range actions {
+		if action.Error != "" {
+			apply.Failed++
+			continue
+		}
+		switch action.Action {
+		case ActionStarted:
+			apply.Started++
+		case ActionRestarted:
+			apply.Restarted++
+		case ActionStopped:
+			apply.Stopped++
+		}
+	}
+	if apply.Result == audit.ApplyFailed && apply.Error == "" {
+		apply.Error = summarizeActions(failedActions(actions))
+	}
+
+	m.applyOutcomes = append(m.applyOutcomes, apply)
+	cutoff := now.Add(-sloWindows[len(sloWindows)-1].length)
+	for len(m.applyOutcomes) > 0 && m.applyOutcomes[0].Time.Before(cutoff) {
+		m.applyOutcomes = m.applyOutcomes[1:]
+	}
+
+	if err := m.applyLog.Record(apply); err != nil {
+		m.logger.Errorf("Failed to record apply of %s: %v", commitSHA[:8], err)
+	}
+}
+
+// applyActions returns the actions recorded for the apply of a commit,
+// including the restarts of its rollout.
+// The caller must hold m.mu.
+func (m *Manager) applyActions(commitSHA string) []ServerAction {
+	for i := len(m.applies) - 1; i >= 0; i-- {
+		if m.applies[i].CommitSHA == commitSHA {
+			return m.applies[i].Actions
+		}
+	}
+	return nil
+}
+
+// GetApplySLO reports the success rate, lead time and duration of the
+// applies in each rolling window
+func (m *Manager) GetApplySLO() ApplySLOReport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	report := ApplySLOReport{Windows: m.applySLOs(time.Now())}
+	if n := len(m.applyOutcomes); n > 0 {
+		last := m.applyOutcomes[n-1]
+		report.Last = &last
+	}
+	return report
+}
+
+// applySLOs summarizes the applies of every window.
+// The caller must hold m.mu.
+func (m *Manager) applySLOs(now time.Time) []ApplySLO {
+	slos := make([]ApplySLO, 0, len(sloWindows))
+	for _, window := range sloWindows {
+		slo := ApplySLO{Window: window.name, SuccessRate: 1}
+		var leadTimes, durations []float64
+		for _, apply := range m.applyOutcomes {
+			if apply.Time.Before(now.Add(-window.length)) {
+				continue
+			}
+			slo.Applies++
+			slo.ServersChanged += apply.Changed()
+			switch apply.Result {
+			case audit.ApplySucceeded:
+				slo.Succeeded++
+			case audit.ApplyFailed:
+				slo.Failed++
+			case audit.ApplyRejected:
+				slo.Rejected++
+				continue
+			}
+			durations = append(durations, apply.DurationSeconds)
+			if apply.LeadTimeSeconds > 0 {
+				leadTimes = append(leadTimes, apply.LeadTimeSeconds)
+			}
+		}
+		if slo.Applies > 0 {
+			slo.SuccessRate = float64(slo.Succeeded) / float64(slo.Applies)
+		}
+		slo.LeadTimeP50, slo.LeadTimeP95 = percentile(leadTimes, 0.5), percentile(leadTimes, 0.95)
+		slo.DurationP50, slo.DurationP95 = percentile(durations, 0.5), percentile(durations, 0.95)
+		slos = append(slos, slo)
+	}
+	return slos
+}
+
+// applyMetrics reports the last apply that was not rejected and the
+// success rate of each window.
+// The caller must hold m.mu.
+func (m *Manager) applyMetrics() []metrics.Metric {
+	var samples []metrics.Metric
+	for i := len(m.applyOutcomes) - 1; i >= 0; i-- {
+		last := m.applyOutcomes[i]
+		if last.Result == audit.ApplyRejected {
+			continue
+		}
+		samples = append(samples,
+			metrics.Metric{Name: "config_apply_duration_seconds", Help: "Duration of the last apply, including its rollout.", Kind: metrics.Gauge, Value: last.DurationSeconds},
+			metrics.Metric{Name: "config_apply_lead_time_seconds", Help: "Time from commit to live of the last apply.", Kind: metrics.Gauge, Value: last.LeadTimeSeconds},
+			metrics.Metric{Name: "config_apply_servers_changed", Help: "Servers started, restarted or stopped by the last apply.", Kind: metrics.Gauge, Value: float64(last.Changed())},
+			metrics.Metric{Name: "config_apply_timestamp_seconds", Help: "Unix time the last apply finished.", Kind: metrics.Gauge, Value: float64(last.Time.Unix())},
+		)
+		break
+	}
+	for _, slo := range m.applySLOs(time.Now()) {
+		labels := map[string]string{"window": slo.Window}
+		samples = append(samples,
+			metrics.Metric{Name: "config_apply_success_ratio", Help: "Share of applies that succeeded in the window.", Kind: metrics.Gauge, Labels: labels, Value: slo.SuccessRate},
+			metrics.Metric{Name: "config_apply_lead_time_p95_seconds", Help: "95th percentile time from commit to live in the window.", Kind: metrics.Gauge, Labels: labels, Value: slo.LeadTimeP95},
+		)
+	}
+	return samples
+}
+
+// percentile returns the nearest-rank percentile of values, 0 without any
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"minecraft-server-manager/internal/metrics"
+)
+
+// snapshotInterval is how often the status snapshot is refreshed besides
+// the status changes and applies that publish it right away
+const snapshotInterval = 5 * time.Second
+
+// statusSnapshot is the status and metric set as of its LastUpdate. It is
+// never modified once published, so GetStatus and Metrics read it without
+// taking m.mu and do not wait for applies.
+type statusSnapshot struct {
+	status  ManagerStatus
+	metrics []metrics.Metric
+}
+
+// publishStatus replaces the status snapshot with the current state.
+// The caller must hold m.mu, for reading or writing.
+func (m *Manager) publishStatus() {
+	m.snapshot.Store(&statusSnapshot{
+		status:  m.collectStatus(),
+		metrics: m.collectMetrics(),
+	})
+}
+
+// runStatusSnapshots refreshes the status snapshot every snapshotInterval
+// until ctx is cancelled, so player counts, traffic and tick health stay
+// current between status changes
+func (m *Manager) runStatusSnapshots(ctx context.Context) {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.RLock()
+			m.publishStatus()
+			m.mu.RUnlock()
+		}
+	}
+}
+
+// GetStatus returns the last status snapshot, with uptimes as of now.
+// LastUpdate is when the snapshot was taken.
+func (m *Manager) GetStatus() ManagerStatus {
+	status := m.snapshot.Load().status
+	status.Servers = append([]ServerStatus(nil), status.Servers...)
+	for i := range status.Servers {
+		status.Servers[i].Uptime = time.Since(status.Servers[i].StartTime).String()
+	}
+	return status
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/notify"
+)
+
+// Staleness describes a configuration the manager could not confirm is
+// the latest of its sources for longer than staleness.warn_minutes
+type Staleness struct {
+	// Since is when the manager last had the latest configuration
+	Since time.Time `json:"since"`
+	Error string    `json:"error,omitempty"`
+
+	// SafeMode is set while the manager makes no changes of its own;
+	// SafeModeAt is when it will with the safe-mode policy
+	SafeMode   bool       `json:"safe_mode"`
+	SafeModeAt *time.Time `json:"safe_mode_at,omitempty"`
+}
+
+// checkStaleness reports when the configuration becomes stale and fresh
+// again, and enters and leaves safe mode following the staleness policy
+func (m *Manager) checkStaleness(now time.Time) {
+	cfg := m.config.Staleness
+	staleFor := m.configStaleness(now)
+	m.pollMu.Lock()
+	pollError := m.pollError
+	m.pollMu.Unlock()
+
+	stale := staleFor >= time.Duration(cfg.WarnMinutes)*time.Minute
+	safeMode := stale && cfg.Policy == config.StalenessSafeMode && staleFor >= time.Duration(cfg.SafeModeHours)*time.Hour
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	since := now.Add(-staleFor).Format(time.RFC3339)
+	switch {
+	case stale && !m.stale:
+		m.logger.Warnf("Configuration is stale, the sources could not be read since %s: %s", since, pollError)
+		m.events.Publish(events.ConfigStale, "", map[string]interface{}{"since": since, "error": pollError})
+		go m.notifier.Notify(notify.Notification{
+			Event:    config.NotifyConfigStale,
+			Title:    "Configuration is stale",
+			Message:  fmt.Sprintf("The configuration sources could not be read since %s: %s", since, pollError),
+			Severity: notify.SeverityWarning,
+			Fields:   map[string]string{"since": since, "error": pollError},
+		})
+	case !stale && m.stale:
+		m.logger.Infof("Configuration is current again")
+		m.events.Publish(events.ConfigFresh, "", map[string]interface{}{"safe_mode": m.safeMode})
+		go m.notifier.Notify(notify.Notification{
+			Event:    config.NotifyConfigStale,
+			Title:    "Configuration is current again",
+			Message:  "The configuration sources can be read again.",
+			Severity: notify.SeverityInfo,
+		})
+	}
+	if safeMode && !m.safeMode {
+		m.logger.Warnf("Entering safe mode, the configuration is stale since %s: servers are only restarted after crashes", since)
+		m.events.Publish(events.ConfigStale, "", map[string]interface{}{"since": since, "error": pollError, "safe_mode": true})
+		go m.notifier.Notify(notify.Notification{
+			Event:    config.NotifyConfigStale,
+			Title:    "Manager entered safe mode",
+			Message:  fmt.Sprintf("The configuration is stale since %s, the manager makes no changes of its own until it is current again: %s", since, pollError),
+			Severity: notify.SeverityCritical,
+			Fields:   map[string]string{"since": since, "error": pollError, "safe_mode": "true"},
+		})
+	}
+	if stale != m.stale || safeMode != m.safeMode {
+		m.stale, m.safeMode = stale, safeMode
+		m.publishStatus()
+	}
+}
+
+// stalenessStatus describes a stale configuration, nil while it is
+// current.
+// The caller must hold m.mu.
+func (m *Manager) stalenessStatus(now time.Time) *Staleness {
+	if !m.stale {
+		return nil
+	}
+	m.pollMu.Lock()
+	staleness := &Staleness{Error: m.pollError, SafeMode: m.safeMode}
+	m.pollMu.Unlock()
+	staleness.Since = now.Add(-m.configStaleness(now))
+
+	if cfg := m.config.Staleness; cfg.Policy == config.StalenessSafeMode && !m.safeMode {
+		at := staleness.Since.Add(time.Duration(cfg.SafeModeHours) * time.Hour)
+		staleness.SafeModeAt = &at
+	}
+	return staleness
+}
+
+// paused reports whether the manager makes no changes of its own, because
+// it is frozen or in safe mode.
+// The caller must hold m.mu.
+func (m *Manager) paused() bool {
+	return m.freeze != nil || m.safeMode
+}
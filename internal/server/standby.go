@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+)
+
+// defaultStandbySync is how often the standby world of a server is synced
+// without standby_sync_minutes
+const defaultStandbySync = 15 * time.Minute
+
+// keptCrashedWorlds is how many worlds of failed over servers are kept for
+// investigation
+const keptCrashedWorlds = 3
+
+// standbyDir is where the standby copy of a server's world is kept
+func (m *Manager) standbyDir(name string) string {
+	return filepath.Join(m.config.GetServerDir(name), "standby")
+}
+
+// standbyInterval returns how often the standby world of a server is synced
+func standbyInterval(serverConfig *config.MinecraftServerConfig) time.Duration {
+	if serverConfig.StandbySyncMinutes > 0 {
+		return time.Duration(serverConfig.StandbySyncMinutes) * time.Minute
+	}
+	return defaultStandbySync
+}
+
+// syncStandbys starts syncing the standby world of every running server
+// with a standby whose copy is due
+func (m *Manager) syncStandbys(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, server := range m.servers {
+		if !server.Config.Standby || server.Status != "running" || server.hold != nil || server.Stdin == nil {
+			continue
+		}
+		if now.Sub(server.standbySynced) < standbyInterval(server.Config) {
+			continue
+		}
+		server.standbySynced = now
+		go m.syncStandby(server)
+	}
+}
+
+// syncStandby copies the world of a running server into its standby
+// directory while saving is on hold, replacing the previous copy once the
+// new one is complete
+func (m *Manager) syncStandby(server *MinecraftServer) {
+	name := server.Config.Name
+	files, err := m.holdSaves(server)
+	if err != nil {
+		m.logger.Errorf("Failed to sync standby world of %s: %v", name, err)
+		return
+	}
+
+	standbyDir := m.standbyDir(name)
+	stagingDir := standbyDir + ".sync"
+	err = os.RemoveAll(stagingDir)
+	if err == nil {
+		err = copyHeldFiles(filepath.Join(m.config.GetServerDir(name), "worlds"), files, stagingDir, nil)
+	}
+	m.resumeSaves(server)
+	if err == nil {
+		if err = os.RemoveAll(standbyDir); err == nil {
+			err = os.Rename(stagingDir, standbyDir)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		m.logger.Errorf("Failed to sync standby world of %s: %v", name, err)
+		return
+	}
+	m.logger.Debugf("Synced standby world of %s (%d files)", name, len(files))
+}
+
+// failover starts a crashed server with a standby on its standby world
+// right away and reports whether it did. The crashed world is kept under
+// crashed/ in the server directory for investigation.
+// The caller must hold m.mu.
+func (m *Manager) failover(server *MinecraftServer) bool {
+	name := server.Config.Name
+	serverConfig := server.Config
+	if !serverConfig.Standby || m.shutdownStatus != nil || server.crash.Reason == CrashPortInUse {
+		return false
+	}
+	standbyWorld := filepath.Join(m.standbyDir(name), serverConfig.WorldName)
+	if _, err := os.Stat(standbyWorld); err != nil {
+		m.logger.Warnf("Server %s has no standby world to fail over to yet", name)
+		return false
+	}
+	if err := checkWorld(standbyWorld, false); err != nil {
+		m.logger.Errorf("Not failing over server %s, its standby world is damaged: %v", name, err)
+		return false
+	}
+
+	crashedDir := filepath.Join(m.config.GetServerDir(name), "crashed")
+	crashedWorld := filepath.Join(crashedDir, fmt.Sprintf("%s-%s", serverConfig.WorldName, time.Now().Format("20060102-150405")))
+	if err := os.MkdirAll(crashedDir, 0755); err != nil {
+		m.logger.Errorf("Failed to fail over server %s: %v", name, err)
+		return false
+	}
+	worldDir := m.config.GetWorldDir(name, serverConfig.WorldName)
+	if err := os.Rename(worldDir, crashedWorld); err != nil {
+		m.logger.Errorf("Failed to fail over server %s: %v", name, err)
+		return false
+	}
+	if err := os.Rename(standbyWorld, worldDir); err != nil {
+		m.logger.Errorf("Failed to fail over server %s: %v", name, err)
+		os.Rename(crashedWorld, worldDir)
+		return false
+	}
+	m.pruneCrashedWorlds(crashedDir)
+
+	m.logger.Warnf("Failing over server %s to its standby world, the crashed world is kept in %s", name, crashedWorld)
+	m.stopServer(name)
+	if err := m.startServer(serverConfig); err != nil {
+		m.logger.Errorf("Failed to start server %s on its standby world: %v", name, err)
+		return true
+	}
+	m.servers[name].failedOver = true
+	return true
+}
+
+// pruneCrashedWorlds removes all but the most recent crashed worlds
+func (m *Manager) pruneCrashedWorlds(crashedDir string) {
+	entries, err := os.ReadDir(crashedDir)
+	if err != nil {
+		return
+	}
+	// Names end in the crash time, newest last
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries[:max(len(entries)-keptCrashedWorlds, 0)] {
+		if err := os.RemoveAll(filepath.Join(crashedDir, entry.Name())); err != nil {
+			m.logger.Warnf("Failed to remove crashed world %s: %v", entry.Name(), err)
+		}
+	}
+}
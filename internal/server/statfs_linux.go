@@ -0,0 +1,31 @@
+package server
+
+import "syscall"
+
+// freeSpace returns the disk space available to unprivileged users on the
+// filesystem of path
+func freeSpace(path string) (uint64, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+	return uint64(fs.Bavail) * uint64(fs.Bsize), nil
+}
+
+// filesystemType returns the magic number of the filesystem of path
+func filesystemType(path string) (uint32, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, err
+	}
+	return uint32(fs.Type), nil
+}
+
+// fileInode returns the inode number of path
+func fileInode(path string) (uint64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Ino, nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package server
+
+import "errors"
+
+var errStatfsUnsupported = errors.New("filesystem information is not supported on this platform")
+
+// freeSpace is only implemented on Linux
+func freeSpace(path string) (uint64, error) {
+	return 0, errStatfsUnsupported
+}
+
+// filesystemType is only implemented on Linux
+func filesystemType(path string) (uint32, error) {
+	return 0, errStatfsUnsupported
+}
+
+// fileInode is only implemented on Linux
+func fileInode(path string) (uint64, error) {
+	return 0, errStatfsUnsupported
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/telegram"
+)
+
+// telegramPollWait is how long one poll for bot commands waits for a
+// message
+const telegramPollWait = 30 * time.Second
+
+// telegramHelp answers /help and /start
+const telegramHelp = `/status - list the servers
+/restart <server> - restart a server (admins only)`
+
+// runTelegramBot answers the commands sent to the Telegram bot until ctx is
+// done
+func (m *Manager) runTelegramBot(ctx context.Context) {
+	bot := m.config.Telegram
+	client := telegram.NewClient(bot.Token)
+	m.logger.Info("Answering Telegram bot commands")
+
+	var offset int64
+	for ctx.Err() == nil {
+		updates, err := client.Updates(ctx, offset, telegramPollWait)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			m.logger.Warnf("Failed to receive Telegram commands: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+		for _, update := range updates {
+			offset = max(offset, update.UpdateID+1)
+			if update.Message == nil || update.Message.From == nil {
+				continue
+			}
+			reply := m.telegramCommand(update.Message)
+			if reply == "" {
+				continue
+			}
+			sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := client.SendMessage(sendCtx, update.Message.Chat.ID, reply); err != nil {
+				m.logger.Warnf("Failed to answer Telegram command: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// telegramCommand carries out a bot command and returns the reply. Messages
+// from outside the configured chats and admins are ignored.
+func (m *Manager) telegramCommand(message *telegram.Message) string {
+	bot := m.config.Telegram
+	admin := slices.Contains(bot.AdminIDs, message.From.ID)
+	if !admin && !slices.Contains(bot.ChatIDs, message.Chat.ID) {
+		return ""
+	}
+	command, args, ok := telegram.Command(message.Text)
+	if !ok {
+		return ""
+	}
+
+	switch command {
+	case "/start", "/help":
+		return telegramHelp
+	case "/status":
+		return m.telegramStatus()
+	case "/restart":
+		if !admin {
+			return "Only admins may restart servers."
+		}
+		if len(args) != 1 {
+			return "Usage: /restart <server>"
+		}
+		m.logger.Infof("Restart of %s requested by Telegram user %d (%s)", args[0], message.From.ID, message.From.Username)
+		if err := m.RestartServer(args[0]); err != nil {
+			return fmt.Sprintf("Failed to restart %s: %v", args[0], err)
+		}
+		return fmt.Sprintf("Restarted %s.", args[0])
+	default:
+		return "Unknown command.\n\n" + telegramHelp
+	}
+}
+
+// telegramStatus describes the servers in one line each
+func (m *Manager) telegramStatus() string {
+	status := m.GetStatus()
+	if len(status.Servers) == 0 {
+		return "No servers are managed."
+	}
+	var text strings.Builder
+	fmt.Fprintf(&text, "%d running, %d stopped\n", status.Running, status.Stopped)
+	for _, server := range status.Servers {
+		fmt.Fprintf(&text, "\n%s: %s", server.Name, server.Status)
+		if server.Status == "running" {
+			fmt.Fprintf(&text, ", %d players, up %s", server.PlayerCount, shortDuration(time.Since(server.StartTime)))
+		}
+	}
+	if status.ConfigError != "" {
+		fmt.Fprintf(&text, "\n\nConfiguration rejected: %s", status.ConfigError)
+	}
+	return text.String()
+}
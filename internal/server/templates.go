@@ -0,0 +1,267 @@
+package server
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/mirror"
+)
+
+// prewarmConcurrency is how many world templates are downloaded at once
+// before an apply
+const prewarmConcurrency = 4
+
+// ResetWorld replaces the world of a server with a fresh copy of its
+// configured world template. The template is downloaded and extracted
+// while the server keeps running; only the swap stops it.
+func (m *Manager) ResetWorld(name string) error {
+	m.mu.RLock()
+	serverConfig := m.findServerConfig(name)
+	var template config.WorldTemplate
+	var exists bool
+	if serverConfig != nil && m.lastConfig != nil {
+		template, exists = m.lastConfig.WorldTemplates[serverConfig.WorldTemplate]
+	}
+	m.mu.RUnlock()
+	switch {
+	case serverConfig == nil:
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	case serverConfig.WorldTemplate == "":
+		return fmt.Errorf("server %s has no world template configured", name)
+	case !exists:
+		return fmt.Errorf("world template %s not found", serverConfig.WorldTemplate)
+	}
+
+	archivePath, err := m.cacheWorldTemplate(serverConfig.WorldTemplate, template)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("invalid world template archive %s: %w", serverConfig.WorldTemplate, err)
+	}
+	defer archive.Close()
+	stagingDir, err := m.stageWorld(serverConfig, &archive.Reader, int64(m.config.Server.MaxImportMB)*1024*1024)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if serverConfig = m.findServerConfig(name); serverConfig == nil {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if server, exists := m.servers[name]; exists {
+		if err := m.checkFrozen(); err != nil {
+			return err
+		}
+		m.announce(server, config.AnnounceWorldReset, announcement{Reason: "requested by an operator"})
+	}
+	if err := m.swapWorld(serverConfig, stagingDir, "world reset"); err != nil {
+		return err
+	}
+	m.logger.Infof("Reset world for server %s from template %s", name, serverConfig.WorldTemplate)
+	m.events.Publish(events.WorldReset, name, map[string]interface{}{"reason": "api"})
+	return nil
+}
+
+// provisionWorld installs the server's world template as its world.
+// The caller must hold m.mu.
+func (m *Manager) provisionWorld(serverConfig *config.MinecraftServerConfig) error {
+	if serverConfig.WorldTemplate == "" {
+		return fmt.Errorf("server %s has no world template configured", serverConfig.Name)
+	}
+
+	archivePath, err := m.fetchWorldTemplate(serverConfig.WorldTemplate)
+	if err != nil {
+		return err
+	}
+
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("invalid world template archive %s: %w", serverConfig.WorldTemplate, err)
+	}
+	defer archive.Close()
+
+	maxBytes := int64(m.config.Server.MaxImportMB) * 1024 * 1024
+	if err := m.replaceWorld(serverConfig, &archive.Reader, maxBytes); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Provisioned world for server %s from template %s", serverConfig.Name, serverConfig.WorldTemplate)
+	return nil
+}
+
+// fetchWorldTemplate returns the path of the cached template archive,
+// downloading and verifying it first if necessary.
+// The caller must hold m.mu.
+func (m *Manager) fetchWorldTemplate(name string) (string, error) {
+	if m.lastConfig == nil {
+		return "", fmt.Errorf("world template %s not found", name)
+	}
+	template, exists := m.lastConfig.WorldTemplates[name]
+	if !exists {
+		return "", fmt.Errorf("world template %s not found", name)
+	}
+	return m.cacheWorldTemplate(name, template)
+}
+
+// cacheWorldTemplate returns the path of a template archive in the cache,
+// downloading and verifying it first if necessary. Concurrent calls for the
+// same archive download it once.
+func (m *Manager) cacheWorldTemplate(name string, template config.WorldTemplate) (string, error) {
+	if template.URL == "" {
+		return "", fmt.Errorf("world template %s has no url", name)
+	}
+	if template.SHA256 == "" {
+		return "", fmt.Errorf("world template %s has no sha256 checksum", name)
+	}
+
+	checksum := strings.ToLower(template.SHA256)
+	templatesDir := filepath.Join(m.config.Server.CacheDir, "templates")
+	cachedPath := filepath.Join(templatesDir, fmt.Sprintf("%s-%s.zip", name, checksum))
+
+	// Cached archives are named by checksum, so an existing file is valid
+	if _, err := os.Stat(cachedPath); err == nil {
+		return cachedPath, nil
+	}
+	lock, _ := m.downloads.LoadOrStore(cachedPath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	if _, err := os.Stat(cachedPath); err == nil {
+		return cachedPath, nil
+	}
+
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create template cache directory: %w", err)
+	}
+
+	if err := m.fetchArtifact(mirror.Template(checksum), template.URL, cachedPath, checksum); err != nil {
+		return "", fmt.Errorf("failed to download world template %s: %w", name, err)
+	}
+
+	return cachedPath, nil
+}
+
+// prewarmTemplates downloads the world templates used by the servers of a
+// configuration that are not cached yet, prewarmConcurrency at a time, so
+// that starting the servers does not wait for them one after another while
+// holding m.mu. Failures are logged, the start downloads the template again.
+func (m *Manager) prewarmTemplates(repoConfig *config.RepoConfig) {
+	names := make(map[string]bool)
+	for _, serverConfig := range repoConfig.Servers {
+		if serverConfig.WorldTemplate != "" {
+			names[serverConfig.WorldTemplate] = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, prewarmConcurrency)
+	for name := range names {
+		template, exists := repoConfig.WorldTemplates[name]
+		if !exists {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, template config.WorldTemplate) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if _, err := m.cacheWorldTemplate(name, template); err != nil {
+				m.logger.Warnf("Failed to pre-download world template %s: %v", name, err)
+			}
+		}(name, template)
+	}
+	wg.Wait()
+}
+
+// fetchArtifact downloads an artifact to destPath, from the mirror when
+// one is configured and otherwise from url. With mirror.fallback,
+// artifacts the mirror does not have are downloaded from url as well. An
+// empty checksum skips verification.
+func (m *Manager) fetchArtifact(artifact mirror.Artifact, url, destPath, checksum string) error {
+	if m.mirror != nil {
+		m.logger.Infof("Downloading %s from %s", artifact, m.mirror.Location(artifact))
+		err := saveFile(destPath, checksum, func(w io.Writer) error {
+			return m.mirror.Fetch(context.Background(), artifact, w)
+		})
+		if !errors.Is(err, mirror.ErrNotFound) || !m.config.Mirror.Fallback {
+			return err
+		}
+		m.logger.Warnf("Mirror has no %s, falling back to its original location", artifact)
+	}
+	m.logger.Infof("Downloading %s from %s", artifact, url)
+	return downloadFile(url, destPath, checksum)
+}
+
+// downloadFile fetches url into destPath, verifying its SHA256 checksum
+// before the file is moved into place. file:// URLs are copied from the
+// local filesystem, which works without internet access.
+func downloadFile(url, destPath, checksum string) error {
+	return saveFile(destPath, checksum, func(w io.Writer) error {
+		if path, local := strings.CutPrefix(url, "file://"); local {
+			source, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer source.Close()
+			_, err = io.Copy(w, source)
+			return err
+		}
+
+		client := &http.Client{Timeout: 10 * time.Minute}
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		_, err = io.Copy(w, resp.Body)
+		return err
+	})
+}
+
+// saveFile writes the output of write to destPath through a temporary
+// file, which is moved into place once its SHA256 checksum matches unless
+// the checksum is empty
+func saveFile(destPath, checksum string, write func(io.Writer) error) error {
+	tmpPath := destPath + ".download"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	hash := sha256.New()
+	if err := write(io.MultiWriter(file, hash)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if checksum != "" && actual != checksum {
+		return fmt.Errorf("checksum mismatch (expected: %s, got: %s)", checksum, actual)
+	}
+
+	return os.Rename(tmpPath, destPath)
+}
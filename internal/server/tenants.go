@@ -0,0 +1,205 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/notify"
+)
+
+// diskInterval is how often the disk usage of servers and tenants is
+// measured between applies, in minutes
+const diskInterval = 10
+
+// TenantStatus is the usage of a tenant against its quota. Zero quotas are
+// unlimited.
+type TenantStatus struct {
+	Name         string    `json:"name"`
+	Servers      int       `json:"servers"`
+	Running      int       `json:"running"`
+	MaxInstances int       `json:"max_instances,omitempty"`
+	Memory       int64     `json:"memory_bytes"`
+	MemoryQuota  int64     `json:"memory_quota_bytes,omitempty"`
+	Disk         int64     `json:"disk_bytes"`
+	DiskQuota    int64     `json:"disk_quota_bytes,omitempty"`
+	DiskMeasured time.Time `json:"disk_measured,omitempty"`
+}
+
+// tenantLimits is a tenant quota with parsed sizes
+type tenantLimits struct {
+	instances int
+	memory    int64
+	disk      int64
+}
+
+// tenantLimits returns the quota of a tenant and whether it is configured
+func (m *Manager) tenantLimits(tenant string) (tenantLimits, bool) {
+	quota, exists := m.config.Tenants[tenant]
+	if !exists {
+		return tenantLimits{}, false
+	}
+	memory, _ := config.ParseMemory(quota.Memory)
+	disk, _ := config.ParseMemory(quota.Disk)
+	return tenantLimits{instances: quota.MaxInstances, memory: memory, disk: disk}, true
+}
+
+// tenantDirs returns the directories of the configured servers by tenant.
+// The caller must hold m.mu.
+func (m *Manager) tenantDirs(servers []config.MinecraftServerConfig) map[string][]string {
+	dirs := make(map[string][]string)
+	for _, serverConfig := range servers {
+		if serverConfig.Tenant != "" {
+			dirs[serverConfig.Tenant] = append(dirs[serverConfig.Tenant], m.config.GetServerDir(serverConfig.Name))
+		}
+	}
+	return dirs
+}
+
+// measureDisk sums the size of the files in the directories of each tenant
+func measureDisk(dirs map[string][]string) map[string]int64 {
+	usage := make(map[string]int64, len(dirs))
+	for tenant, tenantDirs := range dirs {
+		for _, dir := range tenantDirs {
+			filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					usage[tenant] += info.Size()
+				}
+				return nil
+			})
+		}
+	}
+	return usage
+}
+
+// refreshTenantDisk measures the disk usage of the tenants of a
+// configuration before it is applied, unless the last measurement is
+// recent. The directories are walked without holding m.mu.
+func (m *Manager) refreshTenantDisk(servers []config.MinecraftServerConfig) {
+	m.mu.RLock()
+	if len(m.config.Tenants) == 0 || time.Since(m.tenantDiskMeasured) < diskInterval*time.Minute {
+		m.mu.RUnlock()
+		return
+	}
+	dirs := m.tenantDirs(servers)
+	m.mu.RUnlock()
+
+	usage := measureDisk(dirs)
+
+	m.mu.Lock()
+	m.tenantDisk, m.tenantDiskMeasured = usage, time.Now()
+	m.mu.Unlock()
+}
+
+// measureStorage measures the disk usage of every configured server and
+// sums it per tenant
+func (m *Manager) measureStorage() {
+	m.mu.RLock()
+	if m.lastConfig == nil {
+		m.mu.RUnlock()
+		return
+	}
+	dirs := make(map[string][]string, len(m.lastConfig.Servers))
+	tenants := make(map[string]string, len(m.lastConfig.Servers))
+	for _, serverConfig := range m.lastConfig.Servers {
+		dirs[serverConfig.Name] = []string{m.config.GetServerDir(serverConfig.Name)}
+		tenants[serverConfig.Name] = serverConfig.Tenant
+	}
+	m.mu.RUnlock()
+
+	perServer := measureDisk(dirs)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.serverDisk = perServer
+	if len(m.config.Tenants) == 0 {
+		return
+	}
+	perTenant := make(map[string]int64)
+	for name, size := range perServer {
+		if tenant := tenants[name]; tenant != "" {
+			perTenant[tenant] += size
+		}
+	}
+	m.tenantDisk, m.tenantDiskMeasured = perTenant, time.Now()
+	m.checkTenantDisk()
+}
+
+// checkTenantDisk notifies once when a tenant goes over its disk quota.
+// Servers of a tenant over quota keep running, new ones are not started
+// until usage drops.
+// The caller must hold m.mu.
+func (m *Manager) checkTenantDisk() {
+	for tenant := range m.config.Tenants {
+		limits, _ := m.tenantLimits(tenant)
+		used := m.tenantDisk[tenant]
+		over := limits.disk > 0 && used > limits.disk
+		if over == m.tenantOverDisk[tenant] {
+			continue
+		}
+		m.tenantOverDisk[tenant] = over
+		if !over {
+			m.logger.Infof("Tenant %s is back within its disk quota", tenant)
+			continue
+		}
+		m.logger.Warnf("Tenant %s exceeds its disk quota (%d of %d bytes)", tenant, used, limits.disk)
+		m.notifier.Notify(notify.Notification{
+			Event:    config.NotifyTenantDisk,
+			Title:    fmt.Sprintf("Tenant %s exceeds its disk quota", tenant),
+			Message:  fmt.Sprintf("The servers of tenant %s use %d of %d bytes; new servers of the tenant are not started", tenant, used, limits.disk),
+			Severity: notify.SeverityWarning,
+			Tenant:   tenant,
+			Fields:   map[string]string{"tenant": tenant},
+		})
+	}
+}
+
+// tenantStatuses reports the usage of every configured tenant.
+// The caller must hold m.mu.
+func (m *Manager) tenantStatuses() []TenantStatus {
+	if len(m.config.Tenants) == 0 {
+		return nil
+	}
+	byName := make(map[string]*TenantStatus)
+	names := make([]string, 0, len(m.config.Tenants))
+	for tenant := range m.config.Tenants {
+		limits, _ := m.tenantLimits(tenant)
+		byName[tenant] = &TenantStatus{
+			Name:         tenant,
+			MaxInstances: limits.instances,
+			MemoryQuota:  limits.memory,
+			Disk:         m.tenantDisk[tenant],
+			DiskQuota:    limits.disk,
+			DiskMeasured: m.tenantDiskMeasured,
+		}
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+
+	if m.lastConfig != nil {
+		for _, serverConfig := range m.lastConfig.Servers {
+			if status, exists := byName[serverConfig.Tenant]; exists {
+				status.Servers++
+			}
+		}
+	}
+	for _, server := range m.servers {
+		status, exists := byName[server.Config.Tenant]
+		if !exists {
+			continue
+		}
+		status.Memory += m.serverMemory(server.Config)
+		if server.Status == "running" {
+			status.Running++
+		}
+	}
+
+	statuses := make([]TenantStatus, 0, len(names))
+	for _, name := range names {
+		statuses = append(statuses, *byName[name])
+	}
+	return statuses
+}
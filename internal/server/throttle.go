@@ -0,0 +1,81 @@
+package server
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+// throttleChunk is the most a throttled writer writes at once
+const throttleChunk = 64 << 10
+
+// rateLimiter spreads writes over time to keep to a rate in bytes per
+// second
+type rateLimiter struct {
+	rate    int64
+	start   time.Time
+	written int64
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{rate: bytesPerSecond, start: time.Now()}
+}
+
+// wait accounts for n bytes written and sleeps until they are within the
+// rate
+func (l *rateLimiter) wait(n int) {
+	l.written += int64(n)
+	due := time.Duration(float64(l.written) / float64(l.rate) * float64(time.Second))
+	if ahead := due - time.Since(l.start); ahead > 0 {
+		time.Sleep(ahead)
+	}
+}
+
+// throttledWriter writes through a rate limiter
+type throttledWriter struct {
+	w     io.Writer
+	limit *rateLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n, err := t.w.Write(p[:min(len(p), throttleChunk)])
+		written += n
+		t.limit.wait(n)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// backupRateLimiter returns a limiter for the copies of a backup or
+// restore, or nil without backups.max_mb_per_second
+func (m *Manager) backupRateLimiter() *rateLimiter {
+	if m.config.Backups.MaxMBPerSecond == 0 {
+		return nil
+	}
+	return newRateLimiter(int64(m.config.Backups.MaxMBPerSecond) << 20)
+}
+
+// backupIO runs the file copies of a backup or restore, in the idle I/O
+// scheduling class with backups.ionice so that the servers' own disk access
+// goes first
+func (m *Manager) backupIO(run func() error) error {
+	if !m.config.Backups.IONice {
+		return run()
+	}
+	result := make(chan error, 1)
+	go func() {
+		// The thread is never unlocked, so it exits with the goroutine
+		// instead of running other goroutines in the idle class
+		runtime.LockOSThread()
+		if err := setIdleIOPriority(); err != nil {
+			m.logger.Warnf("Failed to lower I/O priority of backup: %v", err)
+		}
+		result <- run()
+	}()
+	return <-result
+}
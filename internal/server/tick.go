@@ -0,0 +1,94 @@
+package server
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Bedrock runs at 20 ticks per second. Below degradedTPS, or when the
+// console takes longer than degradedLatency to answer, a server is reported
+// as degraded.
+const (
+	targetTPS       = 20
+	degradedTPS     = 18
+	degradedLatency = time.Second
+)
+
+// gametimePattern matches the answer to "time query gametime"
+var gametimePattern = regexp.MustCompile(`Time is (\d+)`)
+
+// TickHealth estimates how well a server keeps up with its tick rate. TPS
+// is derived from the game time advancing between two probes, Latency is the
+// console round trip of the last probe.
+type TickHealth struct {
+	TPS        float64   `json:"tps"`
+	Latency    string    `json:"latency"`
+	Degraded   bool      `json:"degraded"`
+	MeasuredAt time.Time `json:"measured_at"`
+
+	latency time.Duration
+}
+
+// tickProbe holds the state of the periodic game time query
+type tickProbe struct {
+	sentAt    time.Time
+	lastTicks int64
+	lastAt    time.Time
+	health    *TickHealth
+}
+
+// probeTicks queries the game time of every running server
+func (m *Manager) probeTicks(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, server := range m.servers {
+		if server.Status != "running" {
+			continue
+		}
+		// An unanswered probe is itself a sign of trouble
+		if !server.tick.sentAt.IsZero() && now.Sub(server.tick.sentAt) > degradedLatency && server.tick.health != nil {
+			server.tick.health.Degraded = true
+		}
+		if err := m.sendCommand(server, "time query gametime"); err != nil {
+			continue
+		}
+		server.tick.sentAt = now
+	}
+}
+
+// handleGametime records the answer to a tick probe.
+// The caller must hold m.mu.
+func (m *Manager) handleGametime(server *MinecraftServer, line string, now time.Time) bool {
+	match := gametimePattern.FindStringSubmatch(line)
+	if match == nil || server.tick.sentAt.IsZero() {
+		return false
+	}
+	ticks, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	probe := &server.tick
+	latency := now.Sub(probe.sentAt)
+	probe.sentAt = time.Time{}
+
+	if !probe.lastAt.IsZero() && ticks > probe.lastTicks {
+		tps := float64(ticks-probe.lastTicks) / now.Sub(probe.lastAt).Seconds()
+		tps = min(tps, targetTPS)
+		degraded := tps < degradedTPS || latency > degradedLatency
+		if degraded && (probe.health == nil || !probe.health.Degraded) {
+			m.logger.Warnf("Server %s is lagging: %.1f TPS, console latency %s", server.Config.Name, tps, latency.Round(time.Millisecond))
+		}
+		probe.health = &TickHealth{
+			TPS:        float64(int(tps*10)) / 10,
+			Latency:    latency.Round(time.Millisecond).String(),
+			Degraded:   degraded,
+			MeasuredAt: now,
+			latency:    latency,
+		}
+	}
+	probe.lastTicks, probe.lastAt = ticks, now
+	return true
+}
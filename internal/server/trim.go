@@ -0,0 +1,357 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/leveldb"
+	"minecraft-server-manager/internal/nbt"
+)
+
+// playerKeepRadius is how many blocks around the last position of every
+// player a trim keeps, so that nobody logs in above the void
+const playerKeepRadius = 128
+
+// defaultTrimInterval is how often worlds are trimmed without every_days
+const defaultTrimInterval = 7 * 24 * time.Hour
+
+// lastTrimFile records the last trim in the server directory
+const lastTrimFile = "trim.json"
+
+// Dimensions of chunk keys; the nether is a eighth of the overworld's size
+const (
+	dimensionOverworld = 0
+	dimensionNether    = 1
+)
+
+// TrimResult reports a world trim
+type TrimResult struct {
+	Time          time.Time `json:"time"`
+	Archive       string    `json:"archive,omitempty"`
+	Radius        int       `json:"radius"`
+	Chunks        int       `json:"chunks"`
+	RemovedChunks int       `json:"removed_chunks"`
+	RemovedActors int       `json:"removed_actors"`
+	SizeBefore    int64     `json:"size_before"`
+	SizeAfter     int64     `json:"size_after"`
+}
+
+// chunkPos is the position of a chunk in a dimension
+type chunkPos struct {
+	x, z      int32
+	dimension int32
+}
+
+// parseChunkKey decodes the position of a chunk record: x and z, the
+// dimension unless it is the overworld, a tag and, for subchunks, their
+// index
+func parseChunkKey(key []byte) (chunkPos, bool) {
+	var pos chunkPos
+	var tag []byte
+	switch len(key) {
+	case 9, 10:
+		tag = key[8:]
+	case 13, 14:
+		pos.dimension = int32(binary.LittleEndian.Uint32(key[8:12]))
+		tag = key[12:]
+	default:
+		return pos, false
+	}
+	pos.x = int32(binary.LittleEndian.Uint32(key[0:4]))
+	pos.z = int32(binary.LittleEndian.Uint32(key[4:8]))
+
+	// 0x2f is a subchunk, followed by its index; 0x2b to 0x3f and 0x76 are
+	// the other chunk records
+	const subchunkTag = 0x2f
+	if len(tag) == 2 {
+		return pos, tag[0] == subchunkTag
+	}
+	return pos, tag[0] != subchunkTag && (tag[0] >= 0x2b && tag[0] <= 0x3f || tag[0] == 0x76)
+}
+
+// parseActorListKey decodes the chunk of a "digp" key, which lists the
+// actors stored in the chunk
+func parseActorListKey(key []byte) (chunkPos, bool) {
+	rest, found := bytes.CutPrefix(key, []byte("digp"))
+	if !found || (len(rest) != 8 && len(rest) != 12) {
+		return chunkPos{}, false
+	}
+	pos := chunkPos{
+		x: int32(binary.LittleEndian.Uint32(rest[0:4])),
+		z: int32(binary.LittleEndian.Uint32(rest[4:8])),
+	}
+	if len(rest) == 12 {
+		pos.dimension = int32(binary.LittleEndian.Uint32(rest[8:12]))
+	}
+	return pos, true
+}
+
+// worldPos is a position in a dimension, in blocks
+type worldPos struct {
+	x, z      float64
+	dimension int32
+}
+
+// playerPos reads the position of a player record
+func playerPos(value []byte) (worldPos, bool) {
+	player, err := nbt.Decode(value)
+	if err != nil {
+		return worldPos{}, false
+	}
+	tag, ok := player.Get("Pos")
+	if !ok {
+		return worldPos{}, false
+	}
+	list, ok := tag.Value.(nbt.List)
+	if !ok || len(list.Items) != 3 {
+		return worldPos{}, false
+	}
+	x, xOK := list.Items[0].(float32)
+	z, zOK := list.Items[2].(float32)
+	if !xOK || !zOK {
+		return worldPos{}, false
+	}
+	pos := worldPos{x: float64(x), z: float64(z)}
+	if dimension, ok := player.Get("DimensionId"); ok {
+		pos.dimension, _ = dimension.Value.(int32)
+	}
+	return pos, true
+}
+
+// chunkTrimmer decides which chunks of a world a trim keeps
+type chunkTrimmer struct {
+	spawn   worldPos
+	radius  float64
+	players []worldPos
+}
+
+// keep reports whether a chunk is within the radius around the spawn or
+// near a player. Only the overworld and the nether are trimmed.
+func (t *chunkTrimmer) keep(pos chunkPos) bool {
+	if pos.dimension != dimensionOverworld && pos.dimension != dimensionNether {
+		return true
+	}
+	center := worldPos{x: float64(pos.x)*16 + 8, z: float64(pos.z)*16 + 8, dimension: pos.dimension}
+
+	spawn, radius := t.spawn, t.radius
+	if pos.dimension == dimensionNether {
+		spawn.x, spawn.z, radius = spawn.x/8, spawn.z/8, radius/8
+	}
+	if within(center, spawn, radius) {
+		return true
+	}
+	for _, player := range t.players {
+		if player.dimension == pos.dimension && within(center, player, playerKeepRadius) {
+			return true
+		}
+	}
+	return false
+}
+
+func within(a, b worldPos, radius float64) bool {
+	dx, dz := a.x-b.x, a.z-b.z
+	return dx*dx+dz*dz <= radius*radius
+}
+
+// trimWorld archives the world of a stopped server and rewrites its
+// database without the chunks beyond the trim radius, and the actors
+// stored in them. It does not need m.mu, see trimUnlocked.
+func (m *Manager) trimWorld(serverConfig *config.MinecraftServerConfig) (*TrimResult, error) {
+	name := serverConfig.Name
+	worldDir := m.config.GetWorldDir(name, serverConfig.WorldName)
+	dbDir := filepath.Join(worldDir, "db")
+	if _, err := os.Stat(dbDir); err != nil {
+		return nil, fmt.Errorf("server %s has no world to trim yet", name)
+	}
+
+	level, err := nbt.ReadLevelDat(filepath.Join(worldDir, "level.dat"))
+	if err != nil {
+		return nil, err
+	}
+	trimmer := &chunkTrimmer{radius: float64(serverConfig.Trim.Radius)}
+	if tag, ok := level.Root.Get("SpawnX"); ok {
+		x, _ := tag.Value.(int32)
+		trimmer.spawn.x = float64(x)
+	}
+	if tag, ok := level.Root.Get("SpawnZ"); ok {
+		z, _ := tag.Value.(int32)
+		trimmer.spawn.z = float64(z)
+	}
+
+	db, err := leveldb.Open(dbDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open world database: %w", err)
+	}
+	actorLists := make(map[chunkPos][]byte)
+	err = db.Entries(func(key, value []byte) error {
+		if string(key) == "~local_player" || bytes.HasPrefix(key, []byte("player_server_")) {
+			if pos, ok := playerPos(value); ok {
+				trimmer.players = append(trimmer.players, pos)
+			}
+		} else if pos, ok := parseActorListKey(key); ok {
+			actorLists[pos] = append([]byte(nil), value...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read world database: %w", err)
+	}
+
+	// Actors are stored under their unique id, listed by their chunk
+	removedActors := make(map[string]bool)
+	for pos, ids := range actorLists {
+		if trimmer.keep(pos) {
+			continue
+		}
+		for i := 0; i+8 <= len(ids); i += 8 {
+			removedActors["actorprefix"+string(ids[i:i+8])] = true
+		}
+	}
+
+	archive, err := m.archiveWorld(serverConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up world before trimming: %w", err)
+	}
+	result := &TrimResult{
+		Time:          time.Now(),
+		Archive:       archive,
+		Radius:        serverConfig.Trim.Radius,
+		RemovedActors: len(removedActors),
+		SizeBefore:    measureDisk(map[string][]string{name: {dbDir}})[name],
+	}
+
+	kept := make(map[chunkPos]bool)
+	removed := make(map[chunkPos]bool)
+	stagingDir := dbDir + ".trim"
+	if err := os.RemoveAll(stagingDir); err != nil {
+		return nil, err
+	}
+	err = leveldb.Create(stagingDir, func(put func(key, value []byte) error) error {
+		return db.Entries(func(key, value []byte) error {
+			if pos, ok := parseChunkKey(key); ok {
+				if !trimmer.keep(pos) {
+					removed[pos] = true
+					return nil
+				}
+				kept[pos] = true
+			} else if pos, ok := parseActorListKey(key); ok && !trimmer.keep(pos) {
+				return nil
+			} else if removedActors[string(key)] {
+				return nil
+			}
+			return put(key, value)
+		})
+	})
+	if err == nil {
+		_, err = leveldb.Open(stagingDir)
+	}
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return nil, fmt.Errorf("failed to write trimmed world database: %w", err)
+	}
+
+	oldDir := dbDir + ".old"
+	if err := os.RemoveAll(oldDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(dbDir, oldDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(stagingDir, dbDir); err != nil {
+		os.Rename(oldDir, dbDir)
+		return nil, err
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		m.logger.Warnf("Failed to remove untrimmed database of %s: %v", name, err)
+	}
+
+	result.Chunks, result.RemovedChunks = len(kept), len(removed)
+	result.SizeAfter = measureDisk(map[string][]string{name: {dbDir}})[name]
+	m.logger.Infof("Trimmed world of %s: removed %d of %d chunks beyond %d blocks, %d bytes before, %d after",
+		name, result.RemovedChunks, result.RemovedChunks+result.Chunks, result.Radius, result.SizeBefore, result.SizeAfter)
+
+	data, _ := json.MarshalIndent(result, "", "  ")
+	if err := os.WriteFile(filepath.Join(m.config.GetServerDir(name), lastTrimFile), data, 0644); err != nil {
+		m.logger.Warnf("Failed to record trim of %s: %v", name, err)
+	}
+	m.events.Publish(events.WorldTrimmed, name, map[string]interface{}{"removed_chunks": result.RemovedChunks, "archive": archive})
+	return result, nil
+}
+
+// trimDue reports whether the world of a server with a trim radius is due
+// to be trimmed
+func (m *Manager) trimDue(serverConfig *config.MinecraftServerConfig, now time.Time) bool {
+	if serverConfig.Trim == nil {
+		return false
+	}
+	interval := defaultTrimInterval
+	if serverConfig.Trim.EveryDays > 0 {
+		interval = time.Duration(serverConfig.Trim.EveryDays) * 24 * time.Hour
+	}
+	data, err := os.ReadFile(filepath.Join(m.config.GetServerDir(serverConfig.Name), lastTrimFile))
+	if err != nil {
+		return true
+	}
+	var last TrimResult
+	return json.Unmarshal(data, &last) != nil || now.Sub(last.Time) >= interval
+}
+
+// trimUnlocked trims the world of a stopped server with m.mu released, so
+// that rewriting a large world does not hold up the manager, keeping the
+// server from being started meanwhile. m.mu is held again on return.
+// The caller must hold m.mu.
+func (m *Manager) trimUnlocked(serverConfig *config.MinecraftServerConfig) (*TrimResult, error) {
+	name := serverConfig.Name
+	m.trimming[name] = true
+	m.mu.Unlock()
+	result, err := m.trimWorld(serverConfig)
+	m.mu.Lock()
+	delete(m.trimming, name)
+	return result, err
+}
+
+// TrimWorld trims the world of a server now, stopping the server while its
+// world is rewritten
+func (m *Manager) TrimWorld(name string) (*TrimResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	serverConfig := m.findServerConfig(name)
+	if serverConfig == nil {
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if serverConfig.Trim == nil {
+		return nil, fmt.Errorf("server %s has no trim radius configured", name)
+	}
+	if m.trimming[name] {
+		return nil, fmt.Errorf("world of server %s is being trimmed already", name)
+	}
+
+	_, running := m.servers[name]
+	if running {
+		if err := m.checkFrozen(); err != nil {
+			return nil, err
+		}
+		m.logger.Infof("Stopping server %s to trim its world", name)
+		m.announceRestart(name, "world maintenance")
+		m.stopServer(name)
+	}
+	result, err := m.trimUnlocked(serverConfig)
+
+	// Start the server with its current configuration, unless it was
+	// removed, started or shut down while the world was rewritten
+	_, started := m.servers[name]
+	if current := m.findServerConfig(name); running && !started && current != nil && m.shutdownStatus == nil {
+		if startErr := m.startServer(current); startErr != nil && err == nil {
+			err = fmt.Errorf("world trimmed but server failed to restart: %w", startErr)
+		}
+	}
+	return result, err
+}
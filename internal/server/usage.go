@@ -0,0 +1,165 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/mail"
+	"minecraft-server-manager/internal/usage"
+)
+
+// usageEmailTimeout bounds sending one usage report by email
+const usageEmailTimeout = time.Minute
+
+// recordUsage samples every configured server for the usage reports. When
+// a month has ended, its reports are published.
+func (m *Manager) recordUsage(now time.Time) {
+	m.mu.RLock()
+	if m.lastConfig == nil {
+		m.mu.RUnlock()
+		return
+	}
+	samples := make([]usage.Sample, 0, len(m.lastConfig.Servers))
+	for _, serverConfig := range m.lastConfig.Servers {
+		sample := usage.Sample{
+			Server:  serverConfig.Name,
+			Tenant:  serverConfig.Tenant,
+			Storage: m.serverDisk[serverConfig.Name],
+		}
+		if server, exists := m.servers[serverConfig.Name]; exists && server.Status == "running" {
+			sample.Running = true
+			sample.Players = len(server.Players)
+			if server.Process != nil && server.Process.Process != nil {
+				sample.PID = server.Process.Process.Pid
+			}
+		}
+		samples = append(samples, sample)
+	}
+	m.mu.RUnlock()
+
+	for i := range samples {
+		if samples[i].PID == 0 {
+			continue
+		}
+		cpu, memory, err := usage.ProcessStats(samples[i].PID)
+		if err != nil {
+			m.logger.Debugf("Failed to read resource usage of %s: %v", samples[i].Server, err)
+			samples[i].PID = 0
+			continue
+		}
+		samples[i].CPUSeconds, samples[i].Memory = cpu, memory
+	}
+
+	closed, err := m.usage.Record(now, samples)
+	if err != nil {
+		m.logger.Errorf("Failed to record usage: %v", err)
+	}
+	if closed != "" {
+		go m.publishUsageReports(closed)
+	}
+}
+
+// publishUsageReports writes the reports of a finished month as CSV and
+// JSON files, one for all servers and one per tenant, and emails them when
+// configured
+func (m *Manager) publishUsageReports(month string) {
+	report, err := m.usage.Report(month, time.Now())
+	if err != nil {
+		m.logger.Errorf("Failed to build usage report for %s: %v", month, err)
+		return
+	}
+
+	dir := filepath.Join(m.config.Server.DataDir, "usage", "reports", month)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		m.logger.Errorf("Failed to write usage reports: %v", err)
+		return
+	}
+	reports := map[string]*usage.Report{"all": report}
+	for _, tenant := range report.Tenants() {
+		reports[tenant] = report.Tenant(tenant)
+	}
+	for name, rep := range reports {
+		if err := writeUsageReport(dir, name, rep); err != nil {
+			m.logger.Errorf("Failed to write usage report %s for %s: %v", name, month, err)
+		}
+	}
+	m.logger.Infof("Wrote usage reports for %s to %s", month, dir)
+
+	if err := m.usage.Prune(time.Now(), m.config.Usage.RetentionMonths); err != nil {
+		m.logger.Warnf("Failed to prune usage history: %v", err)
+	}
+
+	email := m.config.Usage.Email
+	if len(email.To) > 0 {
+		m.emailUsageReport(email.To, "", report)
+	}
+	for tenant, recipients := range email.Tenants {
+		m.emailUsageReport(recipients, tenant, report.Tenant(tenant))
+	}
+}
+
+// writeUsageReport writes one report as <name>.csv and <name>.json
+func writeUsageReport(dir, name string, report *usage.Report) error {
+	var csv bytes.Buffer
+	if err := report.WriteCSV(&csv); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".csv"), csv.Bytes(), 0644); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name+".json"), data, 0644)
+}
+
+// emailUsageReport mails a report as a CSV attachment
+func (m *Manager) emailUsageReport(recipients []string, tenant string, report *usage.Report) {
+	subject := fmt.Sprintf("Server usage for %s", report.Month)
+	filename := fmt.Sprintf("usage-%s.csv", report.Month)
+	if tenant != "" {
+		subject = fmt.Sprintf("Server usage of %s for %s", tenant, report.Month)
+		filename = fmt.Sprintf("usage-%s-%s.csv", tenant, report.Month)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Usage of %d servers in %s:\n\n", len(report.Servers), report.Month)
+	for _, server := range report.Servers {
+		fmt.Fprintf(&body, "%s: %.1f hours up, %d players at peak, %.1f CPU core hours\n",
+			server.Server, server.UptimeHours, server.PeakPlayers, server.CPUCoreHours)
+	}
+	var csv bytes.Buffer
+	report.WriteCSV(&csv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), usageEmailTimeout)
+	defer cancel()
+	err := mail.Send(ctx, m.config.Usage.Email.SMTP, mail.Message{
+		To:          recipients,
+		Subject:     subject,
+		Body:        body.String(),
+		Attachments: []mail.Attachment{{Name: filename, ContentType: "text/csv", Data: csv.Bytes()}},
+	})
+	if err != nil {
+		m.logger.Errorf("Failed to email usage report for %s to %s: %v", report.Month, strings.Join(recipients, ", "), err)
+		return
+	}
+	m.logger.Infof("Emailed usage report for %s to %s", report.Month, strings.Join(recipients, ", "))
+}
+
+// UsageMonths lists the months with recorded usage, oldest first
+func (m *Manager) UsageMonths() ([]string, error) {
+	return m.usage.Months()
+}
+
+// UsageReport reports the usage of every server in a month, which may be
+// the current one
+func (m *Manager) UsageReport(month string) (*usage.Report, error) {
+	return m.usage.Report(month, time.Now())
+}
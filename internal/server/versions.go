@@ -0,0 +1,241 @@
+package server
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/mirror"
+	"minecraft-server-manager/internal/preflight"
+)
+
+// bedrockVersionPattern matches Bedrock versions such as 1.21.44.01
+var bedrockVersionPattern = regexp.MustCompile(`^\d+(\.\d+)+$`)
+
+// bedrockBinary returns the executable a server of a version runs. With
+// server.versions.download it is the binary of the version in
+// cache_dir/versions, downloaded first if necessary and verified against
+// its pinned checksum; otherwise every server runs the one of bedrock_path
+// or versions/bedrock-server.zip.
+// The caller must hold m.mu.
+func (m *Manager) bedrockBinary(version string) (string, error) {
+	if !m.config.Server.Versions.Download {
+		return m.bedrockPath, nil
+	}
+	if version == "" {
+		return "", fmt.Errorf("no version configured, which server.versions.download requires")
+	}
+	checksum, err := m.config.BedrockChecksum(m.lastConfig, version)
+	if err != nil {
+		return "", err
+	}
+	return m.cacheBedrockVersion(version, checksum)
+}
+
+// checkLibraries looks for the shared libraries and glibc version of a
+// Bedrock binary before it is first launched, so that a host lacking them
+// fails with the packages to install instead of a cryptic start failure.
+// Binaries that passed are not checked again, and none are when
+// preflight.skip holds bedrock_libraries.
+// The caller must hold m.mu.
+func (m *Manager) checkLibraries(binary string) error {
+	if m.libraries[binary] || runtime.GOOS != "linux" || slices.Contains(m.config.Preflight.Skip, config.CheckBedrockLibraries) {
+		return nil
+	}
+	result := preflight.CheckLibraries(binary)
+	if result.Status == preflight.StatusFail {
+		return fmt.Errorf("%s. %s", result.Message, result.Fix)
+	}
+	m.libraries[binary] = true
+	return nil
+}
+
+// installedVersion records what was verified when a Bedrock version was
+// installed, in .verified.json of its directory
+type installedVersion struct {
+	// Archive is the checksum of the downloaded archive, Binary that of
+	// the extracted bedrock_server
+	Archive string `json:"archive_sha256"`
+	Binary  string `json:"binary_sha256"`
+	Pinned  bool   `json:"pinned"`
+}
+
+// cacheBedrockVersion returns the path of the bedrock_server binary of a
+// version in the cache, downloading and extracting it first if necessary.
+// The archive must match checksum, and without one it is refused unless
+// verification.allow_unpinned is set. An installed binary is checked
+// against the checksum recorded at installation, so one modified since is
+// never run. Concurrent calls for the same version download it once.
+func (m *Manager) cacheBedrockVersion(version, checksum string) (string, error) {
+	if !bedrockVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid Bedrock version %q", version)
+	}
+	if checksum == "" && !m.config.Verification.AllowUnpinned {
+		return "", fmt.Errorf("Bedrock %s has no pinned checksum, add it to bedrock_checksums or verification.checksums", version)
+	}
+	versionsDir := filepath.Join(m.config.Server.CacheDir, "versions")
+	versionDir := filepath.Join(versionsDir, version)
+	binary := filepath.Join(versionDir, "bedrock_server")
+
+	lock, _ := m.downloads.LoadOrStore(versionDir, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	// Versions are extracted to a temporary directory and renamed, so an
+	// existing record belongs to a complete installation
+	if installed, err := readInstalledVersion(versionDir); err == nil && (checksum == "" || installed.Pinned && installed.Archive == checksum) {
+		actual, err := fileChecksum(binary)
+		if err != nil {
+			return "", fmt.Errorf("failed to verify Bedrock %s: %w", version, err)
+		}
+		if actual != installed.Binary {
+			return "", fmt.Errorf("bedrock_server of Bedrock %s was modified since it was verified (expected: %s, got: %s), remove %s to download it again", version, installed.Binary, actual, versionDir)
+		}
+		return binary, nil
+	}
+
+	if err := os.MkdirAll(versionsDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create versions cache directory: %w", err)
+	}
+	archivePath := versionDir + ".zip"
+	defer os.Remove(archivePath)
+	if err := m.fetchArtifact(mirror.Bedrock(version), m.versionURL(version), archivePath, checksum); err != nil {
+		return "", fmt.Errorf("failed to download Bedrock %s: %w", version, err)
+	}
+	installed := installedVersion{Archive: checksum, Pinned: checksum != ""}
+	if checksum == "" {
+		sum, err := fileChecksum(archivePath)
+		if err != nil {
+			return "", err
+		}
+		installed.Archive = sum
+		m.logger.Warnf("Bedrock %s is not pinned, running it unverified; its checksum is %s", version, sum)
+	}
+
+	tmpDir := versionDir + ".extract"
+	os.RemoveAll(tmpDir)
+	defer os.RemoveAll(tmpDir)
+	if err := extractBedrock(archivePath, tmpDir); err != nil {
+		return "", fmt.Errorf("failed to extract Bedrock %s: %w", version, err)
+	}
+	sum, err := fileChecksum(filepath.Join(tmpDir, "bedrock_server"))
+	if err != nil {
+		return "", err
+	}
+	installed.Binary = sum
+	data, err := json.MarshalIndent(installed, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, installedVersionFile), data, 0644); err != nil {
+		return "", err
+	}
+	os.RemoveAll(versionDir)
+	if err := os.Rename(tmpDir, versionDir); err != nil {
+		return "", err
+	}
+
+	m.logger.Infof("Bedrock %s installed at %s", version, versionDir)
+	return binary, nil
+}
+
+// installedVersionFile holds the installedVersion of a version directory
+const installedVersionFile = ".verified.json"
+
+func readInstalledVersion(versionDir string) (installedVersion, error) {
+	var installed installedVersion
+	data, err := os.ReadFile(filepath.Join(versionDir, installedVersionFile))
+	if err != nil {
+		return installed, err
+	}
+	err = json.Unmarshal(data, &installed)
+	return installed, err
+}
+
+// fileChecksum returns the hex encoded SHA-256 checksum of a file
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// maxBedrockBytes bounds the extracted size of a Bedrock dedicated server
+// archive, which is a few hundred megabytes
+const maxBedrockBytes = 4 << 30
+
+// extractBedrock extracts a Bedrock dedicated server archive to dir
+func extractBedrock(archivePath, dir string) error {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		name := file.Name
+		if strings.Contains(name, "\\") || path.IsAbs(name) || strings.HasPrefix(path.Clean(name), "..") {
+			return fmt.Errorf("archive contains unsafe path %q", name)
+		}
+	}
+	if err := extractWorld(&archive.Reader, "", dir, maxBedrockBytes); err != nil {
+		return err
+	}
+
+	binary := filepath.Join(dir, "bedrock_server")
+	if _, err := os.Stat(binary); err != nil {
+		return fmt.Errorf("archive does not contain bedrock_server")
+	}
+	return os.Chmod(binary, 0755)
+}
+
+// prewarmVersions downloads the Bedrock versions used by the servers of a
+// configuration that are not cached yet, so that applying it does not
+// download them while holding m.mu. Failures are logged, the start
+// downloads the version again.
+func (m *Manager) prewarmVersions(repoConfig *config.RepoConfig) {
+	if !m.config.Server.Versions.Download {
+		return
+	}
+	versions := make(map[string]bool)
+	for _, serverConfig := range repoConfig.Servers {
+		if serverConfig.Version != "" {
+			versions[serverConfig.Version] = true
+		}
+	}
+
+	var wg sync.WaitGroup
+	for version := range versions {
+		checksum, err := m.config.BedrockChecksum(repoConfig, version)
+		if err != nil {
+			m.logger.Warnf("Failed to pre-download Bedrock %s: %v", version, err)
+			continue
+		}
+		wg.Add(1)
+		go func(version, checksum string) {
+			defer wg.Done()
+			if _, err := m.cacheBedrockVersion(version, checksum); err != nil {
+				m.logger.Warnf("Failed to pre-download Bedrock %s: %v", version, err)
+			}
+		}(version, checksum)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,274 @@
+package server
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+)
+
+// ImportWorld replaces the world of a managed server with the contents of a
+// .mcworld/zip archive. The server is stopped while the world is swapped and
+// started again afterwards.
+func (m *Manager) ImportWorld(name string, archive io.Reader) error {
+	maxBytes := int64(m.config.Server.MaxImportMB) * 1024 * 1024
+
+	// Spool the upload to disk, zip needs random access
+	tmpFile, err := os.CreateTemp("", "world-import-*.zip")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	written, err := io.Copy(tmpFile, io.LimitReader(archive, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to store uploaded archive: %w", err)
+	}
+	if written > maxBytes {
+		return fmt.Errorf("archive exceeds maximum import size of %d MB", m.config.Server.MaxImportMB)
+	}
+
+	reader, err := zip.NewReader(tmpFile, written)
+	if err != nil {
+		return fmt.Errorf("invalid world archive: %w", err)
+	}
+
+	m.mu.RLock()
+	serverConfig := m.findServerConfig(name)
+	m.mu.RUnlock()
+	if serverConfig == nil {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+
+	// The archive is extracted and checked while the server keeps running
+	stagingDir, err := m.stageWorld(serverConfig, reader, maxBytes)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if serverConfig = m.findServerConfig(name); serverConfig == nil {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if _, running := m.servers[name]; running {
+		if err := m.checkFrozen(); err != nil {
+			return err
+		}
+	}
+	if err := m.swapWorld(serverConfig, stagingDir, "world replaced"); err != nil {
+		return err
+	}
+
+	m.logger.Infof("Imported world for server %s (%d bytes archive)", name, written)
+	m.events.Publish(events.WorldImported, name, map[string]interface{}{"bytes": written})
+	return nil
+}
+
+// replaceWorld validates a world archive and swaps it in as the server's
+// world, restarting the server if it was running.
+// The caller must hold m.mu.
+func (m *Manager) replaceWorld(serverConfig *config.MinecraftServerConfig, reader *zip.Reader, maxBytes int64) error {
+	stagingDir, err := m.stageWorld(serverConfig, reader, maxBytes)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	return m.swapWorld(serverConfig, stagingDir, "world replaced")
+}
+
+// stageWorld validates a world archive and extracts it into a staging
+// directory next to the server's world, which it returns. It does not need
+// m.mu, so large archives can be staged while the server keeps running.
+func (m *Manager) stageWorld(serverConfig *config.MinecraftServerConfig, reader *zip.Reader, maxBytes int64) (string, error) {
+	root, err := validateWorldArchive(reader, maxBytes)
+	if err != nil {
+		return "", err
+	}
+
+	worldDir := m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName)
+	if err := os.MkdirAll(filepath.Dir(worldDir), 0755); err != nil {
+		return "", err
+	}
+	stagingDir, err := os.MkdirTemp(filepath.Dir(worldDir), filepath.Base(worldDir)+".import-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := extractWorld(reader, root, stagingDir, maxBytes); err != nil {
+		os.RemoveAll(stagingDir)
+		return "", fmt.Errorf("failed to extract world: %w", err)
+	}
+	if err := checkWorld(stagingDir, true); err != nil {
+		os.RemoveAll(stagingDir)
+		return "", fmt.Errorf("world archive is damaged: %w", err)
+	}
+	return stagingDir, nil
+}
+
+// swapWorld moves a staged world into place as the server's world,
+// stopping the server meanwhile and starting it again afterwards. The
+// previous world is kept next to the new one with a ".previous" suffix,
+// and put back when the new one cannot be moved into place.
+// The caller must hold m.mu.
+func (m *Manager) swapWorld(serverConfig *config.MinecraftServerConfig, stagingDir, reason string) error {
+	name := serverConfig.Name
+	if m.trimming[name] {
+		return fmt.Errorf("world of server %s is being trimmed", name)
+	}
+
+	_, running := m.servers[name]
+	if running {
+		m.logger.Infof("Stopping server %s to replace its world", name)
+		m.announceRestart(name, reason)
+		m.stopServer(name)
+	}
+
+	worldDir := m.config.GetWorldDir(name, serverConfig.WorldName)
+	previousDir := worldDir + ".previous"
+	err := os.RemoveAll(previousDir)
+	if err == nil {
+		if err = os.Rename(worldDir, previousDir); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		if err = os.Rename(stagingDir, worldDir); err != nil {
+			os.Rename(previousDir, worldDir)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to move new world into place: %w", err)
+	}
+
+	if running {
+		if startErr := m.startServer(serverConfig); startErr != nil && err == nil {
+			err = fmt.Errorf("world replaced but server failed to restart: %w", startErr)
+		}
+	}
+	return err
+}
+
+// findServerConfig returns the desired configuration for a server, or nil
+// when the server is not part of the applied configuration.
+// The caller must hold m.mu.
+func (m *Manager) findServerConfig(name string) *config.MinecraftServerConfig {
+	if server, exists := m.servers[name]; exists {
+		return server.Config
+	}
+	return m.lastConfig.Server(name)
+}
+
+// validateWorldArchive checks that the archive contains a Bedrock world and
+// stays within the size limit once extracted. It returns the directory
+// inside the archive that holds level.dat.
+func validateWorldArchive(reader *zip.Reader, maxBytes int64) (string, error) {
+	root := ""
+	found := false
+	var total uint64
+
+	for _, file := range reader.File {
+		name := file.Name
+		if strings.Contains(name, "\\") || path.IsAbs(name) || strings.HasPrefix(path.Clean(name), "..") {
+			return "", fmt.Errorf("archive contains unsafe path %q", name)
+		}
+
+		total += file.UncompressedSize64
+		if total > uint64(maxBytes) {
+			return "", fmt.Errorf("extracted world exceeds maximum import size of %d bytes", maxBytes)
+		}
+
+		if path.Base(name) == "level.dat" && !file.FileInfo().IsDir() {
+			dir := path.Dir(name)
+			// Prefer the shallowest level.dat in case of nested copies
+			if !found || len(dir) < len(root) {
+				root = dir
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		return "", fmt.Errorf("archive does not contain level.dat")
+	}
+	if root == "." {
+		root = ""
+	}
+
+	return root, nil
+}
+
+// extractWorld extracts the files below root of an archive to destDir. The
+// extracted bytes are counted while copying, since the sizes an archive
+// declares may lie, and extraction fails beyond maxBytes.
+func extractWorld(reader *zip.Reader, root, destDir string, maxBytes int64) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	prefix := ""
+	if root != "" {
+		prefix = root + "/"
+	}
+
+	for _, file := range reader.File {
+		if !strings.HasPrefix(file.Name, prefix) {
+			continue
+		}
+		relPath := strings.TrimPrefix(file.Name, prefix)
+		if relPath == "" {
+			continue
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(relPath))
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		written, err := extractFile(file, target, maxBytes)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", file.Name, err)
+		}
+		maxBytes -= written
+	}
+
+	return nil
+}
+
+// extractFile writes a file of an archive to target and returns its size.
+// It fails once the file exceeds limit bytes.
+func extractFile(file *zip.File, target string, limit int64) (int64, error) {
+	src, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return written, err
+	}
+	if written > limit {
+		return written, fmt.Errorf("extracted archive exceeds its maximum size")
+	}
+	return written, nil
+}
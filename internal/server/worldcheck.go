@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"minecraft-server-manager/internal/leveldb"
+	"minecraft-server-manager/internal/nbt"
+)
+
+// requiredLevelTags are the level.dat tags of every Bedrock world
+var requiredLevelTags = []string{"LevelName", "RandomSeed", "SpawnX", "SpawnZ"}
+
+// checkWorld verifies that a world can be loaded: its level.dat parses and
+// has the required tags, and its database opens with all of its files in
+// place. A thorough check also reads every entry of the database,
+// verifying the checksums. A missing world is fine, the server generates
+// a new one.
+func checkWorld(worldDir string, thorough bool) error {
+	if _, err := os.Stat(worldDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	level, err := nbt.ReadLevelDat(filepath.Join(worldDir, "level.dat"))
+	if err != nil {
+		return fmt.Errorf("invalid level.dat: %w", err)
+	}
+	for _, name := range requiredLevelTags {
+		if _, ok := level.Root.Get(name); !ok {
+			return fmt.Errorf("level.dat has no %s", name)
+		}
+	}
+
+	dbDir := filepath.Join(worldDir, "db")
+	if _, err := os.Stat(dbDir); os.IsNotExist(err) {
+		// Worlds that were never opened have no database yet
+		return nil
+	}
+	db, err := leveldb.Open(dbDir)
+	if err != nil {
+		return fmt.Errorf("database does not open: %w", err)
+	}
+	if err := db.Check(); err != nil {
+		return fmt.Errorf("damaged database: %w", err)
+	}
+	if thorough {
+		if _, err := db.Len(); err != nil {
+			return fmt.Errorf("damaged database: %w", err)
+		}
+	}
+	return nil
+}
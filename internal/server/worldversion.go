@@ -0,0 +1,284 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/events"
+	"minecraft-server-manager/internal/nbt"
+)
+
+// WorldVersion is the Bedrock version a server last opened its world with
+type WorldVersion struct {
+	World   string    `json:"world"`
+	Version string    `json:"version"`
+	Opened  time.Time `json:"opened"`
+}
+
+func (m *Manager) worldVersionsPath() string {
+	return filepath.Join(m.config.Server.DataDir, "world_versions.json")
+}
+
+// loadWorldVersions reads the versions the worlds were last opened with
+func (m *Manager) loadWorldVersions() error {
+	data, err := os.ReadFile(m.worldVersionsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	worldVersions := make(map[string]WorldVersion)
+	if err := json.Unmarshal(data, &worldVersions); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.worldVersionsPath(), err)
+	}
+	m.mu.Lock()
+	m.worldVersions = worldVersions
+	m.mu.Unlock()
+	return nil
+}
+
+// saveWorldVersions writes the versions of all worlds.
+// The caller must hold m.mu.
+func (m *Manager) saveWorldVersions() error {
+	if err := os.MkdirAll(m.config.Server.DataDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m.worldVersions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.worldVersionsPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.worldVersionsPath())
+}
+
+// parseBedrockVersion splits a version such as 1.21.44.01 into its numbers
+func parseBedrockVersion(version string) ([]int, bool) {
+	if !bedrockVersionPattern.MatchString(version) {
+		return nil, false
+	}
+	var numbers []int
+	for _, part := range strings.Split(version, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, true
+}
+
+// compareVersions compares two versions number by number, missing numbers
+// counting as 0
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// majorUpgrade reports whether to is of a newer major version than from,
+// which Bedrock numbers with the first two numbers: 1.21 after 1.20
+func majorUpgrade(from, to []int) bool {
+	return compareVersions(truncateVersion(to, 2), truncateVersion(from, 2)) > 0
+}
+
+func truncateVersion(version []int, n int) []int {
+	if len(version) > n {
+		return version[:n]
+	}
+	return version
+}
+
+// levelVersion reads the version Bedrock records in level.dat as
+// lastOpenedWithVersion. It is empty for worlds without one.
+func levelVersion(worldDir string) string {
+	level, err := nbt.ReadLevelDat(filepath.Join(worldDir, "level.dat"))
+	if err != nil {
+		return ""
+	}
+	tag, ok := level.Root.Get("lastOpenedWithVersion")
+	if !ok {
+		return ""
+	}
+	list, ok := tag.Value.(nbt.List)
+	if !ok {
+		return ""
+	}
+	var parts []string
+	for _, item := range list.Items {
+		number, ok := item.(int32)
+		if !ok {
+			return ""
+		}
+		parts = append(parts, strconv.Itoa(int(number)))
+	}
+	// The fifth number is unused and always 0
+	if len(parts) > 4 {
+		parts = parts[:4]
+	}
+	return strings.Join(parts, ".")
+}
+
+// worldOpenedWith returns the newest version the world of a server was
+// opened with: the one the manager recorded or the one of its level.dat.
+// It is empty for worlds that were never opened.
+// The caller must hold m.mu.
+func (m *Manager) worldOpenedWith(serverConfig *config.MinecraftServerConfig) string {
+	var opened string
+	var openedNumbers []int
+	if recorded, exists := m.worldVersions[serverConfig.Name]; exists && recorded.World == serverConfig.WorldName {
+		if numbers, ok := parseBedrockVersion(recorded.Version); ok {
+			opened, openedNumbers = recorded.Version, numbers
+		}
+	}
+	level := levelVersion(m.config.GetWorldDir(serverConfig.Name, serverConfig.WorldName))
+	if numbers, ok := parseBedrockVersion(level); ok && compareVersions(numbers, openedNumbers) > 0 {
+		opened = level
+	}
+	return opened
+}
+
+// checkWorldVersion refuses to open the world of a server with an older
+// Bedrock version than it was last opened with, unless allow_downgrade is
+// set, and with a newer major version unless allow_major_upgrade is set.
+// A version confirmed through the API passes either way. It applies with
+// server.versions.download only, where the manager knows the version each
+// server runs.
+// The caller must hold m.mu.
+func (m *Manager) checkWorldVersion(serverConfig *config.MinecraftServerConfig) error {
+	if !m.config.Server.Versions.Download {
+		return nil
+	}
+	target, ok := parseBedrockVersion(serverConfig.Version)
+	if !ok {
+		return nil
+	}
+	opened := m.worldOpenedWith(serverConfig)
+	if opened == "" || m.confirmed[serverConfig.Name] == serverConfig.Version {
+		return nil
+	}
+	openedNumbers, _ := parseBedrockVersion(opened)
+
+	var err error
+	switch {
+	case compareVersions(target, openedNumbers) < 0 && !serverConfig.AllowDowngrade:
+		err = fmt.Errorf("world %s was last opened with Bedrock %s, opening it with the older %s can corrupt it; set allow_downgrade or confirm the version through the API", serverConfig.WorldName, opened, serverConfig.Version)
+	case majorUpgrade(openedNumbers, target) && !serverConfig.AllowMajorUpgrade:
+		err = fmt.Errorf("world %s was last opened with Bedrock %s, opening it with %s upgrades it to a new major version for good; set allow_major_upgrade or confirm the version through the API", serverConfig.WorldName, opened, serverConfig.Version)
+	default:
+		return nil
+	}
+	m.events.Publish(events.WorldBlocked, serverConfig.Name, map[string]interface{}{"world": serverConfig.WorldName, "opened": opened, "version": serverConfig.Version})
+	return err
+}
+
+// versionBlocked reports whether the world version guard keeps a running
+// server from being restarted with its new configuration, recording why in
+// its apply action.
+// The caller must hold m.mu.
+func (m *Manager) versionBlocked(serverConfig *config.MinecraftServerConfig, action *ServerAction) bool {
+	err := m.checkWorldVersion(serverConfig)
+	if err == nil {
+		return false
+	}
+	m.logger.Warnf("Not restarting server %s: %v", serverConfig.Name, err)
+	action.Action = ActionSkipped
+	action.Reason = err.Error()
+	return true
+}
+
+// recordWorldVersion records the version a server opens its world with
+// once its process started, warning about major upgrades. A confirmation
+// of the version is used up.
+// The caller must hold m.mu.
+func (m *Manager) recordWorldVersion(serverConfig *config.MinecraftServerConfig) {
+	if !m.config.Server.Versions.Download {
+		return
+	}
+	target, ok := parseBedrockVersion(serverConfig.Version)
+	if !ok {
+		return
+	}
+	if m.confirmed[serverConfig.Name] == serverConfig.Version {
+		delete(m.confirmed, serverConfig.Name)
+	}
+	opened := m.worldOpenedWith(serverConfig)
+	if openedNumbers, ok := parseBedrockVersion(opened); ok && majorUpgrade(openedNumbers, target) {
+		m.logger.Warnf("Server %s upgrades world %s from Bedrock %s to the new major version %s", serverConfig.Name, serverConfig.WorldName, opened, serverConfig.Version)
+		m.events.Publish(events.WorldUpgraded, serverConfig.Name, map[string]interface{}{"world": serverConfig.WorldName, "from": opened, "version": serverConfig.Version})
+	}
+	if recorded, exists := m.worldVersions[serverConfig.Name]; exists && recorded.World == serverConfig.WorldName && recorded.Version == serverConfig.Version {
+		return
+	}
+
+	m.worldVersions[serverConfig.Name] = WorldVersion{World: serverConfig.WorldName, Version: serverConfig.Version, Opened: time.Now()}
+	if err := m.saveWorldVersions(); err != nil {
+		m.logger.Errorf("Failed to save world versions: %v", err)
+	}
+}
+
+// ConfirmVersion lets the world of a server be opened with a Bedrock
+// version the world version guard refuses, an older or a newer major one,
+// once. version defaults to the configured version; when it is the
+// configured version, the server is started or restarted with it.
+func (m *Manager) ConfirmVersion(name, version string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	serverConfig := m.lastConfig.Server(name)
+	if serverConfig == nil {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	if version == "" {
+		version = serverConfig.Version
+	}
+	if !bedrockVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid Bedrock version %q", version)
+	}
+	if err := m.checkFrozen(); err != nil {
+		return err
+	}
+	m.confirmed[name] = version
+	m.logger.Infof("Confirmed Bedrock %s for the world of server %s (requested through the API)", version, name)
+
+	if version != serverConfig.Version {
+		// Used once an apply configures the version
+		return nil
+	}
+	if server, exists := m.servers[name]; exists {
+		if server.Config != serverConfig {
+			m.restartServers([]*config.MinecraftServerConfig{serverConfig}, "Bedrock version confirmed")
+		}
+		return nil
+	}
+	if _, quarantined := m.quarantined[name]; quarantined || !inOperatingHours(serverConfig, time.Now()) {
+		return nil
+	}
+	if err := m.startServer(serverConfig); err != nil {
+		return fmt.Errorf("failed to start server %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/github"
+)
+
+// ChangeServerConfig changes the allowlist or the player limit of a
+// configured server in its configuration source on behalf of by, so that
+// the repository stays the source of truth. The change is committed or
+// proposed in a pull request as configured by github.write_back, or as
+// mode asks when set, and reaches the server with the apply of the commit.
+func (m *Manager) ChangeServerConfig(name string, edit config.ServerEdit, mode, by string) (*github.Change, error) {
+	m.mu.RLock()
+	source, edit, err := m.checkServerEdit(name, edit)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("Change %s: %s", name, edit.Describe())
+	return m.writeBack(mode, source, message, by, func(content []byte) ([]byte, error) {
+		return config.EditServer(content, name, edit)
+	})
+}
+
+// checkServerEdit validates the changes to a server's configuration and
+// drops those it already has. It returns the server's source.
+// The caller must hold m.mu.
+func (m *Manager) checkServerEdit(name string, edit config.ServerEdit) (string, config.ServerEdit, error) {
+	current := m.lastConfig.Server(name)
+	if current == nil {
+		return "", edit, fmt.Errorf("%w: %s", ErrServerNotFound, name)
+	}
+	for _, player := range append(slices.Clone(edit.WhitelistAdd), edit.WhitelistRemove...) {
+		if _, err := playerTarget(player); err != nil {
+			return "", edit, err
+		}
+	}
+	listed := func(player string) bool {
+		return slices.ContainsFunc(current.Whitelist, func(entry string) bool { return strings.EqualFold(entry, player) })
+	}
+	edit.WhitelistAdd = slices.DeleteFunc(slices.Clone(edit.WhitelistAdd), listed)
+	edit.WhitelistRemove = slices.DeleteFunc(slices.Clone(edit.WhitelistRemove), func(player string) bool { return !listed(player) })
+	if edit.MaxPlayers != nil && *edit.MaxPlayers == current.MaxPlayers {
+		edit.MaxPlayers = nil
+	}
+	if len(edit.WhitelistAdd) == 0 && len(edit.WhitelistRemove) == 0 && edit.MaxPlayers == nil {
+		return "", edit, errors.New("the configuration already has these settings")
+	}
+
+	changed := *current
+	edit.Apply(&changed)
+	if len(current.Whitelist) > 0 && len(changed.Whitelist) == 0 {
+		// An empty allowlist lets everyone join
+		return "", edit, fmt.Errorf("the allowlist of %s must keep at least one player", name)
+	}
+	if edit.MaxPlayers != nil && *edit.MaxPlayers < 1 {
+		return "", edit, errors.New("max_players must be at least 1")
+	}
+
+	// Check the change as the apply of the commit would
+	candidate := *m.lastConfig
+	candidate.Servers = slices.Clone(m.lastConfig.Servers)
+	*candidate.Server(name) = changed
+	if err := candidate.Validate(); err != nil {
+		return "", edit, err
+	}
+	return current.Source, edit, nil
+}
+
+// writeBack writes a change to the configuration file of a source as
+// configured by github.write_back, naming who asked for it. mode may ask for
+// a pull request where commits are configured, never the other way round,
+// so that callers cannot skip a review.
+func (m *Manager) writeBack(mode, source, message, by string, update github.ConfigUpdate) (*github.Change, error) {
+	configured := m.config.GitHub.WriteBack
+	switch {
+	case mode != "" && mode != config.WriteBackCommit && mode != config.WriteBackPullRequest:
+		return nil, fmt.Errorf("invalid mode %q (must be %s or %s)", mode, config.WriteBackCommit, config.WriteBackPullRequest)
+	case configured == "":
+		return nil, errors.New("writing changes back to the configuration is disabled, see github.write_back")
+	case mode == config.WriteBackCommit && configured == config.WriteBackPullRequest:
+		return nil, errors.New("changes are proposed in pull requests as github.write_back says, mode commit is not allowed")
+	case mode == "":
+		mode = configured
+	}
+	if by != "" {
+		message += "\n\nRequested through the manager API by " + by
+	}
+	change, err := m.sources.WriteConfig(source, mode, message, update)
+	if err != nil {
+		return nil, err
+	}
+	summary, _, _ := strings.Cut(message, "\n")
+	switch {
+	case change.PullRequest != "":
+		m.logger.Infof("Opened pull request %s in source %s: %s", change.PullRequest, source, summary)
+	case change.Commit != "":
+		m.logger.Infof("Committed %s to source %s: %s", change.Commit, source, summary)
+	default:
+		m.logger.Infof("Wrote the configuration file of source %s: %s", source, summary)
+	}
+	return change, nil
+}
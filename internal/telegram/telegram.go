@@ -0,0 +1,138 @@
+// Package telegram is a minimal client of the Telegram Bot API, enough to
+// send messages and receive commands by long polling.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiURL is the Bot API endpoint, followed by bot<token>/<method>
+const apiURL = "https://api.telegram.org/"
+
+// maxMessageLength is the longest text Telegram accepts in one message
+const maxMessageLength = 4096
+
+// User is the sender of a message
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Chat is a private chat, group or channel
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// Message is a text message sent to the bot
+type Message struct {
+	MessageID int64  `json:"message_id"`
+	From      *User  `json:"from"`
+	Chat      Chat   `json:"chat"`
+	Text      string `json:"text"`
+}
+
+// Update is one incoming update; only messages are requested
+type Update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *Message `json:"message"`
+}
+
+// Client calls the Bot API with a bot token
+type Client struct {
+	token  string
+	client *http.Client
+}
+
+// NewClient creates a client for the bot with the given token
+func NewClient(token string) *Client {
+	// Long polls hold requests open, timeouts are set per call
+	return &Client{token: token, client: &http.Client{}}
+}
+
+// call invokes a Bot API method and decodes its result into result
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"bot"+c.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The URL carries the token, keep it out of logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: status %d", method, resp.StatusCode)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// SendMessage sends plain text to a chat. Text beyond the Telegram limit
+// is cut off.
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) error {
+	if runes := []rune(text); len(runes) > maxMessageLength {
+		text = string(runes[:maxMessageLength-1]) + "…"
+	}
+	return c.call(ctx, "sendMessage", map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"disable_web_page_preview": true,
+	}, nil)
+}
+
+// Updates long-polls for messages after offset, waiting up to wait for one
+// to arrive
+func (c *Client) Updates(ctx context.Context, offset int64, wait time.Duration) ([]Update, error) {
+	ctx, cancel := context.WithTimeout(ctx, wait+10*time.Second)
+	defer cancel()
+
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(wait.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+// Command splits a message like "/restart@party_bot survival" into the
+// command without the bot name and its arguments. ok is false for messages
+// that are not commands.
+func Command(text string) (command string, args []string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", nil, false
+	}
+	command, _, _ = strings.Cut(strings.ToLower(fields[0]), "@")
+	return command, fields[1:], true
+}
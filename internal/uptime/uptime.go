@@ -0,0 +1,300 @@
+package uptime
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server states recorded by the tracker
+const (
+	StateUp    = "up"
+	StateDown  = "down"
+	StateCrash = "crash"
+)
+
+// Retention is how long state transitions are kept
+const Retention = 30 * 24 * time.Hour
+
+// Windows are the periods availability is reported for
+var Windows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// Event is a state transition of a server
+type Event struct {
+	Time  time.Time `json:"time"`
+	State string    `json:"state"`
+}
+
+// Tracker records server state transitions to one JSON lines file per
+// server so that availability survives manager restarts. While a server is
+// up its file is touched regularly; after a manager crash the open up
+// interval is closed at the file's modification time.
+type Tracker struct {
+	dir    string
+	mu     sync.Mutex
+	events map[string][]Event
+}
+
+// Availability is the uptime of a server over one window
+type Availability struct {
+	Window        string  `json:"window"`
+	UptimePercent float64 `json:"uptime_percent"`
+	Up            string  `json:"up"`
+	Tracked       string  `json:"tracked"`
+	Crashes       int     `json:"crashes"`
+}
+
+// Report summarizes the availability of a server
+type Report struct {
+	Name    string         `json:"name"`
+	State   string         `json:"state"`
+	Since   time.Time      `json:"since,omitempty"`
+	Windows []Availability `json:"windows"`
+	// MTBC is the mean time between crashes over the retention period
+	MTBC string `json:"mtbc,omitempty"`
+}
+
+func NewTracker(dir string) *Tracker {
+	return &Tracker{
+		dir:    dir,
+		events: make(map[string][]Event),
+	}
+}
+
+// Load reads the recorded transitions, drops those past the retention
+// period and closes intervals left open by a manager that did not shut
+// down cleanly
+func (t *Tracker) Load() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read uptime history: %w", err)
+	}
+
+	cutoff := time.Now().Add(-Retention)
+	for _, entry := range entries {
+		name, isHistory := strings.CutSuffix(entry.Name(), ".jsonl")
+		if !isHistory || entry.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(t.dir, entry.Name())
+		events, err := readEvents(path)
+		if err != nil {
+			return err
+		}
+
+		// The manager stopped without recording the server going down
+		if n := len(events); n > 0 && events[n-1].State == StateUp {
+			if info, err := os.Stat(path); err == nil && info.ModTime().After(events[n-1].Time) {
+				events = append(events, Event{Time: info.ModTime(), State: StateDown})
+			} else {
+				events = append(events, Event{Time: events[n-1].Time, State: StateDown})
+			}
+		}
+
+		events = prune(events, cutoff)
+		t.events[name] = events
+		if err := writeEvents(path, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Record appends a state transition of a server. Repeated states are
+// ignored.
+func (t *Tracker) Record(server, state string, at time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := t.events[server]
+	if n := len(events); n > 0 && events[n-1].State == state {
+		return nil
+	}
+	if len(events) == 0 && state != StateUp {
+		// Nothing to close
+		return nil
+	}
+
+	event := Event{Time: at, State: state}
+	t.events[server] = append(prune(events, at.Add(-Retention)), event)
+
+	return appendEvent(t.path(server), event)
+}
+
+// Touch marks the history of servers that are up as current
+func (t *Tracker) Touch(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for server, events := range t.events {
+		if n := len(events); n > 0 && events[n-1].State == StateUp {
+			os.Chtimes(t.path(server), now, now)
+		}
+	}
+}
+
+// Report computes the availability of a server at now
+func (t *Tracker) Report(server string, now time.Time) *Report {
+	t.mu.Lock()
+	events := append([]Event(nil), t.events[server]...)
+	t.mu.Unlock()
+
+	report := &Report{Name: server, State: StateDown}
+	if n := len(events); n > 0 {
+		report.State = events[n-1].State
+		report.Since = events[n-1].Time
+		if report.State == StateCrash {
+			report.State = StateDown
+		}
+	}
+
+	for _, window := range Windows {
+		up, tracked, crashes := measure(events, now.Add(-window.Duration), now)
+		availability := Availability{
+			Window:  window.Name,
+			Up:      up.Round(time.Second).String(),
+			Tracked: tracked.Round(time.Second).String(),
+			Crashes: crashes,
+		}
+		if tracked > 0 {
+			availability.UptimePercent = float64(up) / float64(tracked) * 100
+		}
+		report.Windows = append(report.Windows, availability)
+	}
+
+	if up, _, crashes := measure(events, now.Add(-Retention), now); crashes > 0 {
+		report.MTBC = (up / time.Duration(crashes)).Round(time.Second).String()
+	}
+
+	return report
+}
+
+// measure sums the time a server was up between from and to and counts its
+// crashes. The tracked period starts with the first recorded transition.
+func measure(events []Event, from, to time.Time) (up, tracked time.Duration, crashes int) {
+	if len(events) == 0 {
+		return 0, 0, 0
+	}
+
+	start := from
+	if events[0].Time.After(start) {
+		start = events[0].Time
+	}
+	tracked = to.Sub(start)
+
+	for i, event := range events {
+		if event.State == StateCrash && !event.Time.Before(from) && !event.Time.After(to) {
+			crashes++
+		}
+		if event.State != StateUp {
+			continue
+		}
+
+		end := to
+		if i+1 < len(events) {
+			end = events[i+1].Time
+		}
+		upFrom := event.Time
+		if upFrom.Before(from) {
+			upFrom = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(upFrom) {
+			up += end.Sub(upFrom)
+		}
+	}
+
+	return up, tracked, crashes
+}
+
+// prune drops events before cutoff, keeping the last one so the state at
+// cutoff is known
+func prune(events []Event, cutoff time.Time) []Event {
+	i := 0
+	for i+1 < len(events) && events[i+1].Time.Before(cutoff) {
+		i++
+	}
+	return events[i:]
+}
+
+func (t *Tracker) path(server string) string {
+	return filepath.Join(t.dir, server+".jsonl")
+}
+
+func readEvents(path string) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uptime history: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// Skip lines torn by a crash
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+func writeEvents(path string, events []Event) error {
+	var data []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write uptime history: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func appendEvent(path string, event Event) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create uptime history directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open uptime history: %w", err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
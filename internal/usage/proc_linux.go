@@ -0,0 +1,53 @@
+package usage
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clockTicks is the unit of CPU times in /proc, USER_HZ is 100 on every
+// Linux architecture the Bedrock server runs on
+const clockTicks = 100
+
+// ProcessStats returns the CPU time used so far and the resident memory of
+// a process
+func ProcessStats(pid int) (cpuSeconds float64, memory int64, err error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may contain spaces, the fields start after it
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return 0, 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	// utime and stime are fields 14 and 15, the first after the name is 3
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	cpuSeconds = float64(utime+stime) / clockTicks
+
+	status, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer status.Close()
+	scanner := bufio.NewScanner(status)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "VmRSS:"); found {
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				kb, _ := strconv.ParseInt(fields[0], 10, 64)
+				memory = kb * 1024
+			}
+			break
+		}
+	}
+	return cpuSeconds, memory, scanner.Err()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package usage
+
+import "errors"
+
+// ProcessStats is only implemented on Linux; elsewhere reports have no CPU
+// and memory usage
+func ProcessStats(pid int) (cpuSeconds float64, memory int64, err error) {
+	return 0, 0, errors.New("process statistics are not supported on this platform")
+}
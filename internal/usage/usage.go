@@ -0,0 +1,352 @@
+// Package usage accumulates the resource usage of servers per month and
+// turns it into reports for billing.
+package usage
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MonthFormat is the layout of month keys such as "2024-05". Months are in
+// UTC.
+const MonthFormat = "2006-01"
+
+// sampleInterval is how often the manager records samples, the time
+// credited to the first sample after a start
+const sampleInterval = time.Minute
+
+// maxSampleGap caps the time credited to one sample, so that a manager that
+// was down is not billed for the gap
+const maxSampleGap = 2 * sampleInterval
+
+// Sample is one observation of a server
+type Sample struct {
+	Server  string
+	Tenant  string
+	Running bool
+	Players int
+	// PID and CPUSeconds identify the process and its CPU time so far,
+	// zero when unknown
+	PID        int
+	CPUSeconds float64
+	Memory     int64
+	// Storage is the size of the server directory, zero when not measured
+	Storage int64
+}
+
+// Totals are the usage of one server accumulated over a month
+type Totals struct {
+	Tenant            string  `json:"tenant,omitempty"`
+	UptimeSeconds     float64 `json:"uptime_seconds"`
+	PeakPlayers       int     `json:"peak_players"`
+	CPUSeconds        float64 `json:"cpu_seconds"`
+	MemoryByteSeconds float64 `json:"memory_byte_seconds"`
+	PeakMemory        int64   `json:"peak_memory_bytes"`
+	Storage           int64   `json:"storage_bytes"`
+}
+
+// month is the state file of one month
+type month struct {
+	Month   string             `json:"month"`
+	Servers map[string]*Totals `json:"servers"`
+}
+
+// cpuReading is the last CPU time seen for a server's process
+type cpuReading struct {
+	pid     int
+	seconds float64
+}
+
+// Recorder accumulates samples into one file per month under dir
+type Recorder struct {
+	dir string
+
+	mu      sync.Mutex
+	current month
+	last    time.Time
+	cpu     map[string]cpuReading
+}
+
+// NewRecorder creates a recorder keeping its files in dir
+func NewRecorder(dir string) *Recorder {
+	return &Recorder{dir: dir, cpu: make(map[string]cpuReading)}
+}
+
+func (r *Recorder) path(key string) string {
+	return filepath.Join(r.dir, key+".json")
+}
+
+// Load reads the totals of the current month recorded before a restart
+func (r *Recorder) Load(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := now.UTC().Format(MonthFormat)
+	loaded, err := readMonth(r.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		r.current = month{Month: key, Servers: make(map[string]*Totals)}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.current = *loaded
+	return nil
+}
+
+func readMonth(path string) (*month, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var loaded month
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if loaded.Servers == nil {
+		loaded.Servers = make(map[string]*Totals)
+	}
+	return &loaded, nil
+}
+
+// Record adds one round of samples taken at now and saves the month. When
+// now falls into a new month, the previous one is closed and its key
+// returned so that its reports can be published.
+func (r *Recorder) Record(now time.Time, samples []Sample) (closed string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := now.UTC().Format(MonthFormat)
+	if r.current.Month != key {
+		if r.current.Month != "" && len(r.current.Servers) > 0 {
+			closed = r.current.Month
+		}
+		r.current = month{Month: key, Servers: make(map[string]*Totals)}
+	}
+
+	elapsed := sampleInterval
+	if !r.last.IsZero() {
+		elapsed = min(now.Sub(r.last), maxSampleGap)
+	}
+	r.last = now
+
+	for _, sample := range samples {
+		totals, exists := r.current.Servers[sample.Server]
+		if !exists {
+			totals = &Totals{}
+			r.current.Servers[sample.Server] = totals
+		}
+		totals.Tenant = sample.Tenant
+		totals.PeakPlayers = max(totals.PeakPlayers, sample.Players)
+		if sample.Storage > 0 {
+			totals.Storage = max(totals.Storage, sample.Storage)
+		}
+		if !sample.Running {
+			delete(r.cpu, sample.Server)
+			continue
+		}
+
+		totals.UptimeSeconds += elapsed.Seconds()
+		totals.MemoryByteSeconds += float64(sample.Memory) * elapsed.Seconds()
+		totals.PeakMemory = max(totals.PeakMemory, sample.Memory)
+		// CPU time is cumulative per process, a new process starts over
+		if previous, seen := r.cpu[sample.Server]; seen && previous.pid == sample.PID && sample.CPUSeconds >= previous.seconds {
+			totals.CPUSeconds += sample.CPUSeconds - previous.seconds
+		}
+		if sample.PID != 0 {
+			r.cpu[sample.Server] = cpuReading{pid: sample.PID, seconds: sample.CPUSeconds}
+		}
+	}
+
+	return closed, r.save()
+}
+
+// save writes the current month.
+// The caller must hold r.mu.
+func (r *Recorder) save() error {
+	if err := os.MkdirAll(r.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(r.current, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := r.path(r.current.Month)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Months lists the recorded months, oldest first
+func (r *Recorder) Months() ([]string, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	var months []string
+	for _, entry := range entries {
+		key, isMonth := strings.CutSuffix(entry.Name(), ".json")
+		if _, err := time.Parse(MonthFormat, key); isMonth && err == nil {
+			months = append(months, key)
+		}
+	}
+	sort.Strings(months)
+	return months, nil
+}
+
+// Prune removes the months older than keep months before now
+func (r *Recorder) Prune(now time.Time, keep int) error {
+	months, err := r.Months()
+	if err != nil {
+		return err
+	}
+	cutoff := now.UTC().AddDate(0, -keep, 0).Format(MonthFormat)
+	for _, key := range months {
+		if key < cutoff {
+			if err := os.Remove(r.path(key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ServerUsage is the usage of one server in a report
+type ServerUsage struct {
+	Server          string  `json:"server"`
+	Tenant          string  `json:"tenant,omitempty"`
+	UptimeHours     float64 `json:"uptime_hours"`
+	PeakPlayers     int     `json:"peak_players"`
+	CPUCoreHours    float64 `json:"cpu_core_hours"`
+	AvgMemoryBytes  int64   `json:"avg_memory_bytes"`
+	PeakMemoryBytes int64   `json:"peak_memory_bytes"`
+	StorageBytes    int64   `json:"storage_bytes"`
+}
+
+// Report is the usage of servers over one month
+type Report struct {
+	Month     string        `json:"month"`
+	Generated time.Time     `json:"generated"`
+	Servers   []ServerUsage `json:"servers"`
+}
+
+// Report builds the report of a month, which may still be in progress
+func (r *Recorder) Report(key string, now time.Time) (*Report, error) {
+	if _, err := time.Parse(MonthFormat, key); err != nil {
+		return nil, fmt.Errorf("invalid month %q (must look like 2024-05)", key)
+	}
+
+	r.mu.Lock()
+	var recorded *month
+	if key == r.current.Month {
+		copied := month{Month: key, Servers: make(map[string]*Totals, len(r.current.Servers))}
+		for server, totals := range r.current.Servers {
+			t := *totals
+			copied.Servers[server] = &t
+		}
+		recorded = &copied
+	}
+	r.mu.Unlock()
+
+	if recorded == nil {
+		loaded, err := readMonth(r.path(key))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrNoUsage, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		recorded = loaded
+	}
+
+	report := &Report{Month: key, Generated: now, Servers: []ServerUsage{}}
+	for server, totals := range recorded.Servers {
+		row := ServerUsage{
+			Server:          server,
+			Tenant:          totals.Tenant,
+			UptimeHours:     totals.UptimeSeconds / 3600,
+			PeakPlayers:     totals.PeakPlayers,
+			CPUCoreHours:    totals.CPUSeconds / 3600,
+			PeakMemoryBytes: totals.PeakMemory,
+			StorageBytes:    totals.Storage,
+		}
+		if totals.UptimeSeconds > 0 {
+			row.AvgMemoryBytes = int64(totals.MemoryByteSeconds / totals.UptimeSeconds)
+		}
+		report.Servers = append(report.Servers, row)
+	}
+	sort.Slice(report.Servers, func(i, j int) bool {
+		a, b := report.Servers[i], report.Servers[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Server < b.Server
+	})
+	return report, nil
+}
+
+// ErrNoUsage is returned for months without recorded usage
+var ErrNoUsage = errors.New("no usage recorded")
+
+// Filter returns the report with only the servers keep accepts
+func (rep *Report) Filter(keep func(usage ServerUsage) bool) *Report {
+	filtered := &Report{Month: rep.Month, Generated: rep.Generated, Servers: []ServerUsage{}}
+	for _, usage := range rep.Servers {
+		if keep(usage) {
+			filtered.Servers = append(filtered.Servers, usage)
+		}
+	}
+	return filtered
+}
+
+// Tenant returns the part of the report about one tenant
+func (rep *Report) Tenant(tenant string) *Report {
+	return rep.Filter(func(usage ServerUsage) bool { return usage.Tenant == tenant })
+}
+
+// Tenants lists the tenants in the report, without servers that have none
+func (rep *Report) Tenants() []string {
+	var tenants []string
+	for _, usage := range rep.Servers {
+		if usage.Tenant != "" && (len(tenants) == 0 || tenants[len(tenants)-1] != usage.Tenant) {
+			tenants = append(tenants, usage.Tenant)
+		}
+	}
+	return tenants
+}
+
+// csvHeader names the columns of WriteCSV
+var csvHeader = []string{"month", "tenant", "server", "uptime_hours", "peak_players", "cpu_core_hours", "avg_memory_bytes", "peak_memory_bytes", "storage_bytes"}
+
+// WriteCSV writes the report as CSV with a header row
+func (rep *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+	for _, usage := range rep.Servers {
+		writer.Write([]string{
+			rep.Month,
+			usage.Tenant,
+			usage.Server,
+			strconv.FormatFloat(usage.UptimeHours, 'f', 2, 64),
+			strconv.Itoa(usage.PeakPlayers),
+			strconv.FormatFloat(usage.CPUCoreHours, 'f', 2, 64),
+			strconv.FormatInt(usage.AvgMemoryBytes, 10),
+			strconv.FormatInt(usage.PeakMemoryBytes, 10),
+			strconv.FormatInt(usage.StorageBytes, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,679 @@
+// Package partyclient is a typed Go client for the management API. Its
+// operations mirror the OpenAPI document served at /openapi.json and reuse
+// the manager's response types, so callers never hand-roll request or
+// response structs.
+package partyclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"minecraft-server-manager/internal/audit"
+	"minecraft-server-manager/internal/config"
+	"minecraft-server-manager/internal/github"
+	"minecraft-server-manager/internal/logging"
+	"minecraft-server-manager/internal/proxy"
+	"minecraft-server-manager/internal/server"
+	"minecraft-server-manager/internal/uptime"
+	"minecraft-server-manager/internal/usage"
+	"minecraft-server-manager/internal/websocket"
+)
+
+// Client calls the management API at one address
+type Client struct {
+	addr  string
+	http  *http.Client
+	token string
+}
+
+// Error is an error response of the management API
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.Status)
+}
+
+// PromoteRequest is the body of a promotion
+type PromoteRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	SHA  string `json:"sha,omitempty"`
+}
+
+// ConfigChangeRequest changes the allowlist or player limit of a server in
+// the configuration repository. Mode is commit or pull_request, empty for
+// the manager's github.write_back.
+type ConfigChangeRequest struct {
+	config.ServerEdit
+	Mode string `json:"mode,omitempty"`
+}
+
+// CommandRequest is a console command and how long its output is
+// captured: until a line matches Expect, for QuietMS without output when
+// there is no Expect, or for TimeoutMS. Zero uses the server defaults.
+type CommandRequest struct {
+	Command   string `json:"command"`
+	Expect    string `json:"expect,omitempty"`
+	QuietMS   int    `json:"quiet_ms,omitempty"`
+	TimeoutMS int    `json:"timeout_ms,omitempty"`
+}
+
+// New creates a client for the API at addr, e.g. http://localhost:8080.
+// A nil httpClient uses http.DefaultClient.
+func New(addr string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{addr: strings.TrimRight(addr, "/"), http: httpClient}
+}
+
+// SetToken authenticates requests with an API bearer token
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// Status returns the status of the manager and every server
+func (c *Client) Status(ctx context.Context) (*server.ManagerStatus, error) {
+	var status server.ManagerStatus
+	return &status, c.do(ctx, http.MethodGet, "/status", nil, &status)
+}
+
+// Servers returns the servers matching a query, one page at a time
+func (c *Client) Servers(ctx context.Context, query server.ServerQuery) (*server.ServerList, error) {
+	values := url.Values{}
+	if len(query.Statuses) > 0 {
+		values.Set("status", strings.Join(query.Statuses, ","))
+	}
+	if len(query.Groups) > 0 {
+		values.Set("group", strings.Join(query.Groups, ","))
+	}
+	if len(query.Tenants) > 0 {
+		values.Set("tenant", strings.Join(query.Tenants, ","))
+	}
+	if query.Sort != "" {
+		values.Set("sort", query.Sort)
+	}
+	if query.Limit > 0 {
+		values.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if query.Offset > 0 {
+		values.Set("offset", strconv.Itoa(query.Offset))
+	}
+	path := "/servers"
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	var list server.ServerList
+	return &list, c.do(ctx, http.MethodGet, path, nil, &list)
+}
+
+// Readiness returns the readiness checks. A manager that is not ready is
+// not an error, Ready is false instead.
+func (c *Client) Readiness(ctx context.Context) (*server.Readiness, error) {
+	var readiness server.Readiness
+	err := c.do(ctx, http.MethodGet, "/readyz", nil, &readiness)
+	if apiErr, ok := err.(*Error); ok && apiErr.Status == http.StatusServiceUnavailable {
+		return &readiness, nil
+	}
+	return &readiness, err
+}
+
+// Shutdown returns the progress of a shutdown, an *Error with status 404
+// while the manager is running
+func (c *Client) Shutdown(ctx context.Context) (*server.ShutdownStatus, error) {
+	var status server.ShutdownStatus
+	return &status, c.do(ctx, http.MethodGet, "/shutdown", nil, &status)
+}
+
+// ImportWorld replaces the world of a server with a .mcworld archive
+func (c *Client) ImportWorld(ctx context.Context, name string, archive io.Reader) error {
+	return c.send(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/world/import", "application/octet-stream", archive, nil)
+}
+
+// ExportWorld downloads a consistent copy of the world of a server as a
+// .mcworld archive
+func (c *Client) ExportWorld(ctx context.Context, name string, w io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/world/export", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp, nil)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// MigrateWorld replaces the world of the server to with the world of the
+// server from, both managed by this manager
+func (c *Client) MigrateWorld(ctx context.Context, from, to string) (*server.MigrationResult, error) {
+	var result server.MigrationResult
+	request := map[string]string{"from": from}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(to)+"/world/migrate", request, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ResetWorld resets the world of a server
+func (c *Client) ResetWorld(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/world/reset", nil, nil)
+}
+
+// TrimWorld removes the chunks beyond the trim radius from the world of a
+// server
+func (c *Client) TrimWorld(ctx context.Context, name string) (*server.TrimResult, error) {
+	var result server.TrimResult
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/world/trim", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Restart stops and starts a server
+func (c *Client) Restart(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/restart", nil, nil)
+}
+
+// Suspend freezes a running server, keeping its memory
+func (c *Client) Suspend(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/suspend", nil, nil)
+}
+
+// Resume continues a paused server
+func (c *Client) Resume(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/resume", nil, nil)
+}
+
+// Backups lists the backups of the world of a server, oldest first
+func (c *Client) Backups(ctx context.Context, name string) ([]server.Backup, error) {
+	var backups []server.Backup
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/backups", nil, &backups); err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
+
+// Backup backs up the world of a server
+func (c *Client) Backup(ctx context.Context, name string) (*server.Backup, error) {
+	var backup server.Backup
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/backups", nil, &backup); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// RestoreBackup replaces the world of a server with one of its backups
+func (c *Client) RestoreBackup(ctx context.Context, name, id string) (*server.Backup, error) {
+	var backup server.Backup
+	path := "/servers/" + url.PathEscape(name) + "/backups/" + url.PathEscape(id) + "/restore"
+	if err := c.do(ctx, http.MethodPost, path, nil, &backup); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+// Release lifts the quarantine of a server that exceeded the restart budget
+func (c *Client) Release(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/release", nil, nil)
+}
+
+// ConfirmVersion lets a server open its world with a Bedrock version the
+// world version guard refuses, a downgrade or a major upgrade. An empty
+// version confirms the configured one.
+func (c *Client) ConfirmVersion(ctx context.Context, name, version string) error {
+	request := map[string]string{"version": version}
+	return c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/confirm-version", request, nil)
+}
+
+// Command runs a command on the console of a running server and returns
+// the output that followed it
+func (c *Client) Command(ctx context.Context, name string, request CommandRequest) (*server.CommandResult, error) {
+	var result server.CommandResult
+	return &result, c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/command", request, &result)
+}
+
+// RunMacro starts a macro of the configuration on a running server with
+// args overriding its defaults. It returns once the commands are rendered,
+// the steps run in the background.
+func (c *Client) RunMacro(ctx context.Context, name, macro string, args map[string]string) (*server.MacroRun, error) {
+	var run server.MacroRun
+	request := map[string]interface{}{"args": args}
+	return &run, c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/macros/"+url.PathEscape(macro), request, &run)
+}
+
+// Teleport teleports an online player to a position
+func (c *Client) Teleport(ctx context.Context, name, player string, position server.Position) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/players/"+url.PathEscape(player)+"/teleport", map[string]interface{}{"position": position})
+}
+
+// TeleportToPlayer teleports an online player to another player
+func (c *Client) TeleportToPlayer(ctx context.Context, name, player, to string) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/players/"+url.PathEscape(player)+"/teleport", map[string]interface{}{"to": to})
+}
+
+// SetGamemode changes the game mode of an online player
+func (c *Client) SetGamemode(ctx context.Context, name, player, gamemode string) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/players/"+url.PathEscape(player)+"/gamemode", map[string]interface{}{"gamemode": gamemode})
+}
+
+// ClearInventory clears the inventory of an online player, only the given
+// item when item is set
+func (c *Client) ClearInventory(ctx context.Context, name, player, item string) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/players/"+url.PathEscape(player)+"/clear", map[string]interface{}{"item": item})
+}
+
+// Give gives an online player amount of an item
+func (c *Client) Give(ctx context.Context, name, player, item string, amount int) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/players/"+url.PathEscape(player)+"/give", map[string]interface{}{"item": item, "amount": amount})
+}
+
+// SetWeather sets the weather of a running server
+func (c *Client) SetWeather(ctx context.Context, name, weather string) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/weather", map[string]interface{}{"weather": weather})
+}
+
+// SetTime sets the time of day of a running server, by name or in ticks
+func (c *Client) SetTime(ctx context.Context, name, time string) (*server.CommandResult, error) {
+	return c.moderate(ctx, "/servers/"+url.PathEscape(name)+"/time", map[string]interface{}{"time": time})
+}
+
+// Players lists the players seen by the manager; a non-empty name returns
+// only those who use or used that gamertag
+func (c *Client) Players(ctx context.Context, name string) ([]server.KnownPlayer, error) {
+	path := "/players"
+	if name != "" {
+		path += "?name=" + url.QueryEscape(name)
+	}
+	var players []server.KnownPlayer
+	if err := c.do(ctx, http.MethodGet, path, nil, &players); err != nil {
+		return nil, err
+	}
+	return players, nil
+}
+
+// Bans lists the players banned from a server
+func (c *Client) Bans(ctx context.Context, name string) ([]server.Ban, error) {
+	var bans []server.Ban
+	if err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/bans", nil, &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// Ban bans a player from a server and, when it syncs bans, from its group.
+// It returns the servers the ban applies to.
+func (c *Client) Ban(ctx context.Context, name, player, reason string) ([]string, error) {
+	var response struct {
+		Servers []string `json:"servers"`
+	}
+	request := map[string]interface{}{"player": player, "reason": reason}
+	if err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(name)+"/bans", request, &response); err != nil {
+		return nil, err
+	}
+	return response.Servers, nil
+}
+
+// Unban lifts the ban of a player on a server and the servers it was
+// propagated to. It returns the servers the ban was lifted on.
+func (c *Client) Unban(ctx context.Context, name, player string) ([]string, error) {
+	var response struct {
+		Servers []string `json:"servers"`
+	}
+	if err := c.do(ctx, http.MethodDelete, "/servers/"+url.PathEscape(name)+"/bans/"+url.PathEscape(player), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Servers, nil
+}
+
+func (c *Client) moderate(ctx context.Context, path string, request interface{}) (*server.CommandResult, error) {
+	var result server.CommandResult
+	return &result, c.do(ctx, http.MethodPost, path, request, &result)
+}
+
+// Console attaches to the console of a running server. Received messages
+// are console lines, sent messages are run as commands. The first backlog
+// messages are recent output.
+func (c *Client) Console(ctx context.Context, name string, backlog int) (*websocket.Conn, error) {
+	return c.dial(ctx, "/servers/"+url.PathEscape(name)+"/console?backlog="+strconv.Itoa(backlog))
+}
+
+// Events subscribes to the activity of the manager. Every received message
+// is one JSON encoded events.Event. Empty types or servers receive every
+// event; a non-zero since first replays the remembered events after that ID.
+func (c *Client) Events(ctx context.Context, types, servers []string, since uint64) (*websocket.Conn, error) {
+	query := url.Values{}
+	if len(types) > 0 {
+		query.Set("type", strings.Join(types, ","))
+	}
+	if len(servers) > 0 {
+		query.Set("server", strings.Join(servers, ","))
+	}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	path := "/events"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return c.dial(ctx, path)
+}
+
+// dial opens a WebSocket to an API path
+func (c *Client) dial(ctx context.Context, path string) (*websocket.Conn, error) {
+	wsURL := "ws" + strings.TrimPrefix(c.addr, "http") + path
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	var tlsConfig *tls.Config
+	if transport, ok := c.http.Transport.(*http.Transport); ok {
+		tlsConfig = transport.TLSClientConfig
+	}
+
+	conn, err := websocket.Dial(ctx, wsURL, header, tlsConfig)
+	var handshakeErr *websocket.HandshakeError
+	if errors.As(err, &handshakeErr) {
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal([]byte(handshakeErr.Body), &errResp) != nil || errResp.Error == "" {
+			errResp.Error = http.StatusText(handshakeErr.Status)
+		}
+		return nil, &Error{Status: handshakeErr.Status, Message: errResp.Error}
+	}
+	return conn, err
+}
+
+// Logs returns up to limit console lines of a server after the sequence
+// number since, all of them when limit is 0. Pass the Next of the page
+// read before as since to read on.
+func (c *Client) Logs(ctx context.Context, name string, since uint64, limit int) (*server.LogPage, error) {
+	query := url.Values{}
+	query.Set("since", strconv.FormatUint(since, 10))
+	query.Set("limit", strconv.Itoa(limit))
+	var page server.LogPage
+	return &page, c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/logs?"+query.Encode(), nil, &page)
+}
+
+// Uptime returns the availability of a server
+func (c *Client) Uptime(ctx context.Context, name string) (*uptime.Report, error) {
+	var report uptime.Report
+	return &report, c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/uptime", nil, &report)
+}
+
+// Warnings returns the content log warnings of a server
+func (c *Client) Warnings(ctx context.Context, name string) ([]server.ContentWarning, error) {
+	var warnings []server.ContentWarning
+	return warnings, c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/warnings", nil, &warnings)
+}
+
+// Traffic returns the proxy traffic of a server
+func (c *Client) Traffic(ctx context.Context, name string) (*proxy.Stats, error) {
+	var stats proxy.Stats
+	return &stats, c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/traffic", nil, &stats)
+}
+
+// CollectGarbage removes unreferenced versions, templates and packs, or only
+// reports them with dryRun set
+func (c *Client) CollectGarbage(ctx context.Context, dryRun bool) (*server.GCReport, error) {
+	var report server.GCReport
+	return &report, c.do(ctx, http.MethodPost, "/gc?dry_run="+strconv.FormatBool(dryRun), nil, &report)
+}
+
+// Drift returns the drift found by the last check
+func (c *Client) Drift(ctx context.Context) (*server.DriftReport, error) {
+	var report server.DriftReport
+	return &report, c.do(ctx, http.MethodGet, "/drift", nil, &report)
+}
+
+// CheckDrift checks running servers for drift now and, with correct set,
+// writes drifted files again
+func (c *Client) CheckDrift(ctx context.Context, correct bool) (*server.DriftReport, error) {
+	var report server.DriftReport
+	return &report, c.do(ctx, http.MethodPost, "/drift?correct="+strconv.FormatBool(correct), nil, &report)
+}
+
+// Lock returns the lock of a server
+func (c *Client) Lock(ctx context.Context, name string) (*server.LockedServer, error) {
+	var lock server.LockedServer
+	return &lock, c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(name)+"/lock", nil, &lock)
+}
+
+// LockServer locks the settings of a server until a time
+func (c *Client) LockServer(ctx context.Context, name, reason string, until time.Time) (*server.LockedServer, error) {
+	var lock server.LockedServer
+	request := map[string]interface{}{"reason": reason, "until": until}
+	return &lock, c.do(ctx, http.MethodPut, "/servers/"+url.PathEscape(name)+"/lock", request, &lock)
+}
+
+// UnlockServer lifts the lock of a server
+func (c *Client) UnlockServer(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/servers/"+url.PathEscape(name)+"/lock", nil, nil)
+}
+
+// Freeze returns the freeze in place; a 404 error means the manager is not
+// frozen
+func (c *Client) Freeze(ctx context.Context) (*server.Freeze, error) {
+	var freeze server.Freeze
+	return &freeze, c.do(ctx, http.MethodGet, "/freeze", nil, &freeze)
+}
+
+// FreezeManager stops the manager from applying configuration and
+// restarting servers until Unfreeze is called
+func (c *Client) FreezeManager(ctx context.Context, reason string) (*server.Freeze, error) {
+	var freeze server.Freeze
+	return &freeze, c.do(ctx, http.MethodPut, "/freeze", map[string]string{"reason": reason}, &freeze)
+}
+
+// Unfreeze lifts the freeze of the manager
+func (c *Client) Unfreeze(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/freeze", nil, nil)
+}
+
+// Promote promotes the configuration of one environment to another
+func (c *Client) Promote(ctx context.Context, request PromoteRequest) (*github.Promotion, error) {
+	var promotion github.Promotion
+	return &promotion, c.do(ctx, http.MethodPost, "/promote", request, &promotion)
+}
+
+// ChangeServerConfig writes a change of a server's configuration back to
+// its configuration repository
+func (c *Client) ChangeServerConfig(ctx context.Context, name string, request ConfigChangeRequest) (*github.Change, error) {
+	var change github.Change
+	return &change, c.do(ctx, http.MethodPatch, "/servers/"+url.PathEscape(name)+"/config", request, &change)
+}
+
+// BulkCreate generates copies of a configured server and, when the spec
+// asks for it, commits them to the configuration
+func (c *Client) BulkCreate(ctx context.Context, spec server.BulkSpec) (*server.BulkResult, error) {
+	var result server.BulkResult
+	return &result, c.do(ctx, http.MethodPost, "/bulk", spec, &result)
+}
+
+// Applies returns the apply history
+func (c *Client) Applies(ctx context.Context) ([]server.ApplyRecord, error) {
+	var applies []server.ApplyRecord
+	return applies, c.do(ctx, http.MethodGet, "/applies", nil, &applies)
+}
+
+// ApplySLO returns the success rate, lead time and duration of applies
+// over rolling windows
+func (c *Client) ApplySLO(ctx context.Context) (*server.ApplySLOReport, error) {
+	var report server.ApplySLOReport
+	return &report, c.do(ctx, http.MethodGet, "/applies/slo", nil, &report)
+}
+
+// ApplyDiff returns what the apply of a commit changed
+func (c *Client) ApplyDiff(ctx context.Context, sha string) (*server.ApplyDiff, error) {
+	var diff server.ApplyDiff
+	return &diff, c.do(ctx, http.MethodGet, "/applies/"+url.PathEscape(sha)+"/diff", nil, &diff)
+}
+
+// CrashReports lists the crash reports
+func (c *Client) CrashReports(ctx context.Context) ([]server.CrashReport, error) {
+	var reports []server.CrashReport
+	return reports, c.do(ctx, http.MethodGet, "/reports", nil, &reports)
+}
+
+// DownloadCrashReport writes the bundle of a crash report to w
+func (c *Client) DownloadCrashReport(ctx context.Context, name string, w io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, "/reports/"+url.PathEscape(name), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp, nil)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Audit returns up to limit of the most recent mutating API calls, the
+// server default with limit 0
+func (c *Client) Audit(ctx context.Context, limit int) ([]audit.Entry, error) {
+	path := "/audit"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	var entries []audit.Entry
+	return entries, c.do(ctx, http.MethodGet, path, nil, &entries)
+}
+
+// Logging returns the level, format and outputs of the manager log
+func (c *Client) Logging(ctx context.Context) (*logging.Settings, error) {
+	var settings logging.Settings
+	return &settings, c.do(ctx, http.MethodGet, "/logging", nil, &settings)
+}
+
+// UpdateLogging changes the level, format or outputs of the manager log,
+// keeping those left empty
+func (c *Client) UpdateLogging(ctx context.Context, settings logging.Settings) (*logging.Settings, error) {
+	var updated logging.Settings
+	return &updated, c.do(ctx, http.MethodPut, "/logging", settings, &updated)
+}
+
+// UsageMonths returns the months with recorded usage, oldest first
+func (c *Client) UsageMonths(ctx context.Context) ([]string, error) {
+	var months []string
+	return months, c.do(ctx, http.MethodGet, "/usage", nil, &months)
+}
+
+// UsageReport returns the usage of every server in a month such as
+// "2024-05", limited to some tenants when given
+func (c *Client) UsageReport(ctx context.Context, month string, tenants []string) (*usage.Report, error) {
+	var report usage.Report
+	return &report, c.do(ctx, http.MethodGet, usagePath(month, tenants, false), nil, &report)
+}
+
+// UsageReportCSV writes the usage report of a month as CSV to w
+func (c *Client) UsageReportCSV(ctx context.Context, month string, tenants []string, w io.Writer) error {
+	resp, err := c.request(ctx, http.MethodGet, usagePath(month, tenants, true), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return responseError(resp, nil)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func usagePath(month string, tenants []string, csv bool) string {
+	values := url.Values{}
+	if len(tenants) > 0 {
+		values.Set("tenant", strings.Join(tenants, ","))
+	}
+	if csv {
+		values.Set("format", "csv")
+	}
+	path := "/usage/" + url.PathEscape(month)
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+	return path
+}
+
+// OpenAPI returns the OpenAPI document of the API
+func (c *Client) OpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	var document map[string]interface{}
+	return document, c.do(ctx, http.MethodGet, "/openapi.json", nil, &document)
+}
+
+// do sends body as JSON and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	if body == nil {
+		return c.send(ctx, method, path, "", nil, out)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, "application/json", bytes.NewReader(data), out)
+}
+
+// send sends a request and decodes the JSON response into out. The body of
+// an error response is decoded into out as well, so responses that carry a
+// status such as /readyz can still be read.
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	resp, err := c.request(ctx, method, path, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp, out)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) request(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.addr+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+// responseError reads an error response as *Error, decoding its body into
+// out if set
+func responseError(resp *http.Response, out interface{}) error {
+	data, _ := io.ReadAll(resp.Body)
+	if out != nil {
+		json.Unmarshal(data, out)
+	}
+
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(data, &errResp); err != nil || errResp.Error == "" {
+		errResp.Error = http.StatusText(resp.StatusCode)
+	}
+	return &Error{Status: resp.StatusCode, Message: errResp.Error}
+}